@@ -0,0 +1,142 @@
+package ciam
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AuditEventType defines the authentication flow recorded in the audit trail.
+type AuditEventType string
+
+const (
+	AuditEventSigninAnonym       AuditEventType = "signin_anonym"
+	AuditEventSigninUser         AuditEventType = "signin_user"
+	AuditEventSecretConfirmation AuditEventType = "secret_confirmation"
+	AuditEventTokensRefresh      AuditEventType = "tokens_refresh"
+)
+
+// AuditOutcome defines the outcome of the authentication flow.
+type AuditOutcome string
+
+const (
+	AuditOutcomeSuccess AuditOutcome = "success"
+	AuditOutcomeFailure AuditOutcome = "failure"
+)
+
+// AuditEvent defines the audit trail's record of the authentication flow.
+// Note that the record shall never contain the secrets, or the tokens.
+type AuditEvent struct {
+	Type    AuditEventType `json:"type"`
+	Outcome AuditOutcome   `json:"outcome"`
+	// UserID the user's ID, it is empty if the flow failed before the user was identified.
+	UserID string `json:"user_id,omitempty"`
+	// Reason the failure reason communicated to the client.
+	Reason    string    `json:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AuditSink defines the interface to send the audit events to.
+type AuditSink interface {
+	Emit(ctx context.Context, event AuditEvent)
+}
+
+// NewJSONAuditSink initialises the AuditSink which writes the events to w as JSON lines.
+func NewJSONAuditSink(w io.Writer) AuditSink {
+	return &jsonAuditSink{w: w}
+}
+
+type jsonAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *jsonAuditSink) Emit(_ context.Context, event AuditEvent) {
+	o, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = s.w.Write(append(o, '\n'))
+}
+
+type noopAuditSink struct{}
+
+func (noopAuditSink) Emit(_ context.Context, _ AuditEvent) {}
+
+type MockAuditSink struct {
+	Events []AuditEvent
+}
+
+func (m *MockAuditSink) Emit(_ context.Context, event AuditEvent) {
+	m.Events = append(m.Events, event)
+}
+
+// HTTPHandlerOps defines the options of the CIAM middleware.
+type HTTPHandlerOps func(c *client)
+
+// WithAuditSink sets the sink to send the audit events of the authentication flows to.
+func WithAuditSink(sink AuditSink) HTTPHandlerOps {
+	return func(c *client) {
+		if sink != nil {
+			c.auditSink = sink
+		}
+	}
+}
+
+// withAudit emits the audit event of the authentication flow once it is completed.
+// The flow's outcome is defined by the response status code, and the failure reason by the response's error.
+func (c client) withAudit(eventType AuditEventType, flow http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		aw := &auditResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		flow(aw, r)
+
+		event := AuditEvent{
+			Type:      eventType,
+			Outcome:   AuditOutcomeSuccess,
+			UserID:    aw.userID,
+			Timestamp: time.Now().UTC(),
+		}
+		if aw.statusCode >= http.StatusBadRequest {
+			event.Outcome = AuditOutcomeFailure
+			var resp struct {
+				Error string `json:"error"`
+			}
+			_ = json.Unmarshal(aw.body, &resp)
+			event.Reason = resp.Error
+		}
+		c.auditSink.Emit(r.Context(), event)
+	}
+}
+
+// auditResponseWriter records the response status code, and the response body of the failed flow.
+// The successful flow's response is not recorded because it contains the tokens.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       []byte
+	userID     string
+}
+
+func (w *auditResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode >= http.StatusBadRequest {
+		w.body = append(w.body, b...)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// setAuditUserID sets the ID of the user identified by the authentication flow to the audit event.
+func setAuditUserID(w http.ResponseWriter, userID string) {
+	if aw, ok := w.(*auditResponseWriter); ok {
+		aw.userID = userID
+	}
+}
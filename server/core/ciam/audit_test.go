@@ -0,0 +1,170 @@
+package ciam
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kislerdm/diagramastext/server/core/internal/utils"
+)
+
+func TestClient_Audit(t *testing.T) {
+	const (
+		secret      = "foobar"
+		email       = "foo@bar.baz"
+		fingerprint = "c8f3b2dbcb0d2c4ddb54f3d9b5c0ba8b6e7e6d7a"
+	)
+
+	newRequest := func(path, body string) *http.Request {
+		return &http.Request{
+			Method: http.MethodPost,
+			URL:    &url.URL{Path: path},
+			Body:   io.NopCloser(bytes.NewReader([]byte(body))),
+		}
+	}
+
+	t.Run(
+		"shall emit the failure event given the wrong secret", func(t *testing.T) {
+			// GIVEN
+			userID := utils.NewUUID()
+			key := GenerateCertificate()
+			clientRepo := &MockRepositoryCIAM{
+				UserID: map[string]*userContainer{
+					userID: {ID: userID, Email: email, RoleID: uint8(RoleRegisteredUser)},
+				},
+				Secret: map[string]Secret{
+					userID: {Secret: secret, IssuedAt: time.Now()},
+				},
+			}
+			sink := &MockAuditSink{}
+
+			handlerFn, err := HTTPHandler(clientRepo, &MockSMTPClient{}, key, WithAuditSink(sink))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			iss, err := NewIssuer(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idToken, err := iss.NewIDToken(userID, email, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			handlerFn(nil).ServeHTTP(
+				&utils.MockWriter{},
+				newRequest("/auth/confirm", `{"secret":"wrong1","id_token":"`+idToken+`"}`),
+			)
+
+			// THEN
+			if len(sink.Events) != 1 {
+				t.Fatalf("one audit event expected, got: %+v", sink.Events)
+			}
+			got := sink.Events[0]
+			if got.Type != AuditEventSecretConfirmation || got.Outcome != AuditOutcomeFailure ||
+				got.UserID != userID || got.Reason != "secret is wrong" || got.Timestamp.IsZero() {
+				t.Errorf("unexpected audit event: %+v", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall emit the success event without the tokens", func(t *testing.T) {
+			// GIVEN
+			sink := &MockAuditSink{}
+			var buf bytes.Buffer
+			handlerFn, err := HTTPHandler(
+				&MockRepositoryCIAM{}, &MockSMTPClient{}, GenerateCertificate(),
+				WithAuditSink(sink),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writer := &utils.MockWriter{}
+
+			// WHEN
+			handlerFn(nil).ServeHTTP(writer, newRequest("/auth/anonym", `{"fingerprint":"`+fingerprint+`"}`))
+
+			// THEN
+			if writer.StatusCode != http.StatusOK {
+				t.Fatalf("unexpected status code: %d", writer.StatusCode)
+			}
+			if len(sink.Events) != 1 {
+				t.Fatalf("one audit event expected, got: %+v", sink.Events)
+			}
+			got := sink.Events[0]
+			if got.Type != AuditEventSigninAnonym || got.Outcome != AuditOutcomeSuccess || got.UserID == "" ||
+				got.Reason != "" {
+				t.Errorf("unexpected audit event: %+v", got)
+			}
+
+			NewJSONAuditSink(&buf).Emit(context.TODO(), got)
+			var tokens struct {
+				Access string `json:"access"`
+			}
+			if err := json.Unmarshal(writer.V, &tokens); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(buf.String(), tokens.Access) {
+				t.Error("audit event shall not contain the token")
+			}
+		},
+	)
+
+	t.Run(
+		"shall emit the failure event without user ID given invalid refresh token", func(t *testing.T) {
+			// GIVEN
+			sink := &MockAuditSink{}
+			handlerFn, err := HTTPHandler(
+				&MockRepositoryCIAM{}, &MockSMTPClient{}, GenerateCertificate(), WithAuditSink(sink),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			handlerFn(nil).ServeHTTP(&utils.MockWriter{}, newRequest("/auth/refresh", `{"refresh_token":"foo"}`))
+
+			// THEN
+			want := AuditEvent{Type: AuditEventTokensRefresh, Outcome: AuditOutcomeFailure, Reason: "token is not valid"}
+			if len(sink.Events) != 1 {
+				t.Fatalf("one audit event expected, got: %+v", sink.Events)
+			}
+			got := sink.Events[0]
+			got.Timestamp = time.Time{}
+			if got != want {
+				t.Errorf("unexpected audit event: got = %+v, want = %+v", got, want)
+			}
+		},
+	)
+}
+
+func TestNewJSONAuditSink(t *testing.T) {
+	// GIVEN
+	var buf bytes.Buffer
+	sink := NewJSONAuditSink(&buf)
+
+	// WHEN
+	sink.Emit(
+		context.TODO(), AuditEvent{
+			Type:      AuditEventSigninUser,
+			Outcome:   AuditOutcomeSuccess,
+			UserID:    "foo",
+			Timestamp: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	)
+
+	// THEN
+	const want = `{"type":"signin_user","outcome":"success","user_id":"foo","timestamp":"2023-01-01T00:00:00Z"}` + "\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output: got = %s, want = %s", buf.String(), want)
+	}
+}
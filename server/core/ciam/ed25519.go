@@ -1,6 +1,8 @@
 package ciam
 
 import (
+	"context"
+	"crypto"
 	"crypto/ed25519"
 	"crypto/x509"
 	"encoding/pem"
@@ -45,3 +47,34 @@ func MarshalKey(key ed25519.PrivateKey) ([]byte, error) {
 		},
 	), nil
 }
+
+func newEd25519SigningClient(key ed25519.PrivateKey) (TokenSigningClient, error) {
+	if key == nil {
+		return nil, errors.New("no valid ed25519 private key provided")
+	}
+	pubKey, ok := key.Public().(ed25519.PublicKey)
+	if !ok || len(pubKey) != ed25519.PublicKeySize {
+		return nil, errors.New("key is invalid")
+	}
+	return ed25519SigningClient{privKey: key, pubKey: pubKey}, nil
+}
+
+type ed25519SigningClient struct {
+	privKey ed25519.PrivateKey
+	pubKey  ed25519.PublicKey
+}
+
+func (c ed25519SigningClient) Alg() string {
+	return "EdDSA"
+}
+
+func (c ed25519SigningClient) Sign(_ context.Context, signingString string) ([]byte, error) {
+	return c.privKey.Sign(nil, []byte(signingString), crypto.Hash(0))
+}
+
+func (c ed25519SigningClient) Verify(_ context.Context, signingString string, signature []byte) error {
+	if !ed25519.Verify(c.pubKey, []byte(signingString), signature) {
+		return errors.New("wrong signature")
+	}
+	return nil
+}
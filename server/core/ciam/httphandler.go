@@ -4,6 +4,7 @@ package ciam
 import (
 	"context"
 	"crypto/ed25519"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"log"
@@ -21,7 +22,19 @@ type HTTPHandlerFn func(next http.Handler) http.Handler
 
 // HTTPHandler initializes the CIAM client.
 func HTTPHandler(
-	clientRepository RepositoryCIAM, clientEmail SMTPClient, privateKey ed25519.PrivateKey,
+	clientRepository RepositoryCIAM, clientEmail SMTPClient, privateKey ed25519.PrivateKey, fnOps ...HTTPHandlerOps,
+) (HTTPHandlerFn, error) {
+	signingClient, err := newEd25519SigningClient(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return HTTPHandlerWithSigningClient(clientRepository, clientEmail, signingClient, fnOps...)
+}
+
+// HTTPHandlerWithSigningClient initialises the CIAM middleware which signs tokens using the TokenSigningClient.
+func HTTPHandlerWithSigningClient(
+	clientRepository RepositoryCIAM, clientEmail SMTPClient, signingClient TokenSigningClient,
+	fnOps ...HTTPHandlerOps,
 ) (HTTPHandlerFn, error) {
 	if clientRepository == nil {
 		return nil, errors.New("repo client is required")
@@ -29,18 +42,29 @@ func HTTPHandler(
 	if clientEmail == nil {
 		return nil, errors.New("email client is required")
 	}
-	issuer, err := NewIssuer(privateKey)
+	issuer, err := NewIssuerWithSigningClient(signingClient)
 	if err != nil {
 		return nil, err
 	}
 	return func(next http.Handler) http.Handler {
-		return client{
+		c := client{
 			clientRepository: clientRepository,
 			clientEmail:      clientEmail,
 			tokenIssuer:      issuer,
 			logger:           log.New(os.Stderr, "", log.Lmicroseconds|log.LUTC|log.Lshortfile),
+			auditSink:        noopAuditSink{},
 			next:             next,
 		}
+		for _, fn := range fnOps {
+			fn(&c)
+		}
+		// the limit is applied regardless of the options' order
+		if c.authRateLimiter != nil && c.authRateLimitMaxClients > 0 {
+			c.authRateLimiter.buckets = newBuckets(c.authRateLimitMaxClients)
+		}
+		// the quotas are applied to the tenants regardless of the options' order
+		c.withRoleQuotas()
+		return c
 	}, nil
 }
 
@@ -51,6 +75,16 @@ type client struct {
 	clientRepository RepositoryCIAM
 	clientEmail      SMTPClient
 	tokenIssuer      Issuer
+	auditSink        AuditSink
+	authRateLimiter  *ipRateLimiter
+	// authRateLimitMaxClients overrides the default number of the rate limiter's buckets.
+	authRateLimitMaxClients int
+	// tenants the tenants by ID, see WithTenants.
+	tenants map[string]Tenant
+	// tenantProxies the proxies trusted to set the tenant's header, see WithTenantProxies.
+	tenantProxies utils.TrustedProxies
+	// roleQuotas the configured quotas per role, see WithRoleQuotas.
+	roleQuotas RoleQuotas
 }
 
 func (c client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -60,18 +94,32 @@ func (c client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if strings.HasPrefix(r.URL.Path, "/auth") && !c.authRateLimiter.allow(r) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":"too many requests"}`))
+		return
+	}
+
+	tenant, ok := c.tenant(c.headerTenant(r))
+	if !ok {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":"unknown tenant"}`))
+		return
+	}
+	r = r.WithContext(NewTenantContext(r.Context(), tenant))
+
 	switch p := r.URL.Path; p {
 	case "/auth/anonym":
-		c.signinAnonym(w, r)
+		c.withAudit(AuditEventSigninAnonym, c.signinAnonym)(w, r)
 		return
 	case "/auth/init":
-		c.signinUserInit(w, r)
+		c.withAudit(AuditEventSigninUser, c.signinUserInit)(w, r)
 		return
 	case "/auth/confirm":
-		c.signinUserInitSecretConfirmation(w, r)
+		c.withAudit(AuditEventSecretConfirmation, c.signinUserInitSecretConfirmation)(w, r)
 		return
 	case "/auth/refresh":
-		c.refreshAccessToken(w, r)
+		c.withAudit(AuditEventTokensRefresh, c.refreshAccessToken)(w, r)
 		return
 	default:
 		user, found, err := c.readUserFromHeader(r)
@@ -88,16 +136,22 @@ func (c client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if tenant, err = c.tokenTenant(tenant, user.Tenant); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":"` + err.Error() + `"}`))
+			return
+		}
+
 		if p == "/quotas" {
-			c.getQuotaUsage(w, r, user)
+			c.getQuotaUsage(w, r, user, tenant.RoleQuotas(user.Role))
 			return
 		}
 
-		if ok := c.validateRequestsQuotaUsage(w, r, user); !ok {
+		if ok := c.validateRequestsQuotaUsage(w, r, user, tenant.RoleQuotas(user.Role)); !ok {
 			return
 		}
 
-		r = r.WithContext(NewContext(r.Context(), user))
+		r = r.WithContext(NewTenantContext(NewContext(r.Context(), user), tenant))
 
 		if c.next != nil {
 			c.next.ServeHTTP(w, r)
@@ -106,14 +160,14 @@ func (c client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // getQuotaUsage reads current usage of the quota.
-func (c client) getQuotaUsage(w http.ResponseWriter, r *http.Request, user *User) {
+func (c client) getQuotaUsage(w http.ResponseWriter, r *http.Request, user *User, userQuotas Quotas) {
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		_, _ = w.Write([]byte(`{"error":"` + r.Method + ` is not allowed"}`))
 		return
 	}
 
-	quotas, err := getQuotaUsage(r.Context(), c.clientRepository, user)
+	quotas, err := getQuotaUsage(r.Context(), c.clientRepository, user, userQuotas)
 	if err != nil {
 		c.internalError(w, err)
 		return
@@ -131,8 +185,10 @@ func (c client) getQuotaUsage(w http.ResponseWriter, r *http.Request, user *User
 }
 
 // checks if the requests' quota was exceeded.
-func (c client) validateRequestsQuotaUsage(w http.ResponseWriter, r *http.Request, user *User) bool {
-	quotasUsage, err := getQuotaUsage(r.Context(), c.clientRepository, user)
+func (c client) validateRequestsQuotaUsage(
+	w http.ResponseWriter, r *http.Request, user *User, userQuotas Quotas,
+) bool {
+	quotasUsage, err := getQuotaUsage(r.Context(), c.clientRepository, user, userQuotas)
 	if err != nil {
 		c.internalError(w, err)
 		return false
@@ -182,6 +238,7 @@ func (c client) signinAnonym(w http.ResponseWriter, r *http.Request) {
 		c.internalError(w, err)
 		return
 	}
+	setAuditUserID(w, userID)
 
 	if userID != "" && !isActive {
 		w.WriteHeader(http.StatusForbidden)
@@ -199,10 +256,12 @@ func (c client) signinAnonym(w http.ResponseWriter, r *http.Request) {
 			c.internalError(w, err)
 			return
 		}
+		setAuditUserID(w, userID)
 	}
 
 	o, err := c.issueTokens(
-		r.Context(), User{ID: userID, Role: RoleAnonymUser}, "", req.Fingerprint,
+		r.Context(), User{ID: userID, Role: RoleAnonymUser, Tenant: TenantFromContext(r.Context()).ID}, "",
+		req.Fingerprint,
 	)
 	if err != nil {
 		c.internalError(w, err)
@@ -235,13 +294,12 @@ func (c client) signinUserInit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	const defaultExpirationSecret = 10 * time.Minute
-
 	userID, _, err := c.clientRepository.LookupUserByEmail(r.Context(), req.Email)
 	if err != nil {
 		c.internalError(w, err)
 		return
 	}
+	setAuditUserID(w, userID)
 
 	if userID == "" {
 		userID = utils.NewUUID()
@@ -252,6 +310,7 @@ func (c client) signinUserInit(w http.ResponseWriter, r *http.Request) {
 			c.internalError(w, err)
 			return
 		}
+		setAuditUserID(w, userID)
 	}
 
 	secret := generateOnetimeSecret()
@@ -263,6 +322,12 @@ func (c client) signinUserInit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := c.clientEmail.SendSignInEmail(req.Email, secret); err != nil {
+		if errors.Is(err, ErrEmailThrottled) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":"email cannot be sent now, retry later"}`))
+			c.logger.Println(err)
+			return
+		}
 		c.internalError(w, err)
 		return
 	}
@@ -280,6 +345,20 @@ func (c client) signinUserInit(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// defaultExpirationSecret defines the validity duration of the one-time secret.
+const defaultExpirationSecret = 10 * time.Minute
+
+func isExpiredSecret(issuedAt time.Time) bool {
+	return time.Since(issuedAt) > defaultExpirationSecret
+}
+
+// isValidSecret compares the secret against the reference in constant time to prevent the timing attacks.
+// Note that only the secret's length can be inferred from timing, because the comparison of the values
+// of different length returns immediately.
+func isValidSecret(secret, secretRef string) bool {
+	return secretRef != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(secretRef)) == 1
+}
+
 func (c client) internalError(w http.ResponseWriter, err error) {
 	w.WriteHeader(http.StatusInternalServerError)
 	_, _ = w.Write([]byte(`{"error":"internal error"}`))
@@ -310,8 +389,9 @@ func (c client) signinUserInitSecretConfirmation(w http.ResponseWriter, r *http.
 		c.internalError(w, err)
 		return
 	}
+	setAuditUserID(w, userID)
 
-	found, secretRef, _, err := c.clientRepository.ReadOneTimeSecret(r.Context(), userID)
+	found, secretRef, issuedAt, err := c.clientRepository.ReadOneTimeSecret(r.Context(), userID)
 	if err != nil {
 		c.internalError(w, err)
 		return
@@ -322,7 +402,14 @@ func (c client) signinUserInitSecretConfirmation(w http.ResponseWriter, r *http.
 		return
 	}
 
-	if req.Secret != secretRef {
+	// the repository is expected to clean up expired secrets, the check is kept as defense in depth
+	if isExpiredSecret(issuedAt) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":"secret expired"}`))
+		return
+	}
+
+	if !isValidSecret(req.Secret, secretRef) {
 		w.WriteHeader(http.StatusForbidden)
 		_, _ = w.Write([]byte(`{"error":"secret is wrong"}`))
 		return
@@ -336,7 +423,8 @@ func (c client) signinUserInitSecretConfirmation(w http.ResponseWriter, r *http.
 	_ = c.clientRepository.DeleteOneTimeSecret(r.Context(), userID)
 
 	o, err := c.issueTokens(
-		r.Context(), User{ID: userID, Role: RoleRegisteredUser}, email, fingerprint,
+		r.Context(), User{ID: userID, Role: RoleRegisteredUser, Tenant: TenantFromContext(r.Context()).ID}, email,
+		fingerprint,
 	)
 	if err != nil {
 		c.internalError(w, err)
@@ -362,7 +450,7 @@ func (c client) issueTokens(_ context.Context, user User, email, fingerprint str
 		return nil, err
 	}
 
-	refreshToken, err := c.tokenIssuer.NewRefreshToken(user.ID, WithCustomIat(iat))
+	refreshToken, err := c.tokenIssuer.NewRefreshToken(user.ID, user.Tenant, WithCustomIat(iat))
 	if err != nil {
 		return nil, err
 	}
@@ -391,13 +479,21 @@ func (c client) refreshAccessToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := c.tokenIssuer.ParseRefreshToken(req.Token)
+	userID, tenantID, err := c.tokenIssuer.ParseRefreshToken(req.Token)
 	if err != nil {
 		w.WriteHeader(http.StatusForbidden)
 		_, _ = w.Write([]byte(`{"error":"token is not valid"}`))
 		c.logger.Println(err)
 		return
 	}
+	setAuditUserID(w, userID)
+
+	tenant, err := c.tokenTenant(TenantFromContext(r.Context()), tenantID)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":"` + err.Error() + `"}`))
+		return
+	}
 
 	found, isActive, roleID, email, fingerprint, err := c.clientRepository.ReadUser(r.Context(), userID)
 	if err != nil {
@@ -408,6 +504,13 @@ func (c client) refreshAccessToken(w http.ResponseWriter, r *http.Request) {
 		c.internalError(w, errors.New("user not found"))
 		return
 	}
+	// the user who signed in with email is activated upon the email verification
+	if !isActive && email != "" {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":"email is not verified"}`))
+		c.logger.Printf("user %s has not verified email\n", userID)
+		return
+	}
 	if !isActive {
 		w.WriteHeader(http.StatusForbidden)
 		_, _ = w.Write([]byte(`{"error":"user was deactivated"}`))
@@ -417,7 +520,9 @@ func (c client) refreshAccessToken(w http.ResponseWriter, r *http.Request) {
 
 	iat := time.Now().UTC()
 
-	accToken, err := c.tokenIssuer.NewAccessToken(User{ID: userID, Role: Role(roleID)}, WithCustomIat(iat))
+	accToken, err := c.tokenIssuer.NewAccessToken(
+		User{ID: userID, Role: Role(roleID), Tenant: tenant.ID}, WithCustomIat(iat),
+	)
 	if err != nil {
 		c.internalError(w, err)
 		return
@@ -5,6 +5,7 @@ import (
 	"crypto/ed25519"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
@@ -110,7 +111,7 @@ func TestServeHTTP(t *testing.T) {
 						if _, err := iss.ParseAccessToken(o.Acc); err != nil {
 							t.Errorf("faulty Access token: %v", err)
 						}
-						if _, err := iss.ParseRefreshToken(o.Ref); err != nil {
+						if _, _, err := iss.ParseRefreshToken(o.Ref); err != nil {
 							t.Errorf("faulty Refresh token: %v", err)
 						}
 					}
@@ -265,7 +266,7 @@ func TestServeHTTP(t *testing.T) {
 							)
 						}
 
-						if _, err := iss.ParseRefreshToken(o.Ref); err != nil {
+						if _, _, err := iss.ParseRefreshToken(o.Ref); err != nil {
 							t.Errorf("faulty Refresh token: %v", err)
 						}
 
@@ -310,7 +311,7 @@ func TestServeHTTP(t *testing.T) {
 						t.Fatal(err)
 					}
 
-					refToken, err := iss.NewRefreshToken(wantUserID)
+					refToken, err := iss.NewRefreshToken(wantUserID, "")
 					if err != nil {
 						t.Fatal(err)
 					}
@@ -625,3 +626,233 @@ func (m mockHandlerAPIcall) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	return
 }
+
+func Test_client_signinUserInitSecretConfirmationExpiredSecret(t *testing.T) {
+	// GIVEN
+	userID := utils.NewUUID()
+	const (
+		secret = "foobar"
+		email  = "foo@bar.baz"
+	)
+
+	key := GenerateCertificate()
+	clientRepo := &MockRepositoryCIAM{
+		UserID: map[string]*userContainer{
+			userID: {
+				ID:     userID,
+				Email:  email,
+				RoleID: uint8(RoleRegisteredUser),
+			},
+		},
+		Secret: map[string]Secret{
+			userID: {
+				Secret:   secret,
+				IssuedAt: time.Now().Add(-defaultExpirationSecret - time.Minute),
+			},
+		},
+	}
+
+	handlerFn, err := HTTPHandler(clientRepo, &MockSMTPClient{}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iss, err := NewIssuer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idToken, err := iss.NewIDToken(userID, email, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := &http.Request{
+		Method: http.MethodPost,
+		URL: &url.URL{
+			Path: "/auth/confirm",
+		},
+		Body: io.NopCloser(
+			bytes.NewReader([]byte(`{"secret":"` + secret + `","id_token":"` + idToken + `"}`)),
+		),
+	}
+	writer := &utils.MockWriter{}
+
+	// WHEN
+	handlerFn(nil).ServeHTTP(writer, request)
+
+	// THEN
+	if writer.StatusCode != http.StatusForbidden {
+		t.Errorf("wrong status code. want: %d, got: %d", http.StatusForbidden, writer.StatusCode)
+	}
+	if wantBody := []byte(`{"error":"secret expired"}`); !reflect.DeepEqual(writer.V, wantBody) {
+		t.Errorf("wrong response content. want: %s, got: %s", wantBody, writer.V)
+	}
+	if clientRepo.UserID[userID].IsActive {
+		t.Errorf("user shall not be activated with the expired secret")
+	}
+}
+
+func Test_isValidSecret(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		secretRef string
+		want      bool
+	}{
+		{
+			name:      "equal secrets",
+			secret:    "a1b2c3",
+			secretRef: "a1b2c3",
+			want:      true,
+		},
+		{
+			name:      "different secrets of equal length",
+			secret:    "a1b2c4",
+			secretRef: "a1b2c3",
+			want:      false,
+		},
+		{
+			name:      "secret is the reference's prefix",
+			secret:    "a1b2c",
+			secretRef: "a1b2c3",
+			want:      false,
+		},
+		{
+			name:      "reference is the secret's prefix",
+			secret:    "a1b2c3d",
+			secretRef: "a1b2c3",
+			want:      false,
+		},
+		{
+			name:      "empty secrets",
+			secret:    "",
+			secretRef: "",
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := isValidSecret(tt.secret, tt.secretRef); got != tt.want {
+					t.Errorf("isValidSecret() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_client_refreshAccessTokenEmailVerification(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       userContainer
+		wantStatus int
+		wantBody   []byte
+	}{
+		{
+			name: "shall reject the user with unverified email",
+			user: userContainer{
+				Email:    "foo@bar.baz",
+				IsActive: false,
+				RoleID:   uint8(RoleRegisteredUser),
+			},
+			wantStatus: http.StatusForbidden,
+			wantBody:   []byte(`{"error":"email is not verified"}`),
+		},
+		{
+			name: "shall refresh tokens of the anonym user",
+			user: userContainer{
+				Fingerprint: "9468a4a53a2f2fd9ea96db22dc9dd9bb6ce38b71",
+				IsActive:    true,
+				RoleID:      uint8(RoleAnonymUser),
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "shall reject the deactivated anonym user",
+			user: userContainer{
+				Fingerprint: "9468a4a53a2f2fd9ea96db22dc9dd9bb6ce38b71",
+				IsActive:    false,
+				RoleID:      uint8(RoleAnonymUser),
+			},
+			wantStatus: http.StatusForbidden,
+			wantBody:   []byte(`{"error":"user was deactivated"}`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				user := tt.user
+				user.ID = utils.NewUUID()
+
+				key := GenerateCertificate()
+				handlerFn, err := HTTPHandler(
+					&MockRepositoryCIAM{UserID: map[string]*userContainer{user.ID: &user}}, &MockSMTPClient{}, key,
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				iss, err := NewIssuer(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				refToken, err := iss.NewRefreshToken(user.ID, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				request := &http.Request{
+					Method: http.MethodPost,
+					URL: &url.URL{
+						Path: "/auth/refresh",
+					},
+					Body: io.NopCloser(bytes.NewReader([]byte(`{"refresh_token":"` + refToken + `"}`))),
+				}
+				writer := &utils.MockWriter{}
+
+				// WHEN
+				handlerFn(nil).ServeHTTP(writer, request)
+
+				// THEN
+				if writer.StatusCode != tt.wantStatus {
+					t.Errorf("wrong status code. want: %d, got: %d", tt.wantStatus, writer.StatusCode)
+				}
+				if tt.wantBody != nil && !reflect.DeepEqual(writer.V, tt.wantBody) {
+					t.Errorf("wrong response content. want: %s, got: %s", tt.wantBody, writer.V)
+				}
+			},
+		)
+	}
+}
+
+func Test_client_signinUserInitEmailThrottled(t *testing.T) {
+	// GIVEN
+	smtpClient := &MockSMTPClient{Err: fmt.Errorf("%w: foo", ErrEmailThrottled)}
+	handlerFn, err := HTTPHandler(&MockRepositoryCIAM{}, smtpClient, GenerateCertificate())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := &http.Request{
+		Method: http.MethodPost,
+		URL: &url.URL{
+			Path: "/auth/init",
+		},
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"email":"foo@bar.baz"}`))),
+	}
+	writer := &utils.MockWriter{}
+
+	// WHEN
+	handlerFn(nil).ServeHTTP(writer, request)
+
+	// THEN
+	if writer.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("wrong status code. want: %d, got: %d", http.StatusServiceUnavailable, writer.StatusCode)
+	}
+	if wantBody := []byte(`{"error":"email cannot be sent now, retry later"}`); !reflect.DeepEqual(writer.V, wantBody) {
+		t.Errorf("wrong response content. want: %s, got: %s", wantBody, writer.V)
+	}
+}
@@ -2,6 +2,7 @@ package ciam
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
@@ -9,12 +10,17 @@ type User struct {
 	ID       string
 	APIToken string
 	Role     Role
+	// Tenant the ID of the user's tenant, the empty value defines the default tenant, see Tenant.
+	Tenant string
 }
 
 type Quotas struct {
 	PromptLengthMax   uint16 `json:"prompt_length_max"`
 	RequestsPerMinute uint16 `json:"rpm"`
 	RequestsPerDay    uint16 `json:"rpd"`
+	// RegenerationsPerPrompt the number of the diagram's regenerations for the same prompt within 24 hours,
+	// the zero value does not limit the regenerations besides the requests' quotas.
+	RegenerationsPerPrompt uint16 `json:"regenerations_per_prompt,omitempty"`
 }
 
 type Role uint8
@@ -32,19 +38,22 @@ func (r Role) IsValid() bool {
 	}
 }
 
+// Quotas returns the role's default quotas, see WithRoleQuotas to configure them.
 func (r Role) Quotas() Quotas {
 	switch r {
 	case RoleAnonymUser:
 		return Quotas{
-			PromptLengthMax:   100,
-			RequestsPerMinute: 1,
-			RequestsPerDay:    5,
+			PromptLengthMax:        100,
+			RequestsPerMinute:      1,
+			RequestsPerDay:         5,
+			RegenerationsPerPrompt: 2,
 		}
 	case RoleRegisteredUser:
 		return Quotas{
-			PromptLengthMax:   300,
-			RequestsPerMinute: 3,
-			RequestsPerDay:    20,
+			PromptLengthMax:        300,
+			RequestsPerMinute:      3,
+			RequestsPerDay:         20,
+			RegenerationsPerPrompt: 5,
 		}
 	default:
 		return Quotas{}
@@ -56,31 +65,70 @@ const (
 	RoleRegisteredUser
 )
 
+// String returns the role's name, e.g. to configure its quotas.
+func (r Role) String() string {
+	switch r {
+	case RoleAnonymUser:
+		return "anonym"
+	case RoleRegisteredUser:
+		return "registered"
+	default:
+		return "unknown"
+	}
+}
+
+// roles the list of all roles.
+var roles = []Role{RoleAnonymUser, RoleRegisteredUser}
+
+// ParseRole parses the role's name, see Role.String.
+func ParseRole(name string) (Role, error) {
+	for _, r := range roles {
+		if r.String() == name {
+			return r, nil
+		}
+	}
+	return 0, errors.New("unknown role: " + name)
+}
+
+// isValid checks that all quotas are set.
+func (q Quotas) isValid() bool {
+	return q.PromptLengthMax > 0 && q.RequestsPerMinute > 0 && q.RequestsPerDay > 0
+}
+
+// DefaultRoleQuotas returns the default quotas of all roles, see Role.Quotas.
+func DefaultRoleQuotas() RoleQuotas {
+	o := make(RoleQuotas, len(roles))
+	for _, r := range roles {
+		o[r] = r.Quotas()
+	}
+	return o
+}
+
 type QuotaRequestsConsumption struct {
 	Limit uint16 `json:"limit"`
 	Used  uint16 `json:"used"`
 	Reset int64  `json:"reset"`
 }
 
-func (v quotaIssuer) quotaRPM(user *User) QuotaRequestsConsumption {
+func (v quotaIssuer) quotaRPM(quotas Quotas) QuotaRequestsConsumption {
 	return QuotaRequestsConsumption{
-		Limit: user.Role.Quotas().RequestsPerMinute,
+		Limit: quotas.RequestsPerMinute,
 		Reset: v.minuteNext.Unix(),
 	}
 }
 
-func (v quotaIssuer) quotaRPD(user *User) QuotaRequestsConsumption {
+func (v quotaIssuer) quotaRPD(quotas Quotas) QuotaRequestsConsumption {
 	return QuotaRequestsConsumption{
-		Limit: user.Role.Quotas().RequestsPerDay,
+		Limit: quotas.RequestsPerDay,
 		Reset: v.dayNext.Unix(),
 	}
 }
 
-func (v quotaIssuer) quotaUsage(user *User) QuotasUsage {
+func (v quotaIssuer) quotaUsage(quotas Quotas) QuotasUsage {
 	return QuotasUsage{
-		PromptLengthMax: user.Role.Quotas().PromptLengthMax,
-		RateMinute:      v.quotaRPM(user),
-		RateDay:         v.quotaRPD(user),
+		PromptLengthMax: quotas.PromptLengthMax,
+		RateMinute:      v.quotaRPM(quotas),
+		RateDay:         v.quotaRPD(quotas),
 	}
 }
 
@@ -130,8 +178,8 @@ func sliceWithinWindow(ts []time.Time, tsMin, tsMax time.Time) []time.Time {
 	return o
 }
 
-// getQuotaUsage read current usage of the quota.
-func getQuotaUsage(ctx context.Context, clientRepository RepositoryCIAM, user *User) (
+// getQuotaUsage read current usage of the user's quotas.
+func getQuotaUsage(ctx context.Context, clientRepository RepositoryCIAM, user *User, userQuotas Quotas) (
 	QuotasUsage, error,
 ) {
 	requestsTimestamps, err := clientRepository.GetDailySuccessfulResultsTimestampsByUserID(ctx, user.ID)
@@ -141,7 +189,7 @@ func getQuotaUsage(ctx context.Context, clientRepository RepositoryCIAM, user *U
 
 	quotasController := newQuotaIssuer()
 
-	quotas := quotasController.quotaUsage(user)
+	quotas := quotasController.quotaUsage(userQuotas)
 
 	if len(requestsTimestamps) == 0 {
 		return quotas, nil
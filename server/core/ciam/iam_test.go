@@ -116,7 +116,7 @@ func Test_getQuotaUsage(t *testing.T) {
 				ctx:              context.TODO(),
 				clientRepository: &MockRepositoryCIAM{},
 			},
-			want:    quotasController.quotaUsage(user),
+			want:    quotasController.quotaUsage(user.Role.Quotas()),
 			wantErr: false,
 		},
 		{
@@ -192,7 +192,7 @@ func Test_getQuotaUsage(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(
 			tt.name, func(t *testing.T) {
-				got, err := getQuotaUsage(tt.args.ctx, tt.args.clientRepository, user)
+				got, err := getQuotaUsage(tt.args.ctx, tt.args.clientRepository, user, user.Role.Quotas())
 				if (err != nil) != tt.wantErr {
 					t.Errorf("getQuotaUsage() error = %v, wantErr %v", err, tt.wantErr)
 					return
@@ -309,7 +309,9 @@ func Test_client_validateRequestsQuotaUsage(t *testing.T) {
 					t.Fatal(err)
 				}
 
-				got := c(nil).(client).validateRequestsQuotaUsage(tt.args.writer, &http.Request{}, tt.args.user)
+				got := c(nil).(client).validateRequestsQuotaUsage(
+					tt.args.writer, &http.Request{}, tt.args.user, tt.args.user.Role.Quotas(),
+				)
 
 				if got != tt.want {
 					t.Errorf("unexpected return value. want: %v, got: %v", tt.want, got)
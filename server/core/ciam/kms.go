@@ -0,0 +1,138 @@
+package ciam
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// es256KeySize defines the size of the ES256 signature's components r and s.
+const es256KeySize = 32
+
+type kmsAPI interface {
+	Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+	GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (
+		*kms.GetPublicKeyOutput, error,
+	)
+}
+
+// NewKMSSigningClient initialises the client to sign JWT with the asymmetric AWS KMS key.
+// The key must have the spec ECC_NIST_P256 and the usage SIGN_VERIFY.
+func NewKMSSigningClient(ctx context.Context, region, keyID string) (TokenSigningClient, error) {
+	if keyID == "" {
+		return nil, errors.New("KMS key ID must be set")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsSigningClient{
+		client: kms.NewFromConfig(cfg),
+		keyID:  keyID,
+	}, nil
+}
+
+type kmsSigningClient struct {
+	client kmsAPI
+	keyID  string
+
+	mu     sync.Mutex
+	pubKey *ecdsa.PublicKey
+}
+
+func (c *kmsSigningClient) Alg() string {
+	return "ES256"
+}
+
+func (c *kmsSigningClient) Sign(ctx context.Context, signingString string) ([]byte, error) {
+	digest := sha256.Sum256([]byte(signingString))
+
+	o, err := c.client.Sign(
+		ctx, &kms.SignInput{
+			KeyId:            aws.String(c.keyID),
+			Message:          digest[:],
+			MessageType:      types.MessageTypeDigest,
+			SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha256,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return derToES256Signature(o.Signature)
+}
+
+// Verify verifies the signature locally using the public key fetched from KMS once.
+func (c *kmsSigningClient) Verify(ctx context.Context, signingString string, signature []byte) error {
+	if len(signature) != 2*es256KeySize {
+		return errors.New("wrong signature size")
+	}
+
+	pubKey, err := c.publicKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256([]byte(signingString))
+	r := new(big.Int).SetBytes(signature[:es256KeySize])
+	s := new(big.Int).SetBytes(signature[es256KeySize:])
+	if !ecdsa.Verify(pubKey, digest[:], r, s) {
+		return errors.New("wrong signature")
+	}
+	return nil
+}
+
+func (c *kmsSigningClient) publicKey(ctx context.Context) (*ecdsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pubKey != nil {
+		return c.pubKey, nil
+	}
+
+	o, err := c.client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(c.keyID)})
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(o.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey, ok := key.(*ecdsa.PublicKey)
+	if !ok || pubKey.Curve != elliptic.P256() {
+		return nil, errors.New("wrong key type, ECC_NIST_P256 is expected")
+	}
+
+	c.pubKey = pubKey
+	return c.pubKey, nil
+}
+
+// derToES256Signature converts the ASN.1 DER signature returned by KMS to the JWS format: r || s.
+func derToES256Signature(v []byte) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(v, &sig); err != nil {
+		return nil, err
+	}
+
+	o := make([]byte, 2*es256KeySize)
+	sig.R.FillBytes(o[:es256KeySize])
+	sig.S.FillBytes(o[es256KeySize:])
+	return o, nil
+}
@@ -0,0 +1,169 @@
+package ciam
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// mockKMSClient mimics the asymmetric ECC_NIST_P256 KMS key.
+type mockKMSClient struct {
+	key               *ecdsa.PrivateKey
+	err               error
+	callsGetPublicKey int
+}
+
+func newMockKMSClient(t *testing.T) *mockKMSClient {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &mockKMSClient{key: key}
+}
+
+func (m *mockKMSClient) Sign(_ context.Context, params *kms.SignInput, _ ...func(*kms.Options)) (
+	*kms.SignOutput, error,
+) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if params.MessageType != types.MessageTypeDigest ||
+		params.SigningAlgorithm != types.SigningAlgorithmSpecEcdsaSha256 {
+		return nil, errors.New("unexpected signing parameters")
+	}
+	sig, err := ecdsa.SignASN1(rand.Reader, m.key, params.Message)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.SignOutput{Signature: sig}, nil
+}
+
+func (m *mockKMSClient) GetPublicKey(_ context.Context, _ *kms.GetPublicKeyInput, _ ...func(*kms.Options)) (
+	*kms.GetPublicKeyOutput, error,
+) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.callsGetPublicKey++
+	v, err := x509.MarshalPKIXPublicKey(&m.key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GetPublicKeyOutput{PublicKey: v}, nil
+}
+
+func TestKmsSigningClient(t *testing.T) {
+	t.Run(
+		"shall sign and verify the signing string", func(t *testing.T) {
+			// GIVEN
+			m := newMockKMSClient(t)
+			c := &kmsSigningClient{client: m, keyID: "foo"}
+			const signingString = "header.payload"
+
+			// WHEN
+			sig, err := c.Sign(context.TODO(), signingString)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			if len(sig) != 2*es256KeySize {
+				t.Errorf("unexpected signature length: %d", len(sig))
+			}
+			if err := c.Verify(context.TODO(), signingString, sig); err != nil {
+				t.Errorf("signature shall be valid: %v", err)
+			}
+			if err := c.Verify(context.TODO(), signingString+"x", sig); err == nil {
+				t.Error("signature shall be invalid for a different signing string")
+			}
+		},
+	)
+
+	t.Run(
+		"shall fetch the public key only once", func(t *testing.T) {
+			// GIVEN
+			m := newMockKMSClient(t)
+			c := &kmsSigningClient{client: m, keyID: "foo"}
+			sig, err := c.Sign(context.TODO(), "foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			for i := 0; i < 3; i++ {
+				if err := c.Verify(context.TODO(), "foo", sig); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// THEN
+			if m.callsGetPublicKey != 1 {
+				t.Errorf("public key shall be cached, got %d KMS calls", m.callsGetPublicKey)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail on KMS error", func(t *testing.T) {
+			// GIVEN
+			c := &kmsSigningClient{client: &mockKMSClient{err: errors.New("foo")}, keyID: "foo"}
+
+			// WHEN
+			_, errSign := c.Sign(context.TODO(), "foo")
+			errVerify := c.Verify(context.TODO(), "foo", make([]byte, 2*es256KeySize))
+
+			// THEN
+			if errSign == nil || errVerify == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
+
+func TestIssuerWithKMSSigningClient(t *testing.T) {
+	// GIVEN
+	iss, err := NewIssuerWithSigningClient(&kmsSigningClient{client: newMockKMSClient(t), keyID: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// WHEN
+	tkn, err := iss.NewRefreshToken("bar", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// THEN
+	header, err := base64.RawURLEncoding.DecodeString(strings.Split(tkn, ".")[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(header, &h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Alg != "ES256" {
+		t.Errorf("unexpected alg header: %s", h.Alg)
+	}
+
+	userID, _, err := iss.ParseRefreshToken(tkn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != "bar" {
+		t.Errorf("unexpected user ID: %s", userID)
+	}
+}
@@ -23,6 +23,8 @@ type RepositoryCIAM interface {
 	WriteOneTimeSecret(ctx context.Context, userID, secret string, createdAt time.Time) error
 	ReadOneTimeSecret(ctx context.Context, userID string) (found bool, secret string, issuedAt time.Time, err error)
 	DeleteOneTimeSecret(ctx context.Context, userID string) error
+	// DeleteExpiredSecrets deletes the one-time secrets which outlived their time to live.
+	DeleteExpiredSecrets(ctx context.Context) error
 
 	// GetDailySuccessfulResultsTimestampsByUserID reads the timestamps of all user's successful requests
 	// which led to successful diagrams generation over the last 24 hours / day.
@@ -168,6 +170,18 @@ func (m *MockRepositoryCIAM) DeleteOneTimeSecret(_ context.Context, userID strin
 	return nil
 }
 
+func (m *MockRepositoryCIAM) DeleteExpiredSecrets(_ context.Context) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	for userID, v := range m.Secret {
+		if isExpiredSecret(v.IssuedAt) {
+			delete(m.Secret, userID)
+		}
+	}
+	return nil
+}
+
 func (m *MockRepositoryCIAM) GetDailySuccessfulResultsTimestampsByUserID(_ context.Context, _ string) (
 	[]time.Time, error,
 ) {
@@ -0,0 +1,104 @@
+package ciam
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/kislerdm/diagramastext/server/core/internal/memstore"
+	"github.com/kislerdm/diagramastext/server/core/internal/utils"
+)
+
+// WithAuthRateLimit limits the rate of requests to the authentication routes per client IP
+// to slow down the credential stuffing and the emails bombing. The requests exceeding the limit
+// are rejected with the status code 429. The client IP is read from the header X-Forwarded-For
+// if the request is sent by one of the trusted proxies' networks, otherwise the peer's address is used.
+func WithAuthRateLimit(requestsPerMinute, burst int, trustedProxies ...*net.IPNet) HTTPHandlerOps {
+	return func(c *client) {
+		if requestsPerMinute <= 0 || burst <= 0 {
+			return
+		}
+		c.authRateLimiter = newIPRateLimiter(float64(requestsPerMinute)/60, burst, trustedProxies)
+	}
+}
+
+// WithAuthRateLimitMaxClients sets the maximum number of the client IPs to limit the rate of requests for,
+// see WithAuthRateLimit. The buckets of the least recently seen clients are evicted above the limit,
+// the default limit is 10000 clients. The evictions are published as the expvar "memstore.auth_rate_limit".
+func WithAuthRateLimitMaxClients(n int) HTTPHandlerOps {
+	return func(c *client) {
+		if n > 0 {
+			c.authRateLimitMaxClients = n
+		}
+	}
+}
+
+// ipRateLimiter defines the token bucket per client IP.
+type ipRateLimiter struct {
+	// rate the number of tokens added to the bucket per second.
+	rate  float64
+	burst float64
+	// buckets the buckets of the least recently seen client IPs are evicted above the limit.
+	buckets        *memstore.Store
+	trustedProxies utils.TrustedProxies
+	now            func() time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// maxBuckets the number of buckets above which the least recently used buckets are evicted.
+const maxBuckets = 10000
+
+func newIPRateLimiter(rate float64, burst int, trustedProxies []*net.IPNet) *ipRateLimiter {
+	return &ipRateLimiter{
+		rate:           rate,
+		burst:          float64(burst),
+		buckets:        newBuckets(maxBuckets),
+		trustedProxies: trustedProxies,
+		now:            time.Now,
+	}
+}
+
+func newBuckets(maxBuckets int) *memstore.Store {
+	return memstore.New(memstore.WithName("auth_rate_limit"), memstore.WithMaxEntries(maxBuckets))
+}
+
+// allow takes the token from the bucket of the request's client IP, it returns false if the bucket is empty.
+// All requests are allowed if the limiter is not set.
+func (l *ipRateLimiter) allow(r *http.Request) bool {
+	if l == nil {
+		return true
+	}
+
+	ip := l.trustedProxies.ClientIP(r)
+	now := l.now()
+
+	var allowed bool
+	l.buckets.Update(
+		ip, func(v interface{}, ok bool) interface{} {
+			b := &tokenBucket{tokens: l.burst, updated: now}
+			if ok {
+				b = v.(*tokenBucket)
+			}
+			b.tokens = l.refill(b, now)
+			b.updated = now
+			if b.tokens >= 1 {
+				b.tokens--
+				allowed = true
+			}
+			return b
+		},
+	)
+	return allowed
+}
+
+func (l *ipRateLimiter) refill(b *tokenBucket, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.updated).Seconds()*l.rate
+	if tokens > l.burst {
+		return l.burst
+	}
+	return tokens
+}
@@ -0,0 +1,136 @@
+package ciam
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kislerdm/diagramastext/server/core/internal/utils"
+)
+
+func Test_ipRateLimiter_allow(t *testing.T) {
+	t.Run(
+		"shall trip the bucket and refill it over time", func(t *testing.T) {
+			// GIVEN
+			now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+			l := newIPRateLimiter(1, 2, nil)
+			l.now = func() time.Time { return now }
+			r := &http.Request{RemoteAddr: "10.0.0.1:1234"}
+
+			// WHEN & THEN
+			for i, want := range []bool{true, true, false} {
+				if got := l.allow(r); got != want {
+					t.Errorf("request %d: allow() = %v, want %v", i, got, want)
+				}
+			}
+			if !l.allow(&http.Request{RemoteAddr: "10.0.0.2:1234"}) {
+				t.Error("the bucket of another IP shall not be affected")
+			}
+
+			now = now.Add(time.Second)
+			if !l.allow(r) {
+				t.Error("the bucket shall be refilled")
+			}
+			if l.allow(r) {
+				t.Error("the bucket shall be refilled at the rate")
+			}
+		},
+	)
+
+	t.Run(
+		"shall limit the clients behind the trusted proxy separately", func(t *testing.T) {
+			// GIVEN
+			_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := newIPRateLimiter(1, 1, []*net.IPNet{proxies})
+			newRequest := func(remoteAddr, forwarded string) *http.Request {
+				return &http.Request{RemoteAddr: remoteAddr, Header: http.Header{"X-Forwarded-For": {forwarded}}}
+			}
+
+			// WHEN & THEN
+			if !l.allow(newRequest("10.0.0.1:1234", "1.1.1.1")) || !l.allow(newRequest("10.0.0.1:1234", "2.2.2.2")) {
+				t.Error("the clients behind the trusted proxy shall be limited separately")
+			}
+			if l.allow(newRequest("10.0.0.2:1234", "1.1.1.1")) {
+				t.Error("the client shall be limited regardless of the proxy")
+			}
+			if !l.allow(newRequest("192.168.0.1:1234", "1.1.1.1")) {
+				t.Error("the header of the untrusted peer shall be ignored")
+			}
+		},
+	)
+
+	t.Run(
+		"shall allow all requests if the limiter is not set", func(t *testing.T) {
+			var l *ipRateLimiter
+			if !l.allow(&http.Request{}) {
+				t.Error("request shall be allowed")
+			}
+		},
+	)
+}
+
+func TestHTTPHandler_AuthRateLimit(t *testing.T) {
+	// GIVEN
+	handlerFn, err := HTTPHandler(
+		&MockRepositoryCIAM{}, &MockSMTPClient{}, GenerateCertificate(), WithAuthRateLimit(1, 1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := handlerFn(nil)
+
+	newRequest := func() *http.Request {
+		return &http.Request{
+			Method:     http.MethodPost,
+			URL:        &url.URL{Path: "/auth/init"},
+			RemoteAddr: "192.168.0.1:1234",
+			Body:       io.NopCloser(bytes.NewReader([]byte(`{"email":"foo@bar.baz"}`))),
+		}
+	}
+
+	// WHEN
+	w := &utils.MockWriter{}
+	handler.ServeHTTP(w, newRequest())
+	wLimited := &utils.MockWriter{}
+	handler.ServeHTTP(wLimited, newRequest())
+
+	// THEN
+	if w.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status code: %d", w.StatusCode)
+	}
+	if wLimited.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("unexpected status code: %d", wLimited.StatusCode)
+	}
+	if want := `{"error":"too many requests"}`; string(wLimited.V) != want {
+		t.Errorf("unexpected response: got = %s, want = %s", wLimited.V, want)
+	}
+}
+
+func TestWithAuthRateLimitMaxClients(t *testing.T) {
+	// GIVEN
+	handlerFn, err := HTTPHandler(
+		&MockRepositoryCIAM{}, &MockSMTPClient{}, GenerateCertificate(),
+		WithAuthRateLimitMaxClients(1), WithAuthRateLimit(1, 1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := handlerFn(nil).(client)
+
+	// WHEN
+	for _, ip := range []string{"10.0.0.1:1234", "10.0.0.2:1234", "10.0.0.3:1234"} {
+		handler.authRateLimiter.allow(&http.Request{RemoteAddr: ip})
+	}
+
+	// THEN
+	if got := handler.authRateLimiter.buckets.Stats(); got.Entries != 1 || got.Evictions != 2 {
+		t.Errorf("the buckets of the least recently seen clients shall be evicted, stats: %+v", got)
+	}
+}
@@ -0,0 +1,91 @@
+package ciam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
+)
+
+// ErrEmailThrottled indicates that the email provider throttled the request, it can be retried later.
+var ErrEmailThrottled = errors.New("email sending throttled")
+
+type sesAPI interface {
+	SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (
+		*sesv2.SendEmailOutput, error,
+	)
+}
+
+// NewSESEmailClient initialises the client to send emails using AWS SES v2 API.
+func NewSESEmailClient(ctx context.Context, region, senderEmail string) (SMTPClient, error) {
+	if senderEmail == "" {
+		return nil, errors.New("sender email must be set")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+
+	return &sesClient{
+		client: sesv2.NewFromConfig(cfg),
+		sender: senderEmail,
+	}, nil
+}
+
+type sesClient struct {
+	client sesAPI
+	sender string
+}
+
+func (s sesClient) SendSignInEmail(recipient, authSecret string) error {
+	msg, err := generateMessage(recipient, authSecret)
+	if err != nil {
+		return err
+	}
+
+	var o strings.Builder
+	o.WriteString("From: ")
+	o.WriteString(s.sender)
+	o.WriteString("\n")
+	o.Write(msg)
+
+	_, err = s.client.SendEmail(
+		context.Background(), &sesv2.SendEmailInput{
+			FromEmailAddress: aws.String(s.sender),
+			Destination: &types.Destination{
+				ToAddresses: []string{recipient},
+			},
+			Content: &types.EmailContent{
+				Raw: &types.RawMessage{Data: []byte(o.String())},
+			},
+		},
+	)
+	if isThrottlingError(err) {
+		return fmt.Errorf("%w: %v", ErrEmailThrottled, err)
+	}
+	return err
+}
+
+func isThrottlingError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var (
+		errTooManyRequests *types.TooManyRequestsException
+		errLimitExceeded   *types.LimitExceededException
+	)
+	if errors.As(err, &errTooManyRequests) || errors.As(err, &errLimitExceeded) {
+		return true
+	}
+
+	var errAPI smithy.APIError
+	return errors.As(err, &errAPI) && errAPI.ErrorCode() == "Throttling"
+}
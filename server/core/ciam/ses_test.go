@@ -0,0 +1,136 @@
+package ciam
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+type mockSESClient struct {
+	input *sesv2.SendEmailInput
+	err   error
+}
+
+func (m *mockSESClient) SendEmail(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (
+	*sesv2.SendEmailOutput, error,
+) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.input = params
+	return &sesv2.SendEmailOutput{}, nil
+}
+
+func TestNewSESEmailClient(t *testing.T) {
+	t.Run(
+		"shall fail if no sender email is set", func(t *testing.T) {
+			if _, err := NewSESEmailClient(context.TODO(), "us-east-2", ""); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+	t.Run(
+		"shall initialise the client", func(t *testing.T) {
+			// WHEN
+			got, err := NewSESEmailClient(context.TODO(), "us-east-2", "support@diagramastext.dev")
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, ok := got.(*sesClient)
+			if !ok {
+				t.Fatalf("unexpected type %T", got)
+			}
+			if c.sender != "support@diagramastext.dev" {
+				t.Errorf("unexpected sender: %s", c.sender)
+			}
+		},
+	)
+}
+
+func TestSesClient_SendSignInEmail(t *testing.T) {
+	const (
+		sender    = "support@diagramastext.dev"
+		recipient = "foo@bar.baz"
+		secret    = "a1b2c3"
+	)
+
+	t.Run(
+		"shall send the email with the sign-in secret to the recipient", func(t *testing.T) {
+			// GIVEN
+			m := &mockSESClient{}
+			c := sesClient{client: m, sender: sender}
+
+			// WHEN
+			if err := c.SendSignInEmail(recipient, secret); err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			if *m.input.FromEmailAddress != sender {
+				t.Errorf("unexpected sender: %s", *m.input.FromEmailAddress)
+			}
+			if !reflect.DeepEqual(m.input.Destination.ToAddresses, []string{recipient}) {
+				t.Errorf("unexpected destination: %v", m.input.Destination.ToAddresses)
+			}
+
+			msg := string(m.input.Content.Raw.Data)
+			if !strings.HasPrefix(msg, "From: "+sender+"\nTo: "+recipient+"\n") {
+				t.Errorf("unexpected message headers: %s", msg)
+			}
+			if !strings.Contains(msg, "Subject: diagramastext.dev authentication code: "+secret) {
+				t.Error("message subject does not contain the secret")
+			}
+			if !strings.Contains(msg, "copy the code "+secret) {
+				t.Error("message body does not contain the secret")
+			}
+		},
+	)
+
+	tests := []struct {
+		name          string
+		err           error
+		wantThrottled bool
+	}{
+		{
+			name:          "too many requests",
+			err:           &types.TooManyRequestsException{},
+			wantThrottled: true,
+		},
+		{
+			name:          "limit exceeded",
+			err:           &types.LimitExceededException{},
+			wantThrottled: true,
+		},
+		{
+			name:          "not retriable",
+			err:           &types.MessageRejected{},
+			wantThrottled: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			"shall surface the error: "+tt.name, func(t *testing.T) {
+				// GIVEN
+				c := sesClient{client: &mockSESClient{err: tt.err}, sender: sender}
+
+				// WHEN
+				err := c.SendSignInEmail(recipient, secret)
+
+				// THEN
+				if err == nil {
+					t.Fatal("error expected")
+				}
+				if errors.Is(err, ErrEmailThrottled) != tt.wantThrottled {
+					t.Errorf("unexpected retriable error flag for %v", err)
+				}
+			},
+		)
+	}
+}
@@ -2,7 +2,9 @@ package ciam
 
 import (
 	"bytes"
+	"crypto/tls"
 	_ "embed"
+	"errors"
 	"html/template"
 	"net/smtp"
 )
@@ -11,18 +13,67 @@ type SMTPClient interface {
 	SendSignInEmail(recipient, authSecret string) error
 }
 
-func NewSMTPClient(user, password, host, port, senderEmail string) SMTPClient {
-	return &smtClient{
-		auth:   smtp.PlainAuth("", user, password, host),
-		addr:   host + ":" + port,
-		sender: senderEmail,
+// SMTPTLSMode defines how the connection to the SMTP server is secured.
+type SMTPTLSMode string
+
+const (
+	// SMTPTLSModeOpportunistic upgrades the connection using STARTTLS if the server supports it.
+	SMTPTLSModeOpportunistic SMTPTLSMode = ""
+	// SMTPTLSModeStartTLS requires the connection to be upgraded using STARTTLS.
+	SMTPTLSModeStartTLS SMTPTLSMode = "starttls"
+	// SMTPTLSModeImplicit establishes TLS connection from the start, e.g. to port 465.
+	SMTPTLSModeImplicit SMTPTLSMode = "implicit"
+)
+
+func (m SMTPTLSMode) IsValid() bool {
+	switch m {
+	case SMTPTLSModeOpportunistic, SMTPTLSModeStartTLS, SMTPTLSModeImplicit:
+		return true
+	default:
+		return false
+	}
+}
+
+type SMTPClientOps func(c *smtClient)
+
+// WithSMTPTLSMode sets the mode to secure the connection to the SMTP server.
+func WithSMTPTLSMode(mode SMTPTLSMode) SMTPClientOps {
+	return func(c *smtClient) {
+		c.tlsMode = mode
+	}
+}
+
+// WithSMTPTLSConfig sets the TLS configuration, e.g. to trust custom certificate authorities.
+func WithSMTPTLSConfig(cfg *tls.Config) SMTPClientOps {
+	return func(c *smtClient) {
+		c.tlsConfig = cfg
+	}
+}
+
+// NewSMTPClient initialises the SMTP client. The authentication is skipped if no user is provided.
+func NewSMTPClient(user, password, host, port, senderEmail string, fnOps ...SMTPClientOps) SMTPClient {
+	c := &smtClient{
+		addr:      host + ":" + port,
+		host:      host,
+		sender:    senderEmail,
+		tlsConfig: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12},
+	}
+	if user != "" {
+		c.auth = smtp.PlainAuth("", user, password, host)
+	}
+	for _, fn := range fnOps {
+		fn(c)
 	}
+	return c
 }
 
 type smtClient struct {
-	auth   smtp.Auth
-	addr   string
-	sender string
+	auth      smtp.Auth
+	addr      string
+	host      string
+	sender    string
+	tlsMode   SMTPTLSMode
+	tlsConfig *tls.Config
 }
 
 func (s smtClient) SendSignInEmail(recipient, authSecret string) error {
@@ -30,7 +81,81 @@ func (s smtClient) SendSignInEmail(recipient, authSecret string) error {
 	if err != nil {
 		return err
 	}
-	return smtp.SendMail(s.addr, s.auth, s.sender, []string{recipient}, message)
+	return s.send(recipient, message)
+}
+
+func (s smtClient) dial() (*smtp.Client, error) {
+	if s.tlsMode != SMTPTLSModeImplicit {
+		return smtp.Dial(s.addr)
+	}
+
+	conn, err := tls.Dial("tcp", s.addr, s.tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return smtp.NewClient(conn, s.host)
+}
+
+func (s smtClient) startTLS(c *smtp.Client) error {
+	if s.tlsMode == SMTPTLSModeImplicit {
+		return nil
+	}
+
+	if ok, _ := c.Extension("STARTTLS"); !ok {
+		if s.tlsMode == SMTPTLSModeStartTLS {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		return nil
+	}
+
+	return c.StartTLS(s.tlsConfig)
+}
+
+func (s smtClient) send(recipient string, message []byte) error {
+	if !s.tlsMode.IsValid() {
+		return errors.New("unknown smtp tls mode " + string(s.tlsMode))
+	}
+
+	c, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = c.Close() }()
+
+	if err := s.startTLS(c); err != nil {
+		return err
+	}
+
+	if s.auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err := c.Auth(s.auth); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := c.Mail(s.sender); err != nil {
+		return err
+	}
+
+	if err := c.Rcpt(recipient); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
 }
 
 //go:embed email-signin.html.tmpl
@@ -1,9 +1,20 @@
 package ciam
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
 	"net/smtp"
+	"net/textproto"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewSMTClient(t *testing.T) {
@@ -95,3 +106,227 @@ Content-Disposition: inline
 		},
 	)
 }
+
+// fakeSMTPServer accepts a single SMTP session and records the message's content.
+type fakeSMTPServer struct {
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	withTLS     bool
+
+	done    chan struct{}
+	message string
+	rcpt    string
+}
+
+func newFakeSMTPServer(t *testing.T, tlsConfig *tls.Config, implicitTLS bool) *fakeSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeSMTPServer{
+		listener:    listener,
+		tlsConfig:   tlsConfig,
+		implicitTLS: implicitTLS,
+		done:        make(chan struct{}),
+	}
+	go s.serve()
+	t.Cleanup(func() { _ = listener.Close() })
+	return s
+}
+
+func (s *fakeSMTPServer) port() string {
+	return strings.Split(s.listener.Addr().String(), ":")[1]
+}
+
+func (s *fakeSMTPServer) serve() {
+	defer close(s.done)
+
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	if s.implicitTLS {
+		conn = tls.Server(conn, s.tlsConfig)
+		s.withTLS = true
+	}
+
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 127.0.0.1 ESMTP")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			if s.tlsConfig != nil && !s.withTLS {
+				_ = tp.PrintfLine("250-127.0.0.1")
+				_ = tp.PrintfLine("250-STARTTLS")
+			} else {
+				_ = tp.PrintfLine("250-127.0.0.1")
+			}
+			_ = tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			_ = tp.PrintfLine("220 ready to start TLS")
+			conn = tls.Server(conn, s.tlsConfig)
+			s.withTLS = true
+			tp = textproto.NewConn(conn)
+		case "AUTH":
+			_ = tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			s.rcpt = strings.Trim(strings.SplitN(line, ":", 2)[1], "<>")
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			v, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.message = string(v)
+			_ = tp.PrintfLine("250 ok")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func generateTestTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	server = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS12,
+	}
+	client = &tls.Config{RootCAs: pool, ServerName: "127.0.0.1", MinVersion: tls.VersionTLS12}
+	return server, client
+}
+
+func TestSmtClient_SendSignInEmail(t *testing.T) {
+	const (
+		recipient = "foo@bar.baz"
+		secret    = "a1b2c3"
+	)
+
+	serverTLSConfig, clientTLSConfig := generateTestTLSConfigs(t)
+
+	tests := []struct {
+		name            string
+		serverTLSConfig *tls.Config
+		implicitTLS     bool
+		mode            SMTPTLSMode
+		wantErr         bool
+		wantTLS         bool
+	}{
+		{
+			name:    "opportunistic: server without TLS",
+			mode:    SMTPTLSModeOpportunistic,
+			wantTLS: false,
+		},
+		{
+			name:            "opportunistic: server with STARTTLS",
+			serverTLSConfig: serverTLSConfig,
+			mode:            SMTPTLSModeOpportunistic,
+			wantTLS:         true,
+		},
+		{
+			name:            "STARTTLS",
+			serverTLSConfig: serverTLSConfig,
+			mode:            SMTPTLSModeStartTLS,
+			wantTLS:         true,
+		},
+		{
+			name:    "STARTTLS: server does not support it",
+			mode:    SMTPTLSModeStartTLS,
+			wantErr: true,
+		},
+		{
+			name:            "implicit TLS",
+			serverTLSConfig: serverTLSConfig,
+			implicitTLS:     true,
+			mode:            SMTPTLSModeImplicit,
+			wantTLS:         true,
+		},
+		{
+			name:    "unknown TLS mode",
+			mode:    "foo",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				server := newFakeSMTPServer(t, tt.serverTLSConfig, tt.implicitTLS)
+				client := NewSMTPClient(
+					"user", "password", "127.0.0.1", server.port(), "support@diagramastext.dev",
+					WithSMTPTLSMode(tt.mode), WithSMTPTLSConfig(clientTLSConfig),
+				)
+
+				// WHEN
+				err := client.SendSignInEmail(recipient, secret)
+
+				// THEN
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("SendSignInEmail() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if tt.wantErr {
+					return
+				}
+
+				<-server.done
+				if server.withTLS != tt.wantTLS {
+					t.Errorf("unexpected connection encryption: want = %v, got = %v", tt.wantTLS, server.withTLS)
+				}
+				if server.rcpt != recipient {
+					t.Errorf("unexpected recipient: want = %s, got = %s", recipient, server.rcpt)
+				}
+				if !strings.Contains(server.message, "copy the code "+secret) {
+					t.Errorf("message does not contain the secret")
+				}
+			},
+		)
+	}
+}
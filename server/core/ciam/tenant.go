@@ -0,0 +1,208 @@
+package ciam
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// HeaderTenant the request header with the tenant's ID. It is set by the trusted proxy, e.g. given the reseller's
+// domain, because the tenant defines the users' quotas. The header is ignored unless the request's peer is
+// the trusted proxy, see WithTenantProxies.
+const HeaderTenant = "X-Tenant-ID"
+
+// Tenant defines the configuration of the reseller's deployment of the service.
+// The zero value defines the default tenant which preserves the service's defaults.
+type Tenant struct {
+	// ID the tenant's ID, the empty value defines the default tenant.
+	ID string `json:"id"`
+	// DefaultFooter the footer of the diagrams which do not define it, the empty value keeps the default footer.
+	DefaultFooter string `json:"default_footer,omitempty"`
+	// Theme the PlantUML theme of the diagrams, e.g. "cerulean", the empty value keeps the default theme.
+	Theme string `json:"theme,omitempty"`
+	// Quotas the quotas per role, the roles which are not set use Role.Quotas.
+	Quotas RoleQuotas `json:"quotas,omitempty"`
+}
+
+// RoleQuotas returns the tenant's quotas of the role.
+func (t Tenant) RoleQuotas(role Role) Quotas {
+	if v, ok := t.Quotas[role]; ok {
+		return v
+	}
+	return role.Quotas()
+}
+
+var themeRegexp = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Validate validates the tenant's configuration.
+func (t Tenant) Validate() error {
+	if strings.TrimSpace(t.ID) == "" {
+		return errors.New("tenant ID must be set")
+	}
+	if t.Theme != "" && !themeRegexp.MatchString(t.Theme) {
+		return errors.New("tenant " + t.ID + ": theme must contain lower case letters, digits, - and _ only")
+	}
+	for role, quotas := range t.Quotas {
+		if !quotas.isValid() {
+			return errors.New("tenant " + t.ID + ": quotas of the role " + role.String() + " must be positive")
+		}
+	}
+	return nil
+}
+
+// RoleQuotas defines the quotas per role, it is encoded as the JSON object with the roles' names as keys,
+// e.g. {"registered":{"prompt_length_max":500,"rpm":5,"rpd":50}}.
+type RoleQuotas map[Role]Quotas
+
+// Validate checks that the quotas of all roles are defined.
+func (q RoleQuotas) Validate() error {
+	for _, role := range roles {
+		quotas, ok := q[role]
+		if !ok {
+			return errors.New("quotas of the role " + role.String() + " must be defined")
+		}
+		if !quotas.isValid() {
+			return errors.New("quotas of the role " + role.String() + " must be positive")
+		}
+	}
+	return nil
+}
+
+func (q RoleQuotas) MarshalJSON() ([]byte, error) {
+	o := make(map[string]Quotas, len(q))
+	for role, quotas := range q {
+		o[role.String()] = quotas
+	}
+	return json.Marshal(o)
+}
+
+func (q *RoleQuotas) UnmarshalJSON(data []byte) error {
+	var v map[string]Quotas
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	o := make(RoleQuotas, len(v))
+	for name, quotas := range v {
+		role, err := ParseRole(name)
+		if err != nil {
+			return err
+		}
+		o[role] = quotas
+	}
+	*q = o
+	return nil
+}
+
+// WithTenants sets the tenants resolved from the access token's tenant claim, or from the request header
+// HeaderTenant set by the trusted proxy, see WithTenantProxies. The requests without either are served by
+// the default tenant, the requests with the unknown tenant, or with the header which does not match the token's
+// claim are rejected with the status code 403. The tokens are issued with the claim of the tenant resolved
+// from the header.
+func WithTenants(tenants ...Tenant) HTTPHandlerOps {
+	return func(c *client) {
+		if c.tenants == nil {
+			c.tenants = map[string]Tenant{}
+		}
+		for _, tenant := range tenants {
+			c.tenants[tenant.ID] = tenant
+		}
+	}
+}
+
+// WithTenantProxies sets the networks of the proxies trusted to set the header HeaderTenant, e.g. 10.0.0.0/8.
+// The header is ignored if the request's peer is not the trusted proxy, hence only the default tenant is served
+// by default, see WithTenants.
+func WithTenantProxies(trustedProxies ...*net.IPNet) HTTPHandlerOps {
+	return func(c *client) {
+		c.tenantProxies = trustedProxies
+	}
+}
+
+// headerTenant returns the tenant's ID from the header HeaderTenant set by the trusted proxy.
+func (c client) headerTenant(r *http.Request) string {
+	if !c.tenantProxies.IsTrustedPeer(r) {
+		return ""
+	}
+	return r.Header.Get(HeaderTenant)
+}
+
+// tenant resolves the tenant by ID, it returns false if the tenant is unknown.
+func (c client) tenant(id string) (Tenant, bool) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return Tenant{Quotas: c.roleQuotas}, true
+	}
+	tenant, ok := c.tenants[id]
+	return tenant, ok
+}
+
+// WithRoleQuotas configures the quotas per role instead of the defaults, see Role.Quotas. The quotas apply
+// to the default tenant, and to the tenants which do not define the role's quotas. The access tokens are issued,
+// and validated using the configured quotas. The quotas shall be defined for all roles, see RoleQuotas.Validate.
+func WithRoleQuotas(quotas RoleQuotas) HTTPHandlerOps {
+	return func(c *client) {
+		if len(quotas) == 0 {
+			return
+		}
+		c.roleQuotas = quotas
+		if v, ok := c.tokenIssuer.(issuer); ok {
+			c.tokenIssuer = v.withRoleQuotas(quotas)
+		}
+	}
+}
+
+// withRoleQuotas sets the configured quotas to the tenants which do not define the role's quotas.
+func (c *client) withRoleQuotas() {
+	if len(c.roleQuotas) == 0 {
+		return
+	}
+	for id, tenant := range c.tenants {
+		quotas := make(RoleQuotas, len(c.roleQuotas))
+		for role, v := range c.roleQuotas {
+			quotas[role] = v
+		}
+		for role, v := range tenant.Quotas {
+			quotas[role] = v
+		}
+		tenant.Quotas = quotas
+		c.tenants[id] = tenant
+	}
+}
+
+var (
+	errTenantUnknown  = errors.New("unknown tenant")
+	errTenantMismatch = errors.New("token was issued for another tenant")
+)
+
+// tokenTenant resolves the tenant of the token's claim. The tenant of the header, if set, shall match the claim,
+// including the default tenant's empty claim, to prevent switching to another tenant's quotas.
+func (c client) tokenTenant(headerTenant Tenant, claim string) (Tenant, error) {
+	if claim == headerTenant.ID {
+		return headerTenant, nil
+	}
+	if headerTenant.ID != "" {
+		return Tenant{}, errTenantMismatch
+	}
+	tenant, ok := c.tenant(claim)
+	if !ok {
+		return Tenant{}, errTenantUnknown
+	}
+	return tenant, nil
+}
+
+var tenantKey = struct{ name string }{name: "tenant"}
+
+// NewTenantContext returns the context with the tenant of the request.
+func NewTenantContext(ctx context.Context, tenant Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+// TenantFromContext returns the tenant of the request, the default tenant is returned if the context has none.
+func TenantFromContext(ctx context.Context) Tenant {
+	v, _ := ctx.Value(tenantKey).(Tenant)
+	return v
+}
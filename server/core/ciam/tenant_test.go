@@ -0,0 +1,569 @@
+package ciam
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/internal/utils"
+)
+
+func TestTenant_RoleQuotas(t *testing.T) {
+	tenant := Tenant{
+		ID: "acme",
+		Quotas: RoleQuotas{
+			RoleRegisteredUser: {PromptLengthMax: 500, RequestsPerMinute: 5, RequestsPerDay: 50},
+		},
+	}
+
+	if got := tenant.RoleQuotas(RoleRegisteredUser); got.PromptLengthMax != 500 {
+		t.Errorf("the tenant's quotas shall be used, got: %+v", got)
+	}
+	if got := tenant.RoleQuotas(RoleAnonymUser); !reflect.DeepEqual(got, RoleAnonymUser.Quotas()) {
+		t.Errorf("the default quotas shall be used given the role is not set, got: %+v", got)
+	}
+	if got := (Tenant{}).RoleQuotas(RoleRegisteredUser); !reflect.DeepEqual(got, RoleRegisteredUser.Quotas()) {
+		t.Errorf("the default tenant shall use the default quotas, got: %+v", got)
+	}
+}
+
+func TestTenant_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenant  Tenant
+		wantErr bool
+	}{
+		{name: "valid", tenant: Tenant{ID: "acme", DefaultFooter: "by acme", Theme: "cerulean-outline"}},
+		{name: "missing ID", tenant: Tenant{Theme: "cerulean"}, wantErr: true},
+		{name: "invalid theme", tenant: Tenant{ID: "acme", Theme: "cerulean\n@enduml"}, wantErr: true},
+		{
+			name:    "zero quotas",
+			tenant:  Tenant{ID: "acme", Quotas: RoleQuotas{RoleAnonymUser: {PromptLengthMax: 100}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if err := tt.tenant.Validate(); (err != nil) != tt.wantErr {
+					t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+func TestRoleQuotas_JSON(t *testing.T) {
+	// GIVEN
+	const data = `{"anonym":{"prompt_length_max":50,"rpm":1,"rpd":2},` +
+		`"registered":{"prompt_length_max":500,"rpm":5,"rpd":50}}`
+
+	// WHEN
+	var got RoleQuotas
+	if err := json.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// THEN
+	want := RoleQuotas{
+		RoleAnonymUser:     {PromptLengthMax: 50, RequestsPerMinute: 1, RequestsPerDay: 2},
+		RoleRegisteredUser: {PromptLengthMax: 500, RequestsPerMinute: 5, RequestsPerDay: 50},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected quotas: got = %+v, want = %+v", got, want)
+	}
+	if o, _ := json.Marshal(got); string(o) != data {
+		t.Errorf("unexpected JSON: %s", o)
+	}
+
+	if err := json.Unmarshal([]byte(`{"admin":{}}`), &got); err == nil {
+		t.Error("error expected given unknown role")
+	}
+}
+
+// tenantProxyAddr the address of the proxy trusted to set the header HeaderTenant, see withTenantProxies.
+const tenantProxyAddr = "10.0.0.1:1234"
+
+func withTenantProxies(t *testing.T) HTTPHandlerOps {
+	proxies, err := utils.ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return WithTenantProxies(proxies...)
+}
+
+func TestWithTenants(t *testing.T) {
+	key := GenerateCertificate()
+	tokenIssuer, err := NewIssuer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRequest := func(path, claim, header string) *http.Request {
+		token, err := tokenIssuer.NewAccessToken(User{ID: "bar", Role: RoleRegisteredUser, Tenant: claim})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &http.Request{
+			Method: http.MethodGet, URL: &url.URL{Path: path},
+			Header: http.Header{"Authorization": {"Bearer " + token}}, RemoteAddr: tenantProxyAddr,
+		}
+		if header != "" {
+			r.Header.Set(HeaderTenant, header)
+		}
+		return r
+	}
+
+	clientRepo := &MockRepositoryCIAM{}
+	acme := Tenant{
+		ID: "acme", DefaultFooter: "by acme",
+		Quotas: RoleQuotas{RoleRegisteredUser: {PromptLengthMax: 500, RequestsPerMinute: 5, RequestsPerDay: 50}},
+	}
+
+	var gotTenant Tenant
+	handlerFn, err := HTTPHandler(clientRepo, &MockSMTPClient{}, key, WithTenants(acme), withTenantProxies(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := handlerFn(
+		http.HandlerFunc(
+			func(_ http.ResponseWriter, r *http.Request) {
+				gotTenant = TenantFromContext(r.Context())
+			},
+		),
+	)
+
+	t.Run(
+		"shall resolve the tenant from the header", func(t *testing.T) {
+			// WHEN
+			handler.ServeHTTP(&utils.MockWriter{}, newRequest("/generate/c4", "acme", "acme"))
+
+			// THEN
+			if !reflect.DeepEqual(gotTenant, acme) {
+				t.Errorf("unexpected tenant: %+v", gotTenant)
+			}
+		},
+	)
+
+	t.Run(
+		"shall resolve the default tenant given no header", func(t *testing.T) {
+			// WHEN
+			handler.ServeHTTP(&utils.MockWriter{}, newRequest("/generate/c4", "", ""))
+
+			// THEN
+			if !reflect.DeepEqual(gotTenant, Tenant{}) {
+				t.Errorf("unexpected tenant: %+v", gotTenant)
+			}
+		},
+	)
+
+	t.Run(
+		"shall return the tenant's quotas", func(t *testing.T) {
+			// GIVEN
+			w := &utils.MockWriter{}
+
+			// WHEN
+			handler.ServeHTTP(w, newRequest("/quotas", "acme", "acme"))
+
+			// THEN
+			var got QuotasUsage
+			if err := json.Unmarshal(w.V, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.PromptLengthMax != 500 || got.RateMinute.Limit != 5 || got.RateDay.Limit != 50 {
+				t.Errorf("unexpected quotas: %+v", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall reject the unknown tenant", func(t *testing.T) {
+			// GIVEN
+			w := &utils.MockWriter{}
+
+			// WHEN
+			handler.ServeHTTP(w, newRequest("/generate/c4", "", "qux"))
+
+			// THEN
+			if w.StatusCode != http.StatusForbidden || string(w.V) != `{"error":"unknown tenant"}` {
+				t.Errorf("unexpected response: %d %s", w.StatusCode, w.V)
+			}
+		},
+	)
+
+	t.Run(
+		"shall ignore the header spoofed by the untrusted peer", func(t *testing.T) {
+			// GIVEN
+			r := newRequest("/quotas", "", "acme")
+			r.RemoteAddr = "192.168.0.1:1234"
+			w := &utils.MockWriter{}
+
+			// WHEN
+			handler.ServeHTTP(w, r)
+
+			// THEN
+			var got QuotasUsage
+			if err := json.Unmarshal(w.V, &got); err != nil {
+				t.Fatal(err)
+			}
+			if want := RoleRegisteredUser.Quotas(); got.PromptLengthMax != want.PromptLengthMax ||
+				got.RateMinute.Limit != want.RequestsPerMinute || got.RateDay.Limit != want.RequestsPerDay {
+				t.Errorf("the default tenant's quotas shall apply, got: %+v", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall ignore the header given no trusted proxies", func(t *testing.T) {
+			// GIVEN
+			handlerFn, err := HTTPHandler(clientRepo, &MockSMTPClient{}, key, WithTenants(acme))
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotTenant = Tenant{ID: "foo"}
+
+			// WHEN
+			handlerFn(
+				http.HandlerFunc(
+					func(_ http.ResponseWriter, r *http.Request) {
+						gotTenant = TenantFromContext(r.Context())
+					},
+				),
+			).ServeHTTP(&utils.MockWriter{}, newRequest("/generate/c4", "", "acme"))
+
+			// THEN
+			if !reflect.DeepEqual(gotTenant, Tenant{}) {
+				t.Errorf("unexpected tenant: %+v", gotTenant)
+			}
+		},
+	)
+}
+
+func TestWithTenants_TenantClaim(t *testing.T) {
+	signingClient, err := newEd25519SigningClient(GenerateCertificate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenIssuer, err := NewIssuerWithSigningClient(signingClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRequest := func(claim, header string) *http.Request {
+		token, err := tokenIssuer.NewAccessToken(User{ID: "bar", Role: RoleAnonymUser, Tenant: claim})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &http.Request{
+			Method: http.MethodPost, URL: &url.URL{Path: "/generate/c4"},
+			Header:     http.Header{"Authorization": {"Bearer " + token}},
+			RemoteAddr: tenantProxyAddr,
+		}
+		if header != "" {
+			r.Header.Set(HeaderTenant, header)
+		}
+		return r
+	}
+
+	var gotTenant Tenant
+	handlerFn, err := HTTPHandlerWithSigningClient(
+		&MockRepositoryCIAM{}, &MockSMTPClient{}, signingClient,
+		WithTenants(Tenant{ID: "acme"}, Tenant{ID: "qux"}), withTenantProxies(t),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := handlerFn(
+		http.HandlerFunc(
+			func(_ http.ResponseWriter, r *http.Request) {
+				gotTenant = TenantFromContext(r.Context())
+			},
+		),
+	)
+
+	tests := []struct {
+		name       string
+		claim      string
+		header     string
+		wantTenant string
+		wantStatus int
+	}{
+		{name: "claim without header", claim: "acme", wantTenant: "acme"},
+		{name: "claim matching the header", claim: "acme", header: "acme", wantTenant: "acme"},
+		{name: "header without claim", header: "qux", wantStatus: http.StatusForbidden},
+		{name: "claim not matching the header", claim: "acme", header: "qux", wantStatus: http.StatusForbidden},
+		{name: "unknown claim", claim: "foo", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				gotTenant = Tenant{}
+				w := &utils.MockWriter{}
+
+				// WHEN
+				handler.ServeHTTP(w, newRequest(tt.claim, tt.header))
+
+				// THEN
+				if w.StatusCode != tt.wantStatus {
+					t.Fatalf("unexpected status code: got = %d, want = %d", w.StatusCode, tt.wantStatus)
+				}
+				if gotTenant.ID != tt.wantTenant {
+					t.Errorf("unexpected tenant: got = %s, want = %s", gotTenant.ID, tt.wantTenant)
+				}
+			},
+		)
+	}
+}
+
+func TestWithTenants_IssueTenantClaim(t *testing.T) {
+	// GIVEN
+	signingClient, err := newEd25519SigningClient(GenerateCertificate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenIssuer, err := NewIssuerWithSigningClient(signingClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlerFn, err := HTTPHandlerWithSigningClient(
+		&MockRepositoryCIAM{}, &MockSMTPClient{}, signingClient, WithTenants(Tenant{ID: "acme"}),
+		withTenantProxies(t),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &http.Request{
+		Method: http.MethodPost, URL: &url.URL{Path: "/auth/anonym"},
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(`{"fingerprint":"9468a4a53a2f2fd9ea96db22dc9dd9bb6ce38b71"}`)),
+		RemoteAddr: tenantProxyAddr,
+	}
+	r.Header.Set(HeaderTenant, "acme")
+	w := &utils.MockWriter{}
+
+	// WHEN
+	handlerFn(nil).ServeHTTP(w, r)
+
+	// THEN
+	var o struct {
+		Acc string `json:"access"`
+		Ref string `json:"refresh"`
+	}
+	if err := json.Unmarshal(w.V, &o); err != nil {
+		t.Fatalf("unexpected response: %d %s", w.StatusCode, w.V)
+	}
+	user, err := tokenIssuer.ParseAccessToken(o.Acc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Tenant != "acme" {
+		t.Errorf("the access token shall be issued with the tenant claim, got: %+v", user)
+	}
+	if _, tenant, err := tokenIssuer.ParseRefreshToken(o.Ref); err != nil || tenant != "acme" {
+		t.Errorf("the refresh token shall be issued with the tenant claim, got: %s, error: %v", tenant, err)
+	}
+}
+
+func TestWithTenants_RefreshTenantClaim(t *testing.T) {
+	key := GenerateCertificate()
+	tokenIssuer, err := NewIssuer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := userContainer{ID: utils.NewUUID(), IsActive: true, RoleID: uint8(RoleAnonymUser)}
+	handlerFn, err := HTTPHandler(
+		&MockRepositoryCIAM{UserID: map[string]*userContainer{user.ID: &user}}, &MockSMTPClient{}, key,
+		WithTenants(Tenant{ID: "acme"}, Tenant{ID: "qux"}), withTenantProxies(t),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := handlerFn(nil)
+
+	tests := []struct {
+		name       string
+		claim      string
+		header     string
+		wantTenant string
+		wantStatus int
+	}{
+		{name: "claim without header", claim: "acme", wantTenant: "acme"},
+		{name: "claim matching the header", claim: "acme", header: "acme", wantTenant: "acme"},
+		{name: "default tenant", wantTenant: ""},
+		{name: "header without claim", header: "qux", wantStatus: http.StatusForbidden},
+		{name: "claim not matching the header", claim: "acme", header: "qux", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(
+			"shall reissue the access token of the refresh token's tenant given the "+tt.name, func(t *testing.T) {
+				// GIVEN
+				refToken, err := tokenIssuer.NewRefreshToken(user.ID, tt.claim)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r := &http.Request{
+					Method: http.MethodPost, URL: &url.URL{Path: "/auth/refresh"},
+					Header:     http.Header{},
+					Body:       io.NopCloser(strings.NewReader(`{"refresh_token":"` + refToken + `"}`)),
+					RemoteAddr: tenantProxyAddr,
+				}
+				if tt.header != "" {
+					r.Header.Set(HeaderTenant, tt.header)
+				}
+				w := &utils.MockWriter{}
+
+				// WHEN
+				handler.ServeHTTP(w, r)
+
+				// THEN
+				if tt.wantStatus != 0 {
+					if w.StatusCode != tt.wantStatus {
+						t.Errorf("unexpected status code: got = %d, want = %d", w.StatusCode, tt.wantStatus)
+					}
+					return
+				}
+				var o struct {
+					Acc string `json:"access"`
+				}
+				if err := json.Unmarshal(w.V, &o); err != nil {
+					t.Fatalf("unexpected response: %d %s", w.StatusCode, w.V)
+				}
+				got, err := tokenIssuer.ParseAccessToken(o.Acc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Tenant != tt.wantTenant {
+					t.Errorf("unexpected tenant: got = %s, want = %s", got.Tenant, tt.wantTenant)
+				}
+			},
+		)
+	}
+}
+
+func TestRoleQuotas_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		quotas  RoleQuotas
+		wantErr bool
+	}{
+		{name: "default quotas", quotas: DefaultRoleQuotas()},
+		{
+			name:    "missing role",
+			quotas:  RoleQuotas{RoleAnonymUser: RoleAnonymUser.Quotas()},
+			wantErr: true,
+		},
+		{
+			name: "zero quotas",
+			quotas: RoleQuotas{
+				RoleAnonymUser: RoleAnonymUser.Quotas(), RoleRegisteredUser: {PromptLengthMax: 100},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if err := tt.quotas.Validate(); (err != nil) != tt.wantErr {
+					t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+func TestWithRoleQuotas(t *testing.T) {
+	// GIVEN
+	quotas := DefaultRoleQuotas()
+	quotas[RoleRegisteredUser] = Quotas{PromptLengthMax: 500, RequestsPerMinute: 5, RequestsPerDay: 50}
+
+	signingClient, err := newEd25519SigningClient(GenerateCertificate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenIssuer, err := NewIssuerWithSigningClient(signingClient, WithIssuerRoleQuotas(quotas))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the tenant qux overrides the quotas of the registered user only
+	quxQuotas := Quotas{PromptLengthMax: 50, RequestsPerMinute: 1, RequestsPerDay: 1}
+	handlerFn, err := HTTPHandlerWithSigningClient(
+		&MockRepositoryCIAM{}, &MockSMTPClient{}, signingClient,
+		WithTenants(Tenant{ID: "qux", Quotas: RoleQuotas{RoleRegisteredUser: quxQuotas}}),
+		WithRoleQuotas(quotas), withTenantProxies(t),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := handlerFn(nil)
+
+	tests := []struct {
+		name   string
+		tenant string
+		role   Role
+		want   Quotas
+	}{
+		{name: "default tenant", role: RoleRegisteredUser, want: quotas[RoleRegisteredUser]},
+		{name: "tenant's quotas", tenant: "qux", role: RoleRegisteredUser, want: quxQuotas},
+	}
+	for _, tt := range tests {
+		t.Run(
+			"shall return the configured quotas given the "+tt.name, func(t *testing.T) {
+				// GIVEN
+				r := &http.Request{
+					Method: http.MethodGet, URL: &url.URL{Path: "/quotas"},
+					Header: http.Header{}, RemoteAddr: tenantProxyAddr,
+				}
+				token, err := tokenIssuer.NewAccessToken(User{ID: "bar", Role: RoleRegisteredUser, Tenant: tt.tenant})
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.Header.Set("Authorization", "Bearer "+token)
+				if tt.tenant != "" {
+					r.Header.Set(HeaderTenant, tt.tenant)
+				}
+				w := &utils.MockWriter{}
+
+				// WHEN
+				handler.ServeHTTP(w, r)
+
+				// THEN
+				var got QuotasUsage
+				if err := json.Unmarshal(w.V, &got); err != nil {
+					t.Fatalf("unexpected response: %d %s", w.StatusCode, w.V)
+				}
+				if got.PromptLengthMax != tt.want.PromptLengthMax || got.RateMinute.Limit != tt.want.RequestsPerMinute ||
+					got.RateDay.Limit != tt.want.RequestsPerDay {
+					t.Errorf("unexpected quotas: %+v", got)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"shall issue the access token with the configured quotas", func(t *testing.T) {
+			// GIVEN
+			r := &http.Request{
+				Method: http.MethodPost, URL: &url.URL{Path: "/auth/anonym"},
+				Body: io.NopCloser(strings.NewReader(`{"fingerprint":"9468a4a53a2f2fd9ea96db22dc9dd9bb6ce38b71"}`)),
+			}
+			w := &utils.MockWriter{}
+
+			// WHEN
+			handler.ServeHTTP(w, r)
+
+			// THEN
+			var o struct {
+				Acc string `json:"access"`
+			}
+			if err := json.Unmarshal(w.V, &o); err != nil {
+				t.Fatalf("unexpected response: %d %s", w.StatusCode, w.V)
+			}
+			if _, err := tokenIssuer.ParseAccessToken(o.Acc); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		},
+	)
+}
@@ -1,9 +1,8 @@
 package ciam
 
 import (
-	"crypto"
+	"context"
 	"crypto/ed25519"
-	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -65,9 +64,13 @@ type accessTokenClaims struct {
 	stdClaims
 	Role   Role   `json:"role"`
 	Quotas Quotas `json:"quotas"`
+	// Tenant the ID of the user's tenant, it is omitted for the default tenant.
+	Tenant string `json:"tenant,omitempty"`
 }
 
 type refreshTokenClaims struct {
+	// Tenant the ID of the user's tenant, it is omitted for the default tenant.
+	Tenant string `json:"tenant,omitempty"`
 	stdClaims
 }
 
@@ -95,45 +98,88 @@ type Issuer interface {
 	NewIDToken(userID, email, fingerprint string, fnOps ...ClaimsOps) (string, error)
 	// NewAccessToken issuer access JWT.
 	NewAccessToken(user User, fnOps ...ClaimsOps) (string, error)
-	// NewRefreshToken issuer refresh JWT.
-	NewRefreshToken(userID string, fnOps ...ClaimsOps) (string, error)
+	// NewRefreshToken issuer refresh JWT, the access tokens are reissued for the tenant of the refresh token.
+	NewRefreshToken(userID, tenant string, fnOps ...ClaimsOps) (string, error)
 	// ParseIDToken parses id JWT.
 	ParseIDToken(token string) (userID, email, fingerprint string, err error)
 	// ParseRefreshToken parses refresh JWT.
-	ParseRefreshToken(token string) (userID string, err error)
+	ParseRefreshToken(token string) (userID, tenant string, err error)
 	// ParseAccessToken parses access JWT.
 	ParseAccessToken(token string) (user User, err error)
 }
 
-func NewIssuer(key ed25519.PrivateKey) (Issuer, error) {
-	if key == nil {
-		return nil, errors.New("no valid ed25519 private key provided")
+// TokenSigningClient defines the client to sign and verify JWT.
+type TokenSigningClient interface {
+	// Alg returns the JWT "alg" header value corresponding to the signature algorithm.
+	Alg() string
+	// Sign signs the JWT signing string.
+	Sign(ctx context.Context, signingString string) (signature []byte, err error)
+	// Verify verifies the JWT signature over the signing string.
+	Verify(ctx context.Context, signingString string, signature []byte) error
+}
+
+func NewIssuer(key ed25519.PrivateKey, fnOps ...IssuerOps) (Issuer, error) {
+	signingClient, err := newEd25519SigningClient(key)
+	if err != nil {
+		return nil, err
 	}
-	pubKey, ok := key.Public().(ed25519.PublicKey)
-	if !ok || len(pubKey) != ed25519.PublicKeySize {
-		return nil, errors.New("key is invalid")
+	return NewIssuerWithSigningClient(signingClient, fnOps...)
+}
+
+// NewIssuerWithSigningClient initialises the Issuer which signs tokens using the TokenSigningClient.
+func NewIssuerWithSigningClient(signingClient TokenSigningClient, fnOps ...IssuerOps) (Issuer, error) {
+	if signingClient == nil {
+		return nil, errors.New("signing client is required")
 	}
 
 	h := struct {
 		Alg string `json:"alg"`
 		Typ string `json:"typ"`
 	}{
-		Alg: "EdDSA",
+		Alg: signingClient.Alg(),
 		Typ: "JWT",
 	}
 	header, _ := json.Marshal(h)
 
-	return issuer{
-		privKey: key,
-		pubKey:  pubKey,
-		header:  encodeSegment(header),
-	}, nil
+	o := issuer{
+		signingClient: signingClient,
+		header:        encodeSegment(header),
+	}
+	for _, fn := range fnOps {
+		fn(&o)
+	}
+	return o, nil
 }
 
 type issuer struct {
-	privKey ed25519.PrivateKey
-	pubKey  ed25519.PublicKey
-	header  string
+	signingClient TokenSigningClient
+	header        string
+	// quotas the configured quotas per role, the roles which are not set use Role.Quotas.
+	quotas RoleQuotas
+}
+
+// IssuerOps defines the options of the Issuer.
+type IssuerOps func(i *issuer)
+
+// WithIssuerRoleQuotas configures the quotas per role set to, and validated in the access tokens
+// instead of the defaults, see Role.Quotas.
+func WithIssuerRoleQuotas(quotas RoleQuotas) IssuerOps {
+	return func(i *issuer) {
+		*i = i.withRoleQuotas(quotas)
+	}
+}
+
+func (i issuer) withRoleQuotas(quotas RoleQuotas) issuer {
+	i.quotas = quotas
+	return i
+}
+
+// roleQuotas returns the role's configured quotas.
+func (i issuer) roleQuotas(role Role) Quotas {
+	if v, ok := i.quotas[role]; ok {
+		return v
+	}
+	return role.Quotas()
 }
 
 func (i issuer) serializeAndSign(tkn interface{}) (string, error) {
@@ -144,7 +190,7 @@ func (i issuer) serializeAndSign(tkn interface{}) (string, error) {
 
 	signingStr := i.header + "." + encodeSegment(payload)
 
-	signature, err := i.privKey.Sign(rand.Reader, []byte(signingStr), crypto.Hash(0))
+	signature, err := i.signingClient.Sign(context.Background(), signingStr)
 	if err != nil {
 		return "", err
 	}
@@ -164,14 +210,16 @@ func (i issuer) NewIDToken(userID, email, fingerprint string, fnOps ...ClaimsOps
 func (i issuer) NewAccessToken(user User, fnOps ...ClaimsOps) (string, error) {
 	tkn := accessTokenClaims{
 		Role:      user.Role,
-		Quotas:    user.Role.Quotas(),
+		Quotas:    i.roleQuotas(user.Role),
+		Tenant:    user.Tenant,
 		stdClaims: newStdClaims(user.ID, defaultExpirationDurationAccess, fnOps...),
 	}
 	return i.serializeAndSign(tkn)
 }
 
-func (i issuer) NewRefreshToken(userID string, fnOps ...ClaimsOps) (string, error) {
+func (i issuer) NewRefreshToken(userID, tenant string, fnOps ...ClaimsOps) (string, error) {
 	tkn := refreshTokenClaims{
+		Tenant:    tenant,
 		stdClaims: newStdClaims(userID, defaultExpirationDurationRefresh, fnOps...),
 	}
 	return i.serializeAndSign(tkn)
@@ -190,7 +238,7 @@ func (i issuer) parseToken(token string, tkn interface{}) error {
 
 	signingStr := els[0] + "." + els[1]
 
-	if !ed25519.Verify(i.pubKey, []byte(signingStr), sig) {
+	if err := i.signingClient.Verify(context.Background(), signingStr, sig); err != nil {
 		return errors.New("wrong signature")
 	}
 
@@ -217,15 +265,15 @@ func (i issuer) ParseIDToken(token string) (userID, email, fingerprint string, e
 	return tkn.Sub, tkn.Email, tkn.Fingerprint, nil
 }
 
-func (i issuer) ParseRefreshToken(token string) (userID string, err error) {
+func (i issuer) ParseRefreshToken(token string) (userID, tenant string, err error) {
 	var tkn refreshTokenClaims
 	if err := i.parseToken(token, &tkn); err != nil {
-		return "", err
+		return "", "", err
 	}
 	if err := tkn.IsValidToken(); err != nil {
-		return "", err
+		return "", "", err
 	}
-	return tkn.Sub, nil
+	return tkn.Sub, tkn.Tenant, nil
 }
 
 func (i issuer) ParseAccessToken(token string) (user User, err error) {
@@ -237,12 +285,12 @@ func (i issuer) ParseAccessToken(token string) (user User, err error) {
 		return
 	}
 
-	if !reflect.DeepEqual(tkn.Quotas, tkn.Role.Quotas()) {
+	if !reflect.DeepEqual(tkn.Quotas, i.roleQuotas(tkn.Role)) {
 		err = errors.New("quotas from the token are not up to date")
 		return
 	}
 
-	user = User{ID: tkn.Sub, Role: tkn.Role}
+	user = User{ID: tkn.Sub, Role: tkn.Role, Tenant: tkn.Tenant}
 	return
 }
 
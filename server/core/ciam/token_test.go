@@ -1,9 +1,12 @@
 package ciam
 
 import (
+	"context"
 	"crypto/ed25519"
+	"encoding/json"
 	"math/rand"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/kislerdm/diagramastext/server/core/internal/utils"
@@ -77,14 +80,50 @@ func TestCircular(t *testing.T) {
 		},
 	)
 
+	t.Run(
+		"shall parse generated access token with the tenant claim", func(t *testing.T) {
+			userWant := User{ID: userWant.ID, Role: RoleAnonymUser, Tenant: "acme"}
+			tknStr, err := issuer.NewAccessToken(userWant)
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			got, err := issuer.ParseAccessToken(tknStr)
+			if err != nil {
+				t.Fatalf("failed to parse generated token: %v", err)
+			}
+
+			if !reflect.DeepEqual(userWant, got) {
+				t.Errorf("wront user data extracted from the token. want: %v, got: %v", userWant, got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall omit the tenant claim of the default tenant", func(t *testing.T) {
+			tknStr, err := issuer.NewAccessToken(userWant)
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			payload, err := decodeSegment(strings.Split(tknStr, ".")[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(payload), `"tenant"`) {
+				t.Errorf("unexpected tenant claim: %s", payload)
+			}
+		},
+	)
+
 	t.Run(
 		"shall parse generated refresh token", func(t *testing.T) {
-			tknStr, err := issuer.NewRefreshToken(userWant.ID)
+			tknStr, err := issuer.NewRefreshToken(userWant.ID, "acme")
 			if err != nil {
 				t.Fatalf("failed to generate token: %v", err)
 			}
 
-			userIDGot, err := issuer.ParseRefreshToken(tknStr)
+			userIDGot, tenantGot, err := issuer.ParseRefreshToken(tknStr)
 			if err != nil {
 				t.Fatalf("failed to parse generated token: %v", err)
 			}
@@ -92,6 +131,157 @@ func TestCircular(t *testing.T) {
 			if userWant.ID != userIDGot {
 				t.Errorf("wront userIDWant extracted from the token. want: %s, got: %s", userWant.ID, userIDGot)
 			}
+			if tenantGot != "acme" {
+				t.Errorf("wrong tenant extracted from the token: %s", tenantGot)
+			}
+		},
+	)
+}
+
+// recordingSigningClient records the signing strings passed to the wrapped TokenSigningClient.
+type recordingSigningClient struct {
+	TokenSigningClient
+	signingStrings []string
+}
+
+func (c *recordingSigningClient) Sign(ctx context.Context, signingString string) ([]byte, error) {
+	c.signingStrings = append(c.signingStrings, signingString)
+	return c.TokenSigningClient.Sign(ctx, signingString)
+}
+
+func TestIssuerSignsSigningString(t *testing.T) {
+	for name, newSigningClient := range map[string]func(t *testing.T) TokenSigningClient{
+		"ed25519": func(t *testing.T) TokenSigningClient {
+			c, err := newEd25519SigningClient(GenerateCertificate())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c
+		},
+		"kms": func(t *testing.T) TokenSigningClient {
+			return &kmsSigningClient{client: newMockKMSClient(t), keyID: "foo"}
+		},
+	} {
+		t.Run(
+			name, func(t *testing.T) {
+				// GIVEN
+				signingClient := &recordingSigningClient{TokenSigningClient: newSigningClient(t)}
+				iss, err := NewIssuerWithSigningClient(signingClient)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// WHEN
+				tkn, err := iss.NewIDToken("foo", "foo@bar.baz", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// THEN
+				els := strings.Split(tkn, ".")
+				wantSigningString := els[0] + "." + els[1]
+				if len(signingClient.signingStrings) != 1 || signingClient.signingStrings[0] != wantSigningString {
+					t.Fatalf("token must be signed over its signing string, got: %v", signingClient.signingStrings)
+				}
+
+				sig, err := decodeSegment(els[2])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := signingClient.Verify(context.TODO(), wantSigningString, sig); err != nil {
+					t.Errorf("signature does not verify against the signing string: %v", err)
+				}
+				if err := signingClient.Verify(context.TODO(), "", sig); err == nil {
+					t.Error("signature must not verify against the empty payload")
+				}
+			},
+		)
+	}
+}
+
+func TestWithIssuerRoleQuotas(t *testing.T) {
+	// GIVEN
+	quotas := DefaultRoleQuotas()
+	quotas[RoleRegisteredUser] = Quotas{PromptLengthMax: 500, RequestsPerMinute: 5, RequestsPerDay: 50}
+
+	key := GenerateCertificate()
+	issuerCustom, err := NewIssuer(key, WithIssuerRoleQuotas(quotas))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerDefault, err := NewIssuer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := User{ID: utils.NewUUID(), Role: RoleRegisteredUser}
+
+	t.Run(
+		"shall issue the access token with the configured quotas", func(t *testing.T) {
+			// WHEN
+			tknStr, err := issuerCustom.NewAccessToken(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			payload, err := decodeSegment(strings.Split(tknStr, ".")[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			var claims accessTokenClaims
+			if err := json.Unmarshal(payload, &claims); err != nil {
+				t.Fatal(err)
+			}
+			if claims.Quotas != quotas[RoleRegisteredUser] {
+				t.Errorf("unexpected quotas: %+v", claims.Quotas)
+			}
+
+			got, err := issuerCustom.ParseAccessToken(tknStr)
+			if err != nil {
+				t.Fatalf("failed to parse generated token: %v", err)
+			}
+			if !reflect.DeepEqual(got, user) {
+				t.Errorf("unexpected user: %+v", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall reject the access token with the quotas which are not configured", func(t *testing.T) {
+			// GIVEN
+			tknStr, err := issuerDefault.NewAccessToken(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			_, err = issuerCustom.ParseAccessToken(tknStr)
+
+			// THEN
+			if err == nil {
+				t.Error("error expected given the token with outdated quotas")
+			}
+		},
+	)
+
+	t.Run(
+		"shall use the default quotas of the roles which are not configured", func(t *testing.T) {
+			// GIVEN
+			iss, err := NewIssuer(key, WithIssuerRoleQuotas(RoleQuotas{RoleRegisteredUser: quotas[RoleRegisteredUser]}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			tknStr, err := iss.NewAccessToken(User{ID: user.ID, Role: RoleAnonymUser})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			if _, err := issuerDefault.ParseAccessToken(tknStr); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
 		},
 	)
 }
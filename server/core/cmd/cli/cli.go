@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/diagram/c4container"
+)
+
+// config defines the CLI's parameters.
+type config struct {
+	// Prompt the user's prompt to generate the diagram, it is read from stdin if neither Prompt nor GraphFile is set.
+	Prompt string
+	// GraphFile the path to the JSON-encoded diagram's graph.
+	GraphFile string
+	// Template the name of the common architecture's template to render, see c4container.Templates.
+	Template string
+	// Format the output format: svg, png, pdf or dsl.
+	Format c4container.Format
+	// Out the path to write the rendered diagram to, it is written to stdout if not set.
+	Out string
+	// Local defines the mode to render the graph file without calling the model.
+	// Combined with the dsl format, or with the self-hosted PlantUML server, it runs without internet access.
+	Local bool
+	// PlantUMLURL the base URL of the PlantUML server, e.g. self-hosted, used to render svg and png.
+	PlantUMLURL string
+	// RSVG defines if png and pdf shall be converted from svg using rsvg-convert instead of the PlantUML server.
+	RSVG bool
+}
+
+func parseFlags(args []string, output io.Writer) (config, error) {
+	var (
+		cfg    config
+		format string
+	)
+
+	fs := flag.NewFlagSet("diagramastext", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(
+		&cfg.Prompt, "prompt", "", "prompt to generate the diagram, requires OPENAI_API_KEY; read from stdin if not set",
+	)
+	fs.StringVar(&cfg.GraphFile, "graph-file", "", "path to the JSON file with the diagram's graph")
+	fs.StringVar(
+		&cfg.Template, "template", "",
+		"name of the architecture template to render: "+strings.Join(c4container.Templates(), ", "),
+	)
+	fs.StringVar(&format, "format", string(c4container.FormatSVG), "output format: svg, png, pdf or dsl")
+	fs.StringVar(&cfg.Out, "out", "", "path to write the diagram to, stdout if not set")
+	fs.BoolVar(&cfg.Local, "local", false, "render the -graph-file, or the -template without calling the model")
+	fs.BoolVar(&cfg.RSVG, "rsvg", false, "convert svg to png or pdf using rsvg-convert instead of PlantUML server")
+	fs.StringVar(
+		&cfg.PlantUMLURL, "plantuml-url", "", "base URL of the PlantUML server, e.g. http://localhost:8080/",
+	)
+
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+
+	cfg.Format = c4container.Format(format)
+	if err := cfg.Validate(); err != nil {
+		return config{}, err
+	}
+
+	return cfg, nil
+}
+
+// Validate validates the CLI's parameters.
+func (cfg config) Validate() error {
+	var inputs int
+	for _, v := range []string{cfg.Prompt, cfg.GraphFile, cfg.Template} {
+		if v != "" {
+			inputs++
+		}
+	}
+	if inputs > 1 {
+		return errors.New("only one of -prompt, -graph-file and -template can be set")
+	}
+	if cfg.Local && cfg.GraphFile == "" && cfg.Template == "" {
+		return errors.New("-graph-file, or -template must be set in the -local mode")
+	}
+	if cfg.RSVG && cfg.Format != c4container.FormatPNG && cfg.Format != c4container.FormatPDF {
+		return errors.New("-rsvg can only be set for png and pdf formats")
+	}
+
+	switch cfg.Format {
+	case c4container.FormatSVG, c4container.FormatPNG, c4container.FormatPDF, c4container.FormatDSL:
+		return nil
+	default:
+		return errors.New("-format must be one of svg, png, pdf or dsl")
+	}
+}
+
+// clients defines the clients used to generate the diagram.
+type clients struct {
+	// newModelInference initialises the model inference client, it is only called to generate the diagram from prompt.
+	newModelInference func() (diagram.ModelInference, error)
+	httpClient        diagram.HTTPClient
+}
+
+// run generates the diagram and writes it to the output file, or to stdout if the output file is not set.
+// The prompt is read from stdin if neither the prompt, nor the graph file is set.
+// The model is only called to generate the diagram from prompt, and the PlantUML server is not called
+// to generate the dsl output.
+func run(ctx context.Context, cfg config, c clients, stdin io.Reader, stdout io.Writer) error {
+	if cfg.Prompt == "" && cfg.GraphFile == "" && cfg.Template == "" {
+		prompt, err := readPrompt(stdin)
+		if err != nil {
+			return err
+		}
+		cfg.Prompt = prompt
+	}
+
+	graph, err := readGraph(ctx, cfg, c)
+	if err != nil {
+		return err
+	}
+
+	renderOps := []c4container.HandlerOps{c4container.WithPlantUMLBaseURL(cfg.PlantUMLURL)}
+	if cfg.RSVG {
+		converter, err := c4container.NewExternalRSVGConverter(cfg.Format)
+		if err != nil {
+			return err
+		}
+		renderOps = append(renderOps, c4container.WithPNGRasterizer(converter), c4container.WithPDFConverter(converter))
+	}
+
+	o, err := c4container.Render(ctx, c.httpClient, graph, cfg.Format, renderOps...)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Out == "" {
+		_, err = stdout.Write(o)
+		return err
+	}
+	return os.WriteFile(cfg.Out, o, 0644)
+}
+
+func readPrompt(stdin io.Reader) (string, error) {
+	if stdin == nil {
+		return "", errNoPrompt
+	}
+
+	v, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", err
+	}
+
+	prompt := strings.TrimSpace(string(v))
+	if prompt == "" {
+		return "", errNoPrompt
+	}
+	return prompt, nil
+}
+
+var errNoPrompt = errors.New("prompt must be set using -prompt, or piped to stdin; or -graph-file must be set")
+
+func readGraph(ctx context.Context, cfg config, c clients) ([]byte, error) {
+	if cfg.GraphFile != "" {
+		return os.ReadFile(cfg.GraphFile)
+	}
+
+	if cfg.Template != "" {
+		return c4container.Template(cfg.Template)
+	}
+
+	if c.newModelInference == nil {
+		return nil, errors.New("model inference client is not configured")
+	}
+	modelInference, err := c.newModelInference()
+	if err != nil {
+		return nil, err
+	}
+
+	return c4container.PredictGraph(ctx, modelInference, cfg.Prompt)
+}
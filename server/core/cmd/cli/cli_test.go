@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/diagram/c4container"
+)
+
+func Test_parseFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    config
+		wantErr bool
+	}{
+		{
+			name: "prompt with the default format",
+			args: []string{"-prompt", "foo", "-out", "diagram.svg"},
+			want: config{Prompt: "foo", Format: c4container.FormatSVG, Out: "diagram.svg"},
+		},
+		{
+			name: "graph file rendered as DSL",
+			args: []string{"-graph-file", "graph.json", "-format", "dsl", "-out", "diagram.puml"},
+			want: config{GraphFile: "graph.json", Format: c4container.FormatDSL, Out: "diagram.puml"},
+		},
+		{
+			name: "graph file rendered as png",
+			args: []string{"-graph-file", "graph.json", "-format", "png", "-out", "diagram.png"},
+			want: config{GraphFile: "graph.json", Format: c4container.FormatPNG, Out: "diagram.png"},
+		},
+		{
+			name: "neither prompt nor graph file to read prompt from stdin",
+			args: []string{"-out", "diagram.svg"},
+			want: config{Format: c4container.FormatSVG, Out: "diagram.svg"},
+		},
+		{
+			name: "graph file rendered as pdf",
+			args: []string{"-graph-file", "graph.json", "-format", "pdf", "-out", "diagram.pdf"},
+			want: config{GraphFile: "graph.json", Format: c4container.FormatPDF, Out: "diagram.pdf"},
+		},
+		{
+			name: "png rasterized with rsvg-convert",
+			args: []string{"-graph-file", "graph.json", "-format", "png", "-rsvg"},
+			want: config{GraphFile: "graph.json", Format: c4container.FormatPNG, RSVG: true},
+		},
+		{
+			name:    "rsvg-convert for svg",
+			args:    []string{"-graph-file", "graph.json", "-rsvg"},
+			wantErr: true,
+		},
+		{
+			name:    "both prompt and graph file",
+			args:    []string{"-prompt", "foo", "-graph-file", "graph.json", "-out", "diagram.svg"},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported format",
+			args:    []string{"-prompt", "foo", "-format", "jpeg", "-out", "diagram.jpeg"},
+			wantErr: true,
+		},
+		{
+			name: "output is not set to write to stdout",
+			args: []string{"-prompt", "foo"},
+			want: config{Prompt: "foo", Format: c4container.FormatSVG},
+		},
+		{
+			name: "local mode with the self-hosted PlantUML server",
+			args: []string{"-local", "-graph-file", "graph.json", "-plantuml-url", "http://localhost:8080/"},
+			want: config{
+				GraphFile: "graph.json", Format: c4container.FormatSVG, Local: true,
+				PlantUMLURL: "http://localhost:8080/",
+			},
+		},
+		{
+			name:    "local mode without graph file",
+			args:    []string{"-local", "-prompt", "foo"},
+			wantErr: true,
+		},
+		{
+			name: "template rendered locally",
+			args: []string{"-local", "-template", "web-app", "-format", "dsl"},
+			want: config{Template: "web-app", Format: c4container.FormatDSL, Local: true},
+		},
+		{
+			name:    "both template and graph file",
+			args:    []string{"-template", "web-app", "-graph-file", "graph.json"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"-foo"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := parseFlags(tt.args, io.Discard)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("parseFlags() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("parseFlags() got = %+v, want %+v", got, tt.want)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"help", func(t *testing.T) {
+			if _, err := parseFlags([]string{"-h"}, io.Discard); !errors.Is(err, flag.ErrHelp) {
+				t.Errorf("help error expected, got %v", err)
+			}
+		},
+	)
+}
+
+type mockPlantUMLClient struct {
+	v        []byte
+	requests []*http.Request
+}
+
+func (m *mockPlantUMLClient) Do(req *http.Request) (*http.Response, error) {
+	m.requests = append(m.requests, req)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(string(m.v))),
+	}, nil
+}
+
+const graph = `{"nodes":[{"id":"0","label":"Web"},{"id":"1","label":"DB","database":true}],` +
+	`"links":[{"from":"0","to":"1"}]}`
+
+func Test_run(t *testing.T) {
+	t.Run(
+		"shall render the graph file", func(t *testing.T) {
+			// GIVEN
+			dir := t.TempDir()
+			graphFile := filepath.Join(dir, "graph.json")
+			if err := os.WriteFile(graphFile, []byte(graph), 0644); err != nil {
+				t.Fatal(err)
+			}
+			out := filepath.Join(dir, "diagram.svg")
+			httpClient := &mockPlantUMLClient{v: []byte("<svg></svg>")}
+
+			// WHEN
+			err := run(
+				context.TODO(), config{GraphFile: graphFile, Format: c4container.FormatSVG, Out: out},
+				clients{httpClient: httpClient}, nil, io.Discard,
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "<svg></svg>" {
+				t.Errorf("unexpected output: %s", got)
+			}
+			if len(httpClient.requests) != 1 || !strings.Contains(httpClient.requests[0].URL.Path, "/svg/") {
+				t.Errorf("unexpected requests to PlantUML: %v", httpClient.requests)
+			}
+		},
+	)
+
+	t.Run(
+		"shall render the prompt", func(t *testing.T) {
+			// GIVEN
+			out := filepath.Join(t.TempDir(), "diagram.png")
+			httpClient := &mockPlantUMLClient{v: []byte("png")}
+			c := clients{
+				newModelInference: func() (diagram.ModelInference, error) {
+					return diagram.MockModelInference{V: []byte(graph)}, nil
+				},
+				httpClient: httpClient,
+			}
+
+			// WHEN
+			err := run(
+				context.TODO(), config{Prompt: "foo", Format: c4container.FormatPNG, Out: out}, c, nil, io.Discard,
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(httpClient.requests) != 1 || !strings.Contains(httpClient.requests[0].URL.Path, "/png/") {
+				t.Errorf("unexpected requests to PlantUML: %v", httpClient.requests)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail", func(t *testing.T) {
+			dir := t.TempDir()
+			tests := []struct {
+				name string
+				cfg  config
+				c    clients
+			}{
+				{
+					name: "graph file not found",
+					cfg:  config{GraphFile: filepath.Join(dir, "missing.json"), Format: c4container.FormatSVG, Out: "foo"},
+					c:    clients{httpClient: &mockPlantUMLClient{}},
+				},
+				{
+					name: "model inference client cannot be initialised",
+					cfg:  config{Prompt: "foo", Format: c4container.FormatSVG, Out: "foo"},
+					c: clients{
+						newModelInference: func() (diagram.ModelInference, error) {
+							return nil, errors.New("token must be set")
+						},
+					},
+				},
+				{
+					name: "model inference error",
+					cfg:  config{Prompt: "foo", Format: c4container.FormatSVG, Out: "foo"},
+					c: clients{
+						newModelInference: func() (diagram.ModelInference, error) {
+							return diagram.MockModelInference{Err: errors.New("foo")}, nil
+						},
+					},
+				},
+			}
+			for _, tt := range tests {
+				t.Run(
+					tt.name, func(t *testing.T) {
+						if err := run(context.TODO(), tt.cfg, tt.c, nil, io.Discard); err == nil {
+							t.Error("error expected")
+						}
+					},
+				)
+			}
+		},
+	)
+}
+
+func Test_runStdinStdout(t *testing.T) {
+	newModelInference := func(gotPrompt *string) func() (diagram.ModelInference, error) {
+		return func() (diagram.ModelInference, error) {
+			return mockModelInferenceFn(
+				func(prompt string) []byte {
+					*gotPrompt = prompt
+					return []byte(graph)
+				},
+			), nil
+		}
+	}
+
+	t.Run(
+		"shall read the prompt from stdin and write the diagram to stdout", func(t *testing.T) {
+			// GIVEN
+			var gotPrompt string
+			c := clients{
+				newModelInference: newModelInference(&gotPrompt),
+				httpClient:        &mockPlantUMLClient{v: []byte("<svg></svg>")},
+			}
+			var stdout bytes.Buffer
+
+			// WHEN
+			err := run(
+				context.TODO(), config{Format: c4container.FormatSVG}, c, strings.NewReader("draw X\n"), &stdout,
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotPrompt != "draw X" {
+				t.Errorf("unexpected prompt: %q", gotPrompt)
+			}
+			if stdout.String() != "<svg></svg>" {
+				t.Errorf("unexpected stdout: %s", stdout.String())
+			}
+		},
+	)
+
+	t.Run(
+		"shall respect the format writing to stdout", func(t *testing.T) {
+			// GIVEN
+			var gotPrompt string
+			c := clients{newModelInference: newModelInference(&gotPrompt)}
+			var stdout bytes.Buffer
+
+			// WHEN
+			err := run(context.TODO(), config{Format: c4container.FormatDSL}, c, strings.NewReader("draw X"), &stdout)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(stdout.String(), "@startuml") {
+				t.Errorf("unexpected stdout: %s", stdout.String())
+			}
+		},
+	)
+
+	t.Run(
+		"shall prefer the prompt flag over stdin", func(t *testing.T) {
+			// GIVEN
+			var gotPrompt string
+			c := clients{newModelInference: newModelInference(&gotPrompt)}
+
+			// WHEN
+			err := run(
+				context.TODO(), config{Prompt: "foo", Format: c4container.FormatDSL}, c, strings.NewReader("bar"),
+				io.Discard,
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotPrompt != "foo" {
+				t.Errorf("unexpected prompt: %q", gotPrompt)
+			}
+		},
+	)
+
+	for name, stdin := range map[string]io.Reader{
+		"empty stdin":      strings.NewReader(""),
+		"blank stdin":      strings.NewReader(" \n\t"),
+		"stdin is not set": nil,
+	} {
+		t.Run(
+			"shall fail gracefully given "+name, func(t *testing.T) {
+				// GIVEN
+				var gotPrompt string
+				c := clients{newModelInference: newModelInference(&gotPrompt)}
+				var stdout bytes.Buffer
+
+				// WHEN
+				err := run(context.TODO(), config{Format: c4container.FormatSVG}, c, stdin, &stdout)
+
+				// THEN
+				if !errors.Is(err, errNoPrompt) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				if stdout.Len() != 0 {
+					t.Errorf("nothing shall be written to stdout, got: %s", stdout.String())
+				}
+			},
+		)
+	}
+}
+
+type mockModelInferenceFn func(prompt string) []byte
+
+func (m mockModelInferenceFn) Do(_ context.Context, prompt, _, _ string) (string, []byte, uint16, uint16, error) {
+	v := m(prompt)
+	return string(v), v, 0, 0, nil
+}
+
+type roundTripperFn func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFn) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func Test_runLocal(t *testing.T) {
+	graphFile := filepath.Join(t.TempDir(), "graph.json")
+	if err := os.WriteFile(graphFile, []byte(graph), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run(
+		"shall render DSL without outbound http requests", func(t *testing.T) {
+			// GIVEN
+			defaultTransport := http.DefaultTransport
+			t.Cleanup(func() { http.DefaultTransport = defaultTransport })
+			http.DefaultTransport = roundTripperFn(
+				func(req *http.Request) (*http.Response, error) {
+					t.Errorf("unexpected outbound request: %s", req.URL)
+					return nil, errors.New("network is not available")
+				},
+			)
+
+			httpClient := &mockPlantUMLClient{}
+			c := clients{
+				newModelInference: func() (diagram.ModelInference, error) {
+					t.Error("model inference client shall not be initialised")
+					return nil, errors.New("network is not available")
+				},
+				httpClient: httpClient,
+			}
+			var stdout bytes.Buffer
+
+			// WHEN
+			err := run(
+				context.TODO(), config{GraphFile: graphFile, Format: c4container.FormatDSL, Local: true}, c,
+				strings.NewReader("foo"), &stdout,
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(httpClient.requests) != 0 {
+				t.Errorf("unexpected requests to PlantUML: %v", httpClient.requests)
+			}
+			if !strings.HasPrefix(stdout.String(), "@startuml") {
+				t.Errorf("unexpected output: %s", stdout.String())
+			}
+		},
+	)
+
+	t.Run(
+		"shall render the template", func(t *testing.T) {
+			// GIVEN
+			var stdout bytes.Buffer
+
+			// WHEN
+			err := run(
+				context.TODO(), config{Template: "web-app", Format: c4container.FormatDSL, Local: true}, clients{},
+				nil, &stdout,
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(stdout.String(), `title "Three-tier web application"`) {
+				t.Errorf("unexpected output: %s", stdout.String())
+			}
+		},
+	)
+
+	t.Run(
+		"shall render svg using the self-hosted PlantUML server", func(t *testing.T) {
+			// GIVEN
+			httpClient := &mockPlantUMLClient{v: []byte("<svg></svg>")}
+			cfg := config{
+				GraphFile: graphFile, Format: c4container.FormatSVG, Local: true,
+				PlantUMLURL: "http://localhost:8080",
+			}
+
+			// WHEN
+			err := run(context.TODO(), cfg, clients{httpClient: httpClient}, nil, io.Discard)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(httpClient.requests) != 1 ||
+				!strings.HasPrefix(httpClient.requests[0].URL.String(), "http://localhost:8080/svg/") {
+				t.Errorf("unexpected requests to PlantUML: %v", httpClient.requests)
+			}
+		},
+	)
+}
@@ -0,0 +1,20 @@
+module cli
+
+go 1.19
+
+require (
+	github.com/kislerdm/diagramastext/server/core v0.0.5
+	github.com/kislerdm/diagramastext/server/core/pkg/httpclient v0.0.1
+	github.com/kislerdm/diagramastext/server/core/pkg/openai v0.0.4
+)
+
+require (
+	github.com/google/uuid v1.3.0 // indirect
+	golang.org/x/text v0.8.0 // indirect
+)
+
+replace (
+	github.com/kislerdm/diagramastext/server/core v0.0.5 => ../../
+	github.com/kislerdm/diagramastext/server/core/pkg/httpclient v0.0.1 => ../../pkg/httpclient
+	github.com/kislerdm/diagramastext/server/core/pkg/openai v0.0.4 => ../../pkg/openai
+)
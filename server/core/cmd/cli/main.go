@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/pkg/httpclient"
+	"github.com/kislerdm/diagramastext/server/core/pkg/openai"
+)
+
+func main() {
+	cfg, err := parseFlags(os.Args[1:], os.Stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(2)
+	}
+
+	c := clients{
+		newModelInference: newOpenAIClient,
+		httpClient: httpclient.NewHTTPClient(
+			httpclient.Config{
+				Timeout: 1 * time.Minute,
+				Backoff: httpclient.Backoff{
+					MaxIterations:             2,
+					BackoffTimeMinMillisecond: 10,
+					BackoffTimeMaxMillisecond: 50,
+				},
+			},
+		),
+	}
+
+	if cfg.Local {
+		c.newModelInference = nil
+	}
+
+	if err := run(context.Background(), cfg, c, stdin(), os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// stdin returns the standard input if it is piped, and nil if it is the terminal to avoid waiting for input.
+func stdin() io.Reader {
+	stat, err := os.Stdin.Stat()
+	if err != nil || stat.Mode()&os.ModeCharDevice != 0 {
+		return nil
+	}
+	return os.Stdin
+}
+
+func newOpenAIClient() (diagram.ModelInference, error) {
+	var maxTokens int
+	if v := os.Getenv("OPENAI_MAX_TOKENS"); v != "" {
+		var err error
+		if maxTokens, err = strconv.Atoi(v); err != nil {
+			return nil, errors.New("OPENAI_MAX_TOKENS must be integer")
+		}
+	}
+
+	return openai.NewOpenAIClient(
+		openai.Config{
+			Token:        os.Getenv("OPENAI_API_KEY"),
+			Organization: os.Getenv("OPENAI_ORG_ID"),
+			MaxTokens:    maxTokens,
+			HTTPClient: httpclient.NewHTTPClient(
+				httpclient.Config{
+					Timeout: 2 * time.Minute,
+					Backoff: httpclient.Backoff{
+						MaxIterations:             2,
+						BackoffTimeMinMillisecond: 50,
+						BackoffTimeMaxMillisecond: 300,
+					},
+				},
+			),
+		},
+	)
+}
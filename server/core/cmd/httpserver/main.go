@@ -6,9 +6,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"expvar"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/kislerdm/diagramastext/server/core/ciam"
@@ -16,15 +22,22 @@ import (
 	"github.com/kislerdm/diagramastext/server/core/diagram"
 	"github.com/kislerdm/diagramastext/server/core/diagram/c4container"
 	handlerPkg "github.com/kislerdm/diagramastext/server/core/httphandler"
+	"github.com/kislerdm/diagramastext/server/core/logger"
 	"github.com/kislerdm/diagramastext/server/core/pkg/gcpsecretsmanager"
 	"github.com/kislerdm/diagramastext/server/core/pkg/httpclient"
 	"github.com/kislerdm/diagramastext/server/core/pkg/openai"
+	"github.com/kislerdm/diagramastext/server/core/pkg/otel"
 	"github.com/kislerdm/diagramastext/server/core/pkg/postgres"
+	"github.com/kislerdm/diagramastext/server/core/tokenizer"
 )
 
 var (
 	postgresClient *postgres.Client
-	handler        http.Handler
+	// predictionRepository the repository of the requests, it closes the postgres client.
+	predictionRepository diagram.RepositoryPrediction
+	handler              *handlerPkg.Handler
+	// version of the application set at build time, e.g. -ldflags="-X main.version=v1.0.0".
+	version = "dev"
 )
 
 func init() {
@@ -35,21 +48,38 @@ func init() {
 	}
 
 	cfg := config.LoadDefaultConfig(context.Background(), secretsmanagerClient)
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	logLevel, err := logger.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	appLogger := logger.NewJSONLogger(os.Stderr, logLevel)
+
+	// the spans are exported once the OpenTelemetry tracer provider is registered globally
+	tracer := otel.NewTracer(nil)
+
+	modelHTTPClient := diagram.NewTracingHTTPClient(
+		httpclient.NewHTTPClient(
+			httpclient.Config{
+				Timeout: 2 * time.Minute,
+				Backoff: httpclient.Backoff{
+					MaxIterations:             mustParseAttemptsEnv("MODEL_MAX_ATTEMPTS", 2),
+					BackoffTimeMinMillisecond: 50,
+					BackoffTimeMaxMillisecond: 300,
+				},
+			},
+		), tracer, "openai",
+	)
 
 	modelInferenceClient, err := openai.NewOpenAIClient(
 		openai.Config{
-			Token:     cfg.ModelInferenceConfig.Token,
-			MaxTokens: cfg.ModelInferenceConfig.MaxTokens,
-			HTTPClient: httpclient.NewHTTPClient(
-				httpclient.Config{
-					Timeout: 2 * time.Minute,
-					Backoff: httpclient.Backoff{
-						MaxIterations:             2,
-						BackoffTimeMinMillisecond: 50,
-						BackoffTimeMaxMillisecond: 300,
-					},
-				},
-			),
+			Token:      cfg.ModelInferenceConfig.Token,
+			MaxTokens:  cfg.ModelInferenceConfig.MaxTokens,
+			Examples:   modelExamples(),
+			HTTPClient: modelHTTPClient,
 		},
 	)
 	if err != nil {
@@ -68,6 +98,7 @@ func init() {
 			TableUsers:         cfg.RepositoryPredictionConfig.TableUsers,
 			TableTokens:        cfg.RepositoryPredictionConfig.TableAPITokens,
 			TableOneTimeSecret: cfg.CIAM.TableOneTimeSecret,
+			TableFeedback:      cfg.RepositoryPredictionConfig.TableFeedback,
 			SSLMode:            cfg.RepositoryPredictionConfig.SSLMode,
 		},
 	)
@@ -75,55 +106,415 @@ func init() {
 		log.Fatal(err)
 	}
 
+	// DB_MIGRATE=true applies the pending migrations of the schema on start, DB_MIGRATE=dry-run logs them only
+	if v := os.Getenv("DB_MIGRATE"); v == "true" || v == "dry-run" {
+		migrations, err := postgresClient.Migrate(context.Background(), v == "dry-run")
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, m := range migrations {
+			appLogger.Info("migration", logger.Fields{"name": m.Name, "dry_run": v == "dry-run"})
+		}
+	}
+
 	var corsHeaders map[string]string
 	if v := os.Getenv("CORS_HEADERS"); v != "" {
 		if err := json.Unmarshal([]byte(v), &corsHeaders); err != nil {
 			log.Fatal(err)
 		}
 	}
+	// CORS_MAX_AGE defines the preflight responses' caching duration in seconds
+	corsConfig := handlerPkg.CORSConfig{
+		MaxAge:           time.Duration(mustParseIntEnv("CORS_MAX_AGE")) * time.Second,
+		AllowCredentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+	}
+	if err := handlerPkg.ValidateCORS(corsHeaders, corsConfig); err != nil {
+		log.Fatal(err)
+	}
 
 	ciamSMTPClient := ciam.NewSMTPClient(
 		cfg.CIAM.SmtpUser, cfg.CIAM.SmtpPassword, cfg.CIAM.SmtpHost, cfg.CIAM.SmtpPort, cfg.CIAM.SmtpSenderEmail,
+		ciam.WithSMTPTLSMode(cfg.CIAM.SmtpTLSMode),
 	)
+	if cfg.CIAM.SesRegion != "" {
+		ciamSMTPClient, err = ciam.NewSESEmailClient(context.Background(), cfg.CIAM.SesRegion, cfg.CIAM.SmtpSenderEmail)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	ciamHandler, err := ciam.HTTPHandler(postgresClient, ciamSMTPClient, cfg.CIAM.PrivateKey)
+	ciamOps := []ciam.HTTPHandlerOps{
+		ciam.WithAuditSink(ciam.NewJSONAuditSink(os.Stdout)),
+		ciam.WithAuthRateLimit(10, 5, cfg.TrustedProxies...),
+		ciam.WithAuthRateLimitMaxClients(mustParseIntEnv("AUTH_RATE_LIMIT_MAX_CLIENTS")),
+		ciam.WithTenants(cfg.Tenants...),
+		ciam.WithTenantProxies(cfg.TrustedProxies...),
+		ciam.WithRoleQuotas(cfg.Quotas),
+	}
+	var ciamHandler ciam.HTTPHandlerFn
+	if cfg.CIAM.KMSKeyID != "" {
+		var signingClient ciam.TokenSigningClient
+		signingClient, err = ciam.NewKMSSigningClient(context.Background(), cfg.CIAM.KMSRegion, cfg.CIAM.KMSKeyID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ciamHandler, err = ciam.HTTPHandlerWithSigningClient(postgresClient, ciamSMTPClient, signingClient, ciamOps...)
+	} else {
+		ciamHandler, err = ciam.HTTPHandler(postgresClient, ciamSMTPClient, cfg.CIAM.PrivateKey, ciamOps...)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	c4DiagramHandler, err := c4container.NewC4ContainersHTTPHandler(
-		modelInferenceClient, postgresClient, httpclient.NewHTTPClient(
+	var maxNodeDegree int
+	if v := os.Getenv("DIAGRAM_MAX_NODE_DEGREE"); v != "" {
+		if maxNodeDegree, err = strconv.Atoi(v); err != nil {
+			log.Fatal("DIAGRAM_MAX_NODE_DEGREE must be integer, got: " + v)
+		}
+	}
+
+	var maxSVGSize int
+	if v := os.Getenv("DIAGRAM_MAX_SVG_SIZE"); v != "" {
+		if maxSVGSize, err = strconv.Atoi(v); err != nil {
+			log.Fatal("DIAGRAM_MAX_SVG_SIZE must be integer, got: " + v)
+		}
+	}
+
+	plantUMLClient := diagram.NewTracingHTTPClient(
+		httpclient.NewHTTPClient(
 			httpclient.Config{
 				Timeout: 1 * time.Minute,
 				Backoff: httpclient.Backoff{
-					MaxIterations:             2,
+					MaxIterations:             mustParseAttemptsEnv("PLANTUML_MAX_ATTEMPTS", 2),
 					BackoffTimeMinMillisecond: 10,
 					BackoffTimeMaxMillisecond: 50,
 				},
 			},
+		), tracer, "plantuml",
+	)
+
+	// the storage errors which did not fail the request are reported to the http handler's error sink
+	errorReporter := handlerPkg.NewStderrErrorReporter()
+	storageOps := []c4container.HandlerOps{
+		c4container.WithStorageErrorReporter(
+			func(ctx context.Context, requestID, userID string, err error) {
+				errorReporter.Report(
+					ctx, handlerPkg.ErrorReport{
+						Err: err, Type: handlerPkg.ErrorTypeInternal, RequestID: requestID, UserID: userID,
+					},
+				)
+			},
+		),
+	}
+	if os.Getenv("STORAGE_STRICT") == "true" {
+		storageOps = append(storageOps, c4container.WithStrictStorage())
+	}
+
+	predictionRepository = diagram.NewTracingRepositoryPrediction(postgresClient, tracer)
+	// the requests are written with the multi-row statements, the errors of the periodic flushes are reported
+	if os.Getenv("STORAGE_BATCH") == "true" {
+		predictionRepository = diagram.NewTracingRepositoryPrediction(
+			postgres.NewBatchWriter(
+				postgresClient, postgres.BatchConfig{
+					MaxRows: mustParseIntEnv("STORAGE_BATCH_MAX_ROWS"),
+					OnError: func(ctx context.Context, err error) {
+						errorReporter.Report(ctx, handlerPkg.ErrorReport{Err: err, Type: handlerPkg.ErrorTypeInternal})
+					},
+				},
+			), tracer,
+		)
+	}
+	// the requests are written by the background workers, the errors of the writes are reported
+	if os.Getenv("STORAGE_ASYNC") == "true" {
+		predictionRepository = diagram.NewAsyncRepositoryPrediction(
+			predictionRepository,
+			diagram.WithQueueSize(mustParseIntEnv("STORAGE_QUEUE_SIZE")),
+			diagram.WithWorkers(mustParseIntEnv("STORAGE_WORKERS")),
+			diagram.WithQueueFullPolicy(diagram.QueueFullPolicy(os.Getenv("STORAGE_QUEUE_FULL_POLICY"))),
+			diagram.WithAsyncErrorHandler(
+				func(ctx context.Context, err error) {
+					errorReporter.Report(ctx, handlerPkg.ErrorReport{Err: err, Type: handlerPkg.ErrorTypeInternal})
+				},
+			),
+		)
+	}
+
+	// renderingOps the options shared by the handlers rendering the diagrams
+	renderingOps := []c4container.HandlerOps{
+		c4container.WithVersion(version),
+		c4container.WithLogger(appLogger),
+		c4container.WithDefaultFooter(os.Getenv("DIAGRAM_DEFAULT_FOOTER")),
+		c4container.WithDefaultTechnology(os.Getenv("DIAGRAM_DEFAULT_TECHNOLOGY")),
+		c4container.WithPlantUMLBaseURL(cfg.PlantUML.BaseURLs...),
+		c4container.WithCircuitBreaker(c4container.NewCircuitBreaker(5, 30*time.Second)),
+		c4container.WithMaxNodeDegree(maxNodeDegree),
+		c4container.WithMaxSVGSize(maxSVGSize),
+		c4container.WithCyclesDetection(),
+		c4container.WithOrphanNodesDetection(),
+		c4container.WithSelfLinksDetection(),
+		c4container.WithSVGMinification(),
+		c4container.WithRelationTechnologyInference(
+			map[string]string{"PostgreSQL": "TCP", "MySQL": "TCP", "Redis": "RESP", "Kafka": "TCP"},
 		),
+		c4container.WithFeatureFlags(diagram.NewFeatureFlags(cfg.FeatureFlags)),
+	}
+
+	if v := os.Getenv("TOKENIZER_ENCODING_FILE"); v != "" {
+		if err := loadTokenizerEncoding(v); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// the encodings are loaded before the first request, otherwise the tokens are approximated
+	var modelTokenizer diagram.Tokenizer = tokenizer.Tokenizer{}
+	if err := tokenizer.Warmup(context.Background()); err != nil {
+		appLogger.Warn("tokenizer is not available, the tokens are approximated", logger.Fields{"error": err})
+		modelTokenizer = diagram.NewApproximateTokenizer()
+	}
+
+	c4DiagramOps := append(
+		renderingOps,
+		c4container.WithContextWindow(modelTokenizer),
+		c4container.WithPromptPreprocessor(diagram.NewRegexpRedactor()),
+		c4container.WithModerator(diagram.NewBlocklist(strings.Split(os.Getenv("DIAGRAM_BLOCKLIST"), ",")...)),
+		c4container.WithModerator(modelInferenceClient),
+	)
+	if cfg.Experiment != nil {
+		c4DiagramOps = append(c4DiagramOps, c4container.WithExperiment(diagram.NewExperiment(*cfg.Experiment)))
+	}
+	switch os.Getenv("DIAGRAM_AUTO_TITLE") {
+	case "prompt":
+		c4DiagramOps = append(c4DiagramOps, c4container.WithAutoTitle(c4container.NewPromptTitler(0)))
+	case "model":
+		// the diagrams' examples are not sent along with the title's prompt
+		titlerClient, err := openai.NewOpenAIClient(
+			openai.Config{
+				Token:      cfg.ModelInferenceConfig.Token,
+				MaxTokens:  cfg.ModelInferenceConfig.MaxTokens,
+				HTTPClient: modelHTTPClient,
+			},
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		titler, err := c4container.NewModelTitler(
+			diagram.NewTracingModelInference(titlerClient, tracer), "gpt-3.5-turbo", 0,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c4DiagramOps = append(c4DiagramOps, c4container.WithAutoTitle(titler))
+	}
+	c4DiagramHandler, err := c4container.NewC4ContainersHTTPHandler(
+		diagram.NewTracingModelInference(modelInferenceClient, tracer),
+		predictionRepository,
+		plantUMLClient,
+		append(c4DiagramOps, storageOps...)...,
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	handler = handlerPkg.NewHandler(
+	handlerOps := []handlerPkg.HandlerOps{
+		handlerPkg.WithErrorReporter(errorReporter),
+		handlerPkg.WithTracer(tracer),
+		handlerPkg.WithLogger(appLogger),
+		handlerPkg.WithWatermark(os.Getenv("DIAGRAM_WATERMARK"), ciam.RoleAnonymUser),
+		handlerPkg.WithComplexityLimits(
+			diagram.ComplexityLimits{NodesMax: 20, LinksMax: 30, DiagramsMax: 2}, ciam.RoleAnonymUser,
+		),
+		handlerPkg.WithComplexityLimits(
+			diagram.ComplexityLimits{NodesMax: 50, LinksMax: 100, DiagramsMax: 5}, ciam.RoleRegisteredUser,
+		),
+		handlerPkg.WithRegenerationsLimit(
+			mustParseIntEnv("REGENERATIONS_MAX_ENTRIES"), mustParseIntEnv("REGENERATIONS_MAX_BYTES"),
+		),
+		handlerPkg.WithCORS(corsConfig),
+		handlerPkg.WithReadinessCheck("storage", postgresClient.Ping),
+	}
+	// the self-hosted PlantUML servers are probed, the public server is not
+	for _, baseURL := range cfg.PlantUML.BaseURLs {
+		handlerOps = append(
+			handlerOps, handlerPkg.WithReadinessCheck(
+				"plantuml", handlerPkg.NewHTTPReadinessCheck(&http.Client{Timeout: 2 * time.Second}, baseURL),
+			),
+		)
+	}
+	if os.Getenv("MAINTENANCE") == "true" {
+		handlerOps = append(handlerOps, handlerPkg.WithMaintenance())
+	}
+
+	// DIAGRAM_DEDUPLICATION=true shares the result of the in-flight request with its duplicates, e.g. double-clicks
+	if os.Getenv("DIAGRAM_DEDUPLICATION") == "true" {
+		c4DiagramHandler = diagram.NewDeduplicatedHTTPHandler(c4DiagramHandler)
+	}
+
+	h := handlerPkg.NewHandler(
 		ciamHandler, corsHeaders,
 		map[string]diagram.HTTPHandler{
 			"/c4": c4DiagramHandler,
 		},
+		handlerOps...,
 	)
+
+	var modelPrices map[string]diagram.Price
+	if v := os.Getenv("MODEL_PRICES"); v != "" {
+		if modelPrices, err = diagram.ParsePrices([]byte(v)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// the estimate uses the model of the user's experiment's variant
+	c4EstimateOps := []c4container.HandlerOps{c4container.WithPrices(modelPrices)}
+	if cfg.Experiment != nil {
+		c4EstimateOps = append(c4EstimateOps, c4container.WithExperiment(diagram.NewExperiment(*cfg.Experiment)))
+	}
+	c4EstimateHandler, err := c4container.NewC4ContainersEstimateHandler(modelTokenizer, c4EstimateOps...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := h.RegisterEstimateHandler("/c4", c4EstimateHandler); err != nil {
+		log.Fatal(err)
+	}
+
+	c4PatchHandler, err := c4container.NewC4ContainersPatchHandler(plantUMLClient, postgresClient, renderingOps...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := h.RegisterPatchHandler("/c4", c4PatchHandler); err != nil {
+		log.Fatal(err)
+	}
+
+	feedbackHandler, err := diagram.NewFeedbackHandler(postgresClient)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := h.RegisterFeedbackHandler("/c4", feedbackHandler); err != nil {
+		log.Fatal(err)
+	}
+
+	c4Schema, err := c4container.GraphJSONSchema()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := h.RegisterSchema("/c4", c4Schema); err != nil {
+		log.Fatal(err)
+	}
+
+	handler = h
 }
 
 func main() {
-	defer func() { _ = postgresClient.Close(context.Background()) }()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := c4container.Warmup(context.Background()); err != nil {
+		log.Println(err)
+	}
+	// the readiness probe passes once the startup is completed
+	handler.SetReady(true)
+
+	go cleanupExpiredSecrets(ctx, 10*time.Minute)
+	go toggleMaintenanceOnSignal(handler, syscall.SIGUSR1)
+
+	// the in-memory stores' statistics, e.g. the evictions, are served on the dedicated port
+	// to keep them private
+	if v := os.Getenv("METRICS_PORT"); v != "" {
+		go func() {
+			if err := http.ListenAndServe(":"+v, expvar.Handler()); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
 
 	portServe := "9000"
 	if v := os.Getenv("PORT"); v != "" {
 		portServe = v
 	}
 
-	if err := http.ListenAndServe(":"+portServe, handler); err != nil {
+	mux := http.NewServeMux()
+	handlerPkg.Mount(mux, os.Getenv("PATH_PREFIX"), handler)
+
+	// the in-flight requests are completed, and the queued writes are flushed before the exit
+	if err := handlerPkg.ListenAndServe(ctx, ":"+portServe, mux, 30*time.Second); err != nil {
+		log.Println(err)
+	}
+
+	ctxShutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := predictionRepository.Close(ctxShutdown); err != nil {
 		log.Println(err)
 	}
 }
+
+// mustParseIntEnv parses the environment variable as integer, the unset variable is parsed as zero.
+func mustParseIntEnv(key string) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return 0
+	}
+	o, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatal(key + " must be integer, got: " + v)
+	}
+	return o
+}
+
+// mustParseAttemptsEnv parses the environment variable as the maximum number of the http request's attempts,
+// the unset variable defaults to defaultValue.
+func mustParseAttemptsEnv(key string, defaultValue uint8) uint8 {
+	v := mustParseIntEnv(key)
+	if v == 0 {
+		return defaultValue
+	}
+	if v < 0 || v > math.MaxUint8 {
+		log.Fatal(key + " must be between 1 and " + strconv.Itoa(math.MaxUint8) + ", got: " + strconv.Itoa(v))
+	}
+	return uint8(v)
+}
+
+// cleanupExpiredSecrets periodically deletes the one-time secrets which have never been confirmed.
+func cleanupExpiredSecrets(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := postgresClient.DeleteExpiredSecrets(ctx); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// toggleMaintenanceOnSignal toggles the maintenance mode when the process receives the signal,
+// e.g. kill -USR1 <pid>, to disable the diagrams generation during incidents without restart.
+func toggleMaintenanceOnSignal(h *handlerPkg.Handler, sig os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig)
+	for range ch {
+		h.SetMaintenance(!h.IsMaintenance())
+		log.Printf("maintenance mode: %v", h.IsMaintenance())
+	}
+}
+
+// modelExamples defines the few-shot examples prepended to the model conversation.
+func modelExamples() []openai.Example {
+	examples := c4container.DefaultExamples()
+	o := make([]openai.Example, len(examples))
+	for i, e := range examples {
+		o[i] = openai.Example{Prompt: e.Prompt, Completion: e.Graph}
+	}
+	return o
+}
+
+// loadTokenizerEncoding loads the ranks of the encoding cl100k_base from the file, e.g. shipped with the image,
+// instead of fetching them upon the first use.
+func loadTokenizerEncoding(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	return tokenizer.LoadEncoding(tokenizer.EncodingCL100K, f)
+}
@@ -3,6 +3,10 @@ package config
 import (
 	"context"
 	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
 	"os"
 	"strings"
 
@@ -20,6 +24,7 @@ const (
 	tableLookupUser           = "users"
 	tableLookupApiTokens      = "api_tokens"
 	tableOneTimeSecret        = "user_auth_secrets"
+	tableFeedback             = "user_feedback"
 
 	defaultSenderEmail = "support@diagramastext.dev"
 	defaultSMPTPort    = "587"
@@ -35,6 +40,7 @@ type repositoryPredictionConfig struct {
 	TableSuccessStatus string `json:"table_success_status"`
 	TableUsers         string `json:"table_users"`
 	TableAPITokens     string `json:"table_api_tokens"`
+	TableFeedback      string `json:"table_feedback"`
 	SSLMode            string `json:"ssl_mode"`
 }
 
@@ -67,14 +73,120 @@ type ciamCfg struct {
 	SmtpHost           string
 	SmtpPort           string
 	SmtpSenderEmail    string
+	SmtpTLSMode        ciam.SMTPTLSMode
+	SesRegion          string
+	KMSKeyID           string
+	KMSRegion          string
+}
+
+type plantUMLConfig struct {
+	// BaseURLs the base URLs of the PlantUML servers to balance the load across,
+	// the public server is used if not set.
+	BaseURLs []string
+}
+
+// fileConfig defines the schema of the JSON configuration file.
+type fileConfig struct {
+	secret
+	ModelMaxTokens  int    `json:"model_max_tokens"`
+	SmtpTLSMode     string `json:"smtp_tls_mode"`
+	SesRegion       string `json:"ses_region"`
+	KMSKeyID        string `json:"kms_key_id"`
+	KMSRegion       string `json:"kms_region"`
+	PlantUMLBaseURL string `json:"plantuml_base_url"`
+	// FeatureFlags the features' state, see diagram.FeatureFlagsConfig.
+	FeatureFlags diagram.FeatureFlagsConfig `json:"feature_flags"`
+	// Experiment the experiment comparing the models and the system prompts, see diagram.ExperimentConfig.
+	Experiment *diagram.ExperimentConfig `json:"experiment"`
+	// TrustedProxies the CIDRs of the proxies trusted to set the headers X-Forwarded-For, and ciam.HeaderTenant.
+	TrustedProxies []string `json:"trusted_proxies"`
+	// Tenants the tenants' configurations, see ciam.Tenant.
+	Tenants []ciam.Tenant `json:"tenants"`
+	// Quotas the quotas per role, see ciam.RoleQuotas.
+	Quotas ciam.RoleQuotas `json:"quotas"`
 }
 
 type Config struct {
 	RepositoryPredictionConfig repositoryPredictionConfig
 	CIAM                       ciamCfg
 	ModelInferenceConfig       modelInferenceConfig
+	PlantUML                   plantUMLConfig
+	FeatureFlags               diagram.FeatureFlagsConfig
+	// Experiment the experiment comparing the models and the system prompts, nil if no experiment runs.
+	Experiment *diagram.ExperimentConfig
+	// TrustedProxies the networks of the proxies trusted to set the client IP in the header X-Forwarded-For,
+	// and the tenant in the header ciam.HeaderTenant.
+	TrustedProxies []*net.IPNet
+	// Tenants the tenants resolved from the header ciam.HeaderTenant set by the trusted proxies,
+	// the default tenant serves other requests.
+	Tenants []ciam.Tenant
+	// Quotas the quotas per role, nil if the default quotas apply, see ciam.Role.Quotas.
+	Quotas ciam.RoleQuotas
+}
+
+// Validate validates the configuration, the error lists all invalid settings.
+func (cfg Config) Validate() error {
+	var errs []string
+
+	if cfg.ModelInferenceConfig.Token == "" {
+		errs = append(errs, "model API key must be set")
+	}
+	if cfg.ModelInferenceConfig.MaxTokens < 0 {
+		errs = append(errs, "model max tokens must be non-negative")
+	}
+
+	if cfg.RepositoryPredictionConfig.DBHost == "" {
+		errs = append(errs, "DB host must be set")
+	}
+	if cfg.RepositoryPredictionConfig.DBName == "" {
+		errs = append(errs, "DB name must be set")
+	}
+	if cfg.RepositoryPredictionConfig.DBUser == "" {
+		errs = append(errs, "DB user must be set")
+	}
+
+	if cfg.CIAM.PrivateKey == nil && cfg.CIAM.KMSKeyID == "" {
+		errs = append(errs, "CIAM private key or KMS key ID must be set")
+	}
+	if cfg.CIAM.SmtpHost == "" && cfg.CIAM.SesRegion == "" {
+		errs = append(errs, "CIAM SMTP host or SES region must be set")
+	}
+	if !cfg.CIAM.SmtpTLSMode.IsValid() {
+		errs = append(errs, "unknown SMTP TLS mode: "+string(cfg.CIAM.SmtpTLSMode))
+	}
+
+	for _, baseURL := range cfg.PlantUML.BaseURLs {
+		if u, err := url.Parse(baseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, "PlantUML base URL must be absolute URL")
+			break
+		}
+	}
+
+	if cfg.Quotas != nil {
+		if err := cfg.Quotas.Validate(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	tenants := map[string]struct{}{}
+	for _, tenant := range cfg.Tenants {
+		if err := tenant.Validate(); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if _, ok := tenants[tenant.ID]; ok {
+			errs = append(errs, "duplicate tenant: "+tenant.ID)
+		}
+		tenants[tenant.ID] = struct{}{}
+	}
+
+	if len(errs) > 0 {
+		return errors.New("invalid config: " + strings.Join(errs, "; "))
+	}
+	return nil
 }
 
+// LoadDefaultConfig loads the configuration in the order of precedence:
+// the secrets vault, env variables, the JSON file defined by the env variable CONFIG_FILE, defaults.
 func LoadDefaultConfig(ctx context.Context, clientSecretsManager diagram.RepositorySecretsVault) *Config {
 	// defaults
 	cfg := Config{
@@ -84,6 +196,7 @@ func LoadDefaultConfig(ctx context.Context, clientSecretsManager diagram.Reposit
 			TableSuccessStatus: tableWriteSuccessStatus,
 			TableUsers:         tableLookupUser,
 			TableAPITokens:     tableLookupApiTokens,
+			TableFeedback:      tableFeedback,
 			SSLMode:            defaultSSLMode,
 		},
 		CIAM: ciamCfg{
@@ -93,6 +206,12 @@ func LoadDefaultConfig(ctx context.Context, clientSecretsManager diagram.Reposit
 		},
 	}
 
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFromFile(&cfg, path); err != nil {
+			panic("cannot read config file: " + err.Error())
+		}
+	}
+
 	loadEnvVarConfig(&cfg)
 
 	if secretARN := os.Getenv("ACCESS_CREDENTIALS_URI"); secretARN != "" && clientSecretsManager != nil {
@@ -135,13 +254,115 @@ func loadFromSecretsManager(
 	}
 }
 
+// loadFromFile reads the configuration from the JSON file, the values which are not set in the file are ignored.
+func loadFromFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var f fileConfig
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+
+	setIfNotEmpty(&cfg.ModelInferenceConfig.Token, f.APIKey)
+	if f.ModelMaxTokens != 0 {
+		cfg.ModelInferenceConfig.MaxTokens = f.ModelMaxTokens
+	}
+
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.DBHost, f.DBHost)
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.DBName, f.DBName)
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.DBUser, f.DBUser)
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.DBPassword, f.DBPassword)
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.TablePrompt, f.TablePrompt)
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.TablePrediction, f.TablePrediction)
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.TableSuccessStatus, f.TableSuccessStatus)
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.TableUsers, f.TableUsers)
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.TableAPITokens, f.TableAPITokens)
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.TableFeedback, f.TableFeedback)
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.SSLMode, f.SSLMode)
+
+	if f.PrivateKey != "" {
+		if cfg.CIAM.PrivateKey, err = ciam.ReadPrivateKey(f.PrivateKey); err != nil {
+			return err
+		}
+	}
+	setIfNotEmpty(&cfg.CIAM.TableOneTimeSecret, f.TableOneTimeSecret)
+	setIfNotEmpty(&cfg.CIAM.SmtpUser, f.SmtpUser)
+	setIfNotEmpty(&cfg.CIAM.SmtpPassword, f.SmtpPassword)
+	setIfNotEmpty(&cfg.CIAM.SmtpHost, f.SmtpHost)
+	setIfNotEmpty(&cfg.CIAM.SmtpPort, f.SmtpPort)
+	setIfNotEmpty(&cfg.CIAM.SmtpSenderEmail, f.SmtpSenderEmail)
+	if f.SmtpTLSMode != "" {
+		cfg.CIAM.SmtpTLSMode = ciam.SMTPTLSMode(strings.ToLower(f.SmtpTLSMode))
+	}
+	setIfNotEmpty(&cfg.CIAM.SesRegion, f.SesRegion)
+	setIfNotEmpty(&cfg.CIAM.KMSKeyID, f.KMSKeyID)
+	setIfNotEmpty(&cfg.CIAM.KMSRegion, f.KMSRegion)
+
+	if f.PlantUMLBaseURL != "" {
+		cfg.PlantUML.BaseURLs = splitList(f.PlantUMLBaseURL)
+	}
+
+	if f.FeatureFlags.Defaults != nil || f.FeatureFlags.Users != nil {
+		cfg.FeatureFlags = f.FeatureFlags
+	}
+
+	if f.Experiment != nil {
+		if err := f.Experiment.Validate(); err != nil {
+			return err
+		}
+		cfg.Experiment = f.Experiment
+	}
+
+	if len(f.TrustedProxies) > 0 {
+		if cfg.TrustedProxies, err = utils.ParseTrustedProxies(f.TrustedProxies...); err != nil {
+			return err
+		}
+	}
+
+	if len(f.Tenants) > 0 {
+		cfg.Tenants = f.Tenants
+	}
+
+	if f.Quotas != nil {
+		cfg.Quotas = f.Quotas
+	}
+
+	return nil
+}
+
+func setIfNotEmpty(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+// splitList splits the comma-separated list skipping the empty elements.
+func splitList(v string) []string {
+	var o []string
+	for _, el := range strings.Split(v, ",") {
+		if el = strings.TrimSpace(el); el != "" {
+			o = append(o, el)
+		}
+	}
+	return o
+}
+
 func loadEnvVarConfig(cfg *Config) {
-	cfg.ModelInferenceConfig.MaxTokens = utils.MustParseInt(os.Getenv("MODEL_MAX_TOKENS"))
-	cfg.ModelInferenceConfig.Token = os.Getenv("MODEL_API_KEY")
-	cfg.RepositoryPredictionConfig.DBHost = os.Getenv("DB_HOST")
-	cfg.RepositoryPredictionConfig.DBName = os.Getenv("DB_DBNAME")
-	cfg.RepositoryPredictionConfig.DBUser = os.Getenv("DB_USER")
-	cfg.RepositoryPredictionConfig.DBPassword = os.Getenv("DB_PASSWORD")
+	if v := os.Getenv("MODEL_MAX_TOKENS"); v != "" {
+		maxTokens, err := utils.ParseInt(v)
+		if err != nil || maxTokens < 0 {
+			panic("MODEL_MAX_TOKENS must be non-negative integer, got: " + v)
+		}
+		cfg.ModelInferenceConfig.MaxTokens = maxTokens
+	}
+	setIfNotEmpty(&cfg.ModelInferenceConfig.Token, os.Getenv("MODEL_API_KEY"))
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.DBHost, os.Getenv("DB_HOST"))
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.DBName, os.Getenv("DB_DBNAME"))
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.DBUser, os.Getenv("DB_USER"))
+	setIfNotEmpty(&cfg.RepositoryPredictionConfig.DBPassword, os.Getenv("DB_PASSWORD"))
 
 	if v := os.Getenv("SSL_MODE"); v != "" {
 		cfg.RepositoryPredictionConfig.SSLMode = v
@@ -167,6 +388,10 @@ func loadEnvVarConfig(cfg *Config) {
 		cfg.RepositoryPredictionConfig.TableAPITokens = v
 	}
 
+	if v := os.Getenv("TABLE_FEEDBACK"); v != "" {
+		cfg.RepositoryPredictionConfig.TableFeedback = v
+	}
+
 	if v := os.Getenv("TABLE_ONE_TIME_SECRET"); v != "" {
 		cfg.CIAM.TableOneTimeSecret = v
 	}
@@ -194,4 +419,59 @@ func loadEnvVarConfig(cfg *Config) {
 	if v := os.Getenv("CIAM_SMTP_SENDER_EMAIL"); v != "" {
 		cfg.CIAM.SmtpSenderEmail = v
 	}
+
+	if v := os.Getenv("CIAM_SMTP_TLS_MODE"); v != "" {
+		cfg.CIAM.SmtpTLSMode = ciam.SMTPTLSMode(strings.ToLower(v))
+		if !cfg.CIAM.SmtpTLSMode.IsValid() {
+			panic("unknown SMTP TLS mode: " + v)
+		}
+	}
+
+	if v := os.Getenv("CIAM_SES_REGION"); v != "" {
+		cfg.CIAM.SesRegion = v
+	}
+
+	if v := os.Getenv("CIAM_KMS_KEY_ID"); v != "" {
+		cfg.CIAM.KMSKeyID = v
+	}
+
+	if v := os.Getenv("CIAM_KMS_REGION"); v != "" {
+		cfg.CIAM.KMSRegion = v
+	}
+
+	if v := os.Getenv("PLANTUML_BASE_URL"); v != "" {
+		cfg.PlantUML.BaseURLs = splitList(v)
+	}
+
+	if v := os.Getenv("FEATURE_FLAGS"); v != "" {
+		featureFlags, err := diagram.ParseFeatureFlagsConfig([]byte(v))
+		if err != nil {
+			panic("FEATURE_FLAGS must be JSON-encoded feature flags config, got: " + v)
+		}
+		cfg.FeatureFlags = featureFlags
+	}
+
+	if v := os.Getenv("EXPERIMENT"); v != "" {
+		experiment, err := diagram.ParseExperimentConfig([]byte(v))
+		if err != nil {
+			panic("EXPERIMENT must be JSON-encoded valid experiment config, got: " + v)
+		}
+		cfg.Experiment = &experiment
+	}
+
+	if v := os.Getenv("QUOTAS"); v != "" {
+		var quotas ciam.RoleQuotas
+		if err := json.Unmarshal([]byte(v), &quotas); err != nil {
+			panic("QUOTAS must be JSON-encoded quotas per role, got: " + v)
+		}
+		cfg.Quotas = quotas
+	}
+
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		trustedProxies, err := utils.ParseTrustedProxies(strings.Split(v, ",")...)
+		if err != nil {
+			panic("TRUSTED_PROXIES must be comma-separated list of CIDRs, got: " + v)
+		}
+		cfg.TrustedProxies = trustedProxies
+	}
 }
@@ -4,7 +4,10 @@ import (
 	"context"
 	"crypto/ed25519"
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/kislerdm/diagramastext/server/core/ciam"
@@ -73,6 +76,7 @@ func Test_loadDefaultConfig(t *testing.T) {
 					TableSuccessStatus: tableWriteSuccessStatus,
 					TableUsers:         tableLookupUser,
 					TableAPITokens:     tableLookupApiTokens,
+					TableFeedback:      tableFeedback,
 					SSLMode:            defaultSSLMode,
 				},
 				ModelInferenceConfig: modelInferenceConfig{
@@ -146,6 +150,7 @@ func Test_loadDefaultConfig(t *testing.T) {
 					TableSuccessStatus: "qux",
 					TableUsers:         "u",
 					TableAPITokens:     "t",
+					TableFeedback:      tableFeedback,
 					SSLMode:            "disable",
 				},
 				CIAM: ciamCfg{
@@ -180,11 +185,16 @@ func Test_loadDefaultConfig(t *testing.T) {
 				"TABLE_USERS":            "u",
 				"TABLE_ONE_TIME_SECRET":  "s",
 				"TABLE_API_TOKENS":       "t",
+				"TABLE_FEEDBACK":         "f",
 				"CIAM_SMTP_USER":         "r",
 				"CIAM_SMTP_PASSWORD":     "t",
 				"CIAM_SMTP_HOST":         "yy",
 				"CIAM_SMTP_PORT":         "44",
 				"CIAM_SMTP_SENDER_EMAIL": "dfdf",
+				"CIAM_SMTP_TLS_MODE":     "STARTTLS",
+				"CIAM_SES_REGION":        "us-east-2",
+				"CIAM_KMS_KEY_ID":        "alias/ciam",
+				"CIAM_KMS_REGION":        "us-east-2",
 				"CIAM_KEY":               "projects/my-project/locations/us-east1/keyRings/my-key-ring/cryptoKeys/my-key",
 			},
 			want: &Config{
@@ -198,6 +208,7 @@ func Test_loadDefaultConfig(t *testing.T) {
 					TableSuccessStatus: "qux",
 					TableUsers:         "u",
 					TableAPITokens:     "t",
+					TableFeedback:      "f",
 					SSLMode:            defaultSSLMode,
 				},
 				ModelInferenceConfig: modelInferenceConfig{
@@ -211,6 +222,10 @@ func Test_loadDefaultConfig(t *testing.T) {
 					SmtpHost:           "yy",
 					SmtpPort:           "44",
 					SmtpSenderEmail:    "dfdf",
+					SmtpTLSMode:        ciam.SMTPTLSModeStartTLS,
+					SesRegion:          "us-east-2",
+					KMSKeyID:           "alias/ciam",
+					KMSRegion:          "us-east-2",
 				},
 			},
 		},
@@ -260,6 +275,53 @@ func Test_loadDefaultConfig(t *testing.T) {
 			}
 		},
 	)
+	t.Run(
+		"shall panic if unknown SMTP TLS mode is set", func(t *testing.T) {
+			// GIVEN
+			t.Setenv("CIAM_SMTP_TLS_MODE", "foo")
+
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("panic is expected for unknown SMTP TLS mode")
+				}
+			}()
+
+			// WHEN
+			_ = LoadDefaultConfig(context.TODO(), nil)
+		},
+	)
+
+	for _, v := range []string{"foo", "1.5", "-1"} {
+		t.Run(
+			"shall panic if MODEL_MAX_TOKENS is "+v, func(t *testing.T) {
+				// GIVEN
+				t.Setenv("MODEL_MAX_TOKENS", v)
+
+				defer func() {
+					if r := recover(); r == nil {
+						t.Error("panic is expected for malformed MODEL_MAX_TOKENS")
+					}
+				}()
+
+				// WHEN
+				_ = LoadDefaultConfig(context.TODO(), nil)
+			},
+		)
+	}
+	t.Run(
+		"shall default MODEL_MAX_TOKENS if not set", func(t *testing.T) {
+			// GIVEN
+			t.Setenv("MODEL_MAX_TOKENS", "")
+
+			// WHEN
+			got := LoadDefaultConfig(context.TODO(), nil)
+
+			// THEN
+			if got.ModelInferenceConfig.MaxTokens != 0 {
+				t.Errorf("unexpected MaxTokens: %d, the model's default shall be used", got.ModelInferenceConfig.MaxTokens)
+			}
+		},
+	)
 }
 
 func mustMarshalKey(key ed25519.PrivateKey) string {
@@ -269,3 +331,352 @@ func mustMarshalKey(key ed25519.PrivateKey) string {
 	}
 	return string(o)
 }
+
+func Test_loadDefaultConfigFromFile(t *testing.T) {
+	writeFile := func(t *testing.T, v string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(v), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run(
+		"shall load the config file and override it with env variables", func(t *testing.T) {
+			// GIVEN
+			t.Setenv(
+				"CONFIG_FILE", writeFile(
+					t, `{"model_api_key":"file-key","model_max_tokens":200,"db_host":"file-host","db_name":"file-db",`+
+						`"smtp_tls_mode":"IMPLICIT","kms_key_id":"file-kms","plantuml_base_url":"http://file:8080/"}`,
+				),
+			)
+			t.Setenv("DB_HOST", "env-host")
+			t.Setenv("PLANTUML_BASE_URL", "http://env:8080/, http://env:8081/")
+
+			// WHEN
+			got := LoadDefaultConfig(context.TODO(), nil)
+
+			// THEN
+			if got.ModelInferenceConfig.Token != "file-key" || got.ModelInferenceConfig.MaxTokens != 200 {
+				t.Errorf("unexpected model config: %+v", got.ModelInferenceConfig)
+			}
+			if got.RepositoryPredictionConfig.DBHost != "env-host" {
+				t.Errorf("env variable shall override the file, got DB host: %s", got.RepositoryPredictionConfig.DBHost)
+			}
+			if got.RepositoryPredictionConfig.DBName != "file-db" {
+				t.Errorf("unexpected DB name: %s", got.RepositoryPredictionConfig.DBName)
+			}
+			if got.RepositoryPredictionConfig.TablePrompt != tableWritePrompt {
+				t.Errorf("default shall be kept if not set in the file, got: %s", got.RepositoryPredictionConfig.TablePrompt)
+			}
+			if got.CIAM.SmtpTLSMode != ciam.SMTPTLSModeImplicit || got.CIAM.KMSKeyID != "file-kms" {
+				t.Errorf("unexpected CIAM config: %+v", got.CIAM)
+			}
+			if !reflect.DeepEqual(got.PlantUML.BaseURLs, []string{"http://env:8080/", "http://env:8081/"}) {
+				t.Errorf("env variable shall override the file, got PlantUML URLs: %v", got.PlantUML.BaseURLs)
+			}
+		},
+	)
+
+	t.Run(
+		"shall load the feature flags from the file and override them with env variable", func(t *testing.T) {
+			// GIVEN
+			t.Setenv(
+				"CONFIG_FILE", writeFile(t, `{"feature_flags":{"defaults":{"foo":true},"users":{"bar":{"foo":false}}}}`),
+			)
+
+			// WHEN
+			got := LoadDefaultConfig(context.TODO(), nil)
+
+			// THEN
+			want := diagram.FeatureFlagsConfig{
+				Defaults: map[string]bool{"foo": true},
+				Users:    map[string]map[string]bool{"bar": {"foo": false}},
+			}
+			if !reflect.DeepEqual(got.FeatureFlags, want) {
+				t.Errorf("unexpected feature flags: got = %+v, want = %+v", got.FeatureFlags, want)
+			}
+
+			// WHEN
+			t.Setenv("FEATURE_FLAGS", `{"defaults":{"qux":true}}`)
+			got = LoadDefaultConfig(context.TODO(), nil)
+
+			// THEN
+			want = diagram.FeatureFlagsConfig{Defaults: map[string]bool{"qux": true}}
+			if !reflect.DeepEqual(got.FeatureFlags, want) {
+				t.Errorf("env variable shall override the file: got = %+v, want = %+v", got.FeatureFlags, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall load the experiment from the file and override it with env variable", func(t *testing.T) {
+			// GIVEN
+			t.Setenv(
+				"CONFIG_FILE", writeFile(t, `{"experiment":{"name":"foo","variants":[{"name":"bar","weight":1}]}}`),
+			)
+
+			// WHEN
+			got := LoadDefaultConfig(context.TODO(), nil)
+
+			// THEN
+			want := &diagram.ExperimentConfig{Name: "foo", Variants: []diagram.Variant{{Name: "bar", Weight: 1}}}
+			if !reflect.DeepEqual(got.Experiment, want) {
+				t.Errorf("unexpected experiment: got = %+v, want = %+v", got.Experiment, want)
+			}
+
+			// WHEN
+			t.Setenv("EXPERIMENT", `{"name":"qux","variants":[{"name":"bar","weight":1,"model":"gpt-4"}]}`)
+			got = LoadDefaultConfig(context.TODO(), nil)
+
+			// THEN
+			want = &diagram.ExperimentConfig{
+				Name: "qux", Variants: []diagram.Variant{{Name: "bar", Weight: 1, Model: "gpt-4"}},
+			}
+			if !reflect.DeepEqual(got.Experiment, want) {
+				t.Errorf("env variable shall override the file: got = %+v, want = %+v", got.Experiment, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall panic given invalid experiment env variable", func(t *testing.T) {
+			// GIVEN
+			t.Setenv("EXPERIMENT", `{"name":"foo"}`)
+
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("panic is expected for invalid experiment")
+				}
+			}()
+
+			// WHEN
+			_ = LoadDefaultConfig(context.TODO(), nil)
+		},
+	)
+
+	t.Run(
+		"shall load the trusted proxies from the file and override them with env variable", func(t *testing.T) {
+			// GIVEN
+			t.Setenv("CONFIG_FILE", writeFile(t, `{"trusted_proxies":["10.0.0.0/8","172.16.0.1"]}`))
+
+			// WHEN
+			got := LoadDefaultConfig(context.TODO(), nil)
+
+			// THEN
+			if len(got.TrustedProxies) != 2 || got.TrustedProxies[1].String() != "172.16.0.1/32" {
+				t.Errorf("unexpected trusted proxies: %v", got.TrustedProxies)
+			}
+
+			// WHEN
+			t.Setenv("TRUSTED_PROXIES", "192.168.0.0/16")
+			got = LoadDefaultConfig(context.TODO(), nil)
+
+			// THEN
+			if len(got.TrustedProxies) != 1 || got.TrustedProxies[0].String() != "192.168.0.0/16" {
+				t.Errorf("env variable shall override the file, got: %v", got.TrustedProxies)
+			}
+		},
+	)
+
+	t.Run(
+		"shall load the tenants from the file", func(t *testing.T) {
+			// GIVEN
+			t.Setenv(
+				"CONFIG_FILE", writeFile(
+					t, `{"tenants":[{"id":"acme","default_footer":"by acme","theme":"cerulean",`+
+						`"quotas":{"registered":{"prompt_length_max":500,"rpm":5,"rpd":50}}}]}`,
+				),
+			)
+
+			// WHEN
+			got := LoadDefaultConfig(context.TODO(), nil)
+
+			// THEN
+			want := []ciam.Tenant{
+				{
+					ID: "acme", DefaultFooter: "by acme", Theme: "cerulean",
+					Quotas: ciam.RoleQuotas{
+						ciam.RoleRegisteredUser: {PromptLengthMax: 500, RequestsPerMinute: 5, RequestsPerDay: 50},
+					},
+				},
+			}
+			if !reflect.DeepEqual(got.Tenants, want) {
+				t.Errorf("unexpected tenants: got = %+v, want = %+v", got.Tenants, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall load the quotas from the file, and the env variable shall override the file", func(t *testing.T) {
+			// GIVEN
+			t.Setenv(
+				"CONFIG_FILE", writeFile(
+					t, `{"quotas":{"anonym":{"prompt_length_max":100,"rpm":2,"rpd":20},`+
+						`"registered":{"prompt_length_max":500,"rpm":5,"rpd":50}}}`,
+				),
+			)
+
+			// WHEN
+			got := LoadDefaultConfig(context.TODO(), nil)
+
+			// THEN
+			want := ciam.RoleQuotas{
+				ciam.RoleAnonymUser:     {PromptLengthMax: 100, RequestsPerMinute: 2, RequestsPerDay: 20},
+				ciam.RoleRegisteredUser: {PromptLengthMax: 500, RequestsPerMinute: 5, RequestsPerDay: 50},
+			}
+			if !reflect.DeepEqual(got.Quotas, want) {
+				t.Errorf("unexpected quotas: got = %+v, want = %+v", got.Quotas, want)
+			}
+
+			// WHEN
+			t.Setenv("QUOTAS", `{"anonym":{"prompt_length_max":10,"rpm":1,"rpd":1}}`)
+			got = LoadDefaultConfig(context.TODO(), nil)
+
+			// THEN
+			want = ciam.RoleQuotas{ciam.RoleAnonymUser: {PromptLengthMax: 10, RequestsPerMinute: 1, RequestsPerDay: 1}}
+			if !reflect.DeepEqual(got.Quotas, want) {
+				t.Errorf("env variable shall override the file, got: %+v", got.Quotas)
+			}
+		},
+	)
+
+	t.Run(
+		"shall panic given faulty quotas env variable", func(t *testing.T) {
+			// GIVEN
+			t.Setenv("QUOTAS", `{"foo":{"rpm":1}}`)
+
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("panic is expected for faulty quotas")
+				}
+			}()
+
+			// WHEN
+			_ = LoadDefaultConfig(context.TODO(), nil)
+		},
+	)
+
+	t.Run(
+		"shall panic given faulty trusted proxies env variable", func(t *testing.T) {
+			// GIVEN
+			t.Setenv("TRUSTED_PROXIES", "10.0.0.0/33")
+
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("panic is expected for faulty trusted proxies")
+				}
+			}()
+
+			// WHEN
+			_ = LoadDefaultConfig(context.TODO(), nil)
+		},
+	)
+
+	t.Run(
+		"shall panic given faulty feature flags env variable", func(t *testing.T) {
+			// GIVEN
+			t.Setenv("FEATURE_FLAGS", `{"defaults":[]}`)
+
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("panic is expected for faulty feature flags")
+				}
+			}()
+
+			// WHEN
+			_ = LoadDefaultConfig(context.TODO(), nil)
+		},
+	)
+
+	for name, path := range map[string]func(t *testing.T) string{
+		"file not found":    func(t *testing.T) string { return filepath.Join(t.TempDir(), "missing.json") },
+		"faulty JSON":       func(t *testing.T) string { return writeFile(t, `{`) },
+		"faulty key":        func(t *testing.T) string { return writeFile(t, `{"private_key":"foo"}`) },
+		"faulty proxies":    func(t *testing.T) string { return writeFile(t, `{"trusted_proxies":["foo"]}`) },
+		"faulty experiment": func(t *testing.T) string { return writeFile(t, `{"experiment":{"name":"foo"}}`) },
+	} {
+		t.Run(
+			"shall panic given "+name, func(t *testing.T) {
+				// GIVEN
+				t.Setenv("CONFIG_FILE", path(t))
+
+				defer func() {
+					if r := recover(); r == nil {
+						t.Error("panic is expected for faulty config file")
+					}
+				}()
+
+				// WHEN
+				_ = LoadDefaultConfig(context.TODO(), nil)
+			},
+		)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := Config{
+		RepositoryPredictionConfig: repositoryPredictionConfig{DBHost: "localhost", DBName: "db", DBUser: "user"},
+		CIAM:                       ciamCfg{PrivateKey: ciam.GenerateCertificate(), SmtpHost: "smtp"},
+		ModelInferenceConfig:       modelInferenceConfig{Token: "foo"},
+	}
+
+	t.Run(
+		"valid", func(t *testing.T) {
+			if err := valid.Validate(); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		},
+	)
+
+	t.Run(
+		"valid with KMS, SES and self-hosted PlantUML", func(t *testing.T) {
+			cfg := valid
+			cfg.CIAM = ciamCfg{KMSKeyID: "alias/foo", SesRegion: "us-east-1"}
+			cfg.PlantUML.BaseURLs = []string{"http://localhost:8080/", "http://localhost:8081/"}
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		},
+	)
+
+	t.Run(
+		"shall list all invalid settings", func(t *testing.T) {
+			// GIVEN
+			cfg := Config{
+				CIAM:                 ciamCfg{SmtpTLSMode: "foo"},
+				ModelInferenceConfig: modelInferenceConfig{MaxTokens: -1},
+				PlantUML:             plantUMLConfig{BaseURLs: []string{"http://localhost:8080/", "localhost"}},
+				Tenants:              []ciam.Tenant{{ID: "foo"}, {ID: "foo", Theme: "Foo Bar"}},
+				Quotas:               ciam.RoleQuotas{ciam.RoleAnonymUser: ciam.RoleAnonymUser.Quotas()},
+			}
+
+			// WHEN
+			err := cfg.Validate()
+
+			// THEN
+			if err == nil {
+				t.Fatal("error expected")
+			}
+			for _, want := range []string{
+				"model API key must be set",
+				"model max tokens must be non-negative",
+				"DB host must be set",
+				"DB name must be set",
+				"DB user must be set",
+				"CIAM private key or KMS key ID must be set",
+				"CIAM SMTP host or SES region must be set",
+				"unknown SMTP TLS mode: foo",
+				"PlantUML base URL must be absolute URL",
+				"tenant foo: theme must contain lower case letters, digits, - and _ only",
+				"duplicate tenant: foo",
+				"quotas of the role registered must be defined",
+			} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error shall contain %q, got: %v", want, err)
+				}
+			}
+		},
+	)
+}
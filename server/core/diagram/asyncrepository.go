@@ -0,0 +1,319 @@
+package diagram
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// QueueFullPolicy defines how the write is handled when the queue of the asynchronous repository is full.
+type QueueFullPolicy string
+
+const (
+	// QueueFullWriteSync writes synchronously, i.e. the request waits for the write, to keep the record.
+	QueueFullWriteSync QueueFullPolicy = "sync"
+	// QueueFullDrop drops the write and returns ErrQueueFull to keep the request's latency.
+	QueueFullDrop QueueFullPolicy = "drop"
+)
+
+// ErrQueueFull the write is dropped because the queue of the asynchronous repository is full, see QueueFullDrop.
+var ErrQueueFull = errors.New("repository's queue is full, the write is dropped")
+
+// ErrRepositoryClosed the write is rejected because the repository is closed.
+var ErrRepositoryClosed = errors.New("repository is closed")
+
+// AsyncRepositoryOps defines the options of the asynchronous repository, see NewAsyncRepositoryPrediction.
+type AsyncRepositoryOps func(r *asyncRepositoryPrediction)
+
+// WithQueueSize sets the number of the writes buffered for the background workers, the default size is 1000.
+func WithQueueSize(n int) AsyncRepositoryOps {
+	return func(r *asyncRepositoryPrediction) {
+		if n > 0 {
+			r.queueSize = n
+		}
+	}
+}
+
+// WithWorkers sets the number of the background workers draining the queue, the default number is 4.
+// The writes are sharded across the workers by the request's ID, i.e. the size of every worker's queue
+// is the queue size divided by the number of workers.
+func WithWorkers(n int) AsyncRepositoryOps {
+	return func(r *asyncRepositoryPrediction) {
+		if n > 0 {
+			r.workers = n
+		}
+	}
+}
+
+// WithQueueFullPolicy sets how the write is handled when the queue is full, the write is synchronous by default.
+func WithQueueFullPolicy(policy QueueFullPolicy) AsyncRepositoryOps {
+	return func(r *asyncRepositoryPrediction) {
+		if policy == QueueFullWriteSync || policy == QueueFullDrop {
+			r.queueFullPolicy = policy
+		}
+	}
+}
+
+// WithWriteTimeout sets the timeout of the background write, the default timeout is 10 seconds.
+func WithWriteTimeout(timeout time.Duration) AsyncRepositoryOps {
+	return func(r *asyncRepositoryPrediction) {
+		if timeout > 0 {
+			r.writeTimeout = timeout
+		}
+	}
+}
+
+// WithAsyncErrorHandler sets the handler of the background writes' errors, e.g. to report them.
+// The errors are discarded by default.
+func WithAsyncErrorHandler(fn func(ctx context.Context, err error)) AsyncRepositoryOps {
+	return func(r *asyncRepositoryPrediction) {
+		if fn != nil {
+			r.onError = fn
+		}
+	}
+}
+
+// NewAsyncRepositoryPrediction wraps the repository to write asynchronously via the buffered queue
+// drained by the background workers, i.e. the writes do not add latency to the request.
+// The write returns nil once it is queued, its error is passed to the handler, see WithAsyncErrorHandler.
+// The writes of the same request are ordered, i.e. the model's result and the success flag are written
+// after the prompt they reference. The writes of different requests are not ordered.
+// Close drains the queue before closing the repository.
+func NewAsyncRepositoryPrediction(repository RepositoryPrediction, fnOps ...AsyncRepositoryOps) RepositoryPrediction {
+	r := &asyncRepositoryPrediction{
+		repository:      repository,
+		queueSize:       1000,
+		workers:         4,
+		queueFullPolicy: QueueFullWriteSync,
+		writeTimeout:    10 * time.Second,
+		onError:         func(_ context.Context, _ error) {},
+	}
+	for _, fn := range fnOps {
+		fn(r)
+	}
+
+	queueSize := r.queueSize / r.workers
+	if queueSize == 0 {
+		queueSize = 1
+	}
+	r.queues = make([]chan asyncWrite, r.workers)
+	r.pending = map[string]int{}
+	r.done = make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range r.queues {
+		r.queues[i] = make(chan asyncWrite, queueSize)
+		wg.Add(1)
+		go func(queue chan asyncWrite) {
+			defer wg.Done()
+			r.drain(queue)
+		}(r.queues[i])
+	}
+	go func() {
+		wg.Wait()
+		close(r.done)
+	}()
+
+	return r
+}
+
+type asyncRepositoryPrediction struct {
+	repository      RepositoryPrediction
+	queueSize       int
+	workers         int
+	queueFullPolicy QueueFullPolicy
+	writeTimeout    time.Duration
+	onError         func(ctx context.Context, err error)
+
+	// mu guards the queues from the writes after they are closed.
+	mu     sync.RWMutex
+	closed bool
+	// queues the workers' queues, the writes of the same request are queued to the same worker.
+	queues []chan asyncWrite
+	// pending counts the queued writes by the request's ID.
+	pending   map[string]int
+	pendingMu sync.Mutex
+	// done is closed once the workers drained the queues.
+	done chan struct{}
+}
+
+type asyncWrite struct {
+	ctx       context.Context
+	requestID string
+	write     func(ctx context.Context) error
+}
+
+func (r *asyncRepositoryPrediction) drain(queue <-chan asyncWrite) {
+	for w := range queue {
+		ctx, cancel := context.WithTimeout(w.ctx, r.writeTimeout)
+		if err := w.write(ctx); err != nil {
+			r.onError(w.ctx, err)
+		}
+		cancel()
+		r.addPending(w.requestID, -1)
+	}
+}
+
+func (r *asyncRepositoryPrediction) addPending(requestID string, delta int) (pending int) {
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+	pending = r.pending[requestID] + delta
+	if pending <= 0 {
+		delete(r.pending, requestID)
+	} else {
+		r.pending[requestID] = pending
+	}
+	return pending
+}
+
+// queue returns the queue of the worker which writes the request.
+func (r *asyncRepositoryPrediction) queue(requestID string) chan<- asyncWrite {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(requestID))
+	return r.queues[h.Sum32()%uint32(len(r.queues))]
+}
+
+// enqueue queues the write, or handles it according to the policy if the queue is full.
+func (r *asyncRepositoryPrediction) enqueue(
+	ctx context.Context, requestID string, write func(ctx context.Context) error,
+) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		return ErrRepositoryClosed
+	}
+
+	// the write outlives the request, hence it must not be cancelled with the request's context
+	w := asyncWrite{ctx: detachedContext{ctx}, requestID: requestID, write: write}
+	queue := r.queue(requestID)
+
+	pending := r.addPending(requestID, 1)
+	select {
+	case queue <- w:
+		return nil
+	default:
+	}
+
+	if r.queueFullPolicy == QueueFullDrop {
+		r.addPending(requestID, -1)
+		return ErrQueueFull
+	}
+
+	// the write waits for the request's queued writes, e.g. the prompt referenced by the model's result
+	if pending > 1 {
+		queue <- w
+		return nil
+	}
+	r.addPending(requestID, -1)
+	return write(ctx)
+}
+
+func (r *asyncRepositoryPrediction) WriteInputPrompt(ctx context.Context, requestID, userID, prompt string) error {
+	return r.enqueue(
+		ctx, requestID, func(ctx context.Context) error {
+			return r.repository.WriteInputPrompt(ctx, requestID, userID, prompt)
+		},
+	)
+}
+
+// WriteInputPromptWithClient see RepositoryPredictionWithClient.
+// The metadata is ignored if the wrapped repository does not support it.
+func (r *asyncRepositoryPrediction) WriteInputPromptWithClient(
+	ctx context.Context, requestID, userID, prompt, userAgent, clientVersion string,
+) error {
+	v, ok := r.repository.(RepositoryPredictionWithClient)
+	if !ok {
+		return r.WriteInputPrompt(ctx, requestID, userID, prompt)
+	}
+	return r.enqueue(
+		ctx, requestID, func(ctx context.Context) error {
+			return v.WriteInputPromptWithClient(ctx, requestID, userID, prompt, userAgent, clientVersion)
+		},
+	)
+}
+
+func (r *asyncRepositoryPrediction) WriteModelResult(
+	ctx context.Context, requestID, userID, predictionRaw, prediction, model string,
+	usageTokensPrompt, usageTokensCompletions uint16,
+) error {
+	return r.enqueue(
+		ctx, requestID, func(ctx context.Context) error {
+			return r.repository.WriteModelResult(
+				ctx, requestID, userID, predictionRaw, prediction, model, usageTokensPrompt, usageTokensCompletions,
+			)
+		},
+	)
+}
+
+// WriteModelResultWithVariant see RepositoryPredictionWithVariant.
+// The variant is ignored if the wrapped repository does not support it.
+func (r *asyncRepositoryPrediction) WriteModelResultWithVariant(
+	ctx context.Context, requestID, userID, predictionRaw, prediction, model string,
+	usageTokensPrompt, usageTokensCompletions uint16, variant string,
+) error {
+	v, ok := r.repository.(RepositoryPredictionWithVariant)
+	if !ok {
+		return r.WriteModelResult(
+			ctx, requestID, userID, predictionRaw, prediction, model, usageTokensPrompt, usageTokensCompletions,
+		)
+	}
+	return r.enqueue(
+		ctx, requestID, func(ctx context.Context) error {
+			return v.WriteModelResultWithVariant(
+				ctx, requestID, userID, predictionRaw, prediction, model, usageTokensPrompt, usageTokensCompletions,
+				variant,
+			)
+		},
+	)
+}
+
+func (r *asyncRepositoryPrediction) WriteSuccessFlag(ctx context.Context, requestID, userID, token string) error {
+	return r.enqueue(
+		ctx, requestID, func(ctx context.Context) error {
+			return r.repository.WriteSuccessFlag(ctx, requestID, userID, token)
+		},
+	)
+}
+
+// Close rejects new writes, waits for the queued writes to be flushed, and closes the repository.
+// The writes which were not flushed before the context is done are lost.
+func (r *asyncRepositoryPrediction) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		for _, queue := range r.queues {
+			close(queue)
+		}
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return errors.New("queue is not flushed: " + ctx.Err().Error())
+	}
+	return r.repository.Close(ctx)
+}
+
+// detachedContext keeps the parent's values, e.g. the tracing span, but not its cancellation and deadline.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
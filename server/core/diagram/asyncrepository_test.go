@@ -0,0 +1,318 @@
+package diagram
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockRecordingRepository records the written prompts, the writes wait for the gate if it is set.
+// Only the writes of the gatedPrompt wait if it is set.
+type mockRecordingRepository struct {
+	MockRepositoryPrediction
+	gate        chan struct{}
+	gatedPrompt string
+
+	mu      sync.Mutex
+	prompts []string
+	closed  bool
+}
+
+func (m *mockRecordingRepository) WriteInputPrompt(_ context.Context, _, _, prompt string) error {
+	if m.gate != nil && (m.gatedPrompt == "" || m.gatedPrompt == prompt) {
+		<-m.gate
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prompts = append(m.prompts, prompt)
+	return m.Err
+}
+
+func (m *mockRecordingRepository) Close(_ context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+func (m *mockRecordingRepository) written() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.prompts)
+}
+
+func TestNewAsyncRepositoryPrediction(t *testing.T) {
+	t.Run(
+		"shall flush the writes eventually", func(t *testing.T) {
+			// GIVEN
+			repository := &mockRecordingRepository{}
+			r := NewAsyncRepositoryPrediction(repository, WithWorkers(2))
+
+			// WHEN
+			for i := 0; i < 10; i++ {
+				if err := r.WriteInputPrompt(context.TODO(), "foo", "bar", "qux"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// THEN
+			deadline := time.Now().Add(time.Second)
+			for repository.written() < 10 {
+				if time.Now().After(deadline) {
+					t.Fatalf("the writes shall be flushed, got %d", repository.written())
+				}
+				time.Sleep(time.Millisecond)
+			}
+		},
+	)
+
+	t.Run(
+		"shall drain the queue on close", func(t *testing.T) {
+			// GIVEN
+			repository := &mockRecordingRepository{gate: make(chan struct{})}
+			r := NewAsyncRepositoryPrediction(repository, WithWorkers(1), WithQueueSize(10))
+			for i := 0; i < 5; i++ {
+				if err := r.WriteInputPrompt(context.TODO(), "foo", "bar", "qux"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// WHEN
+			close(repository.gate)
+			err := r.Close(context.TODO())
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if repository.written() != 5 || !repository.closed {
+				t.Errorf("the queue shall be drained before closing, written: %d", repository.written())
+			}
+			if err := r.WriteInputPrompt(context.TODO(), "foo", "bar", "qux"); !errors.Is(err, ErrRepositoryClosed) {
+				t.Errorf("the write after close shall be rejected, got: %v", err)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail to close given the queue is not drained before the context is done", func(t *testing.T) {
+			// GIVEN
+			repository := &mockRecordingRepository{gate: make(chan struct{})}
+			defer close(repository.gate)
+			r := NewAsyncRepositoryPrediction(repository, WithWorkers(1))
+			if err := r.WriteInputPrompt(context.TODO(), "foo", "bar", "qux"); err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+			defer cancel()
+			err := r.Close(ctx)
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+
+	t.Run(
+		"shall handle the full queue according to the policy", func(t *testing.T) {
+			for _, tt := range []struct {
+				policy      QueueFullPolicy
+				wantErr     error
+				wantWritten int
+			}{
+				{policy: QueueFullDrop, wantErr: ErrQueueFull, wantWritten: 0},
+				{policy: QueueFullWriteSync, wantWritten: 1},
+			} {
+				t.Run(
+					string(tt.policy), func(t *testing.T) {
+						// GIVEN
+						// the worker is blocked by the first request's write, and the second request's write
+						// fills the queue
+						repository := &mockRecordingRepository{gate: make(chan struct{}), gatedPrompt: "first"}
+						r := NewAsyncRepositoryPrediction(
+							repository, WithWorkers(1), WithQueueSize(1), WithQueueFullPolicy(tt.policy),
+						).(*asyncRepositoryPrediction)
+						_ = r.WriteInputPrompt(context.TODO(), "first", "bar", "first")
+						for len(r.queues[0]) > 0 {
+							time.Sleep(time.Millisecond)
+						}
+						_ = r.WriteInputPrompt(context.TODO(), "second", "bar", "second")
+
+						// WHEN
+						err := r.WriteInputPrompt(context.TODO(), "third", "bar", "third")
+
+						// THEN
+						if !errors.Is(err, tt.wantErr) {
+							t.Errorf("unexpected error: got = %v, want = %v", err, tt.wantErr)
+						}
+						if got := repository.written(); got != tt.wantWritten {
+							t.Errorf("unexpected number of synchronous writes: got = %d, want = %d", got, tt.wantWritten)
+						}
+
+						close(repository.gate)
+						if err := r.Close(context.TODO()); err != nil {
+							t.Fatal(err)
+						}
+					},
+				)
+			}
+		},
+	)
+
+	t.Run(
+		"shall pass the write's error to the handler", func(t *testing.T) {
+			// GIVEN
+			errs := make(chan error, 1)
+			r := NewAsyncRepositoryPrediction(
+				&mockRecordingRepository{MockRepositoryPrediction: MockRepositoryPrediction{Err: errors.New("foo")}},
+				WithAsyncErrorHandler(
+					func(_ context.Context, err error) {
+						errs <- err
+					},
+				),
+			)
+
+			// WHEN
+			ctx, cancel := context.WithCancel(context.TODO())
+			err := r.WriteInputPrompt(ctx, "foo", "bar", "qux")
+			// the request is completed before the write
+			cancel()
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case err := <-errs:
+				if err.Error() != "foo" {
+					t.Errorf("unexpected error: %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Error("the error shall be handled")
+			}
+		},
+	)
+
+	t.Run(
+		"shall write the request's prompt, model's result and success flag in order", func(t *testing.T) {
+			// GIVEN
+			repository := &mockOrderedRepository{}
+			r := NewAsyncRepositoryPrediction(repository, WithWorkers(4))
+
+			// WHEN
+			for i := 0; i < 100; i++ {
+				requestID := strconv.Itoa(i)
+				if err := r.WriteInputPrompt(context.TODO(), requestID, "bar", "qux"); err != nil {
+					t.Fatal(err)
+				}
+				if err := r.WriteModelResult(context.TODO(), requestID, "bar", "", "", "", 0, 0); err != nil {
+					t.Fatal(err)
+				}
+				if err := r.WriteSuccessFlag(context.TODO(), requestID, "bar", ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := r.Close(context.TODO()); err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			if err := repository.errOrder(); err != nil {
+				t.Error(err)
+			}
+		},
+	)
+
+	t.Run(
+		"shall queue the request's write given the full queue, and the request's pending writes", func(t *testing.T) {
+			// GIVEN
+			// the worker is blocked by the request's prompt, and the model's result fills the queue
+			repository := &mockOrderedRepository{gate: make(chan struct{})}
+			r := NewAsyncRepositoryPrediction(
+				repository, WithWorkers(1), WithQueueSize(1), WithQueueFullPolicy(QueueFullWriteSync),
+			).(*asyncRepositoryPrediction)
+			_ = r.WriteInputPrompt(context.TODO(), "foo", "bar", "qux")
+			for len(r.queues[0]) > 0 {
+				time.Sleep(time.Millisecond)
+			}
+			_ = r.WriteModelResult(context.TODO(), "foo", "bar", "", "", "", 0, 0)
+
+			// WHEN
+			errs := make(chan error, 1)
+			go func() {
+				errs <- r.WriteSuccessFlag(context.TODO(), "foo", "bar", "")
+			}()
+			close(repository.gate)
+
+			// THEN
+			if err := <-errs; err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Close(context.TODO()); err != nil {
+				t.Fatal(err)
+			}
+			if err := repository.errOrder(); err != nil {
+				t.Error(err)
+			}
+		},
+	)
+}
+
+// mockOrderedRepository records the writes' order by the request, the prompts' writes wait for the gate if it is set.
+// The prompts are written with the delay to let the request's further writes overtake them if they are not ordered.
+type mockOrderedRepository struct {
+	MockRepositoryPrediction
+	gate chan struct{}
+
+	mu     sync.Mutex
+	writes map[string][]string
+}
+
+func (m *mockOrderedRepository) write(requestID, v string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.writes == nil {
+		m.writes = map[string][]string{}
+	}
+	m.writes[requestID] = append(m.writes[requestID], v)
+}
+
+func (m *mockOrderedRepository) WriteInputPrompt(_ context.Context, requestID, _, _ string) error {
+	if m.gate != nil {
+		<-m.gate
+	}
+	time.Sleep(100 * time.Microsecond)
+	m.write(requestID, "prompt")
+	return nil
+}
+
+func (m *mockOrderedRepository) WriteModelResult(_ context.Context, requestID, _, _, _, _ string, _, _ uint16) error {
+	m.write(requestID, "prediction")
+	return nil
+}
+
+func (m *mockOrderedRepository) WriteSuccessFlag(_ context.Context, requestID, _, _ string) error {
+	m.write(requestID, "success")
+	return nil
+}
+
+// errOrder returns the error if any request's writes are not ordered like the foreign keys require.
+func (m *mockOrderedRepository) errOrder() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	want := []string{"prompt", "prediction", "success"}
+	for requestID, got := range m.writes {
+		if !reflect.DeepEqual(got, want) {
+			return errors.New("unexpected order of the request " + requestID + ": " + strings.Join(got, ","))
+		}
+	}
+	return nil
+}
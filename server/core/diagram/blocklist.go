@@ -0,0 +1,33 @@
+package diagram
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// NewBlocklist initialises the Moderator which flags the prompts containing any of the terms.
+// The terms are matched case-insensitively as whole words, e.g. the term "ass" does not match "class".
+func NewBlocklist(terms ...string) Moderator {
+	var quoted []string
+	for _, term := range terms {
+		if term = strings.TrimSpace(term); term != "" {
+			quoted = append(quoted, regexp.QuoteMeta(term))
+		}
+	}
+	if len(quoted) == 0 {
+		return blocklist{}
+	}
+	return blocklist{pattern: regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+type blocklist struct {
+	pattern *regexp.Regexp
+}
+
+func (b blocklist) IsFlagged(_ context.Context, prompt string) (bool, error) {
+	if b.pattern == nil {
+		return false, nil
+	}
+	return b.pattern.MatchString(prompt), nil
+}
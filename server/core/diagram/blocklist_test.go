@@ -0,0 +1,59 @@
+package diagram
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewBlocklist(t *testing.T) {
+	tests := []struct {
+		name   string
+		terms  []string
+		prompt string
+		want   bool
+	}{
+		{
+			name:   "blocked term",
+			terms:  []string{"ass", "foo bar"},
+			prompt: "c4 diagram: Ass calls backend",
+			want:   true,
+		},
+		{
+			name:   "blocked phrase",
+			terms:  []string{"ass", "foo bar"},
+			prompt: "draw FOO BAR.",
+			want:   true,
+		},
+		{
+			name:   "benign substring",
+			terms:  []string{"ass", "foo bar"},
+			prompt: "class diagram with the assistant service and foo barista",
+			want:   false,
+		},
+		{
+			name:   "term with the regexp special characters",
+			terms:  []string{"c++"},
+			prompt: "backend in c, and frontend in cpp",
+			want:   false,
+		},
+		{
+			name:   "empty blocklist",
+			terms:  []string{"", " "},
+			prompt: "foo",
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := NewBlocklist(tt.terms...).IsFlagged(context.TODO(), tt.prompt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("IsFlagged() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,110 @@
+package c4container
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitBreakerState defines the state of the CircuitBreaker.
+type CircuitBreakerState string
+
+const (
+	// CircuitBreakerClosed the PlantUML server is called.
+	CircuitBreakerClosed CircuitBreakerState = "closed"
+	// CircuitBreakerOpen the PlantUML server is not called, the rendering fails immediately.
+	CircuitBreakerOpen CircuitBreakerState = "open"
+	// CircuitBreakerHalfOpen a single trial call to the PlantUML server is allowed to test its recovery.
+	CircuitBreakerHalfOpen CircuitBreakerState = "half-open"
+)
+
+// CircuitBreaker short-circuits the calls to the PlantUML server while it is down
+// to fail fast instead of waiting for the timeout, see WithCircuitBreaker.
+type CircuitBreaker struct {
+	maxFailures int
+	cooldown    time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	// trial defines if the trial call is in flight in the half-open state.
+	trial bool
+}
+
+// NewCircuitBreaker initialises the CircuitBreaker which opens after maxFailures consecutive failures
+// of the PlantUML server, and half-opens after the cooldown.
+func NewCircuitBreaker(maxFailures int, cooldown time.Duration) *CircuitBreaker {
+	if maxFailures < 1 {
+		maxFailures = 1
+	}
+	return &CircuitBreaker{maxFailures: maxFailures, cooldown: cooldown, now: time.Now}
+}
+
+// State returns the current state of the breaker, e.g. to export it as the metric.
+func (b *CircuitBreaker) State() CircuitBreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state()
+}
+
+func (b *CircuitBreaker) state() CircuitBreakerState {
+	switch {
+	case b.failures < b.maxFailures:
+		return CircuitBreakerClosed
+	case b.now().Sub(b.openedAt) < b.cooldown:
+		return CircuitBreakerOpen
+	default:
+		return CircuitBreakerHalfOpen
+	}
+}
+
+// allow defines if the PlantUML server can be called. The nil breaker always allows the call.
+func (b *CircuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state() {
+	case CircuitBreakerClosed:
+		return true
+	case CircuitBreakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return false
+	}
+}
+
+// report records the outcome of the call to the PlantUML server.
+func (b *CircuitBreaker) report(failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.maxFailures {
+		b.openedAt = b.now()
+	}
+}
+
+// abort releases the trial call which outcome does not indicate the server's health, e.g. the cancelled call.
+func (b *CircuitBreaker) abort() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
@@ -0,0 +1,137 @@
+package c4container
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	// GIVEN
+	now := time.Unix(0, 0)
+	breaker := NewCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	assertState := func(t *testing.T, want CircuitBreakerState) {
+		t.Helper()
+		if got := breaker.State(); got != want {
+			t.Errorf("unexpected state: got = %s, want = %s", got, want)
+		}
+	}
+
+	t.Run(
+		"shall stay closed until the failures threshold is reached", func(t *testing.T) {
+			// WHEN
+			breaker.report(true)
+			breaker.report(false)
+			breaker.report(true)
+
+			// THEN
+			assertState(t, CircuitBreakerClosed)
+			if !breaker.allow() {
+				t.Error("closed breaker shall allow the call")
+			}
+		},
+	)
+
+	t.Run(
+		"shall open after the consecutive failures", func(t *testing.T) {
+			// WHEN
+			breaker.report(true)
+
+			// THEN
+			assertState(t, CircuitBreakerOpen)
+			if breaker.allow() {
+				t.Error("open breaker shall not allow the call")
+			}
+		},
+	)
+
+	t.Run(
+		"shall half-open after the cooldown allowing a single trial call", func(t *testing.T) {
+			// WHEN
+			now = now.Add(time.Minute)
+
+			// THEN
+			assertState(t, CircuitBreakerHalfOpen)
+			if !breaker.allow() {
+				t.Error("half-open breaker shall allow the trial call")
+			}
+			if breaker.allow() {
+				t.Error("half-open breaker shall not allow the call while the trial is in flight")
+			}
+		},
+	)
+
+	t.Run(
+		"shall open again given the trial call failed", func(t *testing.T) {
+			// WHEN
+			breaker.report(true)
+
+			// THEN
+			assertState(t, CircuitBreakerOpen)
+		},
+	)
+
+	t.Run(
+		"shall release the aborted trial call", func(t *testing.T) {
+			// GIVEN
+			now = now.Add(time.Minute)
+			breaker.allow()
+
+			// WHEN
+			breaker.abort()
+
+			// THEN
+			assertState(t, CircuitBreakerHalfOpen)
+			if !breaker.allow() {
+				t.Error("half-open breaker shall allow the trial call after the aborted one")
+			}
+		},
+	)
+
+	t.Run(
+		"shall close given the trial call succeeded", func(t *testing.T) {
+			// WHEN
+			breaker.report(false)
+
+			// THEN
+			assertState(t, CircuitBreakerClosed)
+		},
+	)
+}
+
+func Test_callPlantUMLWithCircuitBreaker(t *testing.T) {
+	// GIVEN
+	var cntRequests int
+	httpClient := mockHTTPClientFn(
+		func(_ *http.Request) (*http.Response, error) {
+			cntRequests++
+			if cntRequests == 1 {
+				return nil, errors.New("connection refused")
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`<svg></svg>`))}, nil
+		},
+	)
+	breaker := NewCircuitBreaker(1, time.Hour)
+	pool := newPlantUMLPool("http://localhost/")
+
+	// WHEN
+	_, errFirst := callPlantUML(context.TODO(), httpClient, pool, breaker, FormatSVG, "foo")
+	_, errSecond := callPlantUML(context.TODO(), httpClient, pool, breaker, FormatSVG, "foo")
+
+	// THEN
+	if errFirst == nil || errSecond == nil {
+		t.Fatal("error expected")
+	}
+	if cntRequests != 1 {
+		t.Errorf("the PlantUML server shall not be called while the breaker is open, got %d calls", cntRequests)
+	}
+	if breaker.State() != CircuitBreakerOpen {
+		t.Errorf("unexpected state: %s", breaker.State())
+	}
+}
@@ -4,19 +4,44 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/kislerdm/diagramastext/server/core/diagram"
 	"github.com/kislerdm/diagramastext/server/core/errors"
+	"github.com/kislerdm/diagramastext/server/core/logger"
 )
 
 // c4ContainersGraph defines the containers and relations for C4 container diagram's graph.
 type c4ContainersGraph struct {
 	Containers []*container `json:"nodes"`
-	Rels       []*rel       `json:"links"`
+	Rels       []*rel       `json:"links,omitempty"`
 	Title      string       `json:"title,omitempty"`
 	Footer     string       `json:"footer,omitempty"`
-	WithLegend bool         `json:"legend,omitempty"`
+	// Layout the diagram's direction: top-down, or left-right. PlantUML's default is used if it is not set.
+	Layout string `json:"layout,omitempty"`
+	// Style the diagram's rendering style: sketch, or landscape. The default style is used if it is not set.
+	Style      string    `json:"style,omitempty"`
+	WithLegend bool      `json:"legend,omitempty"`
+	RelTags    []*relTag `json:"rel_tags,omitempty"`
+}
+
+// MarshalJSON encodes the legend flag only if the legend is disabled, because the graph without it
+// is decoded with the legend, e.g. to keep the few-shot examples without the legend flag.
+func (l c4ContainersGraph) MarshalJSON() ([]byte, error) {
+	type tmp c4ContainersGraph
+	var withoutLegend *bool
+	if !l.WithLegend {
+		withoutLegend = &l.WithLegend
+	}
+	return json.Marshal(
+		struct {
+			tmp
+			WithLegend *bool `json:"legend,omitempty"`
+		}{tmp: tmp(l), WithLegend: withoutLegend},
+	)
 }
 
 func (l *c4ContainersGraph) UnmarshalJSON(data []byte) error {
@@ -32,6 +57,28 @@ func (l *c4ContainersGraph) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// c4ContainersGraphs defines the model's prediction for the prompt describing several diagrams.
+type c4ContainersGraphs struct {
+	Diagrams []*c4ContainersGraph `json:"diagrams"`
+}
+
+// unmarshalGraphs decodes the model's prediction which defines either a single graph, or the list of graphs.
+func unmarshalGraphs(data []byte) ([]*c4ContainersGraph, error) {
+	var v c4ContainersGraphs
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	if len(v.Diagrams) > 0 {
+		return v.Diagrams, nil
+	}
+
+	var graph c4ContainersGraph
+	if err := json.Unmarshal(data, &graph); err != nil {
+		return nil, err
+	}
+	return []*c4ContainersGraph{&graph}, nil
+}
+
 // container C4 container definition.
 type container struct {
 	ID          string `json:"id"`
@@ -47,17 +94,305 @@ type container struct {
 
 // rel containers relations.
 type rel struct {
-	From       string `json:"from"`
-	To         string `json:"to"`
-	Label      string `json:"label,omitempty"`
-	Direction  string `json:"direction,omitempty"`
+	From       string   `json:"from"`
+	To         string   `json:"to"`
+	Label      string   `json:"label,omitempty"`
+	Direction  string   `json:"direction,omitempty"`
+	Technology string   `json:"technology,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	// IsAsync marks the asynchronous relation.
+	// C4-PlantUML does not define a dedicated macro for async relations, hence they are rendered using
+	// the relation macro with the tag "async" which is styled as the dashed line,
+	// e.g. Rel_R(0, 1, "Uses", $tags="async").
+	IsAsync bool `json:"async,omitempty"`
+}
+
+// relTag relations' styling definition.
+type relTag struct {
+	Name       string `json:"name"`
+	TextColor  string `json:"text_color,omitempty"`
+	LineColor  string `json:"line_color,omitempty"`
+	LineStyle  string `json:"line_style,omitempty"`
 	Technology string `json:"technology,omitempty"`
+	LegendText string `json:"legend_text,omitempty"`
+}
+
+// HandlerOps defines the options of the C4 containers diagram's httphandler.
+type HandlerOps func(cfg *renderingConfig)
+
+// WithDefaultFooter sets the footer used when the diagram does not define it.
+func WithDefaultFooter(footer string) HandlerOps {
+	return func(cfg *renderingConfig) {
+		if footer != "" {
+			cfg.DefaultFooter = footer
+		}
+	}
+}
+
+// WithFixedDate replaces the date macros, e.g. %date('yyyy-MM-dd') of the default footer, with the date
+// to render the same graph to the identical SVG, e.g. for the clients to cache it using the ETag.
+// The empty date omits the macros. The macros render the current date by default.
+func WithFixedDate(date string) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.FixedDate = true
+		cfg.Date = date
+	}
+}
+
+// WithDefaultRelationLabel sets the label of relations which do not define it.
+// The empty label omits it, i.e. the relation is rendered without the label.
+func WithDefaultRelationLabel(label string) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.DefaultRelationLabel = label
+	}
+}
+
+// WithDefaultTechnology sets the technology of containers which do not define it, e.g. "n/a".
+// The technology is omitted by default.
+func WithDefaultTechnology(technology string) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.DefaultTechnology = technology
+	}
+}
+
+// WithExternalGrouping groups the external containers into the system boundary "External".
+// The containers with the explicitly defined group are kept in it.
+func WithExternalGrouping() HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.GroupExternal = true
+	}
+}
+
+// WithPlantUMLBaseURL sets the base URLs of the PlantUML servers, e.g. the self-hosted ones,
+// used to render the diagram. Example: http://localhost:8080/.
+// The servers are called in the round-robin order, the server which fails is skipped for 30 seconds,
+// and the diagram rendering is retried using the next server. The empty URLs are ignored.
+func WithPlantUMLBaseURL(baseURLs ...string) HandlerOps {
+	return func(cfg *renderingConfig) {
+		var urls []string
+		for _, baseURL := range baseURLs {
+			if baseURL == "" {
+				continue
+			}
+			if !strings.HasSuffix(baseURL, "/") {
+				baseURL += "/"
+			}
+			urls = append(urls, baseURL)
+		}
+		if len(urls) > 0 {
+			cfg.PlantUML = newPlantUMLPool(urls...)
+		}
+	}
+}
+
+// WithCircuitBreaker fails the diagram rendering immediately while the PlantUML servers are down
+// instead of waiting for the timeout, see NewCircuitBreaker. The breaker's state can be exported as the metric.
+func WithCircuitBreaker(breaker *CircuitBreaker) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.CircuitBreaker = breaker
+	}
+}
+
+// WithSVGMinification removes the comments, the editor metadata and the whitespaces between the elements
+// from the SVG diagram generated by PlantUML to reduce its size.
+func WithSVGMinification() HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.MinifySVG = true
+	}
+}
+
+// WithMaxSVGSize sets the maximum size of the SVG diagram in bytes, the diagram exceeding it is rejected
+// as too complex with the status code 413. The limit applies to the SVG after the minification,
+// and to the SVG converted to another format. Zero value disables the limit.
+func WithMaxSVGSize(size int) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.MaxSVGSize = size
+	}
+}
+
+// SVGConverter converts the SVG diagram to another format.
+type SVGConverter interface {
+	Convert(ctx context.Context, svg []byte) ([]byte, error)
+}
+
+// SVGConverterFunc the adapter to use the function as SVGConverter.
+type SVGConverterFunc func(ctx context.Context, svg []byte) ([]byte, error)
+
+func (f SVGConverterFunc) Convert(ctx context.Context, svg []byte) ([]byte, error) {
+	return f(ctx, svg)
+}
+
+// WithPDFConverter sets the converter to render the PDF diagram from the SVG fetched from the PlantUML server.
+// The diagram is rendered using the PlantUML route pdf/ if the converter is not set. Note that the route is only
+// supported by the self-hosted PlantUML server with the Apache Batik and FOP libraries installed,
+// e.g. the docker image plantuml/plantuml-server:jetty, the public server www.plantuml.com does not serve it.
+func WithPDFConverter(converter SVGConverter) HandlerOps {
+	return withConverter(FormatPDF, converter)
+}
+
+// WithPNGRasterizer sets the rasterizer to render the PNG diagram from the SVG fetched from the PlantUML server,
+// e.g. for the self-hosted PlantUML server which only serves SVG, see the external NewExternalRSVGConverter.
+// The diagram is rendered using the PlantUML route png/ if the rasterizer is not set, there is no default rasterizer.
+func WithPNGRasterizer(rasterizer SVGConverter) HandlerOps {
+	return withConverter(FormatPNG, rasterizer)
+}
+
+func withConverter(format Format, converter SVGConverter) HandlerOps {
+	return func(cfg *renderingConfig) {
+		if converter == nil {
+			return
+		}
+		if cfg.Converters == nil {
+			cfg.Converters = map[Format]SVGConverter{}
+		}
+		cfg.Converters[format] = converter
+	}
+}
+
+// WithMaxLength sets the maximum number of characters of the containers' label, technology and description.
+// The exceeding values are truncated with the ellipsis. Zero value disables the limit.
+func WithMaxLength(label, technology, description int) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.MaxLengthLabel = label
+		cfg.MaxLengthTechnology = technology
+		cfg.MaxLengthDescription = description
+	}
+}
+
+// WithFailOnMaxLength rejects the diagram with the containers' attributes exceeding the maximum length
+// instead of truncating them.
+func WithFailOnMaxLength() HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.FailOnMaxLength = true
+	}
+}
+
+// WithRelationTechnologyInference sets the technology of the relations which do not define it given
+// the technology of the container the relation points to, e.g. {"Go": "HTTP", "Postgres": "TCP"}.
+// The containers' technologies are matched case-insensitively. The inference is disabled by default.
+func WithRelationTechnologyInference(technologies map[string]string) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.RelationTechnologies = make(map[string]string, len(technologies))
+		for k, v := range technologies {
+			cfg.RelationTechnologies[strings.ToLower(strings.TrimSpace(k))] = v
+		}
+	}
+}
+
+// WithPromptPreprocessor sets the preprocessor to transform the prompt before it is sent to the model and stored,
+// e.g. to redact the personal identifiable information, see diagram.NewRegexpRedactor.
+func WithPromptPreprocessor(preprocessor diagram.PromptPreprocessor) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.PromptPreprocessor = preprocessor
+	}
+}
+
+// WithModerator adds the moderator to reject the prompts violating the content policy before spending
+// the model's tokens. The rejected prompt results to the diagram.HTTPHandler's error with the status code 422.
+// The moderators are called in the order they were added until the prompt is flagged,
+// e.g. the keywords blocklist (see diagram.NewBlocklist) shall precede the moderator calling the external API.
+func WithModerator(moderator diagram.Moderator) HandlerOps {
+	return func(cfg *renderingConfig) {
+		if moderator != nil {
+			cfg.Moderators = append(cfg.Moderators, moderator)
+		}
+	}
+}
+
+// WithMaxNodeDegree sets the maximum number of incoming and outgoing links of a node. The output contains
+// the warning for every node exceeding it to suggest splitting the diagram. Zero value disables the validation.
+func WithMaxNodeDegree(maxDegree int) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.MaxNodeDegree = maxDegree
+	}
+}
+
+// WithCyclesDetection adds the warnings about the circular dependencies between the nodes to the output,
+// e.g. for the UI to highlight them, because the cycles make some layouts unreadable.
+func WithCyclesDetection() HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.DetectCycles = true
+	}
+}
+
+// WithOrphanNodesDetection adds the warnings about the nodes without links to the output.
+// The diagram with the single node is not validated.
+func WithOrphanNodesDetection() HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.DetectOrphanNodes = true
+	}
+}
+
+// WithSelfLinksDetection adds the warnings about the links from the node to itself to the output,
+// because such links usually indicate the model's error. The links are rendered as the loops regardless.
+func WithSelfLinksDetection() HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.DetectSelfLinks = true
+	}
+}
+
+// WithLogger sets the logger, the records of the level info and above are written to stderr by default.
+func WithLogger(l logger.Logger) HandlerOps {
+	return func(cfg *renderingConfig) {
+		if l != nil {
+			cfg.Logger = l
+		}
+	}
+}
+
+// WithVersion sets the application's version added to the output along with the model which generated
+// the diagram, e.g. to reproduce and debug the diagram.
+func WithVersion(version string) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.Version = version
+	}
+}
+
+// Flags of the optional features gated by WithFeatureFlags.
+const (
+	// FeatureSVGMinification gates WithSVGMinification.
+	FeatureSVGMinification = "c4_svg_minification"
+	// FeatureRelationTechnologyInference gates WithRelationTechnologyInference.
+	FeatureRelationTechnologyInference = "c4_relation_technology_inference"
+)
+
+// WithFeatureFlags gates the optional features per user at request time. The features configured
+// by the options are disabled for the user unless their flags are enabled, e.g. FeatureSVGMinification.
+func WithFeatureFlags(flags diagram.FeatureFlags) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.FeatureFlags = flags
+	}
+}
+
+// applyFeatureFlags disables the optional features which are not enabled for the user.
+func (cfg renderingConfig) applyFeatureFlags(ctx context.Context, userID string) renderingConfig {
+	if cfg.FeatureFlags == nil {
+		return cfg
+	}
+	if !cfg.FeatureFlags.IsEnabled(ctx, FeatureSVGMinification, userID) {
+		cfg.MinifySVG = false
+	}
+	if !cfg.FeatureFlags.IsEnabled(ctx, FeatureRelationTechnologyInference, userID) {
+		cfg.RelationTechnologies = nil
+	}
+	return cfg
+}
+
+// applyBranding overrides the default footer and the theme with the tenant's branding, see diagram.Branding.
+func (cfg renderingConfig) applyBranding(branding diagram.Branding) renderingConfig {
+	if branding.DefaultFooter != "" {
+		cfg.DefaultFooter = branding.DefaultFooter
+	}
+	if branding.Theme != "" {
+		cfg.Theme = branding.Theme
+	}
+	return cfg
 }
 
 // NewC4ContainersHTTPHandler initialises the httphandler to generate C4 containers diagram.
 func NewC4ContainersHTTPHandler(
 	clientModelInference diagram.ModelInference, clientRepositoryPrediction diagram.RepositoryPrediction,
-	httpClient diagram.HTTPClient,
+	httpClient diagram.HTTPClient, fnOps ...HandlerOps,
 ) (diagram.HTTPHandler, error) {
 	if clientModelInference == nil {
 		return nil, errors.New("model inference client must be provided")
@@ -65,34 +400,69 @@ func NewC4ContainersHTTPHandler(
 	if httpClient == nil {
 		return nil, errors.New("http client must be provided")
 	}
+
+	cfg := defaultRenderingConfig()
+	cfg.Logger = logger.NewJSONLogger(os.Stderr, logger.LevelInfo)
+	for _, fn := range fnOps {
+		fn(&cfg)
+	}
+
 	return func(ctx context.Context, input diagram.Input) (diagram.Output, error) {
 		if err := input.Validate(); err != nil {
 			return nil, err
 		}
 
+		prompt, err := preprocessPrompt(ctx, cfg.PromptPreprocessor, input.GetPrompt())
+		if err != nil {
+			return nil, err
+		}
+
 		if clientRepositoryPrediction != nil {
-			if err := clientRepositoryPrediction.WriteInputPrompt(
-				ctx, input.GetRequestID(), input.GetUserID(), input.GetPrompt(),
+			if err := handleStorageError(
+				ctx, cfg, input, "cannot write input prompt",
+				writeInputPrompt(ctx, clientRepositoryPrediction, input, prompt),
 			); err != nil {
-				// FIXME: add proper logging
-				log.Printf("clientRepositoryPrediction.WriteInputPrompt err: %+v", err)
+				return nil, err
 			}
 		}
 
-		predictionRaw, diagramPrediction, usageTokensPrompt, usageTokensCompletions, err := clientModelInference.Do(
-			ctx, input.GetPrompt(), contentSystem, model,
+		if err := moderatePrompt(ctx, cfg.Moderators, prompt); err != nil {
+			return nil, err
+		}
+
+		variant := experimentVariant(ctx, cfg.Experiment, input.GetUserID())
+		if err := fitContextWindow(
+			cfg.Tokenizer, variant.Model, systemContent(variant, regeneration(input)), prompt,
+		); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		predictionRaw, diagramPrediction, usageTokensPrompt, usageTokensCompletions, err := predict(
+			ctx, clientModelInference, prompt, regeneration(input), variant,
 		)
 		if err != nil {
 			return nil, errors.New(err.Error())
 		}
+		cfg.Logger.Debug(
+			"model inference", logFields(
+				input, logger.Fields{
+					"duration_ms": time.Since(start).Milliseconds(), "model": variant.Model,
+					"usage_tokens_prompt": usageTokensPrompt, "usage_tokens_completions": usageTokensCompletions,
+					"regeneration": regeneration(input), "experiment_variant": variant.Name,
+				},
+			),
+		)
 
 		if clientRepositoryPrediction != nil {
-			if err := clientRepositoryPrediction.WriteModelResult(
-				ctx, input.GetRequestID(), input.GetUserID(), predictionRaw, string(diagramPrediction), model,
-				usageTokensPrompt, usageTokensCompletions,
+			if err := handleStorageError(
+				ctx, cfg, input, "cannot write model result",
+				writeModelResult(
+					ctx, clientRepositoryPrediction, input, predictionRaw, string(diagramPrediction), variant,
+					usageTokensPrompt, usageTokensCompletions,
+				),
 			); err != nil {
-				// FIXME: add proper logging
-				log.Printf("clientRepositoryPrediction.WriteModelResult err: %+v", err)
+				return nil, err
 			}
 		}
 
@@ -100,38 +470,317 @@ func NewC4ContainersHTTPHandler(
 			return nil, err
 		}
 
-		var diagramGraph c4ContainersGraph
-		if err := json.Unmarshal(diagramPrediction, &diagramGraph); err != nil {
+		diagramGraphs, err := unmarshalGraphs(diagramPrediction)
+		if err != nil {
 			return nil, err
 		}
 
-		diagramPostRendering, err := renderDiagram(ctx, httpClient, &diagramGraph)
+		if err := validateDiagramsCount(diagramGraphs, input.GetComplexityLimits()); err != nil {
+			return nil, err
+		}
+		for _, diagramGraph := range diagramGraphs {
+			if err := validateComplexity(diagramGraph, input.GetComplexityLimits()); err != nil {
+				return nil, err
+			}
+		}
+
+		autoTitle(ctx, cfg, input, prompt, diagramGraphs)
+
+		start = time.Now()
+		diagramsPostRendering, warnings, err := renderDiagrams(
+			ctx, httpClient, diagramGraphs, input.GetComplexityLimits(),
+			cfg.applyFeatureFlags(ctx, input.GetUserID()).applyBranding(branding(input)),
+		)
 		if err != nil {
 			return nil, err
 		}
+		cfg.Logger.Debug(
+			"diagram rendering", logFields(
+				input, logger.Fields{"duration_ms": time.Since(start).Milliseconds(), "diagrams": len(diagramGraphs)},
+			),
+		)
 
 		if clientRepositoryPrediction != nil {
-			if err := clientRepositoryPrediction.WriteSuccessFlag(
-				ctx, input.GetRequestID(), input.GetUserID(), input.GetUserAPIToken(),
+			if err := handleStorageError(
+				ctx, cfg, input, "cannot write success flag",
+				clientRepositoryPrediction.WriteSuccessFlag(
+					ctx, input.GetRequestID(), input.GetUserID(), input.GetUserAPIToken(),
+				),
 			); err != nil {
-				// FIXME: add proper logging
-				log.Printf("clientRepositoryPrediction.WriteSuccessFlag err: %+v", err)
+				return nil, err
 			}
 		}
 
-		return diagram.NewResultSVG(diagramPostRendering)
-
+		o, err := diagram.NewResultSVGs(diagramsPostRendering, warnings...)
+		if err != nil {
+			return nil, err
+		}
+		if o, err = withGraphs(o, input, diagramGraphs); err != nil {
+			return nil, err
+		}
+		return diagram.WithModel(o, modelName(clientModelInference, variant.Model), cfg.Version), nil
 	}, nil
 }
 
+// logFields adds the request's metadata to the log fields.
+func logFields(input diagram.Input, fields logger.Fields) logger.Fields {
+	fields["request_id"] = input.GetRequestID()
+	fields["user_id"] = input.GetUserID()
+	return fields
+}
+
+// renderDiagrams transforms and renders the SVG diagrams using the svg renderer of the request's config,
+// see WithRenderer, and defines the warnings about them. The graphs are replaced with the transformed ones,
+// see WithGraphTransformer, the transformed graphs are validated against the limits.
+// The rendering stops once the context is cancelled, e.g. when the client disconnects,
+// to avoid calling the PlantUML server for the result nobody waits for.
+func renderDiagrams(
+	ctx context.Context, httpClient diagram.HTTPClient, diagramGraphs []*c4ContainersGraph,
+	limits diagram.ComplexityLimits, cfg renderingConfig,
+) ([][]byte, []string, error) {
+	renderer, ok := renderers(httpClient, cfg)[FormatSVG]
+	if !ok {
+		return nil, nil, errors.New("svg renderer must be provided")
+	}
+
+	var warnings []string
+	o := make([][]byte, len(diagramGraphs))
+	for i, diagramGraph := range diagramGraphs {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		diagramGraph, err := transformGraph(ctx, cfg.GraphTransformers, diagramGraph, limits)
+		if err != nil {
+			return nil, nil, err
+		}
+		diagramGraphs[i] = diagramGraph
+
+		rendered, err := renderer.Render(ctx, *diagramGraph)
+		if err != nil {
+			return nil, nil, err
+		}
+		svg, ok := rendered.(diagram.OutputSVG)
+		if !ok {
+			return nil, nil, errors.New("svg renderer must return the svg diagram")
+		}
+		o[i] = svg.RawSVG()
+		warnings = append(warnings, nodesDegreeWarnings(diagramGraph, cfg.MaxNodeDegree)...)
+		warnings = append(warnings, cyclesWarnings(diagramGraph, cfg.DetectCycles)...)
+		warnings = append(warnings, orphanNodesWarnings(diagramGraph, cfg.DetectOrphanNodes)...)
+		warnings = append(warnings, selfLinksWarnings(diagramGraph, cfg.DetectSelfLinks)...)
+	}
+	return o, warnings, nil
+}
+
+// writeInputPrompt records the prompt along with the client's metadata, see diagram.InputClient.
+// The metadata is only recorded if the repository supports it, see diagram.RepositoryPredictionWithClient.
+func writeInputPrompt(
+	ctx context.Context, repository diagram.RepositoryPrediction, input diagram.Input, prompt string,
+) error {
+	v, ok := repository.(diagram.RepositoryPredictionWithClient)
+	if in, okInput := input.(diagram.InputClient); ok && okInput {
+		client := in.GetClient()
+		return v.WriteInputPromptWithClient(
+			ctx, input.GetRequestID(), input.GetUserID(), prompt, client.UserAgent, client.Version,
+		)
+	}
+	return repository.WriteInputPrompt(ctx, input.GetRequestID(), input.GetUserID(), prompt)
+}
+
+// predict calls the variant's model with the variant's system prompt to define the diagram's graph,
+// see experimentVariant. The regenerated diagram is sampled with the higher temperature,
+// and the model is instructed to provide the alternative graph to vary the output, see diagram.InputRegeneration.
+// The temperature is only set if the client supports it, see diagram.ModelInferenceWithTemperature.
+func predict(
+	ctx context.Context, clientModelInference diagram.ModelInference, prompt string, regeneration int,
+	variant diagram.Variant,
+) (
+	predictionRaw string, prediction []byte, usageTokensPrompt uint16, usageTokensCompletions uint16, err error,
+) {
+	instruction, temperature := systemContent(variant, regeneration), temperatureDefault
+	if regeneration > 0 {
+		temperature = temperatureRegeneration(regeneration)
+	}
+
+	if v, ok := clientModelInference.(diagram.ModelInferenceWithTemperature); ok {
+		return v.DoWithTemperature(ctx, prompt, instruction, variant.Model, temperature)
+	}
+	return clientModelInference.Do(ctx, prompt, instruction, variant.Model)
+}
+
+// systemContent defines the variant's system prompt, the regenerated diagram's prompt instructs the model
+// to provide the alternative graph.
+func systemContent(variant diagram.Variant, regeneration int) string {
+	if regeneration > 0 {
+		return variant.SystemContent + contentRegeneration
+	}
+	return variant.SystemContent
+}
+
+const (
+	temperatureDefault float32 = 0.2
+	// temperatureStep the temperature increase per regeneration.
+	temperatureStep float32 = 0.3
+	temperatureMax  float32 = 1
+)
+
+// temperatureRegeneration defines the temperature increasing with every regeneration up to temperatureMax.
+func temperatureRegeneration(regeneration int) float32 {
+	o := temperatureDefault + temperatureStep*float32(regeneration)
+	if o > temperatureMax {
+		return temperatureMax
+	}
+	return o
+}
+
+// branding returns the tenant's branding of the diagram, see diagram.InputBranding.
+func branding(input diagram.Input) diagram.Branding {
+	if v, ok := input.(diagram.InputBranding); ok {
+		return v.GetBranding()
+	}
+	return diagram.Branding{}
+}
+
+// regeneration defines the number of the diagram's regenerations, see diagram.InputRegeneration.
+func regeneration(input diagram.Input) int {
+	if v, ok := input.(diagram.InputRegeneration); ok {
+		return v.GetRegeneration()
+	}
+	return 0
+}
+
+// withGraphs adds the rendered graphs to the output if the input requests them, see diagram.InputGraph.
+func withGraphs(o diagram.Output, input diagram.Input, diagramGraphs []*c4ContainersGraph) (diagram.Output, error) {
+	if v, ok := input.(diagram.InputGraph); !ok || !v.GetIncludeGraph() {
+		return o, nil
+	}
+
+	graphs := make([]json.RawMessage, len(diagramGraphs))
+	for i, diagramGraph := range diagramGraphs {
+		var err error
+		if graphs[i], err = json.Marshal(diagramGraph); err != nil {
+			return nil, errors.New(err.Error())
+		}
+	}
+	return diagram.WithGraphs(o, graphs), nil
+}
+
+// modelName defines the name of the model serving the request, see diagram.ModelNamer.
+func modelName(clientModelInference diagram.ModelInference, model string) string {
+	if v, ok := clientModelInference.(diagram.ModelNamer); ok {
+		return v.ModelName(model)
+	}
+	return model
+}
+
+func preprocessPrompt(ctx context.Context, preprocessor diagram.PromptPreprocessor, prompt string) (string, error) {
+	if preprocessor == nil {
+		return prompt, nil
+	}
+	o, err := preprocessor.Process(ctx, prompt)
+	if err != nil {
+		return "", errors.New(err.Error())
+	}
+	return o, nil
+}
+
+func moderatePrompt(ctx context.Context, moderators []diagram.Moderator, prompt string) error {
+	for _, moderator := range moderators {
+		flagged, err := moderator.IsFlagged(ctx, prompt)
+		if err != nil {
+			return errors.New(err.Error())
+		}
+		if flagged {
+			return errors.HTTPHandlerError{
+				Msg:      "prompt rejected",
+				Type:     "moderation",
+				HTTPCode: http.StatusUnprocessableEntity,
+			}
+		}
+	}
+	return nil
+}
+
+// Format defines the format of the rendered diagram.
+type Format string
+
+const (
+	FormatSVG Format = "svg"
+	FormatPNG Format = "png"
+	// FormatPDF defines the PDF diagram, see WithPDFConverter for details.
+	FormatPDF Format = "pdf"
+	// FormatDSL defines the diagram as C4-PlantUML code, it is rendered without calling the PlantUML server.
+	FormatDSL Format = "dsl"
+)
+
+// PredictGraph defines the diagram's JSON-encoded graph given the prompt using the model.
+func PredictGraph(
+	ctx context.Context, clientModelInference diagram.ModelInference, prompt string,
+) ([]byte, error) {
+	if clientModelInference == nil {
+		return nil, errors.New("model inference client must be provided")
+	}
+
+	_, diagramPrediction, _, _, err := clientModelInference.Do(ctx, prompt, contentSystem, model)
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+
+	if err := errors.NewPredictionError(diagramPrediction); err != nil {
+		return nil, err
+	}
+
+	return diagramPrediction, nil
+}
+
+// Render renders the diagram given its JSON-encoded graph in the requested format using the renderer
+// of the format, see WithRenderer. The http client is only required to render svg, png and pdf.
+func Render(
+	ctx context.Context, httpClient diagram.HTTPClient, graph []byte, format Format, fnOps ...HandlerOps,
+) ([]byte, error) {
+	cfg := defaultRenderingConfig()
+	for _, fn := range fnOps {
+		fn(&cfg)
+	}
+
+	var v c4ContainersGraph
+	if err := json.Unmarshal(graph, &v); err != nil {
+		return nil, errors.New(err.Error())
+	}
+
+	diagramGraph, err := transformGraph(ctx, cfg.GraphTransformers, &v, diagram.ComplexityLimits{})
+	if err != nil {
+		return nil, err
+	}
+
+	renderer, ok := renderers(httpClient, cfg)[format]
+	if !ok {
+		return nil, errors.New("unsupported format " + string(format))
+	}
+	o, err := renderer.Render(ctx, *diagramGraph)
+	if err != nil {
+		return nil, err
+	}
+	return o.Serialize()
+}
+
 const model = "gpt-3.5-turbo"
 
+// contentRegeneration the instruction to vary the output when the diagram is regenerated.
+const contentRegeneration = "\n" + `The user was not satisfied with the previous graph for the prompt.` +
+	`Provide an alternative layout: change the layout, the links' directions and the nodes grouping,` +
+	`but keep the nodes and links described in the prompt.`
+
 const contentSystem =
 // instruction
 `Given prompts and corresponding graphs as json define new graph based on new prompt.` +
 	`Every node has id,label,group,technology as strings, and external,queue,database,user as bool.` +
-	`Every link connects nodes using their id:from,to. It also has label,technology and direction as strings.` +
-	`Every json has title and footer as string.` +
+	`Every link connects nodes using their id:from,to. It also has label,technology and direction as strings,` +
+	`and async as bool.` +
+	`Every json has title and footer as string, optional layout as top-down or left-right,` +
+	`and optional style as sketch for draft diagrams or landscape.` +
+	`If prompt describes several diagrams, output {"diagrams":[{{graph}},{{graph}}]}.` +
 	`Output JSON. If error, return {"error": {{detailed decision explanation}} }` + "\n" +
 
 	// example
@@ -188,6 +837,14 @@ const contentSystem =
 	`"links":[{"from":"0","to":"1","label":"Uses","technology":"HTTP","direction":"LR"},` +
 	`{"from":"1","to":"2","label":"Uses","technology":"HTTP","direction":"LR"}]}` +
 
+	// example
+	`two diagrams: go backend reading from postgres, and user calling the go backend` + "\n" +
+	`{"diagrams":[{"nodes":[{"id":"0","label":"Backend","technology":"Go"},` +
+	`{"id":"1","label":"Database","technology":"Postgres","database":true}],` +
+	`"links":[{"from":"0","to":"1","label":"reads from database","technology":"TCP"}]},` +
+	`{"nodes":[{"id":"0","label":"User","user":true},{"id":"1","label":"Backend","technology":"Go"}],` +
+	`"links":[{"from":"0","to":"1","label":"Calls","technology":"HTTP"}]}]}` + "\n" +
+
 	// example
 	`anna calls bob` + "\n" +
 	`{"nodes":[{"id":"0","label":"Anna","user":true},{"id":"1","label":"Bob","user":true}],` +
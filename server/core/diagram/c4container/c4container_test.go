@@ -1,18 +1,22 @@
 package c4container
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
+	"path"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/kislerdm/diagramastext/server/core/diagram"
 	diagramErrors "github.com/kislerdm/diagramastext/server/core/errors"
+	"github.com/kislerdm/diagramastext/server/core/logger"
 )
 
 const placeholderUserID = "00000000-0000-0000-0000-000000000000"
@@ -24,12 +28,14 @@ func TestNewC4ContainersHandlerInitHappyPath(t *testing.T) {
 		httpClient                 diagram.HTTPClient
 	}
 
+	const mockModel = "gpt-mock-0613"
+
 	mustNewResult := func(v []byte) diagram.Output {
-		o, err := diagram.NewResultSVG(v)
+		o, err := diagram.NewResultSVGs([][]byte{v})
 		if err != nil {
 			panic(err)
 		}
-		return o
+		return diagram.WithModel(o, mockModel, "")
 	}
 
 	tests := []struct {
@@ -43,7 +49,8 @@ func TestNewC4ContainersHandlerInitHappyPath(t *testing.T) {
 			name: "happy path",
 			args: args{
 				clientModelInference: diagram.MockModelInference{
-					V: []byte(`{"nodes":[{"id":"0"}]}`),
+					Model: mockModel,
+					V:     []byte(`{"nodes":[{"id":"0"}]}`),
 				},
 				clientRepositoryPrediction: diagram.MockRepositoryPrediction{},
 				httpClient: diagram.MockHTTPClient{
@@ -124,7 +131,7 @@ func TestNewC4ContainersHandlerInitHappyPath(t *testing.T) {
 				UserID: placeholderUserID,
 			},
 			want:    nil,
-			wantErr: errors.New("diagram/c4container/c4container.go:86: foobar"),
+			wantErr: errors.New("diagram/c4container/c4container.go:445: foobar"),
 		},
 		{
 			name: "unhappy path: failed to predict",
@@ -174,7 +181,7 @@ func TestNewC4ContainersHandlerInitHappyPath(t *testing.T) {
 				UserID: placeholderUserID,
 			},
 			want:    nil,
-			wantErr: errors.New("diagram/c4container/plantuml.go:41: foobar"),
+			wantErr: errors.New("diagram/c4container/plantuml.go:214: foobar"),
 		},
 	}
 
@@ -234,7 +241,7 @@ func TestNewC4ContainersHandlerInitUnhappyPath(t *testing.T) {
 			}
 
 			if err == nil || err.Error() !=
-				"diagram/c4container/c4container.go:63: model inference client must be provided" {
+				"diagram/c4container/c4container.go:398: model inference client must be provided" {
 				t.Fatalf("unexpected error")
 			}
 		},
@@ -255,7 +262,7 @@ func TestNewC4ContainersHandlerInitUnhappyPath(t *testing.T) {
 				t.Fatalf("unexpected client")
 			}
 
-			if err == nil || err.Error() != "diagram/c4container/c4container.go:66: http client must be provided" {
+			if err == nil || err.Error() != "diagram/c4container/c4container.go:401: http client must be provided" {
 				t.Fatalf("unexpected error")
 			}
 		},
@@ -391,7 +398,684 @@ func Test_UnmarshalGraph(t *testing.T) {
 	)
 }
 
+func Test_unmarshalGraphs(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []*c4ContainersGraph
+		wantErr bool
+	}{
+		{
+			name: "single graph",
+			data: `{"nodes":[{"id":"0"}]}`,
+			want: []*c4ContainersGraph{{Containers: []*container{{ID: "0"}}, WithLegend: true}},
+		},
+		{
+			name: "two graphs",
+			data: `{"diagrams":[{"nodes":[{"id":"0"}]},{"nodes":[{"id":"1"}],"legend":false}]}`,
+			want: []*c4ContainersGraph{
+				{Containers: []*container{{ID: "0"}}, WithLegend: true},
+				{Containers: []*container{{ID: "1"}}},
+			},
+		},
+		{
+			name:    "faulty prediction",
+			data:    `{"diagrams":[{"nodes":"0"}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := unmarshalGraphs([]byte(tt.data))
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("unmarshalGraphs() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("unmarshalGraphs() got = %s, want = %s", mustMarshal(got), mustMarshal(tt.want))
+				}
+			},
+		)
+	}
+}
+
+func TestNewC4ContainersHTTPHandlerMultipleDiagrams(t *testing.T) {
+	// GIVEN
+	svgs := []string{
+		`<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+			`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`,
+		`<svg xmlns="http://www.w3.org/2000/svg" height="20px" width="20px" viewBox="0 0 20 20">` +
+			`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`,
+	}
+
+	var cntRequests int
+	handler, err := NewC4ContainersHTTPHandler(
+		diagram.MockModelInference{
+			V: []byte(`{"diagrams":[{"nodes":[{"id":"0"}]},{"nodes":[{"id":"0"},{"id":"1"}]}]}`),
+		},
+		nil,
+		mockHTTPClientFn(
+			func(_ *http.Request) (*http.Response, error) {
+				o := &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader(svgs[cntRequests])),
+				}
+				cntRequests++
+				return o, nil
+			},
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// WHEN
+	got, err := handler(
+		context.TODO(), diagram.MockInput{Prompt: "foobar", RequestID: "xxxx", UserID: placeholderUserID},
+	)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotSVGs := got.(diagram.OutputSVGs).RawSVGs()
+	if len(gotSVGs) != len(svgs) {
+		t.Fatalf("unexpected number of diagrams: %d", len(gotSVGs))
+	}
+	for i, want := range svgs {
+		if string(gotSVGs[i]) != want {
+			t.Errorf("unexpected diagram %d: got = %s, want = %s", i, gotSVGs[i], want)
+		}
+	}
+	if string(got.(diagram.OutputSVG).RawSVG()) != svgs[0] {
+		t.Error("the first diagram is expected as the svg for backward compatibility")
+	}
+}
+
+func TestNewC4ContainersHTTPHandlerDiagramsLimit(t *testing.T) {
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+
+	tests := []struct {
+		name        string
+		diagramsMax int
+		wantErr     bool
+		wantRenders int
+	}{
+		{name: "shall render the diagrams at the limit", diagramsMax: 2, wantRenders: 2},
+		{name: "shall reject the diagrams above the limit before rendering", diagramsMax: 1, wantErr: true},
+		{name: "shall render the diagrams given no limit", wantRenders: 2},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				var renders int
+				handler, err := NewC4ContainersHTTPHandler(
+					diagram.MockModelInference{
+						V: []byte(`{"diagrams":[{"nodes":[{"id":"0"}]},{"nodes":[{"id":"0"},{"id":"1"}]}]}`),
+					},
+					nil,
+					mockHTTPClientFn(
+						func(_ *http.Request) (*http.Response, error) {
+							renders++
+							return &http.Response{
+								StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg)),
+							}, nil
+						},
+					),
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// WHEN
+				_, err = handler(
+					context.TODO(), diagram.MockInput{
+						Prompt: "foobar", UserID: placeholderUserID,
+						Limits: diagram.ComplexityLimits{DiagramsMax: tt.diagramsMax},
+					},
+				)
+
+				// THEN
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				var errHandler diagramErrors.HTTPHandlerError
+				if tt.wantErr && (!errors.As(err, &errHandler) ||
+					errHandler.HTTPCode != http.StatusUnprocessableEntity) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				if renders != tt.wantRenders {
+					t.Errorf("unexpected number of the renders: got = %d, want = %d", renders, tt.wantRenders)
+				}
+			},
+		)
+	}
+}
+
+func TestNewC4ContainersHTTPHandlerBranding(t *testing.T) {
+	// GIVEN
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+
+	// the PlantUML server mock records the diagram's code
+	var gotCode string
+	httpClient := mockHTTPClientFn(
+		func(req *http.Request) (*http.Response, error) {
+			var err error
+			if gotCode, err = decodePlantUMLRequest(path.Base(req.URL.Path)); err != nil {
+				return nil, err
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg))}, nil
+		},
+	)
+	handler, err := NewC4ContainersHTTPHandler(
+		diagram.MockModelInference{V: []byte(`{"nodes":[{"id":"0"}]}`)}, nil, httpClient,
+		WithDefaultFooter("generated by foo.bar"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		branding  diagram.Branding
+		wantCode  []string
+		wantTheme bool
+	}{
+		{
+			name:     "default tenant",
+			wantCode: []string{`footer "generated by foo.bar"`},
+		},
+		{
+			name:      "tenant acme",
+			branding:  diagram.Branding{DefaultFooter: "generated by acme", Theme: "cerulean"},
+			wantCode:  []string{`footer "generated by acme"`, "!theme cerulean"},
+			wantTheme: true,
+		},
+		{
+			name:     "tenant qux",
+			branding: diagram.Branding{DefaultFooter: "generated by qux"},
+			wantCode: []string{`footer "generated by qux"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			"shall render the diagram given the branding of the "+tt.name, func(t *testing.T) {
+				// WHEN
+				_, err := handler(
+					context.TODO(), diagram.MockInput{Prompt: "foobar", UserID: placeholderUserID, Branding: tt.branding},
+				)
+
+				// THEN
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, want := range tt.wantCode {
+					if !strings.Contains(gotCode, "\n"+want+"\n") {
+						t.Errorf("the diagram shall contain %s, got: %s", want, gotCode)
+					}
+				}
+				if strings.Contains(gotCode, "!theme") != tt.wantTheme {
+					t.Errorf("unexpected theme, got: %s", gotCode)
+				}
+			},
+		)
+	}
+}
+
+func TestNewC4ContainersHTTPHandlerWithVersion(t *testing.T) {
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+
+	httpClient := mockHTTPClientFn(
+		func(_ *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg))}, nil
+		},
+	)
+
+	tests := []struct {
+		name                 string
+		clientModelInference diagram.ModelInference
+		wantModel            string
+	}{
+		{
+			name:                 "shall report the model's name",
+			clientModelInference: diagram.MockModelInference{Model: "gpt-mock-0613", V: []byte(`{"nodes":[{"id":"0"}]}`)},
+			wantModel:            "gpt-mock-0613",
+		},
+		{
+			name: "shall report the requested model given the client does not report the name",
+			clientModelInference: mockModelInferenceFn(
+				func(_ string) ([]byte, error) {
+					return []byte(`{"nodes":[{"id":"0"}]}`), nil
+				},
+			),
+			wantModel: model,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				handler, err := NewC4ContainersHTTPHandler(tt.clientModelInference, nil, httpClient, WithVersion("v1.0.0"))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// WHEN
+				got, err := handler(context.TODO(), diagram.MockInput{Prompt: "foobar", UserID: placeholderUserID})
+
+				// THEN
+				if err != nil {
+					t.Fatal(err)
+				}
+				o := got.(diagram.OutputModel)
+				if o.GetModel() != tt.wantModel {
+					t.Errorf("unexpected model: got = %s, want = %s", o.GetModel(), tt.wantModel)
+				}
+				if o.GetVersion() != "v1.0.0" {
+					t.Errorf("unexpected version: %s", o.GetVersion())
+				}
+			},
+		)
+	}
+}
+
+func TestNewC4ContainersHTTPHandlerCancelledContext(t *testing.T) {
+	// GIVEN
+	ctx, cancel := context.WithCancel(context.TODO())
+
+	// the client disconnects while the model generates the prediction
+	clientModelInference := mockModelInferenceFn(
+		func(_ string) ([]byte, error) {
+			cancel()
+			return []byte(`{"nodes":[{"id":"0"}]}`), nil
+		},
+	)
+
+	var cntRenderRequests int
+	httpClient := mockHTTPClientFn(
+		func(_ *http.Request) (*http.Response, error) {
+			cntRenderRequests++
+			return nil, errors.New("unexpected call")
+		},
+	)
+
+	handler, err := NewC4ContainersHTTPHandler(clientModelInference, nil, httpClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// WHEN
+	_, err = handler(ctx, diagram.MockInput{Prompt: "foobar", UserID: placeholderUserID})
+
+	// THEN
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("context.Canceled error expected, got: %v", err)
+	}
+	if cntRenderRequests != 0 {
+		t.Errorf("the diagram shall not be rendered, got %d calls", cntRenderRequests)
+	}
+}
+
+func TestNewC4ContainersHTTPHandlerTracing(t *testing.T) {
+	// GIVEN
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+
+	tracer := &diagram.MockTracer{}
+	ctx, end := tracer.Start(context.TODO(), "request")
+
+	var gotTraceHeader string
+	handler, err := NewC4ContainersHTTPHandler(
+		diagram.NewTracingModelInference(diagram.MockModelInference{V: []byte(`{"nodes":[{"id":"0"}]}`)}, tracer),
+		diagram.NewTracingRepositoryPrediction(diagram.MockRepositoryPrediction{}, tracer),
+		diagram.NewTracingHTTPClient(
+			mockHTTPClientFn(
+				func(req *http.Request) (*http.Response, error) {
+					gotTraceHeader = req.Header.Get("traceparent")
+					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg))}, nil
+				},
+			), tracer, "plantuml",
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// WHEN
+	_, err = handler(ctx, diagram.MockInput{Prompt: "foobar", UserID: placeholderUserID})
+	end(err)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []diagram.MockSpan{
+		{Name: "request", Ended: true},
+		{Name: "repository.write_input_prompt", Parent: "request", Ended: true},
+		{Name: "model_inference", Parent: "request", Ended: true},
+		{Name: "repository.write_model_result", Parent: "request", Ended: true},
+		{Name: "plantuml", Parent: "request", Ended: true},
+		{Name: "repository.write_success_flag", Parent: "request", Ended: true},
+	}
+	if !reflect.DeepEqual(tracer.Spans, want) {
+		t.Errorf("unexpected spans: got = %+v, want = %+v", tracer.Spans, want)
+	}
+	if gotTraceHeader != "plantuml" {
+		t.Errorf("span context shall be propagated to PlantUML, got: %s", gotTraceHeader)
+	}
+}
+
+func TestNewC4ContainersHTTPHandlerLogging(t *testing.T) {
+	// GIVEN
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+
+	l := &logger.MockLogger{}
+	handler, err := NewC4ContainersHTTPHandler(
+		diagram.MockModelInference{V: []byte(`{"nodes":[{"id":"0"}]}`)},
+		diagram.MockRepositoryPrediction{Err: errors.New("foo")},
+		mockHTTPClientFn(
+			func(_ *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg))}, nil
+			},
+		),
+		WithLogger(l),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// WHEN
+	if _, err := handler(
+		context.TODO(), diagram.MockInput{Prompt: "foobar", RequestID: "bar", UserID: placeholderUserID},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// THEN
+	var cntDebug, cntWarn int
+	for _, record := range l.Records {
+		if record.Fields["request_id"] != "bar" || record.Fields["user_id"] != placeholderUserID {
+			t.Errorf("request's metadata expected, got: %+v", record.Fields)
+		}
+		switch record.Level {
+		case logger.LevelDebug:
+			cntDebug++
+			if _, ok := record.Fields["duration_ms"]; !ok {
+				t.Errorf("debug record %s shall include timing", record.Msg)
+			}
+		case logger.LevelWarn:
+			cntWarn++
+		}
+	}
+	if cntDebug != 2 {
+		t.Errorf("the model inference and the rendering shall be logged, got: %+v", l.Records)
+	}
+	if cntWarn != 3 {
+		t.Errorf("the repository's errors shall be logged, got: %+v", l.Records)
+	}
+}
+
+func TestNewC4ContainersHTTPHandlerRegeneration(t *testing.T) {
+	// GIVEN
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+
+	var temperatures []float32
+	handler, err := NewC4ContainersHTTPHandler(
+		diagram.MockModelInference{V: []byte(`{"nodes":[{"id":"0"}]}`), Temperatures: &temperatures},
+		nil,
+		mockHTTPClientFn(
+			func(_ *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg))}, nil
+			},
+		),
+		WithLogger(logger.NewNoopLogger()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// WHEN
+	for regeneration := 0; regeneration < 5; regeneration++ {
+		if _, err := handler(
+			context.TODO(), diagram.MockInput{Prompt: "foobar", UserID: placeholderUserID, Regeneration: regeneration},
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// THEN
+	if len(temperatures) != 5 {
+		t.Fatalf("unexpected model calls: %v", temperatures)
+	}
+	for i := 1; i < len(temperatures); i++ {
+		if temperatures[i] <= temperatures[0] {
+			t.Errorf("regeneration shall pass the higher temperature than the initial call, got: %v", temperatures)
+		}
+		if temperatures[i] < temperatures[i-1] || temperatures[i] > temperatureMax {
+			t.Errorf("temperature shall increase up to %v, got: %v", temperatureMax, temperatures)
+		}
+	}
+}
+
+func Test_predict(t *testing.T) {
+	// GIVEN
+	var gotSystemContent []string
+	client := mockModelInferenceSystemContentFn(
+		func(systemContent string) {
+			gotSystemContent = append(gotSystemContent, systemContent)
+		},
+	)
+
+	// WHEN
+	variant := experimentVariant(context.TODO(), nil, "bar")
+	_, _, _, _, _ = predict(context.TODO(), client, "foo", 0, variant)
+	_, _, _, _, _ = predict(context.TODO(), client, "foo", 1, variant)
+
+	// THEN
+	if want := []string{contentSystem, contentSystem + contentRegeneration}; !reflect.DeepEqual(
+		gotSystemContent, want,
+	) {
+		t.Errorf("the regeneration shall instruct the model to provide the alternative layout, got: %v",
+			gotSystemContent)
+	}
+}
+
+type mockModelInferenceSystemContentFn func(systemContent string)
+
+func (m mockModelInferenceSystemContentFn) Do(_ context.Context, _, systemContent, _ string) (
+	string, []byte, uint16, uint16, error,
+) {
+	m(systemContent)
+	return "", nil, 0, 0, nil
+}
+
+func TestNewC4ContainersHTTPHandlerWithGraph(t *testing.T) {
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+
+	httpClient := mockHTTPClientFn(
+		func(_ *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg))}, nil
+		},
+	)
+	handler, err := NewC4ContainersHTTPHandler(
+		diagram.MockModelInference{
+			V: []byte(`{"nodes":[{"id":"0","label":"Backend","technology":"Go"},{"id":"1","database":true}],` +
+				`"links":[{"from":"0","to":"1","async":true}],"title":"foo","legend":false}`),
+		},
+		nil, httpClient, WithLogger(logger.NewNoopLogger()), WithGraphTransformer(upperCaseLabels),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run(
+		"shall round-trip the rendered graph", func(t *testing.T) {
+			// WHEN
+			o, err := handler(
+				context.TODO(), diagram.MockInput{Prompt: "foobar", UserID: placeholderUserID, IncludeGraph: true},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			graphs := o.(diagram.OutputGraphs).GetGraphs()
+			if len(graphs) != 1 {
+				t.Fatalf("unexpected graphs: %s", graphs)
+			}
+			var got DiagramGraph
+			if err := json.Unmarshal(graphs[0], &got); err != nil {
+				t.Fatal(err)
+			}
+			want := DiagramGraph{
+				Containers: []*Container{
+					{ID: "0", Label: "BACKEND", Technology: "Go"},
+					{ID: "1", IsDatabase: true},
+				},
+				Rels:  []*Relation{{From: "0", To: "1", IsAsync: true}},
+				Title: "foo",
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected graph: got = %s", graphs[0])
+			}
+
+			// the edited graph can be re-rendered
+			dsl, err := Render(context.TODO(), nil, graphs[0], FormatDSL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(dsl), `"BACKEND"`) || strings.Contains(string(dsl), "SHOW_LEGEND") {
+				t.Errorf("unexpected DSL: %s", dsl)
+			}
+		},
+	)
+
+	t.Run(
+		"shall not include the graph by default", func(t *testing.T) {
+			// WHEN
+			o, err := handler(context.TODO(), diagram.MockInput{Prompt: "foobar", UserID: placeholderUserID})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			if got := o.(diagram.OutputGraphs).GetGraphs(); got != nil {
+				t.Errorf("no graphs expected, got: %s", got)
+			}
+		},
+	)
+}
+
+type mockModelInferenceFn func(prompt string) ([]byte, error)
+
+func (m mockModelInferenceFn) Do(_ context.Context, prompt, _, _ string) (string, []byte, uint16, uint16, error) {
+	o, err := m(prompt)
+	return string(o), o, 0, 0, err
+}
+
+func TestNewC4ContainersHTTPHandlerWithPromptPreprocessor(t *testing.T) {
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+
+	httpClient := mockHTTPClientFn(
+		func(_ *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg))}, nil
+		},
+	)
+
+	t.Run(
+		"shall redact the email before the model call and storing the prompt", func(t *testing.T) {
+			// GIVEN
+			const want = "user [REDACTED] calls go backend"
+
+			var gotModelPrompt string
+			repository := &mockRepositoryPrediction{}
+			handler, err := NewC4ContainersHTTPHandler(
+				mockModelInferenceFn(
+					func(prompt string) ([]byte, error) {
+						gotModelPrompt = prompt
+						return []byte(`{"nodes":[{"id":"0"}]}`), nil
+					},
+				),
+				repository, httpClient, WithPromptPreprocessor(diagram.NewRegexpRedactor()),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			_, err = handler(
+				context.TODO(), diagram.MockInput{
+					Prompt: "user john.doe@example.com calls go backend", RequestID: "xxxx", UserID: placeholderUserID,
+				},
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotModelPrompt != want {
+				t.Errorf("unexpected prompt sent to the model: got = %s, want = %s", gotModelPrompt, want)
+			}
+			if repository.InputPrompt != want {
+				t.Errorf("unexpected prompt stored: got = %s, want = %s", repository.InputPrompt, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail without calling the model if the preprocessor fails", func(t *testing.T) {
+			// GIVEN
+			handler, err := NewC4ContainersHTTPHandler(
+				mockModelInferenceFn(
+					func(_ string) ([]byte, error) {
+						t.Error("the model shall not be called")
+						return nil, nil
+					},
+				),
+				nil, httpClient,
+				WithPromptPreprocessor(
+					mockPromptPreprocessorFn(
+						func(_ string) (string, error) {
+							return "", errors.New("foo")
+						},
+					),
+				),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			_, err = handler(
+				context.TODO(), diagram.MockInput{Prompt: "foobar", RequestID: "xxxx", UserID: placeholderUserID},
+			)
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
+
+type mockPromptPreprocessorFn func(prompt string) (string, error)
+
+func (m mockPromptPreprocessorFn) Process(_ context.Context, prompt string) (string, error) {
+	return m(prompt)
+}
+
 type mockRepositoryPrediction struct {
+	InputPrompt            string
 	InputPromptWritten     uint8
 	ModelPredictionWritten uint8
 	SuccessFlagWritten     uint8
@@ -403,7 +1087,8 @@ func (m *mockRepositoryPrediction) GetDailySuccessfulResultsTimestampsByUserID(
 	return nil, nil
 }
 
-func (m *mockRepositoryPrediction) WriteInputPrompt(_ context.Context, _, _, _ string) error {
+func (m *mockRepositoryPrediction) WriteInputPrompt(_ context.Context, _, _, prompt string) error {
+	m.InputPrompt = prompt
 	m.InputPromptWritten++
 	return nil
 }
@@ -422,6 +1107,77 @@ func (m *mockRepositoryPrediction) Close(_ context.Context) error {
 	return nil
 }
 
+func Test_renderingConfig_applyFeatureFlags(t *testing.T) {
+	cfg := defaultRenderingConfig()
+	for _, fn := range []HandlerOps{
+		WithSVGMinification(),
+		WithRelationTechnologyInference(map[string]string{"Go": "HTTP"}),
+	} {
+		fn(&cfg)
+	}
+
+	tests := []struct {
+		name                         string
+		flags                        diagram.FeatureFlags
+		wantMinifySVG                bool
+		wantRelationTechnologiesSize int
+	}{
+		{
+			name:                         "no feature flags",
+			flags:                        nil,
+			wantMinifySVG:                true,
+			wantRelationTechnologiesSize: 1,
+		},
+		{
+			name:                         "all features disabled",
+			flags:                        diagram.MockFeatureFlags{},
+			wantMinifySVG:                false,
+			wantRelationTechnologiesSize: 0,
+		},
+		{
+			name:                         "minification enabled",
+			flags:                        diagram.MockFeatureFlags{FeatureSVGMinification: true},
+			wantMinifySVG:                true,
+			wantRelationTechnologiesSize: 0,
+		},
+		{
+			name: "relation technology inference enabled for the user",
+			flags: diagram.NewFeatureFlags(
+				diagram.FeatureFlagsConfig{
+					Users: map[string]map[string]bool{
+						placeholderUserID: {FeatureRelationTechnologyInference: true},
+					},
+				},
+			),
+			wantMinifySVG:                false,
+			wantRelationTechnologiesSize: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				cfg := cfg
+				WithFeatureFlags(tt.flags)(&cfg)
+
+				// WHEN
+				got := cfg.applyFeatureFlags(context.TODO(), placeholderUserID)
+
+				// THEN
+				if got.MinifySVG != tt.wantMinifySVG {
+					t.Errorf("unexpected MinifySVG: got = %v, want = %v", got.MinifySVG, tt.wantMinifySVG)
+				}
+				if len(got.RelationTechnologies) != tt.wantRelationTechnologiesSize {
+					t.Errorf("unexpected RelationTechnologies: %v", got.RelationTechnologies)
+				}
+				if !cfg.MinifySVG || len(cfg.RelationTechnologies) != 1 {
+					t.Error("the handler's config shall not be mutated")
+				}
+			},
+		)
+	}
+}
+
 func TestC4ContainerHandlerRepositoryPredictionPersistence(t *testing.T) {
 	t.Parallel()
 
@@ -594,3 +1350,333 @@ func TestC4ContainerHandlerRepositoryPredictionPersistence(t *testing.T) {
 		},
 	)
 }
+
+func TestPredictGraph(t *testing.T) {
+	t.Run(
+		"shall return the predicted graph", func(t *testing.T) {
+			// GIVEN
+			want := []byte(`{"nodes":[{"id":"0"}]}`)
+
+			// WHEN
+			got, err := PredictGraph(context.TODO(), diagram.MockModelInference{V: want}, "foo")
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected graph: got = %s, want = %s", got, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail on the prediction error", func(t *testing.T) {
+			// GIVEN
+			clientModelInference := diagram.MockModelInference{V: []byte(`{"error":"foo"}`)}
+
+			// WHEN
+			_, err := PredictGraph(context.TODO(), clientModelInference, "foo")
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
+
+func TestRender(t *testing.T) {
+	graph := []byte(`{"nodes":[{"id":"0"},{"id":"1"}],"links":[{"from":"0","to":"1"}]}`)
+
+	t.Run(
+		"shall render the DSL without the http client", func(t *testing.T) {
+			// WHEN
+			got, err := Render(context.TODO(), nil, graph, FormatDSL)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(got), "@startuml") || !strings.Contains(string(got), `Rel(0, 1, "Uses")`) {
+				t.Errorf("unexpected DSL: %s", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall request the diagram in the given format", func(t *testing.T) {
+			// GIVEN
+			var gotPath string
+			httpClient := mockHTTPClientFn(
+				func(req *http.Request) (*http.Response, error) {
+					gotPath = req.URL.Path
+					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("png"))}, nil
+				},
+			)
+
+			// WHEN
+			got, err := Render(context.TODO(), httpClient, graph, FormatPNG)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "png" {
+				t.Errorf("unexpected output: %s", got)
+			}
+			if !strings.HasPrefix(gotPath, "/plantuml/png/") {
+				t.Errorf("unexpected request path: %s", gotPath)
+			}
+		},
+	)
+
+	t.Run(
+		"shall request pdf from PlantUML if converter is not set", func(t *testing.T) {
+			// GIVEN
+			var gotPath string
+			httpClient := mockHTTPClientFn(
+				func(req *http.Request) (*http.Response, error) {
+					gotPath = req.URL.Path
+					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("pdf"))}, nil
+				},
+			)
+
+			// WHEN
+			got, err := Render(context.TODO(), httpClient, graph, FormatPDF)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "pdf" || !strings.HasPrefix(gotPath, "/plantuml/pdf/") {
+				t.Errorf("unexpected output %s requested from %s", got, gotPath)
+			}
+		},
+	)
+
+	t.Run(
+		"shall convert svg to pdf using the converter", func(t *testing.T) {
+			// GIVEN
+			var gotPath string
+			httpClient := mockHTTPClientFn(
+				func(req *http.Request) (*http.Response, error) {
+					gotPath = req.URL.Path
+					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("<svg/>"))}, nil
+				},
+			)
+			var gotSVG []byte
+			converter := SVGConverterFunc(
+				func(_ context.Context, svg []byte) ([]byte, error) {
+					gotSVG = svg
+					return []byte("pdf"), nil
+				},
+			)
+
+			// WHEN
+			got, err := Render(context.TODO(), httpClient, graph, FormatPDF, WithPDFConverter(converter))
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(gotPath, "/plantuml/svg/") {
+				t.Errorf("svg shall be requested, got: %s", gotPath)
+			}
+			if string(gotSVG) != "<svg/>" || string(got) != "pdf" {
+				t.Errorf("unexpected conversion of %s to %s", gotSVG, got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall rasterize svg to png using the rasterizer", func(t *testing.T) {
+			// GIVEN
+			var gotPath string
+			httpClient := mockHTTPClientFn(
+				func(req *http.Request) (*http.Response, error) {
+					gotPath = req.URL.Path
+					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("<svg/>"))}, nil
+				},
+			)
+			var calls int
+			rasterizer := SVGConverterFunc(
+				func(_ context.Context, svg []byte) ([]byte, error) {
+					calls++
+					return append([]byte("png:"), svg...), nil
+				},
+			)
+
+			// WHEN
+			got, err := Render(context.TODO(), httpClient, graph, FormatPNG, WithPNGRasterizer(rasterizer))
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(gotPath, "/plantuml/svg/") {
+				t.Errorf("svg shall be requested, got: %s", gotPath)
+			}
+			if calls != 1 || string(got) != "png:<svg/>" {
+				t.Errorf("png shall be rasterized from svg, got: %s", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail if the converter fails", func(t *testing.T) {
+			// GIVEN
+			httpClient := mockHTTPClientFn(
+				func(req *http.Request) (*http.Response, error) {
+					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("<svg/>"))}, nil
+				},
+			)
+			converter := SVGConverterFunc(
+				func(_ context.Context, _ []byte) ([]byte, error) {
+					return nil, errors.New("foo")
+				},
+			)
+
+			// WHEN
+			_, err := Render(context.TODO(), httpClient, graph, FormatPDF, WithPDFConverter(converter))
+
+			// THEN
+			if err == nil || !strings.HasSuffix(err.Error(), "cannot convert svg to pdf: foo") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		},
+	)
+
+	t.Run(
+		"shall request the self-hosted PlantUML server", func(t *testing.T) {
+			// GIVEN
+			var gotURL string
+			httpClient := mockHTTPClientFn(
+				func(req *http.Request) (*http.Response, error) {
+					gotURL = req.URL.String()
+					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("svg"))}, nil
+				},
+			)
+
+			// WHEN
+			_, err := Render(
+				context.TODO(), httpClient, graph, FormatSVG, WithPlantUMLBaseURL("http://localhost:8080"),
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(gotURL, "http://localhost:8080/svg/") {
+				t.Errorf("unexpected request URL: %s", gotURL)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail", func(t *testing.T) {
+			tests := []struct {
+				name       string
+				httpClient diagram.HTTPClient
+				graph      []byte
+				format     Format
+			}{
+				{
+					name:   "unsupported format",
+					graph:  graph,
+					format: "jpeg",
+				},
+				{
+					name:   "http client is not set",
+					graph:  graph,
+					format: FormatSVG,
+				},
+				{
+					name:   "faulty graph",
+					graph:  []byte(`{`),
+					format: FormatDSL,
+				},
+			}
+			for _, tt := range tests {
+				t.Run(
+					tt.name, func(t *testing.T) {
+						if _, err := Render(context.TODO(), tt.httpClient, tt.graph, tt.format); err == nil {
+							t.Error("error expected")
+						}
+					},
+				)
+			}
+		},
+	)
+}
+
+type mockHTTPClientFn func(req *http.Request) (*http.Response, error)
+
+func (m mockHTTPClientFn) Do(req *http.Request) (*http.Response, error) {
+	return m(req)
+}
+
+func Test_c4ContainersGraph_MarshalJSON(t *testing.T) {
+	for _, withLegend := range []bool{true, false} {
+		t.Run(
+			"shall round-trip the graph given the legend "+strconv.FormatBool(withLegend), func(t *testing.T) {
+				// GIVEN
+				graph := c4ContainersGraph{Containers: []*container{{ID: "0"}}, WithLegend: withLegend}
+
+				// WHEN
+				got, err := json.Marshal(graph)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// THEN
+				if withLegend == bytes.Contains(got, []byte(`"legend"`)) {
+					t.Errorf("the legend flag shall be encoded only if the legend is disabled, got: %s", got)
+				}
+				var decoded c4ContainersGraph
+				if err := json.Unmarshal(got, &decoded); err != nil {
+					t.Fatal(err)
+				}
+				if decoded.WithLegend != withLegend {
+					t.Errorf("unexpected legend flag: %s", got)
+				}
+			},
+		)
+	}
+}
+
+func Test_renderDiagramsSelfLinksAndCycles(t *testing.T) {
+	// GIVEN
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+	httpClient := mockHTTPClientFn(
+		func(_ *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg))}, nil
+		},
+	)
+	cfg := defaultRenderingConfig()
+	for _, fn := range []HandlerOps{WithCyclesDetection(), WithSelfLinksDetection()} {
+		fn(&cfg)
+	}
+	graph := &c4ContainersGraph{
+		Containers: []*container{{ID: "0"}, {ID: "1"}},
+		Rels:       []*rel{{From: "0", To: "0"}, {From: "0", To: "1"}, {From: "1", To: "0"}},
+	}
+
+	// WHEN
+	_, warnings, err := renderDiagrams(
+		context.TODO(), httpClient, []*c4ContainersGraph{graph}, diagram.ComplexityLimits{}, cfg,
+	)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"circular dependency: 0 -> 1 -> 0",
+		"node 0 links to itself, consider removing the link",
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("the self-link shall be reported once, got: %v", warnings)
+	}
+}
@@ -19,6 +19,8 @@ Author: jyrki.alakuijala@gmail.com (Jyrki Alakuijala)
 
 package compression
 
+import "sync"
+
 const (
 	HASH_SHIFT = 5
 	HASH_MASK  = 32767
@@ -42,11 +44,34 @@ type hash struct {
 	same []uint16 // Amount of repetitions of same byte after this.
 }
 
-// Allocates and initializes all fields of Hash.
-func newHash(a, b byte) (h hash) {
-	h.head = make([]int, 65536)
-	h.prev = make([]uint16, WINDOW_SIZE)
-	h.hashVal = make([]int, WINDOW_SIZE)
+// hashPool keeps the hash tables between the compression iterations and calls
+// because their allocation dominates the compression's memory footprint.
+var hashPool = sync.Pool{
+	New: func() interface{} {
+		h := &hash{
+			head:    make([]int, 65536),
+			prev:    make([]uint16, WINDOW_SIZE),
+			hashVal: make([]int, WINDOW_SIZE),
+		}
+		if HASH_SAME {
+			h.same = make([]uint16, WINDOW_SIZE)
+		}
+		if HASH_SAME_HASH {
+			h.head2 = make([]int, 65536)
+			h.prev2 = make([]uint16, WINDOW_SIZE)
+			h.hashVal2 = make([]int, WINDOW_SIZE)
+		}
+		return h
+	},
+}
+
+// Initializes all fields of Hash using the tables from the pool.
+// The hash must be released once it is no longer used.
+func newHash(a, b byte) *hash {
+	h := hashPool.Get().(*hash)
+	h.val = 0
+	h.val2 = 0
+
 	for i := 0; i < 65536; i++ {
 		h.head[i] = -1 // -1 indicates no head so far.
 	}
@@ -56,13 +81,12 @@ func newHash(a, b byte) (h hash) {
 	}
 
 	if HASH_SAME {
-		h.same = make([]uint16, WINDOW_SIZE)
+		for i := range h.same {
+			h.same[i] = 0
+		}
 	}
 
 	if HASH_SAME_HASH {
-		h.head2 = make([]int, 65536)
-		h.prev2 = make([]uint16, WINDOW_SIZE)
-		h.hashVal2 = make([]int, WINDOW_SIZE)
 		for i := 0; i < 65536; i++ {
 			h.head2[i] = -1
 		}
@@ -76,6 +100,11 @@ func newHash(a, b byte) (h hash) {
 	return h
 }
 
+// Returns the hash tables to the pool.
+func (h *hash) release() {
+	hashPool.Put(h)
+}
+
 // Update the sliding hash value with the given byte. All calls to this function
 // must be made on consecutive input characters. Since the hash value exists out
 // of multiple input bytes, a few warmups with this function are needed initially.
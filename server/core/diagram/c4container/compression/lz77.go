@@ -394,6 +394,7 @@ func (s *BlockState) LZ77Greedy(inStart, inEnd int) (store LZ77Store) {
 	}
 
 	h := newHash(s.block[windowStart], s.block[windowStart+1])
+	defer h.release()
 	for i := windowStart; i < inStart; i++ {
 		h.update(s.block, i, inEnd)
 	}
@@ -402,7 +403,7 @@ func (s *BlockState) LZ77Greedy(inStart, inEnd int) (store LZ77Store) {
 	for i := inStart; i < inEnd; i++ {
 		h.update(s.block, i, inEnd)
 
-		pair := s.findLongestMatch(&h, s.block, i, inEnd, MAX_MATCH, dummySublen[:])
+		pair := s.findLongestMatch(h, s.block, i, inEnd, MAX_MATCH, dummySublen[:])
 		lengthScore := pair.lengthScore()
 
 		if LAZY_MATCHING {
@@ -197,6 +197,7 @@ func (s *BlockState) bestLengths(
 		windowStart = inStart - WINDOW_SIZE
 	}
 	h := newHash(s.block[windowStart], s.block[windowStart+1])
+	defer h.release()
 	for i := windowStart; i < inStart; i++ {
 		h.update(s.block, i, inEnd)
 	}
@@ -235,7 +236,7 @@ func (s *BlockState) bestLengths(
 			}
 		}
 
-		pair := s.findLongestMatch(&h, s.block, i, inEnd, MAX_MATCH, sublen)
+		pair := s.findLongestMatch(h, s.block, i, inEnd, MAX_MATCH, sublen)
 		leng := pair.litLen
 
 		// Literal.
@@ -336,6 +337,7 @@ func (s *BlockState) followPath(
 		windowStart = inStart - WINDOW_SIZE
 	}
 	h := newHash(s.block[windowStart], s.block[windowStart+1])
+	defer h.release()
 	for i := windowStart; i < inStart; i++ {
 		h.update(s.block, i, inEnd)
 	}
@@ -352,7 +354,7 @@ func (s *BlockState) followPath(
 		if length >= MIN_MATCH {
 			// Get the distance by recalculating longest match. The
 			// found length should match the length from the path.
-			pair := s.findLongestMatch(&h, s.block, pos, inEnd, length, nil)
+			pair := s.findLongestMatch(h, s.block, pos, inEnd, length, nil)
 			if pair.litLen != length && length > 2 && pair.litLen > 2 {
 				panic("dummy length is invalid")
 			}
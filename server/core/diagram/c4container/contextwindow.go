@@ -0,0 +1,201 @@
+package c4container
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// contextWindows the maximum number of tokens of the model's prompt and completion.
+var contextWindows = map[string]int{
+	"gpt-3.5-turbo":     4096,
+	"gpt-3.5-turbo-16k": 16384,
+	"gpt-4":             8192,
+	"gpt-4-32k":         32768,
+}
+
+// tokensCompletionReserved the number of tokens of the context window reserved for the model's output.
+const tokensCompletionReserved = 1024
+
+// tokensPerMessage the number of tokens wrapping every message of the chat completion.
+const tokensPerMessage = 3
+
+// Turn defines the prior turn of the conversation: the user's prompt and the graph generated for it.
+type Turn struct {
+	Prompt string
+	// Graph the JSON-encoded graph.
+	Graph string
+}
+
+// ModelContext defines the content sent to the model to generate the diagram.
+type ModelContext struct {
+	// Instruction the system content's instruction followed by the examples.
+	Instruction string
+	// Examples the few-shot examples in the order of importance, the least important examples are trimmed first.
+	Examples []Example
+	// Turns the prior turns of the conversation in the chronological order, the oldest turns are trimmed first.
+	Turns []Turn
+	// Prompt the current user's prompt.
+	Prompt string
+}
+
+// SystemContent returns the instruction followed by the examples, every example is the prompt and the graph
+// on the separate lines.
+func (c ModelContext) SystemContent() string {
+	var o strings.Builder
+	o.WriteString(c.Instruction)
+	for _, e := range c.Examples {
+		o.WriteString("\n" + exampleContent(e))
+	}
+	return o.String()
+}
+
+func exampleContent(e Example) string {
+	return e.Prompt + "\n" + e.Graph
+}
+
+// FitContextWindow trims the least important context to fit the model's context window reserving the tokens
+// for the model's output. The context is trimmed in the following order until it fits:
+//   - the oldest turns of the conversation, except the latest turn;
+//   - the latest turn's prompt;
+//   - the least important examples.
+//
+// The instruction, the current prompt and the latest turn's graph are preserved,
+// hence the error is returned if they do not fit.
+func FitContextWindow(tokenizer diagram.Tokenizer, model string, c ModelContext) (ModelContext, error) {
+	window, ok := contextWindows[model]
+	if !ok {
+		return ModelContext{}, errors.New("unknown context window of the model " + model)
+	}
+
+	tokens, err := countContextTokens(tokenizer, model, c)
+	if err != nil {
+		return ModelContext{}, err
+	}
+
+	limit := window - tokensCompletionReserved
+	o := c
+	o.Examples = append([]Example(nil), c.Examples...)
+	o.Turns = append([]Turn(nil), c.Turns...)
+
+	total := tokens.total()
+	for total > limit && len(o.Turns) > 1 {
+		total -= tokens.turns[0]
+		tokens.turns = tokens.turns[1:]
+		o.Turns = o.Turns[1:]
+	}
+
+	if total > limit && len(o.Turns) == 1 && o.Turns[0].Prompt != "" {
+		total -= tokens.latestTurnPrompt
+		o.Turns[0].Prompt = ""
+	}
+
+	for total > limit && len(o.Examples) > 0 {
+		total -= tokens.examples[len(o.Examples)-1]
+		o.Examples = o.Examples[:len(o.Examples)-1]
+	}
+
+	if total > limit {
+		return ModelContext{}, errors.HTTPHandlerError{
+			Msg: "prompt of " + strconv.Itoa(total) + " tokens exceeds the model's limit of " +
+				strconv.Itoa(limit) + " tokens",
+			Type:     "context_window",
+			HTTPCode: http.StatusUnprocessableEntity,
+		}
+	}
+	return o, nil
+}
+
+// WithContextWindow checks that the request fits the model's context window using the tokenizer before
+// the model is called, see FitContextWindow. The request exceeding the window is rejected with the status code 422
+// without spending the model's tokens. The check is skipped for the models with unknown context window.
+func WithContextWindow(tokenizer diagram.Tokenizer) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.Tokenizer = tokenizer
+	}
+}
+
+// fitContextWindow fits the instruction and the prompt into the model's context window.
+// The few-shot examples are prepended by the model inference client, and the conversation's turns are not sent
+// to the model until the conversational updates are implemented, hence the context is not trimmed, but validated.
+func fitContextWindow(tokenizer diagram.Tokenizer, model, instruction, prompt string) error {
+	if tokenizer == nil {
+		return nil
+	}
+	if _, ok := contextWindows[model]; !ok {
+		return nil
+	}
+	_, err := FitContextWindow(tokenizer, model, ModelContext{Instruction: instruction, Prompt: prompt})
+	return err
+}
+
+// contextTokens the number of tokens of the context's parts including the messages' wrapping.
+type contextTokens struct {
+	// fixed the tokens of the instruction and the current prompt, and of the reply's priming.
+	fixed    int
+	examples []int
+	// turns the tokens of the turns' prompts and graphs.
+	turns []int
+	// latestTurnPrompt the tokens of the latest turn's prompt.
+	latestTurnPrompt int
+}
+
+func (t contextTokens) total() int {
+	o := t.fixed
+	for _, v := range t.examples {
+		o += v
+	}
+	for _, v := range t.turns {
+		o += v
+	}
+	return o
+}
+
+func countContextTokens(tokenizer diagram.Tokenizer, model string, c ModelContext) (contextTokens, error) {
+	count := func(text string) (int, error) {
+		n, err := tokenizer.CountTokens(model, text)
+		if err != nil {
+			return 0, errors.New(err.Error())
+		}
+		return n, nil
+	}
+
+	var o contextTokens
+	for _, text := range []string{c.Instruction, c.Prompt} {
+		n, err := count(text)
+		if err != nil {
+			return contextTokens{}, err
+		}
+		o.fixed += n
+	}
+	// the system and the user's messages, and the reply's priming
+	o.fixed += 3 * tokensPerMessage
+
+	for _, e := range c.Examples {
+		// the example is separated from the preceding content by the new line
+		n, err := count("\n" + exampleContent(e))
+		if err != nil {
+			return contextTokens{}, err
+		}
+		o.examples = append(o.examples, n)
+	}
+
+	for i, turn := range c.Turns {
+		prompt, err := count(turn.Prompt)
+		if err != nil {
+			return contextTokens{}, err
+		}
+		graph, err := count(turn.Graph)
+		if err != nil {
+			return contextTokens{}, err
+		}
+		o.turns = append(o.turns, prompt+graph+2*tokensPerMessage)
+		if i == len(c.Turns)-1 {
+			o.latestTurnPrompt = prompt + tokensPerMessage
+		}
+	}
+	return o, nil
+}
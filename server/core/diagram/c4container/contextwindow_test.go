@@ -0,0 +1,211 @@
+package c4container
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	diagramErrors "github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// words returns the text of n words, i.e. n tokens counted by diagram.MockTokenizer.
+func words(n int) string {
+	return strings.TrimSpace(strings.Repeat("foo ", n))
+}
+
+func TestFitContextWindow(t *testing.T) {
+	// the limit of gpt-3.5-turbo is 4096-1024=3072 tokens,
+	// the messages' wrapping adds 3 tokens per message: system, prompt, reply's priming, turns' prompts and graphs
+	tests := []struct {
+		name    string
+		c       ModelContext
+		want    ModelContext
+		wantErr bool
+	}{
+		{
+			name: "shall not trim the context fitting the window",
+			c: ModelContext{
+				Instruction: words(100),
+				Examples:    []Example{{Prompt: words(10), Graph: words(10)}},
+				Turns:       []Turn{{Prompt: words(10), Graph: words(100)}},
+				Prompt:      words(10),
+			},
+			want: ModelContext{
+				Instruction: words(100),
+				Examples:    []Example{{Prompt: words(10), Graph: words(10)}},
+				Turns:       []Turn{{Prompt: words(10), Graph: words(100)}},
+				Prompt:      words(10),
+			},
+		},
+		{
+			name: "shall trim the oldest turns",
+			c: ModelContext{
+				Instruction: words(100),
+				Turns: []Turn{
+					{Prompt: words(500), Graph: words(500)},
+					{Prompt: words(499), Graph: words(500)},
+					{Prompt: words(498), Graph: words(500)},
+				},
+				Prompt: words(10),
+			},
+			want: ModelContext{
+				Instruction: words(100),
+				Turns:       []Turn{{Prompt: words(499), Graph: words(500)}, {Prompt: words(498), Graph: words(500)}},
+				Prompt:      words(10),
+			},
+		},
+		{
+			name: "shall trim the latest turn's prompt and the least important examples",
+			c: ModelContext{
+				Instruction: words(100),
+				Examples: []Example{
+					{Prompt: words(100), Graph: words(100)},
+					{Prompt: words(100), Graph: words(100)},
+					{Prompt: words(100), Graph: words(100)},
+				},
+				Turns: []Turn{
+					{Prompt: words(500), Graph: words(500)},
+					{Prompt: words(500), Graph: words(2400)},
+				},
+				Prompt: words(10),
+			},
+			want: ModelContext{
+				Instruction: words(100),
+				Examples: []Example{
+					{Prompt: words(100), Graph: words(100)},
+					{Prompt: words(100), Graph: words(100)},
+				},
+				Turns:  []Turn{{Graph: words(2400)}},
+				Prompt: words(10),
+			},
+		},
+		{
+			name: "shall fail if the preserved context does not fit",
+			c: ModelContext{
+				Instruction: words(100),
+				Turns:       []Turn{{Prompt: words(10), Graph: words(2000)}},
+				Prompt:      words(1000),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// WHEN
+				got, err := FitContextWindow(diagram.MockTokenizer{}, "gpt-3.5-turbo", tt.c)
+
+				// THEN
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("FitContextWindow() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("unexpected context: got = %+v, want = %+v", got, tt.want)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"shall fit the trimmed context into the window", func(t *testing.T) {
+			// GIVEN
+			c := ModelContext{
+				Instruction: contentSystem,
+				Examples:    DefaultExamples(),
+				Turns:       []Turn{{Prompt: words(2000), Graph: words(2000)}, {Prompt: words(10), Graph: words(1000)}},
+				Prompt:      words(10),
+			}
+
+			// WHEN
+			got, err := FitContextWindow(diagram.NewApproximateTokenizer(), "gpt-3.5-turbo", c)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			var messages string
+			for _, turn := range got.Turns {
+				messages += turn.Prompt + turn.Graph
+			}
+			tokens, _ := diagram.NewApproximateTokenizer().CountTokens("", got.SystemContent()+messages+got.Prompt)
+			if tokens > contextWindows["gpt-3.5-turbo"]-tokensCompletionReserved {
+				t.Errorf("context of %d tokens does not fit", tokens)
+			}
+			if got.Prompt != c.Prompt || got.Turns[len(got.Turns)-1].Graph != c.Turns[1].Graph {
+				t.Error("the prompt and the latest graph shall be preserved")
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given unknown model", func(t *testing.T) {
+			if _, err := FitContextWindow(diagram.MockTokenizer{}, "foo", ModelContext{}); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the tokenizer error", func(t *testing.T) {
+			_, err := FitContextWindow(
+				diagram.MockTokenizer{Err: errors.New("foo")}, "gpt-3.5-turbo", ModelContext{Prompt: "bar"},
+			)
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
+
+func TestNewC4ContainersHTTPHandlerContextWindow(t *testing.T) {
+	newHandler := func(t *testing.T, calls *int) diagram.HTTPHandler {
+		handler, err := NewC4ContainersHTTPHandler(
+			mockModelInferenceSystemContentFn(func(_ string) { *calls++ }), nil,
+			diagram.MockHTTPClient{}, WithContextWindow(diagram.MockTokenizer{}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return handler
+	}
+
+	t.Run(
+		"shall reject the prompt exceeding the context window before the model call", func(t *testing.T) {
+			// GIVEN
+			var calls int
+			handler := newHandler(t, &calls)
+
+			// WHEN
+			_, err := handler(context.TODO(), diagram.MockInput{Prompt: words(3072), UserID: placeholderUserID})
+
+			// THEN
+			var e diagramErrors.HTTPHandlerError
+			if !errors.As(err, &e) || e.HTTPCode != http.StatusUnprocessableEntity {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if calls != 0 {
+				t.Error("the model shall not be called")
+			}
+		},
+	)
+
+	t.Run(
+		"shall call the model given the prompt fitting the context window", func(t *testing.T) {
+			// GIVEN
+			var calls int
+			handler := newHandler(t, &calls)
+
+			// WHEN
+			_, _ = handler(context.TODO(), diagram.MockInput{Prompt: words(10), UserID: placeholderUserID})
+
+			// THEN
+			if calls != 1 {
+				t.Errorf("the model shall be called once, got: %d", calls)
+			}
+		},
+	)
+}
@@ -0,0 +1,171 @@
+package c4container
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+
+	"github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// GraphDiff defines the difference between two C4 containers graphs.
+// The nodes are identified by their ID, hence the renamed ID is treated as removal and addition.
+// The links are identified by the IDs of the nodes they connect and the label,
+// hence the changed label is also treated as removal and addition.
+type GraphDiff struct {
+	NodesAdded   []*container `json:"nodes_added,omitempty"`
+	NodesRemoved []*container `json:"nodes_removed,omitempty"`
+	// NodesChanged the new version of the nodes which attributes changed.
+	NodesChanged []*container `json:"nodes_changed,omitempty"`
+	LinksAdded   []*rel       `json:"links_added,omitempty"`
+	LinksRemoved []*rel       `json:"links_removed,omitempty"`
+	// LinksChanged the new version of the links which attributes changed.
+	LinksChanged []*rel `json:"links_changed,omitempty"`
+}
+
+// IsEmpty returns true if the graphs are identical.
+func (d GraphDiff) IsEmpty() bool {
+	return len(d.NodesAdded) == 0 && len(d.NodesRemoved) == 0 && len(d.NodesChanged) == 0 &&
+		len(d.LinksAdded) == 0 && len(d.LinksRemoved) == 0 && len(d.LinksChanged) == 0
+}
+
+// DiffGraphs defines the difference from the JSON-encoded graph a to the graph b.
+func DiffGraphs(a, b []byte) (GraphDiff, error) {
+	var graphA, graphB c4ContainersGraph
+	if err := json.Unmarshal(a, &graphA); err != nil {
+		return GraphDiff{}, errors.New(err.Error())
+	}
+	if err := json.Unmarshal(b, &graphB); err != nil {
+		return GraphDiff{}, errors.New(err.Error())
+	}
+	return diffGraphs(&graphA, &graphB), nil
+}
+
+// ApplyDiff applies the difference to the JSON-encoded graph.
+func ApplyDiff(graph []byte, diff GraphDiff) ([]byte, error) {
+	var v c4ContainersGraph
+	if err := json.Unmarshal(graph, &v); err != nil {
+		return nil, errors.New(err.Error())
+	}
+	applyDiff(&v, diff)
+	return json.Marshal(v)
+}
+
+func diffGraphs(a, b *c4ContainersGraph) GraphDiff {
+	var o GraphDiff
+
+	nodesA := map[string]*container{}
+	for _, n := range a.Containers {
+		nodesA[n.ID] = n
+	}
+	nodesB := map[string]struct{}{}
+	for _, n := range b.Containers {
+		nodesB[n.ID] = struct{}{}
+		nodeA, ok := nodesA[n.ID]
+		switch {
+		case !ok:
+			o.NodesAdded = append(o.NodesAdded, n)
+		case !reflect.DeepEqual(nodeA, n):
+			o.NodesChanged = append(o.NodesChanged, n)
+		}
+	}
+	for _, n := range a.Containers {
+		if _, ok := nodesB[n.ID]; !ok {
+			o.NodesRemoved = append(o.NodesRemoved, n)
+		}
+	}
+
+	linksA := linksByKey(a.Rels)
+	linksB := linksByKey(b.Rels)
+	for _, k := range linksKeys(b.Rels) {
+		linkA, ok := linksA[k]
+		switch {
+		case !ok:
+			o.LinksAdded = append(o.LinksAdded, linksB[k])
+		case !reflect.DeepEqual(linkA, linksB[k]):
+			o.LinksChanged = append(o.LinksChanged, linksB[k])
+		}
+	}
+	for _, k := range linksKeys(a.Rels) {
+		if _, ok := linksB[k]; !ok {
+			o.LinksRemoved = append(o.LinksRemoved, linksA[k])
+		}
+	}
+
+	return o
+}
+
+func applyDiff(g *c4ContainersGraph, diff GraphDiff) {
+	nodesRemoved := map[string]struct{}{}
+	for _, n := range diff.NodesRemoved {
+		nodesRemoved[n.ID] = struct{}{}
+	}
+	nodesChanged := map[string]*container{}
+	for _, n := range diff.NodesChanged {
+		nodesChanged[n.ID] = n
+	}
+
+	containers := make([]*container, 0, len(g.Containers)+len(diff.NodesAdded))
+	for _, n := range g.Containers {
+		if _, ok := nodesRemoved[n.ID]; ok {
+			continue
+		}
+		if v, ok := nodesChanged[n.ID]; ok {
+			n = v
+		}
+		containers = append(containers, n)
+	}
+	g.Containers = append(containers, diff.NodesAdded...)
+
+	linksRemoved := linksQueue(diff.LinksRemoved)
+	linksChanged := linksQueue(diff.LinksChanged)
+
+	rels := make([]*rel, 0, len(g.Rels)+len(diff.LinksAdded))
+	for _, l := range g.Rels {
+		k := linkKey(l)
+		if v := linksRemoved[k]; len(v) > 0 {
+			linksRemoved[k] = v[1:]
+			continue
+		}
+		if v := linksChanged[k]; len(v) > 0 {
+			l, linksChanged[k] = v[0], v[1:]
+		}
+		rels = append(rels, l)
+	}
+	g.Rels = append(rels, diff.LinksAdded...)
+}
+
+func linkKey(l *rel) string {
+	return l.From + "->" + l.To + ":" + l.Label
+}
+
+// linksKeys defines the links' identifiers in the order of the links.
+// The identifier includes the link's occurrence number to distinguish multiple links between the same nodes.
+func linksKeys(links []*rel) []string {
+	o := make([]string, len(links))
+	occurrences := map[string]int{}
+	for i, l := range links {
+		k := linkKey(l)
+		o[i] = k + "#" + strconv.Itoa(occurrences[k])
+		occurrences[k]++
+	}
+	return o
+}
+
+// linksQueue groups the links by their identifiers without the occurrence number.
+func linksQueue(links []*rel) map[string][]*rel {
+	o := make(map[string][]*rel, len(links))
+	for _, l := range links {
+		k := linkKey(l)
+		o[k] = append(o[k], l)
+	}
+	return o
+}
+
+func linksByKey(links []*rel) map[string]*rel {
+	o := make(map[string]*rel, len(links))
+	for i, k := range linksKeys(links) {
+		o[k] = links[i]
+	}
+	return o
+}
@@ -0,0 +1,127 @@
+package c4container
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffGraphs(t *testing.T) {
+	const base = `{"nodes":[{"id":"0","label":"Web"},{"id":"1","label":"DB","database":true}],` +
+		`"links":[{"from":"0","to":"1","label":"reads","technology":"TCP"}]}`
+
+	tests := []struct {
+		name string
+		b    string
+		want GraphDiff
+	}{
+		{
+			name: "identical graphs",
+			b:    base,
+			want: GraphDiff{},
+		},
+		{
+			name: "node added",
+			b: `{"nodes":[{"id":"0","label":"Web"},{"id":"1","label":"DB","database":true},` +
+				`{"id":"2","label":"Queue","queue":true}],` +
+				`"links":[{"from":"0","to":"1","label":"reads","technology":"TCP"}]}`,
+			want: GraphDiff{
+				NodesAdded: []*container{{ID: "2", Label: "Queue", IsQueue: true}},
+			},
+		},
+		{
+			name: "node and its link removed",
+			b:    `{"nodes":[{"id":"0","label":"Web"}]}`,
+			want: GraphDiff{
+				NodesRemoved: []*container{{ID: "1", Label: "DB", IsDatabase: true}},
+				LinksRemoved: []*rel{{From: "0", To: "1", Label: "reads", Technology: "TCP"}},
+			},
+		},
+		{
+			name: "node changed",
+			b: `{"nodes":[{"id":"0","label":"Web","technology":"Go"},{"id":"1","label":"DB","database":true}],` +
+				`"links":[{"from":"0","to":"1","label":"reads","technology":"TCP"}]}`,
+			want: GraphDiff{
+				NodesChanged: []*container{{ID: "0", Label: "Web", Technology: "Go"}},
+			},
+		},
+		{
+			name: "node renamed",
+			b: `{"nodes":[{"id":"web","label":"Web"},{"id":"1","label":"DB","database":true}],` +
+				`"links":[{"from":"web","to":"1","label":"reads","technology":"TCP"}]}`,
+			want: GraphDiff{
+				NodesAdded:   []*container{{ID: "web", Label: "Web"}},
+				NodesRemoved: []*container{{ID: "0", Label: "Web"}},
+				LinksAdded:   []*rel{{From: "web", To: "1", Label: "reads", Technology: "TCP"}},
+				LinksRemoved: []*rel{{From: "0", To: "1", Label: "reads", Technology: "TCP"}},
+			},
+		},
+		{
+			name: "link changed",
+			b: `{"nodes":[{"id":"0","label":"Web"},{"id":"1","label":"DB","database":true}],` +
+				`"links":[{"from":"0","to":"1","label":"reads","technology":"gRPC","async":true}]}`,
+			want: GraphDiff{
+				LinksChanged: []*rel{{From: "0", To: "1", Label: "reads", Technology: "gRPC", IsAsync: true}},
+			},
+		},
+		{
+			name: "link added between the same nodes",
+			b: `{"nodes":[{"id":"0","label":"Web"},{"id":"1","label":"DB","database":true}],` +
+				`"links":[{"from":"0","to":"1","label":"reads","technology":"TCP"},` +
+				`{"from":"0","to":"1","label":"writes"}]}`,
+			want: GraphDiff{
+				LinksAdded: []*rel{{From: "0", To: "1", Label: "writes"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// WHEN
+				got, err := DiffGraphs([]byte(base), []byte(tt.b))
+
+				// THEN
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("DiffGraphs() got = %s, want = %s", mustMarshal(got), mustMarshal(tt.want))
+				}
+				if got.IsEmpty() != (tt.b == base) {
+					t.Errorf("unexpected IsEmpty() = %v", got.IsEmpty())
+				}
+
+				// applying the diff to the graph a results to the graph b
+				gotB, err := ApplyDiff([]byte(base), got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if d, err := DiffGraphs(gotB, []byte(tt.b)); err != nil || !d.IsEmpty() {
+					t.Errorf("ApplyDiff() got = %s, want = %s", gotB, tt.b)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"shall fail for faulty graph", func(t *testing.T) {
+			if _, err := DiffGraphs([]byte(`{`), []byte(base)); err == nil {
+				t.Error("error expected")
+			}
+			if _, err := DiffGraphs([]byte(base), []byte(`{`)); err == nil {
+				t.Error("error expected")
+			}
+			if _, err := ApplyDiff([]byte(`{`), GraphDiff{}); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
+
+func mustMarshal(v interface{}) []byte {
+	o, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return o
+}
@@ -0,0 +1,95 @@
+package c4container
+
+import (
+	"context"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// defaultPrices the prices of the model in USD per 1000 tokens.
+var defaultPrices = map[string]diagram.Price{
+	model: {Prompt: 0.0015, Completion: 0.002},
+}
+
+// WithPrices sets the prices of the models used to estimate the cost of the diagram generation,
+// the prices override the default prices of the same models, see NewC4ContainersEstimateHandler.
+func WithPrices(prices map[string]diagram.Price) HandlerOps {
+	return func(cfg *renderingConfig) {
+		for k, v := range prices {
+			cfg.Prices[k] = v
+		}
+	}
+}
+
+// tokensReplyPriming the number of tokens priming the model's reply.
+const tokensReplyPriming = 3
+
+// NewC4ContainersEstimateHandler initialises the handler to estimate the size and cost of the C4 containers
+// diagram generation without calling the model. The estimate uses the model and the system content which
+// the request would use, see WithExperiment. The prompt's tokens include the system content, the curated examples'
+// prompts and graphs, see DefaultExamples, and the chat messages' overhead. The completion's tokens are estimated
+// as the tokens of the largest curated example's graph.
+func NewC4ContainersEstimateHandler(tokenizer diagram.Tokenizer, fnOps ...HandlerOps) (diagram.EstimateHandler, error) {
+	if tokenizer == nil {
+		return nil, errors.New("tokenizer must be provided")
+	}
+
+	cfg := defaultRenderingConfig()
+	for _, fn := range fnOps {
+		fn(&cfg)
+	}
+
+	examples := DefaultExamples()
+	// the tokenizer is checked upon initialisation
+	if _, _, err := examplesTokens(tokenizer, model, examples); err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, input diagram.Input) (diagram.Estimate, error) {
+		if err := input.Validate(); err != nil {
+			return diagram.Estimate{}, err
+		}
+
+		variant := experimentVariant(ctx, cfg.Experiment, input.GetUserID())
+		instruction := systemContent(variant, regeneration(input))
+
+		tokensExamples, tokensCompletion, err := examplesTokens(tokenizer, variant.Model, examples)
+		if err != nil {
+			return diagram.Estimate{}, err
+		}
+		// every message is wrapped: the system content, the examples' prompts and graphs, and the prompt
+		tokensPrompt := tokensExamples + (2+2*len(examples))*tokensPerMessage + tokensReplyPriming
+		for _, text := range []string{instruction, input.GetPrompt()} {
+			n, err := tokenizer.CountTokens(variant.Model, text)
+			if err != nil {
+				return diagram.Estimate{}, errors.New(err.Error())
+			}
+			tokensPrompt += n
+		}
+
+		return diagram.NewEstimate(
+			variant.Model, tokensPrompt, tokensCompletion, cfg.Prices[variant.Model],
+		), nil
+	}, nil
+}
+
+// examplesTokens returns the number of tokens of the examples' prompts and graphs,
+// and the number of tokens of the largest example's graph.
+func examplesTokens(tokenizer diagram.Tokenizer, model string, examples []Example) (total, graphMax int, err error) {
+	for _, e := range examples {
+		tokensPrompt, err := tokenizer.CountTokens(model, e.Prompt)
+		if err != nil {
+			return 0, 0, errors.New(err.Error())
+		}
+		tokensGraph, err := tokenizer.CountTokens(model, e.Graph)
+		if err != nil {
+			return 0, 0, errors.New(err.Error())
+		}
+		total += tokensPrompt + tokensGraph
+		if tokensGraph > graphMax {
+			graphMax = tokensGraph
+		}
+	}
+	return total, graphMax, nil
+}
@@ -0,0 +1,157 @@
+package c4container
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+)
+
+func TestNewC4ContainersEstimateHandler(t *testing.T) {
+	t.Run(
+		"shall estimate the tokens and the cost", func(t *testing.T) {
+			// GIVEN
+			handler, err := NewC4ContainersEstimateHandler(
+				diagram.MockTokenizer{},
+				WithPrices(map[string]diagram.Price{model: {Prompt: 1, Completion: 2}}),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			got, err := handler(
+				context.TODO(), diagram.MockInput{Prompt: "c4 diagram of a python web server reading from postgres"},
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the mock tokenizer counts the words: the largest example's graph contains five words
+			promptTokens := len(strings.Fields(contentSystem)) + 10 + exampleWords() + 6*tokensPerMessage + 3
+			want := diagram.Estimate{
+				Model:            model,
+				PromptTokens:     promptTokens,
+				CompletionTokens: 5,
+				TotalTokens:      promptTokens + 5,
+				Cost:             float64(promptTokens+5*2) / 1000,
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected estimate: got = %+v, want = %+v", got, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall estimate the tokens and the cost of the experiment's variant", func(t *testing.T) {
+			// GIVEN
+			handler, err := NewC4ContainersEstimateHandler(
+				diagram.MockTokenizer{},
+				WithPrices(map[string]diagram.Price{model: {Prompt: 1, Completion: 1}, "gpt-4": {Prompt: 10}}),
+				WithExperiment(
+					diagram.NewExperiment(
+						diagram.ExperimentConfig{
+							Name: "foo",
+							Variants: []diagram.Variant{
+								{Name: "bar", Weight: 1, Model: "gpt-4", SystemContent: "draw the diagram"},
+							},
+						},
+					),
+				),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			got, err := handler(context.TODO(), diagram.MockInput{Prompt: "foo", UserID: placeholderUserID})
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			promptTokens := 3 + 1 + exampleWords() + 6*tokensPerMessage + 3
+			if got.Model != "gpt-4" || got.PromptTokens != promptTokens || got.Cost != float64(promptTokens*10)/1000 {
+				t.Errorf("unexpected estimate: %+v", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall estimate the cost using the default prices", func(t *testing.T) {
+			// GIVEN
+			handler, err := NewC4ContainersEstimateHandler(diagram.NewApproximateTokenizer())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			got, err := handler(context.TODO(), diagram.MockInput{Prompt: "foo"})
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := diagram.NewEstimate(
+				model, got.PromptTokens, got.CompletionTokens, defaultPrices[model],
+			); got.Cost == 0 || got != want {
+				t.Errorf("unexpected estimate: got = %+v, want = %+v", got, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given no tokenizer", func(t *testing.T) {
+			// WHEN
+			_, err := NewC4ContainersEstimateHandler(nil)
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the tokenizer error", func(t *testing.T) {
+			// WHEN
+			_, err := NewC4ContainersEstimateHandler(diagram.MockTokenizer{Err: errors.New("foo")})
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given invalid input", func(t *testing.T) {
+			// GIVEN
+			handler, err := NewC4ContainersEstimateHandler(diagram.MockTokenizer{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			_, err = handler(context.TODO(), diagram.MockInput{Err: errors.New("foo")})
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
+
+// exampleWords returns the number of words of the curated examples' prompts and graphs.
+func exampleWords() int {
+	var o int
+	for _, e := range DefaultExamples() {
+		o += len(strings.Fields(e.Prompt)) + len(strings.Fields(e.Graph))
+	}
+	return o
+}
@@ -0,0 +1,59 @@
+package c4container
+
+import "encoding/json"
+
+// Example defines the prompt and the expected graph used to guide the model, i.e. the few-shot example.
+type Example struct {
+	Prompt string
+	// Graph the JSON-encoded graph expected for the prompt.
+	Graph string
+}
+
+// defaultExamples defines the curated set of the prompts and the expected graphs.
+// The graphs keep the default legend, i.e. the model is not guided to disable it.
+var defaultExamples = []struct {
+	prompt string
+	graph  *c4ContainersGraph
+}{
+	{
+		prompt: "c4 diagram of a python web server reading from postgres",
+		graph: &c4ContainersGraph{
+			Containers: []*container{
+				{ID: "0", Label: "Web Server", Technology: "Python"},
+				{ID: "1", Label: "Database", Technology: "PostgreSQL", IsDatabase: true},
+			},
+			Rels: []*rel{
+				{From: "0", To: "1", Label: "Reads from", Technology: "TCP"},
+			},
+			WithLegend: true,
+		},
+	},
+	{
+		prompt: "user uses go backend which publishes events to kafka consumed by external analytics service",
+		graph: &c4ContainersGraph{
+			Containers: []*container{
+				{ID: "0", Label: "User", IsUser: true},
+				{ID: "1", Label: "Backend", Technology: "Go"},
+				{ID: "2", Label: "Events Broker", Technology: "Kafka", IsQueue: true},
+				{ID: "3", Label: "Analytics Service", IsExternal: true},
+			},
+			Rels: []*rel{
+				{From: "0", To: "1", Label: "Uses", Technology: "HTTPS"},
+				{From: "1", To: "2", Label: "Publishes events", IsAsync: true},
+				{From: "3", To: "2", Label: "Consumes events", IsAsync: true},
+			},
+			WithLegend: true,
+		},
+	},
+}
+
+// DefaultExamples returns the curated set of the few-shot examples.
+// The set can be extended, or overridden by the caller before passing it to the model inference client.
+func DefaultExamples() []Example {
+	o := make([]Example, len(defaultExamples))
+	for i, e := range defaultExamples {
+		graph, _ := json.Marshal(e.graph)
+		o[i] = Example{Prompt: e.prompt, Graph: string(graph)}
+	}
+	return o
+}
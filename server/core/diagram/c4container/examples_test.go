@@ -0,0 +1,49 @@
+package c4container
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDefaultExamples(t *testing.T) {
+	got := DefaultExamples()
+	if len(got) == 0 {
+		t.Fatal("examples expected")
+	}
+
+	for _, e := range got {
+		t.Run(
+			"shall render the example graph for "+e.Prompt, func(t *testing.T) {
+				// WHEN
+				diagram, err := Render(context.TODO(), nil, []byte(e.Graph), FormatDSL)
+
+				// THEN
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(diagram) == 0 {
+					t.Error("diagram expected")
+				}
+				if strings.Contains(e.Graph, `"legend"`) {
+					t.Errorf("the example shall keep the default legend, got: %s", e.Graph)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"shall return a copy of the examples", func(t *testing.T) {
+			// GIVEN
+			examples := DefaultExamples()
+
+			// WHEN
+			examples[0].Prompt = "foo"
+
+			// THEN
+			if DefaultExamples()[0].Prompt == "foo" {
+				t.Error("default examples shall not be mutated")
+			}
+		},
+	)
+}
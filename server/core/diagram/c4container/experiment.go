@@ -0,0 +1,56 @@
+package c4container
+
+import (
+	"context"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+)
+
+// WithExperiment assigns the users to the experiment's variants defining the model and the system prompt
+// to generate the diagrams, e.g. to compare the quality of the diagrams. The variant is recorded
+// with the model's prediction if the repository supports it, see diagram.RepositoryPredictionWithVariant.
+func WithExperiment(experiment diagram.Experiment) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.Experiment = experiment
+	}
+}
+
+// experimentVariant defines the model and the system prompt for the user.
+// The defaults are used if the user is not assigned to the variant, or the variant does not define them.
+func experimentVariant(ctx context.Context, experiment diagram.Experiment, userID string) diagram.Variant {
+	o := diagram.Variant{Model: model, SystemContent: contentSystem}
+	if experiment == nil {
+		return o
+	}
+
+	v, ok := experiment.Assign(ctx, userID)
+	if !ok {
+		return o
+	}
+	o.Name = v.Name
+	if v.Model != "" {
+		o.Model = v.Model
+	}
+	if v.SystemContent != "" {
+		o.SystemContent = v.SystemContent
+	}
+	return o
+}
+
+// writeModelResult records the model's prediction along with the experiment's variant.
+// The variant is only recorded if the user is assigned to it, and the repository supports it.
+func writeModelResult(
+	ctx context.Context, repository diagram.RepositoryPrediction, input diagram.Input,
+	predictionRaw, prediction string, variant diagram.Variant, usageTokensPrompt, usageTokensCompletions uint16,
+) error {
+	if v, ok := repository.(diagram.RepositoryPredictionWithVariant); ok && variant.Name != "" {
+		return v.WriteModelResultWithVariant(
+			ctx, input.GetRequestID(), input.GetUserID(), predictionRaw, prediction, variant.Model,
+			usageTokensPrompt, usageTokensCompletions, variant.Name,
+		)
+	}
+	return repository.WriteModelResult(
+		ctx, input.GetRequestID(), input.GetUserID(), predictionRaw, prediction, variant.Model,
+		usageTokensPrompt, usageTokensCompletions,
+	)
+}
@@ -0,0 +1,134 @@
+package c4container
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/logger"
+)
+
+// mockRepositoryPredictionWithVariant records the model and the variant of the written prediction.
+type mockRepositoryPredictionWithVariant struct {
+	diagram.MockRepositoryPrediction
+	model, variant string
+}
+
+func (m *mockRepositoryPredictionWithVariant) WriteModelResultWithVariant(
+	_ context.Context, _, _, _, _, model string, _, _ uint16, variant string,
+) error {
+	m.model, m.variant = model, variant
+	return nil
+}
+
+// mockModelInferenceRecorder records the model and the system prompt of the call.
+type mockModelInferenceRecorder struct {
+	diagram.MockModelInference
+	model, systemContent string
+}
+
+func (m *mockModelInferenceRecorder) Do(ctx context.Context, userPrompt, systemContent, model string) (
+	string, []byte, uint16, uint16, error,
+) {
+	m.model, m.systemContent = model, systemContent
+	return m.MockModelInference.Do(ctx, userPrompt, systemContent, model)
+}
+
+func (m *mockModelInferenceRecorder) DoWithTemperature(
+	ctx context.Context, userPrompt, systemContent, model string, _ float32,
+) (string, []byte, uint16, uint16, error) {
+	return m.Do(ctx, userPrompt, systemContent, model)
+}
+
+func TestWithExperiment(t *testing.T) {
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+	httpClient := mockHTTPClientFn(
+		func(_ *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg))}, nil
+		},
+	)
+
+	t.Run(
+		"shall generate the diagram using the variant, and record the variant", func(t *testing.T) {
+			// GIVEN
+			modelInference := &mockModelInferenceRecorder{
+				MockModelInference: diagram.MockModelInference{V: []byte(`{"nodes":[{"id":"0"}]}`)},
+			}
+			repository := &mockRepositoryPredictionWithVariant{}
+			handler, err := NewC4ContainersHTTPHandler(
+				modelInference, repository, httpClient,
+				WithLogger(logger.NewNoopLogger()),
+				WithExperiment(
+					diagram.NewExperiment(
+						diagram.ExperimentConfig{
+							Name:     "foo",
+							Variants: []diagram.Variant{{Name: "bar", Weight: 1, Model: "gpt-4", SystemContent: "qux"}},
+						},
+					),
+				),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			got, err := handler(
+				context.TODO(), diagram.MockInput{Prompt: "foobar", RequestID: "bar", UserID: placeholderUserID},
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if modelInference.model != "gpt-4" || modelInference.systemContent != "qux" {
+				t.Errorf(
+					"unexpected model: %s, system prompt: %s", modelInference.model, modelInference.systemContent,
+				)
+			}
+			if repository.model != "gpt-4" || repository.variant != "bar" {
+				t.Errorf("unexpected record, model: %s, variant: %s", repository.model, repository.variant)
+			}
+			if v := got.(diagram.OutputModel).GetModel(); v != "gpt-4" {
+				t.Errorf("unexpected model in the output: %s", v)
+			}
+		},
+	)
+
+	t.Run(
+		"shall generate the diagram using the defaults given the user is not assigned", func(t *testing.T) {
+			// GIVEN
+			modelInference := &mockModelInferenceRecorder{
+				MockModelInference: diagram.MockModelInference{V: []byte(`{"nodes":[{"id":"0"}]}`)},
+			}
+			repository := &mockRepositoryPredictionWithVariant{}
+			handler, err := NewC4ContainersHTTPHandler(
+				modelInference, repository, httpClient,
+				WithLogger(logger.NewNoopLogger()),
+				WithExperiment(diagram.NewExperiment(diagram.ExperimentConfig{})),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			_, err = handler(
+				context.TODO(), diagram.MockInput{Prompt: "foobar", RequestID: "bar", UserID: placeholderUserID},
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if modelInference.model != model || modelInference.systemContent != contentSystem {
+				t.Errorf("the defaults shall be used, got model: %s", modelInference.model)
+			}
+			if repository.variant != "" {
+				t.Errorf("the variant shall not be recorded, got: %s", repository.variant)
+			}
+		},
+	)
+}
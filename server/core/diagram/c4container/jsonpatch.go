@@ -0,0 +1,300 @@
+package c4container
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ApplyPatch applies the JSON Patch, see https://www.rfc-editor.org/rfc/rfc6902, to the JSON-encoded graph,
+// e.g. to edit the diagram sending just the changes. The operations are applied in order,
+// and the graph is not changed if any operation fails. The errors describe the failed operation,
+// hence they can be forwarded to the client.
+func ApplyPatch(graph, patch []byte) ([]byte, error) {
+	var operations []jsonPatchOperation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, errors.New("wrong patch format: " + err.Error())
+	}
+
+	doc, err := decodeJSON(graph)
+	if err != nil {
+		return nil, errors.New("wrong graph format: " + err.Error())
+	}
+
+	for i, op := range operations {
+		if doc, err = op.apply(doc); err != nil {
+			return nil, errors.New("patch operation " + strconv.Itoa(i) + ": " + err.Error())
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+// jsonPatchOperation defines the operation of the JSON Patch.
+type jsonPatchOperation struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	// From the location of the value to move, or to copy.
+	From string `json:"from,omitempty"`
+	// Value the value to add, to replace with, or to test against, it is not set for other operations.
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func (op jsonPatchOperation) apply(doc interface{}) (interface{}, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		return op.add(doc, path)
+	case "remove":
+		o, _, err := removeJSON(doc, path)
+		return o, err
+	case "replace":
+		return op.replace(doc, path)
+	case "move", "copy":
+		return op.moveOrCopy(doc, path)
+	case "test":
+		return op.test(doc, path)
+	default:
+		return nil, errors.New("unsupported op " + op.Op)
+	}
+}
+
+func (op jsonPatchOperation) value() (interface{}, error) {
+	if op.Value == nil {
+		return nil, errors.New("value must be set for the op " + op.Op)
+	}
+	return decodeJSON(op.Value)
+}
+
+func (op jsonPatchOperation) add(doc interface{}, path []string) (interface{}, error) {
+	value, err := op.value()
+	if err != nil {
+		return nil, err
+	}
+	return addJSON(doc, path, value)
+}
+
+func (op jsonPatchOperation) replace(doc interface{}, path []string) (interface{}, error) {
+	value, err := op.value()
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return value, nil
+	}
+	if doc, _, err = removeJSON(doc, path); err != nil {
+		return nil, err
+	}
+	return addJSON(doc, path, value)
+}
+
+func (op jsonPatchOperation) moveOrCopy(doc interface{}, path []string) (interface{}, error) {
+	from, err := parseJSONPointer(op.From)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := getJSON(doc, from)
+	if err != nil {
+		return nil, err
+	}
+
+	if op.Op == "copy" {
+		// the copy must not share the nested objects with the original value
+		v, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = decodeJSON(v); err != nil {
+			return nil, err
+		}
+		return addJSON(doc, path, value)
+	}
+
+	if op.Path == op.From {
+		return doc, nil
+	}
+	if strings.HasPrefix(op.Path, op.From+"/") {
+		return nil, errors.New("value cannot be moved into its child " + op.Path)
+	}
+	if doc, value, err = removeJSON(doc, from); err != nil {
+		return nil, err
+	}
+	return addJSON(doc, path, value)
+}
+
+func (op jsonPatchOperation) test(doc interface{}, path []string) (interface{}, error) {
+	want, err := op.value()
+	if err != nil {
+		return nil, err
+	}
+	got, err := getJSON(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(got, want) {
+		return nil, errors.New("test failed for " + op.Path)
+	}
+	return doc, nil
+}
+
+// decodeJSON decodes the JSON value keeping the numbers' representation.
+func decodeJSON(data []byte) (interface{}, error) {
+	var o interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// parseJSONPointer splits the JSON Pointer, see https://www.rfc-editor.org/rfc/rfc6901, into the reference tokens.
+// The empty pointer references the whole document.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, errors.New("path must start with /, got: " + pointer)
+	}
+
+	o := strings.Split(pointer[1:], "/")
+	for i, token := range o {
+		o[i] = jsonPointerUnescaper.Replace(token)
+	}
+	return o, nil
+}
+
+var jsonPointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+func getJSON(doc interface{}, path []string) (interface{}, error) {
+	o := doc
+	for _, token := range path {
+		var err error
+		if o, err = childJSON(o, token); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+func childJSON(doc interface{}, token string) (interface{}, error) {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		o, ok := v[token]
+		if !ok {
+			return nil, errors.New("member " + token + " not found")
+		}
+		return o, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(v)-1)
+		if err != nil {
+			return nil, err
+		}
+		return v[i], nil
+	default:
+		return nil, errors.New("value referenced by " + token + " not found")
+	}
+}
+
+// arrayIndex parses the array's index not exceeding maxIndex.
+func arrayIndex(token string, maxIndex int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, errors.New("wrong array index " + token)
+	}
+	if i > maxIndex {
+		return 0, errors.New("array index " + token + " is out of bounds")
+	}
+	return i, nil
+}
+
+// updateJSON replaces the parent of the value referenced by the path with the parent updated by fn.
+func updateJSON(
+	doc interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error),
+) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := childJSON(doc, path[0])
+	if err != nil {
+		return nil, err
+	}
+	if child, err = updateJSON(child, path[1:], fn); err != nil {
+		return nil, err
+	}
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		v[path[0]] = child
+	case []interface{}:
+		i, _ := strconv.Atoi(path[0])
+		v[i] = child
+	}
+	return doc, nil
+}
+
+func addJSON(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return updateJSON(
+		doc, path, func(parent interface{}, token string) (interface{}, error) {
+			switch v := parent.(type) {
+			case map[string]interface{}:
+				v[token] = value
+				return v, nil
+			case []interface{}:
+				if token == "-" {
+					return append(v, value), nil
+				}
+				i, err := arrayIndex(token, len(v))
+				if err != nil {
+					return nil, err
+				}
+				v = append(v, nil)
+				copy(v[i+1:], v[i:])
+				v[i] = value
+				return v, nil
+			default:
+				return nil, errors.New("value cannot be added to " + token)
+			}
+		},
+	)
+}
+
+// removeJSON removes the value referenced by the path, and returns it.
+func removeJSON(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("document cannot be removed")
+	}
+
+	var removed interface{}
+	o, err := updateJSON(
+		doc, path, func(parent interface{}, token string) (interface{}, error) {
+			var err error
+			if removed, err = childJSON(parent, token); err != nil {
+				return nil, err
+			}
+			switch v := parent.(type) {
+			case map[string]interface{}:
+				delete(v, token)
+				return v, nil
+			default:
+				i, _ := strconv.Atoi(token)
+				return append(v.([]interface{})[:i], v.([]interface{})[i+1:]...), nil
+			}
+		},
+	)
+	return o, removed, err
+}
@@ -0,0 +1,194 @@
+package c4container
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	const graph = `{"nodes":[{"id":"0","label":"Web Server"},{"id":"1","label":"Database","database":true}],` +
+		`"links":[{"from":"0","to":"1","label":"reads"}],"title":"foo"}`
+
+	tests := []struct {
+		name    string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "shall add the node",
+			patch: `[{"op":"add","path":"/nodes/-","value":{"id":"2","label":"Queue","queue":true}}]`,
+			want: `{"nodes":[{"id":"0","label":"Web Server"},{"id":"1","label":"Database","database":true},` +
+				`{"id":"2","label":"Queue","queue":true}],"links":[{"from":"0","to":"1","label":"reads"}],"title":"foo"}`,
+		},
+		{
+			name:  "shall insert the node at the index",
+			patch: `[{"op":"add","path":"/nodes/0","value":{"id":"2"}}]`,
+			want: `{"nodes":[{"id":"2"},{"id":"0","label":"Web Server"},{"id":"1","label":"Database","database":true}],` +
+				`"links":[{"from":"0","to":"1","label":"reads"}],"title":"foo"}`,
+		},
+		{
+			name: "shall add the link",
+			patch: `[{"op":"add","path":"/nodes/-","value":{"id":"2"}},` +
+				`{"op":"add","path":"/links/1","value":{"from":"2","to":"0"}}]`,
+			want: `{"nodes":[{"id":"0","label":"Web Server"},{"id":"1","label":"Database","database":true},` +
+				`{"id":"2"}],"links":[{"from":"0","to":"1","label":"reads"},{"from":"2","to":"0"}],"title":"foo"}`,
+		},
+		{
+			name:  "shall add the node's attribute",
+			patch: `[{"op":"add","path":"/nodes/0/technology","value":"Go"}]`,
+			want: `{"nodes":[{"id":"0","label":"Web Server","technology":"Go"},` +
+				`{"id":"1","label":"Database","database":true}],"links":[{"from":"0","to":"1","label":"reads"}],` +
+				`"title":"foo"}`,
+		},
+		{
+			name:  "shall remove the node and the link",
+			patch: `[{"op":"remove","path":"/links/0"},{"op":"remove","path":"/nodes/1"}]`,
+			want:  `{"nodes":[{"id":"0","label":"Web Server"}],"links":[],"title":"foo"}`,
+		},
+		{
+			name:  "shall remove the link's attribute",
+			patch: `[{"op":"remove","path":"/links/0/label"}]`,
+			want: `{"nodes":[{"id":"0","label":"Web Server"},{"id":"1","label":"Database","database":true}],` +
+				`"links":[{"from":"0","to":"1"}],"title":"foo"}`,
+		},
+		{
+			name:  "shall replace the node",
+			patch: `[{"op":"replace","path":"/nodes/1","value":{"id":"1","label":"Cache"}}]`,
+			want: `{"nodes":[{"id":"0","label":"Web Server"},{"id":"1","label":"Cache"}],` +
+				`"links":[{"from":"0","to":"1","label":"reads"}],"title":"foo"}`,
+		},
+		{
+			name:  "shall replace the link's label",
+			patch: `[{"op":"replace","path":"/links/0/label","value":"writes"}]`,
+			want: `{"nodes":[{"id":"0","label":"Web Server"},{"id":"1","label":"Database","database":true}],` +
+				`"links":[{"from":"0","to":"1","label":"writes"}],"title":"foo"}`,
+		},
+		{
+			name:  "shall move the title to the footer",
+			patch: `[{"op":"move","from":"/title","path":"/footer"}]`,
+			want: `{"nodes":[{"id":"0","label":"Web Server"},{"id":"1","label":"Database","database":true}],` +
+				`"links":[{"from":"0","to":"1","label":"reads"}],"footer":"foo"}`,
+		},
+		{
+			name: "shall copy the node",
+			patch: `[{"op":"copy","from":"/nodes/0","path":"/nodes/-"},` +
+				`{"op":"replace","path":"/nodes/2/id","value":"2"}]`,
+			want: `{"nodes":[{"id":"0","label":"Web Server"},{"id":"1","label":"Database","database":true},` +
+				`{"id":"2","label":"Web Server"}],"links":[{"from":"0","to":"1","label":"reads"}],"title":"foo"}`,
+		},
+		{
+			name: "shall pass the test and apply the operations",
+			patch: `[{"op":"test","path":"/nodes/1/database","value":true},` +
+				`{"op":"replace","path":"/title","value":"bar"}]`,
+			want: `{"nodes":[{"id":"0","label":"Web Server"},{"id":"1","label":"Database","database":true}],` +
+				`"links":[{"from":"0","to":"1","label":"reads"}],"title":"bar"}`,
+		},
+		{
+			name:  "shall replace the whole graph",
+			patch: `[{"op":"replace","path":"","value":{"nodes":[{"id":"0"}]}}]`,
+			want:  `{"nodes":[{"id":"0"}]}`,
+		},
+		{
+			name:  "shall apply no operations",
+			patch: `[]`,
+			want:  graph,
+		},
+		{
+			name: "shall fail given the failed test",
+			patch: `[{"op":"replace","path":"/title","value":"bar"},` +
+				`{"op":"test","path":"/nodes/0/label","value":"Database"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "shall fail given the index out of bounds",
+			patch:   `[{"op":"remove","path":"/nodes/2"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "shall fail given the index with the leading zero",
+			patch:   `[{"op":"remove","path":"/nodes/01"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "shall fail given the missing member",
+			patch:   `[{"op":"replace","path":"/layout","value":"left-right"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "shall fail given the missing value",
+			patch:   `[{"op":"add","path":"/layout"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "shall fail given the path without the leading slash",
+			patch:   `[{"op":"remove","path":"title"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "shall fail given the unsupported operation",
+			patch:   `[{"op":"delete","path":"/title"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "shall fail moving the value into its child",
+			patch:   `[{"op":"move","from":"/nodes","path":"/nodes/0"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "shall fail given the patch is not a list",
+			patch:   `{"op":"remove","path":"/title"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// WHEN
+				got, err := ApplyPatch([]byte(graph), []byte(tt.patch))
+
+				// THEN
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("ApplyPatch() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if tt.wantErr {
+					return
+				}
+				if !jsonEqual(t, got, []byte(tt.want)) {
+					t.Errorf("ApplyPatch() got = %s, want = %s", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestApplyPatchEscapedPath(t *testing.T) {
+	// GIVEN
+	graph := []byte(`{"a/b":{"c~d":1}}`)
+	patch := []byte(`[{"op":"replace","path":"/a~1b/c~0d","value":2}]`)
+
+	// WHEN
+	got, err := ApplyPatch(graph, patch)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte(`{"a/b":{"c~d":2}}`); !jsonEqual(t, got, want) {
+		t.Errorf("unexpected result: got = %s, want = %s", got, want)
+	}
+}
+
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(va, vb)
+}
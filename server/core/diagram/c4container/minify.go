@@ -0,0 +1,22 @@
+package c4container
+
+import (
+	"bytes"
+	"regexp"
+)
+
+var (
+	// svgMetadata matches the comments, e.g. the PlantUML source code, the processing instructions
+	// except the XML declaration, e.g. <?plantuml 1.2023.5?>, and the metadata elements.
+	svgMetadata = regexp.MustCompile(`(?s)<!--.*?-->|<\?(?:[^x]|x[^m]|xm[^l]).*?\?>|<metadata\b.*?</metadata>`)
+
+	// svgWhitespaceBetweenElements matches the whitespaces between the elements which do not affect rendering.
+	svgWhitespaceBetweenElements = regexp.MustCompile(`>\s+<`)
+)
+
+// minifySVG removes the comments, the editor metadata and the whitespaces between the elements.
+func minifySVG(v []byte) []byte {
+	o := svgMetadata.ReplaceAll(v, nil)
+	o = svgWhitespaceBetweenElements.ReplaceAll(o, []byte("><"))
+	return bytes.TrimSpace(o)
+}
@@ -0,0 +1,75 @@
+package c4container
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/internal/utils"
+)
+
+const svgPlantUML = `<?xml version="1.0" encoding="us-ascii" standalone="no"?>
+<svg xmlns="http://www.w3.org/2000/svg" height="179px" version="1.1" viewBox="0 0 375 179" width="375px">
+<?plantuml 1.2023.5?>
+<metadata>
+	<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"></rdf:RDF>
+</metadata>
+<defs></defs>
+<g>
+	<!--MD5=[8d4298e8c40046c92682b92efe1f786e]
+	cluster X-->
+	<g id="elem_n0">
+		<rect fill="#438DD5" height="52.5938" rx="2.5" ry="2.5" width="125" x="7" y="11.8301"></rect>
+		<text fill="#FFFFFF" font-size="16" x="17" y="36.6816">Web Server</text>
+	</g>
+	<!--SRC=[SoWkIImgAStDuL80WaG5NJk592w7rBmKe100]-->
+</g>
+</svg>
+`
+
+func Test_minifySVG(t *testing.T) {
+	// WHEN
+	got := minifySVG([]byte(svgPlantUML))
+
+	// THEN
+	const want = `<?xml version="1.0" encoding="us-ascii" standalone="no"?>` +
+		`<svg xmlns="http://www.w3.org/2000/svg" height="179px" version="1.1" viewBox="0 0 375 179" width="375px">` +
+		`<defs></defs><g><g id="elem_n0">` +
+		`<rect fill="#438DD5" height="52.5938" rx="2.5" ry="2.5" width="125" x="7" y="11.8301"></rect>` +
+		`<text fill="#FFFFFF" font-size="16" x="17" y="36.6816">Web Server</text>` +
+		`</g></g></svg>`
+	if string(got) != want {
+		t.Errorf("unexpected minified svg:\ngot  = %s\nwant = %s", got, want)
+	}
+
+	if len(got) >= len(svgPlantUML) {
+		t.Errorf("minified svg shall be smaller: before = %d bytes, after = %d bytes", len(svgPlantUML), len(got))
+	}
+
+	if err := utils.ValidateSVG(got); err != nil {
+		t.Errorf("minified svg shall be valid: %v", err)
+	}
+}
+
+func TestRenderWithSVGMinification(t *testing.T) {
+	// GIVEN
+	httpClient := mockHTTPClientFn(
+		func(_ *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svgPlantUML))}, nil
+		},
+	)
+	graph := []byte(`{"nodes":[{"id":"0"}]}`)
+
+	// WHEN
+	got, err := Render(context.TODO(), httpClient, graph, FormatSVG, WithSVGMinification())
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "<!--") || strings.Contains(string(got), "\n") {
+		t.Errorf("svg shall be minified: %s", got)
+	}
+}
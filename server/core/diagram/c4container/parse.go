@@ -0,0 +1,347 @@
+package c4container
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	coreErrors "github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// ParsePlantUML reconstructs the diagram's graph from the C4-PlantUML code, e.g. to edit the hand-written diagram.
+// The subset of C4-PlantUML rendered by Render is supported, hence the rendered diagram round-trips:
+//   - the containers, the databases, the queues and the persons, including the external ones;
+//   - the system boundaries, they define the containers' group;
+//   - the relations, their direction and tags, and the relation tags definitions;
+//   - the layout and the style directives, the title, the footer and the legend.
+//
+// The values equal to the rendering defaults, e.g. the default footer, or the label equal to the container's ID,
+// are omitted. The unsupported macros and the nested boundaries are rejected, while the unsupported named
+// arguments of the supported macros, e.g. $sprite, are ignored.
+func ParsePlantUML(code []byte) (DiagramGraph, error) {
+	p := plantUMLParser{defaults: defaultRenderingConfig()}
+	for i, line := range strings.Split(lineBreaksNormalizer.Replace(string(code)), "\n") {
+		if err := p.parseLine(strings.TrimSpace(line)); err != nil {
+			return DiagramGraph{}, coreErrors.New("line " + strconv.Itoa(i+1) + ": " + err.Error())
+		}
+	}
+
+	if p.inBoundary {
+		return DiagramGraph{}, coreErrors.New("system boundary " + p.group + " is not closed")
+	}
+	if len(p.graph.Containers) == 0 {
+		return DiagramGraph{}, coreErrors.New("no containers found")
+	}
+
+	p.graph.RelTags = withoutDefaultAsyncTag(p.graph.RelTags)
+	return p.graph, nil
+}
+
+type plantUMLParser struct {
+	defaults   renderingConfig
+	graph      DiagramGraph
+	group      string
+	inBoundary bool
+}
+
+func (p *plantUMLParser) parseLine(line string) error {
+	switch {
+	case line == "" || line == "@startuml" || line == "@enduml" ||
+		strings.HasPrefix(line, "'") || strings.HasPrefix(line, "!include") || strings.HasPrefix(line, "!theme"):
+		return nil
+	case line == "}":
+		if !p.inBoundary {
+			return errors.New("unexpected }")
+		}
+		p.group, p.inBoundary = "", false
+		return nil
+	case strings.HasPrefix(line, "title "):
+		return parseQuoted(strings.TrimPrefix(line, "title "), &p.graph.Title)
+	case strings.HasPrefix(line, "footer "):
+		if err := parseQuoted(strings.TrimPrefix(line, "footer "), &p.graph.Footer); err != nil {
+			return err
+		}
+		if p.graph.Footer == p.defaults.DefaultFooter {
+			p.graph.Footer = ""
+		}
+		return nil
+	}
+
+	m, err := parseMacro(line)
+	if err != nil {
+		return err
+	}
+
+	fn, ok := plantUMLMacros[m.name]
+	if !ok {
+		return errors.New("unsupported macro " + m.name)
+	}
+	if m.block && m.name != "System_Boundary" {
+		return errors.New("unexpected { after " + m.name)
+	}
+	return fn(p, m)
+}
+
+// plantUMLMacros defines the handlers of the supported C4-PlantUML macros.
+var plantUMLMacros = map[string]func(p *plantUMLParser, m macro) error{
+	"LAYOUT_TOP_DOWN":   withoutArgs(func(g *DiagramGraph) { g.Layout = layoutTopDown }),
+	"LAYOUT_LEFT_RIGHT": withoutArgs(func(g *DiagramGraph) { g.Layout = layoutLeftRight }),
+	"LAYOUT_AS_SKETCH":  withoutArgs(func(g *DiagramGraph) { g.Style = styleSketch }),
+	"LAYOUT_LANDSCAPE":  withoutArgs(func(g *DiagramGraph) { g.Style = styleLandscape }),
+	"SHOW_LEGEND":       withoutArgs(func(g *DiagramGraph) { g.WithLegend = true }),
+
+	"System_Boundary": parseBoundary,
+	"AddRelTag":       parseRelTag,
+
+	"Person":             containerMacro(container{IsUser: true}),
+	"Person_Ext":         containerMacro(container{IsUser: true, IsExternal: true}),
+	"Container":          containerMacro(container{}),
+	"Container_Ext":      containerMacro(container{IsExternal: true}),
+	"ContainerDb":        containerMacro(container{IsDatabase: true}),
+	"ContainerDb_Ext":    containerMacro(container{IsDatabase: true, IsExternal: true}),
+	"ContainerQueue":     containerMacro(container{IsQueue: true}),
+	"ContainerQueue_Ext": containerMacro(container{IsQueue: true, IsExternal: true}),
+
+	"Rel":   relationMacro(""),
+	"Rel_R": relationMacro("LR"),
+	"Rel_L": relationMacro("RL"),
+	"Rel_D": relationMacro("TD"),
+	"Rel_U": relationMacro("DT"),
+}
+
+func withoutArgs(fn func(g *DiagramGraph)) func(p *plantUMLParser, m macro) error {
+	return func(p *plantUMLParser, _ macro) error {
+		fn(&p.graph)
+		return nil
+	}
+}
+
+func parseBoundary(p *plantUMLParser, m macro) error {
+	if !m.block {
+		return errors.New("system boundary must be followed by {")
+	}
+	if p.inBoundary {
+		return errors.New("nested system boundaries are not supported")
+	}
+
+	id := m.positional(0)
+	if id == "" {
+		return errors.New("system boundary must be identified")
+	}
+	p.group = m.positional(1)
+	if p.group == "" {
+		p.group = id
+	}
+	p.inBoundary = true
+	return nil
+}
+
+func containerMacro(kind container) func(p *plantUMLParser, m macro) error {
+	return func(p *plantUMLParser, m macro) error {
+		n := kind
+		if n.ID = m.positional(0); n.ID == "" {
+			return errors.New(m.name + " must be identified")
+		}
+		if n.Label = m.positional(1); n.Label == n.ID {
+			n.Label = ""
+		}
+		n.Technology = m.value(2, "$techn")
+		n.Description = m.value(3, "$descr")
+		n.System = p.group
+		p.graph.Containers = append(p.graph.Containers, &n)
+		return nil
+	}
+}
+
+func relationMacro(direction string) func(p *plantUMLParser, m macro) error {
+	return func(p *plantUMLParser, m macro) error {
+		l := rel{From: m.positional(0), To: m.positional(1), Direction: direction}
+		if l.From == "" || l.To == "" {
+			return errors.New(m.name + " must specify the end nodes")
+		}
+		if l.Label = m.positional(2); l.Label == p.defaults.DefaultRelationLabel {
+			l.Label = ""
+		}
+		l.Technology = m.value(3, "$techn")
+
+		if tags := m.named("$tags"); tags != "" {
+			for _, tag := range strings.Split(tags, "+") {
+				if tag == relTagAsync {
+					l.IsAsync = true
+					continue
+				}
+				l.Tags = append(l.Tags, tag)
+			}
+		}
+
+		p.graph.Rels = append(p.graph.Rels, &l)
+		return nil
+	}
+}
+
+func parseRelTag(p *plantUMLParser, m macro) error {
+	t := relTag{
+		Name:       m.positional(0),
+		TextColor:  m.named("$textColor"),
+		LineColor:  m.named("$lineColor"),
+		Technology: m.named("$techn"),
+		LegendText: m.named("$legendText"),
+	}
+	if t.Name == "" {
+		return errors.New("relation tag must be named")
+	}
+	if s := m.named("$lineStyle"); s != "" {
+		t.LineStyle = strings.ToLower(strings.TrimSuffix(s, "Line()"))
+	}
+	p.graph.RelTags = append(p.graph.RelTags, &t)
+	return nil
+}
+
+// withoutDefaultAsyncTag removes the async relation tag added by the renderer, see relTags.
+func withoutDefaultAsyncTag(tags []*relTag) []*relTag {
+	for i, t := range tags {
+		if *t != (relTag{Name: relTagAsync, LineStyle: "dashed", LegendText: "async"}) {
+			continue
+		}
+		if len(tags) == 1 {
+			return nil
+		}
+		return append(tags[:i:i], tags[i+1:]...)
+	}
+	return tags
+}
+
+// macro defines the C4-PlantUML macro call, e.g. Rel(0, 1, "Uses", $tags="async").
+type macro struct {
+	name string
+	args []macroArg
+	// block defines if the macro opens the block, e.g. System_Boundary(0, "foo") {.
+	block bool
+}
+
+// macroArg defines the macro's argument, the name is set for the named argument, e.g. $tags.
+type macroArg struct {
+	name  string
+	value string
+}
+
+// positional returns the value of the positional argument by its index, or the empty string if it is not set.
+func (m macro) positional(i int) string {
+	var cnt int
+	for _, arg := range m.args {
+		if arg.name != "" {
+			continue
+		}
+		if cnt == i {
+			return arg.value
+		}
+		cnt++
+	}
+	return ""
+}
+
+// named returns the value of the named argument, or the empty string if it is not set.
+func (m macro) named(name string) string {
+	for _, arg := range m.args {
+		if arg.name == name {
+			return arg.value
+		}
+	}
+	return ""
+}
+
+// value returns the value of the argument which can be set either by position, or by name.
+func (m macro) value(i int, name string) string {
+	if v := m.named(name); v != "" {
+		return v
+	}
+	return m.positional(i)
+}
+
+func parseMacro(line string) (macro, error) {
+	var m macro
+	if strings.HasSuffix(line, "{") {
+		m.block = true
+		line = strings.TrimSpace(strings.TrimSuffix(line, "{"))
+	}
+
+	start := strings.Index(line, "(")
+	if start < 1 || !strings.HasSuffix(line, ")") {
+		return macro{}, errors.New("unsupported statement " + line)
+	}
+	m.name = strings.TrimSpace(line[:start])
+
+	args, err := splitArgs(line[start+1 : len(line)-1])
+	if err != nil {
+		return macro{}, errors.New(m.name + ": " + err.Error())
+	}
+	for _, arg := range args {
+		var v macroArg
+		if strings.HasPrefix(arg, "$") {
+			if i := strings.Index(arg, "="); i > 0 {
+				v.name, arg = strings.TrimSpace(arg[:i]), strings.TrimSpace(arg[i+1:])
+			}
+		}
+		if err := parseValue(arg, &v.value); err != nil {
+			return macro{}, errors.New(m.name + ": " + err.Error())
+		}
+		m.args = append(m.args, v)
+	}
+	return m, nil
+}
+
+// splitArgs splits the macro's arguments by the commas outside the quotes and the parentheses.
+func splitArgs(s string) ([]string, error) {
+	var (
+		o        []string
+		depth    int
+		inQuotes bool
+		escaped  bool
+		start    int
+	)
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && inQuotes:
+			escaped = true
+		case r == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			o = append(o, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if inQuotes || depth != 0 {
+		return nil, errors.New("unbalanced quotes or parentheses")
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" || len(o) > 0 {
+		o = append(o, last)
+	}
+	return o, nil
+}
+
+// parseValue reads the argument's value: the quoted string is unescaped, see stringCleaner.
+func parseValue(s string, o *string) error {
+	if !strings.HasPrefix(s, `"`) {
+		*o = s
+		return nil
+	}
+	return parseQuoted(s, o)
+}
+
+func parseQuoted(s string, o *string) error {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || !strings.HasPrefix(s, `"`) || !strings.HasSuffix(s, `"`) {
+		return errors.New("quoted string expected, got: " + s)
+	}
+	*o = stringUnescaper.Replace(s[1 : len(s)-1])
+	return nil
+}
+
+var stringUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n")
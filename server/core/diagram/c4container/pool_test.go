@@ -0,0 +1,244 @@
+package c4container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_plantUMLPool_order(t *testing.T) {
+	t.Run(
+		"shall select the servers in the round-robin order", func(t *testing.T) {
+			// GIVEN
+			pool := newPlantUMLPool("a/", "b/", "c/")
+
+			for _, want := range [][]int{{0, 1, 2}, {1, 2, 0}, {2, 0, 1}, {0, 1, 2}} {
+				// WHEN
+				got := pool.order()
+
+				// THEN
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("unexpected order: got = %v, want = %v", got, want)
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"shall skip the unhealthy server until the cooldown passes", func(t *testing.T) {
+			// GIVEN
+			now := time.Unix(0, 0)
+			pool := newPlantUMLPool("a/", "b/", "c/")
+			pool.now = func() time.Time { return now }
+
+			pool.report(0, true)
+			now = now.Add(time.Second)
+			pool.report(2, true)
+
+			// WHEN
+			got := pool.order()
+
+			// THEN
+			// the unhealthy servers are the last resort, the least recently failed one goes first
+			if want := []int{1, 0, 2}; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected order: got = %v, want = %v", got, want)
+			}
+
+			// WHEN
+			now = now.Add(pool.cooldown)
+			got = pool.order()
+
+			// THEN
+			if want := []int{1, 2, 0}; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected order after cooldown: got = %v, want = %v", got, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall mark the recovered server healthy", func(t *testing.T) {
+			// GIVEN
+			pool := newPlantUMLPool("a/", "b/")
+			pool.report(0, true)
+
+			// WHEN
+			pool.report(0, false)
+
+			// THEN
+			if got := pool.order(); !reflect.DeepEqual(got, []int{0, 1}) {
+				t.Errorf("unexpected order: %v", got)
+			}
+		},
+	)
+}
+
+func Test_callPlantUML(t *testing.T) {
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg"></svg>`
+
+	newHTTPClient := func(statusCodes map[string]int, requests *[]string) mockHTTPClientFn {
+		return func(req *http.Request) (*http.Response, error) {
+			*requests = append(*requests, req.URL.Host)
+			statusCode, ok := statusCodes[req.URL.Host]
+			if !ok {
+				return nil, errors.New("connection refused")
+			}
+			return &http.Response{StatusCode: statusCode, Body: io.NopCloser(strings.NewReader(svg))}, nil
+		}
+	}
+
+	t.Run(
+		"shall retry using the next server given the server failed", func(t *testing.T) {
+			// GIVEN
+			var requests []string
+			httpClient := newHTTPClient(map[string]int{"b": http.StatusOK}, &requests)
+			pool := newPlantUMLPool("http://a/", "http://b/")
+
+			// WHEN
+			got, err := callPlantUML(context.TODO(), httpClient, pool, nil, FormatSVG, "foo")
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != svg {
+				t.Errorf("unexpected diagram: %s", got)
+			}
+			if want := []string{"a", "b"}; !reflect.DeepEqual(requests, want) {
+				t.Errorf("unexpected requests: got = %v, want = %v", requests, want)
+			}
+
+			// WHEN
+			requests = nil
+			if _, err := callPlantUML(context.TODO(), httpClient, pool, nil, FormatSVG, "foo"); err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			// the failed server is skipped
+			if want := []string{"b"}; !reflect.DeepEqual(requests, want) {
+				t.Errorf("unhealthy server shall be skipped: got = %v, want = %v", requests, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given all servers failed", func(t *testing.T) {
+			// GIVEN
+			var requests []string
+			httpClient := newHTTPClient(map[string]int{"b": http.StatusBadGateway}, &requests)
+			pool := newPlantUMLPool("http://a/", "http://b/")
+
+			// WHEN
+			_, err := callPlantUML(context.TODO(), httpClient, pool, nil, FormatSVG, "foo")
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+			if len(requests) != 2 {
+				t.Errorf("unexpected requests: %v", requests)
+			}
+		},
+	)
+
+	t.Run(
+		"shall not retry given the client error", func(t *testing.T) {
+			// GIVEN
+			var requests []string
+			httpClient := newHTTPClient(
+				map[string]int{"a": http.StatusBadRequest, "b": http.StatusOK}, &requests,
+			)
+			pool := newPlantUMLPool("http://a/", "http://b/")
+
+			// WHEN
+			_, err := callPlantUML(context.TODO(), httpClient, pool, nil, FormatSVG, "foo")
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+			if want := []string{"a"}; !reflect.DeepEqual(requests, want) {
+				t.Errorf("unexpected requests: got = %v, want = %v", requests, want)
+			}
+			if !pool.failedAt[0].IsZero() {
+				t.Error("the server shall be healthy")
+			}
+		},
+	)
+
+	t.Run(
+		"shall not retry given the client error reported by the retrying http client", func(t *testing.T) {
+			// GIVEN
+			var requests []string
+			httpClient := mockHTTPClientFn(
+				func(req *http.Request) (*http.Response, error) {
+					requests = append(requests, req.URL.Host)
+					return nil, mockStatusError{statusCode: http.StatusBadRequest}
+				},
+			)
+			pool := newPlantUMLPool("http://a/", "http://b/")
+
+			// WHEN
+			_, err := callPlantUML(context.TODO(), httpClient, pool, nil, FormatSVG, "foo")
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+			if want := []string{"a"}; !reflect.DeepEqual(requests, want) {
+				t.Errorf("unexpected requests: got = %v, want = %v", requests, want)
+			}
+			if !pool.failedAt[0].IsZero() {
+				t.Error("the server shall be healthy")
+			}
+		},
+	)
+}
+
+// mockStatusError mimics the error of the http client which exhausted the retries.
+type mockStatusError struct {
+	statusCode int
+}
+
+func (e mockStatusError) Error() string {
+	return "error status code: " + strconv.Itoa(e.statusCode)
+}
+
+func (e mockStatusError) StatusCode() int {
+	return e.statusCode
+}
+
+func Test_isClientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "client error", err: mockStatusError{statusCode: http.StatusNotFound}, want: true},
+		{
+			name: "wrapped client error",
+			err:  fmt.Errorf("foo: %w", mockStatusError{statusCode: http.StatusBadRequest}),
+			want: true,
+		},
+		{name: "too many requests", err: mockStatusError{statusCode: http.StatusTooManyRequests}},
+		{name: "server error", err: mockStatusError{statusCode: http.StatusBadGateway}},
+		{name: "no response", err: mockStatusError{}},
+		{name: "no status code", err: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := isClientError(tt.err); got != tt.want {
+					t.Errorf("isClientError() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,107 @@
+package c4container
+
+import (
+	"context"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// Renderer renders the diagram's graph in its format, e.g. the organisation's custom format.
+// The renderer of the svg format renders the generated diagrams, hence its Output must implement
+// diagram.OutputSVG, see NewRenderedDiagram.
+type Renderer interface {
+	Render(ctx context.Context, graph DiagramGraph) (diagram.Output, error)
+	// Format identifies the renderer, see Render.
+	Format() Format
+}
+
+// NewRenderedDiagram defines the Output of the diagram rendered in the format which is serialized as is.
+// The Output of the svg diagram implements diagram.OutputSVG.
+func NewRenderedDiagram(v []byte, format Format) diagram.Output {
+	if format == FormatSVG {
+		return renderedSVG{renderedDiagram: v}
+	}
+	return renderedDiagram(v)
+}
+
+type renderedDiagram []byte
+
+func (o renderedDiagram) Serialize() ([]byte, error) {
+	return o, nil
+}
+
+type renderedSVG struct {
+	renderedDiagram
+}
+
+func (o renderedSVG) RawSVG() []byte {
+	return o.renderedDiagram
+}
+
+// WithRenderer registers the renderer of the custom format to render the diagram using Render.
+// The renderer overrides the registered renderer of the same format, including the builtin renderers
+// of svg, png, pdf and dsl.
+func WithRenderer(renderer Renderer) HandlerOps {
+	return func(cfg *renderingConfig) {
+		if renderer == nil {
+			return
+		}
+		if cfg.Renderers == nil {
+			cfg.Renderers = map[Format]Renderer{}
+		}
+		cfg.Renderers[renderer.Format()] = renderer
+	}
+}
+
+// renderers defines the registry of the builtin renderers extended with the renderers set by WithRenderer.
+// The registry is defined per request to render the diagram with the request's config, e.g. the tenant's branding.
+func renderers(httpClient diagram.HTTPClient, cfg renderingConfig) map[Format]Renderer {
+	o := map[Format]Renderer{FormatDSL: dslRenderer{cfg: cfg}}
+	for _, format := range []Format{FormatSVG, FormatPNG, FormatPDF} {
+		o[format] = plantUMLRenderer{httpClient: httpClient, cfg: cfg, format: format}
+	}
+	for format, renderer := range cfg.Renderers {
+		o[format] = renderer
+	}
+	return o
+}
+
+// plantUMLRenderer renders the diagram using the PlantUML server.
+type plantUMLRenderer struct {
+	httpClient diagram.HTTPClient
+	cfg        renderingConfig
+	format     Format
+}
+
+func (r plantUMLRenderer) Render(ctx context.Context, graph DiagramGraph) (diagram.Output, error) {
+	if r.httpClient == nil {
+		return nil, errors.New("http client must be provided")
+	}
+	o, err := renderDiagram(ctx, r.httpClient, &graph, r.cfg, r.format)
+	if err != nil {
+		return nil, err
+	}
+	return NewRenderedDiagram(o, r.format), nil
+}
+
+func (r plantUMLRenderer) Format() Format {
+	return r.format
+}
+
+// dslRenderer renders the diagram as C4-PlantUML code without calling the PlantUML server.
+type dslRenderer struct {
+	cfg renderingConfig
+}
+
+func (r dslRenderer) Render(_ context.Context, graph DiagramGraph) (diagram.Output, error) {
+	o, err := marshal(&graph, r.cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewRenderedDiagram(o, FormatDSL), nil
+}
+
+func (dslRenderer) Format() Format {
+	return FormatDSL
+}
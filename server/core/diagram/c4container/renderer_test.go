@@ -0,0 +1,186 @@
+package c4container
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/logger"
+)
+
+// mockRenderer renders the number of the graph's nodes and links.
+type mockRenderer struct {
+	format Format
+}
+
+func (m mockRenderer) Render(_ context.Context, graph DiagramGraph) (diagram.Output, error) {
+	return NewRenderedDiagram(
+		[]byte(string(m.format)+":"+strconv.Itoa(len(graph.Containers))+":"+strconv.Itoa(len(graph.Rels))), m.format,
+	), nil
+}
+
+func (m mockRenderer) Format() Format {
+	return m.format
+}
+
+func TestWithRenderer(t *testing.T) {
+	graph := []byte(`{"nodes":[{"id":"0"},{"id":"1"}],"links":[{"from":"0","to":"1"}]}`)
+
+	t.Run(
+		"shall render the diagram using the registered renderer selected by the format", func(t *testing.T) {
+			// GIVEN
+			ops := []HandlerOps{WithRenderer(mockRenderer{format: "foo"}), WithRenderer(mockRenderer{format: "bar"})}
+
+			// WHEN
+			got, err := Render(context.TODO(), nil, graph, "bar", ops...)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "bar:2:1" {
+				t.Errorf("unexpected output: %s", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall render the transformed graph", func(t *testing.T) {
+			// GIVEN
+			transformer := GraphTransformerFunc(
+				func(_ context.Context, graph DiagramGraph) (DiagramGraph, error) {
+					graph.Rels = nil
+					return graph, nil
+				},
+			)
+
+			// WHEN
+			got, err := Render(
+				context.TODO(), nil, graph, "foo", WithRenderer(mockRenderer{format: "foo"}),
+				WithGraphTransformer(transformer),
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "foo:2:0" {
+				t.Errorf("unexpected output: %s", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall override the builtin renderer", func(t *testing.T) {
+			// WHEN
+			got, err := Render(context.TODO(), nil, graph, FormatSVG, WithRenderer(mockRenderer{format: FormatSVG}))
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "svg:2:1" {
+				t.Errorf("unexpected output: %s", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall keep the builtin renderers", func(t *testing.T) {
+			// WHEN
+			got, err := Render(context.TODO(), nil, graph, FormatDSL, WithRenderer(mockRenderer{format: "foo"}))
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(got), "@startuml") {
+				t.Errorf("unexpected output: %s", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the unregistered format", func(t *testing.T) {
+			if _, err := Render(context.TODO(), nil, graph, "qux", WithRenderer(mockRenderer{format: "foo"})); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail to render svg without the http client", func(t *testing.T) {
+			if _, err := Render(context.TODO(), nil, graph, FormatSVG); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
+
+// mockSVGRenderer renders the svg diagram with the title of the graph.
+type mockSVGRenderer struct{}
+
+func (mockSVGRenderer) Render(_ context.Context, graph DiagramGraph) (diagram.Output, error) {
+	return NewRenderedDiagram(
+		[]byte(`<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">`+
+			`<g><g><text font-size="5" x="0" y="5">`+graph.Title+`</text></g></g></svg>`), FormatSVG,
+	), nil
+}
+
+func (mockSVGRenderer) Format() Format {
+	return FormatSVG
+}
+
+func TestWithRenderer_HTTPHandler(t *testing.T) {
+	// GIVEN
+	httpClient := mockHTTPClientFn(
+		func(_ *http.Request) (*http.Response, error) {
+			return nil, errors.New("the PlantUML server shall not be called")
+		},
+	)
+	newHandler := func(renderer Renderer) diagram.HTTPHandler {
+		handler, err := NewC4ContainersHTTPHandler(
+			diagram.MockModelInference{V: []byte(`{"nodes":[{"id":"0"}],"title":"foo"}`)}, nil, httpClient,
+			WithLogger(logger.NewNoopLogger()), WithRenderer(renderer),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return handler
+	}
+
+	t.Run(
+		"shall render the generated diagram using the registered svg renderer", func(t *testing.T) {
+			// WHEN
+			got, err := newHandler(mockSVGRenderer{})(
+				context.TODO(), diagram.MockInput{Prompt: "foobar", UserID: placeholderUserID},
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if svg := got.(diagram.OutputSVG).RawSVG(); !strings.Contains(string(svg), ">foo</text>") {
+				t.Errorf("unexpected diagram: %s", svg)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the svg renderer's invalid diagram", func(t *testing.T) {
+			// WHEN
+			_, err := newHandler(mockRenderer{format: FormatSVG})(
+				context.TODO(), diagram.MockInput{Prompt: "foobar", UserID: placeholderUserID},
+			)
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
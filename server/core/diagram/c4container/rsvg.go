@@ -0,0 +1,49 @@
+package c4container
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+const rsvgConvertBinary = "rsvg-convert"
+
+// NewExternalRSVGConverter initialises the optional SVGConverter to rasterize the SVG diagram to png, or to convert it
+// to pdf, see WithPNGRasterizer and WithPDFConverter. The conversion is not done in-process: it runs the external
+// CLI rsvg-convert of the librsvg library which must be installed, e.g. apk add rsvg-convert,
+// hence the initialisation fails if the binary is not found in PATH.
+func NewExternalRSVGConverter(format Format) (SVGConverter, error) {
+	if format != FormatPNG && format != FormatPDF {
+		return nil, errors.New("rsvg-convert does not support the format " + string(format))
+	}
+
+	path, err := exec.LookPath(rsvgConvertBinary)
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+
+	return rsvgConverter{path: path, format: format}, nil
+}
+
+type rsvgConverter struct {
+	path   string
+	format Format
+}
+
+func (c rsvgConverter) Convert(ctx context.Context, svg []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, c.path, "--format", string(c.format))
+	cmd.Stdin = bytes.NewReader(svg)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, errors.New(rsvgConvertBinary + ": " + err.Error() + ": " + strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
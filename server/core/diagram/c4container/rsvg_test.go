@@ -0,0 +1,78 @@
+package c4container
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeRSVGConvert installs the fake rsvg-convert which echoes its arguments and stdin.
+func fakeRSVGConvert(t *testing.T, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, rsvgConvertBinary), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestNewExternalRSVGConverter(t *testing.T) {
+	t.Run(
+		"shall convert svg", func(t *testing.T) {
+			// GIVEN
+			fakeRSVGConvert(t, `echo "$@"; cat`)
+			converter, err := NewExternalRSVGConverter(FormatPNG)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			got, err := converter.Convert(context.TODO(), []byte("<svg/>"))
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "--format png\n<svg/>"; string(got) != want {
+				t.Errorf("unexpected output: got = %q, want = %q", got, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail if conversion fails", func(t *testing.T) {
+			// GIVEN
+			fakeRSVGConvert(t, `echo "faulty svg" >&2; exit 1`)
+			converter, err := NewExternalRSVGConverter(FormatPDF)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			_, err = converter.Convert(context.TODO(), []byte("<svg"))
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail if rsvg-convert is not installed", func(t *testing.T) {
+			t.Setenv("PATH", t.TempDir())
+			if _, err := NewExternalRSVGConverter(FormatPNG); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail for unsupported format", func(t *testing.T) {
+			if _, err := NewExternalRSVGConverter(FormatDSL); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
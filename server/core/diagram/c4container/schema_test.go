@@ -0,0 +1,123 @@
+package c4container
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// validateJSONSchema validates the value against the subset of JSON Schema used by GraphJSONSchema.
+func validateJSONSchema(schema map[string]interface{}, v interface{}, path string) []string {
+	var errs []string
+
+	switch schema["type"] {
+	case "object":
+		o, ok := v.(map[string]interface{})
+		if !ok {
+			return []string{path + ": object expected"}
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := o[name.(string)]; !ok {
+				errs = append(errs, path+"."+name.(string)+": required")
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, value := range o {
+			propertySchema, ok := properties[name].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			errs = append(errs, validateJSONSchema(propertySchema, value, path+"."+name)...)
+		}
+	case "array":
+		o, ok := v.([]interface{})
+		if !ok {
+			return []string{path + ": array expected"}
+		}
+		for i, value := range o {
+			errs = append(
+				errs,
+				validateJSONSchema(schema["items"].(map[string]interface{}), value, path+"["+strconv.Itoa(i)+"]")...,
+			)
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			errs = append(errs, path+": string expected")
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			errs = append(errs, path+": boolean expected")
+		}
+	}
+
+	return errs
+}
+
+func TestGraphJSONSchema(t *testing.T) {
+	got, err := GraphJSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema map[string]interface{}
+	if err := json.Unmarshal(got, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run(
+		"shall define the required properties", func(t *testing.T) {
+			properties := schema["properties"].(map[string]interface{})
+			nodes := properties["nodes"].(map[string]interface{})["items"].(map[string]interface{})
+			links := properties["links"].(map[string]interface{})["items"].(map[string]interface{})
+
+			for name, tt := range map[string]struct {
+				schema map[string]interface{}
+				want   []interface{}
+			}{
+				"graph": {schema: schema, want: []interface{}{"nodes"}},
+				"node":  {schema: nodes, want: []interface{}{"id"}},
+				"link":  {schema: links, want: []interface{}{"from", "to"}},
+			} {
+				if got := tt.schema["required"]; !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: unexpected required properties: got = %v, want = %v", name, got, tt.want)
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"valid graph shall be valid against the schema", func(t *testing.T) {
+			var graph interface{}
+			if err := json.Unmarshal(
+				[]byte(`{"title":"foo","nodes":[{"id":"0","label":"Web","technology":"Go","user":false},{"id":"1"}],`+
+					`"links":[{"from":"0","to":"1","tags":["async"],"async":true}],"legend":false,`+
+					`"rel_tags":[{"name":"async","line_style":"dashed"}]}`),
+				&graph,
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			if errs := validateJSONSchema(schema, graph, "$"); len(errs) > 0 {
+				t.Errorf("unexpected validation errors: %v", errs)
+			}
+		},
+	)
+
+	t.Run(
+		"invalid graph shall be invalid against the schema", func(t *testing.T) {
+			var graph interface{}
+			if err := json.Unmarshal(
+				[]byte(`{"nodes":[{"label":"Web","external":"yes"}],"links":[{"from":"0"}]}`), &graph,
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			errs := validateJSONSchema(schema, graph, "$")
+			if len(errs) != 3 {
+				t.Errorf("unexpected validation errors: %v", errs)
+			}
+		},
+	)
+}
@@ -0,0 +1,45 @@
+package c4container
+
+import (
+	"context"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/errors"
+	"github.com/kislerdm/diagramastext/server/core/logger"
+)
+
+// StorageErrorReporter reports the error of the request's storage, e.g. to the http handler's error sink.
+type StorageErrorReporter func(ctx context.Context, requestID, userID string, err error)
+
+// WithStrictStorage fails the diagram generation if the prompt, the model's result, or the success flag
+// cannot be stored. By default, the storage is best-effort: the error is logged and reported,
+// see WithStorageErrorReporter, and the diagram is returned to the user.
+func WithStrictStorage() HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.StrictStorage = true
+	}
+}
+
+// WithStorageErrorReporter sets the reporter of the storage errors which did not fail the diagram generation.
+func WithStorageErrorReporter(reporter StorageErrorReporter) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.StorageErrorReporter = reporter
+	}
+}
+
+// handleStorageError returns the storage error in the strict mode, see WithStrictStorage,
+// otherwise it logs and reports the error, and returns nil to continue the diagram generation.
+func handleStorageError(ctx context.Context, cfg renderingConfig, input diagram.Input, msg string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if cfg.StrictStorage {
+		return errors.New(msg + ": " + err.Error())
+	}
+
+	cfg.Logger.Warn(msg, logFields(input, logger.Fields{"error": err}))
+	if cfg.StorageErrorReporter != nil {
+		cfg.StorageErrorReporter(ctx, input.GetRequestID(), input.GetUserID(), errors.New(msg+": "+err.Error()))
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package c4container
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/logger"
+)
+
+func TestNewC4ContainersHTTPHandlerStorageErrors(t *testing.T) {
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+
+	var calls int
+	httpClient := mockHTTPClientFn(
+		func(_ *http.Request) (*http.Response, error) {
+			calls++
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg))}, nil
+		},
+	)
+	input := diagram.MockInput{Prompt: "foobar", RequestID: "bar", UserID: placeholderUserID}
+
+	t.Run(
+		"shall return the diagram and report the storage errors in the best-effort mode", func(t *testing.T) {
+			// GIVEN
+			type report struct {
+				requestID, userID string
+				err               error
+			}
+			var reports []report
+			handler, err := NewC4ContainersHTTPHandler(
+				diagram.MockModelInference{V: []byte(`{"nodes":[{"id":"0"}]}`)},
+				diagram.MockRepositoryPrediction{Err: errors.New("foo")},
+				httpClient,
+				WithLogger(logger.NewNoopLogger()),
+				WithStorageErrorReporter(
+					func(_ context.Context, requestID, userID string, err error) {
+						reports = append(reports, report{requestID: requestID, userID: userID, err: err})
+					},
+				),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			got, err := handler(context.TODO(), input)
+
+			// THEN
+			if err != nil {
+				t.Fatalf("the storage error shall not fail the request, got: %v", err)
+			}
+			if v := string(got.(diagram.OutputSVG).RawSVG()); v != svg {
+				t.Errorf("unexpected svg: %s", v)
+			}
+			if len(reports) != 3 {
+				t.Fatalf("the prompt, the model's result and the success flag errors shall be reported, got: %+v", reports)
+			}
+			for _, r := range reports {
+				if r.requestID != "bar" || r.userID != placeholderUserID || !strings.HasSuffix(r.err.Error(), ": foo") {
+					t.Errorf("unexpected report: %+v", r)
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail in the strict mode", func(t *testing.T) {
+			// GIVEN
+			calls = 0
+			handler, err := NewC4ContainersHTTPHandler(
+				diagram.MockModelInference{V: []byte(`{"nodes":[{"id":"0"}]}`)},
+				diagram.MockRepositoryPrediction{Err: errors.New("foo")},
+				httpClient,
+				WithLogger(logger.NewNoopLogger()),
+				WithStrictStorage(),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			_, err = handler(context.TODO(), input)
+
+			// THEN
+			if err == nil || !strings.HasSuffix(err.Error(), "cannot write input prompt: foo") {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if calls != 0 {
+				t.Error("the diagram shall not be rendered")
+			}
+		},
+	)
+}
+
+// mockRepositoryPredictionWithClient records the client's metadata of the written prompts.
+type mockRepositoryPredictionWithClient struct {
+	diagram.MockRepositoryPrediction
+	userAgent, clientVersion string
+}
+
+func (m *mockRepositoryPredictionWithClient) WriteInputPromptWithClient(
+	_ context.Context, _, _, _, userAgent, clientVersion string,
+) error {
+	m.userAgent, m.clientVersion = userAgent, clientVersion
+	return nil
+}
+
+func TestNewC4ContainersHTTPHandlerClientMetadata(t *testing.T) {
+	// GIVEN
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+	repository := &mockRepositoryPredictionWithClient{}
+	handler, err := NewC4ContainersHTTPHandler(
+		diagram.MockModelInference{V: []byte(`{"nodes":[{"id":"0"}]}`)},
+		diagram.NewTracingRepositoryPrediction(repository, &diagram.MockTracer{}),
+		mockHTTPClientFn(
+			func(_ *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg))}, nil
+			},
+		),
+		WithLogger(logger.NewNoopLogger()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// WHEN
+	_, err = handler(
+		context.TODO(), diagram.MockInput{
+			Prompt: "foobar", RequestID: "bar", UserID: placeholderUserID,
+			Client: diagram.ClientMetadata{UserAgent: "Mozilla/5.0", Version: "v1.0.0"},
+		},
+	)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repository.userAgent != "Mozilla/5.0" || repository.clientVersion != "v1.0.0" {
+		t.Errorf("the client's metadata shall be stored, got: %+v", repository)
+	}
+}
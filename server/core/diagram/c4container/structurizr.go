@@ -0,0 +1,756 @@
+package c4container
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	coreErrors "github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// ParseStructurizr converts the Structurizr DSL workspace into the diagram's graph focusing on the container view,
+// e.g. to migrate the diagram from Structurizr. The following subset of the DSL is supported:
+//   - the people, the software systems and their containers defined in the model, and their relationships;
+//   - the software system with containers defines the containers' group, the relationships with it are omitted
+//     because they are implied by the relationships with its containers;
+//   - the element's tags "Database", "Queue" and "External", and the relationship's tag "Async";
+//   - the container view's title and automatic layout direction, the workspace's name is used as the default title.
+//
+// The presentation constructs, e.g. the styles, the themes and the views other than the container view, are ignored.
+// The other constructs, e.g. the groups, the components, or the deployment environments, are rejected.
+func ParseStructurizr(dsl []byte) (DiagramGraph, error) {
+	p := structurizrParser{elements: map[string]*structurizrElement{}}
+	for i, line := range strings.Split(lineBreaksNormalizer.Replace(string(dsl)), "\n") {
+		if err := p.parseLine(line); err != nil {
+			return DiagramGraph{}, coreErrors.New("line " + strconv.Itoa(i+1) + ": " + err.Error())
+		}
+	}
+	if len(p.stack) > 0 {
+		return DiagramGraph{}, coreErrors.New("unbalanced braces: " + strconv.Itoa(len(p.stack)) + " blocks not closed")
+	}
+
+	graph, err := p.graph()
+	if err != nil {
+		return DiagramGraph{}, coreErrors.New(err.Error())
+	}
+	return graph, nil
+}
+
+type structurizrBlock int
+
+const (
+	structurizrWorkspace structurizrBlock = iota
+	structurizrModel
+	structurizrElementBlock
+	structurizrViews
+	structurizrContainerView
+	// structurizrSkipped the block which content is ignored, e.g. the styles.
+	structurizrSkipped
+)
+
+type structurizrFrame struct {
+	block   structurizrBlock
+	element *structurizrElement
+}
+
+const (
+	structurizrPerson         = "person"
+	structurizrSoftwareSystem = "softwareSystem"
+	structurizrContainer      = "container"
+)
+
+type structurizrElement struct {
+	id     string
+	kind   string
+	node   *container
+	parent *structurizrElement
+	// hasContainers defines if the software system has containers, i.e. it defines the containers' group.
+	hasContainers bool
+}
+
+type structurizrRelationship struct {
+	from, to string
+	rel      *rel
+}
+
+type structurizrParser struct {
+	stack         []structurizrFrame
+	elements      map[string]*structurizrElement
+	order         []*structurizrElement
+	relationships []structurizrRelationship
+	hierarchical  bool
+	inComment     bool
+
+	workspaceName string
+	viewTitle     string
+	layout        string
+}
+
+// structurizrToken defines the token of the DSL statement, the quoted string is unquoted.
+type structurizrToken struct {
+	value  string
+	quoted bool
+}
+
+// is checks if the token is the unquoted keyword.
+func (t structurizrToken) is(keyword string) bool {
+	return !t.quoted && t.value == keyword
+}
+
+func (p *structurizrParser) parseLine(line string) error {
+	line = strings.TrimSpace(line)
+	if p.skipComment(line) {
+		return nil
+	}
+
+	tokens, err := structurizrTokens(line)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case tokens[0].is("}"):
+		if len(tokens) > 1 || len(p.stack) == 0 {
+			return errors.New("unexpected }")
+		}
+		p.stack = p.stack[:len(p.stack)-1]
+		return nil
+	case len(p.stack) == 0:
+		return p.parseRoot(tokens)
+	default:
+		return p.parseStatement(tokens)
+	}
+}
+
+// skipComment checks if the line is empty, or it is the comment, including the multi-line comment /* */.
+func (p *structurizrParser) skipComment(line string) bool {
+	switch {
+	case p.inComment:
+		p.inComment = !strings.HasSuffix(line, "*/")
+	case strings.HasPrefix(line, "/*"):
+		p.inComment = !strings.HasSuffix(line, "*/")
+	default:
+		return line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//")
+	}
+	return true
+}
+
+func (p *structurizrParser) parseRoot(tokens []structurizrToken) error {
+	if !tokens[0].is("workspace") || !opensBlock(tokens) || len(tokens) > 1 && tokens[1].is("extends") {
+		return errors.New("workspace definition expected")
+	}
+	if len(tokens) > 2 {
+		p.workspaceName = tokens[1].value
+	}
+	p.push(structurizrWorkspace, nil)
+	return nil
+}
+
+// parseStatement parses the statement given the block it is defined in.
+func (p *structurizrParser) parseStatement(tokens []structurizrToken) error {
+	frame := p.stack[len(p.stack)-1]
+	switch frame.block {
+	case structurizrWorkspace:
+		return p.parseWorkspace(tokens)
+	case structurizrModel:
+		return p.parseModel(tokens, nil)
+	case structurizrElementBlock:
+		return p.parseModel(tokens, frame.element)
+	case structurizrViews:
+		return p.parseViews(tokens)
+	case structurizrContainerView:
+		return p.parseContainerView(tokens)
+	default:
+		if opensBlock(tokens) {
+			p.push(structurizrSkipped, nil)
+		}
+		return nil
+	}
+}
+
+func (p *structurizrParser) push(block structurizrBlock, element *structurizrElement) {
+	p.stack = append(p.stack, structurizrFrame{block: block, element: element})
+}
+
+func opensBlock(tokens []structurizrToken) bool {
+	return tokens[len(tokens)-1].is("{")
+}
+
+func (p *structurizrParser) parseWorkspace(tokens []structurizrToken) error {
+	switch keyword := tokens[0].value; {
+	case tokens[0].is("model") && opensBlock(tokens):
+		p.push(structurizrModel, nil)
+	case tokens[0].is("views") && opensBlock(tokens):
+		p.push(structurizrViews, nil)
+	case tokens[0].is("name") && len(tokens) > 1:
+		p.workspaceName = tokens[1].value
+	case tokens[0].is("!identifiers"):
+		return p.setIdentifiers(tokens)
+	case keyword == "description" || keyword == "!docs" || keyword == "!adrs":
+	case (keyword == "configuration" || keyword == "properties") && opensBlock(tokens):
+		p.push(structurizrSkipped, nil)
+	default:
+		return errors.New("unsupported construct " + keyword + " in workspace")
+	}
+	return nil
+}
+
+func (p *structurizrParser) setIdentifiers(tokens []structurizrToken) error {
+	if len(tokens) < 2 || !tokens[1].is("flat") && !tokens[1].is("hierarchical") {
+		return errors.New("!identifiers must be flat, or hierarchical")
+	}
+	p.hierarchical = tokens[1].is("hierarchical")
+	return nil
+}
+
+// parseModel parses the statement of the model, or of the element's block if the parent element is set.
+func (p *structurizrParser) parseModel(tokens []structurizrToken, parent *structurizrElement) error {
+	if isStructurizrRelationship(tokens) {
+		return p.addRelationship(tokens, parent)
+	}
+
+	if parent != nil {
+		if ok, err := parseElementProperty(tokens, parent.node); ok || err != nil {
+			return err
+		}
+	}
+
+	switch keyword := elementKeyword(tokens); keyword {
+	case structurizrPerson, structurizrSoftwareSystem, structurizrContainer:
+		return p.addElement(tokens, parent)
+	case "!identifiers":
+		if parent != nil {
+			return errors.New("!identifiers must be defined in the model")
+		}
+		return p.setIdentifiers(tokens)
+	case "properties", "perspectives":
+		if opensBlock(tokens) {
+			p.push(structurizrSkipped, nil)
+		}
+		return nil
+	default:
+		return errors.New("unsupported construct " + keyword)
+	}
+}
+
+// elementKeyword returns the keyword of the statement skipping the identifier assignment, e.g. "id = person".
+func elementKeyword(tokens []structurizrToken) string {
+	if len(tokens) > 2 && tokens[1].is("=") {
+		return tokens[2].value
+	}
+	return tokens[0].value
+}
+
+// parseElementProperty sets the element's property defined in its block, e.g. tags "Database".
+func parseElementProperty(tokens []structurizrToken, node *container) (bool, error) {
+	switch {
+	case tokens[0].is("tags"):
+		for _, t := range tokens[1:] {
+			applyStructurizrTags(node, t.value)
+		}
+	case tokens[0].is("description") && len(tokens) == 2:
+		node.Description = tokens[1].value
+	case tokens[0].is("technology") && len(tokens) == 2:
+		node.Technology = tokens[1].value
+	case tokens[0].is("url"):
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func (p *structurizrParser) addElement(tokens []structurizrToken, parent *structurizrElement) error {
+	var id string
+	if tokens[1].is("=") {
+		id, tokens = tokens[0].value, tokens[2:]
+	}
+
+	el := &structurizrElement{id: id, kind: tokens[0].value, parent: parent, node: &container{}}
+	if err := validateStructurizrParent(el.kind, parent); err != nil {
+		return err
+	}
+
+	block := opensBlock(tokens)
+	args := tokens[1:]
+	if block {
+		args = args[:len(args)-1]
+	}
+	if len(args) == 0 {
+		return errors.New(el.kind + " must be named")
+	}
+
+	el.node.Label = args[0].value
+	el.node.IsUser = el.kind == structurizrPerson
+	if len(args) > 1 {
+		el.node.Description = args[1].value
+	}
+	// the container is the only element which defines the technology
+	tagsPosition := 2
+	if el.kind == structurizrContainer {
+		tagsPosition = 3
+		if len(args) > 2 {
+			el.node.Technology = args[2].value
+		}
+	}
+	if len(args) > tagsPosition {
+		applyStructurizrTags(el.node, args[tagsPosition].value)
+	}
+
+	if err := p.register(el); err != nil {
+		return err
+	}
+	if block {
+		p.push(structurizrElementBlock, el)
+	}
+	return nil
+}
+
+// validateStructurizrParent checks that the container is defined in the software system,
+// and the other elements are defined in the model.
+func validateStructurizrParent(kind string, parent *structurizrElement) error {
+	switch {
+	case kind == structurizrContainer && (parent == nil || parent.kind != structurizrSoftwareSystem):
+		return errors.New("container must be defined in the software system")
+	case kind != structurizrContainer && parent != nil:
+		return errors.New(kind + " must be defined in the model")
+	}
+	return nil
+}
+
+// register adds the element to the model, the element is identified by its identifier, or by its position.
+func (p *structurizrParser) register(el *structurizrElement) error {
+	if el.parent != nil {
+		el.parent.hasContainers = true
+		if p.hierarchical && el.id != "" {
+			el.id = el.parent.id + "." + el.id
+		}
+	}
+	if el.id == "" {
+		el.id = strconv.Itoa(len(p.order))
+	}
+	if _, ok := p.elements[el.id]; ok {
+		return errors.New("duplicate element " + el.id)
+	}
+
+	el.node.ID = strings.ReplaceAll(el.id, ".", "_")
+	p.elements[el.id] = el
+	p.order = append(p.order, el)
+	return nil
+}
+
+// applyStructurizrTags sets the container's type given the element's comma-separated tags.
+func applyStructurizrTags(node *container, tags string) {
+	for _, tag := range strings.Split(tags, ",") {
+		switch strings.ToLower(strings.TrimSpace(tag)) {
+		case "database":
+			node.IsDatabase = true
+		case "queue":
+			node.IsQueue = true
+		case "external":
+			node.IsExternal = true
+		}
+	}
+}
+
+// isStructurizrRelationship checks if the statement defines the relationship, e.g. "a -> b", "-> b", or "r = a -> b".
+func isStructurizrRelationship(tokens []structurizrToken) bool {
+	for _, t := range tokens {
+		if t.is("->") {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *structurizrParser) addRelationship(tokens []structurizrToken, parent *structurizrElement) error {
+	if len(tokens) > 2 && tokens[1].is("=") {
+		tokens = tokens[2:]
+	}
+	if opensBlock(tokens) {
+		p.push(structurizrSkipped, nil)
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	var from string
+	switch {
+	case tokens[0].is("->") && parent != nil:
+		from, tokens = parent.id, tokens[1:]
+	case len(tokens) > 2 && tokens[1].is("->"):
+		from, tokens = tokens[0].value, tokens[2:]
+	default:
+		return errors.New("relationship must define the source and the destination")
+	}
+	if len(tokens) == 0 {
+		return errors.New("relationship must define the destination")
+	}
+
+	l := &rel{}
+	if len(tokens) > 1 {
+		l.Label = tokens[1].value
+	}
+	if len(tokens) > 2 {
+		l.Technology = tokens[2].value
+	}
+	if len(tokens) > 3 {
+		for _, tag := range strings.Split(tokens[3].value, ",") {
+			if strings.EqualFold(strings.TrimSpace(tag), relTagAsync) {
+				l.IsAsync = true
+			}
+		}
+	}
+
+	p.relationships = append(p.relationships, structurizrRelationship{from: from, to: tokens[0].value, rel: l})
+	return nil
+}
+
+func (p *structurizrParser) parseViews(tokens []structurizrToken) error {
+	switch keyword := tokens[0].value; {
+	case tokens[0].is(structurizrContainer) && opensBlock(tokens):
+		p.push(structurizrContainerView, nil)
+		return nil
+	case keyword == "theme" || keyword == "themes":
+		return nil
+	case opensBlock(tokens) && !tokens[0].quoted:
+		// the other views, and the presentation settings, e.g. styles
+		p.push(structurizrSkipped, nil)
+		return nil
+	default:
+		return errors.New("unsupported construct " + keyword + " in views")
+	}
+}
+
+func (p *structurizrParser) parseContainerView(tokens []structurizrToken) error {
+	switch keyword := tokens[0].value; {
+	case tokens[0].is("autolayout") || tokens[0].is("autoLayout"):
+		p.layout = layoutTopDown
+		if len(tokens) > 1 && (tokens[1].is("lr") || tokens[1].is("rl")) {
+			p.layout = layoutLeftRight
+		}
+	case tokens[0].is("title") && len(tokens) > 1:
+		p.viewTitle = tokens[1].value
+	case keyword == "include" || keyword == "exclude" || keyword == "description" || keyword == "default":
+	case opensBlock(tokens):
+		p.push(structurizrSkipped, nil)
+	default:
+		return errors.New("unsupported construct " + keyword + " in container view")
+	}
+	return nil
+}
+
+// graph defines the diagram's graph given the parsed model and the container view.
+func (p *structurizrParser) graph() (DiagramGraph, error) {
+	var o DiagramGraph
+	for _, el := range p.order {
+		if el.hasContainers {
+			continue
+		}
+		if el.parent != nil {
+			el.node.System = el.parent.node.Label
+		}
+		o.Containers = append(o.Containers, el.node)
+	}
+	if len(o.Containers) == 0 {
+		return DiagramGraph{}, errors.New("no elements found")
+	}
+
+	for _, r := range p.relationships {
+		from, ok := p.elements[r.from]
+		if !ok {
+			return DiagramGraph{}, errors.New("relationship source " + r.from + " is not defined")
+		}
+		to, ok := p.elements[r.to]
+		if !ok {
+			return DiagramGraph{}, errors.New("relationship destination " + r.to + " is not defined")
+		}
+		// the relationship with the software system is implied by the relationships with its containers
+		if from.hasContainers || to.hasContainers {
+			continue
+		}
+		r.rel.From, r.rel.To = from.node.ID, to.node.ID
+		o.Rels = append(o.Rels, r.rel)
+	}
+
+	o.Title = p.workspaceName
+	if p.viewTitle != "" {
+		o.Title = p.viewTitle
+	}
+	o.Layout = p.layout
+	return o, nil
+}
+
+// structurizrTokens splits the DSL statement into the tokens separated by the whitespaces.
+func structurizrTokens(line string) ([]structurizrToken, error) {
+	var (
+		o       []structurizrToken
+		current strings.Builder
+		quoted  bool
+		inQuote bool
+		escaped bool
+	)
+	flush := func() {
+		if current.Len() > 0 || quoted {
+			o = append(o, structurizrToken{value: current.String(), quoted: quoted})
+		}
+		current.Reset()
+		quoted = false
+	}
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case inQuote && r == '\\':
+			escaped = true
+		case r == '"':
+			if !inQuote {
+				flush()
+			}
+			quoted = true
+			inQuote = !inQuote
+			if !inQuote {
+				flush()
+			}
+		case inQuote:
+			current.WriteRune(r)
+		case r == ' ' || r == '\t':
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if inQuote {
+		return nil, errors.New("unbalanced quotes")
+	}
+	flush()
+	return o, nil
+}
+
+// RenderStructurizr renders the diagram's graph as the Structurizr DSL workspace with the container view,
+// e.g. to take the diagram to the Structurizr ecosystem. The graph is mapped as follows:
+//   - the users are the people, and the other nodes are the containers;
+//   - the groups are the software systems, the nodes without group belong to the software system named
+//     after the diagram's title;
+//   - the database, the queue and the external nodes are tagged "Database", "Queue" and "External" respectively;
+//   - the relations are the relationships, the async relations are tagged "async";
+//   - every software system has the container view with the automatic layout following the diagram's layout.
+//
+// The presentation attributes, i.e. the relations' directions and tags styles, the style and the footer, are omitted.
+func RenderStructurizr(graph DiagramGraph) (string, error) {
+	w, err := newStructurizrWriter(graph)
+	if err != nil {
+		return "", coreErrors.New(err.Error())
+	}
+	return w.write(), nil
+}
+
+const (
+	structurizrDefaultSystem = "Software System"
+	structurizrIndent        = "    "
+)
+
+// structurizrSystem defines the software system with its containers.
+type structurizrSystem struct {
+	id         string
+	name       string
+	containers []*container
+}
+
+type structurizrWriter struct {
+	graph   DiagramGraph
+	ids     map[string]string
+	people  []*container
+	systems []*structurizrSystem
+	o       bytes.Buffer
+}
+
+func newStructurizrWriter(graph DiagramGraph) (*structurizrWriter, error) {
+	if len(graph.Containers) == 0 {
+		return nil, errors.New("no containers found")
+	}
+
+	w := &structurizrWriter{graph: graph, ids: map[string]string{}}
+	used := map[string]struct{}{}
+	for _, n := range graph.Containers {
+		if _, ok := w.ids[n.ID]; ok || n.ID == "" {
+			return nil, errors.New("container must be uniquely identified: 'id' attribute")
+		}
+		id := structurizrIdentifier(n.ID)
+		if _, ok := used[id]; ok {
+			return nil, errors.New("container's identifier " + id + " is not unique")
+		}
+		w.ids[n.ID] = id
+		used[id] = struct{}{}
+	}
+
+	for _, l := range graph.Rels {
+		if _, ok := w.ids[l.From]; !ok {
+			return nil, errors.New("relation's source " + l.From + " is not defined")
+		}
+		if _, ok := w.ids[l.To]; !ok {
+			return nil, errors.New("relation's destination " + l.To + " is not defined")
+		}
+	}
+
+	w.groupContainers(used)
+	return w, nil
+}
+
+// groupContainers splits the nodes into the people and the software systems in the order of their appearance.
+func (w *structurizrWriter) groupContainers(used map[string]struct{}) {
+	defaultSystem := w.graph.Title
+	if defaultSystem == "" {
+		defaultSystem = structurizrDefaultSystem
+	}
+
+	systems := map[string]*structurizrSystem{}
+	for _, n := range w.graph.Containers {
+		if n.IsUser {
+			w.people = append(w.people, n)
+			continue
+		}
+
+		name := n.System
+		if name == "" {
+			name = defaultSystem
+		}
+		s, ok := systems[name]
+		if !ok {
+			s = &structurizrSystem{name: name, id: uniqueIdentifier("system"+strconv.Itoa(len(w.systems)), used)}
+			systems[name] = s
+			w.systems = append(w.systems, s)
+		}
+		s.containers = append(s.containers, n)
+	}
+}
+
+func (w *structurizrWriter) write() string {
+	w.writeLine(0, "workspace", structurizrArgs(w.graph.Title), " {")
+	w.writeLine(1, "model {")
+	for _, n := range w.people {
+		w.writeLine(2, w.ids[n.ID], " = person", structurizrArgs(nodeLabel(n), n.Description, structurizrTags(n)))
+	}
+	for _, s := range w.systems {
+		w.writeLine(2, s.id, " = softwareSystem", structurizrArgs(s.name), " {")
+		for _, n := range s.containers {
+			w.writeLine(
+				3, w.ids[n.ID], " = container",
+				structurizrArgs(nodeLabel(n), n.Description, n.Technology, structurizrTags(n)),
+			)
+		}
+		w.writeLine(2, "}")
+	}
+	for _, l := range w.graph.Rels {
+		var tags []string
+		if l.IsAsync {
+			tags = append(tags, relTagAsync)
+		}
+		tags = append(tags, l.Tags...)
+		w.writeLine(
+			2, w.ids[l.From], " -> ", w.ids[l.To],
+			structurizrArgs(l.Label, l.Technology, strings.Join(tags, ",")),
+		)
+	}
+	w.writeLine(1, "}")
+
+	autolayout := "tb"
+	if w.graph.Layout == layoutLeftRight {
+		autolayout = "lr"
+	}
+	w.writeLine(1, "views {")
+	for _, s := range w.systems {
+		w.writeLine(2, "container ", s.id, " {")
+		w.writeLine(3, "include *")
+		w.writeLine(3, "autolayout ", autolayout)
+		w.writeLine(2, "}")
+	}
+	w.o.WriteString(structurizrStyles)
+	w.writeLine(1, "}")
+	w.writeLine(0, "}")
+	return w.o.String()
+}
+
+func (w *structurizrWriter) writeLine(indent int, s ...string) {
+	w.o.WriteString(strings.Repeat(structurizrIndent, indent))
+	writeStrings(&w.o, s...)
+	w.o.WriteString("\n")
+}
+
+// structurizrStyles defines the shapes of the elements following the C4-PlantUML rendering.
+const structurizrStyles = `        styles {
+            element "Person" {
+                shape Person
+            }
+            element "Database" {
+                shape Cylinder
+            }
+            element "Queue" {
+                shape Pipe
+            }
+            element "External" {
+                background #999999
+            }
+            relationship "async" {
+                dashed true
+            }
+        }
+`
+
+// nodeLabel returns the node's label, or its ID if the label is not set following the C4-PlantUML rendering.
+func nodeLabel(n *container) string {
+	if n.Label == "" {
+		return n.ID
+	}
+	return n.Label
+}
+
+func structurizrTags(n *container) string {
+	var tags []string
+	for tag, ok := range map[string]bool{"Database": n.IsDatabase, "Queue": n.IsQueue, "External": n.IsExternal} {
+		if ok {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, ",")
+}
+
+// structurizrArgs renders the quoted arguments prefixed with the whitespace omitting the trailing empty ones.
+func structurizrArgs(args ...string) string {
+	for len(args) > 0 && args[len(args)-1] == "" {
+		args = args[:len(args)-1]
+	}
+	var o strings.Builder
+	for _, arg := range args {
+		o.WriteString(` "` + structurizrEscaper.Replace(arg) + `"`)
+	}
+	return o.String()
+}
+
+// structurizrEscaper escapes the quoted string, the DSL does not support the multi-line strings.
+var structurizrEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r\n", " ", "\n", " ", "\r", " ")
+
+// structurizrIdentifier converts the node's ID into the DSL identifier, i.e. [a-zA-Z0-9_-]+.
+func structurizrIdentifier(id string) string {
+	return strings.Map(
+		func(r rune) rune {
+			if r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return '_'
+		}, id,
+	)
+}
+
+// uniqueIdentifier returns the identifier not used by the other elements, and marks it as used.
+func uniqueIdentifier(id string, used map[string]struct{}) string {
+	for {
+		if _, ok := used[id]; !ok {
+			used[id] = struct{}{}
+			return id
+		}
+		id += "_"
+	}
+}
@@ -0,0 +1,299 @@
+package c4container
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStructurizr(t *testing.T) {
+	t.Run(
+		"shall convert the workspace into the graph", func(t *testing.T) {
+			// GIVEN
+			dsl := `workspace "Diagrams as text" "The C4 diagrams generator" {
+    !identifiers hierarchical
+
+    /*
+        the model
+    */
+    model {
+        user = person "User" "Describes the diagram"
+        diagrams = softwareSystem "Diagrams as text" {
+            webapp = container "Web App" "Renders the \"diagrams\"" "JavaScript"
+            backend = container "Backend" {
+                technology "Go"
+                description "Generates the diagrams"
+                -> diagrams.events "Publishes" "" "Async"
+            }
+            events = container "Events" "" "Kafka" "Queue"
+            db = container "Database" "" "Postgres" {
+                tags "Database"
+            }
+        }
+        openai = softwareSystem "OpenAI" "Predicts the graph" "External"
+
+        user -> diagrams "Uses"
+        user -> diagrams.webapp "Visits" "HTTPS"
+        diagrams.webapp -> diagrams.backend "Calls" "JSON/HTTPS"
+        read = diagrams.backend -> diagrams.db "Reads"
+        diagrams.backend -> openai
+    }
+
+    views {
+        systemContext diagrams {
+            include *
+            autolayout lr
+        }
+        container diagrams "containers" {
+            title "Diagrams as text: containers"
+            include *
+            autolayout lr
+        }
+        styles {
+            element "Database" {
+                shape Cylinder
+            }
+        }
+        theme default
+    }
+}
+`
+			// WHEN
+			got, err := ParseStructurizr([]byte(dsl))
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := DiagramGraph{
+				Containers: []*Container{
+					{ID: "user", Label: "User", Description: "Describes the diagram", IsUser: true},
+					{
+						ID: "diagrams_webapp", Label: "Web App", Technology: "JavaScript",
+						Description: `Renders the "diagrams"`, System: "Diagrams as text",
+					},
+					{
+						ID: "diagrams_backend", Label: "Backend", Technology: "Go",
+						Description: "Generates the diagrams", System: "Diagrams as text",
+					},
+					{ID: "diagrams_events", Label: "Events", Technology: "Kafka", IsQueue: true, System: "Diagrams as text"},
+					{ID: "diagrams_db", Label: "Database", Technology: "Postgres", IsDatabase: true, System: "Diagrams as text"},
+					{ID: "openai", Label: "OpenAI", Description: "Predicts the graph", IsExternal: true},
+				},
+				Rels: []*Relation{
+					{From: "diagrams_backend", To: "diagrams_events", Label: "Publishes", IsAsync: true},
+					{From: "user", To: "diagrams_webapp", Label: "Visits", Technology: "HTTPS"},
+					{From: "diagrams_webapp", To: "diagrams_backend", Label: "Calls", Technology: "JSON/HTTPS"},
+					{From: "diagrams_backend", To: "diagrams_db", Label: "Reads"},
+					{From: "diagrams_backend", To: "openai"},
+				},
+				Title:  "Diagrams as text: containers",
+				Layout: layoutLeftRight,
+			}
+			if !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(want)
+				t.Errorf("unexpected graph: got = %s, want = %s", gotJSON, wantJSON)
+			}
+		},
+	)
+
+	t.Run(
+		"shall identify the elements without identifiers by their position", func(t *testing.T) {
+			// GIVEN
+			dsl := "workspace {\nmodel {\nperson \"User\"\nsoftwareSystem \"Foo\" {\n-> \"1\"\n}\n}\n}"
+
+			// WHEN
+			got, err := ParseStructurizr([]byte(dsl))
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := DiagramGraph{
+				Containers: []*Container{{ID: "0", Label: "User", IsUser: true}, {ID: "1", Label: "Foo"}},
+				Rels:       []*Relation{{From: "1", To: "1"}},
+			}
+			if !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Errorf("unexpected graph: got = %s", gotJSON)
+			}
+		},
+	)
+
+	t.Run(
+		"shall reject the unsupported constructs", func(t *testing.T) {
+			for name, dsl := range map[string]string{
+				"no workspace":          `model {`,
+				"extended workspace":    `workspace extends "foo.dsl" {`,
+				"group":                 "workspace {\nmodel {\ngroup \"foo\" {\n}\n}\n}",
+				"component":             "workspace {\nmodel {\ns = softwareSystem \"s\" {\nc = container \"c\" {\ncomponent \"foo\"\n}\n}\n}\n}",
+				"deployment":            "workspace {\nmodel {\ndeploymentEnvironment \"live\" {\n}\n}\n}",
+				"orphan container":      "workspace {\nmodel {\ncontainer \"foo\"\n}\n}",
+				"undefined destination": "workspace {\nmodel {\na = person \"a\"\na -> b\n}\n}",
+				"duplicate identifier":  "workspace {\nmodel {\na = person \"a\"\na = person \"b\"\n}\n}",
+				"unclosed block":        "workspace {\nmodel {\nperson \"a\"\n}",
+				"unexpected brace":      "workspace {\n}\n}",
+				"unbalanced quotes":     "workspace {\nmodel {\nperson \"a\n}\n}",
+				"no elements":           "workspace {\nmodel {\n}\n}",
+			} {
+				t.Run(
+					name, func(t *testing.T) {
+						// WHEN
+						_, err := ParseStructurizr([]byte(dsl))
+
+						// THEN
+						if err == nil {
+							t.Error("error expected")
+						}
+					},
+				)
+			}
+		},
+	)
+
+	t.Run(
+		"shall report the line of the error", func(t *testing.T) {
+			// WHEN
+			_, err := ParseStructurizr([]byte("workspace {\nmodel {\nenterprise \"foo\" {\n}\n}\n}"))
+
+			// THEN
+			if err == nil || !strings.Contains(err.Error(), "line 3: unsupported construct enterprise") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		},
+	)
+}
+
+func TestRenderStructurizr(t *testing.T) {
+	t.Run(
+		"shall render the template", func(t *testing.T) {
+			// GIVEN
+			graph := *templates["event-driven"]
+			graph.Layout = layoutLeftRight
+
+			// WHEN
+			got, err := RenderStructurizr(graph)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := `workspace "Event-driven system" {
+    model {
+        user = person "User"
+        system0 = softwareSystem "Event-driven system" {
+            api = container "API" "" "Go"
+            broker = container "Events Broker" "" "Kafka" "Queue"
+            db = container "Database" "" "PostgreSQL" "Database"
+        }
+        system1 = softwareSystem "Consumers" {
+            orders = container "Orders Service" "" "Go"
+            notifications = container "Notifications Service" "" "Python"
+        }
+        user -> api "Uses" "HTTPS"
+        api -> broker "Publishes events" "" "async"
+        orders -> broker "Consumes events" "" "async"
+        notifications -> broker "Consumes events" "" "async"
+        orders -> db "Reads/Writes" "TCP"
+    }
+    views {
+        container system0 {
+            include *
+            autolayout lr
+        }
+        container system1 {
+            include *
+            autolayout lr
+        }
+` + structurizrStyles + `    }
+}
+`
+			if got != want {
+				t.Errorf("unexpected DSL: got = %s, want = %s", got, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall render the graph which is parsed back", func(t *testing.T) {
+			graphs := map[string]DiagramGraph{}
+			for name, graph := range templates {
+				graphs[name] = *graph
+			}
+			for _, e := range defaultExamples {
+				graphs[e.prompt] = *e.graph
+			}
+
+			for name, graph := range graphs {
+				t.Run(
+					name, func(t *testing.T) {
+						// WHEN
+						dsl, err := RenderStructurizr(graph)
+						if err != nil {
+							t.Fatal(err)
+						}
+						got, err := ParseStructurizr([]byte(dsl))
+
+						// THEN
+						if err != nil {
+							t.Fatal(err)
+						}
+						if got.Title != graph.Title || len(got.Containers) != len(graph.Containers) ||
+							len(got.Rels) != len(graph.Rels) {
+							t.Fatalf("unexpected graph: %s", dsl)
+						}
+
+						nodes := map[string]Container{}
+						for _, n := range got.Containers {
+							nodes[n.ID] = *n
+						}
+						// the nodes without group belong to the software system named after the title
+						defaultSystem := graph.Title
+						if defaultSystem == "" {
+							defaultSystem = structurizrDefaultSystem
+						}
+						for _, want := range graph.Containers {
+							n := *want
+							if !n.IsUser && n.System == "" {
+								n.System = defaultSystem
+							}
+							if nodes[n.ID] != n {
+								t.Errorf("unexpected node: got = %+v, want = %+v", nodes[n.ID], n)
+							}
+						}
+						for i, want := range graph.Rels {
+							if !reflect.DeepEqual(*got.Rels[i], *want) {
+								t.Errorf("unexpected relation: got = %+v, want = %+v", *got.Rels[i], *want)
+							}
+						}
+					},
+				)
+			}
+		},
+	)
+
+	t.Run(
+		"shall not render the invalid graph", func(t *testing.T) {
+			for name, graph := range map[string]DiagramGraph{
+				"no containers":         {},
+				"duplicate ids":         {Containers: []*Container{{ID: "0"}, {ID: "0"}}},
+				"duplicate identifiers": {Containers: []*Container{{ID: "a.b"}, {ID: "a_b"}}},
+				"undefined destination": {Containers: []*Container{{ID: "0"}}, Rels: []*Relation{{From: "0", To: "1"}}},
+			} {
+				t.Run(
+					name, func(t *testing.T) {
+						// WHEN
+						_, err := RenderStructurizr(graph)
+
+						// THEN
+						if err == nil {
+							t.Error("error expected")
+						}
+					},
+				)
+			}
+		},
+	)
+}
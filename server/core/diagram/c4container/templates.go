@@ -0,0 +1,66 @@
+package c4container
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// templates defines the graphs of the common architectures used as the starting points of the diagrams.
+var templates = map[string]*c4ContainersGraph{
+	"web-app": {
+		Title: "Three-tier web application",
+		Containers: []*container{
+			{ID: "user", Label: "User", IsUser: true},
+			{ID: "web", Label: "Web Application", Technology: "JavaScript, React", System: "Web Application"},
+			{ID: "api", Label: "API", Technology: "Go", System: "Web Application"},
+			{ID: "db", Label: "Database", Technology: "PostgreSQL", IsDatabase: true, System: "Web Application"},
+		},
+		Rels: []*rel{
+			{From: "user", To: "web", Label: "Uses", Technology: "HTTPS"},
+			{From: "web", To: "api", Label: "Calls", Technology: "HTTPS/JSON"},
+			{From: "api", To: "db", Label: "Reads/Writes", Technology: "TCP"},
+		},
+		WithLegend: true,
+	},
+	"event-driven": {
+		Title: "Event-driven system",
+		Containers: []*container{
+			{ID: "user", Label: "User", IsUser: true},
+			{ID: "api", Label: "API", Technology: "Go"},
+			{ID: "broker", Label: "Events Broker", Technology: "Kafka", IsQueue: true},
+			{ID: "orders", Label: "Orders Service", Technology: "Go", System: "Consumers"},
+			{ID: "notifications", Label: "Notifications Service", Technology: "Python", System: "Consumers"},
+			{ID: "db", Label: "Database", Technology: "PostgreSQL", IsDatabase: true},
+		},
+		Rels: []*rel{
+			{From: "user", To: "api", Label: "Uses", Technology: "HTTPS"},
+			{From: "api", To: "broker", Label: "Publishes events", IsAsync: true},
+			{From: "orders", To: "broker", Label: "Consumes events", IsAsync: true},
+			{From: "notifications", To: "broker", Label: "Consumes events", IsAsync: true},
+			{From: "orders", To: "db", Label: "Reads/Writes", Technology: "TCP"},
+		},
+		WithLegend: true,
+	},
+}
+
+// Templates lists the names of the available templates in alphabetical order.
+func Templates() []string {
+	o := make([]string, 0, len(templates))
+	for name := range templates {
+		o = append(o, name)
+	}
+	sort.Strings(o)
+	return o
+}
+
+// Template returns the JSON-encoded graph of the common architecture by the name, e.g. "web-app".
+// The graph can be modified, e.g. using ApplyDiff, and rendered using Render. See Templates for the names.
+func Template(name string) ([]byte, error) {
+	graph, ok := templates[name]
+	if !ok {
+		return nil, errors.New("unknown template " + name)
+	}
+	return json.Marshal(graph)
+}
@@ -0,0 +1,45 @@
+package c4container
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTemplates(t *testing.T) {
+	want := []string{"event-driven", "web-app"}
+	if got := Templates(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Templates() = %v, want %v", got, want)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	for _, name := range Templates() {
+		t.Run(
+			"shall render the template "+name, func(t *testing.T) {
+				// WHEN
+				graph, err := Template(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := Render(context.TODO(), nil, graph, FormatDSL)
+
+				// THEN
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) == 0 {
+					t.Error("diagram expected")
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"shall fail given unknown template", func(t *testing.T) {
+			if _, err := Template("foo"); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
@@ -0,0 +1,125 @@
+package c4container
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/errors"
+	"github.com/kislerdm/diagramastext/server/core/logger"
+)
+
+// Titler derives the diagram's title from the user's prompt.
+type Titler interface {
+	Title(ctx context.Context, prompt string) (string, error)
+}
+
+// TitlerFunc the adapter to use the function as Titler.
+type TitlerFunc func(ctx context.Context, prompt string) (string, error)
+
+func (f TitlerFunc) Title(ctx context.Context, prompt string) (string, error) {
+	return f(ctx, prompt)
+}
+
+// defaultTitleLengthMax the maximum number of characters of the derived title.
+const defaultTitleLengthMax = 60
+
+// NewPromptTitler initialises the Titler which uses the first sentence of the prompt as the title.
+// The title exceeding maxLength characters is truncated with the ellipsis, the default limit is 60.
+func NewPromptTitler(maxLength int) Titler {
+	if maxLength <= 0 {
+		maxLength = defaultTitleLengthMax
+	}
+	return TitlerFunc(
+		func(_ context.Context, prompt string) (string, error) {
+			return stringLengthCapper(firstSentence(prompt), maxLength, false)
+		},
+	)
+}
+
+// firstSentence returns the text up to the first sentence's terminal punctuation, e.g. "C4 diagram of foo".
+func firstSentence(s string) string {
+	s = strings.Join(strings.Fields(s), " ") + " "
+	for i, r := range s {
+		if (r == '.' || r == '!' || r == '?') && s[i+1] == ' ' {
+			return s[:i]
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+const contentSystemTitle = `Generate a concise title of at most eight words for the diagram described by the user.
+Respond with JSON {"title":"<title>"}.`
+
+// NewModelTitler initialises the Titler which asks the model to summarise the prompt as the title.
+// The client shall not prepend the diagrams' examples to the prompt, e.g. the examples of openai.Config.
+// The title exceeding maxLength characters is truncated with the ellipsis, the default limit is 60.
+// It fails if the model responds with the empty title.
+// Note that the model's tokens spent on the title are not recorded.
+func NewModelTitler(client diagram.ModelInference, model string, maxLength int) (Titler, error) {
+	if client == nil {
+		return nil, errors.New("model inference client must be provided")
+	}
+	if model == "" {
+		return nil, errors.New("model must be provided")
+	}
+	if maxLength <= 0 {
+		maxLength = defaultTitleLengthMax
+	}
+	return TitlerFunc(
+		func(ctx context.Context, prompt string) (string, error) {
+			_, prediction, _, _, err := client.Do(ctx, prompt, contentSystemTitle, model)
+			if err != nil {
+				return "", err
+			}
+			var v struct {
+				Title string `json:"title"`
+			}
+			if err := json.Unmarshal(prediction, &v); err != nil {
+				return "", err
+			}
+			if strings.TrimSpace(v.Title) == "" {
+				return "", errors.New("model responded with the empty title")
+			}
+			return stringLengthCapper(v.Title, maxLength, false)
+		},
+	), nil
+}
+
+// WithAutoTitle sets the title of the generated diagrams which do not define it using the titler,
+// e.g. NewPromptTitler, or NewModelTitler. The title defined by the model is kept.
+// The diagram is rendered without the title if the titler fails. The auto title is disabled by default.
+func WithAutoTitle(titler Titler) HandlerOps {
+	return func(cfg *renderingConfig) {
+		cfg.Titler = titler
+	}
+}
+
+// autoTitle sets the title derived from the prompt to the graphs which do not define it.
+func autoTitle(
+	ctx context.Context, cfg renderingConfig, input diagram.Input, prompt string, graphs []*c4ContainersGraph,
+) {
+	if cfg.Titler == nil {
+		return
+	}
+
+	var untitled []*c4ContainersGraph
+	for _, graph := range graphs {
+		if strings.TrimSpace(graph.Title) == "" {
+			untitled = append(untitled, graph)
+		}
+	}
+	if len(untitled) == 0 {
+		return
+	}
+
+	title, err := cfg.Titler.Title(ctx, prompt)
+	if err != nil {
+		cfg.Logger.Warn("cannot derive the diagram's title", logFields(input, logger.Fields{"error": err}))
+		return
+	}
+	for _, graph := range untitled {
+		graph.Title = title
+	}
+}
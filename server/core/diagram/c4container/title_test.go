@@ -0,0 +1,203 @@
+package c4container
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/logger"
+)
+
+func TestAutoTitle(t *testing.T) {
+	input := diagram.MockInput{Prompt: "foobar", RequestID: "bar", UserID: placeholderUserID}
+	newConfig := func(fnOps ...HandlerOps) renderingConfig {
+		cfg := defaultRenderingConfig()
+		cfg.Logger = logger.NewNoopLogger()
+		for _, fn := range fnOps {
+			fn(&cfg)
+		}
+		return cfg
+	}
+
+	t.Run(
+		"shall keep the explicit title, and fill the blank one given auto title", func(t *testing.T) {
+			// GIVEN
+			graphs := []*c4ContainersGraph{{Title: "foo"}, {Title: " "}}
+			cfg := newConfig(WithAutoTitle(NewPromptTitler(0)))
+
+			// WHEN
+			autoTitle(context.TODO(), cfg, input, "C4 diagram of the web app. It calls the database.", graphs)
+
+			// THEN
+			if graphs[0].Title != "foo" {
+				t.Errorf("the explicit title shall be kept, got: %s", graphs[0].Title)
+			}
+			if graphs[1].Title != "C4 diagram of the web app" {
+				t.Errorf("unexpected title: %s", graphs[1].Title)
+			}
+		},
+	)
+
+	t.Run(
+		"shall not call the titler given all graphs define the title", func(t *testing.T) {
+			// GIVEN
+			graphs := []*c4ContainersGraph{{Title: "foo"}}
+			cfg := newConfig(
+				WithAutoTitle(
+					TitlerFunc(
+						func(_ context.Context, _ string) (string, error) {
+							t.Error("the titler shall not be called")
+							return "", nil
+						},
+					),
+				),
+			)
+
+			// WHEN
+			autoTitle(context.TODO(), cfg, input, "foobar", graphs)
+
+			// THEN
+			if graphs[0].Title != "foo" {
+				t.Errorf("unexpected title: %s", graphs[0].Title)
+			}
+		},
+	)
+
+	t.Run(
+		"shall keep the blank title by default", func(t *testing.T) {
+			// GIVEN
+			graphs := []*c4ContainersGraph{{}}
+
+			// WHEN
+			autoTitle(context.TODO(), newConfig(), input, "foobar", graphs)
+
+			// THEN
+			if graphs[0].Title != "" {
+				t.Errorf("unexpected title: %s", graphs[0].Title)
+			}
+		},
+	)
+
+	t.Run(
+		"shall keep the blank title given the titler fails", func(t *testing.T) {
+			// GIVEN
+			graphs := []*c4ContainersGraph{{}}
+			cfg := newConfig(
+				WithAutoTitle(
+					TitlerFunc(
+						func(_ context.Context, _ string) (string, error) {
+							return "qux", errors.New("foo")
+						},
+					),
+				),
+			)
+
+			// WHEN
+			autoTitle(context.TODO(), cfg, input, "foobar", graphs)
+
+			// THEN
+			if graphs[0].Title != "" {
+				t.Errorf("unexpected title: %s", graphs[0].Title)
+			}
+		},
+	)
+}
+
+func TestNewPromptTitler(t *testing.T) {
+	tests := []struct {
+		name      string
+		prompt    string
+		maxLength int
+		want      string
+	}{
+		{
+			name:   "first sentence",
+			prompt: "  C4 diagram of\nthe Python 3.10 app!  It writes to Postgres.",
+			want:   "C4 diagram of the Python 3.10 app",
+		},
+		{
+			name:   "single sentence without the punctuation",
+			prompt: "C4 diagram of the web app",
+			want:   "C4 diagram of the web app",
+		},
+		{
+			name:      "truncated sentence",
+			prompt:    "C4 diagram of the web app.",
+			maxLength: 10,
+			want:      "C4 diagra…",
+		},
+		{
+			name:   "default limit",
+			prompt: strings.Repeat("a", defaultTitleLengthMax+1),
+			want:   strings.Repeat("a", defaultTitleLengthMax-1) + "…",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := NewPromptTitler(tt.maxLength).Title(context.TODO(), tt.prompt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("Title() got = %s, want %s", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestNewModelTitler(t *testing.T) {
+	t.Run(
+		"shall fail given no client, or no model", func(t *testing.T) {
+			if _, err := NewModelTitler(nil, "gpt-4", 0); err == nil {
+				t.Error("error expected given no client")
+			}
+			if _, err := NewModelTitler(diagram.MockModelInference{}, "", 0); err == nil {
+				t.Error("error expected given no model")
+			}
+		},
+	)
+
+	t.Run(
+		"shall ask the model for the title", func(t *testing.T) {
+			// GIVEN
+			modelInference := &mockModelInferenceRecorder{
+				MockModelInference: diagram.MockModelInference{V: []byte(`{"title":" Web application "}`)},
+			}
+			titler, err := NewModelTitler(modelInference, "gpt-4", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			got, err := titler.Title(context.TODO(), "foobar")
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != "Web application" {
+				t.Errorf("unexpected title: %s", got)
+			}
+			if modelInference.model != "gpt-4" || modelInference.systemContent != contentSystemTitle {
+				t.Errorf("unexpected model: %s", modelInference.model)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the model's error, unexpected output, or the empty title", func(t *testing.T) {
+			for _, m := range []diagram.MockModelInference{
+				{Err: errors.New("foo")}, {V: []byte("foo")}, {V: []byte(`{"title":" "}`)}, {V: []byte(`{"nodes":[]}`)},
+			} {
+				titler, _ := NewModelTitler(m, "gpt-4", 0)
+				if _, err := titler.Title(context.TODO(), "foobar"); err == nil {
+					t.Error("error expected")
+				}
+			}
+		},
+	)
+}
@@ -0,0 +1,111 @@
+package c4container
+
+import (
+	"context"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// DiagramGraph defines the C4 containers diagram's graph, see GraphJSONSchema.
+type DiagramGraph = c4ContainersGraph
+
+// Container defines the node of DiagramGraph.
+type Container = container
+
+// Relation defines the link between the nodes of DiagramGraph.
+type Relation = rel
+
+// GraphTransformer transforms the diagram's graph defined by the model before it is rendered,
+// e.g. to enforce the naming conventions, or to add the standard logging component.
+type GraphTransformer interface {
+	Transform(ctx context.Context, graph DiagramGraph) (DiagramGraph, error)
+}
+
+// GraphTransformerFunc the adapter to use the function as GraphTransformer.
+type GraphTransformerFunc func(ctx context.Context, graph DiagramGraph) (DiagramGraph, error)
+
+func (f GraphTransformerFunc) Transform(ctx context.Context, graph DiagramGraph) (DiagramGraph, error) {
+	return f(ctx, graph)
+}
+
+// IdentityGraphTransformer returns the graph unchanged, it is used unless WithGraphTransformer is set.
+var IdentityGraphTransformer GraphTransformer = GraphTransformerFunc(
+	func(_ context.Context, graph DiagramGraph) (DiagramGraph, error) {
+		return graph, nil
+	},
+)
+
+// WithGraphTransformer adds the transformer of the diagram's graph invoked between the model's output
+// and the rendering. The transformers are chained in the order they were added, i.e. every transformer
+// receives the output of the preceding one. The failed transformation, or the transformed graph which fails
+// the validation, e.g. exceeding the complexity limits, fails the diagram generation.
+func WithGraphTransformer(transformer GraphTransformer) HandlerOps {
+	return func(cfg *renderingConfig) {
+		if transformer != nil {
+			cfg.GraphTransformers = append(cfg.GraphTransformers, transformer)
+		}
+	}
+}
+
+// transformGraph applies the chain of transformers to the copy of the graph, the graph is returned unchanged
+// given no transformers. The transformed graph is validated as the user's graph, see validateGraph,
+// and against the complexity limits, because the transformers may add the nodes and the links.
+func transformGraph(
+	ctx context.Context, transformers []GraphTransformer, graph *c4ContainersGraph, limits diagram.ComplexityLimits,
+) (*c4ContainersGraph, error) {
+	if len(transformers) == 0 {
+		return graph, nil
+	}
+
+	o := graph.clone()
+	for _, transformer := range transformers {
+		var err error
+		if o, err = transformer.Transform(ctx, o); err != nil {
+			return nil, errors.New(err.Error())
+		}
+	}
+
+	if err := validateGraph(&o); err != nil {
+		return nil, err
+	}
+	if err := validateComplexity(&o, limits); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// clone returns the deep copy of the graph, e.g. for the transformers to modify the nodes and the links
+// without changing the original graph.
+func (l c4ContainersGraph) clone() c4ContainersGraph {
+	o := l
+	if l.Containers != nil {
+		o.Containers = make([]*container, len(l.Containers))
+		for i, n := range l.Containers {
+			if n != nil {
+				v := *n
+				o.Containers[i] = &v
+			}
+		}
+	}
+	if l.Rels != nil {
+		o.Rels = make([]*rel, len(l.Rels))
+		for i, r := range l.Rels {
+			if r != nil {
+				v := *r
+				v.Tags = append([]string(nil), r.Tags...)
+				o.Rels[i] = &v
+			}
+		}
+	}
+	if l.RelTags != nil {
+		o.RelTags = make([]*relTag, len(l.RelTags))
+		for i, t := range l.RelTags {
+			if t != nil {
+				v := *t
+				o.RelTags[i] = &v
+			}
+		}
+	}
+	return o
+}
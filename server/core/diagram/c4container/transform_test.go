@@ -0,0 +1,225 @@
+package c4container
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/logger"
+)
+
+// upperCaseLabels enforces the naming convention: the containers' labels in upper case.
+var upperCaseLabels = GraphTransformerFunc(
+	func(_ context.Context, graph DiagramGraph) (DiagramGraph, error) {
+		for _, n := range graph.Containers {
+			n.Label = strings.ToUpper(n.Label)
+		}
+		return graph, nil
+	},
+)
+
+// injectLogging adds the logging component every container sends its logs to.
+var injectLogging = GraphTransformerFunc(
+	func(_ context.Context, graph DiagramGraph) (DiagramGraph, error) {
+		for _, n := range graph.Containers {
+			graph.Rels = append(graph.Rels, &Relation{From: n.ID, To: "logging", Label: "Sends logs"})
+		}
+		graph.Containers = append(graph.Containers, &Container{ID: "logging", Label: "Logging", Technology: "Loki"})
+		return graph, nil
+	},
+)
+
+func TestRenderWithGraphTransformer(t *testing.T) {
+	graph := []byte(`{"nodes":[{"id":"0","label":"backend"}]}`)
+
+	t.Run(
+		"shall reflect the transformations in the DSL in the chain's order", func(t *testing.T) {
+			// WHEN
+			got, err := Render(
+				context.TODO(), nil, graph, FormatDSL,
+				WithGraphTransformer(injectLogging), WithGraphTransformer(upperCaseLabels),
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range []string{
+				`Container(0, "BACKEND")`,
+				`Container(logging, "LOGGING", "Loki")`,
+				`Rel(0, logging, "Sends logs")`,
+			} {
+				if !strings.Contains(string(got), want) {
+					t.Errorf("DSL shall contain %s, got: %s", want, got)
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"shall render the graph unchanged by default", func(t *testing.T) {
+			// WHEN
+			got, err := Render(context.TODO(), nil, graph, FormatDSL)
+			want, errIdentity := Render(
+				context.TODO(), nil, graph, FormatDSL, WithGraphTransformer(IdentityGraphTransformer),
+			)
+
+			// THEN
+			if err != nil || errIdentity != nil {
+				t.Fatal(err, errIdentity)
+			}
+			if string(got) != string(want) || !strings.Contains(string(got), `Container(0, "backend")`) {
+				t.Errorf("unexpected DSL: %s", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the transformation failed", func(t *testing.T) {
+			// GIVEN
+			var called bool
+			failing := GraphTransformerFunc(
+				func(_ context.Context, graph DiagramGraph) (DiagramGraph, error) {
+					return graph, errors.New("foo")
+				},
+			)
+			next := GraphTransformerFunc(
+				func(_ context.Context, graph DiagramGraph) (DiagramGraph, error) {
+					called = true
+					return graph, nil
+				},
+			)
+
+			// WHEN
+			_, err := Render(
+				context.TODO(), nil, graph, FormatDSL, WithGraphTransformer(failing), WithGraphTransformer(next),
+			)
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+			if called {
+				t.Error("the chain shall stop at the failed transformer")
+			}
+		},
+	)
+}
+
+func Test_transformGraph(t *testing.T) {
+	newGraph := func() *c4ContainersGraph {
+		return &c4ContainersGraph{
+			Containers: []*container{{ID: "0", Label: "backend"}, {ID: "1", Label: "db"}},
+			Rels:       []*rel{{From: "0", To: "1", Tags: []string{"foo"}}},
+		}
+	}
+
+	t.Run(
+		"shall not change the original graph", func(t *testing.T) {
+			// GIVEN
+			graph := newGraph()
+			retag := GraphTransformerFunc(
+				func(_ context.Context, graph DiagramGraph) (DiagramGraph, error) {
+					graph.Rels[0].Tags[0] = "bar"
+					return graph, nil
+				},
+			)
+
+			// WHEN
+			got, err := transformGraph(
+				context.TODO(), []GraphTransformer{upperCaseLabels, retag}, graph, diagram.ComplexityLimits{},
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(graph, newGraph()) {
+				t.Errorf("the original graph shall not be changed, got: %+v", graph)
+			}
+			if got.Containers[0].Label != "BACKEND" || got.Rels[0].Tags[0] != "bar" {
+				t.Errorf("unexpected transformed graph: %+v", got)
+			}
+		},
+	)
+
+	tests := []struct {
+		name        string
+		transformer GraphTransformer
+		limits      diagram.ComplexityLimits
+		wantErr     error
+	}{
+		{
+			name:        "exceeding the limits",
+			transformer: injectLogging,
+			limits:      diagram.ComplexityLimits{NodesMax: 2},
+			wantErr:     newComplexityError("nodes", 2),
+		},
+		{
+			name: "with the link to the unknown node",
+			transformer: GraphTransformerFunc(
+				func(_ context.Context, graph DiagramGraph) (DiagramGraph, error) {
+					graph.Rels = append(graph.Rels, &Relation{From: "0", To: "logging"})
+					return graph, nil
+				},
+			),
+			wantErr: newGraphError("link 0 -> logging references unknown node logging"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			"shall fail given the transformed graph "+tt.name, func(t *testing.T) {
+				// WHEN
+				_, err := transformGraph(context.TODO(), []GraphTransformer{tt.transformer}, newGraph(), tt.limits)
+
+				// THEN
+				if !reflect.DeepEqual(err, tt.wantErr) {
+					t.Errorf("unexpected error: got = %v, want = %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+func TestNewC4ContainersHTTPHandlerWithGraphTransformer(t *testing.T) {
+	// GIVEN
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+
+	var gotPaths []string
+	httpClient := mockHTTPClientFn(
+		func(req *http.Request) (*http.Response, error) {
+			gotPaths = append(gotPaths, req.URL.Path)
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(svg))}, nil
+		},
+	)
+
+	handler, err := NewC4ContainersHTTPHandler(
+		diagram.MockModelInference{V: []byte(`{"nodes":[{"id":"0","label":"backend"}]}`)}, nil, httpClient,
+		WithLogger(logger.NewNoopLogger()), WithGraphTransformer(upperCaseLabels),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// WHEN
+	if _, err := handler(context.TODO(), diagram.MockInput{Prompt: "foobar", UserID: placeholderUserID}); err != nil {
+		t.Fatal(err)
+	}
+
+	// THEN
+	// the diagram is rendered given the transformed graph
+	if _, err := Render(
+		context.TODO(), httpClient, []byte(`{"nodes":[{"id":"0","label":"BACKEND"}]}`), FormatSVG,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if len(gotPaths) != 2 || gotPaths[0] != gotPaths[1] {
+		t.Errorf("the transformed graph shall be rendered, got: %v", gotPaths)
+	}
+}
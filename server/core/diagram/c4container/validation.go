@@ -0,0 +1,249 @@
+package c4container
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// validateComplexity rejects the graph with the number of nodes, or links exceeding the limits
+// to protect the renderer from the oversized diagrams.
+func validateComplexity(c *c4ContainersGraph, limits diagram.ComplexityLimits) error {
+	if limits.NodesMax > 0 && len(c.Containers) > limits.NodesMax {
+		return newComplexityError("nodes", limits.NodesMax)
+	}
+	if limits.LinksMax > 0 && len(c.Rels) > limits.LinksMax {
+		return newComplexityError("links", limits.LinksMax)
+	}
+	return nil
+}
+
+// validateDiagramsCount rejects the prediction with the number of diagrams exceeding the limit,
+// because every diagram is rendered, i.e. the limits of the nodes and links are validated per diagram.
+func validateDiagramsCount(graphs []*c4ContainersGraph, limits diagram.ComplexityLimits) error {
+	if limits.DiagramsMax > 0 && len(graphs) > limits.DiagramsMax {
+		return errors.HTTPHandlerError{
+			Msg:      "prompt exceeds the limit of " + strconv.Itoa(limits.DiagramsMax) + " diagrams",
+			Type:     "complexity",
+			HTTPCode: http.StatusUnprocessableEntity,
+		}
+	}
+	return nil
+}
+
+func newComplexityError(element string, limit int) error {
+	return errors.HTTPHandlerError{
+		Msg:      "diagram exceeds the limit of " + strconv.Itoa(limit) + " " + element,
+		Type:     "complexity",
+		HTTPCode: http.StatusUnprocessableEntity,
+	}
+}
+
+// validateSVGSize rejects the SVG diagram exceeding the maximum size in bytes to protect the clients
+// from the pathological diagrams. Zero maxSize disables the validation.
+func validateSVGSize(svg []byte, maxSize int) error {
+	if maxSize > 0 && len(svg) > maxSize {
+		return errors.HTTPHandlerError{
+			Msg: "diagram is too complex, its size exceeds the limit of " + strconv.Itoa(maxSize) +
+				" bytes, consider splitting the diagram",
+			Type:     "complexity",
+			HTTPCode: http.StatusRequestEntityTooLarge,
+		}
+	}
+	return nil
+}
+
+// nodesDegreeWarnings defines the warnings about the nodes with the number of incoming and outgoing links
+// exceeding the threshold, i.e. the "hairball" nodes which make the diagram unreadable.
+// The warnings follow the order of the nodes in the graph. Zero threshold disables the validation.
+func nodesDegreeWarnings(c *c4ContainersGraph, maxDegree int) []string {
+	if maxDegree <= 0 {
+		return nil
+	}
+
+	degree := map[string]int{}
+	for _, l := range c.Rels {
+		degree[l.From]++
+		degree[l.To]++
+	}
+
+	var o []string
+	for _, n := range c.Containers {
+		if v := degree[n.ID]; v > maxDegree {
+			o = append(
+				o, "node "+n.ID+" has "+strconv.Itoa(v)+" links exceeding the limit of "+strconv.Itoa(maxDegree)+
+					", consider splitting the diagram",
+			)
+		}
+	}
+	return o
+}
+
+// orphanNodesWarnings defines the warnings about the nodes without links which often indicate
+// that the model misunderstood the prompt. The graph with the single node is considered intentionally standalone.
+func orphanNodesWarnings(c *c4ContainersGraph, enabled bool) []string {
+	if !enabled || len(c.Containers) < 2 {
+		return nil
+	}
+
+	linked := map[string]struct{}{}
+	for _, l := range c.Rels {
+		linked[l.From] = struct{}{}
+		linked[l.To] = struct{}{}
+	}
+
+	var o []string
+	for _, n := range c.Containers {
+		if _, ok := linked[n.ID]; !ok {
+			o = append(o, "node "+n.ID+" has no links, consider linking, or removing it")
+		}
+	}
+	return o
+}
+
+// selfLinksWarnings defines the warnings about the links from the node to itself which usually indicate
+// the model's error. Every node is reported once regardless of the number of its self-links.
+func selfLinksWarnings(c *c4ContainersGraph, enabled bool) []string {
+	if !enabled {
+		return nil
+	}
+
+	seen := map[string]struct{}{}
+	var o []string
+	for _, l := range c.Rels {
+		if l.From != l.To {
+			continue
+		}
+		if _, ok := seen[l.From]; ok {
+			continue
+		}
+		seen[l.From] = struct{}{}
+		o = append(o, "node "+l.From+" links to itself, consider removing the link")
+	}
+	return o
+}
+
+// cyclesWarnings defines the warnings about the circular dependencies between the nodes, e.g. to highlight them.
+// The cycles are detected using the depth-first search in the order of the nodes and the links in the graph,
+// every link pointing back to the node on the search path closes the reported cycle. The links from the node
+// to itself are skipped, because they are reported by selfLinksWarnings.
+func cyclesWarnings(c *c4ContainersGraph, enabled bool) []string {
+	if !enabled {
+		return nil
+	}
+
+	var nodes []string
+	adjacency := map[string][]string{}
+	seen := map[string]struct{}{}
+	addNode := func(id string) {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			nodes = append(nodes, id)
+		}
+	}
+	for _, n := range c.Containers {
+		addNode(n.ID)
+	}
+	for _, l := range c.Rels {
+		addNode(l.From)
+		addNode(l.To)
+		if l.From != l.To {
+			adjacency[l.From] = append(adjacency[l.From], l.To)
+		}
+	}
+
+	const (
+		unvisited = iota
+		onPath
+		visited
+	)
+	state := map[string]int{}
+	var path []string
+	var o []string
+
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = onPath
+		path = append(path, id)
+		for _, next := range adjacency[id] {
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case onPath:
+				o = append(o, "circular dependency: "+formatCycle(path, next))
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = visited
+	}
+
+	for _, id := range nodes {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+	return o
+}
+
+// formatCycle formats the cycle closed by the link from the last node on the path to the node start,
+// e.g. 0 -> 1 -> 2 -> 0.
+func formatCycle(path []string, start string) string {
+	i := len(path) - 1
+	for path[i] != start {
+		i--
+	}
+	o := ""
+	for _, id := range path[i:] {
+		o += id + " -> "
+	}
+	return o + start
+}
+
+// nodeIDRegexp defines the node's ID. The ID is written to the PlantUML DSL as is, hence it is limited
+// to prevent the injection of the PlantUML directives.
+var nodeIDRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// validateGraph rejects the graph which cannot be rendered, e.g. the graph edited by the user
+// with the links to the removed nodes.
+func validateGraph(c *c4ContainersGraph) error {
+	if len(c.Containers) == 0 {
+		return newGraphError("graph must have nodes")
+	}
+
+	nodes := make(map[string]struct{}, len(c.Containers))
+	for _, n := range c.Containers {
+		if n == nil || n.ID == "" {
+			return newGraphError("node must be identified: 'id' attribute")
+		}
+		if !nodeIDRegexp.MatchString(n.ID) {
+			return newGraphError("node ID must contain latin letters, digits and _ only")
+		}
+		if _, ok := nodes[n.ID]; ok {
+			return newGraphError("node " + n.ID + " is duplicated")
+		}
+		nodes[n.ID] = struct{}{}
+	}
+
+	for _, l := range c.Rels {
+		if l == nil {
+			return newGraphError("link must be set")
+		}
+		for _, id := range []string{l.From, l.To} {
+			if _, ok := nodes[id]; !ok {
+				return newGraphError("link " + l.From + " -> " + l.To + " references unknown node " + id)
+			}
+		}
+	}
+	return nil
+}
+
+func newGraphError(msg string) error {
+	return errors.HTTPHandlerError{
+		Msg:      msg,
+		Type:     "graph",
+		HTTPCode: http.StatusUnprocessableEntity,
+	}
+}
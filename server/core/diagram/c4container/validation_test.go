@@ -0,0 +1,291 @@
+package c4container
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+)
+
+func Test_nodesDegreeWarnings(t *testing.T) {
+	// node 0 is connected to the nodes 1, 2 and 3, and has the self-relation
+	graph := &c4ContainersGraph{
+		Containers: []*container{{ID: "0"}, {ID: "1"}, {ID: "2"}, {ID: "3"}},
+		Rels: []*rel{
+			{From: "0", To: "1"},
+			{From: "2", To: "0"},
+			{From: "0", To: "3"},
+			{From: "1", To: "2"},
+			{From: "0", To: "0"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		maxDegree int
+		want      []string
+	}{
+		{
+			name:      "node exceeding the threshold",
+			maxDegree: 4,
+			want:      []string{"node 0 has 5 links exceeding the limit of 4, consider splitting the diagram"},
+		},
+		{
+			name:      "nodes exceeding the threshold",
+			maxDegree: 1,
+			want: []string{
+				"node 0 has 5 links exceeding the limit of 1, consider splitting the diagram",
+				"node 1 has 2 links exceeding the limit of 1, consider splitting the diagram",
+				"node 2 has 2 links exceeding the limit of 1, consider splitting the diagram",
+			},
+		},
+		{
+			name:      "node at the threshold",
+			maxDegree: 5,
+			want:      nil,
+		},
+		{
+			name:      "disabled validation",
+			maxDegree: 0,
+			want:      nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := nodesDegreeWarnings(graph, tt.maxDegree); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("nodesDegreeWarnings() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestNewC4ContainersHTTPHandlerWithMaxNodeDegree(t *testing.T) {
+	// GIVEN
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="10px" width="10px" viewBox="0 0 10 10">` +
+		`<g><g><rect height="5" width="5" rx="1" ry="1" x="0" y="0"></rect></g></g></svg>`
+
+	handler, err := NewC4ContainersHTTPHandler(
+		diagram.MockModelInference{
+			V: []byte(`{"nodes":[{"id":"0"},{"id":"1"},{"id":"2"}],` +
+				`"links":[{"from":"0","to":"1"},{"from":"0","to":"2"}]}`),
+		},
+		nil,
+		mockHTTPClientFn(
+			func(_ *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader(svg)),
+				}, nil
+			},
+		),
+		WithMaxNodeDegree(1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// WHEN
+	got, err := handler(
+		context.TODO(), diagram.MockInput{Prompt: "foobar", RequestID: "xxxx", UserID: placeholderUserID},
+	)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := got.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var response struct {
+		SVG      string   `json:"svg"`
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal(v, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"node 0 has 2 links exceeding the limit of 1, consider splitting the diagram"}
+	if !reflect.DeepEqual(response.Warnings, want) {
+		t.Errorf("unexpected warnings: got = %v, want = %v", response.Warnings, want)
+	}
+	if response.SVG == "" {
+		t.Error("svg expected")
+	}
+}
+
+func Test_cyclesWarnings(t *testing.T) {
+	tests := []struct {
+		name    string
+		graph   *c4ContainersGraph
+		enabled bool
+		want    []string
+	}{
+		{
+			name: "acyclic graph",
+			graph: &c4ContainersGraph{
+				Containers: []*container{{ID: "0"}, {ID: "1"}, {ID: "2"}, {ID: "3"}},
+				Rels: []*rel{
+					{From: "0", To: "1"},
+					{From: "0", To: "2"},
+					{From: "1", To: "3"},
+					{From: "2", To: "3"},
+				},
+			},
+			enabled: true,
+			want:    nil,
+		},
+		{
+			name: "3-nodes cycle",
+			graph: &c4ContainersGraph{
+				Containers: []*container{{ID: "0"}, {ID: "1"}, {ID: "2"}, {ID: "3"}},
+				Rels: []*rel{
+					{From: "3", To: "0"},
+					{From: "0", To: "1"},
+					{From: "1", To: "2"},
+					{From: "2", To: "0"},
+				},
+			},
+			enabled: true,
+			want:    []string{"circular dependency: 0 -> 1 -> 2 -> 0"},
+		},
+		{
+			name: "self-relation skipped and 2-nodes cycle",
+			graph: &c4ContainersGraph{
+				Containers: []*container{{ID: "0"}, {ID: "1"}},
+				Rels: []*rel{
+					{From: "0", To: "0"},
+					{From: "0", To: "1"},
+					{From: "1", To: "0"},
+				},
+			},
+			enabled: true,
+			want:    []string{"circular dependency: 0 -> 1 -> 0"},
+		},
+		{
+			name: "disabled detection",
+			graph: &c4ContainersGraph{
+				Containers: []*container{{ID: "0"}, {ID: "1"}},
+				Rels:       []*rel{{From: "0", To: "1"}, {From: "1", To: "0"}},
+			},
+			enabled: false,
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := cyclesWarnings(tt.graph, tt.enabled); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("cyclesWarnings() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_orphanNodesWarnings(t *testing.T) {
+	tests := []struct {
+		name    string
+		graph   *c4ContainersGraph
+		enabled bool
+		want    []string
+	}{
+		{
+			name: "graph with the orphan node",
+			graph: &c4ContainersGraph{
+				Containers: []*container{{ID: "0"}, {ID: "1"}, {ID: "2"}},
+				Rels:       []*rel{{From: "0", To: "2"}},
+			},
+			enabled: true,
+			want:    []string{"node 1 has no links, consider linking, or removing it"},
+		},
+		{
+			name: "graph without orphan nodes",
+			graph: &c4ContainersGraph{
+				Containers: []*container{{ID: "0"}, {ID: "1"}, {ID: "2"}},
+				Rels:       []*rel{{From: "0", To: "1"}, {From: "2", To: "2"}},
+			},
+			enabled: true,
+			want:    nil,
+		},
+		{
+			name:    "single-node graph",
+			graph:   &c4ContainersGraph{Containers: []*container{{ID: "0"}}},
+			enabled: true,
+			want:    nil,
+		},
+		{
+			name: "disabled detection",
+			graph: &c4ContainersGraph{
+				Containers: []*container{{ID: "0"}, {ID: "1"}},
+			},
+			enabled: false,
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := orphanNodesWarnings(tt.graph, tt.enabled); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("orphanNodesWarnings() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_selfLinksWarnings(t *testing.T) {
+	graph := &c4ContainersGraph{
+		Containers: []*container{{ID: "0"}, {ID: "1"}},
+		Rels: []*rel{
+			{From: "0", To: "1"}, {From: "1", To: "1"}, {From: "1", To: "1", Label: "retries"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		graph   *c4ContainersGraph
+		enabled bool
+		want    []string
+	}{
+		{
+			name:    "warn mode: graph with the self-link",
+			graph:   graph,
+			enabled: true,
+			want:    []string{"node 1 links to itself, consider removing the link"},
+		},
+		{
+			name: "warn mode: graph without self-links",
+			graph: &c4ContainersGraph{
+				Containers: []*container{{ID: "0"}, {ID: "1"}},
+				Rels:       []*rel{{From: "0", To: "1"}, {From: "1", To: "0"}},
+			},
+			enabled: true,
+			want:    nil,
+		},
+		{
+			name:    "render mode: graph with the self-link",
+			graph:   graph,
+			enabled: false,
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := selfLinksWarnings(tt.graph, tt.enabled); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("selfLinksWarnings() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
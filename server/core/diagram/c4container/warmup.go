@@ -0,0 +1,28 @@
+package c4container
+
+import (
+	"context"
+
+	"github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// Warmup initialises the diagram's rendering, i.e. the C4-PlantUML code's generation and the compression
+// of the PlantUML request, using the curated example. It is called upon the application's start, e.g. upon
+// the cold start of the serverless function, so the first diagram is rendered as fast as the subsequent ones.
+// The PlantUML server is not called.
+func Warmup(ctx context.Context) error {
+	for _, e := range defaultExamples {
+		if err := ctx.Err(); err != nil {
+			return errors.New(err.Error())
+		}
+
+		dsl, err := marshal(e.graph, defaultRenderingConfig())
+		if err != nil {
+			return err
+		}
+		if _, err := plantUMLRequest(dsl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
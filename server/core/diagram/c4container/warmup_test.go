@@ -0,0 +1,53 @@
+package c4container
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWarmup(t *testing.T) {
+	t.Run(
+		"shall warm up and render the diagram afterwards", func(t *testing.T) {
+			// GIVEN
+			var calls int
+			httpClient := mockHTTPClientFn(
+				func(req *http.Request) (*http.Response, error) {
+					calls++
+					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("<svg/>"))}, nil
+				},
+			)
+
+			// WHEN
+			err := Warmup(context.TODO())
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if calls != 0 {
+				t.Errorf("PlantUML server shall not be called upon warm-up, got %d calls", calls)
+			}
+
+			got, err := Render(context.TODO(), httpClient, []byte(`{"nodes":[{"id":"0"}]}`), FormatSVG)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "<svg/>" {
+				t.Errorf("unexpected diagram: %s", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the cancelled context", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.TODO())
+			cancel()
+			if err := Warmup(ctx); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
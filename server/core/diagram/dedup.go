@@ -0,0 +1,126 @@
+package diagram
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// NewDeduplicatedHTTPHandler wraps the handler to deduplicate the in-flight requests, e.g. fired by the double-click.
+// The request identical to the one being processed, i.e. the request of the same user with the same prompt
+// up to the letter case and whitespaces, and with the same regeneration, graph and branding options,
+// waits for and returns the result of the first request instead of running the handler.
+// The shared request is cancelled once all the waiting requests are cancelled, e.g. when the clients disconnect,
+// i.e. it is completed for the waiting requests if the first request is cancelled.
+// Every caller returns once its context is done.
+func NewDeduplicatedHTTPHandler(handler HTTPHandler) HTTPHandler {
+	return newDeduplicatedHTTPHandler(handler, &inflightGroup{calls: map[string]*inflightCall{}})
+}
+
+func newDeduplicatedHTTPHandler(handler HTTPHandler, g *inflightGroup) HTTPHandler {
+	return func(ctx context.Context, input Input) (Output, error) {
+		return g.do(
+			ctx, dedupKey(input), func(ctx context.Context) (Output, error) {
+				return handler(ctx, input)
+			},
+		)
+	}
+}
+
+// dedupKey defines the identity of the request, i.e. the inputs which change the diagram.
+func dedupKey(input Input) string {
+	var (
+		regeneration int
+		includeGraph bool
+		branding     Branding
+	)
+	if v, ok := input.(InputRegeneration); ok {
+		regeneration = v.GetRegeneration()
+	}
+	if v, ok := input.(InputGraph); ok {
+		includeGraph = v.GetIncludeGraph()
+	}
+	if v, ok := input.(InputBranding); ok {
+		branding = v.GetBranding()
+	}
+	return strings.Join(
+		[]string{
+			input.GetUserID(),
+			strconv.Itoa(regeneration),
+			strconv.FormatBool(includeGraph),
+			branding.DefaultFooter,
+			branding.Theme,
+			normalizePrompt(input.GetPrompt()),
+		}, "\x00",
+	)
+}
+
+func normalizePrompt(prompt string) string {
+	return strings.ToLower(strings.Join(strings.Fields(prompt), " "))
+}
+
+// inflightGroup executes the function once per key for the concurrent callers, i.e. the singleflight semantics.
+type inflightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*inflightCall
+}
+
+type inflightCall struct {
+	// done is closed once the result is set.
+	done chan struct{}
+	// dups the number of callers joined the call.
+	dups int
+	// waiters the number of callers waiting for the result, the call is cancelled once none is left.
+	waiters int
+	cancel  context.CancelFunc
+	v       Output
+	err     error
+}
+
+// do executes the function with the context which keeps the first caller's values, e.g. the tracing span,
+// and which is cancelled once the contexts of all the callers are done.
+func (g *inflightGroup) do(
+	ctx context.Context, key string, fn func(ctx context.Context) (Output, error),
+) (Output, error) {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	if ok {
+		c.dups++
+		c.waiters++
+	} else {
+		ctxCall, cancel := context.WithCancel(detachedContext{ctx})
+		c = &inflightCall{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		g.calls[key] = c
+		go func() {
+			c.v, c.err = fn(ctxCall)
+			g.mu.Lock()
+			g.release(key, c)
+			g.mu.Unlock()
+			close(c.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.v, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		// the cancelled call is not joined by the subsequent identical requests
+		if c.waiters == 0 {
+			g.release(key, c)
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// release cancels the call, and removes it from the in-flight calls. It must be called holding the lock.
+func (g *inflightGroup) release(key string, c *inflightCall) {
+	c.cancel()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
@@ -0,0 +1,338 @@
+package diagram
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewDeduplicatedHTTPHandler(t *testing.T) {
+	t.Run(
+		"shall call the model once for two concurrent identical requests", func(t *testing.T) {
+			// GIVEN
+			var calls int32
+			release := make(chan struct{})
+			handler := func(_ context.Context, _ Input) (Output, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return MockOutput{V: []byte(`{"svg":"foo"}`)}, nil
+			}
+
+			g := &inflightGroup{calls: map[string]*inflightCall{}}
+			do := newDeduplicatedHTTPHandler(handler, g)
+
+			inputs := []Input{
+				MockInput{Prompt: "c4 diagram of  Go web server", UserID: "foo", RequestID: "bar"},
+				MockInput{Prompt: "C4 diagram of Go web server ", UserID: "foo", RequestID: "baz"},
+			}
+
+			// WHEN
+			var wg sync.WaitGroup
+			got := make([]Output, len(inputs))
+			errs := make([]error, len(inputs))
+			for i, input := range inputs {
+				wg.Add(1)
+				go func(i int, input Input) {
+					defer wg.Done()
+					got[i], errs[i] = do(context.TODO(), input)
+				}(i, input)
+			}
+
+			// the result is released after the second request joined the first one
+			waitUntil(
+				t, func() bool {
+					g.mu.Lock()
+					defer g.mu.Unlock()
+					for _, c := range g.calls {
+						return c.dups == 1
+					}
+					return false
+				},
+			)
+			close(release)
+			wg.Wait()
+
+			// THEN
+			if n := atomic.LoadInt32(&calls); n != 1 {
+				t.Errorf("unexpected number of the model calls: %d", n)
+			}
+			for i := range inputs {
+				if errs[i] != nil {
+					t.Fatal(errs[i])
+				}
+				if !reflect.DeepEqual(got[i], MockOutput{V: []byte(`{"svg":"foo"}`)}) {
+					t.Errorf("unexpected output: %v", got[i])
+				}
+			}
+			if len(g.calls) > 0 {
+				t.Error("the in-flight calls shall be released")
+			}
+		},
+	)
+
+	t.Run(
+		"shall process the requests of different users, or with different prompts", func(t *testing.T) {
+			// GIVEN
+			var calls int32
+			handler := NewDeduplicatedHTTPHandler(
+				func(_ context.Context, input Input) (Output, error) {
+					atomic.AddInt32(&calls, 1)
+					if input.GetUserID() == "qux" {
+						return nil, errors.New("foo")
+					}
+					return MockOutput{}, nil
+				},
+			)
+
+			// WHEN
+			for _, input := range []Input{
+				MockInput{Prompt: "c4 diagram of Go web server", UserID: "foo"},
+				MockInput{Prompt: "c4 diagram of Go web server", UserID: "bar"},
+				MockInput{Prompt: "c4 diagram of Python web server", UserID: "foo"},
+				MockInput{Prompt: "c4 diagram of Go web server", UserID: "foo"},
+			} {
+				if _, err := handler(context.TODO(), input); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := handler(context.TODO(), MockInput{Prompt: "c4 diagram of Go web server", UserID: "qux"})
+
+			// THEN
+			if n := atomic.LoadInt32(&calls); n != 5 {
+				t.Errorf("unexpected number of the handler calls: %d", n)
+			}
+			if err == nil {
+				t.Error("the handler's error shall be returned")
+			}
+		},
+	)
+}
+
+func Test_dedupKey(t *testing.T) {
+	input := MockInput{Prompt: "c4 diagram of Go web server", UserID: "foo"}
+
+	t.Run(
+		"shall define the same key given the prompts equal up to the letter case and whitespaces", func(t *testing.T) {
+			other := input
+			other.Prompt = " C4 diagram  of Go web server"
+			other.RequestID = "bar"
+			if dedupKey(input) != dedupKey(other) {
+				t.Error("the keys shall be equal")
+			}
+		},
+	)
+
+	for name, other := range map[string]MockInput{
+		"user":          {Prompt: input.Prompt, UserID: "bar"},
+		"prompt":        {Prompt: "c4 diagram of Python web server", UserID: input.UserID},
+		"regeneration":  {Prompt: input.Prompt, UserID: input.UserID, Regeneration: 1},
+		"include_graph": {Prompt: input.Prompt, UserID: input.UserID, IncludeGraph: true},
+		"footer":        {Prompt: input.Prompt, UserID: input.UserID, Branding: Branding{DefaultFooter: "acme"}},
+		"theme":         {Prompt: input.Prompt, UserID: input.UserID, Branding: Branding{Theme: "cerulean"}},
+	} {
+		t.Run(
+			"shall define different keys given different "+name, func(t *testing.T) {
+				if dedupKey(input) == dedupKey(other) {
+					t.Error("the keys shall differ")
+				}
+			},
+		)
+	}
+}
+
+func TestNewDeduplicatedHTTPHandler_Cancellation(t *testing.T) {
+	t.Run(
+		"shall return the result to the waiting request given the first request is cancelled", func(t *testing.T) {
+			// GIVEN
+			release := make(chan struct{})
+			handler := func(ctx context.Context, _ Input) (Output, error) {
+				<-release
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				return MockOutput{V: []byte(`{"svg":"foo"}`)}, nil
+			}
+
+			g := &inflightGroup{calls: map[string]*inflightCall{}}
+			do := newDeduplicatedHTTPHandler(handler, g)
+			input := MockInput{Prompt: "c4 diagram of Go web server", UserID: "foo"}
+
+			ctxFirst, cancel := context.WithCancel(context.TODO())
+			errFirst := make(chan error, 1)
+			go func() {
+				_, err := do(ctxFirst, input)
+				errFirst <- err
+			}()
+			waitUntil(
+				t, func() bool {
+					g.mu.Lock()
+					defer g.mu.Unlock()
+					return len(g.calls) == 1
+				},
+			)
+
+			type result struct {
+				v   Output
+				err error
+			}
+			second := make(chan result, 1)
+			go func() {
+				v, err := do(context.TODO(), input)
+				second <- result{v: v, err: err}
+			}()
+			waitUntil(
+				t, func() bool {
+					g.mu.Lock()
+					defer g.mu.Unlock()
+					for _, c := range g.calls {
+						return c.dups == 1
+					}
+					return false
+				},
+			)
+
+			// WHEN
+			cancel()
+			if err := <-errFirst; !errors.Is(err, context.Canceled) {
+				t.Errorf("the cancelled request shall return, got: %v", err)
+			}
+			close(release)
+			got := <-second
+
+			// THEN
+			if got.err != nil {
+				t.Fatal(got.err)
+			}
+			if !reflect.DeepEqual(got.v, MockOutput{V: []byte(`{"svg":"foo"}`)}) {
+				t.Errorf("unexpected output: %v", got.v)
+			}
+		},
+	)
+
+	t.Run(
+		"shall abort the lone request before the render call given it is cancelled", func(t *testing.T) {
+			// GIVEN
+			var renders int32
+			started := make(chan struct{})
+			errHandler := make(chan error, 1)
+			handler := func(ctx context.Context, _ Input) (Output, error) {
+				close(started)
+				select {
+				case <-ctx.Done():
+					errHandler <- ctx.Err()
+					return nil, ctx.Err()
+				case <-time.After(5 * time.Second):
+					atomic.AddInt32(&renders, 1)
+					errHandler <- nil
+					return MockOutput{}, nil
+				}
+			}
+
+			g := &inflightGroup{calls: map[string]*inflightCall{}}
+			do := newDeduplicatedHTTPHandler(handler, g)
+
+			ctx, cancel := context.WithCancel(context.TODO())
+			errCaller := make(chan error, 1)
+			go func() {
+				_, err := do(ctx, MockInput{Prompt: "c4 diagram of Go web server", UserID: "foo"})
+				errCaller <- err
+			}()
+			<-started
+
+			// WHEN
+			cancel()
+
+			// THEN
+			if err := <-errCaller; !errors.Is(err, context.Canceled) {
+				t.Errorf("the cancelled request shall return, got: %v", err)
+			}
+			if err := <-errHandler; !errors.Is(err, context.Canceled) {
+				t.Errorf("the handler's context shall be cancelled, got: %v", err)
+			}
+			if n := atomic.LoadInt32(&renders); n != 0 {
+				t.Errorf("the diagram shall not be rendered, got: %d renders", n)
+			}
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			if len(g.calls) > 0 {
+				t.Error("the cancelled call shall be released")
+			}
+		},
+	)
+
+	t.Run(
+		"shall cancel the shared request once all the waiting requests are cancelled", func(t *testing.T) {
+			// GIVEN
+			errHandler := make(chan error, 1)
+			handler := func(ctx context.Context, _ Input) (Output, error) {
+				<-ctx.Done()
+				errHandler <- ctx.Err()
+				return nil, ctx.Err()
+			}
+
+			g := &inflightGroup{calls: map[string]*inflightCall{}}
+			do := newDeduplicatedHTTPHandler(handler, g)
+			input := MockInput{Prompt: "c4 diagram of Go web server", UserID: "foo"}
+
+			ctxFirst, cancelFirst := context.WithCancel(context.TODO())
+			ctxSecond, cancelSecond := context.WithCancel(context.TODO())
+			errs := make(chan error, 2)
+			go func() {
+				_, err := do(ctxFirst, input)
+				errs <- err
+			}()
+			waitUntil(
+				t, func() bool {
+					g.mu.Lock()
+					defer g.mu.Unlock()
+					return len(g.calls) == 1
+				},
+			)
+			go func() {
+				_, err := do(ctxSecond, input)
+				errs <- err
+			}()
+			waitUntil(
+				t, func() bool {
+					g.mu.Lock()
+					defer g.mu.Unlock()
+					for _, c := range g.calls {
+						return c.dups == 1
+					}
+					return false
+				},
+			)
+
+			// WHEN
+			cancelFirst()
+			<-errs
+			select {
+			case err := <-errHandler:
+				t.Fatalf("the shared request shall not be cancelled while the second request waits, got: %v", err)
+			case <-time.After(10 * time.Millisecond):
+			}
+			cancelSecond()
+			<-errs
+
+			// THEN
+			if err := <-errHandler; !errors.Is(err, context.Canceled) {
+				t.Errorf("the shared request shall be cancelled, got: %v", err)
+			}
+		},
+	)
+}
+
+func waitUntil(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within the timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,58 @@
+package diagram
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// Estimate defines the estimated size and cost of the diagram generation.
+type Estimate struct {
+	// Model the model which generates the diagram.
+	Model string `json:"model"`
+	// PromptTokens the number of tokens of the prompt, including the system content with the examples.
+	PromptTokens int `json:"prompt_tokens"`
+	// CompletionTokens the expected number of tokens of the model's output.
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	// Cost the estimated cost in USD.
+	Cost float64 `json:"cost"`
+}
+
+// NewEstimate defines the Estimate given the number of tokens and the model's price.
+func NewEstimate(model string, promptTokens, completionTokens int, price Price) Estimate {
+	return Estimate{
+		Model:            model,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+		Cost:             (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1000,
+	}
+}
+
+// Price defines the model's price in USD per 1000 tokens.
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// ParsePrices decodes the JSON-encoded prices per model,
+// e.g. {"gpt-3.5-turbo":{"prompt":0.0015,"completion":0.002}}.
+func ParsePrices(data []byte) (map[string]Price, error) {
+	var o map[string]Price
+	err := json.Unmarshal(data, &o)
+	return o, err
+}
+
+// NewApproximateTokenizer initialises the Tokenizer which approximates the number of tokens
+// as one token per four characters, i.e. the rule of thumb for the English text.
+func NewApproximateTokenizer() Tokenizer {
+	return approximateTokenizer{}
+}
+
+type approximateTokenizer struct{}
+
+func (approximateTokenizer) CountTokens(_, text string) (int, error) {
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken, nil
+}
+
+const charsPerToken = 4
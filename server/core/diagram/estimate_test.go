@@ -0,0 +1,68 @@
+package diagram
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewEstimate(t *testing.T) {
+	// WHEN
+	got := NewEstimate("foo", 1000, 500, Price{Prompt: 0.0015, Completion: 0.002})
+
+	// THEN
+	want := Estimate{Model: "foo", PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500, Cost: 0.0025}
+	if got != want {
+		t.Errorf("unexpected estimate: got = %+v, want = %+v", got, want)
+	}
+}
+
+func TestParsePrices(t *testing.T) {
+	t.Run(
+		"shall parse the prices", func(t *testing.T) {
+			// WHEN
+			got, err := ParsePrices([]byte(`{"foo":{"prompt":0.0015,"completion":0.002}}`))
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[string]Price{"foo": {Prompt: 0.0015, Completion: 0.002}}; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected prices: got = %v, want = %v", got, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given invalid JSON", func(t *testing.T) {
+			// WHEN
+			_, err := ParsePrices([]byte(`{`))
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
+
+func TestApproximateTokenizer(t *testing.T) {
+	tokenizer := NewApproximateTokenizer()
+	for text, want := range map[string]int{
+		"":                  0,
+		"foo":               1,
+		"c4 diagram":        3,
+		"схема контейнеров": 5,
+	} {
+		t.Run(
+			text, func(t *testing.T) {
+				got, err := tokenizer.CountTokens("foo", text)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("unexpected tokens count: got = %d, want = %d", got, want)
+				}
+			},
+		)
+	}
+}
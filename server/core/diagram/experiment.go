@@ -0,0 +1,98 @@
+package diagram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+)
+
+// ExperimentConfig defines the experiment comparing the variants of the system prompt and the model.
+type ExperimentConfig struct {
+	// Name the experiment's name, the users are bucketed independently per experiment.
+	Name string `json:"name"`
+	// Variants the experiment's variants, the users are bucketed proportionally to the variants' weights.
+	Variants []Variant `json:"variants"`
+}
+
+// Variant defines the experiment's variant. The empty model and system prompt keep the defaults.
+type Variant struct {
+	// Name the variant's name recorded with the prediction.
+	Name string `json:"name"`
+	// Weight the share of the users assigned to the variant relative to the other variants.
+	Weight int `json:"weight"`
+	// Model the model to generate the diagrams.
+	Model string `json:"model,omitempty"`
+	// SystemContent the system prompt to instruct the model.
+	SystemContent string `json:"system_content,omitempty"`
+}
+
+// Validate validates the experiment's configuration.
+func (cfg ExperimentConfig) Validate() error {
+	if cfg.Name == "" {
+		return errors.New("experiment's name must be provided")
+	}
+	if len(cfg.Variants) == 0 {
+		return errors.New("experiment's variants must be provided")
+	}
+	names := map[string]struct{}{}
+	for _, v := range cfg.Variants {
+		if v.Name == "" {
+			return errors.New("variant's name must be provided")
+		}
+		if _, ok := names[v.Name]; ok {
+			return errors.New("variant's name must be unique, got duplicate: " + v.Name)
+		}
+		names[v.Name] = struct{}{}
+		if v.Weight <= 0 {
+			return errors.New("variant's weight must be positive, variant: " + v.Name)
+		}
+	}
+	return nil
+}
+
+// ParseExperimentConfig decodes the JSON-encoded ExperimentConfig and validates it,
+// e.g. {"name":"foo","variants":[{"name":"control","weight":1},{"name":"bar","weight":1,"model":"gpt-4"}]}.
+func ParseExperimentConfig(data []byte) (ExperimentConfig, error) {
+	var cfg ExperimentConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// NewExperiment initialises the Experiment which buckets the users deterministically by the hash of their IDs,
+// i.e. the user is assigned to the same variant as long as the experiment's name and variants do not change.
+// The users are not assigned if the configuration is invalid.
+func NewExperiment(cfg ExperimentConfig) Experiment {
+	var total uint32
+	if cfg.Validate() == nil {
+		for _, v := range cfg.Variants {
+			total += uint32(v.Weight)
+		}
+	}
+	return hashExperiment{cfg: cfg, totalWeight: total}
+}
+
+type hashExperiment struct {
+	cfg         ExperimentConfig
+	totalWeight uint32
+}
+
+func (e hashExperiment) Assign(_ context.Context, userID string) (Variant, bool) {
+	if e.totalWeight == 0 {
+		return Variant{}, false
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(e.cfg.Name + "\x00" + userID))
+	bucket := h.Sum32() % e.totalWeight
+
+	for _, v := range e.cfg.Variants {
+		if bucket < uint32(v.Weight) {
+			return v, true
+		}
+		bucket -= uint32(v.Weight)
+	}
+	return Variant{}, false
+}
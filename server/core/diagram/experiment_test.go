@@ -0,0 +1,122 @@
+package diagram
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestNewExperiment(t *testing.T) {
+	cfg := ExperimentConfig{
+		Name: "foo",
+		Variants: []Variant{
+			{Name: "control", Weight: 1},
+			{Name: "bar", Weight: 3, Model: "gpt-4"},
+		},
+	}
+
+	t.Run(
+		"shall assign the same user to the same variant", func(t *testing.T) {
+			// GIVEN
+			experiment := NewExperiment(cfg)
+
+			for i := 0; i < 100; i++ {
+				userID := "user-" + strconv.Itoa(i)
+
+				// WHEN
+				want, ok := experiment.Assign(context.TODO(), userID)
+				if !ok {
+					t.Fatal("the user shall be assigned")
+				}
+				// the new instance with the same configuration, e.g. after restart
+				got, _ := NewExperiment(cfg).Assign(context.TODO(), userID)
+
+				// THEN
+				if got != want {
+					t.Errorf("the user %s shall be assigned to the same variant: got = %v, want = %v", userID, got, want)
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"shall assign the users proportionally to the weights", func(t *testing.T) {
+			// GIVEN
+			experiment := NewExperiment(cfg)
+
+			// WHEN
+			got := map[string]int{}
+			for i := 0; i < 10000; i++ {
+				v, _ := experiment.Assign(context.TODO(), strconv.Itoa(i))
+				got[v.Name]++
+			}
+
+			// THEN
+			if got["control"] < 2000 || got["control"] > 3000 || got["bar"] < 7000 || got["bar"] > 8000 {
+				t.Errorf("unexpected distribution of the users: %v", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall not assign the users given invalid configuration", func(t *testing.T) {
+			// GIVEN
+			experiment := NewExperiment(ExperimentConfig{Name: "foo", Variants: []Variant{{Name: "bar"}}})
+
+			// WHEN
+			_, ok := experiment.Assign(context.TODO(), "qux")
+
+			// THEN
+			if ok {
+				t.Error("the user shall not be assigned")
+			}
+		},
+	)
+}
+
+func TestParseExperimentConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			data: `{"name":"foo","variants":[{"name":"control","weight":1},{"name":"bar","weight":1,"model":"gpt-4"}]}`,
+		},
+		{
+			name:    "faulty JSON",
+			data:    `{`,
+			wantErr: true,
+		},
+		{
+			name:    "no name",
+			data:    `{"variants":[{"name":"control","weight":1}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "no variants",
+			data:    `{"name":"foo"}`,
+			wantErr: true,
+		},
+		{
+			name:    "duplicate variants",
+			data:    `{"name":"foo","variants":[{"name":"control","weight":1},{"name":"control","weight":1}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "no weight",
+			data:    `{"name":"foo","variants":[{"name":"control"}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if _, err := ParseExperimentConfig([]byte(tt.data)); (err != nil) != tt.wantErr {
+					t.Errorf("ParseExperimentConfig() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
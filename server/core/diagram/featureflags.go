@@ -0,0 +1,38 @@
+package diagram
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// FeatureFlagsConfig defines the features' state.
+type FeatureFlagsConfig struct {
+	// Defaults the features' state for all users. The feature is disabled if it is not listed.
+	Defaults map[string]bool `json:"defaults,omitempty"`
+	// Users the features' state per user ID which overrides the default state.
+	Users map[string]map[string]bool `json:"users,omitempty"`
+}
+
+// ParseFeatureFlagsConfig decodes the JSON-encoded FeatureFlagsConfig,
+// e.g. {"defaults":{"foo":true},"users":{"bar":{"foo":false}}}.
+func ParseFeatureFlagsConfig(data []byte) (FeatureFlagsConfig, error) {
+	var cfg FeatureFlagsConfig
+	err := json.Unmarshal(data, &cfg)
+	return cfg, err
+}
+
+// NewFeatureFlags initialises FeatureFlags with the static configuration.
+func NewFeatureFlags(cfg FeatureFlagsConfig) FeatureFlags {
+	return staticFeatureFlags{cfg: cfg}
+}
+
+type staticFeatureFlags struct {
+	cfg FeatureFlagsConfig
+}
+
+func (f staticFeatureFlags) IsEnabled(_ context.Context, flag, userID string) bool {
+	if v, ok := f.cfg.Users[userID][flag]; ok {
+		return v
+	}
+	return f.cfg.Defaults[flag]
+}
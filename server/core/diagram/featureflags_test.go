@@ -0,0 +1,101 @@
+package diagram
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestNewFeatureFlags(t *testing.T) {
+	flags := NewFeatureFlags(
+		FeatureFlagsConfig{
+			Defaults: map[string]bool{"foo": true, "bar": false},
+			Users: map[string]map[string]bool{
+				"qux":  {"foo": false},
+				"quux": {"bar": true},
+			},
+		},
+	)
+
+	tests := []struct {
+		name   string
+		flag   string
+		userID string
+		want   bool
+	}{
+		{
+			name:   "enabled by default",
+			flag:   "foo",
+			userID: "baz",
+			want:   true,
+		},
+		{
+			name:   "disabled by default",
+			flag:   "bar",
+			userID: "baz",
+			want:   false,
+		},
+		{
+			name:   "unknown flag",
+			flag:   "baz",
+			userID: "baz",
+			want:   false,
+		},
+		{
+			name:   "disabled for the user",
+			flag:   "foo",
+			userID: "qux",
+			want:   false,
+		},
+		{
+			name:   "enabled for the user",
+			flag:   "bar",
+			userID: "quux",
+			want:   true,
+		},
+		{
+			name:   "default for the user without override of the flag",
+			flag:   "foo",
+			userID: "quux",
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := flags.IsEnabled(context.TODO(), tt.flag, tt.userID); got != tt.want {
+					t.Errorf("IsEnabled() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestParseFeatureFlagsConfig(t *testing.T) {
+	t.Run(
+		"shall parse the config", func(t *testing.T) {
+			// WHEN
+			got, err := ParseFeatureFlagsConfig([]byte(`{"defaults":{"foo":true},"users":{"bar":{"foo":false}}}`))
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := FeatureFlagsConfig{
+				Defaults: map[string]bool{"foo": true},
+				Users:    map[string]map[string]bool{"bar": {"foo": false}},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected config: got = %+v, want = %+v", got, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail for faulty config", func(t *testing.T) {
+			if _, err := ParseFeatureFlagsConfig([]byte(`{"defaults":{"foo":"yes"}}`)); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
@@ -0,0 +1,111 @@
+package diagram
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	coreErrors "github.com/kislerdm/diagramastext/server/core/errors"
+	"github.com/kislerdm/diagramastext/server/core/internal/utils"
+)
+
+const (
+	// RatingUp the positive rating of the generated diagram, i.e. thumbs-up.
+	RatingUp = 1
+	// RatingDown the negative rating of the generated diagram, i.e. thumbs-down.
+	RatingDown = -1
+)
+
+// feedbackCommentLengthMax the maximum length of the feedback's comment in characters.
+const feedbackCommentLengthMax = 1000
+
+// InputFeedback defines the user's feedback on the generated diagram, e.g. to improve the model.
+type InputFeedback struct {
+	// RequestID the ID of the request which generated the diagram, see the header X-Request-ID.
+	RequestID string `json:"request_id"`
+	// Rating the diagram's rating, see RatingUp and RatingDown.
+	Rating int `json:"rating"`
+	// Comment the optional comment.
+	Comment string `json:"comment,omitempty"`
+	UserID  string `json:"-"`
+}
+
+// Validate checks that the request ID is UUID, the rating is set, and the comment does not exceed the limit.
+func (v InputFeedback) Validate() error {
+	if v.RequestID == "" {
+		return errors.New("request_id must be set")
+	}
+	if err := utils.ValidateUUID(v.RequestID); err != nil {
+		return errors.New("request_id must be UUID")
+	}
+	if v.Rating != RatingUp && v.Rating != RatingDown {
+		return errors.New("rating must be " + strconv.Itoa(RatingUp) + " or " + strconv.Itoa(RatingDown))
+	}
+	if utf8.RuneCountInString(v.Comment) > feedbackCommentLengthMax {
+		return errors.New("comment must not exceed " + strconv.Itoa(feedbackCommentLengthMax) + " characters")
+	}
+	return nil
+}
+
+// FeedbackHandler records the user's feedback on the generated diagram.
+type FeedbackHandler func(ctx context.Context, input InputFeedback) error
+
+// RepositoryFeedback defines the interface to store the user's feedback on the generated diagrams.
+type RepositoryFeedback interface {
+	// WriteFeedback records the feedback on the request's diagram, the feedback replaces the previous one.
+	// found is false if the user did not make the request.
+	WriteFeedback(ctx context.Context, requestID, userID string, rating int, comment string) (found bool, err error)
+}
+
+// NewFeedbackHandler initialises the FeedbackHandler which stores the feedback in the repository.
+// The feedback on the unknown request is rejected.
+func NewFeedbackHandler(repository RepositoryFeedback) (FeedbackHandler, error) {
+	if repository == nil {
+		return nil, errors.New("repository must be provided")
+	}
+
+	return func(ctx context.Context, input InputFeedback) error {
+		if err := input.Validate(); err != nil {
+			return coreErrors.HTTPHandlerError{
+				Msg: err.Error(), Type: "feedback", HTTPCode: http.StatusUnprocessableEntity,
+			}
+		}
+
+		found, err := repository.WriteFeedback(ctx, input.RequestID, input.UserID, input.Rating, input.Comment)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return coreErrors.HTTPHandlerError{
+				Msg: "request " + input.RequestID + " not found", Type: "feedback", HTTPCode: http.StatusNotFound,
+			}
+		}
+		return nil
+	}, nil
+}
+
+// MockRepositoryFeedback records the feedback on the requests listed in RequestIDs.
+type MockRepositoryFeedback struct {
+	RequestIDs []string
+	Err        error
+	Feedback   []InputFeedback
+}
+
+func (m *MockRepositoryFeedback) WriteFeedback(
+	_ context.Context, requestID, userID string, rating int, comment string,
+) (bool, error) {
+	if m.Err != nil {
+		return false, m.Err
+	}
+	for _, id := range m.RequestIDs {
+		if id == requestID {
+			m.Feedback = append(
+				m.Feedback, InputFeedback{RequestID: requestID, UserID: userID, Rating: rating, Comment: comment},
+			)
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,125 @@
+package diagram
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	coreErrors "github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+func TestNewFeedbackHandler(t *testing.T) {
+	const requestID = "693a35ba-e42c-4168-8afc-5a7c359d1d05"
+
+	t.Run(
+		"shall fail given no repository", func(t *testing.T) {
+			if _, err := NewFeedbackHandler(nil); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+
+	t.Run(
+		"shall write the feedback", func(t *testing.T) {
+			// GIVEN
+			repository := &MockRepositoryFeedback{RequestIDs: []string{requestID}}
+			handler, err := NewFeedbackHandler(repository)
+			if err != nil {
+				t.Fatal(err)
+			}
+			input := InputFeedback{RequestID: requestID, Rating: RatingDown, Comment: "qux", UserID: "bar"}
+
+			// WHEN
+			err = handler(context.TODO(), input)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(repository.Feedback, []InputFeedback{input}) {
+				t.Errorf("unexpected feedback: %+v", repository.Feedback)
+			}
+		},
+	)
+
+	tests := []struct {
+		name       string
+		input      InputFeedback
+		repository *MockRepositoryFeedback
+		wantCode   int
+	}{
+		{
+			name: "unknown request ID",
+			input: InputFeedback{
+				RequestID: "c40bad11-0822-4d84-9f61-44b9a97b0432", Rating: RatingUp, UserID: "bar",
+			},
+			repository: &MockRepositoryFeedback{RequestIDs: []string{requestID}},
+			wantCode:   http.StatusNotFound,
+		},
+		{
+			name:       "no request ID",
+			input:      InputFeedback{Rating: RatingUp, UserID: "bar"},
+			repository: &MockRepositoryFeedback{},
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "request ID is not UUID",
+			input:      InputFeedback{RequestID: "foo", Rating: RatingUp, UserID: "bar"},
+			repository: &MockRepositoryFeedback{RequestIDs: []string{"foo"}},
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "unknown rating",
+			input:      InputFeedback{RequestID: requestID, Rating: 5, UserID: "bar"},
+			repository: &MockRepositoryFeedback{RequestIDs: []string{requestID}},
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name: "too long comment",
+			input: InputFeedback{
+				RequestID: requestID, Rating: RatingUp, UserID: "bar",
+				Comment: strings.Repeat("ä", feedbackCommentLengthMax+1),
+			},
+			repository: &MockRepositoryFeedback{RequestIDs: []string{requestID}},
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			"shall reject the feedback given "+tt.name, func(t *testing.T) {
+				// GIVEN
+				handler, _ := NewFeedbackHandler(tt.repository)
+
+				// WHEN
+				err := handler(context.TODO(), tt.input)
+
+				// THEN
+				var errHandler coreErrors.HTTPHandlerError
+				if !errors.As(err, &errHandler) || errHandler.HTTPCode != tt.wantCode {
+					t.Errorf("unexpected error: %v", err)
+				}
+				if len(tt.repository.Feedback) > 0 {
+					t.Error("the feedback shall not be written")
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"shall return the repository's error", func(t *testing.T) {
+			// GIVEN
+			handler, _ := NewFeedbackHandler(&MockRepositoryFeedback{Err: errors.New("foo")})
+
+			// WHEN
+			err := handler(context.TODO(), InputFeedback{RequestID: requestID, Rating: RatingUp, UserID: "bar"})
+
+			// THEN
+			if err == nil || err.Error() != "foo" {
+				t.Errorf("unexpected error: %v", err)
+			}
+		},
+	)
+}
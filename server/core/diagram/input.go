@@ -15,6 +15,89 @@ type Input interface {
 	GetUserAPIToken() string
 	GetPrompt() string
 	GetRequestID() string
+	GetComplexityLimits() ComplexityLimits
+}
+
+// InputRegeneration defines the Input which regenerates the diagram for the prompt the user was not satisfied with.
+type InputRegeneration interface {
+	// GetRegeneration returns the number of the diagram's regenerations including the current one,
+	// zero value defines the initial generation.
+	GetRegeneration() int
+}
+
+// WithRegeneration sets the number of the diagram's regenerations to the Input created by NewInput,
+// other inputs are returned unchanged.
+func WithRegeneration(input Input, regeneration int) Input {
+	if v, ok := input.(*inquiry); ok {
+		v.Regeneration = regeneration
+	}
+	return input
+}
+
+// InputGraph defines the Input which requests the diagram's graph along with the diagram,
+// e.g. to let the user edit and re-render it.
+type InputGraph interface {
+	GetIncludeGraph() bool
+}
+
+// WithIncludeGraph requests the diagram's graph in the output of the Input created by NewInput,
+// other inputs are returned unchanged.
+func WithIncludeGraph(input Input) Input {
+	if v, ok := input.(*inquiry); ok {
+		v.IncludeGraph = true
+	}
+	return input
+}
+
+// ClientMetadata defines the client which requested the diagram, e.g. for the analytics.
+// The zero value defines the unknown client.
+type ClientMetadata struct {
+	// UserAgent the client's User-Agent.
+	UserAgent string
+	// Version the version of the client application, see the header X-Client-Version.
+	Version string
+}
+
+// InputClient defines the Input which reports the client which requested the diagram.
+type InputClient interface {
+	GetClient() ClientMetadata
+}
+
+// WithClient sets the client's metadata to the Input created by NewInput, other inputs are returned unchanged.
+func WithClient(input Input, client ClientMetadata) Input {
+	if v, ok := input.(*inquiry); ok {
+		v.Client = client
+	}
+	return input
+}
+
+// Branding defines the tenant's branding of the diagram, e.g. of the reseller. The zero value keeps the defaults.
+type Branding struct {
+	// DefaultFooter the footer of the diagrams which do not define it.
+	DefaultFooter string
+	// Theme the PlantUML theme of the diagrams, e.g. "cerulean".
+	Theme string
+}
+
+// InputBranding defines the Input which overrides the diagram's default branding.
+type InputBranding interface {
+	GetBranding() Branding
+}
+
+// WithBranding sets the branding to the Input created by NewInput, other inputs are returned unchanged.
+func WithBranding(input Input, branding Branding) Input {
+	if v, ok := input.(*inquiry); ok {
+		v.Branding = branding
+	}
+	return input
+}
+
+// ComplexityLimits defines the maximum number of the diagram's nodes and links, and the maximum number of diagrams
+// generated for the prompt. Zero value disables the limit.
+type ComplexityLimits struct {
+	NodesMax    int
+	LinksMax    int
+	DiagramsMax int
 }
 
 type MockInput struct {
@@ -23,6 +106,15 @@ type MockInput struct {
 	RequestID string
 	UserID    string
 	APIToken  string
+	Limits    ComplexityLimits
+	// Regeneration see InputRegeneration.
+	Regeneration int
+	// IncludeGraph see InputGraph.
+	IncludeGraph bool
+	// Client see InputClient.
+	Client ClientMetadata
+	// Branding see InputBranding.
+	Branding Branding
 }
 
 func (v MockInput) Validate() error {
@@ -45,16 +137,44 @@ func (v MockInput) GetRequestID() string {
 	return v.RequestID
 }
 
+func (v MockInput) GetComplexityLimits() ComplexityLimits {
+	return v.Limits
+}
+
+func (v MockInput) GetRegeneration() int {
+	return v.Regeneration
+}
+
+func (v MockInput) GetIncludeGraph() bool {
+	return v.IncludeGraph
+}
+
+func (v MockInput) GetClient() ClientMetadata {
+	return v.Client
+}
+
+func (v MockInput) GetBranding() Branding {
+	return v.Branding
+}
+
 type inquiry struct {
 	Prompt          string
 	RequestID       string
 	UserID          string
 	APIToken        string
 	PromptLengthMax uint16
+	Limits          ComplexityLimits
+	Regeneration    int
+	IncludeGraph    bool
+	Client          ClientMetadata
+	Branding        Branding
 }
 
 const promptLengthMin = 3
 
+// ErrPromptEmpty the error of the empty prompt, or the prompt of whitespaces only.
+var ErrPromptEmpty = errors.New("prompt must not be empty")
+
 func (v inquiry) GetPrompt() string {
 	return v.Prompt
 }
@@ -71,10 +191,33 @@ func (v inquiry) GetUserAPIToken() string {
 	return v.APIToken
 }
 
+func (v inquiry) GetComplexityLimits() ComplexityLimits {
+	return v.Limits
+}
+
+func (v inquiry) GetRegeneration() int {
+	return v.Regeneration
+}
+
+func (v inquiry) GetIncludeGraph() bool {
+	return v.IncludeGraph
+}
+
+func (v inquiry) GetClient() ClientMetadata {
+	return v.Client
+}
+
+func (v inquiry) GetBranding() Branding {
+	return v.Branding
+}
+
 func (v inquiry) Validate() error {
 	max := int(v.PromptLengthMax)
 
 	prompt := strings.ReplaceAll(v.Prompt, "\n", "")
+	if strings.TrimSpace(prompt) == "" {
+		return ErrPromptEmpty
+	}
 
 	if len(prompt) < promptLengthMin || len(prompt) > max {
 		return errors.New(
@@ -87,11 +230,15 @@ func (v inquiry) Validate() error {
 }
 
 // NewInput initialises the `Input` object.
-func NewInput(prompt string, userID string, apiToken string, promptLengthMax uint16) (Input, error) {
+// The prompt is trimmed, and its whitespaces are collapsed before the validation, see trimPrompt.
+func NewInput(
+	prompt string, userID string, apiToken string, promptLengthMax uint16, limits ComplexityLimits,
+) (Input, error) {
 	o := &inquiry{
-		Prompt:          prompt,
+		Prompt:          trimPrompt(prompt),
 		UserID:          userID,
 		PromptLengthMax: promptLengthMax,
+		Limits:          limits,
 		APIToken:        apiToken,
 		RequestID:       utils.NewUUID(),
 	}
@@ -102,3 +249,9 @@ func NewInput(prompt string, userID string, apiToken string, promptLengthMax uin
 
 	return o, nil
 }
+
+// trimPrompt removes the leading and trailing whitespaces, and replaces the sequences of whitespaces,
+// including the line breaks, with a single space. It prevents the padding from skewing the prompt's length.
+func trimPrompt(prompt string) string {
+	return strings.Join(strings.Fields(prompt), " ")
+}
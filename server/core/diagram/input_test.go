@@ -55,6 +55,21 @@ func Test_inquiry_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "unhappy path - empty",
+			fields: fields{
+				PromptLengthMax: promptLengthMax,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unhappy path - whitespaces only",
+			fields: fields{
+				Prompt:          " \t \n  ",
+				PromptLengthMax: promptLengthMax,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(
@@ -77,6 +92,7 @@ func TestNewInput(t *testing.T) {
 		userID          string
 		apiToken        string
 		promptLengthMax uint16
+		limits          ComplexityLimits
 	}
 
 	const promptLengthMax = 100
@@ -96,14 +112,49 @@ func TestNewInput(t *testing.T) {
 				userID:          "00000000-0000-0000-0000-000000000000",
 				promptLengthMax: promptLengthMax,
 				apiToken:        "foobar",
+				limits:          ComplexityLimits{NodesMax: 10, LinksMax: 20},
 			},
 			want: &inquiry{
 				Prompt:   validPrompt,
 				UserID:   "00000000-0000-0000-0000-000000000000",
 				APIToken: "foobar",
+				Limits:   ComplexityLimits{NodesMax: 10, LinksMax: 20},
 			},
 			wantErr: false,
 		},
+		{
+			name: "happy path: padded prompt",
+			args: args{
+				prompt:          " \n\tfoo   bar\n\nbaz \t",
+				userID:          "00000000-0000-0000-0000-000000000000",
+				promptLengthMax: promptLengthMax,
+			},
+			want: &inquiry{
+				Prompt: "foo bar baz",
+				UserID: "00000000-0000-0000-0000-000000000000",
+			},
+			wantErr: false,
+		},
+		{
+			name: "unhappy path: padded too short prompt",
+			args: args{
+				prompt:          "   fo    ",
+				userID:          "00000000-0000-0000-0000-000000000000",
+				promptLengthMax: promptLengthMax,
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "unhappy path: whitespace-only prompt",
+			args: args{
+				prompt:          " \n\t  ",
+				userID:          "00000000-0000-0000-0000-000000000000",
+				promptLengthMax: promptLengthMax,
+			},
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name: "unhappy path: invalid prompt",
 			args: args{
@@ -118,7 +169,9 @@ func TestNewInput(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(
 			tt.name, func(t *testing.T) {
-				got, err := NewInput(tt.args.prompt, tt.args.userID, tt.args.apiToken, tt.args.promptLengthMax)
+				got, err := NewInput(
+					tt.args.prompt, tt.args.userID, tt.args.apiToken, tt.args.promptLengthMax, tt.args.limits,
+				)
 				if (err != nil) != tt.wantErr {
 					t.Errorf("NewInputDriverHTTP() error = %v, wantErr %v", err, tt.wantErr)
 					return
@@ -136,6 +189,10 @@ func TestNewInput(t *testing.T) {
 					if !reflect.DeepEqual(got.GetUserAPIToken(), tt.want.GetUserAPIToken()) {
 						t.Errorf("NewInputDriverHTTP() unexpected userAPIToken: got = %v, want %v", got, tt.want)
 					}
+
+					if !reflect.DeepEqual(got.GetComplexityLimits(), tt.want.GetComplexityLimits()) {
+						t.Errorf("NewInputDriverHTTP() unexpected limits: got = %v, want %v", got, tt.want)
+					}
 				}
 			},
 		)
@@ -198,3 +255,26 @@ func TestMockInput(t *testing.T) {
 		},
 	)
 }
+
+func TestWithRegeneration(t *testing.T) {
+	// GIVEN
+	input, err := NewInput("foobar", "bar", "", 100, ComplexityLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// WHEN
+	got := WithRegeneration(input, 2)
+
+	// THEN
+	v, ok := got.(InputRegeneration)
+	if !ok {
+		t.Fatal("the input shall define the regeneration")
+	}
+	if v.GetRegeneration() != 2 {
+		t.Errorf("unexpected regeneration: %d", v.GetRegeneration())
+	}
+	if got.GetPrompt() != "foobar" || got.GetRequestID() != input.GetRequestID() {
+		t.Error("the input attributes shall be preserved")
+	}
+}
@@ -1,7 +1,10 @@
 package diagram
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 
 	"github.com/kislerdm/diagramastext/server/core/internal/utils"
 )
@@ -11,6 +14,46 @@ type Output interface {
 	Serialize() ([]byte, error)
 }
 
+// OutputSVG defines the Output which can be represented as the raw SVG diagram.
+type OutputSVG interface {
+	Output
+	// RawSVG returns XML-encoded SVG diagram.
+	RawSVG() []byte
+}
+
+// OutputSVGs defines the Output which can be represented as the list of raw SVG diagrams,
+// e.g. when the prompt describes several diagrams.
+type OutputSVGs interface {
+	OutputSVG
+	// RawSVGs returns XML-encoded SVG diagrams.
+	RawSVGs() [][]byte
+}
+
+// OutputWarnings defines the Output which carries the warnings about the diagram,
+// e.g. to suggest the user how to improve its readability.
+type OutputWarnings interface {
+	GetWarnings() []string
+}
+
+// OutputModel defines the Output which carries the model which generated the diagram,
+// and the version of the application, e.g. to reproduce and debug the diagram.
+type OutputModel interface {
+	GetModel() string
+	GetVersion() string
+}
+
+// OutputGraphs defines the Output which carries the JSON-encoded graphs of the diagrams,
+// e.g. to let the user edit and re-render them. The graphs are ordered as the diagrams.
+type OutputGraphs interface {
+	GetGraphs() []json.RawMessage
+}
+
+// OutputETag defines the Output which carries the deterministic hash of its serialized representation,
+// e.g. for the clients to detect the diagram's changes and to cache it.
+type OutputETag interface {
+	GetETag() string
+}
+
 type MockOutput struct {
 	V   []byte
 	Err error
@@ -26,16 +69,108 @@ func (m MockOutput) Serialize() ([]byte, error) {
 type responseSVG struct {
 	// SVG XML-encoded SVG diagram.
 	SVG string `json:"svg"`
+	// SVGs all diagrams generated from the prompt. The first diagram is also set as SVG for backward compatibility.
+	SVGs []string `json:"svgs,omitempty"`
+	// Warnings about the diagram which did not prevent its generation.
+	Warnings []string `json:"warnings,omitempty"`
+	// Model which generated the diagram.
+	Model string `json:"model,omitempty"`
+	// Version of the application which generated the diagram.
+	Version string `json:"version,omitempty"`
+	// Graphs the JSON-encoded graphs of the diagrams, they are only set on demand to limit the response's size.
+	Graphs []json.RawMessage `json:"graphs,omitempty"`
+	// ETag the hex-encoded SHA-256 hash of the serialized response without the ETag, see responseSVG.GetETag.
+	ETag string `json:"etag,omitempty"`
 }
 
 func (r responseSVG) Serialize() ([]byte, error) {
+	r.ETag = r.GetETag()
 	return json.Marshal(r)
 }
 
-// NewResultSVG create a response object with the SVG diagram.
-func NewResultSVG(v []byte) (Output, error) {
+func (r responseSVG) RawSVG() []byte {
+	return []byte(r.SVG)
+}
+
+func (r responseSVG) RawSVGs() [][]byte {
+	if len(r.SVGs) == 0 {
+		return [][]byte{r.RawSVG()}
+	}
+	o := make([][]byte, len(r.SVGs))
+	for i, v := range r.SVGs {
+		o[i] = []byte(v)
+	}
+	return o
+}
+
+func (r responseSVG) GetWarnings() []string {
+	return r.Warnings
+}
+
+func (r responseSVG) GetModel() string {
+	return r.Model
+}
+
+func (r responseSVG) GetVersion() string {
+	return r.Version
+}
+
+func (r responseSVG) GetGraphs() []json.RawMessage {
+	return r.Graphs
+}
+
+// GetETag returns the hex-encoded SHA-256 hash of the serialized response without the ETag, hence it changes
+// with any field of the response, e.g. with the graphs set by WithGraphs.
+func (r responseSVG) GetETag() string {
+	r.ETag = ""
+	v, err := json.Marshal(r)
+	if err != nil {
+		return ""
+	}
+	h := sha256.Sum256(v)
+	return hex.EncodeToString(h[:])
+}
+
+// WithGraphs sets the JSON-encoded graphs of the diagrams to the Output created by NewResultSVG,
+// or NewResultSVGs. Other outputs are returned unchanged.
+func WithGraphs(o Output, graphs []json.RawMessage) Output {
+	if r, ok := o.(*responseSVG); ok {
+		r.Graphs = graphs
+	}
+	return o
+}
+
+// WithModel sets the model which generated the diagram and the application's version to the Output
+// created by NewResultSVG, or NewResultSVGs. Other outputs are returned unchanged.
+func WithModel(o Output, model, version string) Output {
+	if r, ok := o.(*responseSVG); ok {
+		r.Model = model
+		r.Version = version
+	}
+	return o
+}
+
+// NewResultSVG create a response object with the SVG diagram and the optional warnings about it.
+func NewResultSVG(v []byte, warnings ...string) (Output, error) {
 	if err := utils.ValidateSVG(v); err != nil {
 		return nil, err
 	}
-	return &responseSVG{SVG: string(v)}, nil
+	return &responseSVG{SVG: string(v), Warnings: warnings}, nil
+}
+
+// NewResultSVGs create a response object with the SVG diagrams generated from a single prompt
+// and the optional warnings about them.
+func NewResultSVGs(v [][]byte, warnings ...string) (Output, error) {
+	if len(v) == 0 {
+		return nil, errors.New("no diagrams found")
+	}
+
+	o := &responseSVG{SVG: string(v[0]), SVGs: make([]string, len(v)), Warnings: warnings}
+	for i, el := range v {
+		if err := utils.ValidateSVG(el); err != nil {
+			return nil, err
+		}
+		o.SVGs[i] = string(el)
+	}
+	return o, nil
 }
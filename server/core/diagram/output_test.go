@@ -1,6 +1,9 @@
 package diagram
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"reflect"
 	"testing"
@@ -67,9 +70,19 @@ func TestNewResultSVG(t *testing.T) {
 	}
 }
 
+// withETag adds the ETag of the serialized response without it, see responseSVG.GetETag.
+func withETag(v []byte) []byte {
+	h := sha256.Sum256(v)
+	return []byte(string(v[:len(v)-1]) + `,"etag":"` + hex.EncodeToString(h[:]) + `"}`)
+}
+
 func Test_responseSVG_Serialize(t *testing.T) {
 	type fields struct {
-		SVG string
+		SVG      string
+		Warnings []string
+		Model    string
+		Version  string
+		Graphs   []json.RawMessage
 	}
 
 	tests := []struct {
@@ -86,26 +99,98 @@ func Test_responseSVG_Serialize(t *testing.T) {
 			want:    []byte(`{"svg":"foo"}`),
 			wantErr: false,
 		},
+		{
+			name: "happy path: with warnings",
+			fields: fields{
+				SVG:      "foo",
+				Warnings: []string{"bar"},
+			},
+			want:    []byte(`{"svg":"foo","warnings":["bar"]}`),
+			wantErr: false,
+		},
+		{
+			name: "happy path: with model",
+			fields: fields{
+				SVG:     "foo",
+				Model:   "gpt-3.5-turbo",
+				Version: "v1.0.0",
+			},
+			want:    []byte(`{"svg":"foo","model":"gpt-3.5-turbo","version":"v1.0.0"}`),
+			wantErr: false,
+		},
+		{
+			name: "happy path: with graphs",
+			fields: fields{
+				SVG:    "foo",
+				Graphs: []json.RawMessage{[]byte(`{"nodes":[{"id":"0"}]}`)},
+			},
+			want:    []byte(`{"svg":"foo","graphs":[{"nodes":[{"id":"0"}]}]}`),
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(
 			tt.name, func(t *testing.T) {
 				r := responseSVG{
-					SVG: tt.fields.SVG,
+					SVG:      tt.fields.SVG,
+					Warnings: tt.fields.Warnings,
+					Model:    tt.fields.Model,
+					Version:  tt.fields.Version,
+					Graphs:   tt.fields.Graphs,
 				}
 				got, err := r.Serialize()
 				if (err != nil) != tt.wantErr {
 					t.Errorf("Serialize() error = %v, wantErr %v", err, tt.wantErr)
 					return
 				}
-				if !reflect.DeepEqual(got, tt.want) {
-					t.Errorf("Serialize() got = %v, want %v", got, tt.want)
+				if want := withETag(tt.want); !reflect.DeepEqual(got, want) {
+					t.Errorf("Serialize() got = %s, want %s", got, want)
 				}
 			},
 		)
 	}
 }
 
+func Test_responseSVG_GetETag(t *testing.T) {
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" height="179px" viewBox="0 0 375 179" width="375px">` +
+		`<g><g><rect height="52" rx="2.5" ry="2.5" width="125" x="7" y="11"></rect></g></g></svg>`
+
+	newOutput := func() Output {
+		o, err := NewResultSVG([]byte(svg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return o
+	}
+	etag := newOutput().(OutputETag).GetETag()
+
+	t.Run(
+		"shall be deterministic", func(t *testing.T) {
+			if got := newOutput().(OutputETag).GetETag(); got != etag {
+				t.Errorf("unexpected etag: got = %s, want = %s", got, etag)
+			}
+		},
+	)
+
+	t.Run(
+		"shall change with the graphs", func(t *testing.T) {
+			o := WithGraphs(newOutput(), []json.RawMessage{[]byte(`{"nodes":[{"id":"0"}]}`)})
+			if o.(OutputETag).GetETag() == etag {
+				t.Error("the etag shall change with the response's body")
+			}
+		},
+	)
+
+	t.Run(
+		"shall change with the model", func(t *testing.T) {
+			o := WithModel(newOutput(), "gpt-3.5-turbo", "v1.0.0")
+			if o.(OutputETag).GetETag() == etag {
+				t.Error("the etag shall change with the response's body")
+			}
+		},
+	)
+}
+
 func TestMockOutput_Serialize(t *testing.T) {
 	type fields struct {
 		V   []byte
@@ -154,3 +239,83 @@ func TestMockOutput_Serialize(t *testing.T) {
 		)
 	}
 }
+
+func Test_responseSVG_RawSVG(t *testing.T) {
+	const want = `<svg xmlns="http://www.w3.org/2000/svg"></svg>`
+	if got := (responseSVG{SVG: want}).RawSVG(); string(got) != want {
+		t.Errorf("RawSVG() = %s, want %s", got, want)
+	}
+}
+
+func TestNewResultSVGs(t *testing.T) {
+	const (
+		svg0 = `<svg xmlns="http://www.w3.org/2000/svg" height="179px" viewBox="0 0 375 179" width="375px">` +
+			`<g><g><rect height="52" rx="2.5" ry="2.5" width="125" x="7" y="11"></rect></g></g></svg>`
+		svg1 = `<svg xmlns="http://www.w3.org/2000/svg" height="100px" viewBox="0 0 100 100" width="100px">` +
+			`<g><g><rect height="52" rx="2.5" ry="2.5" width="50" x="7" y="11"></rect></g></g></svg>`
+	)
+
+	t.Run(
+		"shall return all diagrams and the first one as svg", func(t *testing.T) {
+			// WHEN
+			got, err := NewResultSVGs([][]byte{[]byte(svg0), []byte(svg1)}, "foo")
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v, err := got.Serialize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := json.Marshal(responseSVG{SVG: svg0, SVGs: []string{svg0, svg1}, Warnings: []string{"foo"}})
+			if want = withETag(want); string(v) != string(want) {
+				t.Errorf("unexpected serialized output: got = %s, want = %s", v, want)
+			}
+
+			if !reflect.DeepEqual(got.(OutputSVGs).RawSVGs(), [][]byte{[]byte(svg0), []byte(svg1)}) {
+				t.Errorf("unexpected raw svgs")
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail for no diagrams and for invalid svg", func(t *testing.T) {
+			if _, err := NewResultSVGs(nil); err == nil {
+				t.Error("error expected for no diagrams")
+			}
+			if _, err := NewResultSVGs([][]byte{[]byte(svg0), {0}}); err == nil {
+				t.Error("error expected for invalid svg")
+			}
+		},
+	)
+}
+
+func Test_responseSVG_RawSVGs(t *testing.T) {
+	const want = `<svg xmlns="http://www.w3.org/2000/svg"></svg>`
+	if got := (responseSVG{SVG: want}).RawSVGs(); !reflect.DeepEqual(got, [][]byte{[]byte(want)}) {
+		t.Errorf("RawSVGs() = %s, want %s", got, want)
+	}
+}
+
+func TestWithGraphs(t *testing.T) {
+	// GIVEN
+	o := &responseSVG{SVG: "foo"}
+	graphs := []json.RawMessage{[]byte(`{"nodes":[{"id":"0"}]}`)}
+
+	// WHEN
+	got := WithGraphs(o, graphs)
+
+	// THEN
+	v, ok := got.(OutputGraphs)
+	if !ok {
+		t.Fatal("the output shall carry the graphs")
+	}
+	if !reflect.DeepEqual(v.GetGraphs(), graphs) {
+		t.Errorf("unexpected graphs: %s", v.GetGraphs())
+	}
+	if _, ok := WithGraphs(MockOutput{}, graphs).(OutputGraphs); ok {
+		t.Error("other outputs shall be returned unchanged")
+	}
+}
@@ -0,0 +1,67 @@
+package diagram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/kislerdm/diagramastext/server/core/internal/utils"
+)
+
+// InputPatch defines the JSON Patch, see https://www.rfc-editor.org/rfc/rfc6902, of the diagram's JSON-encoded graph,
+// e.g. to edit the diagram sending just the changes instead of the prompt.
+type InputPatch struct {
+	// RequestID the ID of the request which generated the diagram, see the header X-Request-ID.
+	// The patch is applied to the graph stored for the user's request, see RepositoryGraph.
+	RequestID string `json:"request_id"`
+	// Diagram the index of the request's diagram to patch, see OutputGraphs.
+	Diagram int `json:"diagram,omitempty"`
+	// Patch the list of the JSON Patch operations.
+	Patch  json.RawMessage  `json:"patch"`
+	UserID string           `json:"-"`
+	Limits ComplexityLimits `json:"-"`
+	// Branding the tenant's branding of the diagram, see InputBranding.
+	Branding Branding `json:"-"`
+}
+
+// Validate checks that the request ID and the patch are set, and the diagram's index is not negative.
+func (v InputPatch) Validate() error {
+	if err := utils.ValidateUUID(v.RequestID); err != nil {
+		return errors.New("request_id must be UUID")
+	}
+	if v.Diagram < 0 {
+		return errors.New("diagram must not be negative")
+	}
+	if len(v.Patch) == 0 || string(v.Patch) == "null" {
+		return errors.New("patch must be set")
+	}
+	return nil
+}
+
+// RepositoryGraph defines the interface to read the diagrams' graphs predicted by the model.
+type RepositoryGraph interface {
+	// ReadModelPrediction reads the prediction generated for the request.
+	// found is false if the user did not make the request.
+	ReadModelPrediction(ctx context.Context, requestID, userID string) (prediction string, found bool, err error)
+}
+
+// MockRepositoryGraph returns the prediction V of the requests listed in RequestIDs.
+type MockRepositoryGraph struct {
+	RequestIDs []string
+	V          string
+	Err        error
+}
+
+func (m MockRepositoryGraph) ReadModelPrediction(_ context.Context, requestID, _ string) (
+	string, bool, error,
+) {
+	if m.Err != nil {
+		return "", false, m.Err
+	}
+	for _, id := range m.RequestIDs {
+		if id == requestID {
+			return m.V, true, nil
+		}
+	}
+	return "", false, nil
+}
@@ -0,0 +1,54 @@
+package diagram
+
+import (
+	"testing"
+)
+
+func TestInputPatch_Validate(t *testing.T) {
+	const requestID = "693a35ba-e42c-4168-8afc-5a7c359d1d05"
+
+	tests := []struct {
+		name    string
+		input   InputPatch
+		wantErr bool
+	}{
+		{
+			name:  "shall pass given the request ID and the patch",
+			input: InputPatch{RequestID: requestID, Patch: []byte(`[]`)},
+		},
+		{
+			name:    "shall fail given no request ID",
+			input:   InputPatch{Patch: []byte(`[]`)},
+			wantErr: true,
+		},
+		{
+			name:    "shall fail given the request ID is not UUID",
+			input:   InputPatch{RequestID: "foo", Patch: []byte(`[]`)},
+			wantErr: true,
+		},
+		{
+			name:    "shall fail given the negative diagram's index",
+			input:   InputPatch{RequestID: requestID, Diagram: -1, Patch: []byte(`[]`)},
+			wantErr: true,
+		},
+		{
+			name:    "shall fail given no patch",
+			input:   InputPatch{RequestID: requestID},
+			wantErr: true,
+		},
+		{
+			name:    "shall fail given null patch",
+			input:   InputPatch{RequestID: requestID, Patch: []byte(`null`)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if err := tt.input.Validate(); (err != nil) != tt.wantErr {
+					t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
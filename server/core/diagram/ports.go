@@ -4,12 +4,36 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"strings"
 	"time"
 )
 
 // HTTPHandler httphandler to generate a diagram given the input.
 type HTTPHandler func(ctx context.Context, input Input) (Output, error)
 
+// EstimateHandler estimates the size and cost of the diagram generation given the input without calling the model.
+type EstimateHandler func(ctx context.Context, input Input) (Estimate, error)
+
+// PatchHandler applies the JSON Patch to the diagram's graph and renders the patched diagram, see InputPatch.
+type PatchHandler func(ctx context.Context, input InputPatch) (Output, error)
+
+// Tokenizer counts the tokens of the text for the model, e.g. to estimate the cost of the model inference.
+type Tokenizer interface {
+	CountTokens(model, text string) (int, error)
+}
+
+// MockTokenizer counts the words of the text as tokens.
+type MockTokenizer struct {
+	Err error
+}
+
+func (m MockTokenizer) CountTokens(_, text string) (int, error) {
+	if m.Err != nil {
+		return 0, m.Err
+	}
+	return len(strings.Fields(text)), nil
+}
+
 // RepositoryPrediction defines the interface to store prediction input (prompt) and model result.
 type RepositoryPrediction interface {
 	// WriteInputPrompt records user's input prompt.
@@ -29,6 +53,21 @@ type RepositoryPrediction interface {
 	Close(ctx context.Context) error
 }
 
+// RepositoryPredictionWithClient defines the RepositoryPrediction which records the user's input prompt
+// along with the client which requested the diagram, see InputClient. The empty metadata is recorded as null.
+type RepositoryPredictionWithClient interface {
+	WriteInputPromptWithClient(ctx context.Context, requestID, userID, prompt, userAgent, clientVersion string) error
+}
+
+// RepositoryPredictionWithVariant defines the RepositoryPrediction which records the model's prediction result
+// along with the experiment's variant which defined the model and the system prompt, see Experiment.
+type RepositoryPredictionWithVariant interface {
+	WriteModelResultWithVariant(
+		ctx context.Context, requestID, userID, predictionRaw, prediction, model string,
+		usageTokensPrompt, usageTokensCompletions uint16, variant string,
+	) error
+}
+
 type MockRepositoryPrediction struct {
 	Timestamps []time.Time
 	Err        error
@@ -73,11 +112,31 @@ type ModelInference interface {
 	)
 }
 
+// ModelNamer defines the ModelInference which reports the name of the model serving the requests,
+// e.g. to resolve the requested model's alias to its version.
+type ModelNamer interface {
+	ModelName(model string) string
+}
+
+// ModelInferenceWithTemperature defines the ModelInference which samples the output using the given temperature,
+// e.g. to vary the output when the diagram is regenerated. The higher temperature makes the output more random.
+type ModelInferenceWithTemperature interface {
+	DoWithTemperature(
+		ctx context.Context, userPrompt string, systemContent string, model string, temperature float32,
+	) (
+		predictionRaw string, prediction []byte, usageTokensPrompt uint16, usageTokensCompletions uint16, err error,
+	)
+}
+
 type MockModelInference struct {
+	// Model the name of the model reported by ModelName.
+	Model           string
 	V               []byte
 	UsagePrompt     uint16
 	UsageCompletion uint16
 	Err             error
+	// Temperatures records the temperatures passed to DoWithTemperature, if set.
+	Temperatures *[]float32
 }
 
 func (m MockModelInference) Do(_ context.Context, _, _, _ string) (string, []byte, uint16, uint16, error) {
@@ -87,6 +146,62 @@ func (m MockModelInference) Do(_ context.Context, _, _, _ string) (string, []byt
 	return string(m.V), m.V, m.UsagePrompt, m.UsageCompletion, nil
 }
 
+func (m MockModelInference) DoWithTemperature(
+	ctx context.Context, userPrompt, systemContent, model string, temperature float32,
+) (string, []byte, uint16, uint16, error) {
+	if m.Temperatures != nil {
+		*m.Temperatures = append(*m.Temperatures, temperature)
+	}
+	return m.Do(ctx, userPrompt, systemContent, model)
+}
+
+func (m MockModelInference) ModelName(model string) string {
+	if m.Model != "" {
+		return m.Model
+	}
+	return model
+}
+
+// PromptPreprocessor defines the interface to transform user's prompt before it is sent to the model and stored,
+// e.g. to redact the personal identifiable information.
+type PromptPreprocessor interface {
+	Process(ctx context.Context, prompt string) (string, error)
+}
+
+// Moderator defines the interface to check if user's prompt violates the content policy.
+type Moderator interface {
+	IsFlagged(ctx context.Context, prompt string) (bool, error)
+}
+
+// FeatureFlags defines the interface to check if the feature is enabled for the user at request time,
+// e.g. to roll out the feature gradually without redeployment.
+type FeatureFlags interface {
+	IsEnabled(ctx context.Context, flag, userID string) bool
+}
+
+// Experiment defines the interface to assign the user to the experiment's variant at request time,
+// e.g. to compare the system prompts and the models. The user is not assigned if the experiment does not apply.
+type Experiment interface {
+	Assign(ctx context.Context, userID string) (Variant, bool)
+}
+
+type MockFeatureFlags map[string]bool
+
+func (m MockFeatureFlags) IsEnabled(_ context.Context, flag, _ string) bool {
+	return m[flag]
+}
+
+// Tracer defines the interface to trace the stages of the request processing, e.g. using OpenTelemetry.
+type Tracer interface {
+	// Start starts the span as the child of the span found in the context.
+	// The returned function ends the span recording the error, if any.
+	Start(ctx context.Context, name string) (context.Context, func(err error))
+	// Extract returns the context with the remote span context propagated in the headers of the incoming request.
+	Extract(ctx context.Context, header http.Header) context.Context
+	// Inject propagates the span context found in the context into the headers of the outgoing request.
+	Inject(ctx context.Context, header http.Header)
+}
+
 // HTTPClient client to communicate over http.
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
@@ -0,0 +1,36 @@
+package diagram
+
+import (
+	"context"
+	"regexp"
+)
+
+// redactedPlaceholder replaces the redacted text.
+const redactedPlaceholder = "[REDACTED]"
+
+var (
+	patternEmail = regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
+	// patternPhone matches the international number starting with +, or the national number with the area code
+	// in parentheses, or separated by the whitespace, or the dash, e.g. 555-123-4567. The numbers without the groups'
+	// separators, the IP addresses and the dates are not matched.
+	patternPhone = regexp.MustCompile(
+		`\+\d{1,3}(?:[\s-]?\(\d{1,4}\))?(?:[\s-]?\d{2,8}){2,4}\b|(?:\(\d{2,4}\)[\s-]?|\b\d{3}[\s-])\d{3,4}[\s-]\d{4}\b`,
+	)
+)
+
+// NewRegexpRedactor initialises the PromptPreprocessor which redacts the emails, the phone numbers,
+// and the text matching the additional patterns.
+func NewRegexpRedactor(patterns ...*regexp.Regexp) PromptPreprocessor {
+	return regexpRedactor{patterns: append([]*regexp.Regexp{patternEmail, patternPhone}, patterns...)}
+}
+
+type regexpRedactor struct {
+	patterns []*regexp.Regexp
+}
+
+func (r regexpRedactor) Process(_ context.Context, prompt string) (string, error) {
+	for _, p := range r.patterns {
+		prompt = p.ReplaceAllLiteralString(prompt, redactedPlaceholder)
+	}
+	return prompt, nil
+}
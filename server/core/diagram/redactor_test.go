@@ -0,0 +1,71 @@
+package diagram
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+func TestNewRegexpRedactor(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []*regexp.Regexp
+		prompt   string
+		want     string
+	}{
+		{
+			name:   "email",
+			prompt: "user john.doe+c4@example.com calls go backend",
+			want:   "user [REDACTED] calls go backend",
+		},
+		{
+			name:   "phone numbers",
+			prompt: "call +49 170 1234567 or (030) 123-4567 to reach the support service",
+			want:   "call [REDACTED] or [REDACTED] to reach the support service",
+		},
+		{
+			name:   "phone numbers with the separators",
+			prompt: "call +1 (555) 123-4567, or 555 123 4567, or +491701234567",
+			want:   "call [REDACTED], or [REDACTED], or [REDACTED]",
+		},
+		{
+			name:   "IP addresses",
+			prompt: "backend at 192.168.100.1 reads from postgres at 10.0.0.12:5432",
+			want:   "backend at 192.168.100.1 reads from postgres at 10.0.0.12:5432",
+		},
+		{
+			name:   "dates",
+			prompt: "service deployed on 2023-04-15 replaced the one deployed on 15.04.2023 and 04/15/2023",
+			want:   "service deployed on 2023-04-15 replaced the one deployed on 15.04.2023 and 04/15/2023",
+		},
+		{
+			name:   "ports and counts",
+			prompt: "go backend listens on 8080, serves 10000 rps and 1500000 requests per day",
+			want:   "go backend listens on 8080, serves 10000 rps and 1500000 requests per day",
+		},
+		{
+			name:     "additional pattern",
+			patterns: []*regexp.Regexp{regexp.MustCompile(`(?i)acme corp`)},
+			prompt:   "ACME Corp backend reads from postgres",
+			want:     "[REDACTED] backend reads from postgres",
+		},
+		{
+			name:   "prompt without PII",
+			prompt: "c4 diagram with 3 python services publishing to kafka",
+			want:   "c4 diagram with 3 python services publishing to kafka",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := NewRegexpRedactor(tt.patterns...).Process(context.TODO(), tt.prompt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("Process() got = %s, want = %s", got, tt.want)
+				}
+			},
+		)
+	}
+}
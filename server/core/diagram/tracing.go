@@ -0,0 +1,216 @@
+package diagram
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// NewNoopTracer initialises the Tracer which does not record the spans, it is used by default.
+func NewNoopTracer() Tracer {
+	return noopTracer{}
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string) (context.Context, func(err error)) {
+	return ctx, func(error) {}
+}
+
+func (noopTracer) Extract(ctx context.Context, _ http.Header) context.Context {
+	return ctx
+}
+
+func (noopTracer) Inject(_ context.Context, _ http.Header) {}
+
+// NewTracingHTTPClient wraps the client to record the span with the name for every request,
+// and to propagate the span context to the server, e.g. to the PlantUML server.
+func NewTracingHTTPClient(client HTTPClient, tracer Tracer, name string) HTTPClient {
+	return tracingHTTPClient{client: client, tracer: tracer, name: name}
+}
+
+type tracingHTTPClient struct {
+	client HTTPClient
+	tracer Tracer
+	name   string
+}
+
+func (c tracingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	ctx, end := c.tracer.Start(req.Context(), c.name)
+	req = req.Clone(ctx)
+	c.tracer.Inject(ctx, req.Header)
+	resp, err := c.client.Do(req)
+	end(err)
+	return resp, err
+}
+
+// NewTracingModelInference wraps the client to record the span "model_inference" for every model call.
+func NewTracingModelInference(client ModelInference, tracer Tracer) ModelInference {
+	return tracingModelInference{client: client, tracer: tracer}
+}
+
+type tracingModelInference struct {
+	client ModelInference
+	tracer Tracer
+}
+
+func (c tracingModelInference) Do(ctx context.Context, userPrompt string, systemContent string, model string) (
+	string, []byte, uint16, uint16, error,
+) {
+	ctx, end := c.tracer.Start(ctx, "model_inference")
+	predictionRaw, prediction, usageTokensPrompt, usageTokensCompletions, err := c.client.Do(
+		ctx, userPrompt, systemContent, model,
+	)
+	end(err)
+	return predictionRaw, prediction, usageTokensPrompt, usageTokensCompletions, err
+}
+
+// DoWithTemperature calls the wrapped client with the temperature, see ModelInferenceWithTemperature.
+// The temperature is ignored if the wrapped client does not support it.
+func (c tracingModelInference) DoWithTemperature(
+	ctx context.Context, userPrompt string, systemContent string, model string, temperature float32,
+) (string, []byte, uint16, uint16, error) {
+	v, ok := c.client.(ModelInferenceWithTemperature)
+	if !ok {
+		return c.Do(ctx, userPrompt, systemContent, model)
+	}
+
+	ctx, end := c.tracer.Start(ctx, "model_inference")
+	predictionRaw, prediction, usageTokensPrompt, usageTokensCompletions, err := v.DoWithTemperature(
+		ctx, userPrompt, systemContent, model, temperature,
+	)
+	end(err)
+	return predictionRaw, prediction, usageTokensPrompt, usageTokensCompletions, err
+}
+
+// ModelName reports the name of the wrapped client's model, see ModelNamer.
+func (c tracingModelInference) ModelName(model string) string {
+	if v, ok := c.client.(ModelNamer); ok {
+		return v.ModelName(model)
+	}
+	return model
+}
+
+// NewTracingRepositoryPrediction wraps the repository to record the span for every write,
+// e.g. "repository.write_input_prompt".
+func NewTracingRepositoryPrediction(repository RepositoryPrediction, tracer Tracer) RepositoryPrediction {
+	return tracingRepositoryPrediction{repository: repository, tracer: tracer}
+}
+
+type tracingRepositoryPrediction struct {
+	repository RepositoryPrediction
+	tracer     Tracer
+}
+
+func (r tracingRepositoryPrediction) WriteInputPrompt(ctx context.Context, requestID, userID, prompt string) error {
+	ctx, end := r.tracer.Start(ctx, "repository.write_input_prompt")
+	err := r.repository.WriteInputPrompt(ctx, requestID, userID, prompt)
+	end(err)
+	return err
+}
+
+// WriteInputPromptWithClient calls the wrapped repository with the client's metadata,
+// see RepositoryPredictionWithClient. The metadata is ignored if the wrapped repository does not support it.
+func (r tracingRepositoryPrediction) WriteInputPromptWithClient(
+	ctx context.Context, requestID, userID, prompt, userAgent, clientVersion string,
+) error {
+	v, ok := r.repository.(RepositoryPredictionWithClient)
+	if !ok {
+		return r.WriteInputPrompt(ctx, requestID, userID, prompt)
+	}
+
+	ctx, end := r.tracer.Start(ctx, "repository.write_input_prompt")
+	err := v.WriteInputPromptWithClient(ctx, requestID, userID, prompt, userAgent, clientVersion)
+	end(err)
+	return err
+}
+
+func (r tracingRepositoryPrediction) WriteModelResult(
+	ctx context.Context, requestID, userID, predictionRaw, prediction, model string,
+	usageTokensPrompt, usageTokensCompletions uint16,
+) error {
+	ctx, end := r.tracer.Start(ctx, "repository.write_model_result")
+	err := r.repository.WriteModelResult(
+		ctx, requestID, userID, predictionRaw, prediction, model, usageTokensPrompt, usageTokensCompletions,
+	)
+	end(err)
+	return err
+}
+
+// WriteModelResultWithVariant calls the wrapped repository with the experiment's variant,
+// see RepositoryPredictionWithVariant. The variant is ignored if the wrapped repository does not support it.
+func (r tracingRepositoryPrediction) WriteModelResultWithVariant(
+	ctx context.Context, requestID, userID, predictionRaw, prediction, model string,
+	usageTokensPrompt, usageTokensCompletions uint16, variant string,
+) error {
+	v, ok := r.repository.(RepositoryPredictionWithVariant)
+	if !ok {
+		return r.WriteModelResult(
+			ctx, requestID, userID, predictionRaw, prediction, model, usageTokensPrompt, usageTokensCompletions,
+		)
+	}
+
+	ctx, end := r.tracer.Start(ctx, "repository.write_model_result")
+	err := v.WriteModelResultWithVariant(
+		ctx, requestID, userID, predictionRaw, prediction, model, usageTokensPrompt, usageTokensCompletions, variant,
+	)
+	end(err)
+	return err
+}
+
+func (r tracingRepositoryPrediction) WriteSuccessFlag(ctx context.Context, requestID, userID, token string) error {
+	ctx, end := r.tracer.Start(ctx, "repository.write_success_flag")
+	err := r.repository.WriteSuccessFlag(ctx, requestID, userID, token)
+	end(err)
+	return err
+}
+
+func (r tracingRepositoryPrediction) Close(ctx context.Context) error {
+	return r.repository.Close(ctx)
+}
+
+// MockTracer records the spans in memory.
+type MockTracer struct {
+	mu    sync.Mutex
+	Spans []MockSpan
+}
+
+// MockSpan defines the span recorded by MockTracer.
+type MockSpan struct {
+	Name string
+	// Parent the name of the parent span, or the remote span's header value.
+	Parent string
+	Err    error
+	Ended  bool
+}
+
+type mockTracerSpanKey struct{}
+
+func (m *MockTracer) Start(ctx context.Context, name string) (context.Context, func(err error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parent, _ := ctx.Value(mockTracerSpanKey{}).(string)
+	m.Spans = append(m.Spans, MockSpan{Name: name, Parent: parent})
+	idx := len(m.Spans) - 1
+
+	return context.WithValue(ctx, mockTracerSpanKey{}, name), func(err error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.Spans[idx].Err = err
+		m.Spans[idx].Ended = true
+	}
+}
+
+func (m *MockTracer) Extract(ctx context.Context, header http.Header) context.Context {
+	if v := header.Get("traceparent"); v != "" {
+		return context.WithValue(ctx, mockTracerSpanKey{}, v)
+	}
+	return ctx
+}
+
+func (m *MockTracer) Inject(ctx context.Context, header http.Header) {
+	if v, ok := ctx.Value(mockTracerSpanKey{}).(string); ok {
+		header.Set("traceparent", v)
+	}
+}
@@ -0,0 +1,136 @@
+package diagram
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type mockHTTPClientFn func(req *http.Request) (*http.Response, error)
+
+func (m mockHTTPClientFn) Do(req *http.Request) (*http.Response, error) {
+	return m(req)
+}
+
+func TestNewTracingHTTPClient(t *testing.T) {
+	// GIVEN
+	tracer := &MockTracer{}
+	ctx, end := tracer.Start(context.TODO(), "request")
+
+	var gotHeader string
+	c := NewTracingHTTPClient(
+		mockHTTPClientFn(
+			func(req *http.Request) (*http.Response, error) {
+				gotHeader = req.Header.Get("traceparent")
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			},
+		),
+		tracer, "plantuml",
+	)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost", nil)
+
+	// WHEN
+	_, err := c.Do(req)
+	end(err)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MockSpan{
+		{Name: "request", Ended: true},
+		{Name: "plantuml", Parent: "request", Ended: true},
+	}
+	if !reflect.DeepEqual(tracer.Spans, want) {
+		t.Errorf("unexpected spans: got = %+v, want = %+v", tracer.Spans, want)
+	}
+	if gotHeader != "plantuml" {
+		t.Errorf("span context shall be propagated to the server, got: %s", gotHeader)
+	}
+	if req.Header.Get("traceparent") != "" {
+		t.Error("the original request shall not be mutated")
+	}
+}
+
+func TestNewTracingModelInference(t *testing.T) {
+	// GIVEN
+	errModel := errors.New("foo")
+	tracer := &MockTracer{}
+	c := NewTracingModelInference(MockModelInference{Err: errModel, Model: "bar"}, tracer)
+
+	// WHEN
+	_, _, _, _, err := c.Do(context.TODO(), "foo", "bar", "qux")
+
+	// THEN
+	if !errors.Is(err, errModel) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	want := []MockSpan{{Name: "model_inference", Err: errModel, Ended: true}}
+	if !reflect.DeepEqual(tracer.Spans, want) {
+		t.Errorf("unexpected spans: got = %+v, want = %+v", tracer.Spans, want)
+	}
+	if got := c.(ModelNamer).ModelName("qux"); got != "bar" {
+		t.Errorf("the wrapped client's model name expected, got: %s", got)
+	}
+}
+
+func TestNewTracingRepositoryPrediction(t *testing.T) {
+	// GIVEN
+	tracer := &MockTracer{}
+	r := NewTracingRepositoryPrediction(MockRepositoryPrediction{}, tracer)
+
+	// WHEN
+	_ = r.WriteInputPrompt(context.TODO(), "foo", "bar", "qux")
+	_ = r.WriteModelResult(context.TODO(), "foo", "bar", "qux", "qux", "quux", 1, 1)
+	_ = r.WriteSuccessFlag(context.TODO(), "foo", "bar", "qux")
+
+	// THEN
+	want := []MockSpan{
+		{Name: "repository.write_input_prompt", Ended: true},
+		{Name: "repository.write_model_result", Ended: true},
+		{Name: "repository.write_success_flag", Ended: true},
+	}
+	if !reflect.DeepEqual(tracer.Spans, want) {
+		t.Errorf("unexpected spans: got = %+v, want = %+v", tracer.Spans, want)
+	}
+}
+
+func TestMockTracer_Extract(t *testing.T) {
+	// GIVEN
+	tracer := &MockTracer{}
+	header := http.Header{}
+	header.Set("traceparent", "remote")
+
+	// WHEN
+	ctx := tracer.Extract(context.TODO(), header)
+	_, end := tracer.Start(ctx, "foo")
+	end(nil)
+
+	// THEN
+	if want := []MockSpan{{Name: "foo", Parent: "remote", Ended: true}}; !reflect.DeepEqual(tracer.Spans, want) {
+		t.Errorf("unexpected spans: got = %+v, want = %+v", tracer.Spans, want)
+	}
+}
+
+func TestTracingModelInference_DoWithTemperature(t *testing.T) {
+	// GIVEN
+	tracer := &MockTracer{}
+	var temperatures []float32
+	c := NewTracingModelInference(MockModelInference{Temperatures: &temperatures}, tracer)
+
+	// WHEN
+	_, _, _, _, err := c.(ModelInferenceWithTemperature).DoWithTemperature(context.TODO(), "foo", "bar", "qux", 0.5)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(temperatures, []float32{0.5}) {
+		t.Errorf("the temperature shall be passed to the wrapped client, got: %v", temperatures)
+	}
+	if want := []MockSpan{{Name: "model_inference", Ended: true}}; !reflect.DeepEqual(tracer.Spans, want) {
+		t.Errorf("unexpected spans: got = %+v, want = %+v", tracer.Spans, want)
+	}
+}
@@ -0,0 +1,88 @@
+package diagram
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// watermarkMargin defines the watermark's distance to the diagram's corner.
+const watermarkMargin = 5
+
+// AddWatermark adds the unobtrusive watermark text to the bottom right corner of the SVG diagram.
+func AddWatermark(svg []byte, text string) ([]byte, error) {
+	minX, minY, width, height, err := readViewBox(svg)
+	if err != nil {
+		return nil, err
+	}
+
+	closingTagPos := bytes.LastIndex(svg, []byte("</svg>"))
+	if closingTagPos < 0 {
+		return nil, errors.New("svg closing tag not found")
+	}
+
+	var watermark bytes.Buffer
+	watermark.WriteString(`<text class="watermark" fill="#888888" fill-opacity="0.5" font-family="sans-serif"`)
+	watermark.WriteString(` font-size="10" text-anchor="end" x="`)
+	watermark.WriteString(strconv.FormatFloat(minX+width-watermarkMargin, 'f', -1, 64))
+	watermark.WriteString(`" y="`)
+	watermark.WriteString(strconv.FormatFloat(minY+height-watermarkMargin, 'f', -1, 64))
+	watermark.WriteString(`">`)
+	if err := xml.EscapeText(&watermark, []byte(text)); err != nil {
+		return nil, err
+	}
+	watermark.WriteString("</text>")
+
+	o := make([]byte, 0, len(svg)+watermark.Len())
+	o = append(o, svg[:closingTagPos]...)
+	o = append(o, watermark.Bytes()...)
+	return append(o, svg[closingTagPos:]...), nil
+}
+
+// readViewBox reads the root svg element's viewBox attribute.
+func readViewBox(svg []byte) (minX, minY, width, height float64, err error) {
+	decoder := xml.NewDecoder(bytes.NewReader(svg))
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return 0, 0, 0, 0, errors.New("svg root element not found: " + err.Error())
+		}
+
+		el, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if el.Name.Local != "svg" {
+			return 0, 0, 0, 0, errors.New("svg root element not found")
+		}
+
+		for _, attr := range el.Attr {
+			if attr.Name.Local == "viewBox" {
+				return parseViewBox(attr.Value)
+			}
+		}
+		return 0, 0, 0, 0, errors.New("svg 'viewBox' attr is missing")
+	}
+}
+
+func parseViewBox(s string) (minX, minY, width, height float64, err error) {
+	fields := strings.Fields(strings.ReplaceAll(s, ",", " "))
+	if len(fields) != 4 {
+		return 0, 0, 0, 0, errors.New("svg 'viewBox' attr is malformed")
+	}
+
+	var v [4]float64
+	for i, f := range fields {
+		if v[i], err = strconv.ParseFloat(f, 64); err != nil {
+			return 0, 0, 0, 0, errors.New("svg 'viewBox' attr is malformed")
+		}
+	}
+	return v[0], v[1], v[2], v[3], nil
+}
@@ -0,0 +1,59 @@
+package diagram
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/internal/utils"
+)
+
+const svgWatermarkFixture = `<?xml version="1.0" encoding="us-ascii" standalone="no"?>
+<svg xmlns="http://www.w3.org/2000/svg" height="179px" version="1.1" viewBox="0 0 375 179" width="375px">
+<defs></defs>
+<g>
+	<g id="elem_n0">
+		<rect fill="#438DD5" height="52.5938" rx="2.5" ry="2.5" width="125" x="7" y="11.8301"></rect>
+	</g>
+</g>
+</svg>`
+
+func TestAddWatermark(t *testing.T) {
+	t.Run(
+		"shall add the watermark to the bottom right corner", func(t *testing.T) {
+			// WHEN
+			got, err := AddWatermark([]byte(svgWatermarkFixture), "diagramastext.dev <free>")
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			const want = `<text class="watermark" fill="#888888" fill-opacity="0.5" font-family="sans-serif" ` +
+				`font-size="10" text-anchor="end" x="370" y="174">diagramastext.dev &lt;free&gt;</text></svg>`
+			if !strings.HasSuffix(string(got), want) {
+				t.Errorf("unexpected watermark: %s", got)
+			}
+			if err := utils.ValidateSVG(got); err != nil {
+				t.Errorf("watermarked svg shall be valid: %v", err)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail", func(t *testing.T) {
+			for name, svg := range map[string]string{
+				"not svg":           `<html></html>`,
+				"no viewBox":        `<svg width="1" height="1"></svg>`,
+				"malformed viewBox": `<svg viewBox="0 0 foo 1"></svg>`,
+				"not xml":           `foo`,
+			} {
+				t.Run(
+					name, func(t *testing.T) {
+						if _, err := AddWatermark([]byte(svg), "foo"); err == nil {
+							t.Error("error expected")
+						}
+					},
+				)
+			}
+		},
+	)
+}
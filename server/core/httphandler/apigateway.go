@@ -0,0 +1,177 @@
+package httphandler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// APIGatewayProxyRequest defines the event of the AWS API Gateway's REST API proxy integration.
+// See: https://docs.aws.amazon.com/apigateway/latest/developerguide/set-up-lambda-proxy-integrations.html
+type APIGatewayProxyRequest struct {
+	HTTPMethod                      string                        `json:"httpMethod"`
+	Path                            string                        `json:"path"`
+	Headers                         map[string]string             `json:"headers"`
+	MultiValueHeaders               map[string][]string           `json:"multiValueHeaders"`
+	QueryStringParameters           map[string]string             `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string           `json:"multiValueQueryStringParameters"`
+	RequestContext                  APIGatewayProxyRequestContext `json:"requestContext"`
+	Body                            string                        `json:"body"`
+	IsBase64Encoded                 bool                          `json:"isBase64Encoded"`
+}
+
+// APIGatewayProxyRequestContext defines the context of the API Gateway's request.
+type APIGatewayProxyRequestContext struct {
+	RequestID string `json:"requestId"`
+	Identity  struct {
+		SourceIP string `json:"sourceIp"`
+	} `json:"identity"`
+}
+
+// APIGatewayProxyResponse defines the response of the AWS Lambda to the API Gateway's REST API proxy integration.
+// The binary body is base64-encoded, and flagged with IsBase64Encoded for the API Gateway to decode it.
+// Note that the API Gateway only decodes the media types listed in the REST API's binary media types.
+type APIGatewayProxyResponse struct {
+	StatusCode        int                 `json:"statusCode"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+// APIGatewayProxyHandler handles the API Gateway's proxy events, e.g. to start the AWS Lambda.
+type APIGatewayProxyHandler func(ctx context.Context, req APIGatewayProxyRequest) (APIGatewayProxyResponse, error)
+
+// NewAPIGatewayProxyHandler adapts the http handler, e.g. Handler, to serve the API Gateway's proxy events.
+// The event is mapped to the http request, and the handler's response is mapped to the event's response.
+// The request ID of the API Gateway is propagated in the header X-Request-ID unless the request defines it.
+func NewAPIGatewayProxyHandler(handler http.Handler) APIGatewayProxyHandler {
+	return func(ctx context.Context, event APIGatewayProxyRequest) (APIGatewayProxyResponse, error) {
+		r, err := newRequestFromAPIGateway(ctx, event)
+		if err != nil {
+			return APIGatewayProxyResponse{}, err
+		}
+
+		w := &apiGatewayResponseWriter{header: http.Header{}}
+		handler.ServeHTTP(w, r)
+		return w.response(), nil
+	}
+}
+
+func newRequestFromAPIGateway(ctx context.Context, event APIGatewayProxyRequest) (*http.Request, error) {
+	body := []byte(event.Body)
+	if event.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(event.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	query := url.Values{}
+	for k, v := range event.QueryStringParameters {
+		query.Set(k, v)
+	}
+	for k, v := range event.MultiValueQueryStringParameters {
+		query[k] = v
+	}
+
+	u := url.URL{Path: event.Path, RawQuery: query.Encode()}
+	r, err := http.NewRequestWithContext(ctx, event.HTTPMethod, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range event.Headers {
+		r.Header.Set(k, v)
+	}
+	for k, v := range event.MultiValueHeaders {
+		r.Header.Del(k)
+		for _, el := range v {
+			r.Header.Add(k, el)
+		}
+	}
+	if r.Header.Get(headerRequestID) == "" && event.RequestContext.RequestID != "" {
+		r.Header.Set(headerRequestID, event.RequestContext.RequestID)
+	}
+	r.RemoteAddr = event.RequestContext.Identity.SourceIP
+	r.Host = r.Header.Get("Host")
+
+	return r, nil
+}
+
+// apiGatewayResponseWriter buffers the response to map it to the API Gateway's proxy response.
+type apiGatewayResponseWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (w *apiGatewayResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *apiGatewayResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.body.Write(b)
+}
+
+func (w *apiGatewayResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *apiGatewayResponseWriter) response() APIGatewayProxyResponse {
+	o := APIGatewayProxyResponse{
+		StatusCode:        w.statusCode,
+		MultiValueHeaders: map[string][]string(w.header),
+	}
+	if o.StatusCode == 0 {
+		o.StatusCode = http.StatusOK
+	}
+
+	body := w.body.Bytes()
+	// the content type is detected like the net/http server does it
+	if w.header.Get("Content-Type") == "" && len(body) > 0 {
+		w.header.Set("Content-Type", http.DetectContentType(body))
+	}
+	if isBinaryResponse(w.header, body) {
+		o.Body = base64.StdEncoding.EncodeToString(body)
+		o.IsBase64Encoded = true
+		return o
+	}
+	o.Body = string(body)
+	return o
+}
+
+// isBinaryResponse checks if the response's body shall be base64-encoded, i.e. it is either compressed,
+// or its content type is not textual, e.g. image/png.
+func isBinaryResponse(header http.Header, body []byte) bool {
+	if v := header.Get("Content-Encoding"); v != "" && !strings.EqualFold(v, "identity") {
+		return true
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return !utf8.Valid(body)
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == mimeTypeJSON, strings.HasSuffix(mediaType, "+json"),
+		mediaType == "application/xml", strings.HasSuffix(mediaType, "+xml"),
+		mediaType == "application/javascript":
+		if charset := params["charset"]; charset != "" && !strings.EqualFold(charset, "utf-8") {
+			return true
+		}
+		return false
+	default:
+		return true
+	}
+}
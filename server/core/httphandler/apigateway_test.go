@@ -0,0 +1,166 @@
+package httphandler
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestNewAPIGatewayProxyHandler(t *testing.T) {
+	t.Run(
+		"shall map the JSON response as text", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(mockCIAMHandler, nil, nil)
+			if err := handler.RegisterHandler("/c4", mockDiagramHandler(`{"svg":"foo"}`)); err != nil {
+				t.Fatal(err)
+			}
+			proxyHandler := NewAPIGatewayProxyHandler(handler)
+
+			// WHEN
+			got, err := proxyHandler(
+				context.TODO(), APIGatewayProxyRequest{
+					HTTPMethod: http.MethodPost,
+					Path:       "/generate/c4",
+					Headers:    map[string]string{"Content-Type": "application/json"},
+					Body:       base64.StdEncoding.EncodeToString([]byte(`{"prompt":"foo bar qux"}`)),
+					RequestContext: APIGatewayProxyRequestContext{
+						RequestID: "c0d6e7e3-1a5b-4b8a-a0a6-0a8f6e0f9c2b",
+					},
+					IsBase64Encoded: true,
+				},
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status code: %d", got.StatusCode)
+			}
+			if got.IsBase64Encoded || got.Body != `{"svg":"foo"}` {
+				t.Errorf("unexpected body: %s, base64: %v", got.Body, got.IsBase64Encoded)
+			}
+			const wantRequestID = "c0d6e7e3-1a5b-4b8a-a0a6-0a8f6e0f9c2b"
+			if v := http.Header(got.MultiValueHeaders).Get(headerRequestID); v != wantRequestID {
+				t.Errorf("the API Gateway's request ID shall be propagated, got: %s", v)
+			}
+		},
+	)
+
+	t.Run(
+		"shall map the PNG response as base64-encoded binary", func(t *testing.T) {
+			// GIVEN
+			png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+			var gotRequest *http.Request
+			proxyHandler := NewAPIGatewayProxyHandler(
+				http.HandlerFunc(
+					func(w http.ResponseWriter, r *http.Request) {
+						gotRequest = r
+						w.Header().Set("Content-Type", "image/png")
+						_, _ = w.Write(png)
+					},
+				),
+			)
+
+			// WHEN
+			got, err := proxyHandler(
+				context.TODO(), APIGatewayProxyRequest{
+					HTTPMethod:            http.MethodGet,
+					Path:                  "/generate/c4",
+					QueryStringParameters: map[string]string{"format": "png"},
+					MultiValueHeaders:     map[string][]string{"Accept": {"image/png", "image/*"}},
+				},
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status code: %d", got.StatusCode)
+			}
+			if !got.IsBase64Encoded {
+				t.Error("the binary body shall be base64-encoded")
+			}
+			if body, _ := base64.StdEncoding.DecodeString(got.Body); !reflect.DeepEqual(body, png) {
+				t.Errorf("unexpected body: %s", got.Body)
+			}
+			if v := got.MultiValueHeaders["Content-Type"]; !reflect.DeepEqual(v, []string{"image/png"}) {
+				t.Errorf("unexpected content type: %v", v)
+			}
+			if gotRequest.URL.Query().Get("format") != "png" ||
+				!reflect.DeepEqual(gotRequest.Header.Values("Accept"), []string{"image/png", "image/*"}) {
+				t.Errorf("unexpected request: %+v", gotRequest)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the body is not base64-encoded", func(t *testing.T) {
+			proxyHandler := NewAPIGatewayProxyHandler(http.NotFoundHandler())
+			if _, err := proxyHandler(
+				context.TODO(), APIGatewayProxyRequest{HTTPMethod: http.MethodPost, Body: "{", IsBase64Encoded: true},
+			); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
+
+func Test_isBinaryResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   bool
+	}{
+		{name: "json", header: http.Header{"Content-Type": {"application/json"}}},
+		{name: "svg", header: http.Header{"Content-Type": {"image/svg+xml"}}},
+		{name: "text", header: http.Header{"Content-Type": {"text/plain; charset=utf-8"}}},
+		{name: "png", header: http.Header{"Content-Type": {"image/png"}}, want: true},
+		{name: "pdf", header: http.Header{"Content-Type": {"application/pdf"}}, want: true},
+		{
+			name:   "text in non-utf8 charset",
+			header: http.Header{"Content-Type": {"text/plain; charset=utf-16"}},
+			want:   true,
+		},
+		{
+			name:   "compressed json",
+			header: http.Header{"Content-Type": {"application/json"}, "Content-Encoding": {"gzip"}},
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := isBinaryResponse(tt.header, []byte("foo")); got != tt.want {
+					t.Errorf("isBinaryResponse() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_apiGatewayResponseWriter(t *testing.T) {
+	t.Run(
+		"shall detect the content type given the handler did not set it", func(t *testing.T) {
+			// GIVEN
+			w := &apiGatewayResponseWriter{header: http.Header{}}
+
+			// WHEN
+			_, _ = io.WriteString(w, `{"error":"foo"}`)
+			w.WriteHeader(http.StatusNotFound)
+			got := w.response()
+
+			// THEN
+			if got.StatusCode != http.StatusOK {
+				t.Errorf("the status code shall not be overwritten, got: %d", got.StatusCode)
+			}
+			if got.IsBase64Encoded || got.MultiValueHeaders["Content-Type"][0] != "text/plain; charset=utf-8" {
+				t.Errorf("unexpected response: %+v", got)
+			}
+		},
+	)
+}
@@ -2,7 +2,11 @@ package httphandler
 
 import (
 	"net/http"
+	"net/url"
 	"testing"
+	"time"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
 )
 
 type MockWriter struct {
@@ -31,10 +35,9 @@ func Test_cordHandler_ServeHTTP(t *testing.T) {
 			w := &MockWriter{Headers: http.Header{}}
 
 			handlerCORS{
-				map[string]string{
+				headersMap: map[string]string{
 					"Access-Control-Allow-Origin": "",
 				},
-				nil,
 			}.ServeHTTP(w, &http.Request{})
 
 			if w.Header().Get("Access-Control-Allow-Origin") != "*" {
@@ -48,10 +51,9 @@ func Test_cordHandler_ServeHTTP(t *testing.T) {
 			w := &MockWriter{Headers: http.Header{}}
 
 			handlerCORS{
-				map[string]string{
+				headersMap: map[string]string{
 					"Access-Control-Allow-Origin": "'*'",
 				},
-				nil,
 			}.ServeHTTP(w, &http.Request{})
 
 			if w.Header().Get("Access-Control-Allow-Origin") != "*" {
@@ -68,7 +70,7 @@ func Test_cordHandler_ServeHTTP(t *testing.T) {
 				"bar": "quxx",
 			}
 
-			handlerCORS{m, nil}.ServeHTTP(w, &http.Request{})
+			handlerCORS{headersMap: m}.ServeHTTP(w, &http.Request{})
 
 			for k, want := range m {
 				got := w.Header().Get(k)
@@ -93,8 +95,8 @@ func Test_cordHandler_ServeHTTP(t *testing.T) {
 			const probeStatus = 201
 
 			handlerCORS{
-				m,
-				chainHandler{probeStatus},
+				headersMap: m,
+				next:       chainHandler{probeStatus},
 			}.ServeHTTP(w, &http.Request{Method: http.MethodOptions})
 
 			if w.StatusCode == probeStatus {
@@ -112,3 +114,170 @@ func (c chainHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(c.status)
 	return
 }
+
+func TestHandler_Preflight(t *testing.T) {
+	handler := NewHandler(
+		mockCIAMHandler, map[string]string{"Access-Control-Allow-Origin": "https://diagramastext.dev"},
+		map[string]diagram.HTTPHandler{"/c4": mockDiagramHandler(`{"svg":"foo"}`)},
+	)
+
+	tests := []struct {
+		name             string
+		path             string
+		wantAllowMethods string
+		wantAllowHeaders string
+	}{
+		{
+			name:             "c4 diagram",
+			path:             "/generate/c4",
+			wantAllowMethods: "POST,OPTIONS",
+			wantAllowHeaders: "Content-Type,Authorization,X-API-KEY,If-None-Match,X-Client-Version",
+		},
+		{
+			name:             "status",
+			path:             "/status",
+			wantAllowMethods: "GET,OPTIONS",
+			wantAllowHeaders: "Content-Type,Authorization,X-API-KEY,If-None-Match,X-Client-Version",
+		},
+		{
+			name: "unknown route",
+			path: "/foo",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				w := &MockWriter{Headers: http.Header{}}
+
+				// WHEN
+				handler.ServeHTTP(w, &http.Request{Method: http.MethodOptions, URL: &url.URL{Path: tt.path}})
+
+				// THEN
+				if w.StatusCode != http.StatusOK {
+					t.Errorf("unexpected status code: %d", w.StatusCode)
+				}
+				if got := w.Header().Get("Access-Control-Allow-Methods"); got != tt.wantAllowMethods {
+					t.Errorf("Access-Control-Allow-Methods want: %s, got: %s", tt.wantAllowMethods, got)
+				}
+				if got := w.Header().Get("Access-Control-Allow-Headers"); got != tt.wantAllowHeaders {
+					t.Errorf("Access-Control-Allow-Headers want: %s, got: %s", tt.wantAllowHeaders, got)
+				}
+				if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://diagramastext.dev" {
+					t.Errorf("Access-Control-Allow-Origin want: https://diagramastext.dev, got: %s", got)
+				}
+			},
+		)
+	}
+}
+
+func TestHandler_PreflightCORSConfig(t *testing.T) {
+	t.Run(
+		"shall emit the max age, and the credentials on the preflight response", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(
+				mockCIAMHandler, map[string]string{"Access-Control-Allow-Origin": "https://diagramastext.dev"},
+				map[string]diagram.HTTPHandler{"/c4": mockDiagramHandler(`{"svg":"foo"}`)},
+				WithCORS(CORSConfig{MaxAge: 2 * time.Hour, AllowCredentials: true}),
+			)
+			w := &MockWriter{Headers: http.Header{}}
+
+			// WHEN
+			handler.ServeHTTP(w, &http.Request{Method: http.MethodOptions, URL: &url.URL{Path: "/generate/c4"}})
+
+			// THEN
+			if got := w.Header().Get("Access-Control-Max-Age"); got != "7200" {
+				t.Errorf("Access-Control-Max-Age want: 7200, got: %s", got)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+				t.Errorf("Access-Control-Allow-Credentials want: true, got: %s", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall omit the max age, and the credentials by default", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(
+				mockCIAMHandler, map[string]string{"Access-Control-Allow-Origin": "https://diagramastext.dev"},
+				map[string]diagram.HTTPHandler{"/c4": mockDiagramHandler(`{"svg":"foo"}`)},
+			)
+			w := &MockWriter{Headers: http.Header{}}
+
+			// WHEN
+			handler.ServeHTTP(w, &http.Request{Method: http.MethodOptions, URL: &url.URL{Path: "/generate/c4"}})
+
+			// THEN
+			for _, k := range []string{"Access-Control-Max-Age", "Access-Control-Allow-Credentials"} {
+				if got := w.Header().Get(k); got != "" {
+					t.Errorf("%s shall not be set, got: %s", k, got)
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"shall not allow the credentials for the wildcard origin", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(
+				mockCIAMHandler, map[string]string{"Access-Control-Allow-Origin": "'*'"}, nil,
+				WithCORS(CORSConfig{AllowCredentials: true}),
+			)
+			w := &MockWriter{Headers: http.Header{}}
+
+			// WHEN
+			handler.ServeHTTP(w, &http.Request{Method: http.MethodOptions, URL: &url.URL{Path: "/status"}})
+
+			// THEN
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+				t.Errorf("Access-Control-Allow-Credentials shall not be set, got: %s", got)
+			}
+		},
+	)
+}
+
+func TestValidateCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		corsHeaders map[string]string
+		cfg         CORSConfig
+		wantErr     bool
+	}{
+		{
+			name:        "credentials for the origin",
+			corsHeaders: map[string]string{"Access-Control-Allow-Origin": "https://diagramastext.dev"},
+			cfg:         CORSConfig{MaxAge: time.Hour, AllowCredentials: true},
+		},
+		{
+			name:        "wildcard origin without credentials",
+			corsHeaders: map[string]string{"Access-Control-Allow-Origin": "*"},
+			cfg:         CORSConfig{MaxAge: time.Hour},
+		},
+		{
+			name:        "credentials for the wildcard origin",
+			corsHeaders: map[string]string{"Access-Control-Allow-Origin": "*"},
+			cfg:         CORSConfig{AllowCredentials: true},
+			wantErr:     true,
+		},
+		{
+			name:        "credentials for the empty origin",
+			corsHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+			cfg:         CORSConfig{AllowCredentials: true},
+			wantErr:     true,
+		},
+		{
+			name:    "negative max age",
+			cfg:     CORSConfig{MaxAge: -time.Second},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if err := ValidateCORS(tt.corsHeaders, tt.cfg); (err != nil) != tt.wantErr {
+					t.Errorf("ValidateCORS() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,95 @@
+package httphandler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/kislerdm/diagramastext/server/core/ciam"
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	coreErrors "github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// pathEstimate the suffix of the path to estimate the diagram generation, e.g. /generate/c4/estimate.
+const pathEstimate = "/estimate"
+
+// RegisterEstimateHandler registers the handler to estimate the size and cost of the diagram generation
+// at the path "/generate{path}/estimate". The model is not called, hence the estimate is served
+// in the maintenance mode too. It is safe for concurrent use while the handler serves requests.
+func (h *Handler) RegisterEstimateHandler(path string, handler diagram.EstimateHandler) error {
+	if !strings.HasPrefix(path, "/") {
+		return errors.New("path must start with /")
+	}
+	if handler == nil {
+		return errors.New("handler must be set")
+	}
+
+	h.diagrams.handle(
+		http.MethodPost, prefixDiagrams+path+pathEstimate,
+		handlerEstimate{handler: handler, reporter: h.reporter, limits: h.limits},
+	)
+	return nil
+}
+
+// handlerEstimate serves the requests to estimate the diagram generation.
+type handlerEstimate struct {
+	handler  diagram.EstimateHandler
+	reporter ErrorReporter
+	limits   map[ciam.Role]diagram.ComplexityLimits
+}
+
+func (h handlerEstimate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var requestContract diagramRequest
+
+	defer func() { _ = r.Body.Close() }()
+	if err := json.NewDecoder(r.Body).Decode(&requestContract); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"wrong request format"}`))
+		h.report(r, ErrorTypeBadRequest, err)
+		return
+	}
+
+	user, ok := ciam.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":"user was not extracted from authorisation token"}`))
+		return
+	}
+
+	input, err := newDiagramInput(user, ciam.TenantFromContext(r.Context()), requestContract, h.limits)
+	if err != nil {
+		writeInputError(w, err)
+		h.report(r, ErrorTypeBadRequest, err)
+		return
+	}
+
+	estimate, err := h.handler(r.Context(), input)
+	var errHandler coreErrors.HTTPHandlerError
+	if errors.As(err, &errHandler) && errHandler.HTTPCode >= 400 && errHandler.HTTPCode < 500 {
+		writeError(w, errHandler.HTTPCode, errHandler.Msg)
+		h.report(r, ErrorTypeBadRequest, err)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":"internal error"}`))
+		h.report(r, ErrorTypeInternal, err)
+		return
+	}
+
+	o, err := json.Marshal(estimate)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":"internal error"}`))
+		h.report(r, ErrorTypeInternal, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(o)
+}
+
+func (h handlerEstimate) report(r *http.Request, errType ErrorType, err error) {
+	handlerDiagram{reporter: h.reporter}.report(r, errType, err)
+}
@@ -0,0 +1,103 @@
+package httphandler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	coreErrors "github.com/kislerdm/diagramastext/server/core/errors"
+	"github.com/kislerdm/diagramastext/server/core/logger"
+)
+
+func mockEstimateHandler(err error) diagram.EstimateHandler {
+	return func(_ context.Context, input diagram.Input) (diagram.Estimate, error) {
+		if err != nil {
+			return diagram.Estimate{}, err
+		}
+		return diagram.NewEstimate("foo", len(input.GetPrompt()), 1, diagram.Price{Prompt: 1, Completion: 2}), nil
+	}
+}
+
+func TestHandler_RegisterEstimateHandler(t *testing.T) {
+	t.Run(
+		"shall serve the estimate", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(mockCIAMHandler, nil, nil, WithLogger(logger.NewNoopLogger()), WithMaintenance())
+
+			// WHEN
+			if err := handler.RegisterEstimateHandler("/c4", mockEstimateHandler(nil)); err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			// the estimate is served in the maintenance mode because the model is not called
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newGenerateRequest("/c4/estimate"))
+			if w.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+			want := `{"model":"foo","prompt_tokens":11,"completion_tokens":1,"total_tokens":12,"cost":0.013}`
+			if string(w.V) != want {
+				t.Errorf("unexpected response: got = %s, want = %s", w.V, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the handler's error", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(mockCIAMHandler, nil, nil, WithErrorReporter(&mockErrorReporter{}))
+			if err := handler.RegisterEstimateHandler("/c4", mockEstimateHandler(errors.New("foo"))); err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newGenerateRequest("/c4/estimate"))
+
+			// THEN
+			if w.StatusCode != http.StatusInternalServerError {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+		},
+	)
+
+	t.Run(
+		"shall forward the handler's client error escaped", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(mockCIAMHandler, nil, nil, WithErrorReporter(&mockErrorReporter{}))
+			errHandler := coreErrors.HTTPHandlerError{
+				Msg: `model "foo" is not supported`, Type: "estimate", HTTPCode: http.StatusUnprocessableEntity,
+			}
+			if err := handler.RegisterEstimateHandler("/c4", mockEstimateHandler(errHandler)); err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newGenerateRequest("/c4/estimate"))
+
+			// THEN
+			if w.StatusCode != http.StatusUnprocessableEntity {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+			if want := `{"error":"model \"foo\" is not supported"}`; string(w.V) != want {
+				t.Errorf("unexpected response: got = %s, want = %s", w.V, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail on invalid input", func(t *testing.T) {
+			handler := NewHandler(mockCIAMHandler, nil, nil)
+			if err := handler.RegisterEstimateHandler("c4", mockEstimateHandler(nil)); err == nil {
+				t.Error("error expected for path without the leading slash")
+			}
+			if err := handler.RegisterEstimateHandler("/c4", nil); err == nil {
+				t.Error("error expected for nil handler")
+			}
+		},
+	)
+}
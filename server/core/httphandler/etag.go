@@ -0,0 +1,52 @@
+package httphandler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+)
+
+// setETag sets the ETag header given the hash of the response's body, and reports if the client's cached diagram
+// matches it according to the If-None-Match header, i.e. the response shall be 304 Not Modified.
+// The header is not set given no hash.
+func setETag(w http.ResponseWriter, r *http.Request, hash string) (notModified bool) {
+	if hash == "" {
+		return false
+	}
+
+	etag := `"` + hash + `"`
+	w.Header().Set("ETag", etag)
+	return matchETag(r.Header.Get("If-None-Match"), etag)
+}
+
+// outputETag returns the hash of the serialized diagram's Output, see diagram.OutputETag,
+// or no hash if the Output does not define it.
+func outputETag(o diagram.Output) string {
+	if oETag, ok := o.(diagram.OutputETag); ok {
+		return oETag.GetETag()
+	}
+	return ""
+}
+
+// svgETag returns the hex-encoded SHA-256 hash of the SVG diagram served as image/svg+xml.
+func svgETag(svg []byte) string {
+	h := sha256.Sum256(svg)
+	return hex.EncodeToString(h[:])
+}
+
+// matchETag checks if the If-None-Match header's value lists the entity tag using the weak comparison,
+// see https://www.rfc-editor.org/rfc/rfc9110#section-13.1.2.
+func matchETag(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(v), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package httphandler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+)
+
+func TestHandler_ETag(t *testing.T) {
+	handler := NewHandler(
+		mockCIAMHandler, nil, map[string]diagram.HTTPHandler{
+			"/c4": func(_ context.Context, _ diagram.Input) (diagram.Output, error) {
+				return diagram.NewResultSVG([]byte(mockDiagram))
+			},
+		},
+	)
+
+	// GIVEN
+	w := &mockWriter{Headers: http.Header{}}
+
+	// WHEN
+	handler.ServeHTTP(w, newGenerateRequest("/c4"))
+
+	// THEN
+	if w.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", w.StatusCode)
+	}
+	etag := w.Headers.Get("ETag")
+	var o struct {
+		ETag string `json:"etag"`
+	}
+	if err := json.Unmarshal(w.V, &o); err != nil {
+		t.Fatal(err)
+	}
+	if o.ETag == "" || etag != `"`+o.ETag+`"` {
+		t.Fatalf("unexpected etag. header: %s, body: %s", etag, o.ETag)
+	}
+
+	// GIVEN
+	r := newGenerateRequest("/c4")
+	r.Header.Set("Accept", mimeTypeSVG)
+	w = &mockWriter{Headers: http.Header{}}
+
+	// WHEN
+	handler.ServeHTTP(w, r)
+
+	// THEN
+	etagSVG := w.Headers.Get("ETag")
+	if etagSVG != `"`+svgETag([]byte(mockDiagram))+`"` {
+		t.Fatalf("the etag of the svg representation shall be the svg's hash, got: %s", etagSVG)
+	}
+
+	tests := []struct {
+		name        string
+		accept      string
+		ifNoneMatch string
+		wantETag    string
+		wantStatus  int
+	}{
+		{
+			name:        "shall respond with 304 given the matching etag",
+			ifNoneMatch: etag,
+			wantETag:    etag,
+			wantStatus:  http.StatusNotModified,
+		},
+		{
+			name:        "shall respond with 304 given the matching weak etag in the list",
+			ifNoneMatch: `"foo", W/` + etag,
+			wantETag:    etag,
+			wantStatus:  http.StatusNotModified,
+		},
+		{
+			name:        "shall respond with the diagram given the changed etag",
+			ifNoneMatch: `"foo"`,
+			wantETag:    etag,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "shall respond with the diagram given the etag of the svg representation",
+			ifNoneMatch: etagSVG,
+			wantETag:    etag,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "shall respond with 304 given the matching etag of the svg representation",
+			accept:      mimeTypeSVG,
+			ifNoneMatch: etagSVG,
+			wantETag:    etagSVG,
+			wantStatus:  http.StatusNotModified,
+		},
+		{
+			name:        "shall respond with the svg diagram given the etag of the json representation",
+			accept:      mimeTypeSVG,
+			ifNoneMatch: etag,
+			wantETag:    etagSVG,
+			wantStatus:  http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				r := newGenerateRequest("/c4")
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+				if tt.accept != "" {
+					r.Header.Set("Accept", tt.accept)
+				}
+				w := &mockWriter{Headers: http.Header{}}
+
+				// WHEN
+				handler.ServeHTTP(w, r)
+
+				// THEN
+				if w.StatusCode != tt.wantStatus {
+					t.Errorf("unexpected status code. want: %d, got: %d", tt.wantStatus, w.StatusCode)
+				}
+				if got := w.Headers.Get("ETag"); got != tt.wantETag {
+					t.Errorf("unexpected etag. want: %s, got: %s", tt.wantETag, got)
+				}
+				if tt.wantStatus == http.StatusNotModified && len(w.V) > 0 {
+					t.Errorf("unexpected body: %s", w.V)
+				}
+			},
+		)
+	}
+}
+
+func Test_matchETag(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{
+			name:        "matching",
+			ifNoneMatch: `"foo"`,
+			want:        true,
+		},
+		{
+			name:        "any",
+			ifNoneMatch: "*",
+			want:        true,
+		},
+		{
+			name:        "not matching",
+			ifNoneMatch: `"bar", W/"baz"`,
+			want:        false,
+		},
+		{
+			name:        "missing header",
+			ifNoneMatch: "",
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := matchETag(tt.ifNoneMatch, `"foo"`); got != tt.want {
+					t.Errorf("matchETag() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,81 @@
+package httphandler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/kislerdm/diagramastext/server/core/ciam"
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	coreErrors "github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// pathFeedback the suffix of the path to rate the generated diagram, e.g. /generate/c4/feedback.
+const pathFeedback = "/feedback"
+
+// RegisterFeedbackHandler registers the handler to record the user's feedback on the generated diagram
+// at the path "/generate{path}/feedback". The model is not called, hence the feedback is recorded
+// in the maintenance mode too. It is safe for concurrent use while the handler serves requests.
+func (h *Handler) RegisterFeedbackHandler(path string, handler diagram.FeedbackHandler) error {
+	if !strings.HasPrefix(path, "/") {
+		return errors.New("path must start with /")
+	}
+	if handler == nil {
+		return errors.New("handler must be set")
+	}
+
+	h.diagrams.handle(
+		http.MethodPost, prefixDiagrams+path+pathFeedback, handlerFeedback{handler: handler, reporter: h.reporter},
+	)
+	return nil
+}
+
+// handlerFeedback serves the requests to record the feedback.
+type handlerFeedback struct {
+	handler  diagram.FeedbackHandler
+	reporter ErrorReporter
+}
+
+func (h handlerFeedback) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var input diagram.InputFeedback
+
+	defer func() { _ = r.Body.Close() }()
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"wrong request format"}`))
+		h.report(r, ErrorTypeBadRequest, err)
+		return
+	}
+
+	user, ok := ciam.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":"user was not extracted from authorisation token"}`))
+		return
+	}
+	input.UserID = user.ID
+
+	err := h.handler(r.Context(), input)
+	var errHandler coreErrors.HTTPHandlerError
+	if errors.As(err, &errHandler) && errHandler.HTTPCode >= 400 && errHandler.HTTPCode < 500 {
+		// the message may quote the request ID, hence it is escaped
+		msg, _ := json.Marshal(errHandler.Msg)
+		w.WriteHeader(errHandler.HTTPCode)
+		_, _ = w.Write([]byte(`{"error":` + string(msg) + `}`))
+		h.report(r, ErrorTypeBadRequest, err)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":"internal error"}`))
+		h.report(r, ErrorTypeInternal, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h handlerFeedback) report(r *http.Request, errType ErrorType, err error) {
+	handlerDiagram{reporter: h.reporter}.report(r, errType, err)
+}
@@ -0,0 +1,133 @@
+package httphandler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/logger"
+)
+
+func TestHandler_RegisterFeedbackHandler(t *testing.T) {
+	const requestID = "693a35ba-e42c-4168-8afc-5a7c359d1d05"
+
+	newRequest := func(body string) *http.Request {
+		r := newGenerateRequest("/c4/feedback")
+		r.Body = io.NopCloser(strings.NewReader(body))
+		return r
+	}
+
+	t.Run(
+		"shall record the feedback", func(t *testing.T) {
+			// GIVEN
+			repository := &diagram.MockRepositoryFeedback{RequestIDs: []string{requestID}}
+			feedbackHandler, _ := diagram.NewFeedbackHandler(repository)
+			handler := NewHandler(mockCIAMHandler, nil, nil, WithLogger(logger.NewNoopLogger()))
+			if err := handler.RegisterFeedbackHandler("/c4", feedbackHandler); err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newRequest(`{"request_id":"`+requestID+`","rating":1,"comment":"qux"}`))
+
+			// THEN
+			if w.StatusCode != http.StatusNoContent {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+			want := []diagram.InputFeedback{
+				{RequestID: requestID, Rating: diagram.RatingUp, Comment: "qux", UserID: "foo"},
+			}
+			if !reflect.DeepEqual(repository.Feedback, want) {
+				t.Errorf("unexpected feedback: got = %+v, want = %+v", repository.Feedback, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall reject the feedback on the unknown request", func(t *testing.T) {
+			// GIVEN
+			feedbackHandler, _ := diagram.NewFeedbackHandler(&diagram.MockRepositoryFeedback{})
+			handler := NewHandler(mockCIAMHandler, nil, nil, WithErrorReporter(&mockErrorReporter{}))
+			if err := handler.RegisterFeedbackHandler("/c4", feedbackHandler); err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newRequest(`{"request_id":"`+requestID+`","rating":1}`))
+
+			// THEN
+			if w.StatusCode != http.StatusNotFound {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+			if want := `{"error":"request ` + requestID + ` not found"}`; string(w.V) != want {
+				t.Errorf("unexpected response: got = %s, want = %s", w.V, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall reject the request ID which is not UUID", func(t *testing.T) {
+			// GIVEN
+			repository := &diagram.MockRepositoryFeedback{RequestIDs: []string{`"bar`}}
+			feedbackHandler, _ := diagram.NewFeedbackHandler(repository)
+			handler := NewHandler(mockCIAMHandler, nil, nil, WithErrorReporter(&mockErrorReporter{}))
+			if err := handler.RegisterFeedbackHandler("/c4", feedbackHandler); err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newRequest(`{"request_id":"\"bar","rating":1}`))
+
+			// THEN
+			if w.StatusCode != http.StatusUnprocessableEntity {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+			if want := `{"error":"request_id must be UUID"}`; string(w.V) != want {
+				t.Errorf("unexpected response: got = %s, want = %s", w.V, want)
+			}
+			if len(repository.Feedback) > 0 {
+				t.Error("the feedback shall not be written")
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the repository's error", func(t *testing.T) {
+			// GIVEN
+			feedbackHandler, _ := diagram.NewFeedbackHandler(&diagram.MockRepositoryFeedback{Err: errors.New("foo")})
+			handler := NewHandler(mockCIAMHandler, nil, nil, WithErrorReporter(&mockErrorReporter{}))
+			if err := handler.RegisterFeedbackHandler("/c4", feedbackHandler); err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newRequest(`{"request_id":"`+requestID+`","rating":-1}`))
+
+			// THEN
+			if w.StatusCode != http.StatusInternalServerError {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail on invalid input", func(t *testing.T) {
+			handler := NewHandler(mockCIAMHandler, nil, nil)
+			feedbackHandler, _ := diagram.NewFeedbackHandler(&diagram.MockRepositoryFeedback{})
+			if err := handler.RegisterFeedbackHandler("c4", feedbackHandler); err == nil {
+				t.Error("error expected for path without the leading slash")
+			}
+			if err := handler.RegisterFeedbackHandler("/c4", nil); err == nil {
+				t.Error("error expected for nil handler")
+			}
+		},
+	)
+}
@@ -2,68 +2,410 @@ package httphandler
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/kislerdm/diagramastext/server/core/ciam"
 	"github.com/kislerdm/diagramastext/server/core/diagram"
+	coreErrors "github.com/kislerdm/diagramastext/server/core/errors"
+	"github.com/kislerdm/diagramastext/server/core/internal/memstore"
+	"github.com/kislerdm/diagramastext/server/core/logger"
 )
 
+const (
+	prefixDiagrams = "/generate"
+	prefixSchemas  = "/schema"
+)
+
+// Handler defines the server's http handler.
+type Handler struct {
+	http.Handler
+	routes    *router
+	diagrams  *router
+	reporter  ErrorReporter
+	watermark watermark
+	limits    map[ciam.Role]diagram.ComplexityLimits
+	// maintenance rejects the diagram rendering requests when set, the other routes are served.
+	maintenance *atomic.Bool
+	tracer      diagram.Tracer
+	logger      logger.Logger
+	// regenerations counts the regenerations of the diagrams served at the paths "/generate{path}/regenerate".
+	regenerations *regenerations
+	cors          CORSConfig
+	// ready is set upon the completion of the startup, see Handler.SetReady.
+	ready           *atomic.Bool
+	readinessChecks []readinessCheck
+}
+
+// HandlerOps defines the Handler's options.
+type HandlerOps func(h *Handler)
+
+// WithErrorReporter sets the sink to report errors to.
+func WithErrorReporter(reporter ErrorReporter) HandlerOps {
+	return func(h *Handler) {
+		if reporter != nil {
+			h.reporter = reporter
+		}
+	}
+}
+
+// WithWatermark sets the text to watermark the SVG diagrams generated for the users with the given roles,
+// e.g. for the users of the free tier.
+func WithWatermark(text string, roles ...ciam.Role) HandlerOps {
+	return func(h *Handler) {
+		h.watermark = watermark{text: text, roles: roles}
+	}
+}
+
+// WithComplexityLimits sets the maximum number of the diagram's nodes and links, and the maximum number of diagrams
+// generated for the prompt for the users with the given roles.
+// The diagrams exceeding the limits are rejected with the status code 422.
+func WithComplexityLimits(limits diagram.ComplexityLimits, roles ...ciam.Role) HandlerOps {
+	return func(h *Handler) {
+		if h.limits == nil {
+			h.limits = map[ciam.Role]diagram.ComplexityLimits{}
+		}
+		for _, role := range roles {
+			h.limits[role] = limits
+		}
+	}
+}
+
+// WithTracer sets the tracer to record the span of every request. The span context propagated
+// in the request headers, e.g. traceparent, is used as the parent. No spans are recorded by default.
+func WithTracer(tracer diagram.Tracer) HandlerOps {
+	return func(h *Handler) {
+		if tracer != nil {
+			h.tracer = tracer
+		}
+	}
+}
+
+// WithLogger sets the logger, the records of the level info and above are written to stderr by default.
+func WithLogger(l logger.Logger) HandlerOps {
+	return func(h *Handler) {
+		if l != nil {
+			h.logger = l
+		}
+	}
+}
+
+// WithRegenerationsLimit sets the maximum number of the requests, and their size in bytes to count the regenerations,
+// the counts of the least recently regenerated requests are evicted above the limits. Zero value keeps the default:
+// 100000 requests without the size limit. The evictions are published as the expvar "memstore.regenerations".
+func WithRegenerationsLimit(maxEntries, maxBytes int) HandlerOps {
+	return func(h *Handler) {
+		h.regenerations = newRegenerations(
+			regenerationsWindow, memstore.WithMaxEntries(maxEntries), memstore.WithMaxBytes(maxBytes),
+		)
+	}
+}
+
+// WithCORS sets the CORS headers of the preflight requests' caching, and of the credentialed requests,
+// see CORSConfig. The configuration shall be validated using ValidateCORS.
+func WithCORS(cfg CORSConfig) HandlerOps {
+	return func(h *Handler) {
+		h.cors = cfg
+	}
+}
+
+// WithMaintenance starts the Handler in the maintenance mode, see Handler.SetMaintenance.
+func WithMaintenance() HandlerOps {
+	return func(h *Handler) {
+		h.maintenance.Store(true)
+	}
+}
+
+// SetMaintenance toggles the maintenance mode. The diagram rendering requests are rejected with the status code 503
+// in the maintenance mode, while the other routes, e.g. /status, are served.
+// It is safe for concurrent use while the handler serves requests.
+func (h *Handler) SetMaintenance(enabled bool) {
+	h.maintenance.Store(enabled)
+}
+
+// IsMaintenance returns true if the maintenance mode is enabled.
+func (h *Handler) IsMaintenance() bool {
+	return h.maintenance.Load()
+}
+
+// watermark defines the text added to the SVG diagrams generated for the users with the given roles.
+type watermark struct {
+	text  string
+	roles []ciam.Role
+}
+
+func (w watermark) appliesTo(role ciam.Role) bool {
+	if w.text == "" {
+		return false
+	}
+	for _, r := range w.roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterHandler registers the diagram rendering handler to serve requests to the path "/generate{path}",
+// and to regenerate the diagram at the path "/generate{path}/regenerate", see diagram.InputRegeneration.
+// It is safe for concurrent use while the handler serves requests.
+func (h *Handler) RegisterHandler(path string, handler diagram.HTTPHandler) error {
+	if !strings.HasPrefix(path, "/") {
+		return errors.New("path must start with /")
+	}
+	if handler == nil {
+		return errors.New("handler must be set")
+	}
+
+	h.registerHandler(path, handler)
+	return nil
+}
+
+func (h *Handler) registerHandler(path string, handler diagram.HTTPHandler) {
+	h.diagrams.handle(http.MethodPost, prefixDiagrams+path, h.newHandlerDiagram(handler))
+
+	handlerRegeneration := h.newHandlerDiagram(handler)
+	handlerRegeneration.regenerations = h.regenerations
+	h.diagrams.handle(http.MethodPost, prefixDiagrams+path+pathRegeneration, handlerRegeneration)
+}
+
+// RegisterSchema registers the JSON schema to be served publicly at the path "/schema{path}".
+func (h *Handler) RegisterSchema(path string, schema []byte) error {
+	if !strings.HasPrefix(path, "/") {
+		return errors.New("path must start with /")
+	}
+	if !json.Valid(schema) {
+		return errors.New("schema must be valid JSON")
+	}
+
+	h.routes.handle(
+		http.MethodGet, prefixSchemas+path, http.HandlerFunc(
+			func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(schema)
+			},
+		),
+	)
+	return nil
+}
+
+func (h *Handler) newHandlerDiagram(handler diagram.HTTPHandler) handlerDiagram {
+	return handlerDiagram{
+		handler: handler, reporter: h.reporter, watermark: h.watermark, limits: h.limits, maintenance: h.maintenance,
+		logger: h.logger,
+	}
+}
+
 func NewHandler(
 	ciamHandler ciam.HTTPHandlerFn, corsHeaders map[string]string, diagramHandlers map[string]diagram.HTTPHandler,
-) http.Handler {
-	return handlerCORS{
+	fnOps ...HandlerOps,
+) *Handler {
+	diagrams := newRouter(nil)
+
+	routes := newRouter(ciamHandler(diagrams))
+	routes.handle(http.MethodGet, "/status", http.HandlerFunc(handlerStatus))
+	routes.handle(http.MethodGet, pathLiveness, http.HandlerFunc(handlerLiveness))
+	routes.handle(http.MethodGet, pathOpenAPI, http.HandlerFunc(handlerOpenAPI))
+
+	h := &Handler{
+		routes:        routes,
+		diagrams:      diagrams,
+		reporter:      NewStderrErrorReporter(),
+		maintenance:   &atomic.Bool{},
+		tracer:        diagram.NewNoopTracer(),
+		logger:        logger.NewJSONLogger(os.Stderr, logger.LevelInfo),
+		regenerations: newRegenerations(regenerationsWindow),
+		ready:         &atomic.Bool{},
+	}
+	for _, fn := range fnOps {
+		fn(h)
+	}
+	routes.handle(
+		http.MethodGet, pathReadiness,
+		handlerReadiness{ready: h.ready, checks: h.readinessChecks, logger: h.logger},
+	)
+
+	h.Handler = handlerCORS{
 		headersMap: corsHeaders,
-		next: handlerResponseType{
-			mimeType: "application/json",
-			next: handlerStatus{
-				next: ciamHandler(
-					handlerDiagrams{
-						diagramHandlers: diagramHandlers,
-						log: log.New(
-							os.Stderr, "diagram-generator", log.Lmicroseconds|log.LUTC|log.Lshortfile,
-						),
+		cfg:        h.cors,
+		allowedMethods: func(path string) []string {
+			return append(routes.methods(path), diagrams.methods(path)...)
+		},
+		next: handlerTracing{
+			tracer: h.tracer,
+			next: handlerRequestID{
+				next: handlerResponseType{
+					mimeType: mimeTypeJSON,
+					next: handlerRecovery{
+						reporter: h.reporter,
+						next:     routes,
 					},
-				),
+				},
 			},
 		},
 	}
+
+	for path, handler := range diagramHandlers {
+		h.registerHandler(path, handler)
+	}
+
+	return h
 }
 
-type handlerDiagrams struct {
-	diagramHandlers map[string]diagram.HTTPHandler
-	log             *log.Logger
+// handlerDiagram serves the diagram rendering requests.
+type handlerDiagram struct {
+	handler     diagram.HTTPHandler
+	reporter    ErrorReporter
+	watermark   watermark
+	limits      map[ciam.Role]diagram.ComplexityLimits
+	maintenance *atomic.Bool
+	logger      logger.Logger
+	// regenerations is set to serve the requests to regenerate the diagram.
+	regenerations *regenerations
 }
 
-func (h handlerDiagrams) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		_, _ = w.Write([]byte(`{"error":"` + r.Method + ` is not allowed"}`))
-		return
+// diagramRequest defines the request to generate the diagram.
+type diagramRequest struct {
+	// Prompt the user's prompt, nil defines the request without the prompt, see errPromptMissing.
+	Prompt *string `json:"prompt"`
+	// IncludeGraph requests the diagram's graph in the response, see diagram.InputGraph.
+	IncludeGraph bool `json:"include_graph,omitempty"`
+}
+
+// errPromptMissing the error of the request without the prompt field, it is distinguished from the empty prompt,
+// see diagram.ErrPromptEmpty, to let the UI guide the user.
+var errPromptMissing = errors.New("prompt field is missing")
+
+// newDiagramInput validates the request and defines the diagram's input for the user of the tenant.
+func newDiagramInput(
+	user *ciam.User, tenant ciam.Tenant, req diagramRequest, limits map[ciam.Role]diagram.ComplexityLimits,
+) (diagram.Input, error) {
+	if req.Prompt == nil {
+		return nil, errPromptMissing
 	}
+	input, err := diagram.NewInput(
+		*req.Prompt, user.ID, user.APIToken, tenant.RoleQuotas(user.Role).PromptLengthMax, limits[user.Role],
+	)
+	if err != nil {
+		return nil, err
+	}
+	return diagram.WithBranding(input, tenantBranding(tenant)), nil
+}
 
-	const prefix = "/generate"
+// tenantBranding defines the diagram's branding of the tenant.
+func tenantBranding(tenant ciam.Tenant) diagram.Branding {
+	return diagram.Branding{DefaultFooter: tenant.DefaultFooter, Theme: tenant.Theme}
+}
 
-	t := strings.TrimPrefix(r.URL.Path, prefix)
+// writeInputError writes the error of the request's validation, the message is forwarded to guide the user.
+func writeInputError(w http.ResponseWriter, err error) {
+	writeError(w, http.StatusUnprocessableEntity, err.Error())
+}
 
-	handler, ok := h.diagramHandlers[t]
-	if !ok {
-		w.WriteHeader(http.StatusNotFound)
-		_, _ = w.Write([]byte(`{"error":"` + r.URL.Path + ` not found"}`))
+// writeError writes the error's message escaped, because it may quote the client's, or the model's input,
+// e.g. the graph's nodes IDs.
+func writeError(w http.ResponseWriter, statusCode int, errMsg string) {
+	msg, _ := json.Marshal(errMsg)
+	w.WriteHeader(statusCode)
+	_, _ = w.Write([]byte(`{"error":` + string(msg) + `}`))
+}
+
+// newInput defines the diagram's input, the regeneration is counted for the requests to regenerate the diagram,
+// and it is rejected with errRegenerationsQuotaExceeded above the quota of the user's role.
+func (h handlerDiagram) newInput(r *http.Request, user *ciam.User, req diagramRequest) (diagram.Input, error) {
+	tenant := ciam.TenantFromContext(r.Context())
+	input, err := newDiagramInput(user, tenant, req, h.limits)
+	if err != nil {
+		return nil, err
+	}
+	if req.IncludeGraph {
+		input = diagram.WithIncludeGraph(input)
+	}
+	input = diagram.WithClient(input, clientMetadata(r))
+	if h.regenerations != nil {
+		regeneration := h.regenerations.increment(regenerationKey(r.URL.Path, user.ID, *req.Prompt))
+		if limit := tenant.RoleQuotas(user.Role).RegenerationsPerPrompt; limit > 0 && regeneration > int(limit) {
+			return nil, errRegenerationsQuotaExceeded
+		}
+		input = diagram.WithRegeneration(input, regeneration)
+	}
+	return input, nil
+}
+
+// headerClientVersion the request header with the version of the client application.
+const headerClientVersion = "X-Client-Version"
+
+// clientMetadataLengthMax the maximum length of the client's metadata, the longer values are truncated.
+const clientMetadataLengthMax = 256
+
+// clientMetadata defines the client which requested the diagram given the request's headers.
+func clientMetadata(r *http.Request) diagram.ClientMetadata {
+	truncate := func(s string) string {
+		if len(s) > clientMetadataLengthMax {
+			return s[:clientMetadataLengthMax]
+		}
+		return s
+	}
+	return diagram.ClientMetadata{
+		UserAgent: truncate(r.UserAgent()),
+		Version:   truncate(r.Header.Get(headerClientVersion)),
+	}
+}
+
+func (h handlerDiagram) logDuration(r *http.Request, start time.Time) {
+	fields := logger.Fields{
+		"path":        r.URL.Path,
+		"request_id":  requestIDFromContext(r.Context()),
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+	if user, ok := ciam.FromContext(r.Context()); ok {
+		fields["user_id"] = user.ID
+	}
+	h.logger.Debug("diagram request", fields)
+}
+
+func (h handlerDiagram) report(r *http.Request, errType ErrorType, err error) {
+	report := ErrorReport{
+		Err:       err,
+		Type:      errType,
+		RequestID: requestIDFromContext(r.Context()),
+	}
+	if user, ok := ciam.FromContext(r.Context()); ok {
+		report.UserID = user.ID
+	}
+	h.reporter.Report(r.Context(), report)
+}
+
+func (h handlerDiagram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer h.logDuration(r, time.Now())
+
+	if h.maintenance.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"error":"temporarily unavailable"}`))
 		return
 	}
 
-	var requestContract struct {
-		Prompt string `json:"prompt"`
+	mimeType := negotiateDiagramMimeType(r.Header.Get("Accept"))
+	if mimeType == "" {
+		w.WriteHeader(http.StatusNotAcceptable)
+		_, _ = w.Write([]byte(`{"error":"` + mimeTypeJSON + ` or ` + mimeTypeSVG + ` must be accepted"}`))
+		return
 	}
 
+	var requestContract diagramRequest
+
 	defer func() { _ = r.Body.Close() }()
 	if err := json.NewDecoder(r.Body).Decode(&requestContract); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		_, _ = w.Write([]byte(`{"error":"wrong request format"}`))
-		h.log.Println(err)
+		h.report(r, ErrorTypeBadRequest, err)
 		return
 	}
 
@@ -74,19 +416,66 @@ func (h handlerDiagrams) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	input, err := diagram.NewInput(requestContract.Prompt, user.ID, user.APIToken, user.Role.Quotas().PromptLengthMax)
+	input, err := h.newInput(r, user, requestContract)
+	if errors.Is(err, errRegenerationsQuotaExceeded) {
+		writeError(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		_, _ = w.Write([]byte(`{"error":"wrong request format"}`))
-		h.log.Println(err)
+		writeInputError(w, err)
+		h.report(r, ErrorTypeBadRequest, err)
 		return
 	}
 
-	o, err := handler(r.Context(), input)
+	o, err := h.handler(r.Context(), input)
+	// the client errors, e.g. the diagram exceeding the complexity limits, are forwarded to the client
+	var errHandler coreErrors.HTTPHandlerError
+	if errors.As(err, &errHandler) && errHandler.HTTPCode >= 400 && errHandler.HTTPCode < 500 {
+		writeError(w, errHandler.HTTPCode, errHandler.Msg)
+		h.report(r, ErrorTypeBadRequest, err)
+		return
+	}
+	// the client disconnected, hence the generation was cancelled and nobody waits for the response
+	if err != nil && r.Context().Err() != nil {
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte(`{"error":"internal error"}`))
-		h.log.Println(err)
+		h.report(r, ErrorTypeInternal, err)
+		return
+	}
+
+	if h.watermark.appliesTo(user.Role) {
+		if o, err = addWatermark(o, h.watermark.text); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"error":"internal error"}`))
+			h.report(r, ErrorTypeInternal, err)
+			return
+		}
+	}
+
+	if mimeType == mimeTypeSVG {
+		oSVG, ok := o.(diagram.OutputSVG)
+		if !ok {
+			w.WriteHeader(http.StatusNotAcceptable)
+			_, _ = w.Write([]byte(`{"error":"diagram cannot be represented as ` + mimeTypeSVG + `"}`))
+			return
+		}
+		svg := oSVG.RawSVG()
+		if setETag(w, r, svgETag(svg)) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", mimeTypeSVG)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(svg)
+		return
+	}
+
+	if setETag(w, r, outputETag(o)) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
@@ -94,7 +483,7 @@ func (h handlerDiagrams) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte(`{"error":"internal error"}`))
-		h.log.Println(err)
+		h.report(r, ErrorTypeInternal, err)
 		return
 	}
 
@@ -103,20 +492,109 @@ func (h handlerDiagrams) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// statusClientClosedRequest the non-standard status code logged when the client closed the connection
+// before the response was sent.
+const statusClientClosedRequest = 499
+
+// addWatermark adds the watermark to the SVG diagrams, other outputs are returned unchanged.
+func addWatermark(o diagram.Output, text string) (diagram.Output, error) {
+	_, isMultiple := o.(diagram.OutputSVGs)
+
+	var svgs [][]byte
+	switch v := o.(type) {
+	case diagram.OutputSVGs:
+		svgs = v.RawSVGs()
+	case diagram.OutputSVG:
+		svgs = [][]byte{v.RawSVG()}
+	default:
+		return o, nil
+	}
+
+	for i, svg := range svgs {
+		var err error
+		if svgs[i], err = diagram.AddWatermark(svg, text); err != nil {
+			return nil, err
+		}
+	}
+
+	var warnings []string
+	if oWarnings, ok := o.(diagram.OutputWarnings); ok {
+		warnings = oWarnings.GetWarnings()
+	}
+
+	var oWatermark diagram.Output
+	var err error
+	if isMultiple {
+		oWatermark, err = diagram.NewResultSVGs(svgs, warnings...)
+	} else {
+		oWatermark, err = diagram.NewResultSVG(svgs[0], warnings...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if oModel, ok := o.(diagram.OutputModel); ok {
+		oWatermark = diagram.WithModel(oWatermark, oModel.GetModel(), oModel.GetVersion())
+	}
+	if oGraphs, ok := o.(diagram.OutputGraphs); ok {
+		oWatermark = diagram.WithGraphs(oWatermark, oGraphs.GetGraphs())
+	}
+	return oWatermark, nil
+}
+
+// corsAllowedHeaders defines the request headers expected by the server.
+const corsAllowedHeaders = "Content-Type,Authorization,X-API-KEY,If-None-Match,X-Client-Version"
+
+// CORSConfig defines the CORS headers set along with the headers passed to NewHandler.
+type CORSConfig struct {
+	// MaxAge the duration the browsers cache the preflight response for, i.e. Access-Control-Max-Age.
+	// Zero value omits the header, the browsers' default applies then, e.g. 5 seconds.
+	MaxAge time.Duration
+	// AllowCredentials allows the requests with the credentials, e.g. cookies,
+	// i.e. Access-Control-Allow-Credentials. It cannot be combined with the wildcard origin.
+	AllowCredentials bool
+}
+
+// ValidateCORS validates the CORS configuration given the CORS headers passed to NewHandler.
+// The credentials cannot be allowed for the wildcard origin, because the browsers reject such responses.
+func ValidateCORS(corsHeaders map[string]string, cfg CORSConfig) error {
+	if cfg.MaxAge < 0 {
+		return errors.New("CORS max age must not be negative")
+	}
+	if v, ok := corsHeaders["Access-Control-Allow-Origin"]; ok && cfg.AllowCredentials && isWildcardOrigin(v) {
+		return errors.New("CORS credentials cannot be allowed for the wildcard origin")
+	}
+	return nil
+}
+
+func isWildcardOrigin(v string) bool {
+	return v == "" || v == "*" || v == "'*'"
+}
+
 type handlerCORS struct {
 	headersMap map[string]string
-	next       http.Handler
+	cfg        CORSConfig
+	// allowedMethods returns the methods registered for the path.
+	allowedMethods func(path string) []string
+	next           http.Handler
 }
 
 func (c handlerCORS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wildcardOrigin := false
 	for k, v := range c.headersMap {
 		w.Header().Set(k, v)
-		if k == "Access-Control-Allow-Origin" && (v == "" || v == "'*'") {
+		if k == "Access-Control-Allow-Origin" && isWildcardOrigin(v) {
 			w.Header().Set(k, "*")
+			wildcardOrigin = true
 		}
 	}
+	// the credentialed requests are checked by the browsers on the preflight, and on the actual response
+	if c.cfg.AllowCredentials && !wildcardOrigin {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
 
 	if r.Method == http.MethodOptions {
+		c.setPreflightHeaders(w, r)
 		w.WriteHeader(http.StatusOK)
 		return
 	}
@@ -126,6 +604,24 @@ func (c handlerCORS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// setPreflightHeaders defines the CORS headers for the path's route, if the route is known.
+func (c handlerCORS) setPreflightHeaders(w http.ResponseWriter, r *http.Request) {
+	if c.allowedMethods == nil || r.URL == nil {
+		return
+	}
+
+	methods := c.allowedMethods(r.URL.Path)
+	if len(methods) == 0 {
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(append(methods, http.MethodOptions), ","))
+	w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+	if c.cfg.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.cfg.MaxAge.Seconds())))
+	}
+}
+
 type handlerResponseType struct {
 	mimeType string
 	next     http.Handler
@@ -138,15 +634,31 @@ func (h handlerResponseType) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-type handlerStatus struct {
-	next http.Handler
+func handlerStatus(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
 }
 
-func (h handlerStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet && r.URL.Path == "/status" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
+// handlerRecovery recovers from panics down the handlers chain and responds with the internal error.
+// The panic's stack trace is only sent to the error reporter.
+type handlerRecovery struct {
+	reporter ErrorReporter
+	next     http.Handler
+}
+
+func (h handlerRecovery) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"error":"internal error"}`))
+			h.reporter.Report(
+				r.Context(), ErrorReport{
+					Err:       fmt.Errorf("panic: %v\n%s", rec, debug.Stack()),
+					Type:      ErrorTypePanic,
+					RequestID: requestIDFromContext(r.Context()),
+				},
+			)
+		}
+	}()
 
 	if h.next != nil {
 		h.next.ServeHTTP(w, r)
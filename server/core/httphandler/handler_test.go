@@ -2,15 +2,23 @@ package httphandler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/kislerdm/diagramastext/server/core/ciam"
 	"github.com/kislerdm/diagramastext/server/core/diagram"
 	"github.com/kislerdm/diagramastext/server/core/diagram/c4container"
+	coreErrors "github.com/kislerdm/diagramastext/server/core/errors"
+	"github.com/kislerdm/diagramastext/server/core/logger"
 )
 
 type mockWriter struct {
@@ -185,3 +193,1011 @@ func TestE2e(t *testing.T) {
 		},
 	)
 }
+
+// mockCIAMHandler authenticates all requests as the anonym user.
+func mockCIAMHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			user := &ciam.User{ID: "foo", Role: ciam.RoleAnonymUser}
+			next.ServeHTTP(w, r.WithContext(ciam.NewContext(r.Context(), user)))
+		},
+	)
+}
+
+func mockDiagramHandler(v string) diagram.HTTPHandler {
+	return func(_ context.Context, _ diagram.Input) (diagram.Output, error) {
+		return diagram.MockOutput{V: []byte(v)}, nil
+	}
+}
+
+func newGenerateRequest(path string) *http.Request {
+	return &http.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{Path: "/generate" + path},
+		Header: http.Header{},
+		Body:   io.NopCloser(bytes.NewReader([]byte(`{"prompt":"foo bar qux"}`))),
+	}
+}
+
+func TestHandler_RegisterHandler(t *testing.T) {
+	t.Run(
+		"shall serve the registered handler", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(mockCIAMHandler, nil, nil)
+
+			// WHEN
+			if err := handler.RegisterHandler("/foo", mockDiagramHandler(`{"svg":"foo"}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newGenerateRequest("/foo"))
+			if w.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+			if string(w.V) != `{"svg":"foo"}` {
+				t.Errorf("unexpected response: %s", w.V)
+			}
+		},
+	)
+
+	t.Run(
+		"shall not be affected by the mutation of the map used to initialise the handler", func(t *testing.T) {
+			// GIVEN
+			handlers := map[string]diagram.HTTPHandler{"/foo": mockDiagramHandler(`{"svg":"foo"}`)}
+			handler := NewHandler(mockCIAMHandler, nil, handlers)
+
+			// WHEN
+			delete(handlers, "/foo")
+
+			// THEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newGenerateRequest("/foo"))
+			if w.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail on invalid input", func(t *testing.T) {
+			handler := NewHandler(mockCIAMHandler, nil, nil)
+			if err := handler.RegisterHandler("foo", mockDiagramHandler("")); err == nil {
+				t.Error("error expected for path without the leading slash")
+			}
+			if err := handler.RegisterHandler("/foo", nil); err == nil {
+				t.Error("error expected for nil handler")
+			}
+		},
+	)
+
+	t.Run(
+		"shall register handlers concurrently with serving requests", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(mockCIAMHandler, nil, nil)
+			const n = 10
+
+			// WHEN
+			var wg sync.WaitGroup
+			for i := 0; i < n; i++ {
+				wg.Add(2)
+				path := "/" + strconv.Itoa(i)
+				go func() {
+					defer wg.Done()
+					if err := handler.RegisterHandler(path, mockDiagramHandler(`{"svg":"foo"}`)); err != nil {
+						t.Error(err)
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					handler.ServeHTTP(&mockWriter{Headers: http.Header{}}, newGenerateRequest(path))
+				}()
+			}
+			wg.Wait()
+
+			// THEN
+			for i := 0; i < n; i++ {
+				w := &mockWriter{Headers: http.Header{}}
+				handler.ServeHTTP(w, newGenerateRequest("/"+strconv.Itoa(i)))
+				if w.StatusCode != http.StatusOK {
+					t.Errorf("handler %d is not registered", i)
+				}
+			}
+		},
+	)
+}
+
+func TestHandler_ClientDisconnected(t *testing.T) {
+	// GIVEN
+	ctx, cancel := context.WithCancel(context.TODO())
+
+	reporter := &mockErrorReporter{}
+	handler := NewHandler(
+		mockCIAMHandler, nil, map[string]diagram.HTTPHandler{
+			"/c4": func(ctx context.Context, _ diagram.Input) (diagram.Output, error) {
+				// the client disconnects while the diagram is being generated
+				cancel()
+				return nil, ctx.Err()
+			},
+		},
+		WithErrorReporter(reporter),
+	)
+	w := &mockWriter{Headers: http.Header{}}
+
+	// WHEN
+	handler.ServeHTTP(w, newGenerateRequest("/c4").WithContext(ctx))
+
+	// THEN
+	if w.StatusCode != statusClientClosedRequest {
+		t.Errorf("unexpected status code. want: %d, got: %d", statusClientClosedRequest, w.StatusCode)
+	}
+	if len(reporter.reports) != 0 {
+		t.Errorf("the cancelled request shall not be reported as error, got: %+v", reporter.reports)
+	}
+}
+
+func TestHandler_PanicRecovery(t *testing.T) {
+	// GIVEN
+	reporter := &mockErrorReporter{}
+	handler := NewHandler(
+		mockCIAMHandler, nil, map[string]diagram.HTTPHandler{
+			"/c4": func(_ context.Context, _ diagram.Input) (diagram.Output, error) {
+				panic("foo")
+			},
+		},
+		WithErrorReporter(reporter),
+	)
+	w := &mockWriter{Headers: http.Header{}}
+
+	// WHEN
+	handler.ServeHTTP(w, newGenerateRequest("/c4"))
+
+	// THEN
+	if w.StatusCode != http.StatusInternalServerError {
+		t.Errorf("unexpected status code. want: %d, got: %d", http.StatusInternalServerError, w.StatusCode)
+	}
+	if want := `{"error":"internal error"}`; string(w.V) != want {
+		t.Errorf("unexpected response. want: %s, got: %s", want, w.V)
+	}
+
+	if len(reporter.reports) != 1 {
+		t.Fatalf("one error report is expected, got: %d", len(reporter.reports))
+	}
+	got := reporter.reports[0]
+	if got.Type != ErrorTypePanic {
+		t.Errorf("unexpected error type. want: %s, got: %s", ErrorTypePanic, got.Type)
+	}
+	if got.RequestID == "" {
+		t.Error("request ID shall be reported")
+	}
+	if msg := got.Err.Error(); !strings.Contains(msg, "panic: foo") || !strings.Contains(msg, "goroutine") {
+		t.Errorf("panic value and stack trace shall be reported, got: %s", msg)
+	}
+}
+
+func TestHandler_ContentNegotiation(t *testing.T) {
+	handler := NewHandler(
+		mockCIAMHandler, nil, map[string]diagram.HTTPHandler{
+			"/c4": func(_ context.Context, _ diagram.Input) (diagram.Output, error) {
+				return diagram.NewResultSVG([]byte(mockDiagram))
+			},
+		},
+	)
+
+	tests := []struct {
+		name            string
+		accept          string
+		wantStatus      int
+		wantContentType string
+		wantBody        func(t *testing.T, v []byte)
+	}{
+		{
+			name:            "default",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantBody: func(t *testing.T, v []byte) {
+				var o struct {
+					SVG string `json:"svg"`
+				}
+				if err := json.Unmarshal(v, &o); err != nil {
+					t.Fatal(err)
+				}
+				if o.SVG != mockDiagram {
+					t.Error("unexpected SVG in the response")
+				}
+			},
+		},
+		{
+			name:            "json",
+			accept:          "application/json",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantBody: func(t *testing.T, v []byte) {
+				if !json.Valid(v) {
+					t.Error("JSON response expected")
+				}
+			},
+		},
+		{
+			name:            "svg",
+			accept:          "image/svg+xml",
+			wantStatus:      http.StatusOK,
+			wantContentType: "image/svg+xml",
+			wantBody: func(t *testing.T, v []byte) {
+				if string(v) != mockDiagram {
+					t.Error("raw SVG response expected")
+				}
+			},
+		},
+		{
+			name:            "unsupported",
+			accept:          "text/html",
+			wantStatus:      http.StatusNotAcceptable,
+			wantContentType: "application/json",
+			wantBody: func(t *testing.T, v []byte) {
+				if want := `{"error":"application/json or image/svg+xml must be accepted"}`; string(v) != want {
+					t.Errorf("unexpected response. want: %s, got: %s", want, v)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				r := newGenerateRequest("/c4")
+				r.Header.Set("Accept", tt.accept)
+				w := &mockWriter{Headers: http.Header{}}
+
+				// WHEN
+				handler.ServeHTTP(w, r)
+
+				// THEN
+				if w.StatusCode != tt.wantStatus {
+					t.Errorf("unexpected status code. want: %d, got: %d", tt.wantStatus, w.StatusCode)
+				}
+				if got := w.Headers.Get("Content-Type"); got != tt.wantContentType {
+					t.Errorf("unexpected content type. want: %s, got: %s", tt.wantContentType, got)
+				}
+				tt.wantBody(t, w.V)
+			},
+		)
+	}
+}
+
+// newCIAMHandler authenticates all requests as the user with the given role.
+func newCIAMHandler(role ciam.Role) ciam.HTTPHandlerFn {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				user := &ciam.User{ID: "foo", Role: role}
+				next.ServeHTTP(w, r.WithContext(ciam.NewContext(r.Context(), user)))
+			},
+		)
+	}
+}
+
+func TestHandler_Watermark(t *testing.T) {
+
+	diagramHandlers := map[string]diagram.HTTPHandler{
+		"/c4": func(_ context.Context, _ diagram.Input) (diagram.Output, error) {
+			return diagram.NewResultSVG([]byte(mockDiagram))
+		},
+	}
+
+	const watermarkText = "diagramastext.dev"
+
+	tests := []struct {
+		name          string
+		role          ciam.Role
+		wantWatermark bool
+	}{
+		{
+			name:          "watermarked role",
+			role:          ciam.RoleAnonymUser,
+			wantWatermark: true,
+		},
+		{
+			name:          "role without watermark",
+			role:          ciam.RoleRegisteredUser,
+			wantWatermark: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				handler := NewHandler(
+					newCIAMHandler(tt.role), nil, diagramHandlers,
+					WithWatermark(watermarkText, ciam.RoleAnonymUser),
+				)
+				r := newGenerateRequest("/c4")
+				r.Header.Set("Accept", mimeTypeSVG)
+				w := &mockWriter{Headers: http.Header{}}
+
+				// WHEN
+				handler.ServeHTTP(w, r)
+
+				// THEN
+				if w.StatusCode != http.StatusOK {
+					t.Fatalf("unexpected status code: %d", w.StatusCode)
+				}
+				gotWatermark := strings.Contains(string(w.V), `class="watermark"`) &&
+					strings.Contains(string(w.V), watermarkText)
+				if gotWatermark != tt.wantWatermark {
+					t.Errorf("unexpected watermark presence: got = %v, want = %v", gotWatermark, tt.wantWatermark)
+				}
+			},
+		)
+	}
+}
+
+func Test_addWatermarkMultipleDiagrams(t *testing.T) {
+	// GIVEN
+	o, err := diagram.NewResultSVGs([][]byte{[]byte(mockDiagram), []byte(mockDiagram)}, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o = diagram.WithModel(o, "gpt-mock", "v1.0.0")
+	graphs := []json.RawMessage{[]byte(`{"nodes":[{"id":"0"}]}`), []byte(`{"nodes":[{"id":"1"}]}`)}
+	o = diagram.WithGraphs(o, graphs)
+
+	// WHEN
+	got, err := addWatermark(o, "diagramastext.dev")
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	svgs := got.(diagram.OutputSVGs).RawSVGs()
+	if len(svgs) != 2 {
+		t.Fatalf("unexpected number of diagrams: %d", len(svgs))
+	}
+	for i, svg := range svgs {
+		if !strings.Contains(string(svg), `class="watermark"`) {
+			t.Errorf("diagram %d is not watermarked", i)
+		}
+	}
+	if warnings := got.(diagram.OutputWarnings).GetWarnings(); len(warnings) != 1 || warnings[0] != "foo" {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+	if oModel := got.(diagram.OutputModel); oModel.GetModel() != "gpt-mock" || oModel.GetVersion() != "v1.0.0" {
+		t.Errorf("unexpected model: %s, version: %s", oModel.GetModel(), oModel.GetVersion())
+	}
+	if oGraphs := got.(diagram.OutputGraphs); !reflect.DeepEqual(oGraphs.GetGraphs(), graphs) {
+		t.Errorf("unexpected graphs: %s", oGraphs.GetGraphs())
+	}
+}
+
+func TestHandler_IncludeGraph(t *testing.T) {
+	// GIVEN
+	var got []bool
+	handler := NewHandler(
+		mockCIAMHandler, nil, map[string]diagram.HTTPHandler{
+			"/c4": func(_ context.Context, input diagram.Input) (diagram.Output, error) {
+				got = append(got, input.(diagram.InputGraph).GetIncludeGraph())
+				return diagram.MockOutput{V: []byte(`{"svg":"foo"}`)}, nil
+			},
+		},
+		WithLogger(logger.NewNoopLogger()),
+	)
+
+	// WHEN
+	for _, body := range []string{`{"prompt":"foo bar qux"}`, `{"prompt":"foo bar qux","include_graph":true}`} {
+		r := newGenerateRequest("/c4")
+		r.Body = io.NopCloser(strings.NewReader(body))
+		handler.ServeHTTP(&mockWriter{Headers: http.Header{}}, r)
+	}
+
+	// THEN
+	if want := []bool{false, true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("the graph shall only be requested on demand, got: %v", got)
+	}
+}
+
+func TestHandler_ClientMetadata(t *testing.T) {
+	// GIVEN
+	var got []diagram.ClientMetadata
+	handler := NewHandler(
+		mockCIAMHandler, nil, map[string]diagram.HTTPHandler{
+			"/c4": func(_ context.Context, input diagram.Input) (diagram.Output, error) {
+				got = append(got, input.(diagram.InputClient).GetClient())
+				return diagram.MockOutput{V: []byte(`{"svg":"foo"}`)}, nil
+			},
+		},
+		WithLogger(logger.NewNoopLogger()),
+	)
+
+	// WHEN
+	r := newGenerateRequest("/c4")
+	handler.ServeHTTP(&mockWriter{Headers: http.Header{}}, r)
+
+	userAgent := "Mozilla/5.0 " + strings.Repeat("a", clientMetadataLengthMax)
+	r = newGenerateRequest("/c4")
+	r.Header.Set("User-Agent", userAgent)
+	r.Header.Set("X-Client-Version", "v1.0.0")
+	handler.ServeHTTP(&mockWriter{Headers: http.Header{}}, r)
+
+	// THEN
+	want := []diagram.ClientMetadata{
+		{},
+		{UserAgent: userAgent[:clientMetadataLengthMax], Version: "v1.0.0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected client's metadata: got = %+v, want = %+v", got, want)
+	}
+}
+
+func TestHandler_PromptValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantBody string
+	}{
+		{
+			name:     "missing prompt",
+			body:     `{"request_id":"foo"}`,
+			wantBody: `{"error":"prompt field is missing"}`,
+		},
+		{
+			name:     "null prompt",
+			body:     `{"prompt":null}`,
+			wantBody: `{"error":"prompt field is missing"}`,
+		},
+		{
+			name:     "empty prompt",
+			body:     `{"prompt":""}`,
+			wantBody: `{"error":"prompt must not be empty"}`,
+		},
+		{
+			name:     "whitespace-only prompt",
+			body:     `{"prompt":" \t\n "}`,
+			wantBody: `{"error":"prompt must not be empty"}`,
+		},
+		{
+			name:     "too short prompt",
+			body:     `{"prompt":"fo"}`,
+			wantBody: `{"error":"prompt length must be between 3 and 100 characters"}`,
+		},
+	}
+	for _, tt := range tests {
+		for _, path := range []string{"/c4", "/c4/estimate"} {
+			t.Run(
+				tt.name+" at "+path, func(t *testing.T) {
+					// GIVEN
+					handler := NewHandler(
+						newCIAMHandler(ciam.RoleAnonymUser), nil,
+						map[string]diagram.HTTPHandler{"/c4": mockDiagramHandler(`{"svg":"foo"}`)},
+						WithErrorReporter(&mockErrorReporter{}),
+					)
+					if err := handler.RegisterEstimateHandler("/c4", mockEstimateHandler(nil)); err != nil {
+						t.Fatal(err)
+					}
+					r := newGenerateRequest(path)
+					r.Body = io.NopCloser(strings.NewReader(tt.body))
+					w := &mockWriter{Headers: http.Header{}}
+
+					// WHEN
+					handler.ServeHTTP(w, r)
+
+					// THEN
+					if w.StatusCode != http.StatusUnprocessableEntity {
+						t.Errorf("unexpected status code: %d", w.StatusCode)
+					}
+					if string(w.V) != tt.wantBody {
+						t.Errorf("unexpected response: got = %s, want = %s", w.V, tt.wantBody)
+					}
+				},
+			)
+		}
+	}
+}
+
+func TestHandler_PaddedPrompt(t *testing.T) {
+	// GIVEN
+	var got string
+	handler := NewHandler(
+		mockCIAMHandler, nil, map[string]diagram.HTTPHandler{
+			"/c4": func(_ context.Context, input diagram.Input) (diagram.Output, error) {
+				got = input.GetPrompt()
+				return diagram.MockOutput{V: []byte(`{"svg":"foo"}`)}, nil
+			},
+		},
+	)
+	r := newGenerateRequest("/c4")
+	r.Body = io.NopCloser(strings.NewReader(`{"prompt":"  foo\n\n bar\tqux  "}`))
+	w := &mockWriter{Headers: http.Header{}}
+
+	// WHEN
+	handler.ServeHTTP(w, r)
+
+	// THEN
+	if w.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", w.StatusCode)
+	}
+	if got != "foo bar qux" {
+		t.Errorf("the trimmed prompt shall be passed to the handler, got: %q", got)
+	}
+}
+
+func TestHandler_Tenant(t *testing.T) {
+	tenants := map[string]ciam.Tenant{
+		"acme": {ID: "acme", DefaultFooter: "by acme", Theme: "cerulean"},
+		"qux": {
+			ID: "qux", DefaultFooter: "by qux",
+			Quotas: ciam.RoleQuotas{
+				ciam.RoleAnonymUser: {PromptLengthMax: 5, RequestsPerMinute: 1, RequestsPerDay: 1},
+			},
+		},
+	}
+	// the CIAM mock resolves the tenant from the header
+	ciamHandler := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				ctx := ciam.NewContext(r.Context(), &ciam.User{ID: "foo", Role: ciam.RoleAnonymUser})
+				next.ServeHTTP(w, r.WithContext(ciam.NewTenantContext(ctx, tenants[r.Header.Get(ciam.HeaderTenant)])))
+			},
+		)
+	}
+
+	var got diagram.Branding
+	handler := NewHandler(
+		ciamHandler, nil, map[string]diagram.HTTPHandler{
+			"/c4": func(_ context.Context, input diagram.Input) (diagram.Output, error) {
+				got = input.(diagram.InputBranding).GetBranding()
+				return diagram.MockOutput{V: []byte(`{"svg":"foo"}`)}, nil
+			},
+		},
+		WithErrorReporter(&mockErrorReporter{}),
+	)
+
+	for _, tt := range []struct {
+		tenant string
+		want   diagram.Branding
+	}{
+		{tenant: "", want: diagram.Branding{}},
+		{tenant: "acme", want: diagram.Branding{DefaultFooter: "by acme", Theme: "cerulean"}},
+		{tenant: "qux", want: diagram.Branding{DefaultFooter: "by qux"}},
+	} {
+		t.Run(
+			"shall pass the branding of the tenant "+tt.tenant, func(t *testing.T) {
+				// GIVEN
+				r := newGenerateRequest("/c4")
+				r.Header.Set(ciam.HeaderTenant, tt.tenant)
+				r.Body = io.NopCloser(strings.NewReader(`{"prompt":"foo"}`))
+
+				// WHEN
+				handler.ServeHTTP(&mockWriter{Headers: http.Header{}}, r)
+
+				// THEN
+				if got != tt.want {
+					t.Errorf("unexpected branding: got = %+v, want = %+v", got, tt.want)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"shall validate the prompt's length given the tenant's quotas", func(t *testing.T) {
+			// GIVEN
+			r := newGenerateRequest("/c4")
+			r.Header.Set(ciam.HeaderTenant, "qux")
+			w := &mockWriter{Headers: http.Header{}}
+
+			// WHEN
+			handler.ServeHTTP(w, r)
+
+			// THEN
+			const want = `{"error":"prompt length must be between 3 and 5 characters"}`
+			if w.StatusCode != http.StatusUnprocessableEntity || string(w.V) != want {
+				t.Errorf("unexpected response: %d %s", w.StatusCode, w.V)
+			}
+		},
+	)
+}
+
+func TestHandler_ComplexityLimits(t *testing.T) {
+	// the diagram with three nodes and two links
+	const graph = `{"nodes":[{"id":"0"},{"id":"1"},{"id":"2"}],"links":[{"from":"0","to":"1"},{"from":"1","to":"2"}]}`
+
+	opts := []HandlerOps{
+		WithComplexityLimits(diagram.ComplexityLimits{NodesMax: 3, LinksMax: 1}, ciam.RoleAnonymUser),
+		WithComplexityLimits(diagram.ComplexityLimits{NodesMax: 3, LinksMax: 2}, ciam.RoleRegisteredUser),
+	}
+
+	tests := []struct {
+		name       string
+		role       ciam.Role
+		opts       []HandlerOps
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "anonym user: nodes at the limit, links above the limit",
+			role:       ciam.RoleAnonymUser,
+			opts:       opts,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   `{"error":"diagram exceeds the limit of 1 links"}`,
+		},
+		{
+			name:       "registered user: nodes and links at the limit",
+			role:       ciam.RoleRegisteredUser,
+			opts:       opts,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "registered user: nodes above the limit",
+			role: ciam.RoleRegisteredUser,
+			opts: append(
+				opts, WithComplexityLimits(diagram.ComplexityLimits{NodesMax: 2}, ciam.RoleRegisteredUser),
+			),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   `{"error":"diagram exceeds the limit of 2 nodes"}`,
+		},
+		{
+			name:       "no limits",
+			role:       ciam.RoleAnonymUser,
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				c4Handler, err := c4container.NewC4ContainersHTTPHandler(
+					diagram.MockModelInference{V: []byte(graph)}, nil,
+					diagram.MockHTTPClient{
+						V: &http.Response{
+							StatusCode: http.StatusOK,
+							Body:       io.NopCloser(strings.NewReader(mockDiagram)),
+						},
+					},
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				handler := NewHandler(
+					newCIAMHandler(tt.role), nil, map[string]diagram.HTTPHandler{"/c4": c4Handler}, tt.opts...,
+				)
+				w := &mockWriter{Headers: http.Header{}}
+
+				// WHEN
+				handler.ServeHTTP(w, newGenerateRequest("/c4"))
+
+				// THEN
+				if w.StatusCode != tt.wantStatus {
+					t.Fatalf("unexpected status code: got = %d, want = %d", w.StatusCode, tt.wantStatus)
+				}
+				if tt.wantBody != "" && string(w.V) != tt.wantBody {
+					t.Errorf("unexpected response: got = %s, want = %s", w.V, tt.wantBody)
+				}
+			},
+		)
+	}
+}
+
+func TestHandler_ClientErrorEscaped(t *testing.T) {
+	// GIVEN
+	const wantMsg = `link from "a\\b" points to unknown node`
+	handler := NewHandler(
+		mockCIAMHandler, nil, map[string]diagram.HTTPHandler{
+			"/c4": func(_ context.Context, _ diagram.Input) (diagram.Output, error) {
+				return nil, coreErrors.HTTPHandlerError{
+					Msg: wantMsg, Type: "validation", HTTPCode: http.StatusUnprocessableEntity,
+				}
+			},
+		},
+	)
+	w := &mockWriter{Headers: http.Header{}}
+
+	// WHEN
+	handler.ServeHTTP(w, newGenerateRequest("/c4"))
+
+	// THEN
+	if w.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("unexpected status code: %d", w.StatusCode)
+	}
+	var got struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(w.V, &got); err != nil {
+		t.Fatalf("the response shall be valid JSON, got: %s", w.V)
+	}
+	if got.Error != wantMsg {
+		t.Errorf("unexpected error message: got = %s, want = %s", got.Error, wantMsg)
+	}
+}
+
+type mockModerator struct {
+	Flagged bool
+	Err     error
+}
+
+func (m mockModerator) IsFlagged(_ context.Context, _ string) (bool, error) {
+	return m.Flagged, m.Err
+}
+
+func TestHandler_Moderation(t *testing.T) {
+	tests := []struct {
+		name       string
+		moderator  mockModerator
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "allowed prompt",
+			moderator:  mockModerator{Flagged: false},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "flagged prompt",
+			moderator:  mockModerator{Flagged: true},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   `{"error":"prompt rejected"}`,
+		},
+		{
+			name:       "moderation failed",
+			moderator:  mockModerator{Err: errors.New("foo")},
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"error":"internal error"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				c4Handler, err := c4container.NewC4ContainersHTTPHandler(
+					diagram.MockModelInference{V: []byte(`{"nodes":[{"id":"0"}]}`)}, nil,
+					diagram.MockHTTPClient{
+						V: &http.Response{
+							StatusCode: http.StatusOK,
+							Body:       io.NopCloser(strings.NewReader(mockDiagram)),
+						},
+					},
+					c4container.WithModerator(tt.moderator),
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				handler := NewHandler(
+					newCIAMHandler(ciam.RoleAnonymUser), nil, map[string]diagram.HTTPHandler{"/c4": c4Handler},
+					WithErrorReporter(&mockErrorReporter{}),
+				)
+				w := &mockWriter{Headers: http.Header{}}
+
+				// WHEN
+				handler.ServeHTTP(w, newGenerateRequest("/c4"))
+
+				// THEN
+				if w.StatusCode != tt.wantStatus {
+					t.Fatalf("unexpected status code: got = %d, want = %d", w.StatusCode, tt.wantStatus)
+				}
+				if tt.wantBody != "" && string(w.V) != tt.wantBody {
+					t.Errorf("unexpected response: got = %s, want = %s", w.V, tt.wantBody)
+				}
+			},
+		)
+	}
+}
+
+func TestHandler_Maintenance(t *testing.T) {
+	newStatusRequest := func() *http.Request {
+		return &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/status"}, Header: http.Header{}}
+	}
+
+	t.Run(
+		"shall reject generation and serve status in the maintenance mode", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(
+				mockCIAMHandler, nil, map[string]diagram.HTTPHandler{"/c4": mockDiagramHandler(`{"svg":"foo"}`)},
+				WithMaintenance(),
+			)
+
+			// WHEN
+			wGenerate := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(wGenerate, newGenerateRequest("/c4"))
+			wStatus := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(wStatus, newStatusRequest())
+
+			// THEN
+			if !handler.IsMaintenance() {
+				t.Error("maintenance mode shall be enabled")
+			}
+			if wGenerate.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("unexpected status code: %d", wGenerate.StatusCode)
+			}
+			if want := `{"error":"temporarily unavailable"}`; string(wGenerate.V) != want {
+				t.Errorf("unexpected response: got = %s, want = %s", wGenerate.V, want)
+			}
+			if wStatus.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status code: %d", wStatus.StatusCode)
+			}
+		},
+	)
+
+	t.Run(
+		"shall toggle the maintenance mode at runtime", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(
+				mockCIAMHandler, nil, map[string]diagram.HTTPHandler{"/c4": mockDiagramHandler(`{"svg":"foo"}`)},
+			)
+
+			for _, tt := range []struct {
+				maintenance bool
+				wantStatus  int
+			}{
+				{maintenance: false, wantStatus: http.StatusOK},
+				{maintenance: true, wantStatus: http.StatusServiceUnavailable},
+				{maintenance: false, wantStatus: http.StatusOK},
+			} {
+				// WHEN
+				handler.SetMaintenance(tt.maintenance)
+				w := &mockWriter{Headers: http.Header{}}
+				handler.ServeHTTP(w, newGenerateRequest("/c4"))
+
+				// THEN
+				if w.StatusCode != tt.wantStatus {
+					t.Errorf(
+						"maintenance %v: unexpected status code: got = %d, want = %d",
+						tt.maintenance, w.StatusCode, tt.wantStatus,
+					)
+				}
+			}
+		},
+	)
+}
+
+func TestHandler_RegisterSchema(t *testing.T) {
+	// ciamRejectAll rejects all requests which pass through the authentication.
+	ciamRejectAll := func(_ http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+		)
+	}
+
+	t.Run(
+		"shall serve the C4 graph schema publicly", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(ciamRejectAll, nil, nil)
+			schema, err := c4container.GraphJSONSchema()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			if err := handler.RegisterSchema("/c4", schema); err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/schema/c4"}})
+			if w.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+			if !bytes.Equal(w.V, schema) {
+				t.Errorf("unexpected response: %s", w.V)
+			}
+			if w.Headers.Get("Content-Type") != mimeTypeJSON {
+				t.Errorf("unexpected content type: %s", w.Headers.Get("Content-Type"))
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail on invalid input", func(t *testing.T) {
+			handler := NewHandler(ciamRejectAll, nil, nil)
+			if err := handler.RegisterSchema("c4", []byte(`{}`)); err == nil {
+				t.Error("error expected for path without the leading slash")
+			}
+			if err := handler.RegisterSchema("/c4", []byte(`{`)); err == nil {
+				t.Error("error expected for invalid JSON")
+			}
+		},
+	)
+}
+
+func TestHandler_Tracing(t *testing.T) {
+	// GIVEN
+	tracer := &diagram.MockTracer{}
+	handler := NewHandler(
+		mockCIAMHandler, nil, map[string]diagram.HTTPHandler{
+			"/c4": func(ctx context.Context, _ diagram.Input) (diagram.Output, error) {
+				_, end := tracer.Start(ctx, "model_inference")
+				end(nil)
+				return diagram.MockOutput{V: []byte(`{"svg":"foo"}`)}, nil
+			},
+		},
+		WithTracer(tracer),
+	)
+	r := newGenerateRequest("/c4")
+	r.Header.Set("traceparent", "remote")
+
+	// WHEN
+	handler.ServeHTTP(&mockWriter{Headers: http.Header{}}, r)
+
+	// THEN
+	want := []diagram.MockSpan{
+		{Name: "POST /generate/c4", Parent: "remote", Ended: true},
+		{Name: "model_inference", Parent: "POST /generate/c4", Ended: true},
+	}
+	if !reflect.DeepEqual(tracer.Spans, want) {
+		t.Errorf("unexpected spans: got = %+v, want = %+v", tracer.Spans, want)
+	}
+}
+
+func TestHandler_Logging(t *testing.T) {
+	// GIVEN
+	l := &logger.MockLogger{}
+	handler := NewHandler(
+		mockCIAMHandler, nil, map[string]diagram.HTTPHandler{"/c4": mockDiagramHandler(`{"svg":"foo"}`)},
+		WithLogger(l),
+	)
+
+	// WHEN
+	handler.ServeHTTP(&mockWriter{Headers: http.Header{}}, newGenerateRequest("/c4"))
+
+	// THEN
+	if len(l.Records) != 1 {
+		t.Fatalf("one record expected, got: %+v", l.Records)
+	}
+	got := l.Records[0]
+	if got.Level != logger.LevelDebug || got.Fields["path"] != "/generate/c4" || got.Fields["user_id"] != "foo" {
+		t.Errorf("unexpected record: %+v", got)
+	}
+	if _, ok := got.Fields["duration_ms"]; !ok {
+		t.Error("the record shall include timing")
+	}
+}
+
+func TestHandler_Regeneration(t *testing.T) {
+	// GIVEN
+	var got []int
+	handler := NewHandler(
+		mockCIAMHandler, nil, map[string]diagram.HTTPHandler{
+			"/c4": func(_ context.Context, input diagram.Input) (diagram.Output, error) {
+				got = append(got, input.(diagram.InputRegeneration).GetRegeneration())
+				return diagram.MockOutput{V: []byte(`{"svg":"foo"}`)}, nil
+			},
+		},
+		WithLogger(logger.NewNoopLogger()),
+	)
+
+	newRequest := func(path, body string) *http.Request {
+		r := newGenerateRequest(path)
+		r.Body = io.NopCloser(strings.NewReader(body))
+		return r
+	}
+
+	// WHEN
+	var gotStatusCodes []int
+	for _, r := range []*http.Request{
+		newRequest("/c4", `{"prompt":"foo bar qux"}`),
+		newRequest("/c4/regenerate", `{"prompt":"foo bar qux","request_id":"bar"}`),
+		newRequest("/c4/regenerate", `{"prompt":"Foo  bar qux","request_id":"qux"}`),
+		newRequest("/c4/regenerate", `{"prompt":"foo bar qux"}`),
+		newRequest("/c4/regenerate", `{"prompt":"bar"}`),
+	} {
+		w := &mockWriter{Headers: http.Header{}}
+		handler.ServeHTTP(w, r)
+		gotStatusCodes = append(gotStatusCodes, w.StatusCode)
+	}
+
+	// THEN
+	// the regenerations are counted per user's prompt regardless of the client's request ID,
+	// and they are limited by the quota of the anonym user
+	wantStatusCodes := []int{
+		http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusOK,
+	}
+	if !reflect.DeepEqual(gotStatusCodes, wantStatusCodes) {
+		t.Errorf("unexpected status codes: got = %v, want = %v", gotStatusCodes, wantStatusCodes)
+	}
+	if want := []int{0, 1, 2, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected regenerations: got = %v, want = %v", got, want)
+	}
+}
@@ -0,0 +1,45 @@
+package httphandler
+
+import (
+	"strings"
+)
+
+const (
+	mimeTypeJSON = "application/json"
+	mimeTypeSVG  = "image/svg+xml"
+)
+
+// negotiateDiagramMimeType selects the response mime type given the request's Accept header.
+// JSON is used by default, the empty string is returned if no supported mime type is accepted.
+func negotiateDiagramMimeType(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return mimeTypeJSON
+	}
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		if isRejectedMediaRange(params[1:]) {
+			continue
+		}
+
+		switch strings.ToLower(strings.TrimSpace(params[0])) {
+		case mimeTypeJSON, "application/*", "*/*":
+			return mimeTypeJSON
+		case mimeTypeSVG, "image/*":
+			return mimeTypeSVG
+		}
+	}
+
+	return ""
+}
+
+// isRejectedMediaRange checks if the media range's quality factor is zero, i.e. "q=0".
+func isRejectedMediaRange(params []string) bool {
+	for _, p := range params {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if ok && strings.TrimSpace(k) == "q" && strings.Trim(strings.TrimSpace(v), "0.") == "" {
+			return true
+		}
+	}
+	return false
+}
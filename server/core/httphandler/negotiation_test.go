@@ -0,0 +1,31 @@
+package httphandler
+
+import "testing"
+
+func Test_negotiateDiagramMimeType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: mimeTypeJSON},
+		{accept: "*/*", want: mimeTypeJSON},
+		{accept: "application/json", want: mimeTypeJSON},
+		{accept: "application/*", want: mimeTypeJSON},
+		{accept: "image/svg+xml", want: mimeTypeSVG},
+		{accept: "Image/SVG+XML", want: mimeTypeSVG},
+		{accept: "image/*", want: mimeTypeSVG},
+		{accept: "text/html, image/svg+xml;q=0.9, */*;q=0.8", want: mimeTypeSVG},
+		{accept: "application/json;q=0, image/svg+xml", want: mimeTypeSVG},
+		{accept: "application/json;q=0.0", want: ""},
+		{accept: "text/html", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.accept, func(t *testing.T) {
+				if got := negotiateDiagramMimeType(tt.accept); got != tt.want {
+					t.Errorf("negotiateDiagramMimeType() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,20 @@
+package httphandler
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// pathOpenAPI defines the path to serve the OpenAPI specification of the server's API.
+const pathOpenAPI = "/openapi.json"
+
+// openAPISpec defines the OpenAPI specification of the server's API.
+// It must be kept in sync with the behaviour of the handlers.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func handlerOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(openAPISpec)
+}
@@ -0,0 +1,151 @@
+package httphandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// collectRefs collects the values of all "$ref" attributes of the document.
+func collectRefs(v interface{}) []string {
+	var o []string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, el := range v {
+			if ref, ok := el.(string); ok && k == "$ref" {
+				o = append(o, ref)
+				continue
+			}
+			o = append(o, collectRefs(el)...)
+		}
+	case []interface{}:
+		for _, el := range v {
+			o = append(o, collectRefs(el)...)
+		}
+	}
+	return o
+}
+
+// resolveRef resolves the local reference, e.g. "#/components/schemas/Error".
+func resolveRef(doc map[string]interface{}, ref string) bool {
+	if !strings.HasPrefix(ref, "#/") {
+		return false
+	}
+	var v interface{} = doc
+	for _, el := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		o, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if v, ok = o[el]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run(
+		"shall be valid OpenAPI 3 document", func(t *testing.T) {
+			if v, _ := doc["openapi"].(string); !strings.HasPrefix(v, "3.") {
+				t.Errorf("unexpected openapi version: %v", doc["openapi"])
+			}
+
+			info, _ := doc["info"].(map[string]interface{})
+			if info["title"] == nil || info["version"] == nil {
+				t.Error("info.title and info.version must be set")
+			}
+
+			paths, _ := doc["paths"].(map[string]interface{})
+			for path, item := range paths {
+				for method, op := range item.(map[string]interface{}) {
+					responses, _ := op.(map[string]interface{})["responses"].(map[string]interface{})
+					if len(responses) == 0 {
+						t.Errorf("%s %s: responses must be set", method, path)
+					}
+					for code := range responses {
+						if _, err := strconv.Atoi(code); err != nil {
+							t.Errorf("%s %s: unexpected status code %s", method, path, code)
+						}
+					}
+				}
+			}
+
+			for _, ref := range collectRefs(doc) {
+				if !resolveRef(doc, ref) {
+					t.Errorf("reference %s cannot be resolved", ref)
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"shall list the known paths", func(t *testing.T) {
+			paths, _ := doc["paths"].(map[string]interface{})
+			for path, method := range map[string]string{
+				"/status":                 "get",
+				"/livez":                  "get",
+				"/readyz":                 "get",
+				"/openapi.json":           "get",
+				"/schema/c4":              "get",
+				"/generate/c4":            "post",
+				"/generate/c4/regenerate": "post",
+				"/generate/c4/estimate":   "post",
+				"/generate/c4/patch":      "post",
+				"/generate/c4/feedback":   "post",
+				"/quotas":                 "get",
+				"/auth/anonym":            "post",
+				"/auth/init":              "post",
+				"/auth/confirm":           "post",
+				"/auth/refresh":           "post",
+			} {
+				item, ok := paths[path].(map[string]interface{})
+				if !ok {
+					t.Errorf("path %s is not documented", path)
+					continue
+				}
+				if _, ok := item[method]; !ok {
+					t.Errorf("method %s of the path %s is not documented", method, path)
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"shall be served publicly", func(t *testing.T) {
+			// GIVEN
+			ciamRejectAll := func(_ http.Handler) http.Handler {
+				return http.HandlerFunc(
+					func(w http.ResponseWriter, _ *http.Request) {
+						w.WriteHeader(http.StatusUnauthorized)
+					},
+				)
+			}
+			handler := NewHandler(ciamRejectAll, nil, nil)
+
+			// WHEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/openapi.json"}})
+
+			// THEN
+			if w.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+			if !bytes.Equal(w.V, openAPISpec) {
+				t.Errorf("unexpected response: %s", w.V)
+			}
+			if w.Headers.Get("Content-Type") != mimeTypeJSON {
+				t.Errorf("unexpected content type: %s", w.Headers.Get("Content-Type"))
+			}
+		},
+	)
+}
@@ -0,0 +1,120 @@
+package httphandler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/kislerdm/diagramastext/server/core/ciam"
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	coreErrors "github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// pathPatch the suffix of the path to patch the diagram's graph, e.g. /generate/c4/patch.
+const pathPatch = "/patch"
+
+// RegisterPatchHandler registers the handler to apply the JSON Patch to the diagram's graph and to render
+// the patched diagram at the path "/generate{path}/patch". The diagram is rendered, hence the requests
+// are rejected in the maintenance mode. It is safe for concurrent use while the handler serves requests.
+func (h *Handler) RegisterPatchHandler(path string, handler diagram.PatchHandler) error {
+	if !strings.HasPrefix(path, "/") {
+		return errors.New("path must start with /")
+	}
+	if handler == nil {
+		return errors.New("handler must be set")
+	}
+
+	h.diagrams.handle(
+		http.MethodPost, prefixDiagrams+path+pathPatch,
+		handlerPatch{
+			handler: handler, reporter: h.reporter, watermark: h.watermark, limits: h.limits,
+			maintenance: h.maintenance,
+		},
+	)
+	return nil
+}
+
+// handlerPatch serves the requests to patch the diagram's graph.
+type handlerPatch struct {
+	handler     diagram.PatchHandler
+	reporter    ErrorReporter
+	watermark   watermark
+	limits      map[ciam.Role]diagram.ComplexityLimits
+	maintenance *atomic.Bool
+}
+
+func (h handlerPatch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.maintenance.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"error":"temporarily unavailable"}`))
+		return
+	}
+
+	var input diagram.InputPatch
+
+	defer func() { _ = r.Body.Close() }()
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"wrong request format"}`))
+		h.report(r, ErrorTypeBadRequest, err)
+		return
+	}
+
+	user, ok := ciam.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":"user was not extracted from authorisation token"}`))
+		return
+	}
+	input.UserID = user.ID
+	input.Limits = h.limits[user.Role]
+	input.Branding = tenantBranding(ciam.TenantFromContext(r.Context()))
+
+	o, err := h.handler(r.Context(), input)
+	var errHandler coreErrors.HTTPHandlerError
+	if errors.As(err, &errHandler) && errHandler.HTTPCode >= 400 && errHandler.HTTPCode < 500 {
+		// the message may quote the patch, hence it is escaped
+		msg, _ := json.Marshal(errHandler.Msg)
+		w.WriteHeader(errHandler.HTTPCode)
+		_, _ = w.Write([]byte(`{"error":` + string(msg) + `}`))
+		h.report(r, ErrorTypeBadRequest, err)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":"internal error"}`))
+		h.report(r, ErrorTypeInternal, err)
+		return
+	}
+
+	if h.watermark.appliesTo(user.Role) {
+		if o, err = addWatermark(o, h.watermark.text); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"error":"internal error"}`))
+			h.report(r, ErrorTypeInternal, err)
+			return
+		}
+	}
+
+	if setETag(w, r, outputETag(o)) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	oBytes, err := o.Serialize()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":"internal error"}`))
+		h.report(r, ErrorTypeInternal, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(oBytes)
+}
+
+func (h handlerPatch) report(r *http.Request, errType ErrorType, err error) {
+	handlerDiagram{reporter: h.reporter}.report(r, errType, err)
+}
@@ -0,0 +1,174 @@
+package httphandler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/ciam"
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	coreErrors "github.com/kislerdm/diagramastext/server/core/errors"
+	"github.com/kislerdm/diagramastext/server/core/logger"
+)
+
+func newPatchRequest(body string) *http.Request {
+	r := newGenerateRequest("/c4/patch")
+	r.Body = io.NopCloser(bytes.NewReader([]byte(body)))
+	return r
+}
+
+func TestHandler_RegisterPatchHandler(t *testing.T) {
+	const body = `{"request_id":"693a35ba-e42c-4168-8afc-5a7c359d1d05","diagram":1,` +
+		`"patch":[{"op":"add","path":"/title","value":"foo"}]}`
+
+	t.Run(
+		"shall serve the patched diagram", func(t *testing.T) {
+			// GIVEN
+			var got diagram.InputPatch
+			patchHandler := func(_ context.Context, input diagram.InputPatch) (diagram.Output, error) {
+				got = input
+				return diagram.MockOutput{V: []byte(`{"svg":"<svg></svg>"}`)}, nil
+			}
+			limits := diagram.ComplexityLimits{NodesMax: 10}
+			handler := NewHandler(
+				mockCIAMHandler, nil, nil, WithLogger(logger.NewNoopLogger()),
+				WithComplexityLimits(limits, ciam.RoleAnonymUser),
+			)
+			if err := handler.RegisterPatchHandler("/c4", patchHandler); err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newPatchRequest(body))
+
+			// THEN
+			if w.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+			if want := `{"svg":"<svg></svg>"}`; string(w.V) != want {
+				t.Errorf("unexpected response: got = %s, want = %s", w.V, want)
+			}
+			if got.RequestID != "693a35ba-e42c-4168-8afc-5a7c359d1d05" || got.Diagram != 1 ||
+				string(got.Patch) != `[{"op":"add","path":"/title","value":"foo"}]` {
+				t.Errorf("unexpected input: %+v", got)
+			}
+			if got.UserID != "foo" || got.Limits != limits {
+				t.Errorf("unexpected user's input: %+v", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall forward the client's error", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(mockCIAMHandler, nil, nil, WithErrorReporter(&mockErrorReporter{}))
+			if err := handler.RegisterPatchHandler(
+				"/c4", func(_ context.Context, _ diagram.InputPatch) (diagram.Output, error) {
+					return nil, coreErrors.HTTPHandlerError{
+						Msg: `patch operation 0: member "foo" not found`, Type: "patch",
+						HTTPCode: http.StatusUnprocessableEntity,
+					}
+				},
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newPatchRequest(body))
+
+			// THEN
+			if w.StatusCode != http.StatusUnprocessableEntity {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+			if want := `{"error":"patch operation 0: member \"foo\" not found"}`; string(w.V) != want {
+				t.Errorf("unexpected response: got = %s, want = %s", w.V, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the handler's error", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(mockCIAMHandler, nil, nil, WithErrorReporter(&mockErrorReporter{}))
+			if err := handler.RegisterPatchHandler(
+				"/c4", func(_ context.Context, _ diagram.InputPatch) (diagram.Output, error) {
+					return nil, errors.New("foo")
+				},
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newPatchRequest(body))
+
+			// THEN
+			if w.StatusCode != http.StatusInternalServerError {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the wrong request format", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(mockCIAMHandler, nil, nil, WithErrorReporter(&mockErrorReporter{}))
+			if err := handler.RegisterPatchHandler(
+				"/c4", func(_ context.Context, _ diagram.InputPatch) (diagram.Output, error) {
+					return diagram.MockOutput{}, nil
+				},
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newPatchRequest(`{`))
+
+			// THEN
+			if w.StatusCode != http.StatusBadRequest {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+		},
+	)
+
+	t.Run(
+		"shall reject the requests in the maintenance mode", func(t *testing.T) {
+			// GIVEN
+			handler := NewHandler(mockCIAMHandler, nil, nil, WithMaintenance())
+			if err := handler.RegisterPatchHandler(
+				"/c4", func(_ context.Context, _ diagram.InputPatch) (diagram.Output, error) {
+					return diagram.MockOutput{}, nil
+				},
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newPatchRequest(body))
+
+			// THEN
+			if w.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail on invalid input", func(t *testing.T) {
+			handler := NewHandler(mockCIAMHandler, nil, nil)
+			if err := handler.RegisterPatchHandler("c4", nil); err == nil {
+				t.Error("error expected for path without the leading slash")
+			}
+			if err := handler.RegisterPatchHandler("/c4", nil); err == nil {
+				t.Error("error expected for nil handler")
+			}
+		},
+	)
+}
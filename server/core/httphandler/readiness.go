@@ -0,0 +1,106 @@
+package httphandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+	"github.com/kislerdm/diagramastext/server/core/logger"
+)
+
+const (
+	pathLiveness  = "/livez"
+	pathReadiness = "/readyz"
+	// readinessTimeout the time to run all readiness checks.
+	readinessTimeout = 5 * time.Second
+)
+
+// ReadinessCheck checks that the dependency, e.g. the storage, is reachable.
+type ReadinessCheck func(ctx context.Context) error
+
+// readinessCheck defines the named ReadinessCheck.
+type readinessCheck struct {
+	name  string
+	check ReadinessCheck
+}
+
+// WithReadinessCheck adds the check of the dependency to the readiness probe at the path /readyz,
+// the name identifies the failed dependency in the probe's response, e.g. "storage".
+func WithReadinessCheck(name string, check ReadinessCheck) HandlerOps {
+	return func(h *Handler) {
+		if check != nil {
+			h.readinessChecks = append(h.readinessChecks, readinessCheck{name: name, check: check})
+		}
+	}
+}
+
+// SetReady marks the completion of the application's startup. The readiness probe at the path /readyz fails
+// until the Handler is set ready, and the dependencies are reachable. The liveness probe at the path /livez
+// succeeds while the process is up. It is safe for concurrent use while the handler serves requests.
+func (h *Handler) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// IsReady returns true if the startup is completed, see Handler.SetReady.
+func (h *Handler) IsReady() bool {
+	return h.ready.Load()
+}
+
+// NewHTTPReadinessCheck defines the check of the http dependency, e.g. the PlantUML server.
+// The dependency is reachable if the GET request to the url succeeds with the status code below 500.
+func NewHTTPReadinessCheck(client diagram.HTTPClient, url string) ReadinessCheck {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return errors.New(url + " responded with the status code " + strconv.Itoa(resp.StatusCode))
+		}
+		return nil
+	}
+}
+
+// handlerLiveness serves the liveness probe.
+func handlerLiveness(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// handlerReadiness serves the readiness probe, it responds with the status code 503 during the startup,
+// or if any dependency is not reachable.
+type handlerReadiness struct {
+	ready  *atomic.Bool
+	checks []readinessCheck
+	logger logger.Logger
+}
+
+func (h handlerReadiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"error":"starting up"}`))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	for _, c := range h.checks {
+		if err := c.check(ctx); err != nil {
+			h.logger.Warn("dependency is not reachable", logger.Fields{"dependency": c.name, "error": err})
+			msg, _ := json.Marshal(c.name + " is not reachable")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":` + string(msg) + `}`))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
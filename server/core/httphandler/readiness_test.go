@@ -0,0 +1,122 @@
+package httphandler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+)
+
+func TestHandler_Readiness(t *testing.T) {
+	newProbeRequest := func(path string) *http.Request {
+		return &http.Request{Method: http.MethodGet, URL: &url.URL{Path: path}, Header: http.Header{}}
+	}
+
+	var errStorage error
+	storageCheck := func(_ context.Context) error { return errStorage }
+
+	handler := NewHandler(
+		mockCIAMHandler, nil, map[string]diagram.HTTPHandler{"/c4": mockDiagramHandler(`{"svg":"foo"}`)},
+		WithReadinessCheck("storage", storageCheck),
+	)
+
+	t.Run(
+		"shall fail the readiness, and pass the liveness during the startup", func(t *testing.T) {
+			// WHEN
+			wReady := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(wReady, newProbeRequest("/readyz"))
+			wLive := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(wLive, newProbeRequest("/livez"))
+
+			// THEN
+			if handler.IsReady() {
+				t.Error("the handler shall not be ready")
+			}
+			if wReady.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("unexpected status code: %d", wReady.StatusCode)
+			}
+			if want := `{"error":"starting up"}`; string(wReady.V) != want {
+				t.Errorf("unexpected response: got = %s, want = %s", wReady.V, want)
+			}
+			if wLive.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status code: %d", wLive.StatusCode)
+			}
+		},
+	)
+
+	t.Run(
+		"shall pass the readiness given the startup is completed, and the storage is reachable", func(t *testing.T) {
+			// GIVEN
+			handler.SetReady(true)
+
+			// WHEN
+			w := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(w, newProbeRequest("/readyz"))
+
+			// THEN
+			if w.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status code: %d", w.StatusCode)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail the readiness, and pass the liveness given the storage error", func(t *testing.T) {
+			// GIVEN
+			errStorage = errors.New("connection refused")
+			defer func() { errStorage = nil }()
+
+			// WHEN
+			wReady := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(wReady, newProbeRequest("/readyz"))
+			wLive := &mockWriter{Headers: http.Header{}}
+			handler.ServeHTTP(wLive, newProbeRequest("/livez"))
+
+			// THEN
+			if wReady.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("unexpected status code: %d", wReady.StatusCode)
+			}
+			if want := `{"error":"storage is not reachable"}`; string(wReady.V) != want {
+				t.Errorf("unexpected response: got = %s, want = %s", wReady.V, want)
+			}
+			if wLive.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status code: %d", wLive.StatusCode)
+			}
+		},
+	)
+}
+
+func TestNewHTTPReadinessCheck(t *testing.T) {
+	newResponse := func(statusCode int) *http.Response {
+		return &http.Response{StatusCode: statusCode, Body: io.NopCloser(strings.NewReader(""))}
+	}
+
+	tests := []struct {
+		name    string
+		client  diagram.HTTPClient
+		wantErr bool
+	}{
+		{name: "ok", client: diagram.MockHTTPClient{V: newResponse(http.StatusOK)}},
+		{name: "client error status", client: diagram.MockHTTPClient{V: newResponse(http.StatusNotFound)}},
+		{
+			name: "server error status", client: diagram.MockHTTPClient{V: newResponse(http.StatusBadGateway)},
+			wantErr: true,
+		},
+		{name: "connection error", client: diagram.MockHTTPClient{Err: errors.New("foo")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				err := NewHTTPReadinessCheck(tt.client, "http://localhost:8080/")(context.TODO())
+				if (err != nil) != tt.wantErr {
+					t.Errorf("unexpected error: %v, wantErr: %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
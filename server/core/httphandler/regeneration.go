@@ -0,0 +1,58 @@
+package httphandler
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kislerdm/diagramastext/server/core/internal/memstore"
+)
+
+// pathRegeneration the suffix of the path to regenerate the diagram, e.g. /generate/c4/regenerate.
+const pathRegeneration = "/regenerate"
+
+// regenerationsWindow the period to count the regenerations of the diagram within.
+const regenerationsWindow = 24 * time.Hour
+
+// regenerations counts the regenerations of the diagrams per user's initial request within the window,
+// e.g. to account them in the quotas.
+type regenerations struct {
+	counts *memstore.Store
+}
+
+// regenerationsMaxEntries the default number of the counted requests above which
+// the counts of the least recently regenerated requests are evicted, see WithRegenerationsLimit.
+const regenerationsMaxEntries = 100000
+
+func newRegenerations(window time.Duration, fnOps ...memstore.Ops) *regenerations {
+	return &regenerations{
+		counts: memstore.New(
+			append(
+				[]memstore.Ops{memstore.WithName("regenerations"), memstore.WithMaxEntries(regenerationsMaxEntries)},
+				append(fnOps, memstore.WithTTL(window))...,
+			)...,
+		),
+	}
+}
+
+// errRegenerationsQuotaExceeded the error of the regeneration exceeding the user's quota,
+// see ciam.Quotas.RegenerationsPerPrompt.
+var errRegenerationsQuotaExceeded = errors.New("regenerations quota exceeded")
+
+// regenerationKey identifies the initial request by the authenticated user and the normalized prompt,
+// i.e. by the data the client cannot vary to reset the count without changing the diagram's description.
+func regenerationKey(path, userID, prompt string) string {
+	return path + "\x00" + userID + "\x00" + strings.ToLower(strings.Join(strings.Fields(prompt), " "))
+}
+
+// increment records the regeneration and returns the number of regenerations of the request within the window.
+func (c *regenerations) increment(key string) int {
+	return c.counts.Update(
+		key, func(v interface{}, ok bool) interface{} {
+			if !ok {
+				return 1
+			}
+			return v.(int) + 1
+		},
+	).(int)
+}
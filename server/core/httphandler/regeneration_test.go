@@ -0,0 +1,54 @@
+package httphandler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kislerdm/diagramastext/server/core/internal/memstore"
+)
+
+func Test_regenerations_increment(t *testing.T) {
+	// GIVEN
+	now := time.Unix(0, 0)
+	c := newRegenerations(time.Hour, memstore.WithClock(func() time.Time { return now }))
+
+	// WHEN
+	first := c.increment("foo")
+	second := c.increment("foo")
+	other := c.increment("bar")
+
+	// THEN
+	if first != 1 || second != 2 || other != 1 {
+		t.Errorf("unexpected counts: %d, %d, %d", first, second, other)
+	}
+
+	// WHEN
+	now = now.Add(time.Hour)
+	got := c.increment("foo")
+
+	// THEN
+	if got != 1 {
+		t.Errorf("the count shall be reset after the window, got: %d", got)
+	}
+	if c.counts.Len() != 1 {
+		t.Error("the expired counts shall be removed")
+	}
+}
+
+func TestWithRegenerationsLimit(t *testing.T) {
+	// GIVEN
+	h := NewHandler(mockCIAMHandler, nil, nil, WithRegenerationsLimit(2, 0))
+
+	// WHEN
+	for _, key := range []string{"foo", "bar", "qux"} {
+		h.regenerations.increment(key)
+	}
+
+	// THEN
+	if got := h.regenerations.increment("foo"); got != 1 {
+		t.Errorf("the count of the oldest request shall be evicted, got: %d", got)
+	}
+	if got := h.regenerations.counts.Stats().Evictions; got != 2 {
+		t.Errorf("unexpected number of evictions: %d", got)
+	}
+}
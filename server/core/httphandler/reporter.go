@@ -0,0 +1,61 @@
+package httphandler
+
+import (
+	"context"
+	"log"
+	"os"
+)
+
+// ErrorType classifies the reported errors.
+type ErrorType string
+
+const (
+	// ErrorTypeBadRequest indicates that the request cannot be processed because of its content.
+	ErrorTypeBadRequest ErrorType = "bad_request"
+	// ErrorTypeInternal indicates the server's failure.
+	ErrorTypeInternal ErrorType = "internal"
+	// ErrorTypePanic indicates the recovered panic.
+	ErrorTypePanic ErrorType = "panic"
+)
+
+// ErrorReport defines the error with the request's metadata.
+type ErrorReport struct {
+	Err       error
+	Type      ErrorType
+	RequestID string
+	UserID    string
+}
+
+// ErrorReporter defines the sink to report errors to, e.g. stderr, or Sentry.
+type ErrorReporter interface {
+	Report(ctx context.Context, report ErrorReport)
+}
+
+// ErrorReporterFunc adapts the function to report the error without metadata to the ErrorReporter interface.
+type ErrorReporterFunc func(err error)
+
+func (fn ErrorReporterFunc) Report(_ context.Context, report ErrorReport) {
+	fn(report.Err)
+}
+
+// NewStderrErrorReporter initialises the ErrorReporter which logs errors to stderr.
+func NewStderrErrorReporter() ErrorReporter {
+	return stderrErrorReporter{
+		log: log.New(os.Stderr, "diagram-generator", log.Lmicroseconds|log.LUTC|log.Lshortfile),
+	}
+}
+
+type stderrErrorReporter struct {
+	log *log.Logger
+}
+
+func (s stderrErrorReporter) Report(_ context.Context, report ErrorReport) {
+	s.log.Printf(
+		"[%s] request_id=%s user_id=%s: %v", report.Type, report.RequestID, report.UserID, report.Err,
+	)
+}
+
+// NoopErrorReporter discards errors.
+type NoopErrorReporter struct{}
+
+func (NoopErrorReporter) Report(_ context.Context, _ ErrorReport) {}
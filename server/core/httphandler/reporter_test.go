@@ -0,0 +1,141 @@
+package httphandler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+)
+
+type mockErrorReporter struct {
+	reports []ErrorReport
+}
+
+func (m *mockErrorReporter) Report(_ context.Context, report ErrorReport) {
+	m.reports = append(m.reports, report)
+}
+
+func TestHandler_ErrorReporting(t *testing.T) {
+	errDiagram := errors.New("foo")
+	diagramHandler := func(_ context.Context, _ diagram.Input) (diagram.Output, error) {
+		return nil, errDiagram
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantType   ErrorType
+		wantErr    error
+	}{
+		{
+			name:       "diagram handler's error",
+			body:       `{"prompt":"foo bar qux"}`,
+			wantStatus: http.StatusInternalServerError,
+			wantType:   ErrorTypeInternal,
+			wantErr:    errDiagram,
+		},
+		{
+			name:       "faulty request",
+			body:       `{`,
+			wantStatus: http.StatusBadRequest,
+			wantType:   ErrorTypeBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				reporter := &mockErrorReporter{}
+				handler := NewHandler(
+					mockCIAMHandler, nil, map[string]diagram.HTTPHandler{"/c4": diagramHandler},
+					WithErrorReporter(reporter),
+				)
+
+				const requestID = "bar"
+				header := http.Header{}
+				header.Set("X-Request-ID", requestID)
+
+				w := &mockWriter{Headers: http.Header{}}
+
+				// WHEN
+				handler.ServeHTTP(
+					w, &http.Request{
+						Method: http.MethodPost,
+						URL:    &url.URL{Path: "/generate/c4"},
+						Header: header,
+						Body:   io.NopCloser(bytes.NewReader([]byte(tt.body))),
+					},
+				)
+
+				// THEN
+				if w.StatusCode != tt.wantStatus {
+					t.Errorf("unexpected status code. want: %d, got: %d", tt.wantStatus, w.StatusCode)
+				}
+				if len(reporter.reports) != 1 {
+					t.Fatalf("one error report is expected, got: %d", len(reporter.reports))
+				}
+
+				got := reporter.reports[0]
+				if got.Type != tt.wantType {
+					t.Errorf("unexpected error type. want: %s, got: %s", tt.wantType, got.Type)
+				}
+				if got.RequestID != requestID {
+					t.Errorf("unexpected request ID. want: %s, got: %s", requestID, got.RequestID)
+				}
+				if got.UserID != "foo" {
+					t.Errorf("unexpected user ID. want: foo, got: %s", got.UserID)
+				}
+				if tt.wantErr != nil && !errors.Is(got.Err, tt.wantErr) {
+					t.Errorf("unexpected error. want: %v, got: %v", tt.wantErr, got.Err)
+				}
+			},
+		)
+	}
+}
+
+func TestErrorReporterFunc(t *testing.T) {
+	// GIVEN
+	var got error
+	reporter := ErrorReporterFunc(func(err error) { got = err })
+	want := errors.New("foo")
+
+	// WHEN
+	reporter.Report(context.TODO(), ErrorReport{Err: want, Type: ErrorTypeInternal})
+
+	// THEN
+	if !errors.Is(got, want) {
+		t.Errorf("unexpected error. want: %v, got: %v", want, got)
+	}
+}
+
+func TestHandlerRequestID(t *testing.T) {
+	t.Run(
+		"shall generate the request ID if it is not set", func(t *testing.T) {
+			// GIVEN
+			var got string
+			h := handlerRequestID{
+				next: http.HandlerFunc(
+					func(_ http.ResponseWriter, r *http.Request) { got = requestIDFromContext(r.Context()) },
+				),
+			}
+			w := &mockWriter{Headers: http.Header{}}
+
+			// WHEN
+			h.ServeHTTP(w, &http.Request{Header: http.Header{}})
+
+			// THEN
+			if got == "" {
+				t.Error("request ID shall be generated")
+			}
+			if w.Headers.Get("X-Request-ID") != got {
+				t.Error("request ID shall be returned in the response header")
+			}
+		},
+	)
+}
@@ -0,0 +1,35 @@
+package httphandler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/kislerdm/diagramastext/server/core/internal/utils"
+)
+
+const headerRequestID = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// handlerRequestID propagates the request ID from the request header, or generates it.
+// The request ID is returned in the response header.
+type handlerRequestID struct {
+	next http.Handler
+}
+
+func (h handlerRequestID) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(headerRequestID)
+	if id == "" {
+		id = utils.NewUUID()
+	}
+	w.Header().Set(headerRequestID, id)
+
+	if h.next != nil {
+		h.next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	}
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
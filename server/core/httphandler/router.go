@@ -0,0 +1,80 @@
+package httphandler
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// router dispatches requests using the table of routes defined by the path and the method.
+// Requests to unknown paths are passed to the next handler, or rejected with 404 if no next handler is set.
+// Requests to known paths with unregistered methods are rejected with 405.
+type router struct {
+	mu     sync.RWMutex
+	routes map[string]map[string]http.Handler
+	next   http.Handler
+}
+
+func newRouter(next http.Handler) *router {
+	return &router{
+		routes: map[string]map[string]http.Handler{},
+		next:   next,
+	}
+}
+
+// handle registers the handler to serve the requests with the given method and path.
+func (rt *router) handle(method, path string, handler http.Handler) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if _, ok := rt.routes[path]; !ok {
+		rt.routes[path] = map[string]http.Handler{}
+	}
+	rt.routes[path][method] = handler
+}
+
+// lookup finds the handler for the method and path, pathFound flags if any method is registered for the path.
+func (rt *router) lookup(method, path string) (handler http.Handler, pathFound bool) {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	methods, ok := rt.routes[path]
+	if !ok {
+		return nil, false
+	}
+	return methods[method], true
+}
+
+// methods returns the sorted list of methods registered for the path.
+func (rt *router) methods(path string) []string {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	o := make([]string, 0, len(rt.routes[path]))
+	for method := range rt.routes[path] {
+		o = append(o, method)
+	}
+	sort.Strings(o)
+	return o
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, pathFound := rt.lookup(r.Method, r.URL.Path)
+	switch {
+	case handler != nil:
+		handler.ServeHTTP(w, r)
+	case pathFound:
+		writeInvalidMethodError(w, r.Method)
+	case rt.next != nil:
+		rt.next.ServeHTTP(w, r)
+	default:
+		writeNotFoundError(w, r.URL.Path)
+	}
+}
+
+func writeInvalidMethodError(w http.ResponseWriter, method string) {
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	_, _ = w.Write([]byte(`{"error":"` + method + ` is not allowed"}`))
+}
+
+func writeNotFoundError(w http.ResponseWriter, path string) {
+	w.WriteHeader(http.StatusNotFound)
+	_, _ = w.Write([]byte(`{"error":"` + path + ` not found"}`))
+}
@@ -0,0 +1,138 @@
+package httphandler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+)
+
+func TestRouter_ServeHTTP(t *testing.T) {
+	newHandler := func(status int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(status) })
+	}
+
+	tests := []struct {
+		name       string
+		next       http.Handler
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "registered route",
+			method:     http.MethodGet,
+			path:       "/foo",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "registered route with another method",
+			method:     http.MethodPost,
+			path:       "/foo",
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "known path, wrong method",
+			method:     http.MethodDelete,
+			path:       "/foo",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantBody:   `{"error":"DELETE is not allowed"}`,
+		},
+		{
+			name:       "unknown path",
+			method:     http.MethodGet,
+			path:       "/bar",
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"error":"/bar not found"}`,
+		},
+		{
+			name:       "unknown path passed to the next handler",
+			next:       newHandler(http.StatusAccepted),
+			method:     http.MethodGet,
+			path:       "/bar",
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "known path with wrong method is not passed to the next handler",
+			next:       newHandler(http.StatusAccepted),
+			method:     http.MethodPut,
+			path:       "/foo",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantBody:   `{"error":"PUT is not allowed"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				// GIVEN
+				rt := newRouter(tt.next)
+				rt.handle(http.MethodGet, "/foo", newHandler(http.StatusOK))
+				rt.handle(http.MethodPost, "/foo", newHandler(http.StatusCreated))
+
+				w := &mockWriter{Headers: http.Header{}}
+
+				// WHEN
+				rt.ServeHTTP(w, &http.Request{Method: tt.method, URL: &url.URL{Path: tt.path}})
+
+				// THEN
+				if w.StatusCode != tt.wantStatus {
+					t.Errorf("unexpected status code. want: %d, got: %d", tt.wantStatus, w.StatusCode)
+				}
+				if string(w.V) != tt.wantBody {
+					t.Errorf("unexpected response. want: %s, got: %s", tt.wantBody, w.V)
+				}
+			},
+		)
+	}
+}
+
+func TestNewHandlerRoutes(t *testing.T) {
+	handler := NewHandler(
+		mockCIAMHandler, nil, map[string]diagram.HTTPHandler{"/c4": mockDiagramHandler(`{"svg":"foo"}`)},
+	)
+
+	tests := []struct {
+		name       string
+		request    *http.Request
+		wantStatus int
+	}{
+		{
+			name:       "status",
+			request:    &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/status"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "status: wrong method",
+			request:    &http.Request{Method: http.MethodPost, URL: &url.URL{Path: "/status"}},
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "diagram",
+			request:    newGenerateRequest("/c4"),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "diagram: wrong method",
+			request:    &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/generate/c4"}},
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "unknown diagram",
+			request:    newGenerateRequest("/foo"),
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				w := &mockWriter{Headers: http.Header{}}
+				handler.ServeHTTP(w, tt.request)
+				if w.StatusCode != tt.wantStatus {
+					t.Errorf("unexpected status code. want: %d, got: %d", tt.wantStatus, w.StatusCode)
+				}
+			},
+		)
+	}
+}
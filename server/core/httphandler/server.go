@@ -0,0 +1,64 @@
+package httphandler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Mount mounts the handler, e.g. Handler, on the mux to serve the requests to the paths starting with the prefix,
+// e.g. "/api". The prefix is stripped from the path before the request is routed by the handler.
+// The empty prefix mounts the handler at the root.
+func Mount(mux *http.ServeMux, prefix string, handler http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		mux.Handle("/", handler)
+		return
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	mux.Handle(prefix+"/", http.StripPrefix(prefix, handler))
+}
+
+// ListenAndServe serves the handler on the TCP address until the context is done, see Serve.
+func ListenAndServe(ctx context.Context, addr string, handler http.Handler, shutdownTimeout time.Duration) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return Serve(ctx, listener, handler, shutdownTimeout)
+}
+
+// Serve serves the handler using the listener until the context is done, e.g. on SIGTERM.
+// The server is shut down gracefully: the in-flight requests are completed within the shutdownTimeout.
+func Serve(ctx context.Context, listener net.Listener, handler http.Handler, shutdownTimeout time.Duration) error {
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: readHeaderTimeout}
+
+	errServe := make(chan error, 1)
+	go func() {
+		errServe <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-errServe:
+		return err
+	case <-ctx.Done():
+	}
+
+	ctxShutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctxShutdown); err != nil {
+		return err
+	}
+	if err := <-errServe; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// readHeaderTimeout the time to read the request's headers, it protects the server from the slow clients.
+const readHeaderTimeout = 10 * time.Second
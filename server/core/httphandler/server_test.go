@@ -0,0 +1,175 @@
+package httphandler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+)
+
+func TestMount(t *testing.T) {
+	handler := NewHandler(
+		mockCIAMHandler, map[string]string{"Access-Control-Allow-Origin": "https://diagramastext.dev"},
+		map[string]diagram.HTTPHandler{"/c4": mockDiagramHandler(`{"svg":"foo"}`)},
+	)
+
+	tests := []struct {
+		name   string
+		prefix string
+		path   string
+	}{
+		{name: "root", prefix: "", path: "/generate/c4"},
+		{name: "prefix", prefix: "/api/", path: "/api/generate/c4"},
+		{name: "prefix without leading slash", prefix: "api", path: "/api/generate/c4"},
+	}
+	for _, tt := range tests {
+		t.Run(
+			"shall serve the mounted handler given "+tt.name, func(t *testing.T) {
+				// GIVEN
+				mux := http.NewServeMux()
+				Mount(mux, tt.prefix, handler)
+				srv := httptest.NewServer(mux)
+				defer srv.Close()
+
+				// WHEN
+				resp, err := http.Post(
+					srv.URL+tt.path, mimeTypeJSON, bytes.NewReader([]byte(`{"prompt":"foo bar qux"}`)),
+				)
+
+				// THEN
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer func() { _ = resp.Body.Close() }()
+				body, _ := io.ReadAll(resp.Body)
+				if resp.StatusCode != http.StatusOK || string(body) != `{"svg":"foo"}` {
+					t.Errorf("unexpected response, status code: %d, body: %s", resp.StatusCode, body)
+				}
+				if v := resp.Header.Get("Access-Control-Allow-Origin"); v != "https://diagramastext.dev" {
+					t.Errorf("unexpected Access-Control-Allow-Origin: %s", v)
+				}
+				if v := resp.Header.Get(headerRequestID); v == "" {
+					t.Error("the request ID shall be set")
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"shall route the preflight request", func(t *testing.T) {
+			// GIVEN
+			mux := http.NewServeMux()
+			Mount(mux, "/api", handler)
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+			req, _ := http.NewRequest(http.MethodOptions, srv.URL+"/api/status", nil)
+
+			// WHEN
+			resp, err := srv.Client().Do(req)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if v := resp.Header.Get("Access-Control-Allow-Methods"); v != "GET,OPTIONS" {
+				t.Errorf("unexpected Access-Control-Allow-Methods: %s", v)
+			}
+		},
+	)
+
+	t.Run(
+		"shall not serve the path outside the prefix", func(t *testing.T) {
+			// GIVEN
+			mux := http.NewServeMux()
+			Mount(mux, "/api", handler)
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			// WHEN
+			resp, err := http.Get(srv.URL + "/status")
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusNotFound {
+				t.Errorf("unexpected status code: %d", resp.StatusCode)
+			}
+		},
+	)
+}
+
+func TestServe(t *testing.T) {
+	t.Run(
+		"shall serve until the context is done, and complete the in-flight request", func(t *testing.T) {
+			// GIVEN
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			started := make(chan struct{})
+			handler := http.HandlerFunc(
+				func(w http.ResponseWriter, _ *http.Request) {
+					close(started)
+					time.Sleep(50 * time.Millisecond)
+					w.WriteHeader(http.StatusNoContent)
+				},
+			)
+			ctx, cancel := context.WithCancel(context.TODO())
+
+			errServe := make(chan error, 1)
+			go func() {
+				errServe <- Serve(ctx, listener, handler, time.Second)
+			}()
+
+			// WHEN
+			respCh := make(chan *http.Response, 1)
+			go func() {
+				resp, err := http.Get("http://" + listener.Addr().String())
+				if err != nil {
+					t.Error(err)
+				} else {
+					_ = resp.Body.Close()
+				}
+				respCh <- resp
+			}()
+			<-started
+			cancel()
+
+			// THEN
+			if err := <-errServe; err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if resp := <-respCh; resp == nil || resp.StatusCode != http.StatusNoContent {
+				t.Errorf("the in-flight request shall be completed, got: %v", resp)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the closed listener", func(t *testing.T) {
+			// GIVEN
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = listener.Close()
+
+			// WHEN
+			err = Serve(context.TODO(), listener, http.NotFoundHandler(), time.Second)
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
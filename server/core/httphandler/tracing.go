@@ -0,0 +1,22 @@
+package httphandler
+
+import (
+	"net/http"
+
+	"github.com/kislerdm/diagramastext/server/core/diagram"
+)
+
+// handlerTracing starts the request's span as the child of the span propagated in the request headers, if any.
+type handlerTracing struct {
+	tracer diagram.Tracer
+	next   http.Handler
+}
+
+func (h handlerTracing) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, end := h.tracer.Start(h.tracer.Extract(r.Context(), r.Header), r.Method+" "+r.URL.Path)
+	defer end(nil)
+
+	if h.next != nil {
+		h.next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,291 @@
+// Package memstore defines the concurrent-safe in-memory key-value store with the entries' expiry
+// and the eviction of the least recently used entries, e.g. to cache the results, or to count the requests.
+// The statistics of the named stores are published as the expvar variable "memstore", see WithName.
+package memstore
+
+import (
+	"container/list"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// metrics the statistics of the named stores.
+var metrics = expvar.NewMap("memstore")
+
+// Store the concurrent-safe in-memory key-value store.
+// The expired entries are not returned, they are removed on access, and swept on write once per TTL.
+type Store struct {
+	mu sync.Mutex
+	// entries the index of the list's elements by the key.
+	entries map[string]*list.Element
+	// lru the list of the entries ordered from the most to the least recently used.
+	lru *list.List
+
+	maxEntries int
+	maxBytes   int
+	bytes      int
+	ttl        time.Duration
+	now        func() time.Time
+	sweptAt    time.Time
+
+	evictions   uint64
+	expirations uint64
+}
+
+// Stats defines the Store's statistics, e.g. to export them as the metrics.
+type Stats struct {
+	// Entries the number of entries including the expired entries which were not removed yet.
+	Entries int `json:"entries"`
+	// Bytes the size of the entries, see WithMaxBytes.
+	Bytes int `json:"bytes"`
+	// Evictions the number of entries evicted to keep the store within the limits.
+	Evictions uint64 `json:"evictions"`
+	// Expirations the number of removed expired entries.
+	Expirations uint64 `json:"expirations"`
+}
+
+// Sizer defines the value which reports its size in bytes, see WithMaxBytes.
+type Sizer interface {
+	Size() int
+}
+
+type entry struct {
+	key   string
+	value interface{}
+	size  int
+	// expiresAt zero value defines the entry which does not expire.
+	expiresAt time.Time
+}
+
+func (e *entry) isExpired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// Ops defines the Store's options.
+type Ops func(s *Store)
+
+// WithMaxEntries sets the maximum number of entries, the least recently used entry is evicted
+// to add the entry above the limit. The number of entries is not limited by default.
+func WithMaxEntries(n int) Ops {
+	return func(s *Store) {
+		if n > 0 {
+			s.maxEntries = n
+		}
+	}
+}
+
+// WithMaxBytes sets the maximum size of the entries in bytes, the least recently used entries are evicted
+// to add the entry above the limit. The entry's size is the length of its key plus the length
+// of the string, or []byte value, or the size of the value implementing Sizer. The size is not limited by default.
+func WithMaxBytes(n int) Ops {
+	return func(s *Store) {
+		if n > 0 {
+			s.maxBytes = n
+		}
+	}
+}
+
+// WithName publishes the Store's statistics under the name, see Stats.
+// The statistics of the store with the same name are replaced.
+func WithName(name string) Ops {
+	return func(s *Store) {
+		if name != "" {
+			metrics.Set(name, expvar.Func(func() interface{} { return s.Stats() }))
+		}
+	}
+}
+
+// WithTTL sets the default time to live of the entries. The entries do not expire by default.
+func WithTTL(ttl time.Duration) Ops {
+	return func(s *Store) {
+		if ttl > 0 {
+			s.ttl = ttl
+		}
+	}
+}
+
+// WithClock sets the clock to define the entries' expiry, e.g. to test the expiry.
+func WithClock(now func() time.Time) Ops {
+	return func(s *Store) {
+		if now != nil {
+			s.now = now
+		}
+	}
+}
+
+// New initialises the Store.
+func New(fnOps ...Ops) *Store {
+	s := &Store{
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		now:     time.Now,
+	}
+	for _, fn := range fnOps {
+		fn(s)
+	}
+	return s
+}
+
+// Get returns the value of the entry, and marks the entry as recently used.
+func (s *Store) Get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.get(key, s.now())
+	if !ok {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Set adds, or replaces the entry which expires after the default TTL.
+func (s *Store) Set(key string, value interface{}) {
+	s.SetWithTTL(key, value, s.ttl)
+}
+
+// SetWithTTL adds, or replaces the entry which expires after the ttl. Zero ttl defines the entry which does not expire.
+func (s *Store) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	s.set(key, value, expiresAt(now, ttl))
+}
+
+// Update replaces the value of the entry with the result of fn atomically, and returns the new value.
+// fn receives the current value and true if the entry exists. The existing entry keeps its expiry,
+// the new entry expires after the default TTL.
+func (s *Store) Update(key string, fn func(value interface{}, ok bool) interface{}) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if e, ok := s.get(key, now); ok {
+		v := fn(e.value, true)
+		s.set(key, v, e.expiresAt)
+		return v
+	}
+
+	v := fn(nil, false)
+	s.set(key, v, expiresAt(now, s.ttl))
+	return v
+}
+
+// Delete removes the entry.
+func (s *Store) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+}
+
+// Len returns the number of entries including the expired entries which were not removed yet.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// Stats returns the Store's statistics.
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{
+		Entries:     s.lru.Len(),
+		Bytes:       s.bytes,
+		Evictions:   s.evictions,
+		Expirations: s.expirations,
+	}
+}
+
+func sizeOf(key string, value interface{}) int {
+	switch v := value.(type) {
+	case string:
+		return len(key) + len(v)
+	case []byte:
+		return len(key) + len(v)
+	case Sizer:
+		return len(key) + v.Size()
+	default:
+		return len(key)
+	}
+}
+
+func expiresAt(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+func (s *Store) get(key string, now time.Time) (*entry, bool) {
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if e.isExpired(now) {
+		s.remove(el)
+		s.expirations++
+		return nil, false
+	}
+
+	s.lru.MoveToFront(el)
+	return e, true
+}
+
+func (s *Store) set(key string, value interface{}, expiresAt time.Time) {
+	size := sizeOf(key, value)
+	if el, ok := s.entries[key]; ok {
+		e := el.Value.(*entry)
+		s.bytes += size - e.size
+		e.value = value
+		e.size = size
+		e.expiresAt = expiresAt
+		s.lru.MoveToFront(el)
+	} else {
+		s.entries[key] = s.lru.PushFront(&entry{key: key, value: value, size: size, expiresAt: expiresAt})
+		s.bytes += size
+	}
+	s.evict()
+}
+
+// evict removes the least recently used entries exceeding the limits.
+// The entry exceeding the size limit on its own is removed too.
+func (s *Store) evict() {
+	for s.lru.Len() > 0 &&
+		((s.maxEntries > 0 && s.lru.Len() > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes)) {
+		s.remove(s.lru.Back())
+		s.evictions++
+	}
+}
+
+func (s *Store) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	s.lru.Remove(el)
+	delete(s.entries, e.key)
+	s.bytes -= e.size
+}
+
+// sweep removes the expired entries once per TTL to limit the memory footprint.
+func (s *Store) sweep(now time.Time) {
+	if s.ttl <= 0 || now.Sub(s.sweptAt) < s.ttl {
+		return
+	}
+	for el := s.lru.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*entry).isExpired(now) {
+			s.remove(el)
+			s.expirations++
+		}
+		el = next
+	}
+	s.sweptAt = now
+}
@@ -0,0 +1,320 @@
+package memstore
+
+import (
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStore_SetGet(t *testing.T) {
+	// GIVEN
+	s := New()
+
+	// WHEN
+	s.Set("foo", 1)
+	s.Set("bar", 2)
+	s.Set("foo", 3)
+
+	// THEN
+	if v, ok := s.Get("foo"); !ok || v != 3 {
+		t.Errorf("unexpected value: got = %v, %v, want = 3, true", v, ok)
+	}
+	if v, ok := s.Get("bar"); !ok || v != 2 {
+		t.Errorf("unexpected value: got = %v, %v, want = 2, true", v, ok)
+	}
+	if _, ok := s.Get("qux"); ok {
+		t.Error("the missing entry shall not be found")
+	}
+	if s.Len() != 2 {
+		t.Errorf("unexpected number of entries: %d", s.Len())
+	}
+
+	// WHEN
+	s.Delete("foo")
+
+	// THEN
+	if _, ok := s.Get("foo"); ok {
+		t.Error("the deleted entry shall not be found")
+	}
+}
+
+func TestStore_Expiry(t *testing.T) {
+	t.Run(
+		"shall expire the entries after the TTL", func(t *testing.T) {
+			// GIVEN
+			now := time.Unix(0, 0)
+			s := New(WithTTL(time.Minute), WithClock(func() time.Time { return now }))
+			s.Set("foo", 1)
+			s.SetWithTTL("bar", 2, time.Hour)
+			s.SetWithTTL("qux", 3, 0)
+
+			// WHEN
+			now = now.Add(time.Minute)
+
+			// THEN
+			if _, ok := s.Get("foo"); ok {
+				t.Error("the entry shall expire after the default TTL")
+			}
+			if _, ok := s.Get("bar"); !ok {
+				t.Error("the entry shall expire after its TTL")
+			}
+
+			// WHEN
+			now = now.Add(time.Hour)
+
+			// THEN
+			if _, ok := s.Get("bar"); ok {
+				t.Error("the entry shall expire after its TTL")
+			}
+			if _, ok := s.Get("qux"); !ok {
+				t.Error("the entry without TTL shall not expire")
+			}
+		},
+	)
+
+	t.Run(
+		"shall sweep the expired entries on write", func(t *testing.T) {
+			// GIVEN
+			now := time.Unix(0, 0)
+			s := New(WithTTL(time.Minute), WithClock(func() time.Time { return now }))
+			for i := 0; i < 10; i++ {
+				s.Set(strconv.Itoa(i), i)
+			}
+
+			// WHEN
+			now = now.Add(time.Minute)
+			s.Set("foo", 1)
+
+			// THEN
+			if s.Len() != 1 {
+				t.Errorf("the expired entries shall be removed, got %d entries", s.Len())
+			}
+		},
+	)
+
+	t.Run(
+		"shall keep the expiry of the updated entry", func(t *testing.T) {
+			// GIVEN
+			now := time.Unix(0, 0)
+			s := New(WithTTL(time.Minute), WithClock(func() time.Time { return now }))
+			increment := func(v interface{}, ok bool) interface{} {
+				if !ok {
+					return 1
+				}
+				return v.(int) + 1
+			}
+
+			// WHEN
+			first := s.Update("foo", increment)
+			now = now.Add(30 * time.Second)
+			second := s.Update("foo", increment)
+			now = now.Add(30 * time.Second)
+			third := s.Update("foo", increment)
+
+			// THEN
+			if first != 1 || second != 2 || third != 1 {
+				t.Errorf("unexpected values: %v, %v, %v", first, second, third)
+			}
+		},
+	)
+}
+
+func TestStore_Eviction(t *testing.T) {
+	// GIVEN
+	s := New(WithMaxEntries(2))
+	s.Set("foo", 1)
+	s.Set("bar", 2)
+
+	// WHEN
+	// foo is used recently, hence bar is evicted
+	s.Get("foo")
+	s.Set("qux", 3)
+
+	// THEN
+	if _, ok := s.Get("bar"); ok {
+		t.Error("the least recently used entry shall be evicted")
+	}
+	if _, ok := s.Get("foo"); !ok {
+		t.Error("the recently used entry shall be kept")
+	}
+	if _, ok := s.Get("qux"); !ok {
+		t.Error("the added entry shall be kept")
+	}
+	if s.Len() != 2 {
+		t.Errorf("unexpected number of entries: %d", s.Len())
+	}
+}
+
+func TestStore_Limits(t *testing.T) {
+	t.Run(
+		"shall evict the oldest entries exceeding the number of entries", func(t *testing.T) {
+			// GIVEN
+			s := New(WithMaxEntries(3))
+
+			// WHEN
+			for i := 0; i < 5; i++ {
+				s.Set(strconv.Itoa(i), i)
+			}
+
+			// THEN
+			for i, want := range []bool{false, false, true, true, true} {
+				if _, ok := s.Get(strconv.Itoa(i)); ok != want {
+					t.Errorf("entry %d: found = %v, want = %v", i, ok, want)
+				}
+			}
+			if got := s.Stats(); got.Evictions != 2 || got.Entries != 3 {
+				t.Errorf("unexpected stats: %+v", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall evict the oldest entries exceeding the size", func(t *testing.T) {
+			// GIVEN
+			s := New(WithMaxBytes(10))
+
+			// WHEN
+			s.Set("a", "1234")
+			s.Set("b", []byte("1234"))
+			s.Set("c", "1234")
+
+			// THEN
+			if _, ok := s.Get("a"); ok {
+				t.Error("the oldest entry shall be evicted")
+			}
+			if got := s.Stats(); got.Evictions != 1 || got.Entries != 2 || got.Bytes != 10 {
+				t.Errorf("unexpected stats: %+v", got)
+			}
+
+			// WHEN
+			s.Set("d", "12345678901")
+
+			// THEN
+			if got := s.Stats(); got.Evictions != 4 || got.Entries != 0 || got.Bytes != 0 {
+				t.Errorf("the entry exceeding the size on its own shall be evicted, stats: %+v", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall account the size of the updated entry", func(t *testing.T) {
+			// GIVEN
+			s := New(WithMaxBytes(100))
+			s.Set("a", mockSizer(10))
+
+			// WHEN
+			s.Update(
+				"a", func(v interface{}, _ bool) interface{} {
+					return v.(mockSizer) + 5
+				},
+			)
+
+			// THEN
+			if got := s.Stats().Bytes; got != 16 {
+				t.Errorf("unexpected size: got = %d, want = 16", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall count the expired entries", func(t *testing.T) {
+			// GIVEN
+			now := time.Unix(0, 0)
+			s := New(WithTTL(time.Minute), WithClock(func() time.Time { return now }))
+			s.Set("a", 1)
+
+			// WHEN
+			now = now.Add(time.Minute)
+			s.Get("a")
+
+			// THEN
+			if got := s.Stats(); got.Expirations != 1 || got.Evictions != 0 {
+				t.Errorf("unexpected stats: %+v", got)
+			}
+		},
+	)
+
+	t.Run(
+		"shall publish the stats of the named store", func(t *testing.T) {
+			// GIVEN
+			s := New(WithName("foo"), WithMaxEntries(1))
+
+			// WHEN
+			s.Set("a", 1)
+			s.Set("b", 1)
+
+			// THEN
+			v := expvar.Get("memstore").(*expvar.Map).Get("foo")
+			if v == nil {
+				t.Fatal("the stats shall be published")
+			}
+			var got Stats
+			if err := json.Unmarshal([]byte(v.String()), &got); err != nil {
+				t.Fatal(err)
+			}
+			if want := (Stats{Entries: 1, Bytes: 1, Evictions: 1}); got != want {
+				t.Errorf("unexpected stats: got = %+v, want = %+v", got, want)
+			}
+		},
+	)
+}
+
+type mockSizer int
+
+func (m mockSizer) Size() int {
+	return int(m)
+}
+
+func TestStore_Concurrency(t *testing.T) {
+	// GIVEN
+	const (
+		goroutines = 50
+		iterations = 1000
+	)
+	s := New(WithMaxEntries(100), WithTTL(time.Millisecond))
+	counter := New()
+
+	// WHEN
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				key := strconv.Itoa((g * i) % 200)
+				s.Set(key, i)
+				s.Get(key)
+				s.Update(
+					key, func(v interface{}, ok bool) interface{} {
+						return i
+					},
+				)
+				if i%10 == 0 {
+					s.Delete(key)
+				}
+				_ = s.Len()
+
+				counter.Update(
+					"foo", func(v interface{}, ok bool) interface{} {
+						if !ok {
+							return 1
+						}
+						return v.(int) + 1
+					},
+				)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// THEN
+	if s.Len() > 100 {
+		t.Errorf("the number of entries shall not exceed the limit, got %d", s.Len())
+	}
+	if v, _ := counter.Get("foo"); v != goroutines*iterations {
+		t.Errorf("the updates shall be atomic: got = %v, want = %d", v, goroutines*iterations)
+	}
+}
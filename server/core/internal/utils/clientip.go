@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies defines the networks of the proxies trusted to set the header X-Forwarded-For.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses the list of CIDRs, e.g. 10.0.0.0/8, the IP address is parsed as the single host network.
+// The empty values are skipped.
+func ParseTrustedProxies(cidrs ...string) (TrustedProxies, error) {
+	var o TrustedProxies
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, errors.New("invalid trusted proxy IP: " + cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			o = append(o, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.New("invalid trusted proxy CIDR: " + cidr)
+		}
+		o = append(o, network)
+	}
+	return o, nil
+}
+
+func (p TrustedProxies) isTrusted(ip net.IP) bool {
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTrustedPeer returns true if the request's peer is the trusted proxy, i.e. the headers set by the proxy,
+// e.g. X-Forwarded-For, can be trusted.
+func (p TrustedProxies) IsTrustedPeer(r *http.Request) bool {
+	ip := net.ParseIP(peerAddr(r))
+	return ip != nil && p.isTrusted(ip)
+}
+
+// peerAddr returns the host of the request's peer.
+func peerAddr(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// ClientIP returns the request's client IP. The header X-Forwarded-For is only read if the peer is trusted,
+// otherwise the peer's address is returned. The header's entries are read from right to left,
+// i.e. from the one added by the nearest proxy, and the first entry which is not a trusted proxy is returned,
+// because the entries added by the client can be spoofed.
+func (p TrustedProxies) ClientIP(r *http.Request) string {
+	peer := peerAddr(r)
+	if !p.IsTrustedPeer(r) {
+		return peer
+	}
+
+	clientIP := peer
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		ip := net.ParseIP(hop)
+		if ip == nil {
+			break
+		}
+		clientIP = ip.String()
+		if !p.isTrusted(ip) {
+			break
+		}
+	}
+	return clientIP
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	t.Run(
+		"shall parse CIDRs and IPs", func(t *testing.T) {
+			got, err := ParseTrustedProxies("10.0.0.0/8", " 192.168.0.1", "", "2001:db8::/32", "::1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"10.0.0.0/8", "192.168.0.1/32", "2001:db8::/32", "::1/128"}
+			if len(got) != len(want) {
+				t.Fatalf("unexpected networks: %v", got)
+			}
+			for i, network := range got {
+				if network.String() != want[i] {
+					t.Errorf("unexpected network: got = %s, want = %s", network, want[i])
+				}
+			}
+		},
+	)
+
+	for _, cidr := range []string{"foo", "10.0.0.0/33", "10.0.0.256"} {
+		t.Run(
+			"shall fail given "+cidr, func(t *testing.T) {
+				if _, err := ParseTrustedProxies(cidr); err == nil {
+					t.Error("error expected")
+				}
+			},
+		)
+	}
+}
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8", "172.16.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{
+			name:       "untrusted peer",
+			remoteAddr: "192.168.0.1:1234",
+			forwarded:  "1.1.1.1",
+			want:       "192.168.0.1",
+		},
+		{
+			name:       "untrusted peer without port",
+			remoteAddr: "192.168.0.1",
+			forwarded:  "1.1.1.1",
+			want:       "192.168.0.1",
+		},
+		{
+			name:       "trusted peer",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "1.1.1.1",
+			want:       "1.1.1.1",
+		},
+		{
+			name:       "trusted peer without the header",
+			remoteAddr: "10.0.0.1:1234",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "multi-hop through trusted proxies",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "1.1.1.1, 172.16.0.1, 10.0.0.2",
+			want:       "1.1.1.1",
+		},
+		{
+			name:       "spoofed entry added by the client",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "2.2.2.2, 1.1.1.1, 10.0.0.2",
+			want:       "1.1.1.1",
+		},
+		{
+			name:       "all hops are trusted",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "10.0.0.3,10.0.0.2",
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "invalid entry",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "1.1.1.1, foo, 10.0.0.2",
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "ipv6",
+			remoteAddr: "[2001:db8::1]:1234",
+			forwarded:  "1.1.1.1",
+			want:       "2001:db8::1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				r := &http.Request{RemoteAddr: tt.remoteAddr, Header: http.Header{}}
+				if tt.forwarded != "" {
+					r.Header.Set("X-Forwarded-For", tt.forwarded)
+				}
+				if got := proxies.ClientIP(r); got != tt.want {
+					t.Errorf("ClientIP() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestTrustedProxies_IsTrustedPeer(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for remoteAddr, want := range map[string]bool{
+		"10.0.0.1:1234":    true,
+		"10.0.0.1":         true,
+		"192.168.0.1:1234": false,
+		"foo":              false,
+		"":                 false,
+	} {
+		if got := proxies.IsTrustedPeer(&http.Request{RemoteAddr: remoteAddr}); got != want {
+			t.Errorf("IsTrustedPeer(%q) = %v, want %v", remoteAddr, got, want)
+		}
+	}
+}
@@ -4,12 +4,40 @@ import (
 	"strconv"
 )
 
+// ParseInt parses the string as integer, the empty string is parsed as zero.
+func ParseInt(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// MustParseInt parses the string as integer, it panics if the string is not integer.
 func MustParseInt(s string) int {
-	o, _ := strconv.Atoi(s)
+	o, err := ParseInt(s)
+	if err != nil {
+		panic(err)
+	}
 	return o
 }
 
+// ParseFloat32 parses the string as float32, the empty string is parsed as zero.
+func ParseFloat32(s string) (float32, error) {
+	if s == "" {
+		return 0, nil
+	}
+	o, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return 0, err
+	}
+	return float32(o), nil
+}
+
+// MustParseFloat32 parses the string as float32, it panics if the string is not float.
 func MustParseFloat32(s string) float32 {
-	o, _ := strconv.ParseFloat(s, 32)
-	return float32(o)
+	o, err := ParseFloat32(s)
+	if err != nil {
+		panic(err)
+	}
+	return o
 }
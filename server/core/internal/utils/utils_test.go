@@ -2,64 +2,135 @@ package utils
 
 import "testing"
 
-func Test_mustParseInt(t *testing.T) {
-	type args struct {
-		s string
-	}
+func TestParseInt(t *testing.T) {
 	tests := []struct {
-		name string
-		args args
-		want int
+		name    string
+		s       string
+		want    int
+		wantErr bool
 	}{
 		{
 			name: "happy path",
-			args: args{"10"},
+			s:    "10",
 			want: 10,
 		},
 		{
-			name: "unhappy path",
-			args: args{"foo"},
+			name: "empty string",
+			s:    "",
 			want: 0,
 		},
+		{
+			name:    "unhappy path",
+			s:       "foo",
+			wantErr: true,
+		},
+		{
+			name:    "float",
+			s:       "1.5",
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(
 			tt.name, func(t *testing.T) {
-				if got := MustParseInt(tt.args.s); got != tt.want {
-					t.Errorf("MustParseInt() = %v, want %v", got, tt.want)
+				got, err := ParseInt(tt.s)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("ParseInt() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if got != tt.want {
+					t.Errorf("ParseInt() = %v, want %v", got, tt.want)
 				}
 			},
 		)
 	}
 }
 
-func Test_mustParseFloat32(t *testing.T) {
-	type args struct {
-		s string
-	}
+func Test_mustParseInt(t *testing.T) {
+	t.Run(
+		"happy path", func(t *testing.T) {
+			if got := MustParseInt("10"); got != 10 {
+				t.Errorf("MustParseInt() = %v, want %v", got, 10)
+			}
+		},
+	)
+
+	t.Run(
+		"unhappy path", func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("panic is expected for malformed integer")
+				}
+			}()
+			_ = MustParseInt("foo")
+		},
+	)
+}
+
+func TestParseFloat32(t *testing.T) {
 	tests := []struct {
-		name string
-		args args
-		want float32
+		name    string
+		s       string
+		want    float32
+		wantErr bool
 	}{
 		{
 			name: "happy path",
-			args: args{"0.2"},
+			s:    "0.2",
 			want: 0.2,
 		},
 		{
-			name: "unhappy path",
-			args: args{"foo"},
+			name: "temperature",
+			s:    "0.5",
+			want: 0.5,
+		},
+		{
+			name: "empty string",
+			s:    "",
 			want: 0,
 		},
+		{
+			name:    "unhappy path",
+			s:       "foo",
+			wantErr: true,
+		},
+		{
+			name:    "out of float32 range",
+			s:       "1e39",
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(
 			tt.name, func(t *testing.T) {
-				if got := MustParseFloat32(tt.args.s); got != tt.want {
-					t.Errorf("MustParseFloat32() = %v, want %v", got, tt.want)
+				got, err := ParseFloat32(tt.s)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("ParseFloat32() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if got != tt.want {
+					t.Errorf("ParseFloat32() = %v, want %v", got, tt.want)
 				}
 			},
 		)
 	}
 }
+
+func Test_mustParseFloat32(t *testing.T) {
+	t.Run(
+		"happy path", func(t *testing.T) {
+			if got := MustParseFloat32("0.5"); got != 0.5 {
+				t.Errorf("MustParseFloat32() = %v, want %v", got, 0.5)
+			}
+		},
+	)
+
+	t.Run(
+		"unhappy path", func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("panic is expected for malformed float")
+				}
+			}()
+			_ = MustParseFloat32("foo")
+		},
+	)
+}
@@ -0,0 +1,257 @@
+// Package logger defines the leveled structured logger which redacts the sensitive fields.
+package logger
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// Level defines the logs' verbosity.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// ParseLevel parses the level's name, e.g. "debug". The empty name defines the default level info.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, errors.New("unknown log level " + s)
+	}
+}
+
+// Fields defines the structured context of the log record.
+type Fields map[string]interface{}
+
+// Logger defines the leveled logger.
+type Logger interface {
+	Debug(msg string, fields Fields)
+	Info(msg string, fields Fields)
+	Warn(msg string, fields Fields)
+	Error(msg string, fields Fields)
+}
+
+// redacted replaces the values of the sensitive fields.
+const redacted = "[REDACTED]"
+
+// sensitiveKeys the keys' segments which values shall never be logged, e.g. the key access_token
+// contains the segment token. The key of several segments, e.g. api_key, matches the consecutive segments.
+var sensitiveKeys = []string{"prompt", "token", "secret", "password", "authorization", "api_key", "apikey"}
+
+// quantityKeys the keys' segments which values are the quantities, e.g. the key usage_tokens_prompt defines
+// the number of the prompt's tokens, hence the value is not sensitive.
+var quantityKeys = []string{"usage", "count", "length", "size"}
+
+// Redact returns the copy of the fields with the values of the sensitive fields replaced,
+// e.g. the user's prompt, the access token, or the one-time secret. The keys are matched case-insensitively
+// by their segments split by the non-alphanumeric characters and the camel case, e.g. accessToken.
+func Redact(fields Fields) Fields {
+	if fields == nil {
+		return nil
+	}
+	o := make(Fields, len(fields))
+	for k, v := range fields {
+		o[k] = v
+		if isSensitive(k) {
+			o[k] = redacted
+		}
+	}
+	return o
+}
+
+func isSensitive(key string) bool {
+	segments := keySegments(key)
+	for _, s := range quantityKeys {
+		if containsSegments(segments, []string{s}) {
+			return false
+		}
+	}
+	for _, s := range sensitiveKeys {
+		if containsSegments(segments, keySegments(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// keySegments splits the key into the lower case segments, e.g. "X-API-Key" and "xApiKey" to "x", "api", "key".
+func keySegments(key string) []string {
+	var (
+		o    []string
+		cur  strings.Builder
+		prev rune
+	)
+	for _, r := range key {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			o = appendSegment(o, &cur)
+		case unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)):
+			o = appendSegment(o, &cur)
+			cur.WriteRune(unicode.ToLower(r))
+		default:
+			cur.WriteRune(unicode.ToLower(r))
+		}
+		prev = r
+	}
+	return appendSegment(o, &cur)
+}
+
+func appendSegment(segments []string, cur *strings.Builder) []string {
+	if cur.Len() > 0 {
+		segments = append(segments, cur.String())
+		cur.Reset()
+	}
+	return segments
+}
+
+// containsSegments checks if the segments contain the sub-segments in a row.
+func containsSegments(segments, sub []string) bool {
+	for i := 0; i+len(sub) <= len(segments); i++ {
+		found := true
+		for j, s := range sub {
+			if segments[i+j] != s {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// NewJSONLogger initialises the Logger which writes the records of the level and above to w as JSON lines,
+// e.g. {"level":"info","msg":"foo","time":"2023-05-01T00:00:00Z","user_id":"bar"}.
+// The sensitive fields are redacted at all levels, see Redact.
+func NewJSONLogger(w io.Writer, level Level) Logger {
+	return &jsonLogger{w: w, level: level, now: time.Now}
+}
+
+type jsonLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+	now   func() time.Time
+}
+
+func (l *jsonLogger) Debug(msg string, fields Fields) {
+	l.log(LevelDebug, msg, fields)
+}
+
+func (l *jsonLogger) Info(msg string, fields Fields) {
+	l.log(LevelInfo, msg, fields)
+}
+
+func (l *jsonLogger) Warn(msg string, fields Fields) {
+	l.log(LevelWarn, msg, fields)
+}
+
+func (l *jsonLogger) Error(msg string, fields Fields) {
+	l.log(LevelError, msg, fields)
+}
+
+func (l *jsonLogger) log(level Level, msg string, fields Fields) {
+	if level < l.level {
+		return
+	}
+
+	record := Redact(fields)
+	if record == nil {
+		record = Fields{}
+	}
+	for k, v := range record {
+		if err, ok := v.(error); ok {
+			record[k] = err.Error()
+		}
+	}
+	record["level"] = level.String()
+	record["msg"] = msg
+	record["time"] = l.now().UTC().Format(time.RFC3339Nano)
+
+	o, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(append(o, '\n'))
+}
+
+// NewNoopLogger initialises the Logger which discards the records.
+func NewNoopLogger() Logger {
+	return noopLogger{}
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Debug(string, Fields) {}
+func (noopLogger) Info(string, Fields)  {}
+func (noopLogger) Warn(string, Fields)  {}
+func (noopLogger) Error(string, Fields) {}
+
+// MockLogger records the logs in memory.
+type MockLogger struct {
+	mu      sync.Mutex
+	Records []MockRecord
+}
+
+// MockRecord defines the record of MockLogger.
+type MockRecord struct {
+	Level  Level
+	Msg    string
+	Fields Fields
+}
+
+func (m *MockLogger) Debug(msg string, fields Fields) {
+	m.log(LevelDebug, msg, fields)
+}
+
+func (m *MockLogger) Info(msg string, fields Fields) {
+	m.log(LevelInfo, msg, fields)
+}
+
+func (m *MockLogger) Warn(msg string, fields Fields) {
+	m.log(LevelWarn, msg, fields)
+}
+
+func (m *MockLogger) Error(msg string, fields Fields) {
+	m.log(LevelError, msg, fields)
+}
+
+func (m *MockLogger) log(level Level, msg string, fields Fields) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Records = append(m.Records, MockRecord{Level: level, Msg: msg, Fields: fields})
+}
@@ -0,0 +1,138 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Level
+		wantErr bool
+	}{
+		{in: "debug", want: LevelDebug},
+		{in: "INFO", want: LevelInfo},
+		{in: "", want: LevelInfo},
+		{in: "warning", want: LevelWarn},
+		{in: "error", want: LevelError},
+		{in: "foo", want: LevelInfo, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.in, func(t *testing.T) {
+				got, err := ParseLevel(tt.in)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("ParseLevel() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if got != tt.want {
+					t.Errorf("ParseLevel() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	// GIVEN
+	fields := Fields{
+		"prompt":                   "c4 diagram of my secret project",
+		"access_token":             "foo",
+		"API_KEY":                  "bar",
+		"secret":                   "qux",
+		"user_id":                  "quux",
+		"refreshToken":             "foo",
+		"X-Api-Key":                "bar",
+		"usage_tokens_prompt":      10,
+		"usage_tokens_completions": 20,
+		"tokens":                   30,
+		"prompt_length":            40,
+	}
+
+	// WHEN
+	got := Redact(fields)
+
+	// THEN
+	want := Fields{
+		"prompt":                   redacted,
+		"access_token":             redacted,
+		"API_KEY":                  redacted,
+		"secret":                   redacted,
+		"user_id":                  "quux",
+		"refreshToken":             redacted,
+		"X-Api-Key":                redacted,
+		"usage_tokens_prompt":      10,
+		"usage_tokens_completions": 20,
+		"tokens":                   30,
+		"prompt_length":            40,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Redact() got = %v, want = %v", got, want)
+	}
+	if fields["prompt"] == redacted {
+		t.Error("the input fields shall not be mutated")
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	newLogger := func(level Level) (*jsonLogger, *bytes.Buffer) {
+		var buf bytes.Buffer
+		l := NewJSONLogger(&buf, level).(*jsonLogger)
+		l.now = func() time.Time { return time.Unix(0, 0) }
+		return l, &buf
+	}
+
+	t.Run(
+		"shall write the records of the level and above", func(t *testing.T) {
+			// GIVEN
+			l, buf := newLogger(LevelInfo)
+
+			// WHEN
+			l.Debug("foo", nil)
+			l.Info("bar", Fields{"duration_ms": 10})
+			l.Error("qux", Fields{"error": errors.New("quux")})
+
+			// THEN
+			want := `{"duration_ms":10,"level":"info","msg":"bar","time":"1970-01-01T00:00:00Z"}` + "\n" +
+				`{"error":"quux","level":"error","msg":"qux","time":"1970-01-01T00:00:00Z"}` + "\n"
+			if buf.String() != want {
+				t.Errorf("unexpected logs: got = %s, want = %s", buf.String(), want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall redact the sensitive fields at all levels", func(t *testing.T) {
+			// GIVEN
+			l, buf := newLogger(LevelDebug)
+
+			// WHEN
+			for _, fn := range []func(string, Fields){l.Debug, l.Info, l.Warn, l.Error} {
+				fn("foo", Fields{"prompt": "my prompt", "token": "my token", "user_id": "bar"})
+			}
+
+			// THEN
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) != 4 {
+				t.Fatalf("unexpected number of records: %d", len(lines))
+			}
+			for _, line := range lines {
+				if strings.Contains(line, "my prompt") || strings.Contains(line, "my token") {
+					t.Errorf("sensitive fields shall be redacted, got: %s", line)
+				}
+				var record map[string]interface{}
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatal(err)
+				}
+				if record["user_id"] != "bar" || record["prompt"] != redacted {
+					t.Errorf("unexpected record: %s", line)
+				}
+			}
+		},
+	)
+}
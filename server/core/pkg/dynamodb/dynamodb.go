@@ -0,0 +1,561 @@
+// Package dynamodb defines the client to persist users' data in AWS DynamoDB following the single-table design.
+//
+// The table is expected to have the string partition key "pk", the string sort key "sk",
+// and the time to live attribute "ttl" enabled. The items are keyed as follows (pk / sk):
+//   - user: user#{user_id} / profile
+//   - one-time secret: user#{user_id} / secret
+//   - successful request: user#{user_id} / request#{timestamp}#{request_id}
+//   - email lookup: email#{email} / lookup, it refers to the first user registered with the email
+//   - fingerprint lookup: fingerprint#{fingerprint} / lookup, it refers to the first user registered
+//     with the fingerprint
+//   - API token: token#{token} / token, see Client.CreateAPIToken
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Config configuration of the DynamoDB Client.
+type Config struct {
+	Region    string `json:"region"`
+	TableName string `json:"table_name"`
+	// Endpoint custom endpoint, e.g. the address of DynamoDB local.
+	Endpoint string `json:"endpoint,omitempty"`
+	// OneTimeSecretTTL defines the time to live of the one-time secrets.
+	OneTimeSecretTTL time.Duration `json:"-"`
+}
+
+func (cfg Config) Validate() error {
+	if cfg.Region == "" {
+		return errors.New("region must be provided")
+	}
+	if cfg.TableName == "" {
+		return errors.New("table_name must be provided")
+	}
+	if cfg.OneTimeSecretTTL < 0 {
+		return errors.New("one-time secret's TTL must be positive")
+	}
+	return nil
+}
+
+const defaultOneTimeSecretTTL = 10 * time.Minute
+
+// NewDynamoDBClient initiates the DynamoDB Client.
+func NewDynamoDBClient(ctx context.Context, cfg Config) (*Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	awsCfg, err := awsConfig.LoadDefaultConfig(ctx, awsConfig.WithRegion(cfg.Region))
+	if err != nil {
+		return nil, err
+	}
+
+	var fnOps []func(*dynamodb.Options)
+	if cfg.Endpoint != "" {
+		fnOps = append(fnOps, dynamodb.WithEndpointResolver(dynamodb.EndpointResolverFromURL(cfg.Endpoint)))
+	}
+
+	return newClient(dynamodb.NewFromConfig(awsCfg, fnOps...), cfg), nil
+}
+
+func newClient(c dbClient, cfg Config) *Client {
+	ttl := cfg.OneTimeSecretTTL
+	if ttl == 0 {
+		ttl = defaultOneTimeSecretTTL
+	}
+	return &Client{
+		c:                c,
+		table:            aws.String(cfg.TableName),
+		oneTimeSecretTTL: ttl,
+	}
+}
+
+// Client defines the DynamoDB client object.
+type Client struct {
+	c                dbClient
+	table            *string
+	oneTimeSecretTTL time.Duration
+}
+
+const (
+	attrPK          = "pk"
+	attrSK          = "sk"
+	attrTTL         = "ttl"
+	attrUserID      = "user_id"
+	attrEmail       = "email"
+	attrFingerprint = "fingerprint"
+	attrIsActive    = "is_active"
+	attrRole        = "role"
+	attrSecret      = "secret"
+	attrToken       = "token"
+	attrCreatedAt   = "created_at"
+
+	prefixUser        = "user#"
+	prefixEmail       = "email#"
+	prefixFingerprint = "fingerprint#"
+	prefixToken       = "token#"
+	prefixRequest     = "request#"
+
+	skProfile = "profile"
+	skSecret  = "secret"
+	skLookup  = "lookup"
+	skToken   = "token"
+
+	// timestampLayout defines the fixed width layout to keep lexicographical order of the sort keys.
+	timestampLayout = "2006-01-02T15:04:05.000000000Z"
+)
+
+func key(pk, sk string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		attrPK: &types.AttributeValueMemberS{Value: pk},
+		attrSK: &types.AttributeValueMemberS{Value: sk},
+	}
+}
+
+func item(pk, sk string, attrs map[string]types.AttributeValue) map[string]types.AttributeValue {
+	o := key(pk, sk)
+	for k, v := range attrs {
+		o[k] = v
+	}
+	return o
+}
+
+func readString(item map[string]types.AttributeValue, attr string) string {
+	if v, ok := item[attr].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+func readBool(item map[string]types.AttributeValue, attr string) bool {
+	if v, ok := item[attr].(*types.AttributeValueMemberBOOL); ok {
+		return v.Value
+	}
+	return false
+}
+
+func readInt(item map[string]types.AttributeValue, attr string) (int64, error) {
+	v, ok := item[attr].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, errors.New(attr + " attribute is not a number")
+	}
+	return strconv.ParseInt(v.Value, 10, 64)
+}
+
+func numberAttr(v int64) *types.AttributeValueMemberN {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(v, 10)}
+}
+
+func (c Client) getItem(ctx context.Context, pk, sk string) (map[string]types.AttributeValue, error) {
+	o, err := c.c.GetItem(
+		ctx, &dynamodb.GetItemInput{
+			TableName:      c.table,
+			Key:            key(pk, sk),
+			ConsistentRead: aws.Bool(true),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return o.Item, nil
+}
+
+func (c Client) putLookup(prefix, value, userID string) types.TransactWriteItem {
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			TableName: c.table,
+			Item: item(
+				prefix+value, skLookup, map[string]types.AttributeValue{
+					attrUserID: &types.AttributeValueMemberS{Value: userID},
+				},
+			),
+			ConditionExpression: aws.String("attribute_not_exists(" + attrPK + ")"),
+		},
+	}
+}
+
+func (c Client) CreateUser(ctx context.Context, id, email, fingerprint string, isActive bool, role *uint8) error {
+	if id == "" {
+		return errors.New("id is required")
+	}
+	if role == nil {
+		return errors.New("role is required")
+	}
+
+	items := []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				TableName: c.table,
+				Item: item(
+					prefixUser+id, skProfile, map[string]types.AttributeValue{
+						attrEmail:       &types.AttributeValueMemberS{Value: email},
+						attrFingerprint: &types.AttributeValueMemberS{Value: fingerprint},
+						attrIsActive:    &types.AttributeValueMemberBOOL{Value: isActive},
+						attrRole:        numberAttr(int64(*role)),
+						attrCreatedAt:   &types.AttributeValueMemberS{Value: time.Now().UTC().Format(timestampLayout)},
+					},
+				),
+				ConditionExpression: aws.String("attribute_not_exists(" + attrPK + ")"),
+			},
+		},
+	}
+
+	// The first registered user with the given email/fingerprint will be found by lookup,
+	// i.e. the same user is found as by the postgres client.
+	if email != "" {
+		items = append(items, c.putLookup(prefixEmail, email, id))
+	}
+	if fingerprint != "" {
+		items = append(items, c.putLookup(prefixFingerprint, fingerprint, id))
+	}
+
+	_, err := c.c.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	var errCancelled *types.TransactionCanceledException
+	if !errors.As(err, &errCancelled) || len(errCancelled.CancellationReasons) != len(items) {
+		return err
+	}
+
+	// the existing lookups are kept, and the user is written without them
+	retry := items[:1]
+	for i, reason := range errCancelled.CancellationReasons {
+		isConditionFailed := aws.ToString(reason.Code) == "ConditionalCheckFailed"
+		switch {
+		case i == 0 && isConditionFailed:
+			return err
+		case i > 0 && !isConditionFailed:
+			retry = append(retry, items[i])
+		}
+	}
+	if len(retry) == len(items) {
+		return err
+	}
+	_, err = c.c.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: retry})
+	return err
+}
+
+func (c Client) ReadUser(ctx context.Context, id string) (
+	found, isActive bool, role uint8, email, fingerprint string, err error,
+) {
+	if id == "" {
+		err = errors.New("id is required")
+		return
+	}
+
+	v, err := c.getItem(ctx, prefixUser+id, skProfile)
+	if err != nil || v == nil {
+		return
+	}
+
+	r, err := readInt(v, attrRole)
+	if err != nil {
+		return false, false, 0, "", "", err
+	}
+
+	return true, readBool(v, attrIsActive), uint8(r), readString(v, attrEmail), readString(v, attrFingerprint), nil
+}
+
+func (c Client) lookupUser(ctx context.Context, pk string) (id string, isActive bool, err error) {
+	v, err := c.getItem(ctx, pk, skLookup)
+	if err != nil || v == nil {
+		return
+	}
+
+	id = readString(v, attrUserID)
+
+	var found bool
+	found, isActive, _, _, _, err = c.ReadUser(ctx, id)
+	if err != nil || !found {
+		return "", false, err
+	}
+	return
+}
+
+func (c Client) LookupUserByEmail(ctx context.Context, email string) (id string, isActive bool, err error) {
+	if email == "" {
+		err = errors.New("email is required")
+		return
+	}
+	return c.lookupUser(ctx, prefixEmail+email)
+}
+
+func (c Client) LookupUserByFingerprint(ctx context.Context, fingerprint string) (id string, isActive bool, err error) {
+	if fingerprint == "" {
+		err = errors.New("fingerprint is required")
+		return
+	}
+	return c.lookupUser(ctx, prefixFingerprint+fingerprint)
+}
+
+func (c Client) UpdateUserSetActive(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("id is required")
+	}
+	_, err := c.c.UpdateItem(
+		ctx, &dynamodb.UpdateItemInput{
+			TableName:           c.table,
+			Key:                 key(prefixUser+id, skProfile),
+			UpdateExpression:    aws.String("SET " + attrIsActive + " = :" + attrIsActive),
+			ConditionExpression: aws.String("attribute_exists(" + attrPK + ")"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":" + attrIsActive: &types.AttributeValueMemberBOOL{Value: true},
+			},
+		},
+	)
+	return err
+}
+
+// WriteOneTimeSecret writes the secret which expires after the configured TTL.
+// Note that expired items are removed by DynamoDB asynchronously.
+func (c Client) WriteOneTimeSecret(ctx context.Context, userID, secret string, createdAt time.Time) error {
+	if userID == "" {
+		return errors.New("userID is required")
+	}
+	if secret == "" {
+		return errors.New("secret is required")
+	}
+	if createdAt.IsZero() {
+		return errors.New("createdAt is required")
+	}
+	_, err := c.c.PutItem(
+		ctx, &dynamodb.PutItemInput{
+			TableName: c.table,
+			Item: item(
+				prefixUser+userID, skSecret, map[string]types.AttributeValue{
+					attrSecret:    &types.AttributeValueMemberS{Value: secret},
+					attrCreatedAt: &types.AttributeValueMemberS{Value: createdAt.UTC().Format(timestampLayout)},
+					attrTTL:       numberAttr(createdAt.Add(c.oneTimeSecretTTL).Unix()),
+				},
+			),
+		},
+	)
+	return err
+}
+
+// ReadOneTimeSecret reads the secret. The expired secret is treated as not found
+// because DynamoDB deletes expired items with a delay which can reach several hours.
+func (c Client) ReadOneTimeSecret(ctx context.Context, userID string) (
+	found bool, secret string, issuedAt time.Time, err error,
+) {
+	if userID == "" {
+		err = errors.New("userID is required")
+		return
+	}
+
+	v, err := c.getItem(ctx, prefixUser+userID, skSecret)
+	if err != nil || v == nil {
+		return
+	}
+
+	exp, err := readInt(v, attrTTL)
+	if err != nil {
+		return false, "", time.Time{}, err
+	}
+	if exp <= time.Now().Unix() {
+		return false, "", time.Time{}, nil
+	}
+
+	issuedAt, err = time.Parse(timestampLayout, readString(v, attrCreatedAt))
+	if err != nil {
+		return false, "", time.Time{}, err
+	}
+
+	return true, readString(v, attrSecret), issuedAt, nil
+}
+
+func (c Client) DeleteOneTimeSecret(ctx context.Context, userID string) error {
+	if userID == "" {
+		return errors.New("userID is required")
+	}
+	_, err := c.c.DeleteItem(
+		ctx, &dynamodb.DeleteItemInput{
+			TableName: c.table,
+			Key:       key(prefixUser+userID, skSecret),
+		},
+	)
+	return err
+}
+
+// DeleteExpiredSecrets deletes the expired one-time secrets which have not been removed by DynamoDB yet.
+func (c Client) DeleteExpiredSecrets(ctx context.Context) error {
+	p := dynamodb.NewScanPaginator(
+		c.c, &dynamodb.ScanInput{
+			TableName:                c.table,
+			FilterExpression:         aws.String("#sk = :sk AND #ttl <= :now"),
+			ProjectionExpression:     aws.String("#pk, #sk"),
+			ExpressionAttributeNames: map[string]string{"#pk": attrPK, "#sk": attrSK, "#ttl": attrTTL},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":sk":  &types.AttributeValueMemberS{Value: skSecret},
+				":now": numberAttr(time.Now().Unix()),
+			},
+		},
+	)
+
+	for p.HasMorePages() {
+		o, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, v := range o.Items {
+			if _, err := c.c.DeleteItem(
+				ctx, &dynamodb.DeleteItemInput{
+					TableName: c.table,
+					Key:       key(readString(v, attrPK), readString(v, attrSK)),
+				},
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteSuccessFlag records the successful request to account for the user's quotas.
+func (c Client) WriteSuccessFlag(ctx context.Context, requestID, userID, token string) error {
+	if requestID == "" {
+		return errors.New("request_id is required")
+	}
+	if userID == "" {
+		return errors.New("user_id is required")
+	}
+
+	attrs := map[string]types.AttributeValue{}
+	if token != "" {
+		attrs[attrToken] = &types.AttributeValueMemberS{Value: token}
+	}
+
+	_, err := c.c.PutItem(
+		ctx, &dynamodb.PutItemInput{
+			TableName: c.table,
+			Item: item(
+				prefixUser+userID, prefixRequest+time.Now().UTC().Format(timestampLayout)+"#"+requestID, attrs,
+			),
+		},
+	)
+	return err
+}
+
+func (c Client) GetDailySuccessfulResultsTimestampsByUserID(ctx context.Context, userID string) ([]time.Time, error) {
+	now := time.Now().UTC()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	o, err := c.c.Query(
+		ctx, &dynamodb.QueryInput{
+			TableName:              c.table,
+			KeyConditionExpression: aws.String(attrPK + " = :pk AND " + attrSK + " BETWEEN :from AND :to"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":   &types.AttributeValueMemberS{Value: prefixUser + userID},
+				":from": &types.AttributeValueMemberS{Value: prefixRequest + dayStart.Format(timestampLayout)},
+				":to": &types.AttributeValueMemberS{
+					Value: prefixRequest + dayStart.Add(24*time.Hour).Format(timestampLayout),
+				},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var ts []time.Time
+	for _, v := range o.Items {
+		s := strings.TrimPrefix(readString(v, attrSK), prefixRequest)
+		t, err := time.Parse(timestampLayout, strings.SplitN(s, "#", 2)[0])
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// CreateAPIToken issues the active API token of the user, the existing token is not overwritten.
+func (c Client) CreateAPIToken(ctx context.Context, userID, token string) error {
+	if userID == "" {
+		return errors.New("userID is required")
+	}
+	if token == "" {
+		return errors.New("token is required")
+	}
+	_, err := c.c.PutItem(
+		ctx, &dynamodb.PutItemInput{
+			TableName: c.table,
+			Item: item(
+				prefixToken+token, skToken, map[string]types.AttributeValue{
+					attrUserID:    &types.AttributeValueMemberS{Value: userID},
+					attrIsActive:  &types.AttributeValueMemberBOOL{Value: true},
+					attrCreatedAt: &types.AttributeValueMemberS{Value: time.Now().UTC().Format(timestampLayout)},
+				},
+			),
+			ConditionExpression: aws.String("attribute_not_exists(" + attrPK + ")"),
+		},
+	)
+	return err
+}
+
+// UpdateAPITokenSetInactive revokes the API token.
+func (c Client) UpdateAPITokenSetInactive(ctx context.Context, token string) error {
+	if token == "" {
+		return errors.New("token is required")
+	}
+	_, err := c.c.UpdateItem(
+		ctx, &dynamodb.UpdateItemInput{
+			TableName:           c.table,
+			Key:                 key(prefixToken+token, skToken),
+			UpdateExpression:    aws.String("SET " + attrIsActive + " = :" + attrIsActive),
+			ConditionExpression: aws.String("attribute_exists(" + attrPK + ")"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":" + attrIsActive: &types.AttributeValueMemberBOOL{Value: false},
+			},
+		},
+	)
+	return err
+}
+
+// GetActiveUserIDByActiveTokenID reads the ID of the active user given the active token, see CreateAPIToken.
+func (c Client) GetActiveUserIDByActiveTokenID(ctx context.Context, token string) (string, error) {
+	v, err := c.getItem(ctx, prefixToken+token, skToken)
+	if err != nil || v == nil || !readBool(v, attrIsActive) {
+		return "", err
+	}
+
+	userID := readString(v, attrUserID)
+	found, isActive, _, _, _, err := c.ReadUser(ctx, userID)
+	if err != nil || !found || !isActive {
+		return "", err
+	}
+	return userID, nil
+}
+
+type dbClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (
+		*dynamodb.GetItemOutput, error,
+	)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (
+		*dynamodb.PutItemOutput, error,
+	)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (
+		*dynamodb.UpdateItemOutput, error,
+	)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (
+		*dynamodb.DeleteItemOutput, error,
+	)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (
+		*dynamodb.QueryOutput, error,
+	)
+	TransactWriteItems(
+		ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options),
+	) (*dynamodb.TransactWriteItemsOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (
+		*dynamodb.ScanOutput, error,
+	)
+}
@@ -0,0 +1,473 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{
+			name: "valid",
+			cfg: Config{
+				Region:    "us-east-1",
+				TableName: "ciam",
+			},
+		},
+		{
+			name: "invalid: region is missing",
+			cfg: Config{
+				TableName: "ciam",
+			},
+			wantErr: errors.New("region must be provided"),
+		},
+		{
+			name: "invalid: table name is missing",
+			cfg: Config{
+				Region: "us-east-1",
+			},
+			wantErr: errors.New("table_name must be provided"),
+		},
+		{
+			name: "invalid: negative TTL",
+			cfg: Config{
+				Region:           "us-east-1",
+				TableName:        "ciam",
+				OneTimeSecretTTL: -1 * time.Minute,
+			},
+			wantErr: errors.New("one-time secret's TTL must be positive"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if err := tt.cfg.Validate(); !reflect.DeepEqual(err, tt.wantErr) {
+					t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+func TestNewDynamoDBClient(t *testing.T) {
+	t.Run(
+		"happy path", func(t *testing.T) {
+			c, err := NewDynamoDBClient(
+				context.TODO(), Config{Region: "us-east-1", TableName: "ciam", Endpoint: "http://localhost:8000"},
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *c.table != "ciam" {
+				t.Errorf("unexpected table name: %s", *c.table)
+			}
+			if c.oneTimeSecretTTL != defaultOneTimeSecretTTL {
+				t.Errorf("default TTL is expected to be set")
+			}
+		},
+	)
+
+	t.Run(
+		"unhappy path: invalid config", func(t *testing.T) {
+			if _, err := NewDynamoDBClient(context.TODO(), Config{}); err == nil {
+				t.Errorf("error expected")
+			}
+		},
+	)
+}
+
+func TestClient_Users(t *testing.T) {
+	const (
+		userID      = "ccb42cbf-92c5-4069-bd01-ae25d49d9727"
+		email       = "foo@bar.baz"
+		fingerprint = "c2a3b8c8e5e6b8f1c1d4b5a6c7d8e9f0a1b2c3d4"
+	)
+	role := uint8(1)
+
+	c := newClient(&mockDbClient{}, Config{TableName: "ciam"})
+
+	if err := c.CreateUser(context.TODO(), userID, email, fingerprint, false, &role); err != nil {
+		t.Fatalf("CreateUser() unexpected error: %v", err)
+	}
+
+	if err := c.CreateUser(context.TODO(), userID, email, fingerprint, false, &role); err == nil {
+		t.Errorf("CreateUser() error expected when the user exists")
+	}
+
+	found, isActive, gotRole, gotEmail, gotFingerprint, err := c.ReadUser(context.TODO(), userID)
+	if err != nil {
+		t.Fatalf("ReadUser() unexpected error: %v", err)
+	}
+	if !found || isActive || gotRole != role || gotEmail != email || gotFingerprint != fingerprint {
+		t.Errorf(
+			"ReadUser() unexpected result: %v, %v, %v, %v, %v", found, isActive, gotRole, gotEmail, gotFingerprint,
+		)
+	}
+
+	if err := c.UpdateUserSetActive(context.TODO(), userID); err != nil {
+		t.Fatalf("UpdateUserSetActive() unexpected error: %v", err)
+	}
+
+	id, isActive, err := c.LookupUserByEmail(context.TODO(), email)
+	if err != nil || id != userID || !isActive {
+		t.Errorf("LookupUserByEmail() unexpected result: %v, %v, %v", id, isActive, err)
+	}
+
+	id, isActive, err = c.LookupUserByFingerprint(context.TODO(), fingerprint)
+	if err != nil || id != userID || !isActive {
+		t.Errorf("LookupUserByFingerprint() unexpected result: %v, %v, %v", id, isActive, err)
+	}
+
+	id, isActive, err = c.LookupUserByEmail(context.TODO(), "qux@bar.baz")
+	if err != nil || id != "" || isActive {
+		t.Errorf("LookupUserByEmail() unexpected result for unknown user: %v, %v, %v", id, isActive, err)
+	}
+
+	found, _, _, _, _, err = c.ReadUser(context.TODO(), "unknown")
+	if err != nil || found {
+		t.Errorf("ReadUser() unexpected result for unknown user: %v, %v", found, err)
+	}
+
+	if err := c.UpdateUserSetActive(context.TODO(), "unknown"); err == nil {
+		t.Errorf("UpdateUserSetActive() error expected for unknown user")
+	}
+}
+
+func TestClient_CreateUserKeepsFirstLookup(t *testing.T) {
+	const (
+		firstUserID  = "ccb42cbf-92c5-4069-bd01-ae25d49d9727"
+		secondUserID = "5b1c3b8e-3a0d-4a1e-9e0c-3b7f2d6c9a41"
+		email        = "foo@bar.baz"
+		fingerprint  = "c2a3b8c8e5e6b8f1c1d4b5a6c7d8e9f0a1b2c3d4"
+		// secondFingerprint the fingerprint of the second user only
+		secondFingerprint = "d4c3b2a1f0e9d8c7b6a5d4c1f1b8e6e5c8b3a2c2"
+	)
+	role := uint8(1)
+	c := newClient(&mockDbClient{}, Config{TableName: "ciam"})
+
+	// GIVEN
+	if err := c.CreateUser(context.TODO(), firstUserID, email, fingerprint, true, &role); err != nil {
+		t.Fatal(err)
+	}
+
+	// WHEN
+	err := c.CreateUser(context.TODO(), secondUserID, email, secondFingerprint, true, &role)
+
+	// THEN
+	if err != nil {
+		t.Fatalf("CreateUser() unexpected error: %v", err)
+	}
+	if found, _, _, _, _, err := c.ReadUser(context.TODO(), secondUserID); err != nil || !found {
+		t.Errorf("the second user shall be created, got: %v, %v", found, err)
+	}
+	if id, _, err := c.LookupUserByEmail(context.TODO(), email); err != nil || id != firstUserID {
+		t.Errorf("LookupUserByEmail() shall find the first user, got: %v, %v", id, err)
+	}
+	if id, _, err := c.LookupUserByFingerprint(context.TODO(), fingerprint); err != nil || id != firstUserID {
+		t.Errorf("LookupUserByFingerprint() shall find the first user, got: %v, %v", id, err)
+	}
+	if id, _, err := c.LookupUserByFingerprint(context.TODO(), secondFingerprint); err != nil || id != secondUserID {
+		t.Errorf("LookupUserByFingerprint() shall find the second user by its fingerprint, got: %v, %v", id, err)
+	}
+}
+
+func TestClient_OneTimeSecret(t *testing.T) {
+	const userID = "ccb42cbf-92c5-4069-bd01-ae25d49d9727"
+
+	type args struct {
+		secret    string
+		createdAt time.Time
+	}
+	tests := []struct {
+		name       string
+		args       args
+		wantFound  bool
+		wantSecret string
+	}{
+		{
+			name: "fresh secret",
+			args: args{
+				secret:    "123456",
+				createdAt: time.Now().UTC().Add(-1 * time.Minute),
+			},
+			wantFound:  true,
+			wantSecret: "123456",
+		},
+		{
+			name: "expired secret",
+			args: args{
+				secret:    "123456",
+				createdAt: time.Now().UTC().Add(-11 * time.Minute),
+			},
+			wantFound: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := newClient(&mockDbClient{}, Config{TableName: "ciam", OneTimeSecretTTL: 10 * time.Minute})
+
+				if err := c.WriteOneTimeSecret(context.TODO(), userID, tt.args.secret, tt.args.createdAt); err != nil {
+					t.Fatalf("WriteOneTimeSecret() unexpected error: %v", err)
+				}
+
+				found, secret, issuedAt, err := c.ReadOneTimeSecret(context.TODO(), userID)
+				if err != nil {
+					t.Fatalf("ReadOneTimeSecret() unexpected error: %v", err)
+				}
+				if found != tt.wantFound {
+					t.Errorf("ReadOneTimeSecret() found = %v, want %v", found, tt.wantFound)
+				}
+				if secret != tt.wantSecret {
+					t.Errorf("ReadOneTimeSecret() secret = %v, want %v", secret, tt.wantSecret)
+				}
+				if found && !issuedAt.Equal(tt.args.createdAt) {
+					t.Errorf("ReadOneTimeSecret() issuedAt = %v, want %v", issuedAt, tt.args.createdAt)
+				}
+
+				if err := c.DeleteOneTimeSecret(context.TODO(), userID); err != nil {
+					t.Fatalf("DeleteOneTimeSecret() unexpected error: %v", err)
+				}
+
+				if found, _, _, _ := c.ReadOneTimeSecret(context.TODO(), userID); found {
+					t.Errorf("ReadOneTimeSecret() secret is expected to be deleted")
+				}
+			},
+		)
+	}
+}
+
+func TestClient_WriteOneTimeSecretTTL(t *testing.T) {
+	const userID = "ccb42cbf-92c5-4069-bd01-ae25d49d9727"
+	createdAt := time.Now().UTC()
+
+	db := &mockDbClient{}
+	c := newClient(db, Config{TableName: "ciam", OneTimeSecretTTL: time.Minute})
+	if err := c.WriteOneTimeSecret(context.TODO(), userID, "123456", createdAt); err != nil {
+		t.Fatalf("WriteOneTimeSecret() unexpected error: %v", err)
+	}
+
+	got, err := readInt(db.items[prefixUser+userID+"|"+skSecret], attrTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := createdAt.Add(time.Minute).Unix(); got != want {
+		t.Errorf("unexpected ttl attribute value, want: %d, got: %d", want, got)
+	}
+}
+
+func TestClient_DeleteExpiredSecrets(t *testing.T) {
+	const (
+		userIDExpired = "ccb42cbf-92c5-4069-bd01-ae25d49d9727"
+		userIDFresh   = "47a87ca5-e00f-4075-af68-1ef2caba30ce"
+	)
+
+	db := &mockDbClient{}
+	c := newClient(db, Config{TableName: "ciam", OneTimeSecretTTL: 10 * time.Minute})
+
+	if err := c.WriteOneTimeSecret(
+		context.TODO(), userIDExpired, "foo", time.Now().UTC().Add(-11*time.Minute),
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteOneTimeSecret(context.TODO(), userIDFresh, "bar", time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.DeleteExpiredSecrets(context.TODO()); err != nil {
+		t.Fatalf("DeleteExpiredSecrets() unexpected error: %v", err)
+	}
+
+	if _, ok := db.items[prefixUser+userIDExpired+"|"+skSecret]; ok {
+		t.Errorf("DeleteExpiredSecrets() expired secret is expected to be deleted")
+	}
+
+	if found, secret, _, _ := c.ReadOneTimeSecret(context.TODO(), userIDFresh); !found || secret != "bar" {
+		t.Errorf("DeleteExpiredSecrets() fresh secret is expected to be kept")
+	}
+
+	if err := newClient(&mockDbClient{err: errors.New("foo")}, Config{}).DeleteExpiredSecrets(
+		context.TODO(),
+	); err == nil {
+		t.Errorf("DeleteExpiredSecrets() error expected")
+	}
+}
+
+func TestClient_SuccessfulRequests(t *testing.T) {
+	const userID = "ccb42cbf-92c5-4069-bd01-ae25d49d9727"
+
+	db := &mockDbClient{}
+	c := newClient(db, Config{TableName: "ciam"})
+
+	// yesterday's request shall not be counted
+	db.put(
+		item(
+			prefixUser+userID,
+			prefixRequest+time.Now().UTC().Add(-24*time.Hour).Format(timestampLayout)+"#foo",
+			nil,
+		),
+	)
+
+	for _, requestID := range []string{"bar", "baz"} {
+		if err := c.WriteSuccessFlag(context.TODO(), requestID, userID, ""); err != nil {
+			t.Fatalf("WriteSuccessFlag() unexpected error: %v", err)
+		}
+	}
+
+	got, err := c.GetDailySuccessfulResultsTimestampsByUserID(context.TODO(), userID)
+	if err != nil {
+		t.Fatalf("GetDailySuccessfulResultsTimestampsByUserID() unexpected error: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("GetDailySuccessfulResultsTimestampsByUserID() unexpected number of timestamps: %d", len(got))
+	}
+
+	if err := c.WriteSuccessFlag(context.TODO(), "", userID, ""); err == nil {
+		t.Errorf("WriteSuccessFlag() error expected when request_id is missing")
+	}
+}
+
+func TestClient_GetActiveUserIDByActiveTokenID(t *testing.T) {
+	const (
+		userID = "ccb42cbf-92c5-4069-bd01-ae25d49d9727"
+		token  = "d3d7ad4b-7c6f-4317-a99d-ae3067d01a4f"
+	)
+
+	tests := []struct {
+		name          string
+		tokenIsActive bool
+		userIsActive  bool
+		want          string
+	}{
+		{
+			name:          "active token and user",
+			tokenIsActive: true,
+			userIsActive:  true,
+			want:          userID,
+		},
+		{
+			name:          "inactive token",
+			tokenIsActive: false,
+			userIsActive:  true,
+		},
+		{
+			name:          "inactive user",
+			tokenIsActive: true,
+			userIsActive:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				db := &mockDbClient{}
+				db.put(
+					item(
+						prefixToken+token, skToken, map[string]types.AttributeValue{
+							attrUserID:   &types.AttributeValueMemberS{Value: userID},
+							attrIsActive: &types.AttributeValueMemberBOOL{Value: tt.tokenIsActive},
+						},
+					),
+				)
+				db.put(
+					item(
+						prefixUser+userID, skProfile, map[string]types.AttributeValue{
+							attrIsActive: &types.AttributeValueMemberBOOL{Value: tt.userIsActive},
+							attrRole:     numberAttr(1),
+						},
+					),
+				)
+
+				c := newClient(db, Config{TableName: "ciam"})
+				got, err := c.GetActiveUserIDByActiveTokenID(context.TODO(), token)
+				if err != nil {
+					t.Fatalf("GetActiveUserIDByActiveTokenID() unexpected error: %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("GetActiveUserIDByActiveTokenID() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestClient_APIToken(t *testing.T) {
+	const (
+		userID = "ccb42cbf-92c5-4069-bd01-ae25d49d9727"
+		token  = "d3d7ad4b-7c6f-4317-a99d-ae3067d01a4f"
+	)
+	role := uint8(1)
+	c := newClient(&mockDbClient{}, Config{TableName: "ciam"})
+	if err := c.CreateUser(context.TODO(), userID, "", "", true, &role); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.CreateAPIToken(context.TODO(), userID, token); err != nil {
+		t.Fatalf("CreateAPIToken() unexpected error: %v", err)
+	}
+	if err := c.CreateAPIToken(context.TODO(), "foo", token); err == nil {
+		t.Errorf("CreateAPIToken() error expected when the token exists")
+	}
+	if got, err := c.GetActiveUserIDByActiveTokenID(context.TODO(), token); err != nil || got != userID {
+		t.Errorf("GetActiveUserIDByActiveTokenID() unexpected result for the issued token: %v, %v", got, err)
+	}
+
+	if err := c.UpdateAPITokenSetInactive(context.TODO(), token); err != nil {
+		t.Fatalf("UpdateAPITokenSetInactive() unexpected error: %v", err)
+	}
+	if got, err := c.GetActiveUserIDByActiveTokenID(context.TODO(), token); err != nil || got != "" {
+		t.Errorf("GetActiveUserIDByActiveTokenID() unexpected result for the revoked token: %v, %v", got, err)
+	}
+
+	if err := c.UpdateAPITokenSetInactive(context.TODO(), "unknown"); err == nil {
+		t.Errorf("UpdateAPITokenSetInactive() error expected for unknown token")
+	}
+	if err := c.CreateAPIToken(context.TODO(), "", token); err == nil {
+		t.Errorf("CreateAPIToken() error expected when userID is missing")
+	}
+	if err := c.CreateAPIToken(context.TODO(), userID, ""); err == nil {
+		t.Errorf("CreateAPIToken() error expected when token is missing")
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	wantErr := errors.New("foobar")
+	c := newClient(&mockDbClient{err: wantErr}, Config{TableName: "ciam"})
+	role := uint8(0)
+
+	if err := c.CreateUser(context.TODO(), "foo", "", "bar", true, &role); !reflect.DeepEqual(err, wantErr) {
+		t.Errorf("CreateUser() unexpected error: %v", err)
+	}
+	if _, _, _, _, _, err := c.ReadUser(context.TODO(), "foo"); !reflect.DeepEqual(err, wantErr) {
+		t.Errorf("ReadUser() unexpected error: %v", err)
+	}
+	if _, _, err := c.LookupUserByFingerprint(context.TODO(), "foo"); !reflect.DeepEqual(err, wantErr) {
+		t.Errorf("LookupUserByFingerprint() unexpected error: %v", err)
+	}
+	if _, _, _, err := c.ReadOneTimeSecret(context.TODO(), "foo"); !reflect.DeepEqual(err, wantErr) {
+		t.Errorf("ReadOneTimeSecret() unexpected error: %v", err)
+	}
+	if _, err := c.GetDailySuccessfulResultsTimestampsByUserID(context.TODO(), "foo"); !reflect.DeepEqual(
+		err, wantErr,
+	) {
+		t.Errorf("GetDailySuccessfulResultsTimestampsByUserID() unexpected error: %v", err)
+	}
+	if err := c.CreateUser(context.TODO(), "", "", "bar", true, &role); err == nil {
+		t.Errorf("CreateUser() error expected when id is missing")
+	}
+	if err := c.CreateUser(context.TODO(), "foo", "", "bar", true, nil); err == nil {
+		t.Errorf("CreateUser() error expected when role is missing")
+	}
+	if err := c.WriteOneTimeSecret(context.TODO(), "foo", "bar", time.Time{}); err == nil {
+		t.Errorf("WriteOneTimeSecret() error expected when createdAt is missing")
+	}
+}
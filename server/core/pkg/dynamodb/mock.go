@@ -0,0 +1,166 @@
+package dynamodb
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// mockDbClient in-memory table mimicking the subset of the DynamoDB API used by the Client.
+type mockDbClient struct {
+	err   error
+	items map[string]map[string]types.AttributeValue
+	mu    sync.RWMutex
+}
+
+func mockItemID(k map[string]types.AttributeValue) string {
+	return readString(k, attrPK) + "|" + readString(k, attrSK)
+}
+
+func (m *mockDbClient) put(v map[string]types.AttributeValue) {
+	if m.items == nil {
+		m.items = map[string]map[string]types.AttributeValue{}
+	}
+	m.items[mockItemID(v)] = v
+}
+
+func (m *mockDbClient) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (
+	*dynamodb.GetItemOutput, error,
+) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return &dynamodb.GetItemOutput{Item: m.items[mockItemID(params.Key)]}, nil
+}
+
+func (m *mockDbClient) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (
+	*dynamodb.PutItemOutput, error,
+) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.items[mockItemID(params.Item)]; ok && params.ConditionExpression != nil {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	m.put(params.Item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+// UpdateItem sets the attributes named after the placeholders of the expression attribute values.
+func (m *mockDbClient) UpdateItem(
+	_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options),
+) (*dynamodb.UpdateItemOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.items[mockItemID(params.Key)]
+	if !ok {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	for k, attr := range params.ExpressionAttributeValues {
+		v[strings.TrimPrefix(k, ":")] = attr
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (m *mockDbClient) DeleteItem(
+	_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options),
+) (*dynamodb.DeleteItemOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, mockItemID(params.Key))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// Query selects the items by the partition key ":pk" and the sort key's range [":from", ":to"].
+func (m *mockDbClient) Query(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (
+	*dynamodb.QueryOutput, error,
+) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pk := readString(params.ExpressionAttributeValues, ":pk")
+	from := readString(params.ExpressionAttributeValues, ":from")
+	to := readString(params.ExpressionAttributeValues, ":to")
+
+	var o dynamodb.QueryOutput
+	for _, v := range m.items {
+		sk := readString(v, attrSK)
+		if readString(v, attrPK) == pk && sk >= from && sk <= to {
+			o.Items = append(o.Items, v)
+		}
+	}
+	return &o, nil
+}
+
+// Scan selects the items by the sort key ":sk" which expire before ":now".
+func (m *mockDbClient) Scan(_ context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (
+	*dynamodb.ScanOutput, error,
+) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sk := readString(params.ExpressionAttributeValues, ":sk")
+	now, err := readInt(params.ExpressionAttributeValues, ":now")
+	if err != nil {
+		return nil, err
+	}
+
+	var o dynamodb.ScanOutput
+	for _, v := range m.items {
+		if exp, err := readInt(v, attrTTL); err == nil && readString(v, attrSK) == sk && exp <= now {
+			o.Items = append(o.Items, key(readString(v, attrPK), sk))
+		}
+	}
+	return &o, nil
+}
+
+func (m *mockDbClient) TransactWriteItems(
+	_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options),
+) (*dynamodb.TransactWriteItemsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// the transaction is cancelled if any condition fails, the reasons are listed in the order of the items
+	var cancelled bool
+	reasons := make([]types.CancellationReason, len(params.TransactItems))
+	for i, el := range params.TransactItems {
+		reasons[i].Code = aws.String("None")
+		if el.Put != nil {
+			if _, ok := m.items[mockItemID(el.Put.Item)]; ok && el.Put.ConditionExpression != nil {
+				reasons[i].Code = aws.String("ConditionalCheckFailed")
+				cancelled = true
+			}
+		}
+	}
+	if cancelled {
+		return nil, &types.TransactionCanceledException{CancellationReasons: reasons}
+	}
+	for _, el := range params.TransactItems {
+		if el.Put != nil {
+			m.put(el.Put.Item)
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
@@ -1,8 +1,12 @@
 package httpclient
 
 import (
+	"errors"
+	"io"
 	"math/rand"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -30,6 +34,7 @@ type Config struct {
 
 // Backoff retry configuration.
 type Backoff struct {
+	// MaxIterations the maximum number of the request's attempts, including the first one.
 	MaxIterations             uint8
 	BackoffTimeMinMillisecond int
 	BackoffTimeMaxMillisecond int
@@ -43,25 +48,105 @@ type HTTPClient struct {
 	mu             *sync.RWMutex
 }
 
+// RetriableError the error of the request which failed after the attempts were exhausted.
+type RetriableError struct {
+	// Attempts the number of the request's attempts.
+	Attempts int
+	// LastStatus the status code of the last response, zero if the server has never responded.
+	LastStatus int
+	// LastBody the body of the last response, e.g. to decode the server's error, it is truncated
+	// to lastBodyLengthMax bytes.
+	LastBody []byte
+	// Err the error of the last attempt.
+	Err error
+}
+
+func (e *RetriableError) Error() string {
+	var o strings.Builder
+	_, _ = o.WriteString(e.Err.Error())
+	_, _ = o.WriteString(", attempts: ")
+	_, _ = o.WriteString(strconv.Itoa(e.Attempts))
+	_, _ = o.WriteString(", last status code: ")
+	_, _ = o.WriteString(strconv.Itoa(e.LastStatus))
+	return o.String()
+}
+
+func (e *RetriableError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns LastStatus, e.g. for the callers to check the status without importing the package.
+func (e *RetriableError) StatusCode() int {
+	return e.LastStatus
+}
+
+// ResponseBody returns LastBody, e.g. for the callers to decode the server's error without importing the package.
+func (e *RetriableError) ResponseBody() []byte {
+	return e.LastBody
+}
+
+// Do sends the request retrying it with the backoff until the response's status is successful.
+// The request which failed after the attempts were exhausted results to the RetriableError,
+// the cancelled request is not retried, and its error is returned as is.
 func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
 	var (
-		resp *http.Response
-		err  error
+		resp       *http.Response
+		err        error
+		lastStatus int
+		attempts   int
 	)
 
 	for !c.maxIterations(req) {
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
 		resp, err = c.httpClient.Do(req)
 		c.requestCounterUp(req)
-		if err != nil || resp.StatusCode > 209 {
+		attempts++
+		if err == nil {
+			lastStatus = resp.StatusCode
+		}
+		// the cancelled request is not retried, e.g. when the client which waits for the result disconnected
+		if err == nil && resp.StatusCode <= 209 || req.Context().Err() != nil {
+			c.requestCounterReset(req)
+			return resp, err
+		}
+		if !c.maxIterations(req) {
 			c.backoffDelay(req)
-		} else {
-			break
 		}
 	}
 
 	c.requestCounterReset(req)
 
-	return resp, err
+	if attempts == 0 {
+		return resp, err
+	}
+	var body []byte
+	if err == nil {
+		body, err = statusError(resp)
+	}
+	return nil, &RetriableError{Attempts: attempts, LastStatus: lastStatus, LastBody: body, Err: err}
+}
+
+const (
+	// statusErrorBodyLengthMax the maximum number of bytes of the response's body added to the status error.
+	statusErrorBodyLengthMax = 512
+	// lastBodyLengthMax the maximum number of bytes of the response's body kept in the RetriableError.
+	lastBodyLengthMax = 64 << 10
+)
+
+// statusError defines the error of the unsuccessful response, and reads its body. The response's body is closed.
+func statusError(resp *http.Response) ([]byte, error) {
+	defer func() { _ = resp.Body.Close() }()
+	msg := "error status code: " + strconv.Itoa(resp.StatusCode)
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, lastBodyLengthMax))
+	if v := body; len(v) > 0 {
+		if len(v) > statusErrorBodyLengthMax {
+			v = v[:statusErrorBodyLengthMax]
+		}
+		msg += ", response: " + strings.TrimSpace(string(v))
+	}
+	return body, errors.New(msg)
 }
 
 func (c *HTTPClient) generateRandomDelay() time.Duration {
@@ -82,7 +167,12 @@ func (c *HTTPClient) requestCounterUp(req *http.Request) {
 }
 
 func (c *HTTPClient) backoffDelay(req *http.Request) {
-	time.Sleep(c.generateRandomDelay())
+	timer := time.NewTimer(c.generateRandomDelay())
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+	case <-timer.C:
+	}
 }
 
 func (c *HTTPClient) requestCounterReset(req *http.Request) {
@@ -1,6 +1,8 @@
 package httpclient
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"reflect"
@@ -111,6 +113,21 @@ func (c *mockHttpClient) Do(_ *http.Request) (*http.Response, error) {
 	return c.V, nil
 }
 
+// mockHttpClientSequence responds with the response, or the error of the attempt by its index.
+type mockHttpClientSequence struct {
+	responses []*http.Response
+	errs      []error
+	attempt   int
+}
+
+func (c *mockHttpClientSequence) Do(_ *http.Request) (*http.Response, error) {
+	defer func() { c.attempt++ }()
+	if c.attempt < len(c.errs) && c.errs[c.attempt] != nil {
+		return nil, c.errs[c.attempt]
+	}
+	return c.responses[c.attempt], nil
+}
+
 func Test_client_Do(t *testing.T) {
 	t.Parallel()
 
@@ -141,17 +158,25 @@ func Test_client_Do(t *testing.T) {
 			resp, err := c.Do(&http.Request{Method: http.MethodGet})
 
 			// THEN
-			if err != nil {
-				t.Errorf("unexpected error")
-			}
-			if !reflect.DeepEqual(
-				resp, &http.Response{
-					StatusCode: http.StatusTooManyRequests,
-					Body:       io.NopCloser(strings.NewReader(`foobar`)),
-				},
-			) {
+			if resp != nil {
 				t.Errorf("unexpected response")
 			}
+			var errRetriable *RetriableError
+			if !errors.As(err, &errRetriable) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if errRetriable.Attempts != maxIterations || errRetriable.LastStatus != http.StatusTooManyRequests {
+				t.Errorf(
+					"unexpected attempts: %d, last status: %d", errRetriable.Attempts, errRetriable.LastStatus,
+				)
+			}
+			const wantErr = "error status code: 429, response: foobar, attempts: 2, last status code: 429"
+			if err.Error() != wantErr {
+				t.Errorf("unexpected error message: %s", err)
+			}
+			if string(errRetriable.ResponseBody()) != "foobar" {
+				t.Errorf("the last response's body shall be kept, got: %s", errRetriable.ResponseBody())
+			}
 
 			if cl.Counter != maxIterations {
 				t.Errorf("unexpected number iterations")
@@ -159,6 +184,50 @@ func Test_client_Do(t *testing.T) {
 		},
 	)
 
+	t.Run(
+		"shall wrap the error of the last attempt after exhausting the retries", func(t *testing.T) {
+			// GIVEN
+			errTimeout := errors.New("timeout")
+			cl := mockHttpClientSequence{
+				responses: []*http.Response{
+					{StatusCode: http.StatusBadGateway, Body: io.NopCloser(strings.NewReader(`foo`))},
+				},
+				errs: []error{nil, errTimeout, errTimeout},
+			}
+
+			c := HTTPClient{
+				httpClient: &cl,
+				backoff: Backoff{
+					MaxIterations:             3,
+					BackoffTimeMinMillisecond: 1,
+					BackoffTimeMaxMillisecond: 1,
+				},
+				backoffCounter: map[*http.Request]uint8{},
+				mu:             &sync.RWMutex{},
+			}
+
+			// WHEN
+			_, err := c.Do(&http.Request{Method: http.MethodGet})
+
+			// THEN
+			if !errors.Is(err, errTimeout) {
+				t.Errorf("the error shall unwrap to the last attempt's error, got: %v", err)
+			}
+			var errRetriable *RetriableError
+			if !errors.As(err, &errRetriable) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if errRetriable.Attempts != 3 || errRetriable.LastStatus != http.StatusBadGateway {
+				t.Errorf(
+					"unexpected attempts: %d, last status: %d", errRetriable.Attempts, errRetriable.LastStatus,
+				)
+			}
+			if errRetriable.StatusCode() != http.StatusBadGateway {
+				t.Errorf("unexpected status code: %d", errRetriable.StatusCode())
+			}
+		},
+	)
+
 	t.Run(
 		"happy path: a single iterations", func(t *testing.T) {
 			// GIVEN
@@ -201,4 +270,39 @@ func Test_client_Do(t *testing.T) {
 			}
 		},
 	)
+
+	t.Run(
+		"shall not retry the cancelled request", func(t *testing.T) {
+			// GIVEN
+			cl := mockHttpClient{
+				Err: context.Canceled,
+			}
+
+			c := HTTPClient{
+				httpClient: &cl,
+				backoff: Backoff{
+					MaxIterations:             3,
+					BackoffTimeMinMillisecond: 1000,
+					BackoffTimeMaxMillisecond: 1000,
+				},
+				backoffCounter: map[*http.Request]uint8{},
+				mu:             &sync.RWMutex{},
+			}
+
+			ctx, cancel := context.WithCancel(context.TODO())
+			cancel()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost", nil)
+
+			// WHEN
+			_, err := c.Do(req)
+
+			// THEN
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if cl.Counter != 1 {
+				t.Errorf("unexpected number iterations")
+			}
+		},
+	)
 }
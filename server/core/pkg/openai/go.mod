@@ -1,3 +1,7 @@
 module github.com/kislerdm/diagramastext/server/core/pkg/openai
 
 go 1.19
+
+require github.com/kislerdm/diagramastext/server/core/pkg/httpclient v0.0.1
+
+replace github.com/kislerdm/diagramastext/server/core/pkg/httpclient v0.0.1 => ../httpclient
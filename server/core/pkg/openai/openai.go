@@ -23,6 +23,7 @@ func NewOpenAIClient(cfg Config) (*Client, error) {
 		organization: cfg.Organization,
 		maxTokens:    cfg.MaxTokens,
 		httpClient:   cfg.HTTPClient,
+		examples:     cfg.Examples,
 	}, nil
 }
 
@@ -40,6 +41,16 @@ type Config struct {
 	Organization string
 
 	HTTPClient HTTPClient
+
+	// Examples the few-shot examples prepended to the conversation with the model to improve its output.
+	// The examples are included in their order as long as the request fits into the model's context.
+	Examples []Example
+}
+
+// Example defines the prompt and the expected model's completion.
+type Example struct {
+	Prompt     string
+	Completion string
 }
 
 func (cfg Config) Validate() error {
@@ -57,6 +68,7 @@ func (cfg Config) Validate() error {
 const (
 	defaultMaxTokens   = 500
 	defaultTemperature = 0.2
+	maxTemperature     = 2
 	defaultTopP        = 1
 )
 
@@ -66,6 +78,7 @@ type Client struct {
 	token        string
 	organization string
 	maxTokens    int
+	examples     []Example
 }
 
 func (c Client) getMaxTokens(model string) int {
@@ -78,11 +91,26 @@ func (c Client) getMaxTokens(model string) int {
 func (c Client) Do(ctx context.Context, userPrompt string, systemContent string, model string) (
 	predictionRaw string, prediction []byte, usageTokensPrompt uint16, usageTokensCompletions uint16, err error,
 ) {
+	return c.DoWithTemperature(ctx, userPrompt, systemContent, model, defaultTemperature)
+}
+
+// DoWithTemperature calls the model sampling its output with the given temperature between 0 and 2,
+// the higher temperature makes the output more random.
+// see: https://platform.openai.com/docs/api-reference/completions/create#completions/create-temperature
+func (c Client) DoWithTemperature(
+	ctx context.Context, userPrompt string, systemContent string, model string, temperature float32,
+) (
+	predictionRaw string, prediction []byte, usageTokensPrompt uint16, usageTokensCompletions uint16, err error,
+) {
+	if temperature < 0 || temperature > maxTemperature {
+		return "", nil, 0, 0, errors.New("temperature must be between 0 and 2")
+	}
+
 	if err := c.validatePrompt(model, userPrompt, systemContent); err != nil {
 		return "", nil, 0, 0, err
 	}
 
-	req, err := c.request(ctx, model, userPrompt, systemContent)
+	req, err := c.request(ctx, model, userPrompt, systemContent, temperature)
 	if err != nil {
 		return "", nil, 0, 0, err
 	}
@@ -95,8 +123,39 @@ func (c Client) Do(ctx context.Context, userPrompt string, systemContent string,
 	return decodeResponse(respBytes, model)
 }
 
+// IsFlagged checks if the input violates OpenAI's usage policies using the "moderations" endpoint.
+// see: https://platform.openai.com/docs/api-reference/moderations
+func (c Client) IsFlagged(ctx context.Context, input string) (bool, error) {
+	payload, err := newReader(openAIRequestModeration{Input: input})
+	if err != nil {
+		return false, err
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.openai.com/v1/moderations", payload)
+
+	respBytes, err := c.requestHandler(req)
+	if err != nil {
+		return false, err
+	}
+
+	var resp openAIResponseModeration
+	if err := json.Unmarshal(respBytes, &resp); err != nil {
+		return false, err
+	}
+	if len(resp.Results) == 0 {
+		return false, errors.New("no moderation results found")
+	}
+
+	for _, r := range resp.Results {
+		if r.Flagged {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 type payload interface {
-	openAIRequestCompletions | openAIRequestCompletionsChat
+	openAIRequestCompletions | openAIRequestCompletionsChat | openAIRequestModeration
 }
 
 func newReader[T payload](v T) (io.Reader, error) {
@@ -108,11 +167,13 @@ func newReader[T payload](v T) (io.Reader, error) {
 	return &w, nil
 }
 
-func (c Client) request(ctx context.Context, model, userPrompt, systemContent string) (*http.Request, error) {
+func (c Client) request(
+	ctx context.Context, model, userPrompt, systemContent string, temperature float32,
+) (*http.Request, error) {
 	base := openAIRequestBase{
 		Model:            model,
 		MaxTokens:        c.getMaxTokens(model),
-		Temperature:      defaultTemperature,
+		Temperature:      temperature,
 		FrequencyPenalty: 0,
 		PresencePenalty:  0,
 	}
@@ -122,28 +183,44 @@ func (c Client) request(ctx context.Context, model, userPrompt, systemContent st
 		err     error
 	)
 
+	examples := c.examplesWithinContext(model, userPrompt, systemContent)
+
 	switch model {
 	case "gpt-3.5-turbo":
+		messages := []openAIRequestChatMessage{
+			{
+				Role:    "system",
+				Content: systemContent,
+			},
+		}
+		for _, e := range examples {
+			messages = append(
+				messages,
+				openAIRequestChatMessage{Role: "user", Content: e.Prompt},
+				openAIRequestChatMessage{Role: "assistant", Content: e.Completion},
+			)
+		}
 		payload, err = newReader(
 			openAIRequestCompletionsChat{
 				openAIRequestBase: base,
-				Messages: []openAIRequestChatMessage{
-					{
-						Role:    "system",
-						Content: systemContent,
-					},
-					{
+				Messages: append(
+					messages, openAIRequestChatMessage{
 						Role:    "user",
 						Content: userPrompt,
 					},
-				},
+				),
 			},
 		)
 	default:
+		var prompt strings.Builder
+		prompt.WriteString(systemContent + "\n")
+		for _, e := range examples {
+			prompt.WriteString(e.Prompt + "\n" + e.Completion + "\n")
+		}
 		payload, err = newReader(
 			openAIRequestCompletions{
 				openAIRequestBase: base,
-				Prompt:            systemContent + "\n" + userPrompt + "\n",
+				Prompt:            prompt.String() + userPrompt + "\n",
 				Stop:              []string{"\n"},
 				TopP:              defaultTopP,
 				BestOf:            2,
@@ -158,6 +235,18 @@ func (c Client) request(ctx context.Context, model, userPrompt, systemContent st
 	return req, nil
 }
 
+// examplesWithinContext returns the examples which fit into the model's context along with the prompt.
+func (c Client) examplesWithinContext(model, userPrompt, systemContent string) []Example {
+	size := len(userPrompt) + len(systemContent) + c.getMaxTokens(model)
+	for i, e := range c.examples {
+		size += len(e.Prompt) + len(e.Completion)
+		if size > modelContextMaxTokes(model) {
+			return c.examples[:i]
+		}
+	}
+	return c.examples
+}
+
 func (c Client) validatePrompt(model, userPrompt, systemContent string) error {
 	if len(userPrompt)+len(systemContent)+c.getMaxTokens(model) > modelContextMaxTokes(model) {
 		return errors.New(
@@ -181,17 +270,21 @@ func (c Client) requestHandler(req *http.Request) ([]byte, error) {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		// the client which retries the request, e.g. httpclient.HTTPClient, returns the error
+		// with the server's last response once the attempts are exhausted
+		var v interface {
+			StatusCode() int
+			ResponseBody() []byte
+		}
+		if errors.As(err, &v) && v.StatusCode() > 209 {
+			return nil, decodeErrorResponse(v.StatusCode(), bytes.NewReader(v.ResponseBody()))
+		}
 		return nil, err
 	}
 
 	if resp.StatusCode > 209 {
-		var e openAIErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&e); err == nil {
-			if v := e.Error; v != nil {
-				return nil, errors.New(v.Message)
-			}
-		}
-		return nil, errors.New("error status code: " + strconv.Itoa(resp.StatusCode))
+		defer func() { _ = resp.Body.Close() }()
+		return nil, decodeErrorResponse(resp.StatusCode, resp.Body)
 	}
 
 	buf, err := io.ReadAll(resp.Body)
@@ -202,6 +295,17 @@ func (c Client) requestHandler(req *http.Request) ([]byte, error) {
 	return buf, nil
 }
 
+// decodeErrorResponse defines the error of the unsuccessful response using the server's error message.
+func decodeErrorResponse(statusCode int, body io.Reader) error {
+	var e openAIErrorResponse
+	if err := json.NewDecoder(body).Decode(&e); err == nil {
+		if v := e.Error; v != nil {
+			return errors.New(v.Message)
+		}
+	}
+	return errors.New("error status code: " + strconv.Itoa(statusCode))
+}
+
 func baseURL(model string) string {
 	switch model {
 	case "gpt-3.5-turbo":
@@ -355,6 +459,18 @@ type openAIRequestCompletionsChat struct {
 	Messages []openAIRequestChatMessage `json:"messages"`
 }
 
+type openAIRequestModeration struct {
+	Input string `json:"input"`
+}
+
+type openAIResponseModeration struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Results []struct {
+		Flagged bool `json:"flagged"`
+	} `json:"results"`
+}
+
 type openAIResponseBase struct {
 	ID      string `json:"id"`
 	Object  string `json:"object"`
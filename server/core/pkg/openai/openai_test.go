@@ -2,6 +2,7 @@ package openai
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"math/rand"
@@ -10,6 +11,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/kislerdm/diagramastext/server/core/pkg/httpclient"
 )
 
 func randomString(length int) string {
@@ -460,6 +463,47 @@ func Test_clientOpenAI_Do(t *testing.T) {
 	}
 }
 
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func Test_clientOpenAI_DoWithRetriesExhausted(t *testing.T) {
+	// GIVEN
+	transport := http.DefaultTransport
+	defer func() { http.DefaultTransport = transport }()
+	http.DefaultTransport = roundTripperFunc(
+		func(_ *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Body:       io.NopCloser(strings.NewReader(`{"error":{"code":429,"message":"foobar"}}`)),
+				Header:     http.Header{},
+			}, nil
+		},
+	)
+
+	c := Client{
+		httpClient: httpclient.NewHTTPClient(
+			httpclient.Config{
+				Backoff: httpclient.Backoff{
+					MaxIterations: 2, BackoffTimeMinMillisecond: 1, BackoffTimeMaxMillisecond: 1,
+				},
+			},
+		),
+		token:     mockToken,
+		maxTokens: 10,
+	}
+
+	// WHEN
+	_, _, _, _, err := c.Do(context.TODO(), "foobar", "qux", "")
+
+	// THEN
+	if err == nil || err.Error() != "foobar" {
+		t.Errorf("the server's error shall be decoded, got: %v", err)
+	}
+}
+
 func Test_cleanRawChatResponse(t *testing.T) {
 	type args struct {
 		s string
@@ -624,3 +668,212 @@ func Test_cleanContent(t *testing.T) {
 		)
 	}
 }
+
+func TestClient_IsFlagged(t *testing.T) {
+	newClient := func(statusCode int, body string) Client {
+		return Client{
+			httpClient: mockHTTPClient{
+				V: &http.Response{StatusCode: statusCode, Body: io.NopCloser(strings.NewReader(body))},
+			},
+			token: mockToken,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		client  Client
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:   "allowed input",
+			client: newClient(http.StatusOK, `{"id":"modr-0","model":"text-moderation-005","results":[{"flagged":false}]}`),
+			want:   false,
+		},
+		{
+			name:   "flagged input",
+			client: newClient(http.StatusOK, `{"id":"modr-0","model":"text-moderation-005","results":[{"flagged":true}]}`),
+			want:   true,
+		},
+		{
+			name:    "no results",
+			client:  newClient(http.StatusOK, `{"id":"modr-0","results":[]}`),
+			wantErr: true,
+		},
+		{
+			name:    "error response",
+			client:  newClient(http.StatusTooManyRequests, `{"error":{"message":"foo","type":"bar"}}`),
+			wantErr: true,
+		},
+		{
+			name:    "http client error",
+			client:  Client{httpClient: mockHTTPClient{Err: errors.New("foo")}, token: mockToken},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := tt.client.IsFlagged(context.TODO(), "foo")
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("IsFlagged() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if got != tt.want {
+					t.Errorf("IsFlagged() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+type mockHTTPClientRecorder struct {
+	requestBody []byte
+	body        string
+}
+
+func (m *mockHTTPClientRecorder) Do(req *http.Request) (*http.Response, error) {
+	var err error
+	if m.requestBody, err = io.ReadAll(req.Body); err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(m.body))}, nil
+}
+
+func TestClient_DoWithExamples(t *testing.T) {
+	examples := []Example{
+		{Prompt: "go web server", Completion: `{"nodes":[{"id":"0","technology":"Go"}]}`},
+		{Prompt: "python web server", Completion: `{"nodes":[{"id":"0","technology":"Python"}]}`},
+	}
+
+	t.Run(
+		"shall prepend the examples to the chat", func(t *testing.T) {
+			// GIVEN
+			httpClient := &mockHTTPClientRecorder{
+				body: `{"id":"0","choices":[{"message":{"content":"{\"nodes\":[{\"id\":\"0\"}]}"}}]}`,
+			}
+			c, err := NewOpenAIClient(Config{Token: mockToken, HTTPClient: httpClient, Examples: examples})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			if _, _, _, _, err := c.Do(context.TODO(), "foo", "bar", "gpt-3.5-turbo"); err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			var got openAIRequestCompletionsChat
+			if err := json.Unmarshal(httpClient.requestBody, &got); err != nil {
+				t.Fatal(err)
+			}
+			want := []openAIRequestChatMessage{
+				{Role: "system", Content: "bar"},
+				{Role: "user", Content: examples[0].Prompt},
+				{Role: "assistant", Content: examples[0].Completion},
+				{Role: "user", Content: examples[1].Prompt},
+				{Role: "assistant", Content: examples[1].Completion},
+				{Role: "user", Content: "foo"},
+			}
+			if !reflect.DeepEqual(got.Messages, want) {
+				t.Errorf("unexpected messages: got = %+v, want = %+v", got.Messages, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall prepend the examples to the completions prompt", func(t *testing.T) {
+			// GIVEN
+			httpClient := &mockHTTPClientRecorder{body: `{"id":"0","choices":[{"text":"{\"nodes\":[{\"id\":\"0\"}]}"}]}`}
+			c, err := NewOpenAIClient(Config{Token: mockToken, HTTPClient: httpClient, Examples: examples[:1]})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			if _, _, _, _, err := c.Do(context.TODO(), "foo", "bar", "code-davinci-002"); err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			var got openAIRequestCompletions
+			if err := json.Unmarshal(httpClient.requestBody, &got); err != nil {
+				t.Fatal(err)
+			}
+			if want := "bar\ngo web server\n" + examples[0].Completion + "\nfoo\n"; got.Prompt != want {
+				t.Errorf("unexpected prompt: got = %q, want = %q", got.Prompt, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall skip the examples exceeding the model's context", func(t *testing.T) {
+			// GIVEN
+			c := Client{
+				examples: []Example{
+					examples[0], {Prompt: randomString(4096)}, examples[1],
+				},
+			}
+
+			// WHEN
+			got := c.examplesWithinContext("gpt-3.5-turbo", "foo", "bar")
+
+			// THEN
+			if !reflect.DeepEqual(got, examples[:1]) {
+				t.Errorf("unexpected examples: %+v", got)
+			}
+		},
+	)
+}
+
+func TestClient_DoWithTemperature(t *testing.T) {
+	t.Run(
+		"shall request the completion with the temperature", func(t *testing.T) {
+			// GIVEN
+			httpClient := &mockHTTPClientRecorder{
+				body: `{"id":"0","choices":[{"message":{"content":"{\"nodes\":[{\"id\":\"0\"}]}"}}]}`,
+			}
+			c, err := NewOpenAIClient(Config{Token: mockToken, HTTPClient: httpClient})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			if _, _, _, _, err := c.DoWithTemperature(
+				context.TODO(), "foo", "bar", "gpt-3.5-turbo", 0.8,
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			var got openAIRequestCompletionsChat
+			if err := json.Unmarshal(httpClient.requestBody, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Temperature != 0.8 {
+				t.Errorf("unexpected temperature: %v", got.Temperature)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the temperature out of range", func(t *testing.T) {
+			// GIVEN
+			httpClient := &mockHTTPClientRecorder{}
+			c, err := NewOpenAIClient(Config{Token: mockToken, HTTPClient: httpClient})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			_, _, _, _, err = c.DoWithTemperature(context.TODO(), "foo", "bar", "gpt-3.5-turbo", 2.1)
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+			if httpClient.requestBody != nil {
+				t.Error("the model shall not be called")
+			}
+		},
+	)
+}
@@ -0,0 +1,54 @@
+// Package otel adapts OpenTelemetry to trace the stages of the request processing.
+package otel
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTracer initialises the Tracer which records the spans using the OpenTelemetry tracer provider.
+// The nil provider falls back to the global one, i.e. the no-op provider unless it was set by otel.SetTracerProvider.
+// The span context is propagated in the W3C Trace Context headers, i.e. traceparent and tracestate.
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracer{
+		tracer:     provider.Tracer("github.com/kislerdm/diagramastext/server/core"),
+		propagator: propagation.TraceContext{},
+	}
+}
+
+// Tracer records the spans using OpenTelemetry.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// Start starts the span as the child of the span found in the context.
+// The returned function ends the span recording the error, if any.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, func(err error)) {
+	ctx, span := t.tracer.Start(ctx, name)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// Extract returns the context with the remote span context propagated in the headers of the incoming request.
+func (t *Tracer) Extract(ctx context.Context, header http.Header) context.Context {
+	return t.propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject propagates the span context found in the context into the headers of the outgoing request.
+func (t *Tracer) Inject(ctx context.Context, header http.Header) {
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
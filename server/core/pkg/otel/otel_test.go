@@ -0,0 +1,80 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTracer() (*Tracer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	return NewTracer(provider), exporter
+}
+
+func TestTracer(t *testing.T) {
+	t.Run(
+		"shall record the child spans of the remote span", func(t *testing.T) {
+			// GIVEN
+			tracer, exporter := newTestTracer()
+			const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+			header := http.Header{}
+			header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+			// WHEN
+			ctx, endRequest := tracer.Start(tracer.Extract(context.TODO(), header), "POST /generate/c4")
+			ctxModel, endModel := tracer.Start(ctx, "model_inference")
+			outgoing := http.Header{}
+			tracer.Inject(ctxModel, outgoing)
+			endModel(errors.New("foo"))
+			endRequest(nil)
+
+			// THEN
+			spans := exporter.GetSpans()
+			if len(spans) != 2 {
+				t.Fatalf("unexpected number of spans: %d", len(spans))
+			}
+			model, request := spans[0], spans[1]
+			if request.Name != "POST /generate/c4" || model.Name != "model_inference" {
+				t.Errorf("unexpected spans: %s, %s", request.Name, model.Name)
+			}
+			if request.SpanContext.TraceID().String() != traceID ||
+				request.Parent.SpanID().String() != "00f067aa0ba902b7" {
+				t.Error("the request span shall be the child of the remote span")
+			}
+			if model.Parent.SpanID() != request.SpanContext.SpanID() {
+				t.Error("the model span shall be the child of the request span")
+			}
+			if model.Status.Code != codes.Error || len(model.Events) != 1 {
+				t.Errorf("the error shall be recorded, got status: %+v", model.Status)
+			}
+			want := "00-" + traceID + "-" + model.SpanContext.SpanID().String() + "-01"
+			if got := outgoing.Get("traceparent"); got != want {
+				t.Errorf("unexpected propagated header: got = %s, want = %s", got, want)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fall back to the global provider", func(t *testing.T) {
+			// GIVEN
+			tracer := NewTracer(nil)
+
+			// WHEN
+			ctx, end := tracer.Start(context.TODO(), "foo")
+			end(nil)
+
+			// THEN
+			header := http.Header{}
+			tracer.Inject(ctx, header)
+			if header.Get("traceparent") != "" {
+				t.Error("no-op provider shall not propagate the span context")
+			}
+		},
+	)
+}
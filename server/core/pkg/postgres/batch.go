@@ -0,0 +1,250 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxQueryParameters the limit of the parameters of the postgres statement.
+const maxQueryParameters = 65535
+
+var (
+	columnsPrompt     = []string{"request_id", "user_id", "prompt", "timestamp", "user_agent", "client_version"}
+	columnsPrediction = []string{
+		"request_id", "user_id", "response", "timestamp", "model_id", "prompt_tokens", "completion_tokens",
+		"response_raw", "experiment_variant",
+	}
+	columnsSuccessFlag = []string{"request_id", "user_id", "timestamp", "token"}
+)
+
+// BatchConfig configuration of the BatchWriter.
+type BatchConfig struct {
+	// MaxRows defines the number of the pending rows which triggers the flush, defaults to 100.
+	// It is limited by the number of the statement's parameters.
+	MaxRows int
+	// FlushInterval defines the interval to flush the pending rows, defaults to 1 second.
+	FlushInterval time.Duration
+	// OnError handles the errors of the flushes triggered by the interval.
+	OnError func(ctx context.Context, err error)
+}
+
+// NewBatchWriter initiates the BatchWriter which writes the prompts and predictions of the Client
+// with the multi-row INSERT statements.
+func NewBatchWriter(client *Client, cfg BatchConfig) *BatchWriter {
+	maxRows := cfg.MaxRows
+	if maxRows <= 0 {
+		maxRows = 100
+	}
+	if limit := maxQueryParameters / len(columnsPrediction); maxRows > limit {
+		maxRows = limit
+	}
+	interval := cfg.FlushInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	onError := cfg.OnError
+	if onError == nil {
+		onError = func(_ context.Context, _ error) {}
+	}
+
+	w := &BatchWriter{
+		client:  client,
+		maxRows: maxRows,
+		onError: onError,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.flushPeriodically(interval)
+	return w
+}
+
+// BatchWriter accumulates the rows of the prompts, the predictions and the success flags, and flushes them
+// when the number of the pending rows reaches the limit, or periodically.
+// The rows are written in the order they were received. The rows of the flushed batch are not retried.
+type BatchWriter struct {
+	client  *Client
+	maxRows int
+	onError func(ctx context.Context, err error)
+
+	mu           sync.Mutex
+	prompts      [][]any
+	predictions  [][]any
+	successFlags [][]any
+
+	// flushMu serializes the flushes to keep the order of the rows.
+	flushMu sync.Mutex
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func (w *BatchWriter) flushPeriodically(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if err := w.Flush(context.Background()); err != nil {
+				w.onError(context.Background(), err)
+			}
+		}
+	}
+}
+
+// WriteInputPrompt adds the prompt to the batch. The flush error is returned if the write triggers the flush.
+func (w *BatchWriter) WriteInputPrompt(ctx context.Context, requestID, userID, prompt string) error {
+	if err := validateInputPrompt(requestID, prompt); err != nil {
+		return err
+	}
+	return w.add(ctx, &w.prompts, []any{requestID, userID, prompt, time.Now().UTC(), nil, nil})
+}
+
+// WriteInputPromptWithClient adds the prompt along with the client's metadata to the batch,
+// see Client.WriteInputPromptWithClient. The flush error is returned if the write triggers the flush.
+func (w *BatchWriter) WriteInputPromptWithClient(
+	ctx context.Context, requestID, userID, prompt, userAgent, clientVersion string,
+) error {
+	if err := validateInputPrompt(requestID, prompt); err != nil {
+		return err
+	}
+	return w.add(
+		ctx, &w.prompts,
+		[]any{requestID, userID, prompt, time.Now().UTC(), nullString(userAgent), nullString(clientVersion)},
+	)
+}
+
+// WriteModelResult adds the model's prediction to the batch.
+// The flush error is returned if the write triggers the flush.
+func (w *BatchWriter) WriteModelResult(
+	ctx context.Context, requestID, userID, predictionRaw, prediction, model string,
+	usageTokensPrompt, usageTokensCompletions uint16,
+) error {
+	if err := validateModelResult(requestID, userID, predictionRaw, prediction, model); err != nil {
+		return err
+	}
+	return w.add(
+		ctx, &w.predictions, []any{
+			requestID, userID, prediction, time.Now().UTC(), model, usageTokensPrompt, usageTokensCompletions,
+			predictionRaw, nil,
+		},
+	)
+}
+
+// WriteModelResultWithVariant adds the model's prediction along with the experiment's variant to the batch,
+// see Client.WriteModelResultWithVariant. The flush error is returned if the write triggers the flush.
+func (w *BatchWriter) WriteModelResultWithVariant(
+	ctx context.Context, requestID, userID, predictionRaw, prediction, model string,
+	usageTokensPrompt, usageTokensCompletions uint16, variant string,
+) error {
+	if err := validateModelResult(requestID, userID, predictionRaw, prediction, model); err != nil {
+		return err
+	}
+	return w.add(
+		ctx, &w.predictions, []any{
+			requestID, userID, prediction, time.Now().UTC(), model, usageTokensPrompt, usageTokensCompletions,
+			predictionRaw, nullString(variant),
+		},
+	)
+}
+
+// WriteSuccessFlag adds the success flag to the batch. The flush error is returned if the write triggers the flush.
+func (w *BatchWriter) WriteSuccessFlag(ctx context.Context, requestID, userID, token string) error {
+	if err := validateSuccessFlag(requestID, userID); err != nil {
+		return err
+	}
+	return w.add(ctx, &w.successFlags, []any{requestID, userID, time.Now().UTC(), nullString(token)})
+}
+
+func (w *BatchWriter) add(ctx context.Context, rows *[][]any, row []any) error {
+	w.mu.Lock()
+	*rows = append(*rows, row)
+	full := len(w.prompts)+len(w.predictions)+len(w.successFlags) >= w.maxRows
+	w.mu.Unlock()
+
+	if full {
+		return w.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush writes the pending rows with one statement per table. The prompts are written before the predictions,
+// and the predictions are written before the success flags.
+func (w *BatchWriter) Flush(ctx context.Context) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	prompts, predictions, successFlags := w.prompts, w.predictions, w.successFlags
+	w.prompts, w.predictions, w.successFlags = nil, nil, nil
+	w.mu.Unlock()
+
+	var errs []string
+	for _, batch := range []struct {
+		table   string
+		columns []string
+		rows    [][]any
+	}{
+		{table: w.client.tableWritePrompt, columns: columnsPrompt, rows: prompts},
+		{table: w.client.tableWriteModelPrediction, columns: columnsPrediction, rows: predictions},
+		{table: w.client.tableWriteSuccessFlag, columns: columnsSuccessFlag, rows: successFlags},
+	} {
+		if len(batch.rows) == 0 {
+			continue
+		}
+		query, args := insertQuery(batch.table, batch.columns, batch.rows)
+		if _, err := w.client.c.Exec(ctx, query, args...); err != nil {
+			errs = append(
+				errs, "cannot write "+strconv.Itoa(len(batch.rows))+" rows to "+batch.table+": "+err.Error(),
+			)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Close flushes the pending rows and closes the Client.
+func (w *BatchWriter) Close(ctx context.Context) error {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+
+	if err := w.Flush(ctx); err != nil {
+		_ = w.client.Close(ctx)
+		return err
+	}
+	return w.client.Close(ctx)
+}
+
+// insertQuery defines the multi-row INSERT statement and its parameters.
+func insertQuery(table string, columns []string, rows [][]any) (string, []any) {
+	var buf strings.Builder
+	_, _ = buf.WriteString("INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES ")
+
+	args := make([]any, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		if i > 0 {
+			_, _ = buf.WriteString(", ")
+		}
+		_ = buf.WriteByte('(')
+		for j, v := range row {
+			if j > 0 {
+				_, _ = buf.WriteString(", ")
+			}
+			args = append(args, v)
+			_, _ = buf.WriteString("$" + strconv.Itoa(len(args)))
+		}
+		_ = buf.WriteByte(')')
+	}
+
+	return buf.String(), args
+}
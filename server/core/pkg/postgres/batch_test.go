@@ -0,0 +1,211 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type execCall struct {
+	query string
+	args  []any
+}
+
+// mockRecordingDbClient records the executed statements.
+type mockRecordingDbClient struct {
+	mockDbClient
+
+	mu    sync.Mutex
+	calls []execCall
+}
+
+func (m *mockRecordingDbClient) Exec(_ context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, execCall{query: query, args: args})
+	return pgconn.CommandTag{}, m.err
+}
+
+func (m *mockRecordingDbClient) executed() []execCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]execCall(nil), m.calls...)
+}
+
+func newMockBatchClient(db dbClient) *Client {
+	return &Client{
+		c:                         db,
+		tableWritePrompt:          "prompt",
+		tableWriteModelPrediction: "prediction",
+		tableWriteSuccessFlag:     "success",
+	}
+}
+
+func TestBatchWriter(t *testing.T) {
+	t.Run(
+		"shall write the batch of N rows in one statement", func(t *testing.T) {
+			// GIVEN
+			const n = 5
+			db := &mockRecordingDbClient{}
+			w := NewBatchWriter(newMockBatchClient(db), BatchConfig{MaxRows: n, FlushInterval: time.Hour})
+
+			// WHEN
+			for i := 0; i < n; i++ {
+				if err := w.WriteInputPrompt(context.TODO(), "foo", "bar", "qux"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// THEN
+			calls := db.executed()
+			if len(calls) != 1 {
+				t.Fatalf("the rows shall be written in one statement, got %d", len(calls))
+			}
+			const wantQuery = "INSERT INTO prompt (request_id, user_id, prompt, timestamp, user_agent, client_version) " +
+				"VALUES ($1, $2, $3, $4, $5, $6), ($7, $8, $9, $10, $11, $12), ($13, $14, $15, $16, $17, $18), " +
+				"($19, $20, $21, $22, $23, $24), ($25, $26, $27, $28, $29, $30)"
+			if calls[0].query != wantQuery {
+				t.Errorf("unexpected query: %s", calls[0].query)
+			}
+			if len(calls[0].args) != n*len(columnsPrompt) {
+				t.Errorf("unexpected number of parameters: %d", len(calls[0].args))
+			}
+		},
+	)
+
+	t.Run(
+		"shall write the rows in order", func(t *testing.T) {
+			// GIVEN
+			db := &mockRecordingDbClient{}
+			w := NewBatchWriter(newMockBatchClient(db), BatchConfig{FlushInterval: time.Hour})
+
+			// WHEN
+			_ = w.WriteSuccessFlag(context.TODO(), "0", "bar", "")
+			_ = w.WriteModelResultWithVariant(context.TODO(), "0", "bar", "{}", "{}", "baz", 1, 1, "control")
+			_ = w.WriteInputPrompt(context.TODO(), "0", "bar", "qux")
+			_ = w.WriteInputPromptWithClient(context.TODO(), "1", "bar", "qux", "curl/8.0", "")
+			err := w.Flush(context.TODO())
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			calls := db.executed()
+			if len(calls) != 3 {
+				t.Fatalf("one statement per table expected, got %d", len(calls))
+			}
+			for i, table := range []string{"prompt", "prediction", "success"} {
+				if !strings.HasPrefix(calls[i].query, "INSERT INTO "+table+" ") {
+					t.Errorf("unexpected order of statements: %s", calls[i].query)
+				}
+			}
+			if calls[0].args[0] != "0" || calls[0].args[6] != "1" {
+				t.Errorf("the prompts shall be written in the order they were received: %v", calls[0].args)
+			}
+			if calls[0].args[10] != "curl/8.0" || calls[0].args[11] != nil {
+				t.Errorf("unexpected client's metadata: %v", calls[0].args[10:])
+			}
+			if calls[1].args[8] != "control" {
+				t.Errorf("unexpected variant: %v", calls[1].args[8])
+			}
+			if calls[2].args[3] != nil {
+				t.Errorf("the empty token shall be written as null, got: %v", calls[2].args[3])
+			}
+		},
+	)
+
+	t.Run(
+		"shall flush periodically and report the error", func(t *testing.T) {
+			// GIVEN
+			db := &mockRecordingDbClient{mockDbClient: mockDbClient{err: errors.New("foo")}}
+			errs := make(chan error, 1)
+			w := NewBatchWriter(
+				newMockBatchClient(db), BatchConfig{
+					FlushInterval: time.Millisecond,
+					OnError: func(_ context.Context, err error) {
+						select {
+						case errs <- err:
+						default:
+						}
+					},
+				},
+			)
+
+			// WHEN
+			if err := w.WriteInputPrompt(context.TODO(), "foo", "bar", "qux"); err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			select {
+			case err := <-errs:
+				if err.Error() != "cannot write 1 rows to prompt: foo" {
+					t.Errorf("unexpected error: %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Error("the flush error shall be reported")
+			}
+		},
+	)
+
+	t.Run(
+		"shall return the error of the flush triggered by the write", func(t *testing.T) {
+			// GIVEN
+			db := &mockRecordingDbClient{mockDbClient: mockDbClient{err: errors.New("foo")}}
+			w := NewBatchWriter(newMockBatchClient(db), BatchConfig{MaxRows: 1, FlushInterval: time.Hour})
+
+			// WHEN
+			err := w.WriteInputPrompt(context.TODO(), "foo", "bar", "qux")
+
+			// THEN
+			if err == nil || err.Error() != "cannot write 1 rows to prompt: foo" {
+				t.Errorf("unexpected error: %v", err)
+			}
+		},
+	)
+
+	t.Run(
+		"shall flush the pending rows on close", func(t *testing.T) {
+			// GIVEN
+			db := &mockRecordingDbClient{}
+			w := NewBatchWriter(newMockBatchClient(db), BatchConfig{FlushInterval: time.Hour})
+			_ = w.WriteInputPrompt(context.TODO(), "foo", "bar", "qux")
+
+			// WHEN
+			err := w.Close(context.TODO())
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(db.executed()) != 1 {
+				t.Error("the pending rows shall be flushed")
+			}
+		},
+	)
+
+	t.Run(
+		"shall not write the invalid row", func(t *testing.T) {
+			// GIVEN
+			db := &mockRecordingDbClient{}
+			w := NewBatchWriter(newMockBatchClient(db), BatchConfig{FlushInterval: time.Hour})
+
+			// WHEN
+			err := w.WriteInputPrompt(context.TODO(), "", "bar", "qux")
+
+			// THEN
+			if err == nil || err.Error() != "request_id is required" {
+				t.Errorf("unexpected error: %v", err)
+			}
+			_ = w.Flush(context.TODO())
+			if len(db.executed()) != 0 {
+				t.Error("no statements expected")
+			}
+		},
+	)
+}
@@ -0,0 +1,195 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// tableMigrations the table of the applied migrations' versions.
+const tableMigrations = "schema_migrations"
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// Migration defines the versioned change of the schema.
+type Migration struct {
+	// Version the sequential number of the migration, it is defined by the file's name prefix, e.g. 0001_init.sql.
+	Version int
+	// Name the name of the migration's file.
+	Name string
+	// Query the SQL statements with the tables' names of the Client.
+	Query string
+}
+
+// Migrate applies the pending migrations in the order of their versions, and records the applied versions
+// in the table schema_migrations. The migrations are applied in the transaction holding the advisory lock,
+// hence the concurrent calls, e.g. by several application's instances starting simultaneously, apply them once.
+// Every migration is applied in the dedicated savepoint, i.e. the failed migration does not revert the preceding
+// ones, and the migrations are idempotent, i.e. the tables which pre-exist are kept.
+// It returns the applied migrations, or the pending migrations without applying them if dryRun is set.
+func (c Client) Migrate(ctx context.Context, dryRun bool) ([]Migration, error) {
+	migrations, err := c.readMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		applied, err := readAppliedMigrations(ctx, c.c)
+		if err != nil {
+			return nil, err
+		}
+		return pendingMigrations(migrations, applied), nil
+	}
+
+	var o []Migration
+	var errMigration error
+	if err := pgx.BeginFunc(
+		ctx, c.c, func(tx pgx.Tx) error {
+			// the lock is released when the transaction ends
+			if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationsLockID); err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec(
+				ctx, `CREATE TABLE IF NOT EXISTS `+tableMigrations+` (
+    version    INTEGER   NOT NULL PRIMARY KEY,
+    name       TEXT      NOT NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+)`,
+			); err != nil {
+				return err
+			}
+
+			applied, err := readAppliedMigrations(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			for _, m := range pendingMigrations(migrations, applied) {
+				// the nested transaction is the savepoint, hence the preceding migrations are kept on failure
+				if err := pgx.BeginFunc(
+					ctx, tx, func(tx pgx.Tx) error {
+						if _, err := tx.Exec(ctx, m.Query); err != nil {
+							return err
+						}
+						_, err := tx.Exec(
+							ctx, `INSERT INTO `+tableMigrations+` (version, name) VALUES ($1, $2)`,
+							m.Version, m.Name,
+						)
+						return err
+					},
+				); err != nil {
+					errMigration = errors.New("migration " + m.Name + ": " + err.Error())
+					return nil
+				}
+				o = append(o, m)
+			}
+			return nil
+		},
+	); err != nil {
+		return nil, err
+	}
+	return o, errMigration
+}
+
+// migrationsLockID the key of the advisory lock held while the migrations are applied.
+const migrationsLockID int64 = 7_420_150_310_912_357_019
+
+// pendingMigrations returns the migrations which versions are not applied.
+func pendingMigrations(migrations []Migration, applied map[int]struct{}) []Migration {
+	var o []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			o = append(o, m)
+		}
+	}
+	return o
+}
+
+// querier defines the connection, or the transaction to read the rows.
+type querier interface {
+	Query(ctx context.Context, query string, args ...any) (pgx.Rows, error)
+}
+
+// readAppliedMigrations reads the versions of the applied migrations, none are applied if the table does not exist.
+func readAppliedMigrations(ctx context.Context, db querier) (map[int]struct{}, error) {
+	rows, err := db.Query(ctx, `SELECT version FROM `+tableMigrations)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		// undefined_table
+		if errors.As(err, &pgErr) && pgErr.Code == "42P01" {
+			return map[int]struct{}{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	o := map[int]struct{}{}
+	var version int
+	for rows.Next() {
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		o[version] = struct{}{}
+	}
+	return o, rows.Err()
+}
+
+// readMigrations reads the embedded migrations sorted by version, and sets the tables' names of the Client.
+func (c Client) readMigrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	tables := struct {
+		TablePrompt        string
+		TablePrediction    string
+		TableSuccessStatus string
+		TableUsers         string
+		TableTokens        string
+		TableOneTimeSecret string
+		TableFeedback      string
+	}{
+		TablePrompt:        c.tableWritePrompt,
+		TablePrediction:    c.tableWriteModelPrediction,
+		TableSuccessStatus: c.tableWriteSuccessFlag,
+		TableUsers:         c.tableUsers,
+		TableTokens:        c.tableTokens,
+		TableOneTimeSecret: c.tableOneTimeSecret,
+		TableFeedback:      c.tableFeedback,
+	}
+
+	o := make([]Migration, 0, len(files))
+	for _, file := range files {
+		name := path.Base(file)
+		version, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil {
+			return nil, errors.New("migration " + name + ": version prefix must be integer")
+		}
+
+		tmpl, err := template.ParseFS(migrationsFS, file)
+		if err != nil {
+			return nil, err
+		}
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, tables); err != nil {
+			return nil, err
+		}
+
+		o = append(o, Migration{Version: version, Name: name, Query: buf.String()})
+	}
+
+	sort.Slice(o, func(i, j int) bool { return o[i].Version < o[j].Version })
+	return o, nil
+}
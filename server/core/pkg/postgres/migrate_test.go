@@ -0,0 +1,305 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	regexpCreateTable = regexp.MustCompile(`CREATE TABLE IF NOT EXISTS (\w+)`)
+	regexpCreateIndex = regexp.MustCompile(`CREATE INDEX IF NOT EXISTS (\w+) ON (\w+) \(([^)]+)\)`)
+)
+
+// mockMigrationsDB the database which records the tables, the indexes and the versions of the applied migrations.
+type mockMigrationsDB struct {
+	mockDbClient
+	tables   map[string]struct{}
+	indexes  map[string]string
+	versions map[int]string
+	// queries the executed migrations' queries
+	queries []string
+	// locks the number of the advisory locks taken on the migrations
+	locks   int
+	errExec error
+	// failVersion the version of the migration which fails to be recorded
+	failVersion int
+}
+
+func newMockMigrationsDB() *mockMigrationsDB {
+	return &mockMigrationsDB{
+		tables: map[string]struct{}{}, indexes: map[string]string{}, versions: map[int]string{},
+	}
+}
+
+func (m *mockMigrationsDB) Exec(_ context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+	if m.errExec != nil {
+		return pgconn.CommandTag{}, m.errExec
+	}
+	if strings.HasPrefix(query, "SELECT pg_advisory_xact_lock") {
+		if args[0] != migrationsLockID {
+			return pgconn.CommandTag{}, errors.New("unexpected lock ID")
+		}
+		m.locks++
+		return pgconn.NewCommandTag("SELECT 1"), nil
+	}
+	if strings.HasPrefix(query, "INSERT INTO "+tableMigrations) {
+		if args[0].(int) == m.failVersion {
+			return pgconn.CommandTag{}, errors.New("foo")
+		}
+		m.versions[args[0].(int)] = args[1].(string)
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	}
+	if !strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS "+tableMigrations) {
+		m.queries = append(m.queries, query)
+	}
+	for _, match := range regexpCreateTable.FindAllStringSubmatch(query, -1) {
+		m.tables[match[1]] = struct{}{}
+	}
+	for _, match := range regexpCreateIndex.FindAllStringSubmatch(query, -1) {
+		m.indexes[match[1]] = match[2] + " (" + match[3] + ")"
+	}
+	return pgconn.NewCommandTag("CREATE"), nil
+}
+
+func (m *mockMigrationsDB) Query(_ context.Context, _ string, _ ...any) (pgx.Rows, error) {
+	if _, ok := m.tables[tableMigrations]; !ok {
+		return nil, &pgconn.PgError{Code: "42P01"}
+	}
+	rows := &mockRows{s: &sync.RWMutex{}}
+	for version := range m.versions {
+		rows.v = append(rows.v, []any{version})
+	}
+	return rows, nil
+}
+
+func (m *mockMigrationsDB) Begin(_ context.Context) (pgx.Tx, error) {
+	return mockMigrationsTx{mockTx: mockTx{client: m}, db: m}, nil
+}
+
+type mockMigrationsTx struct {
+	mockTx
+	db *mockMigrationsDB
+}
+
+func (m mockMigrationsTx) Begin(_ context.Context) (pgx.Tx, error) {
+	return m, nil
+}
+
+func (m mockMigrationsTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return m.db.Query(ctx, sql, args...)
+}
+
+func (m mockMigrationsTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return m.db.Exec(ctx, sql, args...)
+}
+
+func newMigrationsClient(db dbClient) Client {
+	return Client{
+		c:                         db,
+		tableWritePrompt:          "user_prompts",
+		tableWriteModelPrediction: "openai_responses",
+		tableWriteSuccessFlag:     "successful_requests",
+		tableUsers:                "users",
+		tableTokens:               "api_tokens",
+		tableOneTimeSecret:        "user_auth_secrets",
+		tableFeedback:             "user_feedback",
+	}
+}
+
+func TestClient_Migrate(t *testing.T) {
+	wantTables := map[string]struct{}{
+		tableMigrations:       {},
+		"user_prompts":        {},
+		"openai_responses":    {},
+		"successful_requests": {},
+		"users":               {},
+		"api_tokens":          {},
+		"user_auth_secrets":   {},
+		"user_feedback":       {},
+	}
+	wantIndexes := map[string]string{
+		"ind_user_api_tokens_user_id":            "api_tokens (user_id)",
+		"ind_successful_requests_timestamp":      "successful_requests (timestamp)",
+		"ind_successful_requests_user_id":        "successful_requests (user_id)",
+		"ind_user_auth_secrets_created_at":       "user_auth_secrets (created_at)",
+		"ind_user_prompts_user_id_timestamp":     "user_prompts (user_id, timestamp)",
+		"ind_openai_responses_user_id_timestamp": "openai_responses (user_id, timestamp)",
+	}
+
+	t.Run(
+		"shall apply all migrations, and shall be idempotent", func(t *testing.T) {
+			// GIVEN
+			db := newMockMigrationsDB()
+			c := newMigrationsClient(db)
+
+			// WHEN
+			applied, err := c.Migrate(context.TODO(), false)
+
+			// THEN
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			migrations, err := c.readMigrations()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(applied, migrations) {
+				t.Errorf("all migrations shall be applied, got: %+v", applied)
+			}
+			for i, m := range applied {
+				if m.Version != i+1 {
+					t.Errorf("migrations shall be applied in the order of versions, got: %d at %d", m.Version, i)
+				}
+				if db.versions[m.Version] != m.Name {
+					t.Errorf("the version %d shall be recorded", m.Version)
+				}
+			}
+			if !reflect.DeepEqual(db.tables, wantTables) {
+				t.Errorf("unexpected tables: %v", db.tables)
+			}
+			if !reflect.DeepEqual(db.indexes, wantIndexes) {
+				t.Errorf("unexpected indexes: %v", db.indexes)
+			}
+
+			// WHEN
+			applied, err = c.Migrate(context.TODO(), false)
+
+			// THEN
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(applied) != 0 {
+				t.Errorf("no migrations shall be applied twice, got: %+v", applied)
+			}
+			if len(db.queries) != len(migrations) {
+				t.Errorf("the migrations shall be executed once, got: %d queries", len(db.queries))
+			}
+		},
+	)
+
+	t.Run(
+		"shall not change the schema given dry-run", func(t *testing.T) {
+			// GIVEN
+			db := newMockMigrationsDB()
+			c := newMigrationsClient(db)
+
+			// WHEN
+			pending, err := c.Migrate(context.TODO(), true)
+
+			// THEN
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(pending) == 0 {
+				t.Error("pending migrations shall be returned")
+			}
+			if len(db.tables) != 0 || len(db.versions) != 0 {
+				t.Errorf("the schema shall not be changed, got tables: %v", db.tables)
+			}
+
+			// WHEN
+			if _, err := c.Migrate(context.TODO(), false); err != nil {
+				t.Fatal(err)
+			}
+			pending, err = c.Migrate(context.TODO(), true)
+
+			// THEN
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(pending) != 0 {
+				t.Errorf("no migrations shall be pending, got: %+v", pending)
+			}
+		},
+	)
+
+	t.Run(
+		"shall set the tables' names of the client", func(t *testing.T) {
+			// GIVEN
+			db := newMockMigrationsDB()
+			c := newMigrationsClient(db)
+			c.tableWritePrompt = "foo"
+
+			// WHEN
+			if _, err := c.Migrate(context.TODO(), false); err != nil {
+				t.Fatal(err)
+			}
+
+			// THEN
+			if _, ok := db.tables["foo"]; !ok {
+				t.Errorf("the prompt table shall be created, got: %v", db.tables)
+			}
+			if _, ok := db.tables["user_prompts"]; ok {
+				t.Error("the default prompt table shall not be created")
+			}
+			for _, q := range db.queries {
+				if strings.Contains(q, "{{") {
+					t.Errorf("the query shall not contain the template's placeholders: %s", q)
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the database error", func(t *testing.T) {
+			// GIVEN
+			db := newMockMigrationsDB()
+			db.errExec = errors.New("foo")
+			c := newMigrationsClient(db)
+
+			// WHEN
+			_, err := c.Migrate(context.TODO(), false)
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+
+	t.Run(
+		"shall keep the migrations applied before the failed one", func(t *testing.T) {
+			// GIVEN
+			db := newMockMigrationsDB()
+			db.failVersion = 2
+			c := newMigrationsClient(db)
+
+			// WHEN
+			applied, err := c.Migrate(context.TODO(), false)
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+			if len(applied) != 1 || applied[0].Version != 1 {
+				t.Errorf("the first migration shall be applied, got: %+v", applied)
+			}
+			if _, ok := db.versions[1]; !ok || len(db.versions) != 1 {
+				t.Errorf("the first version shall be recorded, got: %v", db.versions)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given the query error other than the missing table", func(t *testing.T) {
+			// GIVEN
+			c := newMigrationsClient(&mockDbClient{err: errors.New("foo")})
+
+			// WHEN
+			_, err := c.Migrate(context.TODO(), true)
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
@@ -0,0 +1,62 @@
+CREATE TABLE IF NOT EXISTS {{.TablePrompt}}
+(
+    request_id UUID      NOT NULL PRIMARY KEY,
+    user_id    UUID      NOT NULL,
+    prompt     TEXT      NOT NULL,
+    timestamp  TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS {{.TablePrediction}}
+(
+    request_id        UUID      NOT NULL PRIMARY KEY REFERENCES {{.TablePrompt}} (request_id),
+    user_id           UUID      NOT NULL,
+    response_raw      TEXT      NOT NULL,
+    response          TEXT      NOT NULL,
+    prompt_tokens     SMALLINT  NOT NULL,
+    completion_tokens SMALLINT  NOT NULL,
+    model_id          TEXT      NOT NULL,
+    timestamp         TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS {{.TableUsers}}
+(
+    user_id         UUID      NOT NULL PRIMARY KEY,
+    email           TEXT,
+    role            SMALLINT  NOT NULL,
+    web_fingerprint TEXT,
+    is_active       BOOLEAN   NOT NULL DEFAULT FALSE,
+    is_premium      BOOLEAN   NOT NULL DEFAULT FALSE,
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    update_at       TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS {{.TableTokens}}
+(
+    token      UUID      NOT NULL PRIMARY KEY,
+    user_id    UUID      NOT NULL REFERENCES {{.TableUsers}} (user_id),
+    is_active  BOOLEAN   NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ind_user_{{.TableTokens}}_user_id ON {{.TableTokens}} (user_id);
+
+CREATE TABLE IF NOT EXISTS {{.TableSuccessStatus}}
+(
+    request_id UUID      NOT NULL PRIMARY KEY REFERENCES {{.TablePrompt}} (request_id),
+    user_id    UUID      NOT NULL REFERENCES {{.TableUsers}} (user_id),
+    token      UUID,
+    timestamp  TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ind_{{.TableSuccessStatus}}_timestamp ON {{.TableSuccessStatus}} (timestamp);
+CREATE INDEX IF NOT EXISTS ind_{{.TableSuccessStatus}}_user_id ON {{.TableSuccessStatus}} (user_id);
+
+CREATE TABLE IF NOT EXISTS {{.TableOneTimeSecret}}
+(
+    user_id    UUID      NOT NULL PRIMARY KEY REFERENCES {{.TableUsers}} (user_id),
+    secret     TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ind_{{.TableOneTimeSecret}}_created_at ON {{.TableOneTimeSecret}} (created_at);
@@ -0,0 +1,3 @@
+ALTER TABLE {{.TablePrompt}}
+    ADD COLUMN IF NOT EXISTS user_agent     TEXT,
+    ADD COLUMN IF NOT EXISTS client_version TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE {{.TablePrediction}}
+    ADD COLUMN IF NOT EXISTS experiment_variant TEXT;
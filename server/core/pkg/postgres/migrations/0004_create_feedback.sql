@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS {{.TableFeedback}}
+(
+    request_id UUID      NOT NULL PRIMARY KEY REFERENCES {{.TablePrompt}} (request_id),
+    user_id    UUID      NOT NULL,
+    rating     SMALLINT  NOT NULL,
+    comment    TEXT,
+    timestamp  TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,6 @@
+-- The indexes serve the reads of the user's requests within the time window, e.g. the user's history of prompts
+-- sorted by time, and the count of the user's requests to enforce the rate limits:
+--   SELECT ... FROM {{.TablePrompt}} WHERE user_id = $1 ORDER BY timestamp DESC LIMIT $2;
+--   SELECT COUNT(*) FROM {{.TablePrediction}} WHERE user_id = $1 AND timestamp >= $2;
+CREATE INDEX IF NOT EXISTS ind_{{.TablePrompt}}_user_id_timestamp ON {{.TablePrompt}} (user_id, timestamp);
+CREATE INDEX IF NOT EXISTS ind_{{.TablePrediction}}_user_id_timestamp ON {{.TablePrediction}} (user_id, timestamp);
@@ -15,8 +15,11 @@ import (
 type mockDbClient struct {
 	err   error
 	query string
+	args  []any
 	tx    pgx.Tx
 	v     pgx.Rows
+	// tag the command tag returned by Exec, defaults to the query's command.
+	tag *pgconn.CommandTag
 }
 
 func (m *mockDbClient) Query(_ context.Context, query string, _ ...any) (pgx.Rows, error) {
@@ -31,14 +34,22 @@ func (m *mockDbClient) Close(_ context.Context) error {
 	return m.err
 }
 
-func (m *mockDbClient) Exec(_ context.Context, query string, _ ...any) (pgconn.CommandTag, error) {
+func (m *mockDbClient) Exec(_ context.Context, query string, args ...any) (pgconn.CommandTag, error) {
 	m.query = query
+	m.args = args
 	if m.err != nil {
 		return pgconn.CommandTag{}, m.err
 	}
+	if m.tag != nil {
+		return *m.tag, nil
+	}
 	return pgconn.NewCommandTag(strings.ToUpper(strings.Split(query, " ")[0])), nil
 }
 
+func (m *mockDbClient) Ping(_ context.Context) error {
+	return m.err
+}
+
 func (m *mockDbClient) Begin(_ context.Context) (pgx.Tx, error) {
 	if m.err != nil {
 		return nil, m.err
@@ -50,6 +61,7 @@ type dbClient interface {
 	Exec(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error)
 	Query(ctx context.Context, query string, args ...any) (pgx.Rows, error)
 	Close(ctx context.Context) error
+	Ping(ctx context.Context) error
 	Begin(ctx context.Context) (pgx.Tx, error)
 }
 
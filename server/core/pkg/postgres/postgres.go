@@ -22,7 +22,11 @@ type Config struct {
 	TableUsers         string `json:"table_users,omitempty"`
 	TableTokens        string `json:"table_tokens,omitempty"`
 	TableOneTimeSecret string `json:"table_one_time_secret,omitempty"`
-	SSLMode            string `json:"ssl_mode"`
+	// TableFeedback defines the table of the users' feedback on the diagrams, defaults to "user_feedback".
+	TableFeedback string `json:"table_feedback,omitempty"`
+	SSLMode       string `json:"ssl_mode"`
+	// OneTimeSecretTTL defines the time to live of the one-time secrets.
+	OneTimeSecretTTL time.Duration `json:"-"`
 }
 
 func (cfg Config) Validate() error {
@@ -100,6 +104,16 @@ func NewPostgresClient(ctx context.Context, cfg Config) (
 		}
 	}
 
+	oneTimeSecretTTL := cfg.OneTimeSecretTTL
+	if oneTimeSecretTTL <= 0 {
+		oneTimeSecretTTL = defaultOneTimeSecretTTL
+	}
+
+	tableFeedback := cfg.TableFeedback
+	if tableFeedback == "" {
+		tableFeedback = defaultTableFeedback
+	}
+
 	return &Client{
 		c:                         db,
 		tableWritePrompt:          cfg.TablePrompt,
@@ -108,9 +122,16 @@ func NewPostgresClient(ctx context.Context, cfg Config) (
 		tableUsers:                cfg.TableUsers,
 		tableTokens:               cfg.TableTokens,
 		tableOneTimeSecret:        cfg.TableOneTimeSecret,
+		tableFeedback:             tableFeedback,
+		oneTimeSecretTTL:          oneTimeSecretTTL,
 	}, nil
 }
 
+const (
+	defaultOneTimeSecretTTL = 10 * time.Minute
+	defaultTableFeedback    = "user_feedback"
+)
+
 type Client struct {
 	c                         dbClient
 	tableWritePrompt          string
@@ -119,6 +140,8 @@ type Client struct {
 	tableUsers                string
 	tableTokens               string
 	tableOneTimeSecret        string
+	tableFeedback             string
+	oneTimeSecretTTL          time.Duration
 }
 
 func (c Client) GetDailySuccessfulResultsTimestampsByUserID(ctx context.Context, userID string) ([]time.Time, error) {
@@ -165,13 +188,25 @@ func (c Client) Close(ctx context.Context) error {
 	return c.c.Close(ctx)
 }
 
-func (c Client) WriteInputPrompt(ctx context.Context, requestID, userID, prompt string) error {
+// Ping checks that the database is reachable, e.g. to probe the application's readiness.
+func (c Client) Ping(ctx context.Context) error {
+	return c.c.Ping(ctx)
+}
+
+func validateInputPrompt(requestID, prompt string) error {
 	if requestID == "" {
 		return errors.New("request_id is required")
 	}
 	if prompt == "" {
 		return errors.New("prompt is required")
 	}
+	return nil
+}
+
+func (c Client) WriteInputPrompt(ctx context.Context, requestID, userID, prompt string) error {
+	if err := validateInputPrompt(requestID, prompt); err != nil {
+		return err
+	}
 	_, err := c.c.Exec(
 		ctx, `INSERT INTO `+c.tableWritePrompt+
 			` (request_id, user_id, prompt, timestamp) VALUES ($1, $2, $3, $4)`,
@@ -183,10 +218,36 @@ func (c Client) WriteInputPrompt(ctx context.Context, requestID, userID, prompt
 	return err
 }
 
-func (c Client) WriteModelResult(
-	ctx context.Context, requestID, userID, predictionRaw, prediction, model string,
-	usageTokensPrompt, usageTokensCompletions uint16,
+// WriteInputPromptWithClient records the prompt along with the client's User-Agent and version.
+// The empty metadata is recorded as null.
+func (c Client) WriteInputPromptWithClient(
+	ctx context.Context, requestID, userID, prompt, userAgent, clientVersion string,
 ) error {
+	if err := validateInputPrompt(requestID, prompt); err != nil {
+		return err
+	}
+	_, err := c.c.Exec(
+		ctx, `INSERT INTO `+c.tableWritePrompt+
+			` (request_id, user_id, prompt, timestamp, user_agent, client_version) VALUES ($1, $2, $3, $4, $5, $6)`,
+		requestID,
+		userID,
+		prompt,
+		time.Now().UTC(),
+		nullString(userAgent),
+		nullString(clientVersion),
+	)
+	return err
+}
+
+// nullString defines the empty string as null.
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func validateModelResult(requestID, userID, predictionRaw, prediction, model string) error {
 	if requestID == "" {
 		return errors.New("request_id is required")
 	}
@@ -202,6 +263,16 @@ func (c Client) WriteModelResult(
 	if model == "" {
 		return errors.New("model is required")
 	}
+	return nil
+}
+
+func (c Client) WriteModelResult(
+	ctx context.Context, requestID, userID, predictionRaw, prediction, model string,
+	usageTokensPrompt, usageTokensCompletions uint16,
+) error {
+	if err := validateModelResult(requestID, userID, predictionRaw, prediction, model); err != nil {
+		return err
+	}
 	_, err := c.c.Exec(
 		ctx, `INSERT INTO `+c.tableWriteModelPrediction+
 			` (
@@ -235,13 +306,46 @@ func (c Client) WriteModelResult(
 	return err
 }
 
-func (c Client) WriteSuccessFlag(ctx context.Context, requestID, userID, token string) error {
+// WriteModelResultWithVariant records the model's prediction result along with the experiment's variant
+// which defined the model and the system prompt.
+func (c Client) WriteModelResultWithVariant(
+	ctx context.Context, requestID, userID, predictionRaw, prediction, model string,
+	usageTokensPrompt, usageTokensCompletions uint16, variant string,
+) error {
+	if err := validateModelResult(requestID, userID, predictionRaw, prediction, model); err != nil {
+		return err
+	}
+	_, err := c.c.Exec(
+		ctx, `INSERT INTO `+c.tableWriteModelPrediction+
+			` (request_id, user_id, response, timestamp, model_id, prompt_tokens, completion_tokens, response_raw,`+
+			` experiment_variant) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		requestID,
+		userID,
+		prediction,
+		time.Now().UTC(),
+		model,
+		usageTokensPrompt,
+		usageTokensCompletions,
+		predictionRaw,
+		nullString(variant),
+	)
+	return err
+}
+
+func validateSuccessFlag(requestID, userID string) error {
 	if requestID == "" {
 		return errors.New("request_id is required")
 	}
 	if userID == "" {
 		return errors.New("user_id is required")
 	}
+	return nil
+}
+
+func (c Client) WriteSuccessFlag(ctx context.Context, requestID, userID, token string) error {
+	if err := validateSuccessFlag(requestID, userID); err != nil {
+		return err
+	}
 
 	if token != "" {
 		_, err := c.c.Exec(
@@ -284,6 +388,61 @@ func (c Client) WriteSuccessFlag(ctx context.Context, requestID, userID, token s
 	return err
 }
 
+// WriteFeedback records the user's feedback on the request's diagram, the feedback replaces the previous one.
+// found is false if the prompt of the request made by the user is not found.
+func (c Client) WriteFeedback(
+	ctx context.Context, requestID, userID string, rating int, comment string,
+) (found bool, err error) {
+	if requestID == "" {
+		return false, errors.New("request_id is required")
+	}
+	if userID == "" {
+		return false, errors.New("user_id is required")
+	}
+	tag, err := c.c.Exec(
+		ctx, `INSERT INTO `+c.tableFeedback+` (request_id, user_id, rating, comment, timestamp)
+SELECT request_id, user_id, $3, $4, $5 FROM `+c.tableWritePrompt+` WHERE request_id = $1 AND user_id = $2
+ON CONFLICT (request_id) DO UPDATE SET rating = $3, comment = $4, timestamp = $5`,
+		requestID,
+		userID,
+		rating,
+		nullString(comment),
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ReadModelPrediction reads the model's prediction, i.e. the diagram's graph, generated for the user's request.
+// found is false if the prediction of the request made by the user is not found.
+func (c Client) ReadModelPrediction(ctx context.Context, requestID, userID string) (
+	prediction string, found bool, err error,
+) {
+	if requestID == "" {
+		return "", false, errors.New("request_id is required")
+	}
+	if userID == "" {
+		return "", false, errors.New("user_id is required")
+	}
+	rows, err := c.c.Query(
+		ctx, `SELECT response FROM `+c.tableWriteModelPrediction+` WHERE request_id = $1 AND user_id = $2`,
+		requestID, userID,
+	)
+	if err != nil {
+		return "", false, err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		if err := rows.Scan(&prediction); err != nil {
+			return "", false, err
+		}
+		return prediction, true, nil
+	}
+	return "", false, rows.Err()
+}
+
 func (c Client) CreateUser(ctx context.Context, id, email, fingerprint string, isActive bool, role *uint8) error {
 	if id == "" {
 		return errors.New("id is required")
@@ -435,3 +594,12 @@ func (c Client) DeleteOneTimeSecret(ctx context.Context, userID string) error {
 	_, err := c.c.Exec(ctx, "DELETE FROM "+c.tableOneTimeSecret+" WHERE user_id = $1", userID)
 	return err
 }
+
+// DeleteExpiredSecrets deletes the one-time secrets created earlier than the configured TTL.
+func (c Client) DeleteExpiredSecrets(ctx context.Context) error {
+	_, err := c.c.Exec(
+		ctx, "DELETE FROM "+c.tableOneTimeSecret+" WHERE created_at < $1",
+		time.Now().UTC().Add(-c.oneTimeSecretTTL),
+	)
+	return err
+}
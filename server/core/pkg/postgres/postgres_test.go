@@ -273,6 +273,8 @@ func TestNewRepositoryPostgres(t *testing.T) {
 				tableUsers:                "quxx",
 				tableTokens:               "baz",
 				tableOneTimeSecret:        "quxxx",
+				tableFeedback:             defaultTableFeedback,
+				oneTimeSecretTTL:          defaultOneTimeSecretTTL,
 			},
 			wantErr: false,
 		},
@@ -393,6 +395,56 @@ func TestClient_WritePrompt(t *testing.T) {
 	}
 }
 
+func TestClient_WriteInputPromptWithClient(t *testing.T) {
+	// GIVEN
+	db := &mockDbClient{}
+	c := Client{c: db, tableWritePrompt: "foo"}
+
+	// WHEN
+	err := c.WriteInputPromptWithClient(
+		context.TODO(), "693a35ba-e42c-4168-8afc-5a7c359d1d05", "c40bad11-0822-4d84-9f61-44b9a97b0432",
+		"c4 diagram of four boxes", "Mozilla/5.0", "",
+	)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	const wantQuery = `INSERT INTO foo (request_id, user_id, prompt, timestamp, user_agent, client_version) ` +
+		`VALUES ($1, $2, $3, $4, $5, $6)`
+	if db.query != wantQuery {
+		t.Errorf("unexpected query: %s", db.query)
+	}
+	if db.args[4] != "Mozilla/5.0" || db.args[5] != nil {
+		t.Errorf("the empty metadata shall be written as null, got: %v", db.args[4:])
+	}
+}
+
+func TestClient_WriteModelResultWithVariant(t *testing.T) {
+	// GIVEN
+	db := &mockDbClient{}
+	c := Client{c: db, tableWriteModelPrediction: "foo"}
+
+	// WHEN
+	err := c.WriteModelResultWithVariant(
+		context.TODO(), "693a35ba-e42c-4168-8afc-5a7c359d1d05", "c40bad11-0822-4d84-9f61-44b9a97b0432",
+		`{"nodes":[{"id":"0"}]}`, `{"nodes":[{"id":"0"}]}`, "gpt-4", 100, 50, "bar",
+	)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	const wantQuery = `INSERT INTO foo (request_id, user_id, response, timestamp, model_id, prompt_tokens, ` +
+		`completion_tokens, response_raw, experiment_variant) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	if db.query != wantQuery {
+		t.Errorf("unexpected query: %s", db.query)
+	}
+	if db.args[8] != "bar" {
+		t.Errorf("unexpected variant: %v", db.args[8])
+	}
+}
+
 func TestClient_WriteModelResult(t *testing.T) {
 	type fields struct {
 		c dbClient
@@ -581,6 +633,39 @@ func TestClient_Close(t *testing.T) {
 	)
 }
 
+func TestClient_Ping(t *testing.T) {
+	t.Parallel()
+
+	t.Run(
+		"happy path", func(t *testing.T) {
+			// GIVEN
+			c := Client{
+				c: &mockDbClient{},
+			}
+			// WHEN
+			err := c.Ping(context.TODO())
+			// THEN
+			if err != nil {
+				t.Errorf("unexpected error")
+			}
+		},
+	)
+	t.Run(
+		"unhappy path", func(t *testing.T) {
+			// GIVEN
+			c := Client{
+				c: &mockDbClient{err: errors.New("connection refused")},
+			}
+			// WHEN
+			err := c.Ping(context.TODO())
+			// THEN
+			if err == nil {
+				t.Errorf("expected error")
+			}
+		},
+	)
+}
+
 func TestClient_WriteSuccessFlag(t *testing.T) {
 	type fields struct {
 		c dbClient
@@ -1771,3 +1856,204 @@ func TestClient_DeleteOneTimeSecret(t *testing.T) {
 		)
 	}
 }
+
+func TestClient_DeleteExpiredSecrets(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		err       error
+		wantErr   bool
+		wantQuery string
+	}{
+		{
+			name:      "happy path",
+			ttl:       10 * time.Minute,
+			wantQuery: "DELETE FROM secret WHERE created_at < $1",
+		},
+		{
+			name:    "unhappy path: db error",
+			ttl:     10 * time.Minute,
+			err:     errors.New("foo"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				db := &mockDbClient{err: tt.err}
+				c := Client{
+					c:                  db,
+					tableOneTimeSecret: "secret",
+					oneTimeSecretTTL:   tt.ttl,
+				}
+
+				tsMin := time.Now().UTC().Add(-tt.ttl)
+				err := c.DeleteExpiredSecrets(context.TODO())
+				tsMax := time.Now().UTC().Add(-tt.ttl)
+
+				if (err != nil) != tt.wantErr {
+					t.Errorf("DeleteExpiredSecrets() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				if err == nil {
+					if db.query != tt.wantQuery {
+						t.Error("DeleteExpiredSecrets() executed unexpected query")
+					}
+					// the secrets created before the cutoff are expired, the fresh ones are kept
+					cutoff := db.args[0].(time.Time)
+					if cutoff.Before(tsMin) || cutoff.After(tsMax) {
+						t.Errorf("DeleteExpiredSecrets() unexpected cutoff timestamp: %v", cutoff)
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestClient_WriteFeedback(t *testing.T) {
+	newTag := func(s string) *pgconn.CommandTag {
+		tag := pgconn.NewCommandTag(s)
+		return &tag
+	}
+
+	t.Run(
+		"shall write the feedback on the user's request", func(t *testing.T) {
+			// GIVEN
+			db := &mockDbClient{tag: newTag("INSERT 0 1")}
+			c := Client{c: db, tableWritePrompt: "foo", tableFeedback: "bar"}
+
+			// WHEN
+			found, err := c.WriteFeedback(
+				context.TODO(), "693a35ba-e42c-4168-8afc-5a7c359d1d05", "c40bad11-0822-4d84-9f61-44b9a97b0432",
+				-1, "",
+			)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !found {
+				t.Error("the request shall be found")
+			}
+			const wantQuery = `INSERT INTO bar (request_id, user_id, rating, comment, timestamp)
+SELECT request_id, user_id, $3, $4, $5 FROM foo WHERE request_id = $1 AND user_id = $2
+ON CONFLICT (request_id) DO UPDATE SET rating = $3, comment = $4, timestamp = $5`
+			if db.query != wantQuery {
+				t.Errorf("unexpected query: %s", db.query)
+			}
+			if db.args[2] != -1 || db.args[3] != nil {
+				t.Errorf("unexpected args: %v", db.args[2:4])
+			}
+		},
+	)
+
+	t.Run(
+		"shall report the unknown request", func(t *testing.T) {
+			// GIVEN
+			c := Client{c: &mockDbClient{tag: newTag("INSERT 0 0")}, tableWritePrompt: "foo", tableFeedback: "bar"}
+
+			// WHEN
+			found, err := c.WriteFeedback(context.TODO(), "foo", "bar", 1, "qux")
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found {
+				t.Error("the request shall not be found")
+			}
+		},
+	)
+
+	tests := []struct {
+		name              string
+		requestID, userID string
+		db                *mockDbClient
+	}{
+		{name: "no request ID", userID: "bar", db: &mockDbClient{}},
+		{name: "no user ID", requestID: "foo", db: &mockDbClient{}},
+		{name: "failed query", requestID: "foo", userID: "bar", db: &mockDbClient{err: errors.New("foo")}},
+	}
+	for _, tt := range tests {
+		t.Run(
+			"shall fail given "+tt.name, func(t *testing.T) {
+				c := Client{c: tt.db, tableWritePrompt: "foo", tableFeedback: "bar"}
+				if _, err := c.WriteFeedback(context.TODO(), tt.requestID, tt.userID, 1, ""); err == nil {
+					t.Error("error expected")
+				}
+			},
+		)
+	}
+}
+
+func TestClient_ReadModelPrediction(t *testing.T) {
+	const (
+		requestID = "693a35ba-e42c-4168-8afc-5a7c359d1d05"
+		userID    = "c40bad11-0822-4d84-9f61-44b9a97b0432"
+	)
+
+	t.Run(
+		"shall read the prediction of the user's request", func(t *testing.T) {
+			// GIVEN
+			db := &mockDbClient{
+				v: &mockRows{s: &sync.RWMutex{}, v: [][]any{{`{"nodes":[{"id":"0"}]}`}}},
+			}
+			c := Client{c: db, tableWriteModelPrediction: "foo"}
+
+			// WHEN
+			prediction, found, err := c.ReadModelPrediction(context.TODO(), requestID, userID)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !found {
+				t.Error("the request shall be found")
+			}
+			if prediction != `{"nodes":[{"id":"0"}]}` {
+				t.Errorf("unexpected prediction: %s", prediction)
+			}
+			if want := `SELECT response FROM foo WHERE request_id = $1 AND user_id = $2`; db.query != want {
+				t.Errorf("unexpected query: %s", db.query)
+			}
+		},
+	)
+
+	t.Run(
+		"shall report the unknown request", func(t *testing.T) {
+			// GIVEN
+			c := Client{c: &mockDbClient{v: &mockRows{s: &sync.RWMutex{}}}, tableWriteModelPrediction: "foo"}
+
+			// WHEN
+			prediction, found, err := c.ReadModelPrediction(context.TODO(), requestID, userID)
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found || prediction != "" {
+				t.Error("the request shall not be found")
+			}
+		},
+	)
+
+	tests := []struct {
+		name              string
+		requestID, userID string
+		db                *mockDbClient
+	}{
+		{name: "no request ID", userID: userID, db: &mockDbClient{}},
+		{name: "no user ID", requestID: requestID, db: &mockDbClient{}},
+		{name: "failed query", requestID: requestID, userID: userID, db: &mockDbClient{err: errors.New("foo")}},
+	}
+	for _, tt := range tests {
+		t.Run(
+			"shall fail given "+tt.name, func(t *testing.T) {
+				c := Client{c: tt.db, tableWriteModelPrediction: "foo"}
+				if _, _, err := c.ReadModelPrediction(context.TODO(), tt.requestID, tt.userID); err == nil {
+					t.Error("error expected")
+				}
+			},
+		)
+	}
+}
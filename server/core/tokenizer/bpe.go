@@ -0,0 +1,177 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// encoding defines the byte pair encoding given the ranks of the tokens, the lower rank is merged first.
+type encoding struct {
+	ranks map[string]int
+}
+
+func (e *encoding) countTokens(text string) int {
+	var o int
+	for _, piece := range splitCL100K(text) {
+		if _, ok := e.ranks[piece]; ok {
+			o++
+			continue
+		}
+		o += e.countMerged(piece)
+	}
+	return o
+}
+
+// countMerged counts the tokens of the piece by merging its bytes pairwise in the order of the ranks.
+func (e *encoding) countMerged(piece string) int {
+	// boundaries of the tokens, the token i spans piece[boundaries[i]:boundaries[i+1]]
+	boundaries := make([]int, len(piece)+1)
+	for i := range boundaries {
+		boundaries[i] = i
+	}
+
+	for len(boundaries) > 2 {
+		minRank, minIndex := -1, -1
+		for i := 0; i < len(boundaries)-2; i++ {
+			rank, ok := e.ranks[piece[boundaries[i]:boundaries[i+2]]]
+			if ok && (minRank < 0 || rank < minRank) {
+				minRank, minIndex = rank, i
+			}
+		}
+		if minIndex < 0 {
+			break
+		}
+		boundaries = append(boundaries[:minIndex+1], boundaries[minIndex+2:]...)
+	}
+	return len(boundaries) - 1
+}
+
+// splitCL100K splits the text into the pieces encoded independently following the cl100k_base pattern:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// The pattern is matched manually because the standard library does not support the lookahead.
+func splitCL100K(text string) []string {
+	var o []string
+	for i := 0; i < len(text); {
+		n := matchCL100K(text[i:])
+		o = append(o, text[i:i+n])
+		i += n
+	}
+	return o
+}
+
+// matchCL100K returns the length of the pattern's leftmost alternative matching the beginning of the text.
+func matchCL100K(s string) int {
+	for _, match := range []func(string) int{
+		matchContraction, matchLetters, matchNumbers, matchPunctuation, matchWhitespaces,
+	} {
+		if n := match(s); n > 0 {
+			return n
+		}
+	}
+	// unreachable: every character is matched by one of the alternatives
+	_, n := utf8.DecodeRuneInString(s)
+	return n
+}
+
+// matchContraction matches (?i:'s|'t|'re|'ve|'m|'ll|'d).
+func matchContraction(s string) int {
+	if len(s) < 2 || s[0] != '\'' {
+		return 0
+	}
+	switch unicode.ToLower(rune(s[1])) {
+	case 's', 't', 'm', 'd':
+		return 2
+	}
+	if len(s) < 3 {
+		return 0
+	}
+	switch string(unicode.ToLower(rune(s[1]))) + string(unicode.ToLower(rune(s[2]))) {
+	case "re", "ve", "ll":
+		return 3
+	}
+	return 0
+}
+
+// matchLetters matches [^\r\n\p{L}\p{N}]?\p{L}+.
+func matchLetters(s string) int {
+	r, n := utf8.DecodeRuneInString(s)
+	var start int
+	if r != '\r' && r != '\n' && !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+		start = n
+	}
+	end := start + prefixLength(s[start:], unicode.IsLetter, -1)
+	if end == start {
+		return 0
+	}
+	return end
+}
+
+// matchNumbers matches \p{N}{1,3}.
+func matchNumbers(s string) int {
+	return prefixLength(s, unicode.IsNumber, 3)
+}
+
+// matchPunctuation matches ` ?[^\s\p{L}\p{N}]+[\r\n]*`.
+func matchPunctuation(s string) int {
+	var start int
+	if len(s) > 0 && s[0] == ' ' {
+		start = 1
+	}
+	end := start + prefixLength(s[start:], isPunctuation, -1)
+	if end == start {
+		return 0
+	}
+	return end + prefixLength(s[end:], isNewLine, -1)
+}
+
+// matchWhitespaces matches `\s*[\r\n]+|\s+(?!\S)|\s+`.
+func matchWhitespaces(s string) int {
+	end := prefixLength(s, unicode.IsSpace, -1)
+	if end == 0 {
+		return 0
+	}
+
+	// \s*[\r\n]+ spans up to the last new line of the whitespaces
+	lastNewLine := -1
+	for i, r := range s[:end] {
+		if isNewLine(r) {
+			lastNewLine = i
+		}
+	}
+	if lastNewLine >= 0 {
+		return lastNewLine + 1
+	}
+
+	// \s+(?!\S) leaves the last whitespace followed by the non-whitespace to prefix the next piece
+	if end < len(s) {
+		if _, n := utf8.DecodeLastRuneInString(s[:end]); end > n {
+			return end - n
+		}
+	}
+	return end
+}
+
+func isPunctuation(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+func isNewLine(r rune) bool {
+	return r == '\r' || r == '\n'
+}
+
+// prefixLength returns the length in bytes of the text's prefix with up to limit runes satisfying the condition,
+// the negative limit means no limit.
+func prefixLength(s string, fn func(r rune) bool, limit int) int {
+	var o, cnt int
+	for o < len(s) && cnt != limit {
+		r, n := utf8.DecodeRuneInString(s[o:])
+		if !fn(r) {
+			break
+		}
+		o += n
+		cnt++
+	}
+	return o
+}
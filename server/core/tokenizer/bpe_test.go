@@ -0,0 +1,58 @@
+package tokenizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_splitCL100K(t *testing.T) {
+	// the reference pieces are defined by the cl100k_base pattern
+	tests := map[string][]string{
+		"Hello, world!":   {"Hello", ",", " world", "!"},
+		"I'm here, We'LL": {"I", "'m", " here", ",", " We", "'LL"},
+		"12345":           {"123", "45"},
+		"foo  bar\n\nbaz": {"foo", " ", " bar", "\n\n", "baz"},
+		"trailing   ":     {"trailing", "   "},
+		"end.\n":          {"end", ".\n"},
+		` {"id":"0"}`:     {` {"`, "id", `":"`, "0", `"}`},
+		"привет мир":      {"привет", " мир"},
+		"":                nil,
+	}
+	for text, want := range tests {
+		t.Run(
+			text, func(t *testing.T) {
+				if got := splitCL100K(text); !reflect.DeepEqual(got, want) {
+					t.Errorf("unexpected pieces: got = %q, want = %q", got, want)
+				}
+			},
+		)
+	}
+}
+
+func Test_encoding_countTokens(t *testing.T) {
+	// GIVEN
+	enc := &encoding{ranks: map[string]int{"a": 0, "b": 1, "c": 2, "ab": 3, "abc": 4, " ab": 5, " ": 6}}
+
+	tests := map[string]int{
+		// the piece is the token
+		"abc": 1,
+		// ab + c + ab -> abc + ab
+		"abcab": 2,
+		// the lower rank is merged first: ab + c -> abc, hence " " + abc + d
+		" abcd": 3,
+		"":      0,
+	}
+	for text, want := range tests {
+		t.Run(
+			text, func(t *testing.T) {
+				// WHEN
+				got := enc.countTokens(text)
+
+				// THEN
+				if got != want {
+					t.Errorf("unexpected tokens count: got = %d, want = %d", got, want)
+				}
+			},
+		)
+	}
+}
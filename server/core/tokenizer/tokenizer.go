@@ -0,0 +1,229 @@
+// Package tokenizer counts the tokens of the text as the OpenAI models do, e.g. to budget the prompts.
+package tokenizer
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kislerdm/diagramastext/server/core/errors"
+)
+
+// EncodingCL100K the encoding of the models gpt-4 and gpt-3.5-turbo.
+const EncodingCL100K = "cl100k_base"
+
+// encodingsURL the location of the encodings' ranks published by OpenAI.
+const encodingsURL = "https://openaipublic.blob.core.windows.net/encodings/"
+
+// modelsEncodings maps the models to their encodings, the model's versions are matched by the prefix "{model}-".
+var modelsEncodings = map[string]string{
+	"gpt-4":                  EncodingCL100K,
+	"gpt-3.5-turbo":          EncodingCL100K,
+	"gpt-35-turbo":           EncodingCL100K,
+	"text-embedding-ada-002": EncodingCL100K,
+}
+
+// CountTokens counts the tokens of the text encoded for the model, e.g. gpt-3.5-turbo.
+// The encoding's ranks are fetched from OpenAI upon the first use unless they were loaded using LoadEncoding,
+// the encoding is cached per model afterwards. The special tokens, e.g. <|endoftext|>, are counted as the text.
+func CountTokens(model, text string) (int, error) {
+	enc, err := encodings.get(model)
+	if err != nil {
+		return 0, err
+	}
+	return enc.countTokens(text), nil
+}
+
+// LoadEncoding loads the ranks of the encoding, e.g. cl100k_base, from the file in the tiktoken format,
+// i.e. the lines of the base64-encoded token and its rank. It is used instead of fetching the ranks from OpenAI,
+// e.g. when the application runs without access to the internet.
+func LoadEncoding(name string, r io.Reader) error {
+	enc, err := readEncoding(r)
+	if err != nil {
+		return err
+	}
+
+	encodings.mu.Lock()
+	defer encodings.mu.Unlock()
+	encodings.byName[name] = enc
+	for model, v := range encodings.byModel {
+		if v.name == name {
+			delete(encodings.byModel, model)
+		}
+	}
+	return nil
+}
+
+// Warmup loads the encodings of the known models, e.g. upon the application's start,
+// so the first CountTokens call does not fetch them.
+func Warmup(ctx context.Context) error {
+	for model := range modelsEncodings {
+		if err := ctx.Err(); err != nil {
+			return errors.New(err.Error())
+		}
+		if _, err := encodings.get(model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tokenizer counts the tokens using CountTokens.
+type Tokenizer struct{}
+
+func (Tokenizer) CountTokens(model, text string) (int, error) {
+	return CountTokens(model, text)
+}
+
+var encodings = &encodingsCache{
+	byName:   map[string]*encoding{},
+	byModel:  map[string]cachedEncoding{},
+	fetching: map[string]*fetchCall{},
+	fetch:    fetchEncoding,
+}
+
+type encodingsCache struct {
+	mu      sync.Mutex
+	byName  map[string]*encoding
+	byModel map[string]cachedEncoding
+	// fetching the encodings being fetched by their names, the concurrent callers wait for the same fetch.
+	fetching map[string]*fetchCall
+	// fetch reads the encoding's ranks by its name.
+	fetch func(name string) (*encoding, error)
+}
+
+type fetchCall struct {
+	// done is closed once the fetch is completed.
+	done chan struct{}
+	enc  *encoding
+	err  error
+}
+
+type cachedEncoding struct {
+	name string
+	*encoding
+}
+
+// get returns the model's encoding. The encoding is fetched without holding the lock,
+// i.e. the cached encodings are read while the other encoding is being fetched.
+func (c *encodingsCache) get(model string) (*encoding, error) {
+	c.mu.Lock()
+	if v, ok := c.byModel[model]; ok {
+		c.mu.Unlock()
+		return v.encoding, nil
+	}
+
+	name, err := encodingName(model)
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	enc, ok := c.byName[name]
+	if !ok {
+		c.mu.Unlock()
+		if enc, err = c.fetchOnce(name); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+	}
+	c.byModel[model] = cachedEncoding{name: name, encoding: enc}
+	c.mu.Unlock()
+	return enc, nil
+}
+
+// fetchOnce fetches the encoding once for the concurrent callers, and caches it by the name.
+func (c *encodingsCache) fetchOnce(name string) (*encoding, error) {
+	c.mu.Lock()
+	if c.fetching == nil {
+		c.fetching = map[string]*fetchCall{}
+	}
+	if call, ok := c.fetching[name]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.enc, call.err
+	}
+	call := &fetchCall{done: make(chan struct{})}
+	c.fetching[name] = call
+	c.mu.Unlock()
+
+	enc, err := c.fetch(name)
+
+	c.mu.Lock()
+	// the encoding loaded while it was being fetched is kept, see LoadEncoding
+	if v, ok := c.byName[name]; ok {
+		enc, err = v, nil
+	} else if err == nil {
+		c.byName[name] = enc
+	}
+	call.enc, call.err = enc, err
+	delete(c.fetching, name)
+	c.mu.Unlock()
+	close(call.done)
+	return enc, err
+}
+
+func encodingName(model string) (string, error) {
+	if name, ok := modelsEncodings[model]; ok {
+		return name, nil
+	}
+	for prefix, name := range modelsEncodings {
+		if strings.HasPrefix(model, prefix+"-") {
+			return name, nil
+		}
+	}
+	return "", errors.New("unknown encoding of the model " + model)
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+func fetchEncoding(name string) (*encoding, error) {
+	resp, err := httpClient.Get(encodingsURL + name + ".tiktoken")
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("cannot fetch the encoding " + name + ", status code: " + strconv.Itoa(resp.StatusCode))
+	}
+	return readEncoding(resp.Body)
+}
+
+func readEncoding(r io.Reader) (*encoding, error) {
+	ranks := map[string]int{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, errors.New("wrong encoding format, line: " + line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, errors.New("wrong encoding format, line: " + line)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, errors.New("wrong encoding format, line: " + line)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New(err.Error())
+	}
+	if len(ranks) == 0 {
+		return nil, errors.New("encoding must contain ranks")
+	}
+	return &encoding{ranks: ranks}, nil
+}
@@ -0,0 +1,294 @@
+package tokenizer
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mockRanks the ranks in the tiktoken format.
+func mockRanks(tokens ...string) string {
+	var o strings.Builder
+	for i, token := range tokens {
+		o.WriteString(base64.StdEncoding.EncodeToString([]byte(token)) + " " + strconv.Itoa(i) + "\n")
+	}
+	return o.String()
+}
+
+// mockEncodings replaces the cache of the encodings, and counts the fetched encodings.
+func mockEncodings(t *testing.T, err error, tokens ...string) *int {
+	var fetched int
+	original := encodings
+	encodings = &encodingsCache{
+		byName:   map[string]*encoding{},
+		byModel:  map[string]cachedEncoding{},
+		fetching: map[string]*fetchCall{},
+		fetch: func(_ string) (*encoding, error) {
+			fetched++
+			if err != nil {
+				return nil, err
+			}
+			return readEncoding(strings.NewReader(mockRanks(tokens...)))
+		},
+	}
+	t.Cleanup(func() { encodings = original })
+	return &fetched
+}
+
+func TestCountTokens(t *testing.T) {
+	t.Run(
+		"shall count the tokens and cache the encoding", func(t *testing.T) {
+			// GIVEN
+			fetched := mockEncodings(t, nil, "d", "i", "a", "g", "r", "m", " ", "di", "ag", "ra", "ram", "diag")
+
+			// WHEN
+			// the models share the encoding
+			var got []int
+			for _, model := range []string{"gpt-3.5-turbo", "gpt-3.5-turbo", "gpt-4-0613"} {
+				n, err := CountTokens(model, "diagram diag")
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, n)
+			}
+
+			// THEN
+			// diagram -> di + ag + ra + m -> di + ag + ram -> diag + ram, and " diag" -> " " + diag
+			for _, n := range got {
+				if n != 4 {
+					t.Errorf("unexpected tokens count: %d", n)
+				}
+			}
+			if *fetched != 1 {
+				t.Errorf("the encoding shall be fetched once, got: %d", *fetched)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given unknown model", func(t *testing.T) {
+			// GIVEN
+			mockEncodings(t, nil, "a")
+
+			// WHEN
+			_, err := CountTokens("foo", "bar")
+
+			// THEN
+			if err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+
+	t.Run(
+		"shall not cache the failed fetch", func(t *testing.T) {
+			// GIVEN
+			fetched := mockEncodings(t, errors.New("foo"))
+
+			// WHEN
+			_, err0 := CountTokens("gpt-4", "bar")
+			_, err1 := CountTokens("gpt-4", "bar")
+
+			// THEN
+			if err0 == nil || err1 == nil {
+				t.Error("error expected")
+			}
+			if *fetched != 2 {
+				t.Errorf("the encoding shall be fetched on every call, got: %d", *fetched)
+			}
+		},
+	)
+}
+
+func TestCountTokens_Concurrent(t *testing.T) {
+	// GIVEN
+	gate := make(chan struct{})
+	var fetched int32
+	original := encodings
+	encodings = &encodingsCache{
+		byName:   map[string]*encoding{},
+		byModel:  map[string]cachedEncoding{},
+		fetching: map[string]*fetchCall{},
+		fetch: func(_ string) (*encoding, error) {
+			atomic.AddInt32(&fetched, 1)
+			<-gate
+			return readEncoding(strings.NewReader(mockRanks("a")))
+		},
+	}
+	t.Cleanup(func() { encodings = original })
+
+	// WHEN
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for _, model := range []string{"gpt-4", "gpt-4", "gpt-3.5-turbo", "gpt-4-0613"} {
+		wg.Add(1)
+		go func(model string) {
+			defer wg.Done()
+			_, err := CountTokens(model, "a")
+			errs <- err
+		}(model)
+	}
+	for atomic.LoadInt32(&fetched) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// THEN
+	// the cache is not locked while the encoding is being fetched
+	loaded := make(chan error, 1)
+	go func() {
+		loaded <- LoadEncoding("foo", strings.NewReader(mockRanks("a")))
+	}()
+	select {
+	case err := <-loaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("the encoding shall be loaded while the other encoding is being fetched")
+	}
+
+	close(gate)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&fetched); n != 1 {
+		t.Errorf("the encoding shall be fetched once for the concurrent callers, got: %d", n)
+	}
+}
+
+// TestCountTokens_Reference compares the tokens count to the reference of tiktoken.
+// It requires the encoding cl100k_base in the tiktoken format, e.g. downloaded from
+// https://openaipublic.blob.core.windows.net/encodings/cl100k_base.tiktoken, set by TOKENIZER_ENCODING_FILE.
+func TestCountTokens_Reference(t *testing.T) {
+	path := os.Getenv("TOKENIZER_ENCODING_FILE")
+	if path == "" {
+		t.Skip("TOKENIZER_ENCODING_FILE is not set")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	mockEncodings(t, errors.New("the encoding shall not be fetched"))
+	if err := LoadEncoding(EncodingCL100K, f); err != nil {
+		t.Fatal(err)
+	}
+
+	// see: https://github.com/openai/openai-cookbook/blob/main/examples/How_to_count_tokens_with_tiktoken.ipynb
+	for text, want := range map[string]int{
+		"hello world":                  2,
+		"tiktoken is great!":           6,
+		"antidisestablishmentarianism": 6,
+		"2 + 2 = 4":                    7,
+		"お誕生日おめでとう":                    9,
+	} {
+		t.Run(
+			text, func(t *testing.T) {
+				got, err := CountTokens("gpt-3.5-turbo", text)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("unexpected tokens count: got = %d, want = %d", got, want)
+				}
+			},
+		)
+	}
+}
+
+func TestLoadEncoding(t *testing.T) {
+	t.Run(
+		"shall use the loaded encoding instead of the cached one", func(t *testing.T) {
+			// GIVEN
+			fetched := mockEncodings(t, nil, "a")
+			if _, err := CountTokens("gpt-3.5-turbo", "ab"); err != nil {
+				t.Fatal(err)
+			}
+
+			// WHEN
+			err := LoadEncoding(EncodingCL100K, strings.NewReader(mockRanks("a", "b", "ab")))
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Tokenizer{}.CountTokens("gpt-3.5-turbo", "ab")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != 1 {
+				t.Errorf("unexpected tokens count: %d", got)
+			}
+			if *fetched != 1 {
+				t.Errorf("the loaded encoding shall not be fetched, got: %d", *fetched)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail given invalid ranks", func(t *testing.T) {
+			mockEncodings(t, nil)
+			for name, ranks := range map[string]string{
+				"empty":          "",
+				"missing rank":   "YQ==",
+				"invalid base64": "a 0",
+				"invalid rank":   "YQ== a",
+			} {
+				t.Run(
+					name, func(t *testing.T) {
+						if err := LoadEncoding(EncodingCL100K, strings.NewReader(ranks)); err == nil {
+							t.Error("error expected")
+						}
+					},
+				)
+			}
+		},
+	)
+}
+
+func TestWarmup(t *testing.T) {
+	t.Run(
+		"shall load the encodings before counting the tokens", func(t *testing.T) {
+			// GIVEN
+			fetched := mockEncodings(t, nil, "a")
+
+			// WHEN
+			err := Warmup(context.TODO())
+
+			// THEN
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *fetched != 1 {
+				t.Errorf("the shared encoding shall be fetched once, got: %d", *fetched)
+			}
+			if _, err := CountTokens("gpt-4", "a"); err != nil {
+				t.Fatal(err)
+			}
+			if *fetched != 1 {
+				t.Errorf("the encoding shall not be fetched after warm-up, got: %d", *fetched)
+			}
+		},
+	)
+
+	t.Run(
+		"shall fail if the encoding cannot be fetched", func(t *testing.T) {
+			mockEncodings(t, errors.New("foo"))
+			if err := Warmup(context.TODO()); err == nil {
+				t.Error("error expected")
+			}
+		},
+	)
+}
@@ -9,6 +9,9 @@ resource "aws_api_gateway_rest_api" "this" {
   name           = "main${local.suffix}"
   api_key_source = "HEADER"
 
+  # the lambda responses of the media types are base64-encoded, and decoded by the gateway
+  binary_media_types = ["image/png", "application/pdf"]
+
   endpoint_configuration {
     types = ["REGIONAL"]
   }
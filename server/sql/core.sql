@@ -2,24 +2,38 @@ CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 
 CREATE TABLE IF NOT EXISTS user_prompts
 (
-    request_id UUID      NOT NULL PRIMARY KEY,
-    user_id    UUID      NOT NULL,
-    prompt     TEXT      NOT NULL,
-    timestamp  TIMESTAMP NOT NULL DEFAULT NOW()
+    request_id     UUID      NOT NULL PRIMARY KEY,
+    user_id        UUID      NOT NULL,
+    prompt         TEXT      NOT NULL,
+    timestamp      TIMESTAMP NOT NULL DEFAULT NOW(),
+    user_agent     TEXT,
+    client_version TEXT
 );
 
+ALTER TABLE user_prompts
+    ADD COLUMN IF NOT EXISTS user_agent     TEXT,
+    ADD COLUMN IF NOT EXISTS client_version TEXT;
+
+CREATE INDEX IF NOT EXISTS ind_user_prompts_user_id_timestamp ON user_prompts (user_id, timestamp);
+
 CREATE TABLE IF NOT EXISTS openai_responses
 (
-    request_id        UUID      NOT NULL PRIMARY KEY REFERENCES user_prompts (request_id),
-    user_id           UUID      NOT NULL,
-    response_raw      TEXT      NOT NULL,
-    response          TEXT      NOT NULL,
-    prompt_tokens     SMALLINT  NOT NULL,
-    completion_tokens SMALLINT  NOT NULL,
-    model_id          TEXT      NOT NULL,
-    timestamp         TIMESTAMP NOT NULL DEFAULT NOW()
+    request_id         UUID      NOT NULL PRIMARY KEY REFERENCES user_prompts (request_id),
+    user_id            UUID      NOT NULL,
+    response_raw       TEXT      NOT NULL,
+    response           TEXT      NOT NULL,
+    prompt_tokens      SMALLINT  NOT NULL,
+    completion_tokens  SMALLINT  NOT NULL,
+    model_id           TEXT      NOT NULL,
+    timestamp          TIMESTAMP NOT NULL DEFAULT NOW(),
+    experiment_variant TEXT
 );
 
+ALTER TABLE openai_responses
+    ADD COLUMN IF NOT EXISTS experiment_variant TEXT;
+
+CREATE INDEX IF NOT EXISTS ind_openai_responses_user_id_timestamp ON openai_responses (user_id, timestamp);
+
 CREATE TABLE IF NOT EXISTS users
 (
     user_id         UUID      NOT NULL PRIMARY KEY,
@@ -74,3 +88,14 @@ CREATE TABLE IF NOT EXISTS user_auth_secrets
     created_at TIMESTAMP NOT NULL
 )
 ;
+
+CREATE INDEX IF NOT EXISTS ind_user_auth_secrets_created_at ON user_auth_secrets (created_at);
+
+CREATE TABLE IF NOT EXISTS user_feedback
+(
+    request_id UUID      NOT NULL PRIMARY KEY REFERENCES user_prompts (request_id),
+    user_id    UUID      NOT NULL,
+    rating     SMALLINT  NOT NULL,
+    comment    TEXT,
+    timestamp  TIMESTAMP NOT NULL DEFAULT NOW()
+);